@@ -6,6 +6,7 @@ package ast
 
 import (
 	"fmt"
+	"net"
 	"sort"
 	"strings"
 
@@ -37,8 +38,21 @@ type IndexResult struct {
 	Else      map[*Rule][]*Rule
 	Default   *Rule
 	EarlyExit bool
+
+	// Hits counts the index nodes that matched during the lookup for each
+	// kind of condition other than equality, i.e., IndexHitPrefix,
+	// IndexHitGlob, IndexHitCIDR and IndexHitRange.
+	Hits map[string]int
 }
 
+// Kinds of conditions reported in IndexResult.Hits.
+const (
+	IndexHitPrefix = "prefix"
+	IndexHitGlob   = "glob"
+	IndexHitCIDR   = "cidr"
+	IndexHitRange  = "range"
+)
+
 // NewIndexResult returns a new IndexResult object.
 func NewIndexResult(kind DocKind) *IndexResult {
 	return &IndexResult{
@@ -109,7 +123,11 @@ func (i *baseDocEqIndex) Build(rules []*Rule) bool {
 			node := i.root
 			if indices.Indexed(rule) {
 				for _, ref := range indices.Sorted() {
-					node = node.Insert(ref, indices.Value(rule, ref), indices.Mapper(rule, ref))
+					if cond := indices.Cond(rule, ref); cond != nil {
+						node = node.InsertCond(ref, cond)
+					} else {
+						node = node.Insert(ref, indices.Value(rule, ref), indices.Mapper(rule, ref))
+					}
 				}
 			}
 			// Insert rule into trie with (insertion order, priority order)
@@ -153,6 +171,7 @@ func (i *baseDocEqIndex) Lookup(resolver ValueResolver) (*IndexResult, error) {
 	}
 
 	result.EarlyExit = tr.values.Len() == 1 && tr.values.Slice()[0].IsGround()
+	result.Hits = tr.hits
 
 	return result, nil
 }
@@ -207,6 +226,20 @@ type refindex struct {
 	Ref    Ref
 	Value  Value
 	Mapper *valueMapper
+	Cond   *indexCond
+}
+
+// indexCond represents a condition other than equality that a rule places on
+// a reference, e.g., startswith(input.path, "/api/"). Rules with conditions
+// are stored in dedicated structures of the trie node for the reference so
+// that lookups only visit the rules whose condition holds.
+type indexCond struct {
+	kind      string     // one of the IndexHit* constants
+	prefix    string     // IndexHitPrefix, IndexHitGlob
+	cidr      *net.IPNet // IndexHitCIDR
+	bound     Value      // IndexHitRange
+	upper     bool       // IndexHitRange: ref < bound (or <=) instead of ref > bound (or >=)
+	inclusive bool       // IndexHitRange
 }
 
 type refindices struct {
@@ -256,6 +289,21 @@ func (i *refindices) Update(rule *Rule, expr *Expr) {
 		i.updateEq(rule, expr)
 	} else if op.Equal(GlobMatch.Ref()) {
 		i.updateGlobMatch(rule, expr)
+	} else if op.Equal(StartsWith.Ref()) && len(expr.Operands()) == 2 {
+		i.updateStartsWith(rule, expr)
+	} else if op.Equal(NetCIDRContains.Ref()) && len(expr.Operands()) == 2 {
+		i.updateCIDRContains(rule, expr)
+	} else if len(expr.Operands()) == 2 {
+		switch {
+		case op.Equal(GreaterThan.Ref()):
+			i.updateRange(rule, expr, false, false)
+		case op.Equal(GreaterThanEq.Ref()):
+			i.updateRange(rule, expr, false, true)
+		case op.Equal(LessThan.Ref()):
+			i.updateRange(rule, expr, true, false)
+		case op.Equal(LessThanEq.Ref()):
+			i.updateRange(rule, expr, true, true)
+		}
 	}
 }
 
@@ -305,6 +353,13 @@ func (i *refindices) Mapper(rule *Rule, ref Ref) *valueMapper {
 	return nil
 }
 
+func (i *refindices) Cond(rule *Rule, ref Ref) *indexCond {
+	if index := i.index(rule, ref); index != nil {
+		return index.Cond
+	}
+	return nil
+}
+
 func (i *refindices) updateEq(rule *Rule, expr *Expr) {
 	a, b := expr.Operand(0), expr.Operand(1)
 	args := rule.Head.Args
@@ -326,42 +381,120 @@ func (i *refindices) updateGlobMatch(rule *Rule, expr *Expr) {
 		return
 	}
 
+	// The 3rd operand of glob.match is the value to match.
+	ref := i.operandRef(rule, args, expr.Operand(2))
+	if ref == nil {
+		return
+	}
+
 	if arr := globPatternToArray(expr.Operand(0), delim); arr != nil {
-		// The 3rd operand of glob.match is the value to match. We assume the
-		// 3rd operand was a reference that has been rewritten and bound to a
-		// variable earlier in the query OR a function argument variable.
-		match := expr.Operand(2)
-		if _, ok := match.Value.(Var); ok {
-			var ref Ref
-			for _, other := range i.rules[rule] {
-				if _, ok := other.Value.(Var); ok && other.Value.Compare(match.Value) == 0 {
-					ref = other.Ref
-				}
-			}
-			if ref == nil {
-				for j, arg := range args {
-					if arg.Equal(match) {
-						ref = Ref{FunctionArgRootDocument, IntNumberTerm(j)}
+		i.insert(rule, &refindex{
+			Ref:   ref,
+			Value: arr.Value,
+			Mapper: &valueMapper{
+				Key: delim,
+				MapValue: func(v Value) Value {
+					if s, ok := v.(String); ok {
+						return stringSliceToArray(splitStringEscaped(string(s), delim))
 					}
-				}
-			}
-			if ref != nil {
-				i.insert(rule, &refindex{
-					Ref:   ref,
-					Value: arr.Value,
-					Mapper: &valueMapper{
-						Key: delim,
-						MapValue: func(v Value) Value {
-							if s, ok := v.(String); ok {
-								return stringSliceToArray(splitStringEscaped(string(s), delim))
-							}
-							return v
-						},
-					},
-				})
+					return v
+				},
+			},
+		})
+		return
+	}
+
+	// Patterns that cannot be split into segments (e.g., because they contain
+	// super globs or character classes) are indexed on their literal prefix.
+	if prefix, ok := globPatternLiteralPrefix(expr.Operand(0)); ok {
+		i.insertCond(rule, ref, &indexCond{kind: IndexHitGlob, prefix: prefix})
+	}
+}
+
+func (i *refindices) updateStartsWith(rule *Rule, expr *Expr) {
+
+	prefix, ok := expr.Operand(1).Value.(String)
+	if !ok {
+		return
+	}
+
+	if ref := i.operandRef(rule, rule.Head.Args, expr.Operand(0)); ref != nil {
+		i.insertCond(rule, ref, &indexCond{kind: IndexHitPrefix, prefix: string(prefix)})
+	}
+}
+
+func (i *refindices) updateCIDRContains(rule *Rule, expr *Expr) {
+
+	s, ok := expr.Operand(0).Value.(String)
+	if !ok {
+		return
+	}
+
+	_, cidr, err := net.ParseCIDR(string(s))
+	if err != nil || !cidrIndexable(cidr) {
+		return
+	}
+
+	if ref := i.operandRef(rule, rule.Head.Args, expr.Operand(1)); ref != nil {
+		i.insertCond(rule, ref, &indexCond{kind: IndexHitCIDR, cidr: cidr})
+	}
+}
+
+func (i *refindices) updateRange(rule *Rule, expr *Expr, upper, inclusive bool) {
+
+	a, b := expr.Operand(0), expr.Operand(1)
+	args := rule.Head.Args
+
+	// If the constant is on the left-hand side, the comparison is flipped,
+	// e.g., 10 < x is equivalent to x > 10.
+	if IsScalar(b.Value) {
+		if ref := i.operandRef(rule, args, a); ref != nil {
+			i.insertCond(rule, ref, &indexCond{kind: IndexHitRange, bound: b.Value, upper: upper, inclusive: inclusive})
+		}
+	} else if IsScalar(a.Value) {
+		if ref := i.operandRef(rule, args, b); ref != nil {
+			i.insertCond(rule, ref, &indexCond{kind: IndexHitRange, bound: a.Value, upper: !upper, inclusive: inclusive})
+		}
+	}
+}
+
+// operandRef returns the reference that the call operand x refers to. We
+// assume the operand was a reference that has been rewritten and bound to a
+// variable earlier in the query OR a function argument variable.
+func (i *refindices) operandRef(rule *Rule, args []*Term, x *Term) Ref {
+
+	if _, ok := x.Value.(Var); !ok {
+		return nil
+	}
+
+	var ref Ref
+
+	for _, other := range i.rules[rule] {
+		if _, ok := other.Value.(Var); ok && other.Value.Compare(x.Value) == 0 {
+			ref = other.Ref
+		}
+	}
+
+	if ref == nil {
+		for j, arg := range args {
+			if arg.Equal(x) {
+				ref = Ref{FunctionArgRootDocument, IntNumberTerm(j)}
 			}
 		}
 	}
+
+	return ref
+}
+
+// insertCond adds a condition on ref to the rule's indices. Conditions do not
+// replace equality indices on the same ref because those are more selective.
+func (i *refindices) insertCond(rule *Rule, ref Ref, cond *indexCond) {
+	if other := i.index(rule, ref); other != nil && other.Cond == nil {
+		if _, ok := other.Value.(Var); !ok {
+			return
+		}
+	}
+	i.insert(rule, &refindex{Ref: ref, Cond: cond})
 }
 
 func (i *refindices) insert(rule *Rule, index *refindex) {
@@ -400,6 +533,7 @@ type trieTraversalResult struct {
 	unordered map[int][]*ruleNode
 	ordering  []int
 	values    Set
+	hits      map[string]int
 }
 
 func newTrieTraversalResult() *trieTraversalResult {
@@ -423,6 +557,13 @@ func (tr *trieTraversalResult) Add(t *trieNode) {
 	}
 }
 
+func (tr *trieTraversalResult) hit(kind string) {
+	if tr.hits == nil {
+		tr.hits = map[string]int{}
+	}
+	tr.hits[kind]++
+}
+
 type trieNode struct {
 	ref       Ref
 	values    Set
@@ -432,6 +573,10 @@ type trieNode struct {
 	undefined *trieNode
 	scalars   map[Value]*trieNode
 	array     *trieNode
+	prefixes  *prefixTree
+	globs     *prefixTree
+	cidrs     *cidrIndex
+	ranges    *rangeIndex
 	rules     []*ruleNode
 }
 
@@ -453,6 +598,18 @@ func (node *trieNode) String() string {
 	if node.array != nil {
 		flags = append(flags, fmt.Sprintf("array:%p", node.array))
 	}
+	if node.prefixes != nil {
+		flags = append(flags, fmt.Sprintf("prefixes:%d", node.prefixes.size()))
+	}
+	if node.globs != nil {
+		flags = append(flags, fmt.Sprintf("globs:%d", node.globs.size()))
+	}
+	if node.cidrs != nil {
+		flags = append(flags, fmt.Sprintf("cidrs:%d", node.cidrs.size()))
+	}
+	if node.ranges != nil {
+		flags = append(flags, fmt.Sprintf("ranges:%d", node.ranges.size()))
+	}
 	if len(node.scalars) > 0 {
 		buf := make([]string, 0, len(node.scalars))
 		for k, v := range node.scalars {
@@ -514,11 +671,31 @@ func (node *trieNode) Do(walker trieWalker) {
 	if node.array != nil {
 		node.array.Do(next)
 	}
+	node.eachCondChild(func(_ string, child *trieNode) {
+		child.Do(next)
+	})
 	if node.next != nil {
 		node.next.Do(next)
 	}
 }
 
+// eachCondChild invokes f on every child of node stored in a condition
+// structure.
+func (node *trieNode) eachCondChild(f func(kind string, child *trieNode)) {
+	if node.prefixes != nil {
+		node.prefixes.each(func(child *trieNode) { f(IndexHitPrefix, child) })
+	}
+	if node.globs != nil {
+		node.globs.each(func(child *trieNode) { f(IndexHitGlob, child) })
+	}
+	if node.cidrs != nil {
+		node.cidrs.each(func(child *trieNode) { f(IndexHitCIDR, child) })
+	}
+	if node.ranges != nil {
+		node.ranges.each(func(child *trieNode) { f(IndexHitRange, child) })
+	}
+}
+
 func (node *trieNode) Insert(ref Ref, value Value, mapper *valueMapper) *trieNode {
 
 	if node.next == nil {
@@ -533,6 +710,46 @@ func (node *trieNode) Insert(ref Ref, value Value, mapper *valueMapper) *trieNod
 	return node.next.insertValue(value)
 }
 
+// InsertCond is like Insert except the rule places cond on ref instead of
+// requiring ref to equal a value.
+func (node *trieNode) InsertCond(ref Ref, cond *indexCond) *trieNode {
+
+	if node.next == nil {
+		node.next = newTrieNodeImpl()
+		node.next.ref = ref
+	}
+
+	return node.next.insertCond(cond)
+}
+
+func (node *trieNode) insertCond(cond *indexCond) *trieNode {
+
+	switch cond.kind {
+	case IndexHitPrefix:
+		if node.prefixes == nil {
+			node.prefixes = newPrefixTree()
+		}
+		return node.prefixes.insert(cond.prefix)
+	case IndexHitGlob:
+		if node.globs == nil {
+			node.globs = newPrefixTree()
+		}
+		return node.globs.insert(cond.prefix)
+	case IndexHitCIDR:
+		if node.cidrs == nil {
+			node.cidrs = &cidrIndex{}
+		}
+		return node.cidrs.insert(cond.cidr)
+	case IndexHitRange:
+		if node.ranges == nil {
+			node.ranges = &rangeIndex{}
+		}
+		return node.ranges.insert(cond.bound, cond.upper, cond.inclusive)
+	}
+
+	panic("illegal condition")
+}
+
 func (node *trieNode) Traverse(resolver ValueResolver, tr *trieTraversalResult) error {
 
 	if node == nil {
@@ -649,7 +866,55 @@ func (node *trieNode) traverse(resolver ValueResolver, tr *trieTraversalResult)
 		}
 	}
 
-	return nil
+	return node.traverseConds(resolver, tr, v)
+}
+
+// traverseConds visits the children of node whose conditions hold for value.
+// If the conditions cannot be checked against value (e.g., startswith on a
+// number), all children of that kind are visited so that evaluation reports
+// the same errors as it would without indexing.
+func (node *trieNode) traverseConds(resolver ValueResolver, tr *trieTraversalResult, value Value) error {
+
+	var err error
+
+	visit := func(kind string) func(*trieNode) {
+		return func(child *trieNode) {
+			if err == nil {
+				tr.hit(kind)
+				err = child.Traverse(resolver, tr)
+			}
+		}
+	}
+
+	s, isString := value.(String)
+
+	if node.prefixes != nil {
+		if isString {
+			node.prefixes.match(string(s), visit(IndexHitPrefix))
+		} else {
+			node.prefixes.each(visit(IndexHitPrefix))
+		}
+	}
+
+	if node.globs != nil {
+		if isString {
+			node.globs.match(string(s), visit(IndexHitGlob))
+		} else {
+			node.globs.each(visit(IndexHitGlob))
+		}
+	}
+
+	if node.cidrs != nil {
+		if !isString || !node.cidrs.match(string(s), visit(IndexHitCIDR)) {
+			node.cidrs.each(visit(IndexHitCIDR))
+		}
+	}
+
+	if node.ranges != nil {
+		node.ranges.match(value, visit(IndexHitRange))
+	}
+
+	return err
 }
 
 func (node *trieNode) traverseValue(resolver ValueResolver, tr *trieTraversalResult, value Value) error {
@@ -727,7 +992,15 @@ func (node *trieNode) traverseUnknown(resolver ValueResolver, tr *trieTraversalR
 		}
 	}
 
-	return nil
+	var err error
+
+	node.eachCondChild(func(_ string, child *trieNode) {
+		if err == nil {
+			err = child.traverseUnknown(resolver, tr)
+		}
+	})
+
+	return err
 }
 
 // If term `a` is one of the function's operands, we store a Ref: `args[0]`
@@ -851,6 +1124,41 @@ func globPatternToArray(pattern *Term, delim string) *Term {
 	return NewTerm(NewArray(arr...))
 }
 
+// globPatternLiteralPrefix returns the literal characters at the start of a
+// glob pattern, i.e., everything up to the first unescaped special character.
+// Every string matched by the pattern starts with the prefix.
+func globPatternLiteralPrefix(pattern *Term) (string, bool) {
+
+	s, ok := pattern.Value.(String)
+	if !ok {
+		return "", false
+	}
+
+	var prefix strings.Builder
+	var escaped bool
+
+	for _, c := range string(s) {
+		if escaped {
+			prefix.WriteRune(c)
+			escaped = false
+			continue
+		}
+		switch c {
+		case '\\':
+			escaped = true
+			continue
+		case '*', '?', '[', '{':
+			return prefix.String(), prefix.Len() > 0
+		}
+		prefix.WriteRune(c)
+	}
+
+	// Patterns without special characters could have been split into
+	// segments so we should not get here, but an exact match is still a
+	// prefix match.
+	return prefix.String(), !escaped
+}
+
 // splits s on characters in delim except if delim characters have been escaped
 // with reverse solidus.
 func splitStringEscaped(s string, delim string) []string {
@@ -882,3 +1190,292 @@ func stringSliceToArray(s []string) *Array {
 	}
 	return NewArray(arr...)
 }
+
+// prefixTree is a radix tree of string prefixes. Each prefix inserted into the
+// tree is associated with a trie node holding the rules that require the value
+// of a reference to start with the prefix.
+type prefixTree struct {
+	node     *trieNode
+	children map[byte]*prefixEdge
+}
+
+type prefixEdge struct {
+	label string
+	tree  *prefixTree
+}
+
+func newPrefixTree() *prefixTree {
+	return &prefixTree{}
+}
+
+func (t *prefixTree) insert(prefix string) *trieNode {
+
+	if prefix == "" {
+		if t.node == nil {
+			t.node = newTrieNodeImpl()
+		}
+		return t.node
+	}
+
+	if t.children == nil {
+		t.children = map[byte]*prefixEdge{}
+	}
+
+	edge, ok := t.children[prefix[0]]
+	if !ok {
+		edge = &prefixEdge{label: prefix, tree: newPrefixTree()}
+		t.children[prefix[0]] = edge
+		return edge.tree.insert("")
+	}
+
+	var n int
+	for n < len(prefix) && n < len(edge.label) && prefix[n] == edge.label[n] {
+		n++
+	}
+
+	if n < len(edge.label) {
+		// Split the edge at the end of the common prefix.
+		mid := newPrefixTree()
+		mid.children = map[byte]*prefixEdge{
+			edge.label[n]: {label: edge.label[n:], tree: edge.tree},
+		}
+		edge.label = edge.label[:n]
+		edge.tree = mid
+	}
+
+	return edge.tree.insert(prefix[n:])
+}
+
+// match invokes f on the nodes of all prefixes of s.
+func (t *prefixTree) match(s string, f func(*trieNode)) {
+	for t != nil {
+		if t.node != nil {
+			f(t.node)
+		}
+		if len(s) == 0 {
+			return
+		}
+		edge, ok := t.children[s[0]]
+		if !ok || !strings.HasPrefix(s, edge.label) {
+			return
+		}
+		s = s[len(edge.label):]
+		t = edge.tree
+	}
+}
+
+func (t *prefixTree) each(f func(*trieNode)) {
+	if t.node != nil {
+		f(t.node)
+	}
+	keys := make([]int, 0, len(t.children))
+	for k := range t.children {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		t.children[byte(k)].tree.each(f)
+	}
+}
+
+func (t *prefixTree) size() int {
+	var n int
+	t.each(func(*trieNode) { n++ })
+	return n
+}
+
+// cidrIndex holds binary radix trees of IPv4 and IPv6 networks. Each network
+// is associated with a trie node holding the rules that require the value of a
+// reference to be an address or network contained in it.
+type cidrIndex struct {
+	v4 *cidrTree
+	v6 *cidrTree
+}
+
+type cidrTree struct {
+	node     *trieNode
+	children [2]*cidrTree
+}
+
+// cidrIndexable returns true if the network is in a form whose containment
+// checks can be answered by the index. Networks written as IPv4-mapped IPv6
+// addresses are excluded since net.IPNet treats them specially.
+func cidrIndexable(cidr *net.IPNet) bool {
+	return len(cidr.IP) == len(cidr.Mask) && (len(cidr.IP) == net.IPv4len || cidr.IP.To4() == nil)
+}
+
+func (idx *cidrIndex) insert(cidr *net.IPNet) *trieNode {
+
+	ones, _ := cidr.Mask.Size()
+	root := &idx.v6
+	if len(cidr.IP) == net.IPv4len {
+		root = &idx.v4
+	}
+
+	if *root == nil {
+		*root = &cidrTree{}
+	}
+
+	t := *root
+
+	for i := 0; i < ones; i++ {
+		bit := ipBit(cidr.IP, i)
+		if t.children[bit] == nil {
+			t.children[bit] = &cidrTree{}
+		}
+		t = t.children[bit]
+	}
+
+	if t.node == nil {
+		t.node = newTrieNodeImpl()
+	}
+
+	return t.node
+}
+
+// match invokes f on the nodes of all networks that contain s, where s is an
+// IP address or a network in CIDR notation. If s cannot be parsed, match
+// returns false.
+func (idx *cidrIndex) match(s string, f func(*trieNode)) bool {
+
+	var ip net.IP
+	var ones int
+
+	if ip = net.ParseIP(s); ip == nil {
+		var cidr *net.IPNet
+		var err error
+		if _, cidr, err = net.ParseCIDR(s); err != nil {
+			return false
+		}
+		ip = cidr.IP
+		ones, _ = cidr.Mask.Size()
+	} else {
+		ones = len(ip) * 8
+	}
+
+	t := idx.v6
+	if ip4 := ip.To4(); ip4 != nil {
+		// net.IPNet.Contains treats IPv4-mapped IPv6 addresses as IPv4.
+		ones -= (len(ip) - len(ip4)) * 8
+		ip = ip4
+		t = idx.v4
+	}
+
+	for i := 0; t != nil; i++ {
+		if t.node != nil {
+			f(t.node)
+		}
+		if i >= ones {
+			break
+		}
+		t = t.children[ipBit(ip, i)]
+	}
+
+	return true
+}
+
+func (idx *cidrIndex) each(f func(*trieNode)) {
+	idx.v4.each(f)
+	idx.v6.each(f)
+}
+
+func (idx *cidrIndex) size() int {
+	var n int
+	idx.each(func(*trieNode) { n++ })
+	return n
+}
+
+func (t *cidrTree) each(f func(*trieNode)) {
+	if t == nil {
+		return
+	}
+	if t.node != nil {
+		f(t.node)
+	}
+	t.children[0].each(f)
+	t.children[1].each(f)
+}
+
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// rangeIndex holds the bounds of comparisons between a reference and a
+// constant. Bounds are kept sorted so that lookups can find the satisfied
+// comparisons with a binary search. Values are compared with the same total
+// order as the comparison built-in functions.
+type rangeIndex struct {
+	lower []*rangeBound // ref > bound, ref >= bound
+	upper []*rangeBound // ref < bound, ref <= bound
+}
+
+type rangeBound struct {
+	bound     Value
+	inclusive bool
+	node      *trieNode
+}
+
+func (idx *rangeIndex) insert(bound Value, upper, inclusive bool) *trieNode {
+
+	bounds := &idx.lower
+	if upper {
+		bounds = &idx.upper
+	}
+
+	pos := sort.Search(len(*bounds), func(i int) bool {
+		if c := Compare((*bounds)[i].bound, bound); c != 0 {
+			return c > 0
+		}
+		return !(*bounds)[i].inclusive || inclusive
+	})
+
+	if pos < len(*bounds) && Compare((*bounds)[pos].bound, bound) == 0 && (*bounds)[pos].inclusive == inclusive {
+		return (*bounds)[pos].node
+	}
+
+	rb := &rangeBound{bound: bound, inclusive: inclusive, node: newTrieNodeImpl()}
+	*bounds = append(*bounds, nil)
+	copy((*bounds)[pos+1:], (*bounds)[pos:])
+	(*bounds)[pos] = rb
+
+	return rb.node
+}
+
+// match invokes f on the nodes of all comparisons that hold for value.
+func (idx *rangeIndex) match(value Value, f func(*trieNode)) {
+
+	// Lower bounds are satisfied if they are less than the value (or equal
+	// to it if the bound is inclusive.)
+	for _, rb := range idx.lower {
+		c := Compare(rb.bound, value)
+		if c > 0 || (c == 0 && !rb.inclusive) {
+			break
+		}
+		f(rb.node)
+	}
+
+	// Upper bounds are satisfied if they are greater than the value (or
+	// equal to it if the bound is inclusive.)
+	pos := sort.Search(len(idx.upper), func(i int) bool {
+		return Compare(idx.upper[i].bound, value) >= 0
+	})
+
+	for _, rb := range idx.upper[pos:] {
+		if rb.inclusive || Compare(rb.bound, value) > 0 {
+			f(rb.node)
+		}
+	}
+}
+
+func (idx *rangeIndex) each(f func(*trieNode)) {
+	for _, rb := range idx.lower {
+		f(rb.node)
+	}
+	for _, rb := range idx.upper {
+		f(rb.node)
+	}
+}
+
+func (idx *rangeIndex) size() int {
+	return len(idx.lower) + len(idx.upper)
+}
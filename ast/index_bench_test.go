@@ -0,0 +1,67 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func BenchmarkIndexLookupConditions(b *testing.B) {
+
+	kinds := map[string]struct {
+		rule  func(i int) string
+		input string
+	}{
+		"prefix": {
+			rule:  func(i int) string { return fmt.Sprintf(`startswith(input.path, "/tenants/%d/")`, i) },
+			input: `{"path": "/tenants/4242/docs"}`,
+		},
+		"glob": {
+			rule:  func(i int) string { return fmt.Sprintf(`glob.match("/tenants/%d/*", ["/"], input.path)`, i) },
+			input: `{"path": "/tenants/4242/docs"}`,
+		},
+		"cidr": {
+			rule:  func(i int) string { return fmt.Sprintf(`net.cidr_contains("10.%d.%d.0/24", input.addr)`, i/256, i%256) },
+			input: `{"addr": "10.16.146.7"}`,
+		},
+		"range": {
+			rule:  func(i int) string { return fmt.Sprintf(`input.level >= %d`, i) },
+			input: `{"level": 42}`,
+		},
+	}
+
+	sizes := []int{10, 100, 1000, 10000}
+
+	for kind, tc := range kinds {
+		for _, n := range sizes {
+			var buf strings.Builder
+			buf.WriteString("package test\n")
+			for i := 0; i < n; i++ {
+				fmt.Fprintf(&buf, "p { %v }\n", tc.rule(i))
+			}
+			// Compile the module so that the call operands are rewritten the
+			// same way they are during policy evaluation.
+			compiler := MustCompileModules(map[string]string{"test.rego": buf.String()})
+			module := compiler.Modules["test.rego"]
+			input := MustParseTerm(tc.input)
+
+			b.Run(fmt.Sprintf("%v/%d", kind, n), func(b *testing.B) {
+				index := newBaseDocEqIndex(func(Ref) bool { return false })
+				if !index.Build(module.Rules) {
+					b.Fatal("expected index build to succeed")
+				}
+				resolver := testResolver{input: input}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := index.Lookup(resolver); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -6,6 +6,7 @@ package ast
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -671,6 +672,356 @@ func TestBaseDocEqIndexing(t *testing.T) {
 
 }
 
+func TestBaseDocEqIndexingConditions(t *testing.T) {
+
+	module := MustParseModule(`
+	package test
+
+	prefix {
+		x = input.path
+		startswith(x, "/api/v1/")
+	} {
+		x = input.path
+		startswith(x, "/api/v2/")
+	} {
+		x = input.path
+		startswith(x, "/api/")
+	} {
+		x = input.path
+		startswith(x, "/admin")
+	} {
+		x = input.path
+		startswith(x, "/api/v2/")
+		input.path = "/api/v1/exact"
+	} {
+		input.method = "GET"
+		x = input.path
+		startswith(x, "/")
+	}
+
+	glob {
+		x = input.path
+		glob.match("/api/**", ["/"], x)
+	} {
+		x = input.path
+		glob.match("/api/v*/users", ["/"], x)
+	} {
+		x = input.path
+		glob.match("/admin/{a,b}", ["/"], x)
+	} {
+		x = input.path
+		glob.match("*/users", ["/"], x)
+	}
+
+	cidr {
+		x = input.ip
+		net.cidr_contains("10.0.0.0/8", x)
+	} {
+		x = input.ip
+		net.cidr_contains("10.1.0.0/16", x)
+	} {
+		x = input.ip
+		net.cidr_contains("192.168.0.0/16", x)
+	} {
+		x = input.ip
+		net.cidr_contains("2001:db8::/32", x)
+	} {
+		x = input.ip
+		net.cidr_contains("0.0.0.0/0", x)
+	}
+
+	range {
+		x = input.level
+		x > 10
+	} {
+		x = input.level
+		x >= 10
+	} {
+		x = input.level
+		x < 5
+	} {
+		x = input.level
+		x <= 5
+	} {
+		x = input.level
+		20 < x
+	} {
+		x = input.level
+		x > 1
+		y = input.size
+		y < 100
+	}
+
+	fn_prefix(a) {
+		startswith(a, "foo")
+	}
+
+	fn_prefix(a) {
+		startswith(a, "bar")
+	}
+	`)
+
+	tests := []struct {
+		note       string
+		ruleset    string
+		input      string
+		args       []Value
+		unknowns   []string
+		expectedRS []string
+		hits       map[string]int
+	}{
+		{
+			note:    "prefix: nested prefixes",
+			ruleset: "prefix",
+			input:   `{"path": "/api/v1/users"}`,
+			expectedRS: []string{
+				`prefix { x = input.path; startswith(x, "/api/v1/") }`,
+				`prefix { x = input.path; startswith(x, "/api/") }`,
+			},
+			hits: map[string]int{IndexHitPrefix: 3},
+		},
+		{
+			note:    "prefix: equality is preferred",
+			ruleset: "prefix",
+			input:   `{"path": "/api/v1/exact"}`,
+			expectedRS: []string{
+				`prefix { x = input.path; startswith(x, "/api/v1/") }`,
+				`prefix { x = input.path; startswith(x, "/api/") }`,
+				`prefix { x = input.path; startswith(x, "/api/v2/"); input.path = "/api/v1/exact" }`,
+			},
+			hits: map[string]int{IndexHitPrefix: 3},
+		},
+		{
+			note:    "prefix: combined with equality",
+			ruleset: "prefix",
+			input:   `{"path": "/x", "method": "GET"}`,
+			expectedRS: []string{
+				`prefix { input.method = "GET"; x = input.path; startswith(x, "/") }`,
+			},
+			hits: map[string]int{IndexHitPrefix: 1},
+		},
+		{
+			note:       "prefix: no match",
+			ruleset:    "prefix",
+			input:      `{"path": "/other"}`,
+			expectedRS: []string{},
+		},
+		{
+			note:       "prefix: undefined",
+			ruleset:    "prefix",
+			input:      `{}`,
+			expectedRS: []string{},
+		},
+		{
+			note:    "prefix: non-string value visits all rules",
+			ruleset: "prefix",
+			input:   `{"path": 7}`,
+			expectedRS: []string{
+				`prefix { x = input.path; startswith(x, "/api/v1/") }`,
+				`prefix { x = input.path; startswith(x, "/api/v2/") }`,
+				`prefix { x = input.path; startswith(x, "/api/") }`,
+				`prefix { x = input.path; startswith(x, "/admin") }`,
+			},
+			hits: map[string]int{IndexHitPrefix: 5},
+		},
+		{
+			note:     "prefix: unknown",
+			ruleset:  "prefix",
+			input:    `{}`,
+			unknowns: []string{"input.path"},
+			expectedRS: []string{
+				`prefix { x = input.path; startswith(x, "/api/v1/") }`,
+				`prefix { x = input.path; startswith(x, "/api/v2/") }`,
+				`prefix { x = input.path; startswith(x, "/api/") }`,
+				`prefix { x = input.path; startswith(x, "/admin") }`,
+				`prefix { x = input.path; startswith(x, "/api/v2/"); input.path = "/api/v1/exact" }`,
+			},
+		},
+		{
+			note:    "prefix: function arguments",
+			ruleset: "fn_prefix",
+			args:    []Value{String("barbaz")},
+			expectedRS: []string{
+				`fn_prefix(a) { startswith(a, "bar") }`,
+			},
+			hits: map[string]int{IndexHitPrefix: 1},
+		},
+		{
+			note:    "glob: literal prefix",
+			ruleset: "glob",
+			input:   `{"path": "/api/v2/users"}`,
+			expectedRS: []string{
+				`glob { x = input.path; glob.match("/api/**", ["/"], x) }`,
+				`glob { x = input.path; glob.match("/api/v*/users", ["/"], x) }`,
+			},
+			hits: map[string]int{IndexHitGlob: 2},
+		},
+		{
+			note:    "glob: alternatives",
+			ruleset: "glob",
+			input:   `{"path": "/admin/a"}`,
+			expectedRS: []string{
+				`glob { x = input.path; glob.match("/admin/{a,b}", ["/"], x) }`,
+			},
+			hits: map[string]int{IndexHitGlob: 1},
+		},
+		{
+			note:    "cidr: address",
+			ruleset: "cidr",
+			input:   `{"ip": "10.1.2.3"}`,
+			expectedRS: []string{
+				`cidr { x = input.ip; net.cidr_contains("10.0.0.0/8", x) }`,
+				`cidr { x = input.ip; net.cidr_contains("10.1.0.0/16", x) }`,
+				`cidr { x = input.ip; net.cidr_contains("0.0.0.0/0", x) }`,
+			},
+			hits: map[string]int{IndexHitCIDR: 3},
+		},
+		{
+			note:    "cidr: network",
+			ruleset: "cidr",
+			input:   `{"ip": "10.2.0.0/16"}`,
+			expectedRS: []string{
+				`cidr { x = input.ip; net.cidr_contains("10.0.0.0/8", x) }`,
+				`cidr { x = input.ip; net.cidr_contains("0.0.0.0/0", x) }`,
+			},
+			hits: map[string]int{IndexHitCIDR: 2},
+		},
+		{
+			note:    "cidr: wider network",
+			ruleset: "cidr",
+			input:   `{"ip": "10.0.0.0/7"}`,
+			expectedRS: []string{
+				`cidr { x = input.ip; net.cidr_contains("0.0.0.0/0", x) }`,
+			},
+			hits: map[string]int{IndexHitCIDR: 1},
+		},
+		{
+			note:    "cidr: ipv4-mapped ipv6 address",
+			ruleset: "cidr",
+			input:   `{"ip": "::ffff:192.168.1.1"}`,
+			expectedRS: []string{
+				`cidr { x = input.ip; net.cidr_contains("192.168.0.0/16", x) }`,
+				`cidr { x = input.ip; net.cidr_contains("0.0.0.0/0", x) }`,
+			},
+			hits: map[string]int{IndexHitCIDR: 2},
+		},
+		{
+			note:    "cidr: ipv6",
+			ruleset: "cidr",
+			input:   `{"ip": "2001:db8::1"}`,
+			expectedRS: []string{
+				`cidr { x = input.ip; net.cidr_contains("2001:db8::/32", x) }`,
+			},
+			hits: map[string]int{IndexHitCIDR: 1},
+		},
+		{
+			note:    "cidr: invalid address visits all rules",
+			ruleset: "cidr",
+			input:   `{"ip": "not-an-ip"}`,
+			expectedRS: []string{
+				`cidr { x = input.ip; net.cidr_contains("10.0.0.0/8", x) }`,
+				`cidr { x = input.ip; net.cidr_contains("10.1.0.0/16", x) }`,
+				`cidr { x = input.ip; net.cidr_contains("192.168.0.0/16", x) }`,
+				`cidr { x = input.ip; net.cidr_contains("2001:db8::/32", x) }`,
+				`cidr { x = input.ip; net.cidr_contains("0.0.0.0/0", x) }`,
+			},
+			hits: map[string]int{IndexHitCIDR: 5},
+		},
+		{
+			note:    "range: inclusive bound",
+			ruleset: "range",
+			input:   `{"level": 10}`,
+			expectedRS: []string{
+				`range { x = input.level; x >= 10 }`,
+			},
+			hits: map[string]int{IndexHitRange: 2},
+		},
+		{
+			note:    "range: lower bounds",
+			ruleset: "range",
+			input:   `{"level": 25, "size": 50}`,
+			expectedRS: []string{
+				`range { x = input.level; x > 10 }`,
+				`range { x = input.level; x >= 10 }`,
+				`range { x = input.level; 20 < x }`,
+				`range { x = input.level; x > 1; y = input.size; y < 100 }`,
+			},
+			hits: map[string]int{IndexHitRange: 5},
+		},
+		{
+			note:    "range: upper bounds",
+			ruleset: "range",
+			input:   `{"level": 5, "size": 100}`,
+			expectedRS: []string{
+				`range { x = input.level; x <= 5 }`,
+			},
+			hits: map[string]int{IndexHitRange: 2},
+		},
+		{
+			note:    "range: values of other types",
+			ruleset: "range",
+			input:   `{"level": "high"}`,
+			expectedRS: []string{
+				`range { x = input.level; x > 10 }`,
+				`range { x = input.level; x >= 10 }`,
+				`range { x = input.level; 20 < x }`,
+			},
+			hits: map[string]int{IndexHitRange: 4},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			rules := []*Rule{}
+			for _, rule := range module.Rules {
+				if rule.Head.Name == Var(tc.ruleset) {
+					rules = append(rules, rule)
+				}
+			}
+
+			var expectedRS RuleSet
+			for _, r := range tc.expectedRS {
+				expectedRS.Add(MustParseRule(r))
+			}
+
+			index := newBaseDocEqIndex(func(Ref) bool {
+				return false
+			})
+
+			if !index.Build(rules) {
+				t.Fatalf("Expected index build to succeed")
+			}
+
+			var unknownRefs Set
+			if len(tc.unknowns) > 0 {
+				unknownRefs = NewSet()
+				for _, s := range tc.unknowns {
+					unknownRefs.Add(MustParseTerm(s))
+				}
+			}
+
+			input := MustParseTerm(`{}`)
+			if tc.input != "" {
+				input = MustParseTerm(tc.input)
+			}
+
+			result, err := index.Lookup(testResolver{input: input, unknownRefs: unknownRefs, args: tc.args})
+			if err != nil {
+				t.Fatalf("Unexpected error during index lookup: %v", err)
+			}
+
+			if !NewRuleSet(result.Rules...).Equal(expectedRS) {
+				t.Fatalf("Expected ruleset %v but got: %v", expectedRS, result.Rules)
+			}
+
+			if len(tc.hits) > 0 && !reflect.DeepEqual(result.Hits, tc.hits) {
+				t.Fatalf("Expected hits %v but got: %v", tc.hits, result.Hits)
+			}
+		})
+	}
+}
+
 func TestBaseDocEqIndexingPriorities(t *testing.T) {
 
 	module := MustParseModule(`
@@ -36,6 +36,7 @@ const (
 	PlanFile              = "plan.json"
 	ManifestExt           = ".manifest"
 	SignaturesFile        = "signatures.json"
+	EncryptionFile        = "encryption.json"
 	patchFile             = "patch.json"
 	dataFile              = "data.json"
 	yamlDataFile          = "data.yaml"
@@ -339,6 +340,7 @@ type Reader struct {
 	metrics               metrics.Metrics
 	baseDir               string
 	verificationConfig    *VerificationConfig
+	decryptionConfig      *DecryptionConfig
 	skipVerify            bool
 	processAnnotations    bool
 	files                 map[string]FileInfo // files in the bundle signature payload
@@ -388,6 +390,12 @@ func (r *Reader) WithBundleVerificationConfig(config *VerificationConfig) *Reade
 	return r
 }
 
+// WithDecryptionConfig sets the key configuration used to decrypt an encrypted bundle
+func (r *Reader) WithDecryptionConfig(config *DecryptionConfig) *Reader {
+	r.decryptionConfig = config
+	return r
+}
+
 // WithSkipBundleVerification skips verification of a signed bundle
 func (r *Reader) WithSkipBundleVerification(skipVerify bool) *Reader {
 	r.skipVerify = skipVerify
@@ -414,7 +422,7 @@ func (r *Reader) Read() (Bundle, error) {
 	var descriptors []*Descriptor
 	var err error
 
-	bundle.Signatures, bundle.Patch, descriptors, err = preProcessBundle(r.loader, r.skipVerify, r.sizeLimitBytes)
+	bundle.Signatures, bundle.Patch, descriptors, err = preProcessBundle(r.loader, r.skipVerify, r.decryptionConfig, r.sizeLimitBytes)
 	if err != nil {
 		return bundle, err
 	}
@@ -647,9 +655,10 @@ func Write(w io.Writer, bundle Bundle) error {
 
 // Writer implements bundle serialization.
 type Writer struct {
-	usePath       bool
-	disableFormat bool
-	w             io.Writer
+	usePath          bool
+	disableFormat    bool
+	encryptionConfig *EncryptionConfig
+	w                io.Writer
 }
 
 // NewWriter returns a bundle writer that writes to w.
@@ -673,8 +682,27 @@ func (w *Writer) DisableFormat(yes bool) *Writer {
 	return w
 }
 
+// WithEncryptionConfig configures the writer to encrypt the bundle files
+// for the key in the config.
+func (w *Writer) WithEncryptionConfig(config *EncryptionConfig) *Writer {
+	w.encryptionConfig = config
+	return w
+}
+
 // Write writes the bundle to the writer's output stream.
 func (w *Writer) Write(bundle Bundle) error {
+
+	if w.encryptionConfig != nil {
+		var buf bytes.Buffer
+		plain := *w
+		plain.encryptionConfig = nil
+		plain.w = &buf
+		if err := plain.Write(bundle); err != nil {
+			return err
+		}
+		return encryptArchive(&buf, w.w, w.encryptionConfig)
+	}
+
 	gw := gzip.NewWriter(w.w)
 	tw := tar.NewWriter(gw)
 
@@ -809,7 +837,7 @@ func writeSignatures(tw *tar.Writer, bundle Bundle) error {
 	return archive.WriteFile(tw, fmt.Sprintf(".%v", SignaturesFile), bs)
 }
 
-func hashBundleFiles(hash SignatureHasher, b *Bundle) ([]FileInfo, error) {
+func hashBundleFiles(hash SignatureHasher, alg HashingAlgorithm, b *Bundle) ([]FileInfo, error) {
 
 	files := []FileInfo{}
 
@@ -817,14 +845,14 @@ func hashBundleFiles(hash SignatureHasher, b *Bundle) ([]FileInfo, error) {
 	if err != nil {
 		return files, err
 	}
-	files = append(files, NewFile(strings.TrimPrefix("data.json", "/"), hex.EncodeToString(bs), defaultHashingAlg))
+	files = append(files, NewFile(strings.TrimPrefix("data.json", "/"), hex.EncodeToString(bs), alg.String()))
 
 	if len(b.Wasm) != 0 {
 		bs, err := hash.HashFile(b.Wasm)
 		if err != nil {
 			return files, err
 		}
-		files = append(files, NewFile(strings.TrimPrefix(WasmFile, "/"), hex.EncodeToString(bs), defaultHashingAlg))
+		files = append(files, NewFile(strings.TrimPrefix(WasmFile, "/"), hex.EncodeToString(bs), alg.String()))
 	}
 
 	for _, wasmModule := range b.WasmModules {
@@ -832,7 +860,7 @@ func hashBundleFiles(hash SignatureHasher, b *Bundle) ([]FileInfo, error) {
 		if err != nil {
 			return files, err
 		}
-		files = append(files, NewFile(strings.TrimPrefix(wasmModule.Path, "/"), hex.EncodeToString(bs), defaultHashingAlg))
+		files = append(files, NewFile(strings.TrimPrefix(wasmModule.Path, "/"), hex.EncodeToString(bs), alg.String()))
 	}
 
 	for _, planmodule := range b.PlanModules {
@@ -840,7 +868,7 @@ func hashBundleFiles(hash SignatureHasher, b *Bundle) ([]FileInfo, error) {
 		if err != nil {
 			return files, err
 		}
-		files = append(files, NewFile(strings.TrimPrefix(planmodule.Path, "/"), hex.EncodeToString(bs), defaultHashingAlg))
+		files = append(files, NewFile(strings.TrimPrefix(planmodule.Path, "/"), hex.EncodeToString(bs), alg.String()))
 	}
 
 	// Parse the manifest into a JSON structure;
@@ -861,7 +889,7 @@ func hashBundleFiles(hash SignatureHasher, b *Bundle) ([]FileInfo, error) {
 		return files, err
 	}
 
-	files = append(files, NewFile(strings.TrimPrefix(ManifestExt, "/"), hex.EncodeToString(bs), defaultHashingAlg))
+	files = append(files, NewFile(strings.TrimPrefix(ManifestExt, "/"), hex.EncodeToString(bs), alg.String()))
 
 	return files, err
 }
@@ -895,7 +923,9 @@ func (b *Bundle) FormatModules(useModulePath bool) error {
 // GenerateSignature generates the signature for the given bundle.
 func (b *Bundle) GenerateSignature(signingConfig *SigningConfig, keyID string, useModulePath bool) error {
 
-	hash, err := NewSignatureHasher(HashingAlgorithm(defaultHashingAlg))
+	alg := signingConfig.hashingAlgorithm()
+
+	hash, err := NewSignatureHasher(alg)
 	if err != nil {
 		return err
 	}
@@ -912,10 +942,10 @@ func (b *Bundle) GenerateSignature(signingConfig *SigningConfig, keyID string, u
 		if useModulePath {
 			path = module.Path
 		}
-		files = append(files, NewFile(strings.TrimPrefix(path, "/"), hex.EncodeToString(bytes), defaultHashingAlg))
+		files = append(files, NewFile(strings.TrimPrefix(path, "/"), hex.EncodeToString(bytes), alg.String()))
 	}
 
-	result, err := hashBundleFiles(hash, b)
+	result, err := hashBundleFiles(hash, alg, b)
 	if err != nil {
 		return err
 	}
@@ -1243,10 +1273,11 @@ func IsStructuredDoc(name string) bool {
 		filepath.Base(name) == SignaturesFile || filepath.Base(name) == ManifestExt
 }
 
-func preProcessBundle(loader DirectoryLoader, skipVerify bool, sizeLimitBytes int64) (SignaturesConfig, Patch, []*Descriptor, error) {
+func preProcessBundle(loader DirectoryLoader, skipVerify bool, decryption *DecryptionConfig, sizeLimitBytes int64) (SignaturesConfig, Patch, []*Descriptor, error) {
 	descriptors := []*Descriptor{}
 	var signatures SignaturesConfig
 	var patch Patch
+	var encryption *encryptionHeader
 
 	for {
 		f, err := loader.NextFile()
@@ -1268,28 +1299,47 @@ func preProcessBundle(loader DirectoryLoader, skipVerify bool, sizeLimitBytes in
 			if err := util.NewJSONDecoder(&buf).Decode(&signatures); err != nil {
 				return signatures, patch, nil, errors.Wrap(err, "bundle load failed on signatures decode")
 			}
+		} else if isEncryptionFile(f.Path()) {
+			header, err := readEncryptionHeader(f, sizeLimitBytes)
+			if err != nil {
+				return signatures, patch, nil, err
+			}
+			encryption = &header
 		} else if !strings.HasSuffix(f.Path(), SignaturesFile) {
 			descriptors = append(descriptors, f)
+		}
+	}
 
-			if filepath.Base(f.Path()) == patchFile {
+	// the files of an encrypted bundle are decrypted before anything else
+	// reads them
+	if encryption != nil {
+		if err := decryptDescriptors(*encryption, decryption, descriptors, sizeLimitBytes); err != nil {
+			return signatures, patch, nil, err
+		}
+	} else if decryption.requiresEncryption() {
+		return signatures, patch, nil, fmt.Errorf("bundle missing .%v file", EncryptionFile)
+	}
 
-				var b bytes.Buffer
-				tee := io.TeeReader(f.reader, &b)
-				f.reader = tee
+	for _, f := range descriptors {
+		if filepath.Base(f.Path()) == patchFile {
 
-				buf, err := readFile(f, sizeLimitBytes)
-				if err != nil {
-					return signatures, patch, nil, err
-				}
+			var b bytes.Buffer
+			tee := io.TeeReader(f.reader, &b)
+			f.reader = tee
 
-				if err := util.NewJSONDecoder(&buf).Decode(&patch); err != nil {
-					return signatures, patch, nil, errors.Wrap(err, "bundle load failed on patch decode")
-				}
+			buf, err := readFile(f, sizeLimitBytes)
+			if err != nil {
+				return signatures, patch, nil, err
+			}
 
-				f.reader = &b
+			if err := util.NewJSONDecoder(&buf).Decode(&patch); err != nil {
+				return signatures, patch, nil, errors.Wrap(err, "bundle load failed on patch decode")
 			}
+
+			f.reader = &b
 		}
 	}
+
 	return signatures, patch, descriptors, nil
 }
 
@@ -9,6 +9,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,6 +20,8 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
 
 	"github.com/meta-quick/opax/ast"
 	"github.com/meta-quick/opax/internal/file/archive"
@@ -330,7 +333,7 @@ func TestReadWithSignatures(t *testing.T) {
 		"no_signatures": {
 			[][2]string{{"/.signatures.json", `{"signatures": []}`}},
 			NewVerificationConfig(map[string]*KeyConfig{}, "", "", nil),
-			true, fmt.Errorf(".signatures.json: missing JWT (expected exactly one)"),
+			true, fmt.Errorf(".signatures.json: missing JWT (expected at least one)"),
 		},
 		"digest_mismatch": {
 			[][2]string{
@@ -987,6 +990,92 @@ func TestRoundtrip(t *testing.T) {
 	}
 }
 
+func TestRoundtripWithSM2Signature(t *testing.T) {
+
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, err := smx509.WritePrivateKeyToPem(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := smx509.WritePublicKeyToPem(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := Bundle{
+		Data: map[string]interface{}{"foo": "bar"},
+		Modules: []ModuleFile{
+			{
+				URL:    "/foo/corge/corge.rego",
+				Path:   "/foo/corge/corge.rego",
+				Parsed: ast.MustParseModule(`package foo.corge`),
+				Raw:    []byte("package foo.corge\n"),
+			},
+		},
+		Manifest: Manifest{
+			Roots:    &[]string{""},
+			Revision: "quickbrownfaux",
+		},
+	}
+
+	if err := bundle.GenerateSignature(NewSigningConfig(string(priv), "SM2", ""), "foo", false); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := NewWriter(&buf).Write(bundle); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	raw := buf.Bytes()
+
+	vc := NewVerificationConfig(map[string]*KeyConfig{"foo": {Key: string(pub), Algorithm: "SM2"}}, "foo", "", nil)
+
+	files, err := VerifyBundleSignature(bundle.Signatures, vc)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	for name, file := range files {
+		if file.Algorithm != SM3.String() {
+			t.Fatalf("Expected file %v to be hashed with SM3 but got %v", name, file.Algorithm)
+		}
+	}
+
+	bundle2, err := NewReader(bytes.NewReader(raw)).WithBundleVerificationConfig(vc).Read()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if !bundle2.Equal(bundle) {
+		t.Fatal("Exp:", bundle, "\n\nGot:", bundle2)
+	}
+
+	// a signature made with another SM2 key does not verify
+	other, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPub, err := smx509.WritePublicKeyToPem(&other.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vc = NewVerificationConfig(map[string]*KeyConfig{"foo": {Key: string(otherPub), Algorithm: "SM2"}}, "foo", "", nil)
+
+	_, err = NewReader(bytes.NewReader(raw)).WithBundleVerificationConfig(vc).Read()
+	if err == nil || !strings.Contains(err.Error(), "failed to verify signature using sm2") {
+		t.Fatal("Expected verification error but got:", err)
+	}
+}
+
 func TestRoundtripWithPlanModules(t *testing.T) {
 
 	b := Bundle{
@@ -1340,7 +1429,7 @@ func TestHashBundleFiles(t *testing.T) {
 				})
 			}
 
-			f, err := hashBundleFiles(h, &Bundle{Data: tc.data, Manifest: tc.manifest, Wasm: tc.wasm, PlanModules: plans})
+			f, err := hashBundleFiles(h, SHA256, &Bundle{Data: tc.data, Manifest: tc.manifest, Wasm: tc.wasm, PlanModules: plans})
 			if err != nil {
 				t.Fatal("Unexpected error:", err)
 			}
@@ -0,0 +1,388 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
+	"github.com/meta-quick/opax/util"
+)
+
+// NewDelta returns a delta bundle that transforms the data in the prev
+// snapshot bundle into the data in the next snapshot bundle. The patch
+// operations are limited to the manifest roots. Delta bundles cannot carry
+// policies or change the manifest roots, so an error is returned if the
+// policies, Wasm modules or manifest roots differ between the snapshots. The
+// delta bundle inherits the manifest (including the revision) of next.
+func NewDelta(prev, next Bundle) (Bundle, error) {
+
+	if prev.Type() != SnapshotBundleType || next.Type() != SnapshotBundleType {
+		return Bundle{}, fmt.Errorf("delta bundles can only be computed between snapshot bundles")
+	}
+
+	manifest := next.Manifest.Copy()
+
+	if !prev.Manifest.Copy().equalWasmResolversAndRoots(manifest) {
+		return Bundle{}, fmt.Errorf("manifest roots or wasm resolvers differ between snapshots")
+	}
+
+	if err := compareBundlePolicies(prev, next); err != nil {
+		return Bundle{}, err
+	}
+	if manifest.Revision == "" || manifest.Revision == prev.Manifest.Revision {
+		return Bundle{}, fmt.Errorf("next snapshot revision must be set and differ from previous snapshot revision %q", prev.Manifest.Revision)
+	}
+
+	prevData, err := roundTripData(prev.Data)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	nextData, err := roundTripData(next.Data)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	var ops []PatchOperation
+
+	for _, root := range sortedRoots(manifest) {
+		path := splitRoot(root)
+		x, xok := lookupData(prevData, path)
+		y, yok := lookupData(nextData, path)
+		switch {
+		case xok && yok:
+			ops = append(ops, diffData(path, x, y)...)
+		case yok:
+			ops = append(ops, PatchOperation{Op: "upsert", Path: escapePatchPath(path), Value: y})
+		case xok:
+			ops = append(ops, PatchOperation{Op: "remove", Path: escapePatchPath(path)})
+		}
+	}
+
+	if len(ops) == 0 {
+		return Bundle{}, fmt.Errorf("snapshots contain the same data")
+	}
+
+	return Bundle{
+		Manifest: manifest,
+		Patch:    Patch{Data: ops},
+	}, nil
+}
+
+// VerifyDelta applies the delta bundle to the data in the prev snapshot
+// bundle and returns an error if the result differs from the data in the next
+// snapshot bundle within the manifest roots.
+func VerifyDelta(prev, delta, next Bundle) error {
+
+	if delta.Type() != DeltaBundleType {
+		return fmt.Errorf("bundle is not a delta bundle")
+	}
+
+	if !delta.Manifest.Copy().equalWasmResolversAndRoots(prev.Manifest.Copy()) {
+		return fmt.Errorf("delta bundle manifest roots or wasm resolvers differ from previous snapshot")
+	}
+
+	prevData, err := roundTripData(prev.Data)
+	if err != nil {
+		return err
+	}
+
+	nextData, err := roundTripData(next.Data)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	store := inmem.NewFromObject(prevData.(map[string]interface{}))
+	txn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+	defer store.Abort(ctx, txn)
+
+	if err := applyPatches(ctx, store, txn, delta.Patch.Data); err != nil {
+		return fmt.Errorf("delta bundle cannot be applied to previous snapshot: %w", err)
+	}
+
+	for _, root := range sortedRoots(delta.Manifest) {
+		path := splitRoot(root)
+
+		result, err := store.Read(ctx, txn, storage.Path(path))
+		if err != nil && !storage.IsNotFound(err) {
+			return err
+		}
+
+		found := err == nil
+		if found {
+			result, err = roundTripData(result)
+			if err != nil {
+				return err
+			}
+		}
+
+		exp, ok := lookupData(nextData, path)
+		if ok != found || !reflect.DeepEqual(result, exp) {
+			return fmt.Errorf("delta bundle applied to previous snapshot differs from next snapshot at %v", escapePatchPath(path))
+		}
+	}
+
+	return nil
+}
+
+// compareBundlePolicies returns an error if the policies, Wasm modules or
+// plans differ between prev and next. Policies are compared by their parsed
+// form so that formatting changes and file moves (e.g., when the snapshots are
+// built from different directories) are not considered changes.
+func compareBundlePolicies(prev, next Bundle) error {
+
+	changed := map[string]struct{}{}
+
+	matched := make([]bool, len(prev.Modules))
+
+	for _, y := range next.Modules {
+		found := false
+		for i, x := range prev.Modules {
+			if !matched[i] && equalModuleFiles(x, y) {
+				matched[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			changed["policy "+y.Path] = struct{}{}
+		}
+	}
+
+	for i, x := range prev.Modules {
+		if !matched[i] {
+			changed["policy "+x.Path] = struct{}{}
+		}
+	}
+
+	files := func(b Bundle) map[string][]byte {
+		result := map[string][]byte{}
+		for _, m := range b.WasmModules {
+			result["wasm module "+m.Path] = m.Raw
+		}
+		for _, m := range b.PlanModules {
+			result["plan "+m.Path] = m.Raw
+		}
+		return result
+	}
+
+	x, y := files(prev), files(next)
+
+	for k, raw := range y {
+		if other, ok := x[k]; !ok || !bytes.Equal(raw, other) {
+			changed[k] = struct{}{}
+		}
+	}
+
+	for k := range x {
+		if _, ok := y[k]; !ok {
+			changed[k] = struct{}{}
+		}
+	}
+
+	if len(changed) > 0 {
+		keys := make([]string, 0, len(changed))
+		for k := range changed {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("delta bundles cannot contain policy changes (changed: %v)", strings.Join(keys, ", "))
+	}
+
+	return nil
+}
+
+// DiffData returns the patch operations that transform the data document x
+// into the data document y. The operations are computed the same way as the
+// operations of delta bundles created by NewDelta.
+func DiffData(x, y interface{}) ([]PatchOperation, error) {
+
+	x, err := roundTripData(x)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err = roundTripData(y)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffData([]string{}, x, y), nil
+}
+
+func equalModuleFiles(x, y ModuleFile) bool {
+	if x.Parsed != nil && y.Parsed != nil {
+		return x.Parsed.Equal(y.Parsed)
+	}
+	return bytes.Equal(x.Raw, y.Raw)
+}
+
+// diffData returns the patch operations that transform x into y. Objects are
+// diffed key by key. Arrays are diffed element by element (with elements
+// appended or removed at the end) unless replacing the array outright is
+// smaller.
+func diffData(path []string, x, y interface{}) []PatchOperation {
+
+	switch x := x.(type) {
+	case map[string]interface{}:
+		if y, ok := y.(map[string]interface{}); ok {
+			return diffObjects(path, x, y)
+		}
+	case []interface{}:
+		if y, ok := y.([]interface{}); ok {
+			ops := diffArrays(path, x, y)
+			replace := []PatchOperation{{Op: "upsert", Path: escapePatchPath(path), Value: y}}
+			if len(path) > 0 && len(ops) > 1 && patchSize(ops) > patchSize(replace) {
+				return replace
+			}
+			return ops
+		}
+	}
+
+	if reflect.DeepEqual(x, y) {
+		return nil
+	}
+
+	return []PatchOperation{{Op: "upsert", Path: escapePatchPath(path), Value: y}}
+}
+
+func diffObjects(path []string, x, y map[string]interface{}) []PatchOperation {
+
+	var ops []PatchOperation
+
+	for _, k := range sortedKeys(x) {
+		if _, ok := y[k]; !ok {
+			ops = append(ops, PatchOperation{Op: "remove", Path: escapePatchPath(childPath(path, k))})
+		}
+	}
+
+	for _, k := range sortedKeys(y) {
+		child := childPath(path, k)
+		if xv, ok := x[k]; ok {
+			ops = append(ops, diffData(child, xv, y[k])...)
+		} else {
+			ops = append(ops, PatchOperation{Op: "upsert", Path: escapePatchPath(child), Value: y[k]})
+		}
+	}
+
+	return ops
+}
+
+func diffArrays(path []string, x, y []interface{}) []PatchOperation {
+
+	var ops []PatchOperation
+
+	n := len(x)
+	if len(y) < n {
+		n = len(y)
+	}
+
+	for i := 0; i < n; i++ {
+		child := childPath(path, strconv.Itoa(i))
+		for _, op := range diffData(child, x[i], y[i]) {
+			// Upserting an array index inserts an element, so changed
+			// elements must be replaced instead.
+			if op.Op == "upsert" && op.Path == escapePatchPath(child) {
+				op.Op = "replace"
+			}
+			ops = append(ops, op)
+		}
+	}
+
+	for i := len(x) - 1; i >= n; i-- {
+		ops = append(ops, PatchOperation{Op: "remove", Path: escapePatchPath(childPath(path, strconv.Itoa(i)))})
+	}
+
+	for i := n; i < len(y); i++ {
+		ops = append(ops, PatchOperation{Op: "upsert", Path: escapePatchPath(childPath(path, "-")), Value: y[i]})
+	}
+
+	return ops
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func childPath(path []string, key string) []string {
+	return append(path[:len(path):len(path)], key)
+}
+
+func patchSize(ops []PatchOperation) int {
+	bs, err := json.Marshal(ops)
+	if err != nil {
+		return 0
+	}
+	return len(bs)
+}
+
+func sortedRoots(m Manifest) []string {
+	m.Init()
+	roots := make([]string, len(*m.Roots))
+	copy(roots, *m.Roots)
+	for i := range roots {
+		roots[i] = strings.Trim(roots[i], "/")
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+func splitRoot(root string) []string {
+	if root == "" {
+		return []string{}
+	}
+	return strings.Split(root, "/")
+}
+
+func lookupData(data interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		data, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+func roundTripData(data interface{}) (interface{}, error) {
+	if data == nil {
+		return map[string]interface{}{}, nil
+	}
+	if err := util.RoundTrip(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// escapePatchPath returns the JSON pointer for path.
+func escapePatchPath(path []string) string {
+	var buf strings.Builder
+	for _, key := range path {
+		buf.WriteByte('/')
+		buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1"))
+	}
+	if buf.Len() == 0 {
+		return "/"
+	}
+	return buf.String()
+}
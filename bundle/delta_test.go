@@ -0,0 +1,239 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/util"
+)
+
+func TestNewDelta(t *testing.T) {
+
+	tests := []struct {
+		note  string
+		roots []string
+		prev  string
+		next  string
+		exp   string
+	}{
+		{
+			note: "object keys",
+			prev: `{"a": {"b": 1, "c": 2, "d": {"e": true}}}`,
+			next: `{"a": {"b": 1, "c": 3, "f": "x"}}`,
+			exp: `[
+				{"op": "remove", "path": "/a/d", "value": null},
+				{"op": "upsert", "path": "/a/c", "value": 3},
+				{"op": "upsert", "path": "/a/f", "value": "x"}
+			]`,
+		},
+		{
+			note: "array elements",
+			prev: fmt.Sprintf(`{"a": [%v, {"x": 1}, %v, %v]}`, long(1), long(2), long(3)),
+			next: fmt.Sprintf(`{"a": [%v, {"x": 2}, 0, %v, %v]}`, long(1), long(3), long(4)),
+			exp: fmt.Sprintf(`[
+				{"op": "upsert", "path": "/a/1/x", "value": 2},
+				{"op": "replace", "path": "/a/2", "value": 0},
+				{"op": "upsert", "path": "/a/-", "value": %v}
+			]`, long(4)),
+		},
+		{
+			note: "array truncated",
+			prev: fmt.Sprintf(`{"a": [%v, %v, %v, 4, 5]}`, long(1), long(2), long(3)),
+			next: fmt.Sprintf(`{"a": [%v, %v, %v]}`, long(1), long(2), long(3)),
+			exp: `[
+				{"op": "remove", "path": "/a/4", "value": null},
+				{"op": "remove", "path": "/a/3", "value": null}
+			]`,
+		},
+		{
+			note: "array replaced when smaller",
+			prev: `{"a": [1, 2, 3]}`,
+			next: `{"a": [4, 5, 6]}`,
+			exp:  `[{"op": "upsert", "path": "/a", "value": [4, 5, 6]}]`,
+		},
+		{
+			note: "type change",
+			prev: `{"a": {"b": [1]}}`,
+			next: `{"a": {"b": {"c": 1}}}`,
+			exp:  `[{"op": "upsert", "path": "/a/b", "value": {"c": 1}}]`,
+		},
+		{
+			note:  "roots",
+			roots: []string{"a/b", "c"},
+			prev:  `{"a": {"b": {"x": 1}}, "c": 1}`,
+			next:  `{"a": {}, "c": 2}`,
+			exp: `[
+				{"op": "remove", "path": "/a/b", "value": null},
+				{"op": "upsert", "path": "/c", "value": 2}
+			]`,
+		},
+		{
+			note:  "new root data",
+			roots: []string{"a/b"},
+			prev:  `{}`,
+			next:  `{"a": {"b": {"x": 1}}}`,
+			exp:   `[{"op": "upsert", "path": "/a/b", "value": {"x": 1}}]`,
+		},
+		{
+			note: "escaping",
+			prev: `{"a/b": {"c~d": 1}}`,
+			next: `{"a/b": {"c~d": 2}}`,
+			exp:  `[{"op": "upsert", "path": "/a~1b/c~0d", "value": 2}]`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			prev := deltaTestBundle("v1", tc.roots, tc.prev, nil)
+			next := deltaTestBundle("v2", tc.roots, tc.next, nil)
+
+			delta, err := NewDelta(prev, next)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if delta.Type() != DeltaBundleType || delta.Manifest.Revision != "v2" {
+				t.Fatalf("Expected delta bundle with revision v2 but got %v (%v)", delta.Type(), delta.Manifest)
+			}
+
+			var exp, result interface{}
+			if err := util.UnmarshalJSON([]byte(tc.exp), &exp); err != nil {
+				t.Fatal(err)
+			}
+			bs := util.MustMarshalJSON(delta.Patch.Data)
+			if err := util.UnmarshalJSON(bs, &result); err != nil {
+				t.Fatal(err)
+			}
+
+			if util.Compare(exp, result) != 0 {
+				t.Fatalf("Expected:\n\n%v\n\nGot:\n\n%v", tc.exp, string(bs))
+			}
+
+			if err := VerifyDelta(prev, delta, next); err != nil {
+				t.Fatal(err)
+			}
+
+			// Check that the delta survives a round trip through the bundle format.
+			var buf bytes.Buffer
+			if err := NewWriter(&buf).Write(delta); err != nil {
+				t.Fatal(err)
+			}
+
+			written, err := NewReader(&buf).Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := VerifyDelta(prev, written, next); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestNewDeltaErrors(t *testing.T) {
+
+	module := func(src string) []ModuleFile {
+		return []ModuleFile{{Path: "/x.rego", Raw: []byte(src), Parsed: ast.MustParseModule(src)}}
+	}
+
+	tests := []struct {
+		note string
+		prev Bundle
+		next Bundle
+		exp  string
+	}{
+		{
+			note: "policy changed",
+			prev: deltaTestBundle("v1", nil, `{"a": 1}`, module("package x\np = 1")),
+			next: deltaTestBundle("v2", nil, `{"a": 2}`, module("package x\np = 2")),
+			exp:  "delta bundles cannot contain policy changes (changed: policy /x.rego)",
+		},
+		{
+			note: "policy removed",
+			prev: deltaTestBundle("v1", nil, `{"a": 1}`, module("package x\np = 1")),
+			next: deltaTestBundle("v2", nil, `{"a": 2}`, nil),
+			exp:  "delta bundles cannot contain policy changes (changed: policy /x.rego)",
+		},
+		{
+			note: "roots changed",
+			prev: deltaTestBundle("v1", []string{"a"}, `{"a": 1}`, nil),
+			next: deltaTestBundle("v2", []string{"a", "b"}, `{"a": 2}`, nil),
+			exp:  "manifest roots or wasm resolvers differ between snapshots",
+		},
+		{
+			note: "same revision",
+			prev: deltaTestBundle("v1", nil, `{"a": 1}`, nil),
+			next: deltaTestBundle("v1", nil, `{"a": 2}`, nil),
+			exp:  `next snapshot revision must be set and differ from previous snapshot revision "v1"`,
+		},
+		{
+			note: "same data",
+			prev: deltaTestBundle("v1", nil, `{"a": 1}`, nil),
+			next: deltaTestBundle("v2", nil, `{"a": 1}`, nil),
+			exp:  "snapshots contain the same data",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := NewDelta(tc.prev, tc.next)
+			if err == nil || err.Error() != tc.exp {
+				t.Fatalf("Expected error %q but got: %v", tc.exp, err)
+			}
+		})
+	}
+
+	// Formatting changes are not policy changes.
+	prev := deltaTestBundle("v1", nil, `{"a": 1}`, module("package x\np = 1"))
+	next := deltaTestBundle("v2", nil, `{"a": 2}`, module("package x\n\n# comment\np = 1\n"))
+	if _, err := NewDelta(prev, next); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyDeltaMismatch(t *testing.T) {
+
+	prev := deltaTestBundle("v1", nil, `{"a": {"b": 1}}`, nil)
+	next := deltaTestBundle("v2", nil, `{"a": {"b": 2}}`, nil)
+	delta := Bundle{
+		Manifest: next.Manifest,
+		Patch:    Patch{Data: []PatchOperation{{Op: "upsert", Path: "/a/b", Value: 3}}},
+	}
+
+	err := VerifyDelta(prev, delta, next)
+	if err == nil || !strings.Contains(err.Error(), "differs from next snapshot at /") {
+		t.Fatal("Expected mismatch error but got:", err)
+	}
+
+	delta.Patch.Data[0].Op = "replace"
+	delta.Patch.Data[0].Path = "/a/c"
+
+	err = VerifyDelta(prev, delta, next)
+	if err == nil || !strings.Contains(err.Error(), "delta bundle cannot be applied to previous snapshot") {
+		t.Fatal("Expected patch error but got:", err)
+	}
+}
+
+func long(i int) string {
+	return fmt.Sprintf("%q", strings.Repeat(fmt.Sprint(i), 64))
+}
+
+func deltaTestBundle(revision string, roots []string, data string, modules []ModuleFile) Bundle {
+	b := Bundle{
+		Manifest: Manifest{Revision: revision},
+		Data:     util.MustUnmarshalJSON([]byte(data)).(map[string]interface{}),
+		Modules:  modules,
+	}
+	if roots != nil {
+		b.Manifest.Roots = &roots
+	}
+	return b
+}
@@ -0,0 +1,595 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm4"
+	smx509 "github.com/tjfoc/gmsm/x509"
+
+	"github.com/meta-quick/opax/internal/file/archive"
+	"github.com/meta-quick/opax/util"
+)
+
+// Content encryption algorithms supported for encrypted bundles.
+const (
+	EncryptionAlgAES256GCM = "A256GCM"
+	EncryptionAlgSM4GCM    = "SM4GCM"
+)
+
+// Key wrapping algorithms. The algorithm is determined by the type of the
+// recipient's public key.
+const (
+	keyAlgRSAOAEP256 = "RSA-OAEP-256"
+	keyAlgECDHES     = "ECDH-ES+A256GCM"
+	keyAlgSM2        = "SM2"
+)
+
+const defaultEncryptionAlg = EncryptionAlgAES256GCM
+
+// EncryptionAlgorithms contains the supported content encryption algorithms.
+var EncryptionAlgorithms = []string{EncryptionAlgAES256GCM, EncryptionAlgSM4GCM}
+
+// encryptionHeader is the content of the encryption file. The content key is
+// wrapped once per recipient.
+type encryptionHeader struct {
+	Algorithm  string                `json:"enc"`
+	Recipients []encryptionRecipient `json:"recipients"`
+}
+
+type encryptionRecipient struct {
+	KeyID        string `json:"kid,omitempty"`
+	Algorithm    string `json:"alg"`
+	EphemeralKey string `json:"epk,omitempty"`
+	EncryptedKey string `json:"encrypted_key"`
+}
+
+// EncryptionConfig represents the key configuration used to generate an
+// encrypted bundle.
+type EncryptionConfig struct {
+	Key       string // PEM encoded public key (or certificate) or path to it
+	KeyID     string
+	Algorithm string
+}
+
+// NewEncryptionConfig return a new EncryptionConfig
+func NewEncryptionConfig(key, keyID, alg string) *EncryptionConfig {
+	if alg == "" {
+		alg = defaultEncryptionAlg
+	}
+
+	return &EncryptionConfig{
+		Key:       key,
+		KeyID:     keyID,
+		Algorithm: alg,
+	}
+}
+
+// GetPublicKey returns the public key from the encryption config
+func (e *EncryptionConfig) GetPublicKey() (interface{}, error) {
+	key := e.Key
+
+	if block, _ := pem.Decode([]byte(key)); block == nil {
+		bs, err := ioutil.ReadFile(key)
+		if err != nil {
+			return nil, err
+		}
+		key = string(bs)
+	}
+
+	return parsePublicKey([]byte(key))
+}
+
+// DecryptionConfig represents the key configuration used to decrypt an
+// encrypted bundle. If KeyID is set, bundles must be encrypted for that key.
+// Otherwise any configured private key that the bundle is encrypted for is
+// used. Plaintext bundles are rejected if KeyID is set or Required is true.
+type DecryptionConfig struct {
+	PrivateKeys map[string]*KeyConfig
+	KeyID       string `json:"keyid"`
+	Required    bool   `json:"required"`
+}
+
+// NewDecryptionConfig return a new DecryptionConfig
+func NewDecryptionConfig(keys map[string]*KeyConfig, id string) *DecryptionConfig {
+	return &DecryptionConfig{
+		PrivateKeys: keys,
+		KeyID:       id,
+	}
+}
+
+// ValidateAndInjectDefaults validates the config and inserts default values
+func (dc *DecryptionConfig) ValidateAndInjectDefaults(keys map[string]*KeyConfig) error {
+	dc.PrivateKeys = keys
+
+	if dc.KeyID != "" {
+		kc, ok := keys[dc.KeyID]
+		if !ok {
+			return fmt.Errorf("key id %s not found", dc.KeyID)
+		}
+		if kc.PrivateKey == "" {
+			return fmt.Errorf("key id %s has no private key", dc.KeyID)
+		}
+	} else if dc.Required {
+		for _, kc := range keys {
+			if kc.PrivateKey != "" {
+				return nil
+			}
+		}
+		return fmt.Errorf("decryption required but no private key configured")
+	}
+	return nil
+}
+
+// requiresEncryption returns true if plaintext bundles must be rejected.
+func (dc *DecryptionConfig) requiresEncryption() bool {
+	return dc != nil && (dc.KeyID != "" || dc.Required)
+}
+
+// GetPrivateKey returns the private key corresponding to the given key id
+func (dc *DecryptionConfig) GetPrivateKey(id string) (interface{}, error) {
+	kc, ok := dc.PrivateKeys[id]
+	if !ok || kc.PrivateKey == "" {
+		return nil, fmt.Errorf("decryption key corresponding to ID %v not found", id)
+	}
+	return parsePrivateKey([]byte(kc.PrivateKey))
+}
+
+// encryptArchive reads the bundle tarball from r and writes it to w with
+// every file except the signatures file encrypted under a fresh content key.
+// Files are sealed individually and bound to their path so that they cannot
+// be swapped around inside the bundle. The signatures file stays in plaintext
+// and exposes the file names and plaintext hashes of the bundle.
+func encryptArchive(r io.Reader, w io.Writer, config *EncryptionConfig) error {
+
+	pub, err := config.GetPublicKey()
+	if err != nil {
+		return fmt.Errorf("failed to read encryption key: %w", err)
+	}
+
+	cek, aead, err := newContentKey(config.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	recipient, err := wrapContentKey(pub, cek)
+	if err != nil {
+		return err
+	}
+	recipient.KeyID = config.KeyID
+
+	header := encryptionHeader{
+		Algorithm:  config.Algorithm,
+		Recipients: []encryptionRecipient{recipient},
+	}
+
+	bs, err := json.MarshalIndent(header, "", " ")
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	if err := archive.WriteFile(tw, "."+EncryptionFile, bs); err != nil {
+		return err
+	}
+
+	loader := NewTarballLoader(r)
+
+	for {
+		f, err := loader.NextFile()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, f.reader)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		content := buf.Bytes()
+		if !strings.HasSuffix(f.Path(), SignaturesFile) {
+			content, err = sealFile(aead, f.Path(), content)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := archive.WriteFile(tw, f.Path(), content); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// decryptDescriptors replaces the readers of the descriptors with readers of
+// the decrypted file content.
+func decryptDescriptors(header encryptionHeader, config *DecryptionConfig, descriptors []*Descriptor, sizeLimitBytes int64) error {
+
+	if config == nil {
+		return fmt.Errorf("bundle is encrypted but decryption key not provided")
+	}
+
+	cek, err := unwrapContentKey(header, config)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newContentCipher(header.Algorithm, cek)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range descriptors {
+		buf, err := readFile(f, sizeLimitBytes+int64(aead.NonceSize()+aead.Overhead()))
+		if err != nil {
+			return err
+		}
+
+		plaintext, err := openFile(aead, f.Path(), buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		f.reader = bytes.NewReader(plaintext)
+	}
+
+	return nil
+}
+
+func sealFile(aead cipher.AEAD, path string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, encryptedFileAAD(path)), nil
+}
+
+func openFile(aead cipher.AEAD, path string, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("bundle file '%v' is not encrypted", encryptedFilePath(path))
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, encryptedFileAAD(path))
+	if err != nil {
+		return nil, fmt.Errorf("bundle file '%v' could not be decrypted", encryptedFilePath(path))
+	}
+	return plaintext, nil
+}
+
+func encryptedFilePath(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
+
+func encryptedFileAAD(path string) []byte {
+	return []byte(encryptedFilePath(path))
+}
+
+func newContentKey(alg string) ([]byte, cipher.AEAD, error) {
+	size, err := contentKeySize(alg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cek := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newContentCipher(alg, cek)
+	return cek, aead, err
+}
+
+func contentKeySize(alg string) (int, error) {
+	switch alg {
+	case EncryptionAlgAES256GCM:
+		return 32, nil
+	case EncryptionAlgSM4GCM:
+		return sm4.BlockSize, nil
+	}
+	return 0, fmt.Errorf("unsupported encryption algorithm '%v'", alg)
+}
+
+func newContentCipher(alg string, cek []byte) (cipher.AEAD, error) {
+
+	size, err := contentKeySize(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cek) != size {
+		return nil, fmt.Errorf("invalid content key size for %v", alg)
+	}
+
+	var block cipher.Block
+
+	switch alg {
+	case EncryptionAlgSM4GCM:
+		block, err = sm4.NewCipher(cek)
+	default:
+		block, err = aes.NewCipher(cek)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func wrapContentKey(pub interface{}, cek []byte) (encryptionRecipient, error) {
+
+	var r encryptionRecipient
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		bs, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil)
+		if err != nil {
+			return r, err
+		}
+		r.Algorithm = keyAlgRSAOAEP256
+		r.EncryptedKey = base64.RawURLEncoding.EncodeToString(bs)
+
+	case *ecdsa.PublicKey:
+		eph, err := ecdsa.GenerateKey(pub.Curve, rand.Reader)
+		if err != nil {
+			return r, err
+		}
+
+		kek := deriveKeyEncryptionKey(pub.Curve, pub.X, pub.Y, eph)
+
+		aead, err := newContentCipher(EncryptionAlgAES256GCM, kek)
+		if err != nil {
+			return r, err
+		}
+
+		bs, err := sealFile(aead, "", cek)
+		if err != nil {
+			return r, err
+		}
+
+		r.Algorithm = keyAlgECDHES
+		r.EphemeralKey = base64.RawURLEncoding.EncodeToString(elliptic.Marshal(pub.Curve, eph.X, eph.Y))
+		r.EncryptedKey = base64.RawURLEncoding.EncodeToString(bs)
+
+	case *sm2.PublicKey:
+		bs, err := sm2.EncryptAsn1(pub, cek, rand.Reader)
+		if err != nil {
+			return r, err
+		}
+		r.Algorithm = keyAlgSM2
+		r.EncryptedKey = base64.RawURLEncoding.EncodeToString(bs)
+
+	default:
+		return r, fmt.Errorf("unsupported encryption key type %T", pub)
+	}
+
+	return r, nil
+}
+
+func unwrapContentKey(header encryptionHeader, config *DecryptionConfig) ([]byte, error) {
+
+	for _, r := range header.Recipients {
+
+		if config.KeyID != "" {
+			if r.KeyID != config.KeyID {
+				continue
+			}
+		} else if _, ok := config.PrivateKeys[r.KeyID]; !ok {
+			continue
+		}
+
+		priv, err := config.GetPrivateKey(r.KeyID)
+		if err != nil {
+			return nil, err
+		}
+
+		cek, err := unwrapRecipientKey(r, priv)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt content key for key ID %v: %w", r.KeyID, err)
+		}
+
+		return cek, nil
+	}
+
+	if config.KeyID != "" {
+		return nil, fmt.Errorf("bundle is not encrypted for key ID %v", config.KeyID)
+	}
+
+	return nil, fmt.Errorf("bundle is not encrypted for any of the configured keys")
+}
+
+func unwrapRecipientKey(r encryptionRecipient, priv interface{}) ([]byte, error) {
+
+	bs, err := base64.RawURLEncoding.DecodeString(r.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		if r.Algorithm != keyAlgRSAOAEP256 {
+			break
+		}
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, bs, nil)
+
+	case *ecdsa.PrivateKey:
+		if r.Algorithm != keyAlgECDHES {
+			break
+		}
+
+		epk, err := base64.RawURLEncoding.DecodeString(r.EphemeralKey)
+		if err != nil {
+			return nil, err
+		}
+
+		x, y := elliptic.Unmarshal(priv.Curve, epk)
+		if x == nil {
+			return nil, fmt.Errorf("invalid ephemeral key")
+		}
+
+		kek := deriveKeyEncryptionKey(priv.Curve, x, y, priv)
+
+		aead, err := newContentCipher(EncryptionAlgAES256GCM, kek)
+		if err != nil {
+			return nil, err
+		}
+
+		return openFile(aead, "", bs)
+
+	case *sm2.PrivateKey:
+		if r.Algorithm != keyAlgSM2 {
+			break
+		}
+		return sm2.DecryptAsn1(priv, bs)
+	}
+
+	return nil, fmt.Errorf("key wrapping algorithm '%v' does not match key type %T", r.Algorithm, priv)
+}
+
+// deriveKeyEncryptionKey returns the key that wraps the content key for the
+// ECDH-ES key agreement between priv and the public point (x, y). The shared
+// secret is passed through a single round of the Concat KDF (NIST SP 800-56A)
+// with SHA-256.
+func deriveKeyEncryptionKey(curve elliptic.Curve, x, y *big.Int, priv *ecdsa.PrivateKey) []byte {
+
+	zx, _ := curve.ScalarMult(x, y, priv.D.Bytes())
+
+	z := make([]byte, (curve.Params().BitSize+7)/8)
+	zx.FillBytes(z)
+
+	h := sha256.New()
+	_ = binary.Write(h, binary.BigEndian, uint32(1))
+	h.Write(z)
+	h.Write([]byte(keyAlgECDHES))
+	return h.Sum(nil)
+}
+
+// parsePublicKey returns the RSA, ECDSA or SM2 public key from the PEM
+// encoded key or certificate.
+func parsePublicKey(bs []byte) (interface{}, error) {
+
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM encoded public key")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			cert, err := smx509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			return cert.PublicKey, nil
+		}
+		return cert.PublicKey, nil
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			// SM2 keys use a curve that the standard library does not know.
+			if pub, err := smx509.ParseSm2PublicKey(block.Bytes); err == nil {
+				return pub, nil
+			}
+			return nil, err
+		}
+		return pub, nil
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block type '%v' for public key", block.Type)
+}
+
+// parsePrivateKey returns the RSA, ECDSA or SM2 private key from the PEM
+// encoded key.
+func parsePrivateKey(bs []byte) (interface{}, error) {
+
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM encoded private key")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		priv, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			if priv, err := smx509.ParseSm2PrivateKey(block.Bytes); err == nil {
+				return priv, nil
+			}
+			return nil, err
+		}
+		return priv, nil
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			if priv, err := smx509.ParsePKCS8UnecryptedPrivateKey(block.Bytes); err == nil {
+				return priv, nil
+			}
+			return nil, err
+		}
+		return priv, nil
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block type '%v' for private key", block.Type)
+}
+
+func readEncryptionHeader(f *Descriptor, sizeLimitBytes int64) (encryptionHeader, error) {
+	var header encryptionHeader
+
+	buf, err := readFile(f, sizeLimitBytes)
+	if err != nil {
+		return header, err
+	}
+
+	if err := util.NewJSONDecoder(&buf).Decode(&header); err != nil {
+		return header, fmt.Errorf("bundle load failed on encryption header decode: %w", err)
+	}
+
+	if len(header.Recipients) == 0 {
+		return header, fmt.Errorf("bundle encryption header contains no recipients")
+	}
+
+	return header, nil
+}
+
+func isEncryptionFile(path string) bool {
+	return filepath.Base(path) == "."+EncryptionFile
+}
@@ -0,0 +1,392 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/internal/file/archive"
+)
+
+type testEncryptionKey struct {
+	public  string
+	private string
+}
+
+func newTestEncryptionKey(t *testing.T, kind string) testEncryptionKey {
+	t.Helper()
+
+	var pub, priv []byte
+	var err error
+
+	switch kind {
+	case "rsa":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err = x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	case "ecdsa":
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err = x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	case "sm2":
+		key, err := sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err = smx509.MarshalSm2PublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, err = smx509.WritePrivateKeyToPem(key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testEncryptionKey{
+		public:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+		private: string(priv),
+	}
+}
+
+func testEncryptionBundle() Bundle {
+	module := `package example
+
+# confidential rule
+allow { input.secret == "s3cr3t" }`
+
+	return Bundle{
+		Manifest: Manifest{Revision: "abc", Roots: &[]string{"example"}},
+		Data:     map[string]interface{}{"example": map[string]interface{}{"masks": []interface{}{"ssn"}}},
+		Modules: []ModuleFile{
+			{
+				URL:    "/example/example.rego",
+				Path:   "/example/example.rego",
+				Parsed: ast.MustParseModule(module),
+				Raw:    []byte(module),
+			},
+		},
+	}
+}
+
+func writeEncryptedBundle(t *testing.T, b Bundle, config *EncryptionConfig) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).UseModulePath(true).WithEncryptionConfig(config).Write(b); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncryptedBundleRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		kind string
+		alg  string
+	}{
+		{kind: "rsa", alg: EncryptionAlgAES256GCM},
+		{kind: "ecdsa", alg: EncryptionAlgAES256GCM},
+		{kind: "sm2", alg: EncryptionAlgSM4GCM},
+		{kind: "rsa", alg: EncryptionAlgSM4GCM},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.kind+"/"+tc.alg, func(t *testing.T) {
+			key := newTestEncryptionKey(t, tc.kind)
+			exp := testEncryptionBundle()
+
+			raw := writeEncryptedBundle(t, exp, NewEncryptionConfig(key.public, "edge", tc.alg))
+
+			// the policy must not be readable from the archive
+			gr, err := gzip.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain, err := io.ReadAll(gr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(plain, []byte("s3cr3t")) || bytes.Contains(plain, []byte("ssn")) {
+				t.Fatal("expected bundle contents to be encrypted")
+			}
+
+			dc := NewDecryptionConfig(map[string]*KeyConfig{"edge": {PrivateKey: key.private}}, "edge")
+
+			result, err := NewReader(bytes.NewReader(raw)).WithDecryptionConfig(dc).Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !result.Equal(exp) {
+				t.Fatalf("expected %v but got %v", exp, result)
+			}
+		})
+	}
+}
+
+func TestEncryptedBundleErrors(t *testing.T) {
+
+	key := newTestEncryptionKey(t, "rsa")
+	other := newTestEncryptionKey(t, "rsa")
+	b := testEncryptionBundle()
+
+	raw := writeEncryptedBundle(t, b, NewEncryptionConfig(key.public, "edge", ""))
+
+	var plain bytes.Buffer
+	if err := NewWriter(&plain).UseModulePath(true).Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		note   string
+		raw    []byte
+		config *DecryptionConfig
+		err    string
+	}{
+		{
+			note: "no decryption config",
+			raw:  raw,
+			err:  "bundle is encrypted but decryption key not provided",
+		},
+		{
+			note:   "key id mismatch",
+			raw:    raw,
+			config: NewDecryptionConfig(map[string]*KeyConfig{"other": {PrivateKey: key.private}}, "other"),
+			err:    "bundle is not encrypted for key ID other",
+		},
+		{
+			note:   "no matching keys",
+			raw:    raw,
+			config: NewDecryptionConfig(map[string]*KeyConfig{"other": {PrivateKey: key.private}}, ""),
+			err:    "bundle is not encrypted for any of the configured keys",
+		},
+		{
+			note:   "wrong private key",
+			raw:    raw,
+			config: NewDecryptionConfig(map[string]*KeyConfig{"edge": {PrivateKey: other.private}}, ""),
+			err:    "failed to decrypt content key for key ID edge",
+		},
+		{
+			note:   "key type mismatch",
+			raw:    raw,
+			config: NewDecryptionConfig(map[string]*KeyConfig{"edge": {PrivateKey: newTestEncryptionKey(t, "ecdsa").private}}, ""),
+			err:    "key wrapping algorithm 'RSA-OAEP-256' does not match key type *ecdsa.PrivateKey",
+		},
+		{
+			note:   "plaintext bundle with required key",
+			raw:    plain.Bytes(),
+			config: NewDecryptionConfig(map[string]*KeyConfig{"edge": {PrivateKey: key.private}}, "edge"),
+			err:    "bundle missing .encryption.json file",
+		},
+		{
+			note:   "plaintext bundle with decryption required",
+			raw:    plain.Bytes(),
+			config: &DecryptionConfig{PrivateKeys: map[string]*KeyConfig{"edge": {PrivateKey: key.private}}, Required: true},
+			err:    "bundle missing .encryption.json file",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(tc.raw)).WithDecryptionConfig(tc.config).Read()
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error %q but got %v", tc.err, err)
+			}
+		})
+	}
+
+	t.Run("plaintext bundle without required key", func(t *testing.T) {
+		dc := NewDecryptionConfig(map[string]*KeyConfig{"edge": {PrivateKey: key.private}}, "")
+		if _, err := NewReader(bytes.NewReader(plain.Bytes())).WithDecryptionConfig(dc).Read(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestEncryptedBundleTamperedFiles(t *testing.T) {
+
+	key := newTestEncryptionKey(t, "ecdsa")
+	raw := writeEncryptedBundle(t, testEncryptionBundle(), NewEncryptionConfig(key.public, "edge", ""))
+	dc := NewDecryptionConfig(map[string]*KeyConfig{"edge": {PrivateKey: key.private}}, "edge")
+
+	rewrite := func(f func(path string, content []byte) (string, []byte)) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		loader := NewTarballLoader(bytes.NewReader(raw))
+		for {
+			d, err := loader.NextFile()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var content bytes.Buffer
+			if _, err := io.Copy(&content, d.reader); err != nil {
+				t.Fatal(err)
+			}
+			path, bs := f(d.Path(), content.Bytes())
+			if err := archive.WriteFile(tw, path, bs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("modified content", func(t *testing.T) {
+		tampered := rewrite(func(path string, content []byte) (string, []byte) {
+			if strings.HasSuffix(path, "data.json") {
+				content[len(content)-1] ^= 0xff
+			}
+			return path, content
+		})
+		_, err := NewReader(bytes.NewReader(tampered)).WithDecryptionConfig(dc).Read()
+		if err == nil || err.Error() != "bundle file 'data.json' could not be decrypted" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("moved file", func(t *testing.T) {
+		tampered := rewrite(func(path string, content []byte) (string, []byte) {
+			if strings.HasSuffix(path, "data.json") {
+				return "/example/data.json", content
+			}
+			return path, content
+		})
+		_, err := NewReader(bytes.NewReader(tampered)).WithDecryptionConfig(dc).Read()
+		if err == nil || err.Error() != "bundle file 'example/data.json' could not be decrypted" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestEncryptedSignedBundle(t *testing.T) {
+
+	key := newTestEncryptionKey(t, "sm2")
+	b := testEncryptionBundle()
+
+	if err := b.GenerateSignature(NewSigningConfig("secret", "HS256", ""), "foo", true); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := writeEncryptedBundle(t, b, NewEncryptionConfig(key.public, "edge", EncryptionAlgSM4GCM))
+
+	vc := NewVerificationConfig(map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}}, "foo", "", nil)
+	dc := NewDecryptionConfig(map[string]*KeyConfig{"edge": {PrivateKey: key.private}}, "edge")
+
+	result, err := NewReader(bytes.NewReader(raw)).
+		WithBundleVerificationConfig(vc).
+		WithDecryptionConfig(dc).
+		Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Equal(b) {
+		t.Fatalf("expected %v but got %v", b, result)
+	}
+}
+
+func TestEncryptedDeltaBundle(t *testing.T) {
+
+	key := newTestEncryptionKey(t, "rsa")
+
+	b := Bundle{
+		Manifest: Manifest{Revision: "def"},
+		Patch: Patch{Data: []PatchOperation{
+			{Op: "upsert", Path: "/a/b", Value: "secret"},
+		}},
+	}
+
+	raw := writeEncryptedBundle(t, b, NewEncryptionConfig(key.public, "edge", ""))
+	dc := NewDecryptionConfig(map[string]*KeyConfig{"edge": {PrivateKey: key.private}}, "")
+
+	result, err := NewReader(bytes.NewReader(raw)).WithDecryptionConfig(dc).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Type() != DeltaBundleType || len(result.Patch.Data) != 1 || result.Patch.Data[0].Value != "secret" {
+		t.Fatalf("unexpected delta bundle: %v", result.Patch)
+	}
+}
+
+func TestDecryptionConfigValidateAndInjectDefaults(t *testing.T) {
+
+	keys := map[string]*KeyConfig{
+		"pub":  {Key: "public"},
+		"priv": {PrivateKey: "private"},
+	}
+
+	tests := []struct {
+		keyID    string
+		required bool
+		keys     map[string]*KeyConfig
+		err      string
+	}{
+		{keyID: ""},
+		{keyID: "priv"},
+		{keyID: "pub", err: "key id pub has no private key"},
+		{keyID: "missing", err: "key id missing not found"},
+		{required: true},
+		{required: true, keys: map[string]*KeyConfig{"pub": {Key: "public"}}, err: "decryption required but no private key configured"},
+	}
+
+	for _, tc := range tests {
+		dc := NewDecryptionConfig(nil, tc.keyID)
+		dc.Required = tc.required
+		ks := keys
+		if tc.keys != nil {
+			ks = tc.keys
+		}
+		err := dc.ValidateAndInjectDefaults(ks)
+		if tc.err == "" && err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.keyID, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%v: expected error %q but got %v", tc.keyID, tc.err, err)
+		}
+	}
+}
@@ -16,6 +16,8 @@ import (
 	"io"
 	"sort"
 	"strings"
+
+	"github.com/tjfoc/gmsm/sm3"
 )
 
 // HashingAlgorithm represents a subset of hashing algorithms implemented in Go
@@ -31,6 +33,7 @@ const (
 	SHA512    HashingAlgorithm = "SHA-512"
 	SHA512224 HashingAlgorithm = "SHA-512-224"
 	SHA512256 HashingAlgorithm = "SHA-512-256"
+	SM3       HashingAlgorithm = "SM3"
 )
 
 // String returns the string representation of a HashingAlgorithm
@@ -68,6 +71,8 @@ func NewSignatureHasher(alg HashingAlgorithm) (SignatureHasher, error) {
 		h.h = sha512.New512_224
 	case SHA512256:
 		h.h = sha512.New512_256
+	case SM3:
+		h.h = sm3.New
 	default:
 		return nil, fmt.Errorf("unsupported hashing algorithm: %s", alg)
 	}
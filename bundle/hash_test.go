@@ -97,6 +97,7 @@ func TestHashFileBytes(t *testing.T) {
 	}{
 		"map_byte_array":   {mapBytes, SHA256},
 		"array_byte_array": {arrayBytes, MD5},
+		"map_bytes_sm3":    {mapBytes, SM3},
 	}
 
 	for name, tc := range tests {
@@ -32,6 +32,8 @@ type VerificationConfig struct {
 	KeyID      string   `json:"keyid"`
 	Scope      string   `json:"scope"`
 	Exclude    []string `json:"exclude_files"`
+	KeyIDs     []string `json:"keyids,omitempty"`    // keys that must have signed the bundle, or with a threshold, that may
+	Threshold  int      `json:"threshold,omitempty"` // minimum number of distinct keys that must have signed the bundle
 }
 
 // NewVerificationConfig return a new VerificationConfig
@@ -61,40 +63,121 @@ func (vc *VerificationConfig) ValidateAndInjectDefaults(keys map[string]*KeyConf
 			return fmt.Errorf("key id %s not found", vc.KeyID)
 		}
 	}
+
+	for _, id := range vc.KeyIDs {
+		if _, ok := keys[id]; !ok {
+			return fmt.Errorf("key id %s not found", id)
+		}
+	}
+
+	if vc.Threshold < 0 {
+		return fmt.Errorf("invalid threshold %d", vc.Threshold)
+	}
+
+	if vc.Threshold > len(keys) {
+		return fmt.Errorf("threshold %d exceeds number of keys (%d)", vc.Threshold, len(keys))
+	}
+
+	if n := vc.numAcceptedKeys(); n > 0 && vc.Threshold > n {
+		return fmt.Errorf("threshold %d exceeds number of accepted keys (%d)", vc.Threshold, n)
+	}
+
 	return nil
 }
 
+// acceptsKey returns true if signatures made with the key may be used to
+// verify bundles. If KeyID or KeyIDs are set, only those keys are accepted.
+// Otherwise any configured key is.
+func (vc *VerificationConfig) acceptsKey(id string) bool {
+	if vc.KeyID == "" && len(vc.KeyIDs) == 0 {
+		return true
+	}
+	if id == vc.KeyID {
+		return true
+	}
+	for _, kid := range vc.KeyIDs {
+		if id == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// numAcceptedKeys returns the number of distinct keys set by KeyID and
+// KeyIDs.
+func (vc *VerificationConfig) numAcceptedKeys() int {
+	ids := map[string]struct{}{}
+	if vc.KeyID != "" {
+		ids[vc.KeyID] = struct{}{}
+	}
+	for _, id := range vc.KeyIDs {
+		ids[id] = struct{}{}
+	}
+	return len(ids)
+}
+
+// isMultiSignature returns true if the config requires signatures from
+// specific keys or a minimum number of keys.
+func (vc *VerificationConfig) isMultiSignature() bool {
+	return vc != nil && (len(vc.KeyIDs) > 0 || vc.Threshold > 0)
+}
+
 // GetPublicKey returns the public key corresponding to the given key id
 func (vc *VerificationConfig) GetPublicKey(id string) (*KeyConfig, error) {
 	var kc *KeyConfig
 	var ok bool
 
 	if kc, ok = vc.PublicKeys[id]; !ok {
-		return nil, fmt.Errorf("verification key corresponding to ID %v not found", id)
+		return nil, unknownKeyError(id)
 	}
 	return kc, nil
 }
 
 // SigningConfig represents the key configuration used to generate a signed bundle
 type SigningConfig struct {
-	Plugin     string
-	Key        string
-	Algorithm  string
-	ClaimsPath string
+	Plugin           string
+	Key              string
+	Algorithm        string
+	HashingAlgorithm HashingAlgorithm
+	ClaimsPath       string
 }
 
-// NewSigningConfig return a new SigningConfig
+// NewSigningConfig return a new SigningConfig. Files are hashed with SM3 when
+// signing with SM2 and with SHA-256 otherwise.
 func NewSigningConfig(key, alg, claimsPath string) *SigningConfig {
 	if alg == "" {
 		alg = defaultTokenSigningAlg
 	}
 
 	return &SigningConfig{
-		Plugin:     defaultSignerID,
-		Key:        key,
-		Algorithm:  alg,
-		ClaimsPath: claimsPath,
+		Plugin:           defaultSignerID,
+		Key:              key,
+		Algorithm:        alg,
+		HashingAlgorithm: defaultHashingAlgorithm(alg),
+		ClaimsPath:       claimsPath,
+	}
+}
+
+// WithHashingAlgorithm sets the algorithm used to hash the bundle files in the signing config
+func (s *SigningConfig) WithHashingAlgorithm(alg HashingAlgorithm) *SigningConfig {
+	if alg != "" {
+		s.HashingAlgorithm = alg
+	}
+	return s
+}
+
+func (s *SigningConfig) hashingAlgorithm() HashingAlgorithm {
+	if s.HashingAlgorithm == "" {
+		return defaultHashingAlgorithm(s.Algorithm)
+	}
+	return s.HashingAlgorithm
+}
+
+func defaultHashingAlgorithm(alg string) HashingAlgorithm {
+	if jwa.SignatureAlgorithm(alg) == jwa.SM2 {
+		return SM3
 	}
+	return HashingAlgorithm(defaultHashingAlg)
 }
 
 // WithPlugin sets the signing plugin in the signing config
@@ -38,6 +38,31 @@ func TestValidateAndInjectDefaultsVerificationConfig(t *testing.T) {
 			NewVerificationConfig(map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}}, "bar", "", nil),
 			true, fmt.Errorf("key id bar not found"),
 		},
+		"valid_config_with_required_keys_and_threshold": {
+			map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}, "bar": {Key: "secret", Algorithm: "HS256"}},
+			&VerificationConfig{KeyIDs: []string{"foo", "bar"}, Threshold: 1},
+			false, nil,
+		},
+		"threshold_exceeds_accepted_keys": {
+			map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}, "bar": {Key: "secret", Algorithm: "HS256"}},
+			&VerificationConfig{KeyIDs: []string{"foo"}, Threshold: 2},
+			true, fmt.Errorf("threshold 2 exceeds number of accepted keys (1)"),
+		},
+		"required_key_not_found": {
+			map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}},
+			&VerificationConfig{KeyIDs: []string{"foo", "bar"}},
+			true, fmt.Errorf("key id bar not found"),
+		},
+		"threshold_exceeds_keys": {
+			map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}},
+			&VerificationConfig{Threshold: 2},
+			true, fmt.Errorf("threshold 2 exceeds number of keys (1)"),
+		},
+		"negative_threshold": {
+			map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}},
+			&VerificationConfig{Threshold: -1},
+			true, fmt.Errorf("invalid threshold -1"),
+		},
 	}
 
 	for name, tc := range tests {
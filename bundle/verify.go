@@ -57,90 +57,185 @@ func VerifyBundleSignature(sc SignaturesConfig, bvc *VerificationConfig) (map[st
 type DefaultVerifier struct{}
 
 // VerifyBundleSignature verifies the bundle signature using the given public keys or secret.
-// If a signature is verified, it keeps track of the files specified in the JWT payload
+// If a signature is verified, it keeps track of the files specified in the JWT payload.
+//
+// Bundles may carry multiple signatures. By default, all of them must be valid.
+// If the verification config lists key IDs or sets a threshold, signatures
+// from keys that are not configured or not accepted are ignored and the bundle
+// is accepted if all listed keys, or with a threshold at least threshold
+// distinct accepted keys, signed it. All valid signatures must cover the same
+// files.
 func (*DefaultVerifier) VerifyBundleSignature(sc SignaturesConfig, bvc *VerificationConfig) (map[string]FileInfo, error) {
 	files := make(map[string]FileInfo)
 
 	if len(sc.Signatures) == 0 {
-		return files, fmt.Errorf(".signatures.json: missing JWT (expected exactly one)")
+		return files, fmt.Errorf(".signatures.json: missing JWT (expected at least one)")
 	}
 
-	if len(sc.Signatures) > 1 {
-		return files, fmt.Errorf(".signatures.json: multiple JWTs not supported (expected exactly one)")
-	}
+	// signed maps the IDs of the keys with valid signatures to the payloads
+	signed := map[string]*DecodedSignature{}
+	var keyIDs []string
 
 	for _, token := range sc.Signatures {
-		payload, err := verifyJWTSignature(token, bvc)
+		keyID, payload, err := verifyJWTSignature(token, bvc, len(sc.Signatures) > 1)
 		if err != nil {
+			if isIgnorableKeyError(err) && bvc.isMultiSignature() {
+				continue
+			}
 			return files, err
 		}
 
-		for _, file := range payload.Files {
-			files[file.Name] = file
+		if len(keyIDs) > 0 && !EqualSignedFiles(signed[keyIDs[0]].Files, payload.Files) {
+			return files, fmt.Errorf(".signatures.json: signatures cover different files")
+		}
+
+		if _, ok := signed[keyID]; !ok {
+			keyIDs = append(keyIDs, keyID)
 		}
+		signed[keyID] = payload
 	}
+
+	// With a threshold, the key IDs are the keys that may sign the bundle.
+	// Otherwise each of them must have.
+	if bvc.Threshold == 0 {
+		for _, keyID := range bvc.KeyIDs {
+			if _, ok := signed[keyID]; !ok {
+				return files, fmt.Errorf(".signatures.json: missing valid signature for required key %v", keyID)
+			}
+		}
+	}
+
+	threshold := bvc.Threshold
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	if len(keyIDs) < threshold {
+		return files, fmt.Errorf(".signatures.json: %d valid signature(s) from distinct keys (expected at least %d)", len(keyIDs), threshold)
+	}
+
+	for _, file := range signed[keyIDs[0]].Files {
+		files[file.Name] = file
+	}
+
 	return files, nil
 }
 
-func verifyJWTSignature(token string, bvc *VerificationConfig) (*DecodedSignature, error) {
+// unknownKeyError is returned when the key a signature refers to is not
+// configured.
+type unknownKeyError string
+
+func (e unknownKeyError) Error() string {
+	return fmt.Sprintf("verification key corresponding to ID %v not found", string(e))
+}
+
+// unacceptedKeyError is returned when a signature was made with a key that the
+// verification config does not accept.
+type unacceptedKeyError string
+
+func (e unacceptedKeyError) Error() string {
+	return fmt.Sprintf("verification key ID %v not accepted", string(e))
+}
+
+func isIgnorableKeyError(err error) bool {
+	switch err.(type) {
+	case unknownKeyError, unacceptedKeyError:
+		return true
+	}
+	return false
+}
+
+// EqualSignedFiles returns true if x and y contain the same files with the same
+// hashes, regardless of their order.
+func EqualSignedFiles(x, y []FileInfo) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	files := make(map[string]FileInfo, len(x))
+	for _, file := range x {
+		files[file.Name] = file
+	}
+	for _, file := range y {
+		if other, ok := files[file.Name]; !ok || other != file {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyJWTSignature verifies the token and returns the ID of the key that
+// signed it along with the decoded payload. If the bundle carries multiple
+// signatures, the key ID in the token takes precedence over the key ID in
+// the verification config, but only keys accepted by the config are used.
+func verifyJWTSignature(token string, bvc *VerificationConfig, multiple bool) (string, *DecodedSignature, error) {
 	// decode JWT to check if the header specifies the key to use and/or if claims have the scope.
 
 	parts, err := jws.SplitCompact(token)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	var decodedHeader []byte
 	if decodedHeader, err = base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
-		return nil, errors.Wrap(err, "failed to base64 decode JWT headers")
+		return "", nil, errors.Wrap(err, "failed to base64 decode JWT headers")
 	}
 
 	var hdr jws.StandardHeaders
 	if err := json.Unmarshal(decodedHeader, &hdr); err != nil {
-		return nil, errors.Wrap(err, "failed to parse JWT headers")
+		return "", nil, errors.Wrap(err, "failed to parse JWT headers")
 	}
 
 	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	var ds DecodedSignature
 	if err := json.Unmarshal(payload, &ds); err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	// check for the id of the key to use for JWT signature verification
 	// first in the OPA config. If not found, then check the JWT kid.
+	if bvc == nil {
+		return "", nil, fmt.Errorf("verification key not provided")
+	}
+
+	// With multiple signatures, each JWT identifies its own key.
 	keyID := bvc.KeyID
-	if keyID == "" {
-		keyID = hdr.KeyID
+	if keyID == "" || multiple {
+		if hdr.KeyID != "" {
+			keyID = hdr.KeyID
+		} else if ds.KeyID != "" {
+			// If header has no key id, check the deprecated key claim.
+			keyID = ds.KeyID
+		}
 	}
+
 	if keyID == "" {
-		// If header has no key id, check the deprecated key claim.
-		keyID = ds.KeyID
+		return "", nil, fmt.Errorf("verification key ID is empty")
 	}
 
-	if keyID == "" {
-		return nil, fmt.Errorf("verification key ID is empty")
+	if !bvc.acceptsKey(keyID) {
+		return "", nil, unacceptedKeyError(keyID)
 	}
 
 	// now that we have the keyID, fetch the actual key
 	keyConfig, err := bvc.GetPublicKey(keyID)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	// verify JWT signature
 	alg := jwa.SignatureAlgorithm(keyConfig.Algorithm)
 	key, err := verify.GetSigningKey(keyConfig.Key, alg)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	_, err = jws.Verify([]byte(token), alg, key)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	// verify the scope
@@ -150,9 +245,9 @@ func verifyJWTSignature(token string, bvc *VerificationConfig) (*DecodedSignatur
 	}
 
 	if ds.Scope != scope {
-		return nil, fmt.Errorf("scope mismatch")
+		return "", nil, fmt.Errorf("scope mismatch")
 	}
-	return &ds, nil
+	return keyID, &ds, nil
 }
 
 // VerifyBundleFile verifies the hash of a file in the bundle matches to that provided in the bundle's signature
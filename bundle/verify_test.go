@@ -24,8 +24,8 @@ func TestVerifyBundleSignature(t *testing.T) {
 		wantErr            bool
 		err                error
 	}{
-		"no_signatures":       {SignaturesConfig{}, nil, true, fmt.Errorf(".signatures.json: missing JWT (expected exactly one)")},
-		"multiple_signatures": {SignaturesConfig{Signatures: []string{signedTokenHS256, otherSignedTokenHS256}}, nil, true, fmt.Errorf(".signatures.json: multiple JWTs not supported (expected exactly one)")},
+		"no_signatures":       {SignaturesConfig{}, nil, true, fmt.Errorf(".signatures.json: missing JWT (expected at least one)")},
+		"multiple_signatures": {SignaturesConfig{Signatures: []string{signedTokenHS256, otherSignedTokenHS256}}, nil, true, fmt.Errorf("verification key not provided")},
 		"invalid_token":       {SignaturesConfig{Signatures: []string{badToken}}, nil, true, fmt.Errorf("Failed to split compact serialization")},
 		"invalid_token_header_base64": {
 			SignaturesConfig{Signatures: []string{badTokenHeaderBase64}},
@@ -200,7 +200,7 @@ yQjtQ8mbDOsiLLvh7wIDAQAB==
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
 
-			_, err := verifyJWTSignature(tc.token, NewVerificationConfig(tc.keys, tc.keyID, tc.scope, nil))
+			_, _, err := verifyJWTSignature(tc.token, NewVerificationConfig(tc.keys, tc.keyID, tc.scope, nil), false)
 
 			if tc.wantErr {
 				if err == nil {
@@ -225,12 +225,89 @@ yQjtQ8mbDOsiLLvh7wIDAQAB==
 		Algorithm: "RS256",
 	}
 
-	_, err := verifyJWTSignature(signedTokenRS256, NewVerificationConfig(keys, "foo", "write", nil))
+	_, _, err := verifyJWTSignature(signedTokenRS256, NewVerificationConfig(keys, "foo", "write", nil), false)
 	if err != nil {
 		t.Fatalf("Unexpected error %v", err)
 	}
 }
 
+func TestVerifyBundleSignatureMultiple(t *testing.T) {
+
+	files := []FileInfo{NewFile("data.json", "c2131544c716a25a5e31f504300f5240e8235cadb9a57f0bd1b6f4bd74b26612", SHA256.String())}
+	otherFiles := []FileInfo{NewFile("data.json", "42cfe6768b57bb5f7503c165c28dd07ac5b813554ebc850f2cc35843e7137b1d", SHA256.String())}
+
+	token := func(keyID, secret string, files []FileInfo) string {
+		t.Helper()
+		tok, err := GenerateSignedToken(files, NewSigningConfig(secret, "HS256", ""), keyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+
+	keys := map[string]*KeyConfig{
+		"policy":   {Key: "policy-secret", Algorithm: "HS256"},
+		"security": {Key: "security-secret", Algorithm: "HS256"},
+	}
+
+	policy := token("policy", "policy-secret", files)
+	security := token("security", "security-secret", files)
+	unknown := token("other", "other-secret", files)
+	forged := token("security", "wrong-secret", files)
+	different := token("security", "security-secret", otherFiles)
+
+	tests := map[string]struct {
+		signatures []string
+		keyID      string
+		keyIDs     []string
+		threshold  int
+		err        string
+	}{
+		"all_valid":                   {signatures: []string{policy, security}},
+		"config_key_id_unpinned_key":  {signatures: []string{policy, security}, keyID: "policy", err: "verification key ID security not accepted"},
+		"config_key_id_only_unpinned": {signatures: []string{security, security}, keyID: "policy", err: "verification key ID security not accepted"},
+		"config_key_id_threshold":     {signatures: []string{security, policy}, keyID: "policy", threshold: 1},
+		"config_key_id_no_pinned_sig": {signatures: []string{security, unknown}, keyID: "policy", threshold: 1, err: ".signatures.json: 0 valid signature(s) from distinct keys (expected at least 1)"},
+		"unknown_key":                 {signatures: []string{policy, unknown}, err: "verification key corresponding to ID other not found"},
+		"unknown_key_threshold":       {signatures: []string{policy, unknown}, threshold: 1},
+		"unknown_key_required":        {signatures: []string{unknown, policy}, keyIDs: []string{"policy"}},
+		"unlisted_key_required":       {signatures: []string{security, security}, keyIDs: []string{"policy"}, err: ".signatures.json: missing valid signature for required key policy"},
+		"required_keys":               {signatures: []string{security, policy}, keyIDs: []string{"policy", "security"}},
+		"required_key_missing":        {signatures: []string{policy, unknown}, keyIDs: []string{"policy", "security"}, err: ".signatures.json: missing valid signature for required key security"},
+		"threshold":                   {signatures: []string{policy, security}, threshold: 2},
+		"threshold_of_key_ids":        {signatures: []string{security, unknown}, keyIDs: []string{"policy", "security"}, threshold: 1},
+		"threshold_unlisted_key":      {signatures: []string{security, policy}, keyIDs: []string{"policy"}, threshold: 1},
+		"threshold_same_key":          {signatures: []string{policy, policy}, threshold: 2, err: ".signatures.json: 1 valid signature(s) from distinct keys (expected at least 2)"},
+		"threshold_only_unknown_keys": {signatures: []string{unknown}, threshold: 1, err: ".signatures.json: 0 valid signature(s) from distinct keys (expected at least 1)"},
+		"invalid_signature":           {signatures: []string{policy, forged}, threshold: 1, err: "Failed to verify message: failed to match hmac signature"},
+		"different_files":             {signatures: []string{policy, different}, threshold: 2, err: ".signatures.json: signatures cover different files"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			bvc := NewVerificationConfig(keys, tc.keyID, "", nil)
+			bvc.KeyIDs = tc.keyIDs
+			bvc.Threshold = tc.threshold
+
+			result, err := VerifyBundleSignature(SignaturesConfig{Signatures: tc.signatures}, bvc)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Expected error %q but got: %v", tc.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(result) != 1 || result["data.json"] != files[0] {
+				t.Fatalf("Expected signed files %v but got: %v", files, result)
+			}
+		})
+	}
+}
+
 func TestVerifyBundleFile(t *testing.T) {
 
 	tests := map[string]struct {
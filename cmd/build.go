@@ -18,6 +18,7 @@ import (
 	"github.com/meta-quick/opax/bundle"
 	"github.com/meta-quick/opax/compile"
 	"github.com/meta-quick/opax/keys"
+	"github.com/meta-quick/opax/loader"
 	"github.com/meta-quick/opax/util"
 )
 
@@ -41,12 +42,18 @@ type buildParams struct {
 	claimsFile         string
 	excludeVerifyFiles []string
 	plugin             string
+	delta              string
+	verifyDelta        bool
+	encryptKey         string
+	encryptKeyID       string
+	encryptAlg         *util.EnumFlag
 }
 
 func newBuildParams() buildParams {
 	return buildParams{
 		capabilities: newcapabilitiesFlag(),
 		target:       util.NewEnumFlag(compile.TargetRego, compile.Targets),
+		encryptAlg:   util.NewEnumFlag(bundle.EncryptionAlgAES256GCM, bundle.EncryptionAlgorithms),
 	}
 }
 
@@ -165,6 +172,43 @@ containing optional claims.
 For more information on the format of the ".signatures.json" file
 see https://www.openpolicyagent.org/docs/latest/management-bundles/#signature-format.
 
+Delta Bundles
+-------------
+
+The --delta flag makes the 'build' command emit a delta bundle instead of a snapshot
+bundle. The paths are built into a snapshot as usual and the data in that snapshot is
+compared with the data in the previous snapshot bundle given to --delta. The output
+contains the JSON Patch operations that transform the previous data into the new data
+within the manifest roots. The output manifest (and revision) is taken from the new
+snapshot. The revision must be set and must differ from the previous revision.
+
+Delta bundles cannot carry policies, so the command fails if the policies or manifest
+roots differ between the snapshots. Delta bundles cannot be signed.
+
+The --verify-delta flag applies the generated delta to the previous snapshot and
+checks that the result matches the new snapshot before writing the output.
+
+Example:
+
+    $ opa build -b ./v2 --revision v2 --delta v1.tar.gz --verify-delta -o v2-delta.tar.gz
+
+Encryption
+----------
+
+The 'build' command can encrypt the output bundle so that policies and data are
+not readable at rest. The bundle files are encrypted with a random content key
+(--encrypt-alg selects AES-256-GCM or SM4-GCM) and the content key is wrapped with
+the public key given by the --encrypt-key flag. RSA, ECDSA and SM2 public keys (or
+certificates) are supported. The --encrypt-key-id flag names the key; OPA uses the
+private key configured under that name in the 'keys' section to decrypt the bundle.
+
+Signatures are generated over the plaintext files, so encrypted bundles can be signed
+as well. The ".signatures.json" file is not encrypted.
+
+Example:
+
+    $ opa build --bundle foo --encrypt-key /path/to/public_key.pem --encrypt-key-id edge
+
 Capabilities
 ------------
 
@@ -223,6 +267,8 @@ against OPA v0.22.0:
 	buildCommand.Flags().VarP(&buildParams.entrypoints, "entrypoint", "e", "set slash separated entrypoint path")
 	buildCommand.Flags().VarP(&buildParams.revision, "revision", "r", "set output bundle revision")
 	buildCommand.Flags().StringVarP(&buildParams.outputFile, "output", "o", "bundle.tar.gz", "set the output filename")
+	buildCommand.Flags().StringVarP(&buildParams.delta, "delta", "", "", "build a delta bundle against the previous snapshot bundle at this path")
+	buildCommand.Flags().BoolVarP(&buildParams.verifyDelta, "verify-delta", "", false, "verify that the delta bundle applied to the previous snapshot yields the new snapshot")
 
 	addBundleModeFlag(buildCommand.Flags(), &buildParams.bundleMode, false)
 	addIgnoreFlag(buildCommand.Flags(), &buildParams.ignore)
@@ -240,6 +286,11 @@ against OPA v0.22.0:
 	addSigningPluginFlag(buildCommand.Flags(), &buildParams.plugin)
 	addClaimsFileFlag(buildCommand.Flags(), &buildParams.claimsFile)
 
+	// bundle encryption config
+	addEncryptionKeyFlag(buildCommand.Flags(), &buildParams.encryptKey)
+	addEncryptionKeyIDFlag(buildCommand.Flags(), &buildParams.encryptKeyID, defaultPublicKeyID)
+	addEncryptionAlgFlag(buildCommand.Flags(), buildParams.encryptAlg)
+
 	RootCommand.AddCommand(buildCommand)
 }
 
@@ -255,11 +306,19 @@ func dobuild(params buildParams, args []string) error {
 
 	bsc := buildSigningConfig(params.key, params.algorithm, params.claimsFile, params.plugin)
 
+	bec := buildEncryptionConfig(params.encryptKey, params.encryptKeyID, params.encryptAlg.String())
+
 	if bvc != nil || bsc != nil {
 		if !params.bundleMode {
 			return fmt.Errorf("enable bundle mode (ie. --bundle) to verify or sign bundle files or directories")
 		}
 	}
+
+	if params.delta == "" && params.verifyDelta {
+		return fmt.Errorf("specify the previous snapshot bundle (ie. --delta) to verify the delta bundle")
+	} else if params.delta != "" && bsc != nil {
+		return fmt.Errorf("delta bundles cannot be signed")
+	}
 	var capabilities *ast.Capabilities
 	// if capabilities are not provided as a cmd flag,
 	// then ast.CapabilitiesForThisVersion must be called
@@ -279,7 +338,8 @@ func dobuild(params buildParams, args []string) error {
 		WithPaths(args...).
 		WithFilter(buildCommandLoaderFilter(params.bundleMode, params.ignore)).
 		WithBundleVerificationConfig(bvc).
-		WithBundleSigningConfig(bsc)
+		WithBundleSigningConfig(bsc).
+		WithBundleEncryptionConfig(bec)
 
 	if params.revision.isSet {
 		compiler = compiler.WithRevision(*params.revision.v)
@@ -298,6 +358,13 @@ func dobuild(params buildParams, args []string) error {
 		return err
 	}
 
+	if params.delta != "" {
+		buf, err = buildDelta(params.delta, *compiler.Bundle(), params.verifyDelta, bec)
+		if err != nil {
+			return err
+		}
+	}
+
 	out, err := os.Create(params.outputFile)
 	if err != nil {
 		return err
@@ -311,6 +378,49 @@ func dobuild(params buildParams, args []string) error {
 	return out.Close()
 }
 
+// buildDelta returns the delta bundle between the snapshot bundle at prevPath
+// and next. If verify is true, the delta bundle is read back and applied to
+// the previous snapshot to check that it yields next. If bec is set, the delta
+// bundle is encrypted.
+func buildDelta(prevPath string, next bundle.Bundle, verify bool, bec *bundle.EncryptionConfig) (*bytes.Buffer, error) {
+
+	prev, err := loader.NewFileLoader().WithSkipBundleVerification(true).AsBundle(prevPath)
+	if err != nil {
+		return nil, err
+	}
+
+	delta, err := bundle.NewDelta(*prev, next)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := bundle.NewWriter(buf).Write(delta); err != nil {
+		return nil, err
+	}
+
+	if verify {
+		written, err := bundle.NewReader(bytes.NewReader(buf.Bytes())).WithSkipBundleVerification(true).Read()
+		if err != nil {
+			return nil, err
+		}
+		if err := bundle.VerifyDelta(*prev, written, next); err != nil {
+			return nil, err
+		}
+	}
+
+	if bec == nil {
+		return buf, nil
+	}
+
+	encrypted := bytes.NewBuffer(nil)
+	if err := bundle.NewWriter(encrypted).WithEncryptionConfig(bec).Write(delta); err != nil {
+		return nil, err
+	}
+
+	return encrypted, nil
+}
+
 func buildCommandLoaderFilter(bundleMode bool, ignore []string) func(string, os.FileInfo, int) bool {
 	return func(abspath string, info os.FileInfo, depth int) bool {
 		if !bundleMode {
@@ -341,3 +451,11 @@ func buildSigningConfig(key, alg, claimsFile, plugin string) *bundle.SigningConf
 
 	return bundle.NewSigningConfig(key, alg, claimsFile).WithPlugin(plugin)
 }
+
+func buildEncryptionConfig(key, keyID, alg string) *bundle.EncryptionConfig {
+	if key == "" {
+		return nil
+	}
+
+	return bundle.NewEncryptionConfig(key, keyID, alg)
+}
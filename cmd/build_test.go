@@ -3,6 +3,11 @@ package cmd
 import (
 	"archive/tar"
 	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"io"
 	"os"
 	"path"
@@ -10,7 +15,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/keys"
 	"github.com/meta-quick/opax/loader"
+	"github.com/meta-quick/opax/util"
 
 	"github.com/meta-quick/opax/util/test"
 )
@@ -220,3 +228,144 @@ func TestBuildVerificationConfigError(t *testing.T) {
 		}
 	})
 }
+
+func TestBuildDelta(t *testing.T) {
+
+	files := map[string]string{
+		"v1/.manifest": `{"revision": "v1", "roots": ["users", "test"]}`,
+		"v1/data.json": `{"users": {"alice": {"roles": ["admin"]}, "bob": {"roles": ["dev"]}}}`,
+		"v1/test.rego": "package test\np = 1",
+		"v2/.manifest": `{"revision": "v2", "roots": ["users", "test"]}`,
+		"v2/data.json": `{"users": {"alice": {"roles": ["admin"]}, "carol": {"roles": ["ops"]}}}`,
+		"v2/test.rego": "package test\np = 1",
+		"v3/.manifest": `{"revision": "v3", "roots": ["users", "test"]}`,
+		"v3/data.json": `{"users": {}}`,
+		"v3/test.rego": "package test\np = 2",
+	}
+
+	test.WithTempFS(files, func(root string) {
+		prev := newBuildParams()
+		prev.bundleMode = true
+		prev.outputFile = path.Join(root, "v1.tar.gz")
+
+		if err := dobuild(prev, []string{path.Join(root, "v1")}); err != nil {
+			t.Fatal(err)
+		}
+
+		params := newBuildParams()
+		params.bundleMode = true
+		params.outputFile = path.Join(root, "delta.tar.gz")
+		params.delta = prev.outputFile
+		params.verifyDelta = true
+
+		if err := dobuild(params, []string{path.Join(root, "v2")}); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := loader.NewFileLoader().AsBundle(params.outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if b.Type() != bundle.DeltaBundleType || b.Manifest.Revision != "v2" || len(b.Modules) != 0 {
+			t.Fatalf("Expected delta bundle with revision v2 and no modules but got: %v", b.Manifest)
+		}
+
+		exp := []bundle.PatchOperation{
+			{Op: "remove", Path: "/users/bob"},
+			{Op: "upsert", Path: "/users/carol", Value: map[string]interface{}{"roles": []interface{}{"ops"}}},
+		}
+
+		if util.Compare(util.MustUnmarshalJSON(util.MustMarshalJSON(exp)), util.MustUnmarshalJSON(util.MustMarshalJSON(b.Patch.Data))) != 0 {
+			t.Fatalf("Expected patch %v but got %v", exp, b.Patch.Data)
+		}
+
+		// Policy changes cannot be expressed by delta bundles.
+		params.outputFile = path.Join(root, "delta-v3.tar.gz")
+		err = dobuild(params, []string{path.Join(root, "v3")})
+		if err == nil || !strings.Contains(err.Error(), "delta bundles cannot contain policy changes") {
+			t.Fatal("Expected policy change error but got:", err)
+		}
+
+		if _, err := os.Stat(params.outputFile); !os.IsNotExist(err) {
+			t.Fatal("Expected no output file to be written")
+		}
+	})
+}
+
+func TestBuildDeltaFlagErrors(t *testing.T) {
+
+	params := newBuildParams()
+	params.verifyDelta = true
+
+	err := dobuild(params, []string{"."})
+	if err == nil || !strings.Contains(err.Error(), "specify the previous snapshot bundle") {
+		t.Fatal("Expected error but got:", err)
+	}
+
+	params = newBuildParams()
+	params.bundleMode = true
+	params.delta = "bundle.tar.gz"
+	params.key = "secret"
+
+	err = dobuild(params, []string{"."})
+	if err == nil || err.Error() != "delta bundles cannot be signed" {
+		t.Fatal("Expected error but got:", err)
+	}
+}
+
+func TestBuildEncrypted(t *testing.T) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"public.pem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+		"test.rego":  "package test\nsecret = \"masking-model\"",
+	}
+
+	test.WithTempFS(files, func(root string) {
+		params := newBuildParams()
+		params.outputFile = path.Join(root, "bundle.tar.gz")
+		params.encryptKey = path.Join(root, "public.pem")
+		params.encryptKeyID = "edge"
+		if err := params.encryptAlg.Set(bundle.EncryptionAlgSM4GCM); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := dobuild(params, []string{path.Join(root, "test.rego")}); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(params.outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		dc := bundle.NewDecryptionConfig(map[string]*keys.Config{
+			"edge": {PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: priv}))},
+		}, "edge")
+
+		b, err := bundle.NewReader(f).WithDecryptionConfig(dc).Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(b.Modules) != 1 || !strings.Contains(string(b.Modules[0].Raw), "masking-model") {
+			t.Fatalf("Expected decrypted module but got: %v", b.Modules)
+		}
+	})
+}
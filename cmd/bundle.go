@@ -0,0 +1,261 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	ib "github.com/meta-quick/opax/internal/bundle/inspect"
+	pr "github.com/meta-quick/opax/internal/presentation"
+	"github.com/meta-quick/opax/util"
+
+	"github.com/spf13/cobra"
+)
+
+var bundleCommand = &cobra.Command{
+	Use:   "bundle",
+	Short: "Inspect and compare OPA bundles",
+}
+
+type bundleDiffCommandParams struct {
+	outputFormat *util.EnumFlag
+	fail         bool
+}
+
+func newBundleDiffCommandParams() bundleDiffCommandParams {
+	return bundleDiffCommandParams{
+		outputFormat: util.NewEnumFlag(evalPrettyOutput, []string{
+			evalJSONOutput,
+			evalPrettyOutput,
+		}),
+	}
+}
+
+func init() {
+
+	params := newBundleDiffCommandParams()
+
+	var diffCommand = &cobra.Command{
+		Use:   "diff <old-path> <new-path>",
+		Short: "Compare two OPA bundles",
+		Long: `Compare two OPA bundles.
+
+The 'diff' command reads two revisions of a bundle and lists the changes between them:
+
+* modules that were added, removed or modified, with the rules whose definitions changed
+* data changes as JSON Patch operations (in the format used by delta bundles)
+* manifest changes: revision, roots, metadata and Wasm resolvers
+* Wasm modules that were added, removed or modified
+* changes to the signing plugin, keys or algorithms
+
+Modules are compared by their ASTs, so changes that only affect formatting or comments
+are not reported. Signatures are not verified.
+
+Example:
+
+  $ opa bundle diff bundle-v1.tar.gz bundle-v2.tar.gz
+
+The bundles can be gzipped tarballs or directories. The same comparison is available as
+'opa inspect --compare <old-path> <new-path>'. If no changes are found, nothing is printed. If the
+'--fail' flag is set, the 'diff' command exits with exit code 2 if the bundles differ.
+`,
+		PreRunE: func(_ *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("specify exactly two OPA bundles or paths")
+			}
+			return nil
+		},
+		Run: func(_ *cobra.Command, args []string) {
+			changed, err := doBundleDiff(params, args[0], args[1], os.Stdout)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			if changed && params.fail {
+				os.Exit(2)
+			}
+		},
+	}
+
+	addOutputFormat(diffCommand.Flags(), params.outputFormat)
+	diffCommand.Flags().BoolVar(&params.fail, "fail", false, "exit with a non-zero exit code if the bundles differ")
+	bundleCommand.AddCommand(diffCommand)
+	RootCommand.AddCommand(bundleCommand)
+}
+
+// doBundleDiff writes the differences between the bundles at prev and next to
+// out and returns true if the bundles differ.
+func doBundleDiff(params bundleDiffCommandParams, prev, next string, out io.Writer) (bool, error) {
+	diff, err := ib.Compare(prev, next)
+	if err != nil {
+		return false, err
+	}
+
+	switch params.outputFormat.String() {
+	case evalJSONOutput:
+		return !diff.Empty(), pr.JSON(out, diff)
+
+	default:
+		return !diff.Empty(), printBundleDiff(out, diff)
+	}
+}
+
+func printBundleDiff(out io.Writer, diff *ib.Diff) error {
+
+	if diff.Manifest != nil {
+		if err := populateManifestDiff(out, diff.Manifest); err != nil {
+			return err
+		}
+	}
+
+	if len(diff.Modules) != 0 {
+		populateModulesDiff(out, diff.Modules)
+	}
+
+	if len(diff.Data) != 0 {
+		if err := populateDataDiff(out, diff); err != nil {
+			return err
+		}
+	}
+
+	if len(diff.WasmModules) != 0 {
+		t := generateTableWithKeys(out, "file", "change")
+		for _, f := range diff.WasmModules {
+			t.Append([]string{truncateFileName(f.Path), f.Change})
+		}
+		fmt.Fprintln(out, "WASM MODULES:")
+		t.Render()
+	}
+
+	if diff.Signatures != nil {
+		populateSignaturesDiff(out, diff.Signatures)
+	}
+
+	return nil
+}
+
+func populateManifestDiff(out io.Writer, m *ib.ManifestDiff) error {
+	t := generateTableWithKeys(out, "field", "old", "new")
+
+	if m.Revision != nil {
+		t.Append([]string{"Revision", truncateStr(fmt.Sprint(m.Revision.Old)), truncateStr(fmt.Sprint(m.Revision.New))})
+	}
+
+	for _, root := range m.RootsRemoved {
+		t.Append([]string{"Roots", truncateFileName(root), ""})
+	}
+
+	for _, root := range m.RootsAdded {
+		t.Append([]string{"Roots", "", truncateFileName(root)})
+	}
+
+	if m.Metadata != nil {
+		x, err := json.Marshal(m.Metadata.Old)
+		if err != nil {
+			return err
+		}
+		y, err := json.Marshal(m.Metadata.New)
+		if err != nil {
+			return err
+		}
+		t.Append([]string{"Metadata", truncateStr(string(x)), truncateStr(string(y))})
+	}
+
+	for _, wr := range m.WasmResolvers {
+		t.Append([]string{"Wasm " + truncateStr(wr.Entrypoint), truncateFileName(wr.OldModule), truncateFileName(wr.NewModule)})
+	}
+
+	fmt.Fprintln(out, "MANIFEST:")
+	t.Render()
+
+	return nil
+}
+
+// populateModulesDiff lists the changed modules with one line per changed
+// package, import and rule. Lines are prefixed with +, - and ~ for additions,
+// removals and modifications.
+func populateModulesDiff(out io.Writer, modules []ib.ModuleDiff) {
+	t := generateTableWithKeys(out, "file", "change", "details")
+
+	for _, m := range modules {
+		var details []string
+
+		if m.Package != nil {
+			details = append(details, fmt.Sprintf("~ package %v", m.Package.New))
+		}
+		for _, imp := range m.ImportsRemoved {
+			details = append(details, "- "+imp)
+		}
+		for _, imp := range m.ImportsAdded {
+			details = append(details, "+ "+imp)
+		}
+		for _, r := range m.Rules {
+			details = append(details, changePrefix(r.Change)+r.Name)
+		}
+
+		if len(details) == 0 {
+			details = append(details, "")
+		}
+
+		for _, d := range details {
+			t.Append([]string{truncateFileName(m.Path), m.Change, truncateStr(d)})
+		}
+	}
+
+	fmt.Fprintln(out, "MODULES:")
+	t.Render()
+}
+
+func populateDataDiff(out io.Writer, diff *ib.Diff) error {
+	t := generateTableWithKeys(out, "op", "path", "value")
+
+	for _, op := range diff.Data {
+		var value string
+		if op.Op != "remove" {
+			bs, err := json.Marshal(op.Value)
+			if err != nil {
+				return err
+			}
+			value = string(bs)
+		}
+		t.Append([]string{op.Op, truncateFileName(op.Path), truncateStr(value)})
+	}
+
+	fmt.Fprintln(out, "DATA:")
+	t.Render()
+
+	return nil
+}
+
+func populateSignaturesDiff(out io.Writer, s *ib.SignaturesDiff) {
+	t := generateTableWithKeys(out, "field", "old", "new")
+
+	t.Append([]string{"Signed", fmt.Sprint(s.Old.Signed), fmt.Sprint(s.New.Signed)})
+
+	if s.Old.Plugin != s.New.Plugin {
+		t.Append([]string{"Plugin", s.Old.Plugin, s.New.Plugin})
+	}
+
+	t.Append([]string{"Key IDs", truncateStr(strings.Join(s.Old.KeyIDs, ", ")), truncateStr(strings.Join(s.New.KeyIDs, ", "))})
+	t.Append([]string{"Algorithms", strings.Join(s.Old.Algorithms, ", "), strings.Join(s.New.Algorithms, ", ")})
+
+	fmt.Fprintln(out, "SIGNATURES:")
+	t.Render()
+}
+
+func changePrefix(change string) string {
+	switch change {
+	case ib.ChangeAdded:
+		return "+ "
+	case ib.ChangeRemoved:
+		return "- "
+	default:
+		return "~ "
+	}
+}
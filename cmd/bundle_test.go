@@ -0,0 +1,135 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/meta-quick/opax/internal/file/archive"
+	"github.com/meta-quick/opax/util"
+	"github.com/meta-quick/opax/util/test"
+)
+
+func TestDoBundleDiff(t *testing.T) {
+
+	v1 := archive.MustWriteTarGz([][2]string{
+		{"/.manifest", `{"revision": "v1", "roots": ["authz"]}`},
+		{"/data.json", `{"authz": {"admins": ["alice"]}}`},
+		{"/authz/authz.rego", "package authz\nallow { input.user == data.authz.admins[_] }\ndeny { false }"},
+	})
+
+	v2 := archive.MustWriteTarGz([][2]string{
+		{"/.manifest", `{"revision": "v2", "roots": ["authz", "audit"]}`},
+		{"/data.json", `{"authz": {"admins": ["alice", "bob"]}}`},
+		{"/authz/authz.rego", "package authz\nallow { input.user == data.authz.admins[_] }\nallow { input.method == \"GET\" }"},
+		{"/audit/audit.rego", "package audit\nlog = true"},
+	})
+
+	test.WithTempFS(nil, func(rootDir string) {
+		prev := filepath.Join(rootDir, "v1.tar.gz")
+		next := filepath.Join(rootDir, "v2.tar.gz")
+
+		if err := os.WriteFile(prev, v1.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(next, v2.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		params := newBundleDiffCommandParams()
+		if err := params.outputFormat.Set(evalJSONOutput); err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		changed, err := doBundleDiff(params, prev, next, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !changed {
+			t.Fatal("expected bundles to differ")
+		}
+
+		exp := util.MustUnmarshalJSON([]byte(`{
+			"manifest": {
+				"revision": {"old": "v1", "new": "v2"},
+				"roots_added": ["audit"]
+			},
+			"modules": [
+				{
+					"path": "/audit/audit.rego",
+					"change": "added",
+					"rules": [{"name": "log", "change": "added", "added": ["log = true"]}]
+				},
+				{
+					"path": "/authz/authz.rego",
+					"change": "modified",
+					"rules": [
+						{"name": "allow", "change": "modified", "added": ["allow {\n\tinput.method == \"GET\"\n}"]},
+						{"name": "deny", "change": "removed", "removed": ["deny {\n\tfalse\n}"]}
+					]
+				}
+			],
+			"data": [{"op": "upsert", "path": "/authz/admins/-", "value": "bob"}]
+		}`))
+
+		if result := util.MustUnmarshalJSON(out.Bytes()); !reflect.DeepEqual(exp, result) {
+			t.Fatalf("expected diff output to be %v, got %v", exp, result)
+		}
+
+		out.Reset()
+		changed, err = doBundleDiff(newBundleDiffCommandParams(), prev, next, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !changed {
+			t.Fatal("expected bundles to differ")
+		}
+
+		expPretty := `MANIFEST:
++----------+-----+-------+
+|  FIELD   | OLD |  NEW  |
++----------+-----+-------+
+| Revision | v1  | v2    |
+| Roots    |     | audit |
++----------+-----+-------+
+MODULES:
++-------------------+----------+---------+
+|       FILE        |  CHANGE  | DETAILS |
++-------------------+----------+---------+
+| /audit/audit.rego | added    | + log   |
+| /authz/authz.rego | modified | ~ allow |
+|                   |          | - deny  |
++-------------------+----------+---------+
+DATA:
++--------+-----------------+-------+
+|   OP   |      PATH       | VALUE |
++--------+-----------------+-------+
+| upsert | /authz/admins/- | "bob" |
++--------+-----------------+-------+
+`
+
+		if out.String() != expPretty {
+			t.Fatalf("expected pretty diff output to be:\n\n%v\n\ngot:\n\n%v", expPretty, out.String())
+		}
+
+		out.Reset()
+		changed, err = doBundleDiff(newBundleDiffCommandParams(), prev, prev, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if changed || out.Len() != 0 {
+			t.Fatalf("expected no changes but got: %v", out.String())
+		}
+	})
+}
@@ -65,6 +65,7 @@ type evalCommandParams struct {
 	schema              *schemaFlags
 	target              *util.EnumFlag
 	timeout             time.Duration
+	budget              topdown.Budget
 }
 
 func newEvalCommandParams() evalCommandParams {
@@ -120,7 +121,7 @@ func validateEvalParams(p *evalCommandParams, cmdArgs []string) error {
 	if p.instrument {
 		p.metrics = true
 	}
-	return nil
+	return p.budget.Validate()
 }
 
 const (
@@ -278,6 +279,10 @@ access.
 	evalCommand.Flags().VarP(&params.prettyLimit, "pretty-limit", "", "set limit after which pretty output gets truncated")
 	evalCommand.Flags().BoolVarP(&params.failDefined, "fail-defined", "", false, "exits with non-zero exit code on defined/non-empty result and errors")
 	evalCommand.Flags().DurationVar(&params.timeout, "timeout", 0, "set eval timeout (default unlimited)")
+	evalCommand.Flags().Int64Var(&params.budget.MaxSteps, "max-steps", 0, "set maximum number of evaluation steps (default unlimited)")
+	evalCommand.Flags().Int64Var(&params.budget.MaxTermBytes, "max-term-bytes", 0, "set maximum size of values produced by built-in functions and comprehensions (default unlimited)")
+	evalCommand.Flags().Int64Var(&params.budget.MaxResultBytes, "max-result-bytes", 0, "set maximum size of query results (default unlimited)")
+	evalCommand.Flags().Int64Var(&params.budget.MaxHTTPSendCalls, "max-http-send-calls", 0, "set maximum number of http.send calls (default unlimited)")
 
 	// Shared flags
 	addCapabilitiesFlag(evalCommand.Flags(), params.capabilities)
@@ -584,6 +589,10 @@ func setupEval(args []string, params evalCommandParams) (*evalContext, error) {
 		regoArgs = append(regoArgs, rego.Capabilities(params.capabilities.C))
 	}
 
+	if params.budget.Enabled() {
+		regoArgs = append(regoArgs, rego.Budget(&params.budget))
+	}
+
 	evalCtx := &evalContext{
 		params:   params,
 		metrics:  m,
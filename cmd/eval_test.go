@@ -602,6 +602,31 @@ func TestEvalWithStrictBuiltinErrors(t *testing.T) {
 	}
 }
 
+func TestEvalWithBudget(t *testing.T) {
+	params := newEvalCommandParams()
+	params.budget.MaxSteps = 10
+
+	var buf bytes.Buffer
+	_, err := eval([]string{"x := numbers.range(1, 100)[_]"}, params, &buf)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	var output presentation.Output
+	if err := util.NewJSONDecoder(&buf).Decode(&output); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Errors) != 1 || output.Errors[0].Code != topdown.BudgetErr {
+		t.Fatalf("expected budget error but got: %v", buf.String())
+	}
+
+	params.budget.MaxSteps = -1
+	if err := validateEvalParams(&params, []string{"x"}); err == nil {
+		t.Fatal("expected validation error")
+	}
+}
+
 func assertResultSet(t *testing.T, rs rego.ResultSet, expected string) {
 	t.Helper()
 	result := []interface{}{}
@@ -14,6 +14,7 @@ import (
 	"github.com/meta-quick/opax/logging"
 	"github.com/meta-quick/opax/plugins"
 	"github.com/meta-quick/opax/plugins/bundle"
+	"github.com/meta-quick/opax/plugins/datasync"
 	"github.com/meta-quick/opax/plugins/discovery"
 	"github.com/meta-quick/opax/plugins/logs"
 	"github.com/meta-quick/opax/plugins/status"
@@ -98,7 +99,7 @@ func runExec(params *exec.Params) error {
 		return fmt.Errorf("runtime error: %w", err)
 	}
 
-	if err := triggerPlugins(ctx, opa, []string{discovery.Name, bundle.Name, status.Name}); err != nil {
+	if err := triggerPlugins(ctx, opa, []string{discovery.Name, bundle.Name, datasync.Name, status.Name}); err != nil {
 		return fmt.Errorf("runtime error: %w", err)
 	}
 
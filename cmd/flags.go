@@ -95,7 +95,7 @@ func addClaimsFileFlag(fs *pflag.FlagSet, file *string) {
 }
 
 func addSigningKeyFlag(fs *pflag.FlagSet, key *string) {
-	fs.StringVarP(key, "signing-key", "", "", "set the secret (HMAC) or path of the PEM file containing the private key (RSA and ECDSA)")
+	fs.StringVarP(key, "signing-key", "", "", "set the secret (HMAC) or path of the PEM file containing the private key (RSA, ECDSA and SM2)")
 }
 
 func addSigningPluginFlag(fs *pflag.FlagSet, plugin *string) {
@@ -103,7 +103,7 @@ func addSigningPluginFlag(fs *pflag.FlagSet, plugin *string) {
 }
 
 func addVerificationKeyFlag(fs *pflag.FlagSet, key *string) {
-	fs.StringVarP(key, "verification-key", "", "", "set the secret (HMAC) or path of the PEM file containing the public key (RSA and ECDSA)")
+	fs.StringVarP(key, "verification-key", "", "", "set the secret (HMAC) or path of the PEM file containing the public key (RSA, ECDSA and SM2)")
 }
 
 func addVerificationKeyIDFlag(fs *pflag.FlagSet, keyID *string, value string) {
@@ -122,6 +122,18 @@ func addBundleVerificationExcludeFilesFlag(fs *pflag.FlagSet, excludeNames *[]st
 	fs.StringSliceVarP(excludeNames, "exclude-files-verify", "", []string{}, "set file names to exclude during bundle verification")
 }
 
+func addEncryptionKeyFlag(fs *pflag.FlagSet, key *string) {
+	fs.StringVarP(key, "encrypt-key", "", "", "set the path of the PEM file containing the public key or certificate (RSA, ECDSA and SM2) to encrypt the bundle for")
+}
+
+func addEncryptionKeyIDFlag(fs *pflag.FlagSet, keyID *string, value string) {
+	fs.StringVarP(keyID, "encrypt-key-id", "", value, "name assigned to the encryption key used for bundle decryption")
+}
+
+func addEncryptionAlgFlag(fs *pflag.FlagSet, alg *util.EnumFlag) {
+	fs.VarP(alg, "encrypt-alg", "", "set the bundle content encryption algorithm")
+}
+
 func addCapabilitiesFlag(fs *pflag.FlagSet, f *capabilitiesFlag) {
 	fs.VarP(f, "capabilities", "", "set capabilities.json file path")
 }
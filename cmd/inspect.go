@@ -26,6 +26,7 @@ const maxTableFieldLen = 50
 
 type inspectCommandParams struct {
 	outputFormat *util.EnumFlag
+	compare      string
 }
 
 func newInspectCommandParams() inspectCommandParams {
@@ -38,6 +39,11 @@ func newInspectCommandParams() inspectCommandParams {
 }
 
 func init() {
+	RootCommand.AddCommand(newInspectCommand())
+	bundleCommand.AddCommand(newInspectCommand())
+}
+
+func newInspectCommand() *cobra.Command {
 
 	params := newInspectCommandParams()
 
@@ -65,11 +71,24 @@ Example:
 
 You can provide exactly one OPA bundle or path to the 'inspect' command on the command-line. If you provide a path
 referring to a directory, the 'inspect' command will load that path as a bundle and summarize its structure and contents.
+
+If the '--compare' flag is set, the 'inspect' command lists the changes between the bundle provided with the flag and the
+bundle provided on the command-line instead (see 'opa bundle diff'):
+
+  $ opa inspect --compare bundle-v1.tar.gz bundle-v2.tar.gz
 `,
 		PreRunE: func(_ *cobra.Command, args []string) error {
 			return validateInspectParams(&params, args)
 		},
 		Run: func(_ *cobra.Command, args []string) {
+			if params.compare != "" {
+				diffParams := bundleDiffCommandParams{outputFormat: params.outputFormat}
+				if _, err := doBundleDiff(diffParams, params.compare, args[0], os.Stdout); err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				return
+			}
 			if err := doInspect(params, args[0], os.Stdout); err != nil {
 				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
@@ -78,7 +97,8 @@ referring to a directory, the 'inspect' command will load that path as a bundle
 	}
 
 	addOutputFormat(inspectCommand.Flags(), params.outputFormat)
-	RootCommand.AddCommand(inspectCommand)
+	inspectCommand.Flags().StringVar(&params.compare, "compare", "", "list the changes from the bundle at the given path instead")
+	return inspectCommand
 }
 
 func doInspect(params inspectCommandParams, path string, out io.Writer) error {
@@ -0,0 +1,595 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/internal/presentation"
+	initload "github.com/meta-quick/opax/internal/runtime/init"
+	"github.com/meta-quick/opax/plugins/logs"
+	"github.com/meta-quick/opax/rego"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
+	"github.com/meta-quick/opax/topdown"
+	"github.com/meta-quick/opax/util"
+)
+
+type replayCommandParams struct {
+	dataPaths    repeatedStringFlag
+	bundlePaths  repeatedStringFlag
+	ignore       []string
+	outputFormat *util.EnumFlag
+	fail         bool
+}
+
+const (
+	replayFormatPretty = "pretty"
+	replayFormatJSON   = "json"
+)
+
+// replayNondeterministicBuiltins are the builtins whose results may differ
+// between the original evaluation and the replay. The current time is
+// replayed from the timestamp of the decision. The results of the other
+// builtins are not logged, so they cannot be replayed.
+var replayNondeterministicBuiltins = map[string]struct{}{
+	ast.HTTPSend.Name:           {},
+	ast.RandIntn.Name:           {},
+	ast.UUIDRFC4122.Name:        {},
+	ast.OPARuntime.Name:         {},
+	ast.NetLookupIPAddr.Name:    {},
+	ast.JWTEncodeSign.Name:      {},
+	ast.JWTEncodeSignRaw.Name:   {},
+	ast.TimedGaugeGet.Name:      {},
+	ast.TimedGaugeAdd.Name:      {},
+	ast.TimedGaugeDelete.Name:   {},
+	ast.TimedCounterGet.Name:    {},
+	ast.TimedCounterAdd.Name:    {},
+	ast.TimedCounterDelete.Name: {},
+}
+
+func newReplayCommandParams() replayCommandParams {
+	return replayCommandParams{
+		outputFormat: util.NewEnumFlag(replayFormatPretty, []string{
+			replayFormatPretty, replayFormatJSON,
+		}),
+	}
+}
+
+func init() {
+
+	params := newReplayCommandParams()
+
+	replayCommand := &cobra.Command{
+		Use:   "replay [<decision log file> [...]]",
+		Short: "Replay decision logs against a policy",
+		Long: `Replay decision logs against a policy and report the decisions that change.
+
+The replay command reads decision log events, re-evaluates the path or query of
+every decision with its input against the given bundles and data, and reports
+the decisions whose results differ from the logged results along with
+statistics per path.
+
+Example replaying the decisions logged by OPA against a candidate bundle:
+
+	opa replay -b ./candidate-bundle decisions.log
+
+Decision log events are read from the files or from stdin if no file is given.
+The events can be newline-delimited JSON, e.g., written by the decision log
+console or file output, or JSON arrays as uploaded to decision log services.
+Gzip compressed files are decompressed.
+
+The current time (time.now_ns) is replayed from the timestamp of each decision.
+The results of other non-deterministic builtins, e.g., http.send, are not
+recorded in decision logs, so these builtins are evaluated again. Decisions
+that change after calling them are reported as not replayable instead of as
+changed and do not cause a non-zero exit code with --fail.
+
+Decisions whose input or result was erased or masked cannot be replayed and are
+skipped.
+`,
+		Run: func(cmd *cobra.Command, args []string) {
+			changed, err := replay(context.Background(), args, params, os.Stdin, os.Stdout)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(2)
+			}
+			if changed && params.fail {
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDataFlag(replayCommand.Flags(), &params.dataPaths)
+	addBundleFlag(replayCommand.Flags(), &params.bundlePaths)
+	addIgnoreFlag(replayCommand.Flags(), &params.ignore)
+	addOutputFormat(replayCommand.Flags(), params.outputFormat)
+	replayCommand.Flags().BoolVar(&params.fail, "fail", false, "exits with non-zero exit code if any decision changes")
+
+	RootCommand.AddCommand(replayCommand)
+}
+
+// replayOutput is the result of replaying decision logs.
+type replayOutput struct {
+	Changes       []replayChange          `json:"changes"`
+	NotReplayable []replayChange          `json:"not_replayable"`
+	Stats         map[string]*replayStats `json:"stats"`
+}
+
+// replayChange describes a decision whose result changed. Changes of
+// decisions that called non-deterministic builtins are not replayable.
+type replayChange struct {
+	DecisionID       string       `json:"decision_id"`
+	Path             string       `json:"path,omitempty"`
+	Query            string       `json:"query,omitempty"`
+	Input            *interface{} `json:"input,omitempty"`
+	Result           *interface{} `json:"result,omitempty"`
+	Error            interface{}  `json:"error,omitempty"`
+	ReplayedResult   *interface{} `json:"replayed_result,omitempty"`
+	ReplayedError    string       `json:"replayed_error,omitempty"`
+	Nondeterministic []string     `json:"nondeterministic,omitempty"`
+}
+
+// replayStats aggregates the replayed decisions of a path or query.
+type replayStats struct {
+	Total         int `json:"total"`
+	Unchanged     int `json:"unchanged"`
+	Changed       int `json:"changed"`
+	NotReplayable int `json:"not_replayable"`
+	Skipped       int `json:"skipped"`
+}
+
+// replay replays the decision logs read from the files, or r if no files are
+// given, and writes the report to w. It returns true if any decision changed.
+func replay(ctx context.Context, args []string, params replayCommandParams, r io.Reader, w io.Writer) (bool, error) {
+
+	rp, err := newReplayer(ctx, params)
+	if err != nil {
+		return false, err
+	}
+
+	if len(args) == 0 {
+		if err := rp.replayEvents(ctx, r); err != nil {
+			return false, err
+		}
+	}
+
+	for _, file := range args {
+		if err := rp.replayFile(ctx, file); err != nil {
+			return false, err
+		}
+	}
+
+	switch params.outputFormat.String() {
+	case replayFormatJSON:
+		err = presentation.JSON(w, rp.output)
+	default:
+		err = rp.output.pretty(w)
+	}
+
+	return len(rp.output.Changes) > 0, err
+}
+
+type replayer struct {
+	compiler *ast.Compiler
+	store    storage.Store
+	queries  map[string]rego.PreparedEvalQuery
+	output   replayOutput
+}
+
+func newReplayer(ctx context.Context, params replayCommandParams) (*replayer, error) {
+
+	f := loaderFilter{
+		Ignore: params.ignore,
+	}
+
+	files, err := initload.LoadPaths(params.dataPaths.v, f.Apply, false, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	bundles, err := initload.LoadPaths(params.bundlePaths.v, f.Apply, true, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	store := inmem.New()
+	txn, err := store.NewTransaction(ctx, storage.WriteParams)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := initload.InsertAndCompile(ctx, initload.InsertAndCompileOptions{
+		Store:   store,
+		Txn:     txn,
+		Files:   files.Files,
+		Bundles: bundles.Bundles,
+	})
+	if err != nil {
+		store.Abort(ctx, txn)
+		return nil, err
+	}
+
+	if err := store.Commit(ctx, txn); err != nil {
+		return nil, err
+	}
+
+	return &replayer{
+		compiler: result.Compiler,
+		store:    store,
+		queries:  map[string]rego.PreparedEvalQuery{},
+		output: replayOutput{
+			Changes:       []replayChange{},
+			NotReplayable: []replayChange{},
+			Stats:         map[string]*replayStats{},
+		},
+	}, nil
+}
+
+func (rp *replayer) replayFile(ctx context.Context, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := rp.replayEvents(ctx, f); err != nil {
+		return fmt.Errorf("%v: %w", file, err)
+	}
+
+	return nil
+}
+
+// replayEvents replays the decision log events read from r. Values that are
+// not decision log events, e.g., other console log messages, are ignored.
+func (rp *replayer) replayEvents(ctx context.Context, r io.Reader) error {
+
+	br := bufio.NewReader(r)
+
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		r = br
+	}
+
+	decoder := util.NewJSONDecoder(r)
+
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		var events []logs.EventV1
+
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			if err := util.UnmarshalJSON(raw, &events); err != nil {
+				return err
+			}
+		} else {
+			var event logs.EventV1
+			if err := util.UnmarshalJSON(raw, &event); err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+
+		for i := range events {
+			// Divergence events reported by shadow evaluations do not
+			// describe a decision of their own.
+			if events[i].DecisionID == "" || events[i].Divergence != nil {
+				continue
+			}
+			if err := rp.replayEvent(ctx, &events[i]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (rp *replayer) replayEvent(ctx context.Context, event *logs.EventV1) error {
+
+	key := event.Path
+	if key == "" {
+		key = event.Query
+	}
+
+	stats, ok := rp.output.Stats[key]
+	if !ok {
+		stats = &replayStats{}
+		rp.output.Stats[key] = stats
+	}
+
+	stats.Total++
+
+	if event.Path == "" && event.Query == "" || len(event.Erased) > 0 || len(event.Masked) > 0 {
+		stats.Skipped++
+		return nil
+	}
+
+	change := replayChange{
+		DecisionID: event.DecisionID,
+		Path:       event.Path,
+		Query:      event.Query,
+		Input:      event.Input,
+		Result:     event.Result,
+		Error:      event.Error,
+	}
+
+	tracer := &ndBuiltinTracer{}
+	result, err := rp.eval(ctx, event, tracer)
+
+	if err != nil {
+		if event.Error != nil {
+			stats.Unchanged++
+			return nil
+		}
+		change.ReplayedError = err.Error()
+	} else {
+		change.ReplayedResult = result
+
+		equal, err := replayResultsEqual(event.Result, result)
+		if err != nil {
+			return err
+		}
+
+		if equal && event.Error == nil {
+			stats.Unchanged++
+			return nil
+		}
+	}
+
+	// The result may have changed only because a non-deterministic builtin
+	// returned a different value than in the original evaluation.
+	if len(tracer.called) > 0 {
+		stats.NotReplayable++
+		change.Nondeterministic = tracer.builtins()
+		rp.output.NotReplayable = append(rp.output.NotReplayable, change)
+		return nil
+	}
+
+	stats.Changed++
+	rp.output.Changes = append(rp.output.Changes, change)
+	return nil
+}
+
+// eval evaluates the path or query of the event with the event's input. The
+// result has the same form as the result logged by the server.
+func (rp *replayer) eval(ctx context.Context, event *logs.EventV1, tracer topdown.QueryTracer) (*interface{}, error) {
+
+	query := event.Query
+	if event.Path != "" {
+		ref, err := ast.PtrRef(ast.DefaultRootDocument, event.Path)
+		if err != nil {
+			return nil, err
+		}
+		query = ref.String()
+	}
+
+	pq, ok := rp.queries[query]
+	if !ok {
+		var err error
+		pq, err = rego.New(
+			rego.Query(query),
+			rego.Compiler(rp.compiler),
+			rego.Store(rp.store),
+		).PrepareForEval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rp.queries[query] = pq
+	}
+
+	opts := []rego.EvalOption{rego.EvalQueryTracer(tracer)}
+
+	if event.Input != nil {
+		opts = append(opts, rego.EvalInput(*event.Input))
+	}
+
+	if !event.Timestamp.IsZero() {
+		opts = append(opts, rego.EvalTime(event.Timestamp))
+	}
+
+	rs, err := pq.Eval(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if event.Path != "" {
+		if len(rs) == 0 {
+			return nil, nil
+		}
+		return &rs[0].Expressions[0].Value, nil
+	}
+
+	results := make([]interface{}, 0, len(rs))
+	for _, r := range rs {
+		results = append(results, map[string]interface{}(r.Bindings.WithoutWildcards()))
+	}
+
+	var x interface{} = results
+	return &x, nil
+}
+
+func replayResultsEqual(a, b *interface{}) (bool, error) {
+	if a == nil || b == nil {
+		return a == nil && b == nil, nil
+	}
+
+	av, err := ast.InterfaceToValue(*a)
+	if err != nil {
+		return false, err
+	}
+
+	bv, err := ast.InterfaceToValue(*b)
+	if err != nil {
+		return false, err
+	}
+
+	return av.Compare(bv) == 0, nil
+}
+
+// ndBuiltinTracer records the non-deterministic builtins that are called
+// during evaluation.
+type ndBuiltinTracer struct {
+	called map[string]struct{}
+}
+
+func (*ndBuiltinTracer) Enabled() bool {
+	return true
+}
+
+func (*ndBuiltinTracer) Config() topdown.TraceConfig {
+	return topdown.TraceConfig{}
+}
+
+func (t *ndBuiltinTracer) TraceEvent(evt topdown.Event) {
+	if evt.Op != topdown.EvalOp {
+		return
+	}
+
+	expr, ok := evt.Node.(*ast.Expr)
+	if !ok {
+		return
+	}
+
+	if expr.IsCall() {
+		t.record(expr.Operator().String())
+	}
+
+	ast.WalkTerms(expr, func(term *ast.Term) bool {
+		if call, ok := term.Value.(ast.Call); ok {
+			t.record(call[0].String())
+		}
+		return false
+	})
+}
+
+func (t *ndBuiltinTracer) record(name string) {
+	if _, ok := replayNondeterministicBuiltins[name]; !ok {
+		return
+	}
+	if t.called == nil {
+		t.called = map[string]struct{}{}
+	}
+	t.called[name] = struct{}{}
+}
+
+func (t *ndBuiltinTracer) builtins() []string {
+	names := make([]string, 0, len(t.called))
+	for name := range t.called {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (o replayOutput) pretty(w io.Writer) error {
+
+	for _, c := range o.Changes {
+		c.pretty(w, "changed")
+	}
+
+	for _, c := range o.NotReplayable {
+		c.pretty(w, "not replayable")
+	}
+
+	keys := make([]string, 0, len(o.Stats))
+	for k := range o.Stats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var total replayStats
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Path", "Total", "Unchanged", "Changed", "Not replayable", "Skipped"})
+	table.SetAutoFormatHeaders(false)
+
+	for _, k := range keys {
+		s := o.Stats[k]
+		table.Append(s.row(k))
+		total.Total += s.Total
+		total.Unchanged += s.Unchanged
+		total.Changed += s.Changed
+		total.NotReplayable += s.NotReplayable
+		total.Skipped += s.Skipped
+	}
+
+	table.SetFooter(total.row("Total"))
+	table.Render()
+
+	return nil
+}
+
+func (c replayChange) pretty(w io.Writer, status string) {
+	key := c.Path
+	if key == "" {
+		key = c.Query
+	}
+
+	fmt.Fprintf(w, "Decision %v (%v) %v:\n", c.DecisionID, key, status)
+	fmt.Fprintf(w, "  logged:   %v\n", replayFormatResult(c.Result, c.Error))
+
+	var replayErr interface{}
+	if c.ReplayedError != "" {
+		replayErr = c.ReplayedError
+	}
+	fmt.Fprintf(w, "  replayed: %v\n", replayFormatResult(c.ReplayedResult, replayErr))
+
+	if len(c.Nondeterministic) > 0 {
+		fmt.Fprintf(w, "  non-deterministic builtins called: %v\n", strings.Join(c.Nondeterministic, ", "))
+	}
+
+	fmt.Fprintln(w)
+}
+
+func (s replayStats) row(key string) []string {
+	return []string{
+		key,
+		fmt.Sprint(s.Total),
+		fmt.Sprint(s.Unchanged),
+		fmt.Sprint(s.Changed),
+		fmt.Sprint(s.NotReplayable),
+		fmt.Sprint(s.Skipped),
+	}
+}
+
+func replayFormatResult(result *interface{}, err interface{}) string {
+	if err != nil {
+		bs, _ := json.Marshal(err)
+		return "error " + string(bs)
+	}
+	if result == nil {
+		return "undefined"
+	}
+	bs, e := json.Marshal(*result)
+	if e != nil {
+		return fmt.Sprint(*result)
+	}
+	return string(bs)
+}
@@ -0,0 +1,181 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/meta-quick/opax/util/test"
+)
+
+const replayTestPolicy = `package authz
+
+default allow = false
+
+allow {
+	input.user == "alice"
+}
+
+allow {
+	input.user == "admin"
+	time.now_ns() < time.parse_rfc3339_ns("2022-01-01T00:00:00Z")
+}
+
+token = rand.intn("token", 1000000)
+`
+
+const replayTestEvents = `{"decision_id": "1", "path": "authz/allow", "input": {"user": "alice"}, "result": true, "timestamp": "2022-06-01T00:00:00Z"}
+{"decision_id": "2", "path": "authz/allow", "input": {"user": "bob"}, "result": true, "timestamp": "2022-06-01T00:00:00Z"}
+{"level": "info", "msg": "Server initialized."}
+{"decision_id": "3", "path": "authz/allow", "input": {"user": "admin"}, "result": true, "timestamp": "2021-06-01T00:00:00Z"}
+{"decision_id": "4", "path": "authz/allow", "erased": ["/input"], "result": false, "timestamp": "2022-06-01T00:00:00Z"}
+{"decision_id": "5", "query": "data.authz.allow = x", "input": {"user": "alice"}, "result": [{"x": true}], "timestamp": "2022-06-01T00:00:00Z"}
+{"decision_id": "6", "path": "authz/token", "result": -1, "timestamp": "2022-06-01T00:00:00Z"}
+{"decision_id": "1", "path": "authz/allow", "result": true, "divergence": {"bundle": "candidate", "result": false}, "timestamp": "2022-06-01T00:00:00Z"}
+`
+
+func TestReplay(t *testing.T) {
+
+	files := map[string]string{
+		"policy.rego":   replayTestPolicy,
+		"decisions.log": replayTestEvents,
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+		params := newReplayCommandParams()
+		_ = params.dataPaths.Set(filepath.Join(rootDir, "policy.rego"))
+		_ = params.outputFormat.Set(replayFormatJSON)
+
+		var buf bytes.Buffer
+		changed, err := replay(context.Background(), []string{filepath.Join(rootDir, "decisions.log")}, params, nil, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !changed {
+			t.Fatal("Expected decisions to change")
+		}
+
+		var output replayOutput
+		if err := json.Unmarshal(buf.Bytes(), &output); err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, c := range output.Changes {
+			ids = append(ids, c.DecisionID)
+		}
+
+		if !reflect.DeepEqual(ids, []string{"2"}) {
+			t.Fatalf("Expected decision 2 to change but got: %v", buf.String())
+		}
+
+		if c := output.Changes[0]; c.ReplayedResult == nil || *c.ReplayedResult != false || len(c.Nondeterministic) != 0 {
+			t.Fatalf("Unexpected change: %+v", c)
+		}
+
+		// Decisions that change after calling non-deterministic builtins
+		// are not reported as changed.
+		if len(output.NotReplayable) != 1 || output.NotReplayable[0].DecisionID != "6" || !reflect.DeepEqual(output.NotReplayable[0].Nondeterministic, []string{"rand.intn"}) {
+			t.Fatalf("Expected decision 6 to be not replayable but got: %v", buf.String())
+		}
+
+		exp := map[string]*replayStats{
+			"authz/allow":          {Total: 4, Unchanged: 2, Changed: 1, Skipped: 1},
+			"data.authz.allow = x": {Total: 1, Unchanged: 1},
+			"authz/token":          {Total: 1, NotReplayable: 1},
+		}
+
+		if !reflect.DeepEqual(output.Stats, exp) {
+			t.Fatalf("Unexpected stats: %v", buf.String())
+		}
+	})
+}
+
+func TestReplayNotReplayableUnchanged(t *testing.T) {
+
+	files := map[string]string{
+		"policy.rego": replayTestPolicy,
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+		params := newReplayCommandParams()
+		_ = params.dataPaths.Set(filepath.Join(rootDir, "policy.rego"))
+
+		in := strings.NewReader(`{"decision_id": "6", "path": "authz/token", "result": -1}`)
+
+		var buf bytes.Buffer
+		changed, err := replay(context.Background(), nil, params, in, &buf)
+		if err != nil {
+			t.Fatal(err)
+		} else if changed {
+			t.Fatalf("Expected not replayable decision not to be reported as changed but got:\n%v", buf.String())
+		}
+
+		if exp := "Decision 6 (authz/token) not replayable:\n"; !strings.Contains(buf.String(), exp) {
+			t.Fatalf("Expected output to contain %q but got:\n%v", exp, buf.String())
+		}
+	})
+}
+
+func TestReplayPrettyStdinGzip(t *testing.T) {
+
+	files := map[string]string{
+		"policy.rego": replayTestPolicy,
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+		params := newReplayCommandParams()
+		_ = params.dataPaths.Set(filepath.Join(rootDir, "policy.rego"))
+
+		// Decisions uploaded to a decision log service are gzip compressed
+		// JSON arrays.
+		var in bytes.Buffer
+		w := gzip.NewWriter(&in)
+		_, _ = w.Write([]byte(`[{"decision_id": "1", "path": "authz/allow", "input": {"user": "alice"}, "result": false}]`))
+		_ = w.Close()
+
+		var buf bytes.Buffer
+		changed, err := replay(context.Background(), nil, params, &in, &buf)
+		if err != nil {
+			t.Fatal(err)
+		} else if !changed {
+			t.Fatal("Expected decision to change")
+		}
+
+		for _, exp := range []string{
+			"Decision 1 (authz/allow) changed:\n  logged:   false\n  replayed: true\n",
+			"| authz/allow |     1 |         0 |       1 |              0 |       0 |",
+		} {
+			if !strings.Contains(buf.String(), exp) {
+				t.Fatalf("Expected output to contain %q but got:\n%v", exp, buf.String())
+			}
+		}
+	})
+}
+
+func TestReplayInvalidEvents(t *testing.T) {
+
+	test.WithTempFS(map[string]string{"decisions.log": `{"decision_id": "1",`}, func(rootDir string) {
+		path := filepath.Join(rootDir, "decisions.log")
+		_, err := replay(context.Background(), []string{path}, newReplayCommandParams(), nil, &bytes.Buffer{})
+		if err == nil || !strings.HasPrefix(err.Error(), path) {
+			t.Fatalf("Expected error for file but got: %v", err)
+		}
+
+		_, err = replay(context.Background(), []string{filepath.Join(rootDir, "missing.log")}, newReplayCommandParams(), nil, &bytes.Buffer{})
+		if !os.IsNotExist(err) {
+			t.Fatalf("Expected not exist error but got: %v", err)
+		}
+	})
+}
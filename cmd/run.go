@@ -51,7 +51,7 @@ type runCmdParams struct {
 func newRunParams() runCmdParams {
 	return runCmdParams{
 		rt:             runtime.NewParams(),
-		authentication: util.NewEnumFlag("off", []string{"token", "tls", "off"}),
+		authentication: util.NewEnumFlag("off", []string{"token", "tls", "jwt", "apikey", "off"}),
 		authorization:  util.NewEnumFlag("off", []string{"basic", "off"}),
 		minTLSVersion:  util.NewEnumFlag("1.2", []string{"1.0", "1.1", "1.2", "1.3"}),
 		logLevel:       util.NewEnumFlag("info", []string{"debug", "info", "error"}),
@@ -172,6 +172,7 @@ To skip bundle verification, use the --skip-verify flag.
 	runCommand.Flags().StringVarP(&cmdParams.rt.HistoryPath, "history", "H", historyPath(), "set path of history file")
 	cmdParams.rt.Addrs = runCommand.Flags().StringSliceP("addr", "a", []string{defaultAddr}, "set listening address of the server (e.g., [ip]:<port> for TCP, unix://<path> for UNIX domain socket)")
 	cmdParams.rt.DiagnosticAddrs = runCommand.Flags().StringSlice("diagnostic-addr", []string{}, "set read-only diagnostic listening address of the server for /health and /metric APIs (e.g., [ip]:<port> for TCP, unix://<path> for UNIX domain socket)")
+	cmdParams.rt.GRPCAddrs = runCommand.Flags().StringSlice("grpc-addr", []string{}, "set listening address of the gRPC decision API (e.g., [ip]:<port> for TCP, unix://<path> for UNIX domain socket)")
 	runCommand.Flags().BoolVar(&cmdParams.rt.H2CEnabled, "h2c", false, "enable H2C for HTTP listeners")
 	runCommand.Flags().StringVarP(&cmdParams.rt.OutputFormat, "format", "f", "pretty", "set shell output format, i.e, pretty, json")
 	runCommand.Flags().BoolVarP(&cmdParams.rt.Watch, "watch", "w", false, "watch command line files for changes")
@@ -216,9 +217,11 @@ Flags:
 
 func initRuntime(ctx context.Context, params runCmdParams, args []string) (*runtime.Runtime, error) {
 	authenticationSchemes := map[string]server.AuthenticationScheme{
-		"token": server.AuthenticationToken,
-		"tls":   server.AuthenticationTLS,
-		"off":   server.AuthenticationOff,
+		"token":  server.AuthenticationToken,
+		"tls":    server.AuthenticationTLS,
+		"jwt":    server.AuthenticationJWT,
+		"apikey": server.AuthenticationAPIKey,
+		"off":    server.AuthenticationOff,
 	}
 
 	authorizationScheme := map[string]server.AuthorizationScheme{
@@ -6,6 +6,7 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -24,17 +25,18 @@ import (
 )
 
 type signCmdParams struct {
-	algorithm      string
-	key            string
-	claimsFile     string
-	outputFilePath string
-	bundleMode     bool
-	plugin         string
+	algorithm       string
+	key             string
+	keyID           string
+	claimsFile      string
+	outputFilePath  string
+	bundleMode      bool
+	plugin          string
+	appendSignature bool
 }
 
 const (
 	defaultTokenSigningAlg = "RS256"
-	defaultHashingAlg      = "SHA-256"
 	signaturesFile         = ".signatures.json"
 )
 
@@ -54,8 +56,9 @@ The 'sign' command generates a digital signature for policy bundles. It generate
 ".signatures.json" file that dictates which files should be included in the bundle,
 what their SHA hashes are, and is cryptographically secure.
 
-The signatures file is a JSON file with an array containing a single JSON Web Token (JWT)
-that encapsulates the signature for the bundle.
+The signatures file is a JSON file with an array containing a JSON Web Token (JWT)
+that encapsulates the signature for the bundle (or one JWT per key if the bundle is
+signed with multiple keys).
 
 The --signing-alg flag can be used to specify the algorithm to sign the token. The 'sign'
 command uses RS256 (by default) as the signing algorithm.
@@ -64,7 +67,8 @@ for a list of supported signing algorithms.
 
 The key to be used for signing the JWT MUST be provided using the --signing-key flag.
 For example, for RSA family of algorithms, the command expects a PEM file containing
-the private key.
+the private key. For SM2, the command expects a PEM file containing the SM2 private
+key in PKCS #8 or SEC 1 ("EC PRIVATE KEY") format.
 For HMAC family of algorithms (eg. HS256), the secret can be provided using
 the --signing-key flag.
 
@@ -122,11 +126,24 @@ And the decoded JWT payload has the following form:
 The "files" field is generated from the files under the directory path(s)
 provided to the 'sign' command. During bundle signature verification, OPA will check
 each file name (ex. "foo/bar/data.json") in the "files" field
-exists in the actual bundle. The file content is hashed using SHA256.
+exists in the actual bundle. The file content is hashed using SHA-256, or using SM3
+when the signing algorithm is SM2.
 
 To include additional claims in the payload use the --claims-file flag to provide
 a JSON file containing optional claims.
 
+Bundles can be signed with multiple keys, for example to require both the policy
+team and the security team to sign production bundles. Each signer runs the 'sign'
+command with the --append flag, which adds a signature to the existing ".signatures.json"
+file instead of replacing it. The --signing-key-id flag sets the ID of the key in the
+signature so that OPA can pick the right verification key:
+
+	$ opa sign --signing-key policy.pem --signing-key-id policy --bundle foo
+	$ opa sign --signing-key security.pem --signing-key-id security --append --bundle foo
+
+The existing signatures must cover the same files, so the bundle must not change
+between the 'sign' commands.
+
 For more information on the format of the ".signatures.json" file see
 https://www.openpolicyagent.org/docs/latest/management-bundles/#signature-format.
 `,
@@ -151,6 +168,8 @@ https://www.openpolicyagent.org/docs/latest/management-bundles/#signature-format
 	addSigningPluginFlag(signCommand.Flags(), &cmdParams.plugin)
 
 	signCommand.Flags().StringVarP(&cmdParams.outputFilePath, "output-file-path", "o", ".", "set the location for the .signatures.json file")
+	signCommand.Flags().StringVarP(&cmdParams.keyID, "signing-key-id", "", "", "set the ID of the signing key (included in the signature as the \"kid\" header)")
+	signCommand.Flags().BoolVarP(&cmdParams.appendSignature, "append", "", false, "append the signature to the existing .signatures.json file")
 
 	RootCommand.AddCommand(signCommand)
 }
@@ -161,27 +180,31 @@ func doSign(args []string, params signCmdParams) error {
 		return err
 	}
 
-	hash, err := bundle.NewSignatureHasher(bundle.HashingAlgorithm(defaultHashingAlg))
+	signingConfig := buildSigningConfig(params.key, params.algorithm, params.claimsFile, params.plugin)
+
+	hash, err := bundle.NewSignatureHasher(signingConfig.HashingAlgorithm)
 	if err != nil {
 		return err
 	}
 
-	files, err := readBundleFiles(load.BundlesLoader, hash)
+	files, err := readBundleFiles(load.BundlesLoader, hash, signingConfig.HashingAlgorithm)
 	if err != nil {
 		return err
 	}
 
-	signingConfig := buildSigningConfig(params.key, params.algorithm, params.claimsFile, params.plugin)
-
-	token, err := bundle.GenerateSignedToken(files, signingConfig, "")
+	token, err := bundle.GenerateSignedToken(files, signingConfig, params.keyID)
 	if err != nil {
 		return err
 	}
 
+	if params.appendSignature {
+		return appendTokenToFile(token, params.keyID, files, params.outputFilePath)
+	}
+
 	return writeTokenToFile(token, params.outputFilePath)
 }
 
-func readBundleFiles(loaders []initload.BundleLoader, h bundle.SignatureHasher) ([]bundle.FileInfo, error) {
+func readBundleFiles(loaders []initload.BundleLoader, h bundle.SignatureHasher, alg bundle.HashingAlgorithm) ([]bundle.FileInfo, error) {
 	files := []bundle.FileInfo{}
 
 	for _, bl := range loaders {
@@ -216,7 +239,7 @@ func readBundleFiles(loaders []initload.BundleLoader, h bundle.SignatureHasher)
 			}
 
 			// hash the file content
-			fi, err := hashFileContent(h, buf.Bytes(), path)
+			fi, err := hashFileContent(h, alg, buf.Bytes(), path)
 			if err != nil {
 				return files, err
 			}
@@ -226,7 +249,7 @@ func readBundleFiles(loaders []initload.BundleLoader, h bundle.SignatureHasher)
 	return files, nil
 }
 
-func hashFileContent(h bundle.SignatureHasher, data []byte, path string) (bundle.FileInfo, error) {
+func hashFileContent(h bundle.SignatureHasher, alg bundle.HashingAlgorithm, data []byte, path string) (bundle.FileInfo, error) {
 
 	var fileInfo bundle.FileInfo
 	var value interface{}
@@ -245,23 +268,100 @@ func hashFileContent(h bundle.SignatureHasher, data []byte, path string) (bundle
 		return fileInfo, err
 	}
 
-	return bundle.NewFile(strings.TrimPrefix(path, "/"), hex.EncodeToString(bytes), defaultHashingAlg), nil
+	return bundle.NewFile(strings.TrimPrefix(path, "/"), hex.EncodeToString(bytes), alg.String()), nil
 }
 
 func writeTokenToFile(token, fileLoc string) error {
-	content := make(map[string]interface{})
-	content["signatures"] = []string{token}
+	return writeSignaturesToFile(bundle.SignaturesConfig{Signatures: []string{token}}, fileLoc)
+}
 
-	bs, err := json.MarshalIndent(content, "", " ")
+func writeSignaturesToFile(sc bundle.SignaturesConfig, fileLoc string) error {
+	bs, err := json.MarshalIndent(sc, "", " ")
 	if err != nil {
 		return err
 	}
 
-	path := signaturesFile
+	return ioutil.WriteFile(signaturesFilePath(fileLoc), bs, 0644)
+}
+
+// appendTokenToFile adds the token to the signatures in the .signatures.json
+// file at fileLoc. The existing signatures must cover the same files as the
+// token and must have been generated with other keys.
+func appendTokenToFile(token, keyID string, files []bundle.FileInfo, fileLoc string) error {
+	path := signaturesFilePath(fileLoc)
+
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var sc bundle.SignaturesConfig
+	if err := util.UnmarshalJSON(bs, &sc); err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+
+	for _, existing := range sc.Signatures {
+		kid, payload, err := decodeSignature(existing)
+		if err != nil {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+
+		if kid == keyID {
+			return fmt.Errorf("%v: bundle already signed with key %v", path, keyID)
+		}
+
+		if !bundle.EqualSignedFiles(payload.Files, files) {
+			return fmt.Errorf("%v: existing signature covers different files (sign the bundle again without --append)", path)
+		}
+	}
+
+	sc.Signatures = append(sc.Signatures, token)
+
+	return writeSignaturesToFile(sc, fileLoc)
+}
+
+// decodeSignature returns the key ID and payload of the signature without
+// verifying it.
+func decodeSignature(token string) (string, *bundle.DecodedSignature, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", nil, fmt.Errorf("invalid signature")
+	}
+
+	var hdr struct {
+		KeyID string `json:"kid"`
+	}
+
+	bs, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err == nil {
+		err = json.Unmarshal(bs, &hdr)
+	}
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to decode signature header")
+	}
+
+	var payload bundle.DecodedSignature
+
+	bs, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err == nil {
+		err = json.Unmarshal(bs, &payload)
+	}
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to decode signature payload")
+	}
+
+	if hdr.KeyID == "" {
+		hdr.KeyID = payload.KeyID
+	}
+
+	return hdr.KeyID, &payload, nil
+}
+
+func signaturesFilePath(fileLoc string) string {
 	if fileLoc != "" {
-		path = filepath.Join(fileLoc, path)
+		return filepath.Join(fileLoc, signaturesFile)
 	}
-	return ioutil.WriteFile(path, bs, 0644)
+	return signaturesFile
 }
 
 func validateSignParams(args []string, params signCmdParams) error {
@@ -276,5 +376,9 @@ func validateSignParams(args []string, params signCmdParams) error {
 	if !params.bundleMode {
 		return fmt.Errorf("enable bundle mode (ie. --bundle) to sign bundle files or directories")
 	}
+
+	if params.appendSignature && params.keyID == "" {
+		return fmt.Errorf("specify the ID of the signing key (ie. --signing-key-id) to append a signature")
+	}
 	return nil
 }
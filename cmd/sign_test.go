@@ -5,13 +5,18 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+
 	"github.com/meta-quick/opax/bundle"
 	"github.com/meta-quick/opax/internal/file/archive"
 	"github.com/meta-quick/opax/keys"
@@ -129,6 +134,156 @@ func TestBundleSignVerification(t *testing.T) {
 	})
 }
 
+func TestBundleSignVerificationSM2(t *testing.T) {
+
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, err := smx509.WritePrivateKeyToPem(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := smx509.WritePublicKeyToPem(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"/.manifest":            `{"revision": "quickbrownfaux"}`,
+		"/a/b/c/data.json":      "[1,2,3]",
+		"/example/example.rego": `package example`,
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+
+		keyFile := filepath.Join(t.TempDir(), "private.pem")
+		if err := ioutil.WriteFile(keyFile, priv, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		params := signCmdParams{
+			algorithm:      "SM2",
+			key:            keyFile,
+			outputFilePath: rootDir,
+			bundleMode:     true,
+		}
+
+		if err := doSign([]string{rootDir}, params); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		var filesInBundle [][2]string
+		err = filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+			if !info.IsDir() {
+				bs, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				filesInBundle = append(filesInBundle, [2]string{path, string(bs)})
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kc := keys.Config{
+			Key:       string(pub),
+			Algorithm: "SM2",
+		}
+
+		bvc := bundle.NewVerificationConfig(map[string]*keys.Config{"foo": &kc}, "foo", "", nil)
+		reader := bundle.NewReader(archive.MustWriteTarGz(filesInBundle)).WithBundleVerificationConfig(bvc).WithBaseDir(rootDir)
+
+		b, err := reader.Read()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		verified, err := bundle.VerifyBundleSignature(b.Signatures, bvc)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		for name, file := range verified {
+			if file.Algorithm != bundle.SM3.String() {
+				t.Fatalf("Expected file %v to be hashed with SM3 but got %v", name, file.Algorithm)
+			}
+		}
+	})
+}
+
+func TestBundleSignAppend(t *testing.T) {
+
+	files := map[string]string{
+		"/.manifest":            `{"revision": "quickbrownfaux"}`,
+		"/a/b/c/data.json":      "[1,2,3]",
+		"/example/example.rego": `package example`,
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+
+		sign := func(secret, keyID string, appendSignature bool) error {
+			return doSign([]string{rootDir}, signCmdParams{
+				algorithm:       "HS256",
+				key:             secret,
+				keyID:           keyID,
+				outputFilePath:  rootDir,
+				bundleMode:      true,
+				appendSignature: appendSignature,
+			})
+		}
+
+		read := func(bvc *bundle.VerificationConfig) error {
+			_, err := bundle.NewCustomReader(bundle.NewDirectoryLoader(rootDir)).WithBundleVerificationConfig(bvc).WithBaseDir(rootDir).Read()
+			return err
+		}
+
+		if err := sign("policy-secret", "policy", false); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := sign("security-secret", "security", true); err != nil {
+			t.Fatal(err)
+		}
+
+		err := sign("security-secret", "security", true)
+		if err == nil || !strings.Contains(err.Error(), "bundle already signed with key security") {
+			t.Fatalf("Expected duplicate key error but got: %v", err)
+		}
+
+		keyConfigs := map[string]*keys.Config{
+			"policy":   {Key: "policy-secret", Algorithm: "HS256"},
+			"security": {Key: "security-secret", Algorithm: "HS256"},
+		}
+
+		bvc := bundle.NewVerificationConfig(keyConfigs, "", "", nil)
+		bvc.KeyIDs = []string{"policy", "security"}
+		if err := read(bvc); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		bvc = bundle.NewVerificationConfig(map[string]*keys.Config{"policy": keyConfigs["policy"]}, "", "", nil)
+		bvc.Threshold = 1
+		if err := read(bvc); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		// the bundle must not change between signatures
+		if err := ioutil.WriteFile(filepath.Join(rootDir, "a", "b", "c", "data.json"), []byte("[1,2,3,4]"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		err = sign("other-secret", "other", true)
+		if err == nil || !strings.Contains(err.Error(), "existing signature covers different files") {
+			t.Fatalf("Expected different files error but got: %v", err)
+		}
+	})
+}
+
 func TestValidateSignParams(t *testing.T) {
 
 	tests := map[string]struct {
@@ -152,6 +307,11 @@ func TestValidateSignParams(t *testing.T) {
 			signCmdParams{key: "foo"},
 			true, fmt.Errorf("enable bundle mode (ie. --bundle) to sign bundle files or directories"),
 		},
+		"append_without_key_id": {
+			[]string{"foo"},
+			signCmdParams{key: "foo", bundleMode: true, appendSignature: true},
+			true, fmt.Errorf("specify the ID of the signing key (ie. --signing-key-id) to append a signature"),
+		},
 		"no_error": {
 			[]string{"foo"},
 			signCmdParams{key: "foo", bundleMode: true},
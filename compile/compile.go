@@ -74,6 +74,7 @@ type Compiler struct {
 	debug             debug.Debug                // optionally outputs debug information produced during build
 	bvc               *bundle.VerificationConfig // represents the key configuration used to verify a signed bundle
 	bsc               *bundle.SigningConfig      // represents the key configuration used to generate a signed bundle
+	bec               *bundle.EncryptionConfig   // represents the key configuration used to generate an encrypted bundle
 	keyID             string                     // represents the name of the default key used to verify a signed bundle
 	metadata          *map[string]interface{}    // represents additional data included in .manifest file
 }
@@ -168,6 +169,12 @@ func (c *Compiler) WithBundleSigningConfig(config *bundle.SigningConfig) *Compil
 	return c
 }
 
+// WithBundleEncryptionConfig sets the key configuration to use to generate an encrypted bundle
+func (c *Compiler) WithBundleEncryptionConfig(config *bundle.EncryptionConfig) *Compiler {
+	c.bec = config
+	return c
+}
+
 // WithBundleVerificationKeyID sets the key to use to verify a signed bundle.
 // If provided, the "keyid" claim in the bundle signature, will be set to this value
 func (c *Compiler) WithBundleVerificationKeyID(keyID string) *Compiler {
@@ -248,7 +255,7 @@ func (c *Compiler) Build(ctx context.Context) error {
 		return nil
 	}
 
-	return bundle.NewWriter(*c.output).Write(*c.bundle)
+	return bundle.NewWriter(*c.output).WithEncryptionConfig(c.bec).Write(*c.bundle)
 }
 
 func (c *Compiler) init() error {
@@ -27,6 +27,7 @@ type Config struct {
 	Bundles                      json.RawMessage            `json:"bundles,omitempty"`
 	DecisionLogs                 json.RawMessage            `json:"decision_logs,omitempty"`
 	Status                       json.RawMessage            `json:"status,omitempty"`
+	DataSync                     json.RawMessage            `json:"data_sync,omitempty"`
 	Plugins                      map[string]json.RawMessage `json:"plugins,omitempty"`
 	Keys                         json.RawMessage            `json:"keys,omitempty"`
 	DefaultDecision              *string                    `json:"default_decision,omitempty"`
@@ -34,6 +35,16 @@ type Config struct {
 	Caching                      json.RawMessage            `json:"caching,omitempty"`
 	PersistenceDirectory         *string                    `json:"persistence_directory,omitempty"`
 	DistributedTracing           json.RawMessage            `json:"distributed_tracing,omitempty"`
+	Server                       *ServerConfig              `json:"server,omitempty"`
+}
+
+// ServerConfig represents the configuration of the OPA server. The sections
+// are parsed by the server.
+type ServerConfig struct {
+	Budget         json.RawMessage `json:"budget,omitempty"`
+	Authentication json.RawMessage `json:"authentication,omitempty"`
+	Metrics        json.RawMessage `json:"metrics,omitempty"`
+	Batch          json.RawMessage `json:"batch,omitempty"`
 }
 
 // ParseConfig returns a valid Config object with defaults injected. The id
@@ -57,6 +68,9 @@ func (c Config) PluginNames() (result []string) {
 	if c.DecisionLogs != nil {
 		result = append(result, "decision_logs")
 	}
+	if c.DataSync != nil {
+		result = append(result, "data_sync")
+	}
 	for name := range c.Plugins {
 		result = append(result, name)
 	}
@@ -68,7 +82,7 @@ func (c Config) PluginNames() (result []string) {
 //
 // Deprecated. Use PluginNames instead.
 func (c Config) PluginsEnabled() bool {
-	return c.Bundle != nil || c.Bundles != nil || c.DecisionLogs != nil || c.Status != nil || len(c.Plugins) > 0
+	return c.Bundle != nil || c.Bundles != nil || c.DecisionLogs != nil || c.Status != nil || c.DataSync != nil || len(c.Plugins) > 0
 }
 
 // DefaultDecisionRef returns the default decision as a reference.
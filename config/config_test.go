@@ -361,3 +361,20 @@ func TestActiveConfig(t *testing.T) {
 	}
 
 }
+
+func TestParseConfigServer(t *testing.T) {
+
+	conf, err := ParseConfig([]byte(`{"server": {"budget": {"max_steps": 10}, "metrics": {"max_path_labels": 5}}}`), "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &ServerConfig{
+		Budget:  json.RawMessage(`{"max_steps":10}`),
+		Metrics: json.RawMessage(`{"max_path_labels":5}`),
+	}
+
+	if !reflect.DeepEqual(conf.Server, exp) {
+		t.Fatalf("Expected %+v but got %+v", exp, conf.Server)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package datafilter contains the building blocks shared by the translators
+// that convert the residual queries produced by partial evaluation into
+// filters for external data stores.
+package datafilter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/meta-quick/opax/ast"
+)
+
+const (
+	// UnsupportedErr indicates the residual queries contain a construct that
+	// cannot be expressed in the target language.
+	UnsupportedErr = "datafilter_unsupported_error"
+
+	// ConfigErr indicates the translator options are invalid.
+	ConfigErr = "datafilter_config_error"
+)
+
+// Error is returned when residual queries cannot be translated.
+type Error struct {
+	Code     string        `json:"code"`
+	Message  string        `json:"message"`
+	Location *ast.Location `json:"location,omitempty"`
+}
+
+func (e *Error) Error() string {
+
+	msg := fmt.Sprintf("%v: %v", e.Code, e.Message)
+
+	if e.Location != nil {
+		if len(e.Location.File) > 0 {
+			return e.Location.File + ":" + fmt.Sprint(e.Location.Row) + ": " + msg
+		}
+		return fmt.Sprint(e.Location.Row) + ":" + fmt.Sprint(e.Location.Col) + ": " + msg
+	}
+
+	return msg
+}
+
+// IsError returns true if err is a datafilter error with code.
+func IsError(code string, err error) bool {
+	if err, ok := err.(*Error); ok {
+		return err.Code == code
+	}
+	return false
+}
+
+// Unsupported returns an error indicating that the construct at loc cannot be
+// translated.
+func Unsupported(loc *ast.Location, f string, a ...interface{}) *Error {
+	return &Error{
+		Code:     UnsupportedErr,
+		Location: loc,
+		Message:  fmt.Sprintf(f, a...),
+	}
+}
+
+// InvalidConfig returns an error indicating that the translator options are
+// invalid.
+func InvalidConfig(f string, a ...interface{}) *Error {
+	return &Error{
+		Code:    ConfigErr,
+		Message: fmt.Sprintf(f, a...),
+	}
+}
+
+// Mapping maps the references under an unknown (e.g., input.documents) onto
+// the fields of a target collection such as an SQL table or a search index.
+type Mapping struct {
+	prefix ast.Ref
+	fields map[string]string
+}
+
+// NewMapping returns a Mapping for the unknown ref. The fields map is keyed by
+// the dotted path of a reference relative to ref (e.g., "owner" or
+// "meta.owner"). If fields is empty, the dotted path itself is used as the
+// field name.
+func NewMapping(ref string, fields map[string]string) (*Mapping, error) {
+
+	prefix, err := ast.ParseRef(ref)
+	if err != nil {
+		return nil, InvalidConfig("invalid reference %q: %v", ref, err)
+	}
+
+	if !prefix.IsGround() {
+		return nil, InvalidConfig("reference %q must be ground", ref)
+	}
+
+	return &Mapping{prefix: prefix, fields: fields}, nil
+}
+
+// Prefix returns the unknown this mapping applies to.
+func (m *Mapping) Prefix() ast.Ref {
+	return m.prefix
+}
+
+// Field returns the name of the field that ref refers to. If ref is not
+// covered by the mapping, ok is false.
+func (m *Mapping) Field(ref ast.Ref) (field string, ok bool) {
+
+	if len(ref) <= len(m.prefix) || !ref.HasPrefix(m.prefix) {
+		return "", false
+	}
+
+	path := make([]string, 0, len(ref)-len(m.prefix))
+
+	for _, t := range ref[len(m.prefix):] {
+		s, ok := t.Value.(ast.String)
+		if !ok {
+			return "", false
+		}
+		path = append(path, string(s))
+	}
+
+	key := strings.Join(path, ".")
+
+	if len(m.fields) == 0 {
+		return key, true
+	}
+
+	field, ok = m.fields[key]
+	return field, ok
+}
+
+// Scalar returns the Go representation of a scalar term. Numbers are converted
+// to int64 when they are integral and to float64 otherwise.
+func Scalar(t *ast.Term) (interface{}, bool) {
+	switch v := t.Value.(type) {
+	case ast.Null:
+		return nil, true
+	case ast.Boolean:
+		return bool(v), true
+	case ast.String:
+		return string(v), true
+	case ast.Number:
+		if i, ok := v.Int64(); ok {
+			return i, true
+		}
+		if f, ok := v.Float64(); ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Operands returns the operands of a call expression with the given number of
+// arguments. Expressions with other arities yield nil.
+func Operands(expr *ast.Expr, n int) []*ast.Term {
+	terms, ok := expr.Terms.([]*ast.Term)
+	if !ok || len(terms) != n+1 {
+		return nil
+	}
+	return terms[1:]
+}
@@ -0,0 +1,537 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package elasticsearch translates the residual queries produced by partial
+// evaluation into Elasticsearch/OpenSearch query DSL.
+//
+// The residual queries are combined into a bool query that matches a document
+// if any of the queries matches it. The expressions of each query are placed
+// in the filter context of a nested bool query so that they do not contribute
+// to scoring.
+package elasticsearch
+
+import (
+	"strings"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/datafilter"
+	"github.com/meta-quick/opax/rego"
+)
+
+// Index maps an unknown onto the documents of a search index.
+type Index struct {
+	// Unknown is the reference partial evaluation was asked to treat as
+	// unknown, e.g., "input.document".
+	Unknown string `json:"unknown"`
+
+	// Fields maps the dotted path of a reference relative to Unknown onto a
+	// field of the index. If Fields is empty, the path itself is used as the
+	// field name.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Options contains the settings of a translation.
+type Options struct {
+	Indices []Index `json:"indices"`
+}
+
+// Query is a node of the query DSL. It serializes to the JSON accepted by the
+// search APIs.
+type Query map[string]interface{}
+
+// Translate converts the residual queries in pq into a query. If pq contains
+// no queries, the result is a match_none query. If any query is empty, the
+// result is a match_all query.
+func Translate(pq *rego.PartialQueries, opts Options) (Query, error) {
+
+	t, err := newTranslator(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pq.Support) > 0 {
+		var loc *ast.Location
+		if len(pq.Support[0].Rules) > 0 {
+			loc = pq.Support[0].Rules[0].Location
+		}
+		return nil, datafilter.Unsupported(loc, "support modules cannot be translated (package %v)", pq.Support[0].Package.Path)
+	}
+
+	if len(pq.Queries) == 0 {
+		return Query{"match_none": Query{}}, nil
+	}
+
+	should := make([]interface{}, 0, len(pq.Queries))
+
+	for _, body := range pq.Queries {
+
+		if len(body) == 0 {
+			return Query{"match_all": Query{}}, nil
+		}
+
+		q, err := t.body(body)
+		if err != nil {
+			return nil, err
+		}
+
+		should = append(should, q)
+	}
+
+	if len(should) == 1 {
+		return should[0].(Query), nil
+	}
+
+	return boolQuery("should", should, "minimum_should_match", 1), nil
+}
+
+type translator struct {
+	mappings []*datafilter.Mapping
+}
+
+func newTranslator(opts Options) (*translator, error) {
+
+	if len(opts.Indices) == 0 {
+		return nil, datafilter.InvalidConfig("at least one index must be declared")
+	}
+
+	t := &translator{}
+
+	for _, index := range opts.Indices {
+		m, err := datafilter.NewMapping(index.Unknown, index.Fields)
+		if err != nil {
+			return nil, err
+		}
+		t.mappings = append(t.mappings, m)
+	}
+
+	return t, nil
+}
+
+func (t *translator) body(body ast.Body) (Query, error) {
+
+	filter := make([]interface{}, 0, len(body))
+
+	for _, expr := range body {
+		q, err := t.expr(expr)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, q)
+	}
+
+	return boolQuery("filter", filter), nil
+}
+
+func (t *translator) expr(expr *ast.Expr) (Query, error) {
+
+	if len(expr.With) > 0 {
+		return nil, datafilter.Unsupported(expr.Location, "with modifiers cannot be translated: %v", expr)
+	}
+
+	q, err := t.positive(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if expr.Negated {
+		return not(q), nil
+	}
+
+	return q, nil
+}
+
+func (t *translator) positive(expr *ast.Expr) (Query, error) {
+
+	if term, ok := expr.Terms.(*ast.Term); ok {
+		field, ok, err := t.field(term)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+		}
+		// A reference on its own is true if the value is defined and not false.
+		return boolQuery(
+			"filter", []interface{}{existsQuery(field)},
+			"must_not", []interface{}{termQuery(field, false)},
+		), nil
+	}
+
+	if !expr.IsCall() {
+		return nil, datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+	}
+
+	op := expr.Operator()
+
+	switch {
+	case op.Equal(ast.Equality.Ref()), op.Equal(ast.Equal.Ref()):
+		return t.equal(expr)
+	case op.Equal(ast.NotEqual.Ref()):
+		q, err := t.equal(expr)
+		if err != nil {
+			return nil, err
+		}
+		return not(q), nil
+	case op.Equal(ast.LessThan.Ref()):
+		return t.compare(expr, "lt")
+	case op.Equal(ast.LessThanEq.Ref()):
+		return t.compare(expr, "lte")
+	case op.Equal(ast.GreaterThan.Ref()):
+		return t.compare(expr, "gt")
+	case op.Equal(ast.GreaterThanEq.Ref()):
+		return t.compare(expr, "gte")
+	case op.Equal(ast.StartsWith.Ref()):
+		return t.startsWith(expr)
+	case op.Equal(ast.GlobMatch.Ref()):
+		return t.globMatch(expr)
+	case op.Equal(ast.Member.Ref()):
+		return t.member(expr)
+	}
+
+	return nil, datafilter.Unsupported(expr.Location, "built-in function %v cannot be translated", op)
+}
+
+// operands returns the field and the constant of a binary expression. If the
+// constant is on the left-hand side, swapped is true.
+func (t *translator) operands(expr *ast.Expr) (field string, value interface{}, swapped bool, err error) {
+
+	operands := datafilter.Operands(expr, 2)
+	if operands == nil {
+		return "", nil, false, datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+	}
+
+	a, b := operands[0], operands[1]
+
+	fieldA, okA, err := t.field(a)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	fieldB, okB, err := t.field(b)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	switch {
+	case okA && okB:
+		return "", nil, false, datafilter.Unsupported(expr.Location, "fields cannot be compared with each other: %v", expr)
+	case okA:
+		v, err := scalar(expr, b)
+		return fieldA, v, false, err
+	case okB:
+		v, err := scalar(expr, a)
+		return fieldB, v, true, err
+	}
+
+	return "", nil, false, datafilter.Unsupported(expr.Location, "expression does not refer to a field: %v", expr)
+}
+
+func (t *translator) equal(expr *ast.Expr) (Query, error) {
+
+	field, v, _, err := t.operands(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil {
+		return not(existsQuery(field)), nil
+	}
+
+	return termQuery(field, v), nil
+}
+
+// flipped maps range operators onto their equivalents with swapped operands.
+var flipped = map[string]string{
+	"lt":  "gt",
+	"lte": "gte",
+	"gt":  "lt",
+	"gte": "lte",
+}
+
+func (t *translator) compare(expr *ast.Expr, op string) (Query, error) {
+
+	field, v, swapped, err := t.operands(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil {
+		return nil, datafilter.Unsupported(expr.Location, "null cannot be compared with %v: %v", op, expr)
+	}
+
+	if swapped {
+		op = flipped[op]
+	}
+
+	return Query{"range": Query{field: Query{op: v}}}, nil
+}
+
+func (t *translator) startsWith(expr *ast.Expr) (Query, error) {
+
+	operands := datafilter.Operands(expr, 2)
+	if operands == nil {
+		return nil, datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+	}
+
+	field, ok, err := t.field(operands[0])
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, datafilter.Unsupported(expr.Location, "first argument of startswith must refer to a field: %v", expr)
+	}
+
+	prefix, ok := operands[1].Value.(ast.String)
+	if !ok {
+		return nil, datafilter.Unsupported(expr.Location, "second argument of startswith must be a string constant: %v", expr)
+	}
+
+	return Query{"prefix": Query{field: Query{"value": string(prefix)}}}, nil
+}
+
+func (t *translator) globMatch(expr *ast.Expr) (Query, error) {
+
+	operands := datafilter.Operands(expr, 3)
+	if operands == nil {
+		return nil, datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+	}
+
+	pattern, ok := operands[0].Value.(ast.String)
+	if !ok {
+		return nil, datafilter.Unsupported(expr.Location, "pattern of glob.match must be a string constant: %v", expr)
+	}
+
+	delimiters, err := globDelimiters(operands[1])
+	if err != nil {
+		return nil, datafilter.Unsupported(expr.Location, "%v: %v", err.Error(), expr)
+	}
+
+	field, ok, err := t.field(operands[2])
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, datafilter.Unsupported(expr.Location, "third argument of glob.match must refer to a field: %v", expr)
+	}
+
+	p, err := parseGlob(string(pattern), delimiters)
+	if err != nil {
+		return nil, datafilter.Unsupported(expr.Location, "%v: %v", err.Error(), expr)
+	}
+
+	if p.regexp {
+		return Query{"regexp": Query{field: Query{"value": p.value}}}, nil
+	}
+
+	return Query{"wildcard": Query{field: Query{"value": p.value}}}, nil
+}
+
+func (t *translator) member(expr *ast.Expr) (Query, error) {
+
+	operands := datafilter.Operands(expr, 2)
+	if operands == nil {
+		return nil, datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+	}
+
+	field, ok, err := t.field(operands[0])
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, datafilter.Unsupported(expr.Location, "left-hand side of membership test must refer to a field: %v", expr)
+	}
+
+	var elems []*ast.Term
+
+	switch coll := operands[1].Value.(type) {
+	case *ast.Array:
+		coll.Foreach(func(x *ast.Term) {
+			elems = append(elems, x)
+		})
+	case ast.Set:
+		coll.Foreach(func(x *ast.Term) {
+			elems = append(elems, x)
+		})
+	default:
+		return nil, datafilter.Unsupported(expr.Location, "right-hand side of membership test must be a constant array or set: %v", expr)
+	}
+
+	values := make([]interface{}, len(elems))
+
+	for i := range elems {
+		v, err := scalar(expr, elems[i])
+		if err != nil {
+			return nil, err
+		} else if v == nil {
+			return nil, datafilter.Unsupported(expr.Location, "null cannot be used in membership test: %v", expr)
+		}
+		values[i] = v
+	}
+
+	return Query{"terms": Query{field: values}}, nil
+}
+
+// field returns the index field for term. If term is not a reference to an
+// unknown, ok is false. References to unknowns that are not mapped onto a
+// field are reported as errors.
+func (t *translator) field(term *ast.Term) (string, bool, error) {
+
+	ref, ok := term.Value.(ast.Ref)
+	if !ok {
+		return "", false, nil
+	}
+
+	for _, m := range t.mappings {
+		if !ref.HasPrefix(m.Prefix()) {
+			continue
+		}
+		field, ok := m.Field(ref)
+		if !ok {
+			return "", false, datafilter.Unsupported(term.Location, "reference %v is not mapped onto a field", ref)
+		}
+		return field, true, nil
+	}
+
+	return "", false, datafilter.Unsupported(term.Location, "reference %v is not covered by any index", ref)
+}
+
+func scalar(expr *ast.Expr, term *ast.Term) (interface{}, error) {
+	v, ok := datafilter.Scalar(term)
+	if !ok {
+		return nil, datafilter.Unsupported(expr.Location, "%v %v cannot be translated: %v", ast.TypeName(term.Value), term, expr)
+	}
+	return v, nil
+}
+
+func termQuery(field string, v interface{}) Query {
+	return Query{"term": Query{field: v}}
+}
+
+func existsQuery(field string) Query {
+	return Query{"exists": Query{"field": field}}
+}
+
+func not(q Query) Query {
+	// Avoid double negation, e.g., for "x != null".
+	if b, ok := q["bool"].(Query); ok && len(b) == 1 {
+		if mustNot, ok := b["must_not"].([]interface{}); ok && len(mustNot) == 1 {
+			return mustNot[0].(Query)
+		}
+	}
+	return boolQuery("must_not", []interface{}{q})
+}
+
+func boolQuery(kvs ...interface{}) Query {
+	q := Query{}
+	for i := 0; i < len(kvs); i += 2 {
+		q[kvs[i].(string)] = kvs[i+1]
+	}
+	return Query{"bool": q}
+}
+
+func globDelimiters(term *ast.Term) ([]rune, error) {
+
+	arr, ok := term.Value.(*ast.Array)
+	if !ok {
+		return nil, errGlob("delimiters of glob.match must be a constant array")
+	}
+
+	delimiters := make([]rune, 0, arr.Len())
+
+	for i := 0; i < arr.Len(); i++ {
+		s, ok := arr.Elem(i).Value.(ast.String)
+		if !ok || len([]rune(string(s))) != 1 {
+			return nil, errGlob("delimiters of glob.match must be single characters")
+		}
+		delimiters = append(delimiters, []rune(string(s))[0])
+	}
+
+	// glob.match defaults to "." if no delimiters are given.
+	if len(delimiters) == 0 {
+		delimiters = []rune{'.'}
+	}
+
+	return delimiters, nil
+}
+
+type glob struct {
+	value  string
+	regexp bool
+}
+
+type errGlob string
+
+func (e errGlob) Error() string {
+	return string(e)
+}
+
+// parseGlob converts a glob.match pattern into a wildcard pattern. The
+// wildcard query cannot exclude the delimiters from the characters matched by
+// "*" and "?", so patterns that use them are converted into regular
+// expressions instead. "**" matches across delimiters and is therefore
+// equivalent to "*" in a wildcard pattern.
+func parseGlob(pattern string, delimiters []rune) (glob, error) {
+
+	runes := []rune(pattern)
+
+	var wildcard, regexp strings.Builder
+	var single bool
+
+	var notDelimiter strings.Builder
+	notDelimiter.WriteString("[^")
+	for _, d := range delimiters {
+		notDelimiter.WriteString(escapeRegexp(d))
+	}
+	notDelimiter.WriteString("]")
+
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\\':
+			if i+1 == len(runes) {
+				return glob{}, errGlob("pattern of glob.match ends with an escape character")
+			}
+			i++
+			wildcard.WriteString(escapeWildcard(runes[i]))
+			regexp.WriteString(escapeRegexp(runes[i]))
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+				wildcard.WriteString("*")
+				regexp.WriteString(".*")
+			} else {
+				single = true
+				regexp.WriteString(notDelimiter.String() + "*")
+			}
+		case '?':
+			single = true
+			regexp.WriteString(notDelimiter.String())
+		case '[', ']', '{', '}':
+			return glob{}, errGlob("character classes and alternatives in glob.match patterns cannot be translated")
+		default:
+			wildcard.WriteString(escapeWildcard(r))
+			regexp.WriteString(escapeRegexp(r))
+		}
+	}
+
+	if single {
+		return glob{value: regexp.String(), regexp: true}, nil
+	}
+
+	return glob{value: wildcard.String()}, nil
+}
+
+func escapeWildcard(r rune) string {
+	switch r {
+	case '*', '?', '\\':
+		return `\` + string(r)
+	}
+	return string(r)
+}
+
+// regexpReserved contains the characters with special meaning in Lucene
+// regular expressions, including those enabled by optional operator flags.
+const regexpReserved = `.?+*|{}[]()"\#@&<>~^-`
+
+func escapeRegexp(r rune) string {
+	if strings.ContainsRune(regexpReserved, r) {
+		return `\` + string(r)
+	}
+	return string(r)
+}
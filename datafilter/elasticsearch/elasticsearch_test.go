@@ -0,0 +1,281 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/datafilter"
+	"github.com/meta-quick/opax/rego"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+var documentIndex = Index{
+	Unknown: "input.document",
+	Fields: map[string]string{
+		"owner":      "owner.keyword",
+		"path":       "path",
+		"level":      "level",
+		"kind":       "kind",
+		"public":     "public",
+		"deleted":    "deleted",
+		"meta.email": "meta.email",
+		"reviewer":   "reviewer",
+	},
+}
+
+func TestTranslateGolden(t *testing.T) {
+
+	tests := []struct {
+		note   string
+		module string
+		input  string
+	}{
+		{
+			note: "term",
+			module: `package filters
+				allow { input.document.owner == input.subject }`,
+			input: `{"subject": "alice"}`,
+		},
+		{
+			note: "not_equal",
+			module: `package filters
+				allow { input.document.owner != "alice" }`,
+		},
+		{
+			note: "range",
+			module: `package filters
+				allow {
+					input.document.level <= input.clearance
+					0 < input.document.level
+				}`,
+			input: `{"clearance": 2}`,
+		},
+		{
+			note: "prefix",
+			module: `package filters
+				allow { startswith(input.document.path, "/finance/") }`,
+		},
+		{
+			note: "terms",
+			module: `package filters
+				import future.keywords.in
+				allow { input.document.kind in ["memo", "sheet"] }`,
+		},
+		{
+			note: "wildcard",
+			module: `package filters
+				allow { glob.match("**@example.com", [], input.document.meta.email) }`,
+		},
+		{
+			note: "regexp",
+			module: `package filters
+				allow { glob.match("/finance/*/q?", ["/"], input.document.path) }`,
+		},
+		{
+			note: "exists",
+			module: `package filters
+				allow { input.document.public }
+				allow { input.document.reviewer != null }`,
+		},
+		{
+			note: "not",
+			module: `package filters
+				allow {
+					input.document.owner == input.subject
+					not input.document.deleted
+				}`,
+			input: `{"subject": "bob"}`,
+		},
+		{
+			note: "match_all",
+			module: `package filters
+				allow { input.subject == "admin" }`,
+			input: `{"subject": "admin"}`,
+		},
+		{
+			note: "match_none",
+			module: `package filters
+				allow { input.subject == "admin" }`,
+			input: `{"subject": "guest"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			input := `{}`
+			if tc.input != "" {
+				input = tc.input
+			}
+
+			pq, err := rego.New(
+				rego.Query("data.filters.allow == true"),
+				rego.Module("test.rego", tc.module),
+				rego.ParsedInput(ast.MustParseTerm(input).Value),
+				rego.Unknowns([]string{"input.document"}),
+			).Partial(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q, err := Translate(pq, Options{Indices: []Index{documentIndex}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bs, err := json.MarshalIndent(q, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			bs = append(bs, '\n')
+
+			golden := filepath.Join("testdata", tc.note+".json")
+
+			if *update {
+				if err := ioutil.WriteFile(golden, bs, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			exp, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(exp, bs) {
+				t.Fatalf("query does not match %v (run with -update to regenerate):\n\n%s", golden, bs)
+			}
+		})
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		query   string
+		opts    *Options
+		code    string
+		message string
+	}{
+		{
+			note:    "unsupported built-in",
+			query:   `contains(input.document.path, "x")`,
+			code:    datafilter.UnsupportedErr,
+			message: "built-in function contains cannot be translated",
+		},
+		{
+			note:    "field comparison",
+			query:   `input.document.owner = input.document.reviewer`,
+			code:    datafilter.UnsupportedErr,
+			message: "fields cannot be compared with each other",
+		},
+		{
+			note:    "unmapped field",
+			query:   `input.document.secret = 1`,
+			code:    datafilter.UnsupportedErr,
+			message: "reference input.document.secret is not mapped onto a field",
+		},
+		{
+			note:    "reference outside of indices",
+			query:   `input.user.name = "alice"`,
+			code:    datafilter.UnsupportedErr,
+			message: "reference input.user.name is not covered by any index",
+		},
+		{
+			note:    "glob character class",
+			query:   `glob.match("[ab]*", [], input.document.path)`,
+			code:    datafilter.UnsupportedErr,
+			message: "character classes and alternatives in glob.match patterns cannot be translated",
+		},
+		{
+			note:    "glob variable pattern",
+			query:   `glob.match(input.document.kind, [], input.document.path)`,
+			code:    datafilter.UnsupportedErr,
+			message: "pattern of glob.match must be a string constant",
+		},
+		{
+			note:    "null range",
+			query:   `input.document.level > null`,
+			code:    datafilter.UnsupportedErr,
+			message: "null cannot be compared with gt",
+		},
+		{
+			note:    "composite constant",
+			query:   `input.document.owner = {"name": "alice"}`,
+			code:    datafilter.UnsupportedErr,
+			message: `object {"name": "alice"} cannot be translated`,
+		},
+		{
+			note:    "no indices",
+			query:   `input.document.owner = "alice"`,
+			opts:    &Options{},
+			code:    datafilter.ConfigErr,
+			message: "at least one index must be declared",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			pq := &rego.PartialQueries{
+				Queries: []ast.Body{ast.MustParseBody(tc.query)},
+			}
+
+			opts := Options{Indices: []Index{documentIndex}}
+			if tc.opts != nil {
+				opts = *tc.opts
+			}
+
+			_, err := Translate(pq, opts)
+			if !datafilter.IsError(tc.code, err) {
+				t.Fatalf("expected %v error but got: %v", tc.code, err)
+			}
+
+			if !strings.Contains(err.Error(), tc.message) {
+				t.Fatalf("expected error to contain %q but got: %v", tc.message, err)
+			}
+		})
+	}
+}
+
+func TestParseGlob(t *testing.T) {
+
+	tests := []struct {
+		pattern    string
+		delimiters []rune
+		value      string
+		regexp     bool
+	}{
+		{`abc`, []rune{'.'}, `abc`, false},
+		{`a**`, []rune{'.'}, `a*`, false},
+		{`a\*b**`, []rune{'.'}, `a\*b*`, false},
+		{`a*.b`, []rune{'.'}, `a[^\.]*\.b`, true},
+		{`a?c`, []rune{'/', ':'}, `a[^/:]c`, true},
+		{`**.a+b*`, []rune{'.'}, `.*\.a\+b[^\.]*`, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.pattern, func(t *testing.T) {
+			g, err := parseGlob(tc.pattern, tc.delimiters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.value != tc.value || g.regexp != tc.regexp {
+				t.Fatalf("expected %v (regexp: %v) but got %v (regexp: %v)", tc.value, tc.regexp, g.value, g.regexp)
+			}
+		})
+	}
+}
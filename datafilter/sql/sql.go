@@ -0,0 +1,434 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package sql translates the residual queries produced by partial evaluation
+// into parameterized SQL WHERE clauses.
+//
+// Each unknown (e.g., input.documents) is mapped onto a table and the fields
+// referenced under it are mapped onto columns of that table. The residual
+// queries are combined with OR and the expressions of each query are combined
+// with AND. Constants are never inlined into the generated SQL; they are
+// returned as arguments to be bound to the placeholders of the clause.
+package sql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/datafilter"
+	"github.com/meta-quick/opax/rego"
+)
+
+// Dialect names an SQL dialect supported by the translator.
+type Dialect string
+
+const (
+	// Postgres generates SQL for PostgreSQL. Placeholders are numbered ($1, $2, ...).
+	Postgres Dialect = "postgres"
+
+	// MySQL generates SQL for MySQL and MariaDB.
+	MySQL Dialect = "mysql"
+
+	// SQLite generates SQL for SQLite.
+	SQLite Dialect = "sqlite"
+)
+
+// Table maps an unknown onto an SQL table.
+type Table struct {
+	// Name is the name of the table. It is used to qualify column names.
+	Name string `json:"name"`
+
+	// Unknown is the reference partial evaluation was asked to treat as
+	// unknown, e.g., "input.documents".
+	Unknown string `json:"unknown"`
+
+	// Columns maps the dotted path of a reference relative to Unknown onto a
+	// column name. If Columns is empty, the path itself is used as the column
+	// name.
+	Columns map[string]string `json:"columns,omitempty"`
+}
+
+// Options contains the settings of a translation.
+type Options struct {
+	Dialect Dialect `json:"dialect"`
+	Tables  []Table `json:"tables"`
+}
+
+// Result is the outcome of a translation. Where is a boolean SQL expression
+// and Args contains the values to bind to its placeholders in order.
+type Result struct {
+	Where string        `json:"where"`
+	Args  []interface{} `json:"args"`
+}
+
+const (
+	sqlTrue  = "1 = 1"
+	sqlFalse = "1 = 0"
+)
+
+// Translate converts the residual queries in pq into an SQL WHERE clause. If
+// pq contains no queries, the clause matches no rows. If any query is empty,
+// the clause matches all rows.
+func Translate(pq *rego.PartialQueries, opts Options) (*Result, error) {
+
+	t, err := newTranslator(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pq.Support) > 0 {
+		var loc *ast.Location
+		if len(pq.Support[0].Rules) > 0 {
+			loc = pq.Support[0].Rules[0].Location
+		}
+		return nil, datafilter.Unsupported(loc, "support modules cannot be translated (package %v)", pq.Support[0].Package.Path)
+	}
+
+	if len(pq.Queries) == 0 {
+		return &Result{Where: sqlFalse, Args: []interface{}{}}, nil
+	}
+
+	disjuncts := make([]string, 0, len(pq.Queries))
+
+	for _, body := range pq.Queries {
+
+		if len(body) == 0 {
+			return &Result{Where: sqlTrue, Args: []interface{}{}}, nil
+		}
+
+		s, err := t.body(body)
+		if err != nil {
+			return nil, err
+		}
+
+		disjuncts = append(disjuncts, s)
+	}
+
+	if len(disjuncts) == 1 {
+		return &Result{Where: disjuncts[0], Args: t.args}, nil
+	}
+
+	return &Result{Where: "(" + strings.Join(disjuncts, ") OR (") + ")", Args: t.args}, nil
+}
+
+type translator struct {
+	dialect  Dialect
+	tables   []string
+	mappings []*datafilter.Mapping
+	args     []interface{}
+}
+
+func newTranslator(opts Options) (*translator, error) {
+
+	switch opts.Dialect {
+	case Postgres, MySQL, SQLite:
+	case "":
+		opts.Dialect = Postgres
+	default:
+		return nil, datafilter.InvalidConfig("unknown dialect %q", opts.Dialect)
+	}
+
+	if len(opts.Tables) == 0 {
+		return nil, datafilter.InvalidConfig("at least one table must be declared")
+	}
+
+	t := &translator{
+		dialect: opts.Dialect,
+		args:    []interface{}{},
+	}
+
+	for _, table := range opts.Tables {
+
+		if table.Name == "" {
+			return nil, datafilter.InvalidConfig("table for %q must have a name", table.Unknown)
+		}
+
+		m, err := datafilter.NewMapping(table.Unknown, table.Columns)
+		if err != nil {
+			return nil, err
+		}
+
+		t.tables = append(t.tables, table.Name)
+		t.mappings = append(t.mappings, m)
+	}
+
+	return t, nil
+}
+
+func (t *translator) body(body ast.Body) (string, error) {
+
+	conjuncts := make([]string, 0, len(body))
+
+	for _, expr := range body {
+		s, err := t.expr(expr)
+		if err != nil {
+			return "", err
+		}
+		conjuncts = append(conjuncts, s)
+	}
+
+	if len(conjuncts) == 1 {
+		return conjuncts[0], nil
+	}
+
+	for i := range conjuncts {
+		conjuncts[i] = "(" + conjuncts[i] + ")"
+	}
+
+	return strings.Join(conjuncts, " AND "), nil
+}
+
+func (t *translator) expr(expr *ast.Expr) (string, error) {
+
+	if len(expr.With) > 0 {
+		return "", datafilter.Unsupported(expr.Location, "with modifiers cannot be translated: %v", expr)
+	}
+
+	s, err := t.positive(expr)
+	if err != nil {
+		return "", err
+	}
+
+	if expr.Negated {
+		return "NOT (" + s + ")", nil
+	}
+
+	return s, nil
+}
+
+func (t *translator) positive(expr *ast.Expr) (string, error) {
+
+	if term, ok := expr.Terms.(*ast.Term); ok {
+		col, ok, err := t.column(term)
+		if err != nil {
+			return "", err
+		} else if !ok {
+			return "", datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+		}
+		return col + " = " + t.bind(true), nil
+	}
+
+	if !expr.IsCall() {
+		return "", datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+	}
+
+	op := expr.Operator()
+
+	switch {
+	case op.Equal(ast.Equality.Ref()), op.Equal(ast.Equal.Ref()):
+		return t.compare(expr, "=")
+	case op.Equal(ast.NotEqual.Ref()):
+		return t.compare(expr, "<>")
+	case op.Equal(ast.LessThan.Ref()):
+		return t.compare(expr, "<")
+	case op.Equal(ast.LessThanEq.Ref()):
+		return t.compare(expr, "<=")
+	case op.Equal(ast.GreaterThan.Ref()):
+		return t.compare(expr, ">")
+	case op.Equal(ast.GreaterThanEq.Ref()):
+		return t.compare(expr, ">=")
+	case op.Equal(ast.StartsWith.Ref()):
+		return t.startsWith(expr)
+	case op.Equal(ast.Member.Ref()):
+		return t.member(expr)
+	}
+
+	return "", datafilter.Unsupported(expr.Location, "built-in function %v cannot be translated", op)
+}
+
+// flipped maps comparison operators onto their equivalents with swapped operands.
+var flipped = map[string]string{
+	"=":  "=",
+	"<>": "<>",
+	"<":  ">",
+	"<=": ">=",
+	">":  "<",
+	">=": "<=",
+}
+
+func (t *translator) compare(expr *ast.Expr, op string) (string, error) {
+
+	operands := datafilter.Operands(expr, 2)
+	if operands == nil {
+		return "", datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+	}
+
+	a, b := operands[0], operands[1]
+
+	colA, okA, err := t.column(a)
+	if err != nil {
+		return "", err
+	}
+
+	colB, okB, err := t.column(b)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case okA && okB:
+		return colA + " " + op + " " + colB, nil
+	case okA:
+		return t.compareConst(expr, colA, op, b)
+	case okB:
+		return t.compareConst(expr, colB, flipped[op], a)
+	}
+
+	return "", datafilter.Unsupported(expr.Location, "expression does not refer to a column: %v", expr)
+}
+
+func (t *translator) compareConst(expr *ast.Expr, col string, op string, term *ast.Term) (string, error) {
+
+	v, err := t.scalar(expr, term)
+	if err != nil {
+		return "", err
+	}
+
+	if v == nil {
+		switch op {
+		case "=":
+			return col + " IS NULL", nil
+		case "<>":
+			return col + " IS NOT NULL", nil
+		}
+		return "", datafilter.Unsupported(expr.Location, "null cannot be compared with %v: %v", op, expr)
+	}
+
+	return col + " " + op + " " + t.bind(v), nil
+}
+
+func (t *translator) startsWith(expr *ast.Expr) (string, error) {
+
+	operands := datafilter.Operands(expr, 2)
+	if operands == nil {
+		return "", datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+	}
+
+	col, ok, err := t.column(operands[0])
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", datafilter.Unsupported(expr.Location, "first argument of startswith must refer to a column: %v", expr)
+	}
+
+	prefix, ok := operands[1].Value.(ast.String)
+	if !ok {
+		return "", datafilter.Unsupported(expr.Location, "second argument of startswith must be a string constant: %v", expr)
+	}
+
+	// SQLite's LIKE is case-insensitive for ASCII characters so use GLOB instead.
+	if t.dialect == SQLite {
+		return col + " GLOB " + t.bind(escapeGlob(string(prefix))+"*"), nil
+	}
+
+	return col + " LIKE " + t.bind(escapeLike(string(prefix))+"%") + " ESCAPE '!'", nil
+}
+
+func (t *translator) member(expr *ast.Expr) (string, error) {
+
+	operands := datafilter.Operands(expr, 2)
+	if operands == nil {
+		return "", datafilter.Unsupported(expr.Location, "expression cannot be translated: %v", expr)
+	}
+
+	col, ok, err := t.column(operands[0])
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", datafilter.Unsupported(expr.Location, "left-hand side of membership test must refer to a column: %v", expr)
+	}
+
+	var elems []*ast.Term
+
+	switch coll := operands[1].Value.(type) {
+	case *ast.Array:
+		coll.Foreach(func(x *ast.Term) {
+			elems = append(elems, x)
+		})
+	case ast.Set:
+		coll.Foreach(func(x *ast.Term) {
+			elems = append(elems, x)
+		})
+	default:
+		return "", datafilter.Unsupported(expr.Location, "right-hand side of membership test must be a constant array or set: %v", expr)
+	}
+
+	if len(elems) == 0 {
+		return sqlFalse, nil
+	}
+
+	placeholders := make([]string, len(elems))
+
+	for i := range elems {
+		v, err := t.scalar(expr, elems[i])
+		if err != nil {
+			return "", err
+		} else if v == nil {
+			return "", datafilter.Unsupported(expr.Location, "null cannot be used in membership test: %v", expr)
+		}
+		placeholders[i] = t.bind(v)
+	}
+
+	return col + " IN (" + strings.Join(placeholders, ", ") + ")", nil
+}
+
+// column returns the qualified column name for term. If term is not a
+// reference to an unknown, ok is false. References to unknowns that are not
+// mapped onto a column are reported as errors.
+func (t *translator) column(term *ast.Term) (string, bool, error) {
+
+	ref, ok := term.Value.(ast.Ref)
+	if !ok {
+		return "", false, nil
+	}
+
+	for i, m := range t.mappings {
+		if !ref.HasPrefix(m.Prefix()) {
+			continue
+		}
+		field, ok := m.Field(ref)
+		if !ok {
+			return "", false, datafilter.Unsupported(term.Location, "reference %v is not mapped onto a column of table %v", ref, t.tables[i])
+		}
+		return t.quote(t.tables[i]) + "." + t.quote(field), true, nil
+	}
+
+	return "", false, datafilter.Unsupported(term.Location, "reference %v is not covered by any table", ref)
+}
+
+func (t *translator) scalar(expr *ast.Expr, term *ast.Term) (interface{}, error) {
+	v, ok := datafilter.Scalar(term)
+	if !ok {
+		return nil, datafilter.Unsupported(expr.Location, "%v %v cannot be translated: %v", ast.TypeName(term.Value), term, expr)
+	}
+	return v, nil
+}
+
+func (t *translator) bind(v interface{}) string {
+	t.args = append(t.args, v)
+	if t.dialect == Postgres {
+		return fmt.Sprintf("$%d", len(t.args))
+	}
+	return "?"
+}
+
+func (t *translator) quote(ident string) string {
+	if t.dialect == MySQL {
+		return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+var globEscaper = strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]")
+
+func escapeGlob(s string) string {
+	return globEscaper.Replace(s)
+}
@@ -0,0 +1,333 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/datafilter"
+	"github.com/meta-quick/opax/rego"
+)
+
+var documentsTable = Table{
+	Name:    "documents",
+	Unknown: "input.document",
+}
+
+func partial(t *testing.T, module string, input string) *rego.PartialQueries {
+	t.Helper()
+
+	pq, err := rego.New(
+		rego.Query("data.filters.allow == true"),
+		rego.Module("test.rego", module),
+		rego.ParsedInput(ast.MustParseTerm(input).Value),
+		rego.Unknowns([]string{"input.document"}),
+	).Partial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pq
+}
+
+func TestTranslateWhere(t *testing.T) {
+
+	tests := []struct {
+		note   string
+		module string
+		input  string
+		where  string
+	}{
+		{
+			note: "equality",
+			module: `package filters
+				allow { input.document.owner == input.subject }`,
+			input: `{"subject": "alice"}`,
+			where: `"documents"."owner" = ?`,
+		},
+		{
+			note: "unification with constant on the left",
+			module: `package filters
+				allow { input.subject = input.document.owner }`,
+			input: `{"subject": "bob"}`,
+			where: `"documents"."owner" = ?`,
+		},
+		{
+			note: "not equal",
+			module: `package filters
+				allow { input.document.owner != "alice" }`,
+			input: `{}`,
+			where: `"documents"."owner" <> ?`,
+		},
+		{
+			note: "comparison",
+			module: `package filters
+				allow { input.document.level <= input.clearance }`,
+			input: `{"clearance": 2}`,
+			where: `"documents"."level" <= ?`,
+		},
+		{
+			note: "comparison with constant on the left",
+			module: `package filters
+				allow { 3 < input.document.level }`,
+			input: `{}`,
+			where: `"documents"."level" > ?`,
+		},
+		{
+			note: "startswith",
+			module: `package filters
+				allow { startswith(input.document.path, "/finance/") }`,
+			input: `{}`,
+			where: `"documents"."path" GLOB ?`,
+		},
+		{
+			note: "startswith escapes wildcards",
+			module: `package filters
+				allow { startswith(input.document.path, "/legal/100%_") }`,
+			input: `{}`,
+			where: `"documents"."path" GLOB ?`,
+		},
+		{
+			note: "set membership",
+			module: `package filters
+				import future.keywords.in
+				allow { input.document.kind in {"memo", "sheet"} }`,
+			input: `{}`,
+			where: `"documents"."kind" IN (?, ?)`,
+		},
+		{
+			note: "conjunction",
+			module: `package filters
+				allow {
+					input.document.owner == input.subject
+					input.document.level > 1
+				}`,
+			input: `{"subject": "alice"}`,
+			where: `("documents"."owner" = ?) AND ("documents"."level" > ?)`,
+		},
+		{
+			note: "disjunction",
+			module: `package filters
+				allow { input.document.owner == input.subject }
+				allow { input.document.public }`,
+			input: `{"subject": "carol"}`,
+			where: `("documents"."owner" = ?) OR ("documents"."public" = ?)`,
+		},
+		{
+			note: "negation",
+			module: `package filters
+				allow {
+					input.document.public
+					not input.document.deleted
+				}`,
+			input: `{}`,
+			where: `("documents"."public" = ?) AND (NOT ("documents"."deleted" = ?))`,
+		},
+		{
+			note: "unconditional",
+			module: `package filters
+				allow { input.subject == "admin" }`,
+			input: `{"subject": "admin"}`,
+			where: `1 = 1`,
+		},
+		{
+			note: "never",
+			module: `package filters
+				allow { input.subject == "admin" }`,
+			input: `{"subject": "guest"}`,
+			where: `1 = 0`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			result, err := Translate(partial(t, tc.module, tc.input), Options{
+				Dialect: SQLite,
+				Tables:  []Table{documentsTable},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Where != tc.where {
+				t.Fatalf("expected where clause:\n\n%v\n\ngot:\n\n%v", tc.where, result.Where)
+			}
+		})
+	}
+}
+
+func TestTranslateNull(t *testing.T) {
+
+	pq := &rego.PartialQueries{
+		Queries: []ast.Body{
+			ast.MustParseBody(`input.document.reviewer = null; input.document.owner != null`),
+		},
+	}
+
+	result, err := Translate(pq, Options{Dialect: SQLite, Tables: []Table{documentsTable}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `("documents"."reviewer" IS NULL) AND ("documents"."owner" IS NOT NULL)`
+	if result.Where != exp {
+		t.Fatalf("expected %v but got %v", exp, result.Where)
+	}
+}
+
+func TestTranslateDialects(t *testing.T) {
+
+	pq := &rego.PartialQueries{
+		Queries: []ast.Body{
+			ast.MustParseBody(`input.document.meta.owner = "alice"; startswith(input.document.path, "/a_b")`),
+			ast.MustParseBody(`input.document.level > 3`),
+		},
+	}
+
+	table := Table{
+		Name:    "docs",
+		Unknown: "input.document",
+		Columns: map[string]string{
+			"meta.owner": "owner_id",
+			"path":       "path",
+			"level":      "level",
+		},
+	}
+
+	tests := []struct {
+		dialect Dialect
+		where   string
+	}{
+		{
+			dialect: Postgres,
+			where:   `(("docs"."owner_id" = $1) AND ("docs"."path" LIKE $2 ESCAPE '!')) OR ("docs"."level" > $3)`,
+		},
+		{
+			dialect: MySQL,
+			where:   "((`docs`.`owner_id` = ?) AND (`docs`.`path` LIKE ? ESCAPE '!')) OR (`docs`.`level` > ?)",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.dialect), func(t *testing.T) {
+			result, err := Translate(pq, Options{Dialect: tc.dialect, Tables: []Table{table}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Where != tc.where {
+				t.Fatalf("expected where clause:\n\n%v\n\ngot:\n\n%v", tc.where, result.Where)
+			}
+
+			expArgs := []interface{}{"alice", "/a!_b%", int64(3)}
+			if !reflect.DeepEqual(result.Args, expArgs) {
+				t.Fatalf("expected args %v but got %v", expArgs, result.Args)
+			}
+		})
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		query   string
+		support string
+		opts    *Options
+		code    string
+		message string
+	}{
+		{
+			note:    "unsupported built-in",
+			query:   `contains(input.document.path, "x")`,
+			code:    datafilter.UnsupportedErr,
+			message: "built-in function contains cannot be translated",
+		},
+		{
+			note:    "unmapped column",
+			query:   `input.document.secret = 1`,
+			opts:    &Options{Tables: []Table{{Name: "documents", Unknown: "input.document", Columns: map[string]string{"owner": "owner"}}}},
+			code:    datafilter.UnsupportedErr,
+			message: "reference input.document.secret is not mapped onto a column of table documents",
+		},
+		{
+			note:    "reference outside of tables",
+			query:   `input.other.owner = "alice"`,
+			code:    datafilter.UnsupportedErr,
+			message: "reference input.other.owner is not covered by any table",
+		},
+		{
+			note:    "variables",
+			query:   `input.document.tags[x] = "a"`,
+			code:    datafilter.UnsupportedErr,
+			message: "reference input.document.tags[x] is not mapped onto a column of table documents",
+		},
+		{
+			note:    "composite constant",
+			query:   `input.document.owner = ["alice"]`,
+			code:    datafilter.UnsupportedErr,
+			message: `array ["alice"] cannot be translated`,
+		},
+		{
+			note:    "with modifier",
+			query:   `input.document.owner = "alice" with input.x as 1`,
+			code:    datafilter.UnsupportedErr,
+			message: "with modifiers cannot be translated",
+		},
+		{
+			note:    "support modules",
+			query:   `input.document.owner = "alice"`,
+			support: `package partial.filters allow { input.document.public }`,
+			code:    datafilter.UnsupportedErr,
+			message: "support modules cannot be translated (package data.partial.filters)",
+		},
+		{
+			note:    "unknown dialect",
+			query:   `input.document.owner = "alice"`,
+			opts:    &Options{Dialect: "oracle", Tables: []Table{documentsTable}},
+			code:    datafilter.ConfigErr,
+			message: `unknown dialect "oracle"`,
+		},
+		{
+			note:    "no tables",
+			query:   `input.document.owner = "alice"`,
+			opts:    &Options{},
+			code:    datafilter.ConfigErr,
+			message: "at least one table must be declared",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			pq := &rego.PartialQueries{
+				Queries: []ast.Body{ast.MustParseBody(tc.query)},
+			}
+
+			if tc.support != "" {
+				pq.Support = []*ast.Module{ast.MustParseModule(tc.support)}
+			}
+
+			opts := Options{Tables: []Table{documentsTable}}
+			if tc.opts != nil {
+				opts = *tc.opts
+			}
+
+			_, err := Translate(pq, opts)
+			if !datafilter.IsError(tc.code, err) {
+				t.Fatalf("expected %v error but got: %v", tc.code, err)
+			}
+
+			if !strings.Contains(err.Error(), tc.message) {
+				t.Fatalf("expected error to contain %q but got: %v", tc.message, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package sqlitetest runs the SQL translations of partial evaluation results
+// against SQLite. It is a separate module so that the SQLite driver is not a
+// dependency of OPA.
+package sqlitetest
+
+import (
+	"context"
+	dbsql "database/sql"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/datafilter/sql"
+	"github.com/meta-quick/opax/rego"
+
+	_ "modernc.org/sqlite"
+)
+
+type document struct {
+	ID      int
+	Owner   string
+	Path    string
+	Level   int
+	Kind    string
+	Public  bool
+	Deleted bool
+}
+
+var documents = []document{
+	{1, "alice", "/finance/q1", 1, "report", false, false},
+	{2, "alice", "/finance/q2", 3, "memo", false, true},
+	{3, "bob", "/hr/salaries", 5, "report", false, false},
+	{4, "bob", "/finance_old/q4", 2, "sheet", true, false},
+	{5, "carol", "/FINANCE/q3", 4, "memo", false, false},
+	{6, "dave", "/hr/holidays", 1, "sheet", true, true},
+	{7, "erin", "/legal/100%_done", 2, "report", false, false},
+}
+
+func openDB(t *testing.T) *dbsql.DB {
+	t.Helper()
+
+	db, err := dbsql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE documents (
+		id INTEGER PRIMARY KEY,
+		owner TEXT,
+		path TEXT,
+		level INTEGER,
+		kind TEXT,
+		public BOOLEAN,
+		deleted BOOLEAN,
+		reviewer TEXT
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range documents {
+		_, err := db.Exec(`INSERT INTO documents VALUES (?, ?, ?, ?, ?, ?, ?, NULL)`,
+			d.ID, d.Owner, d.Path, d.Level, d.Kind, d.Public, d.Deleted)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+var documentsTable = sql.Table{
+	Name:    "documents",
+	Unknown: "input.document",
+}
+
+func partial(t *testing.T, module string, input string) *rego.PartialQueries {
+	t.Helper()
+
+	pq, err := rego.New(
+		rego.Query("data.filters.allow == true"),
+		rego.Module("test.rego", module),
+		rego.ParsedInput(ast.MustParseTerm(input).Value),
+		rego.Unknowns([]string{"input.document"}),
+	).Partial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pq
+}
+
+// allowed returns the IDs of the documents the policy allows by evaluating
+// the policy against each document in turn.
+func allowed(t *testing.T, module string, input string) []int {
+	t.Helper()
+
+	var ids []int
+
+	for _, d := range documents {
+
+		in := ast.MustParseTerm(input)
+		doc := ast.MustInterfaceToValue(map[string]interface{}{
+			"owner":   d.Owner,
+			"path":    d.Path,
+			"level":   d.Level,
+			"kind":    d.Kind,
+			"public":  d.Public,
+			"deleted": d.Deleted,
+		})
+
+		in.Value.(ast.Object).Insert(ast.StringTerm("document"), ast.NewTerm(doc))
+
+		rs, err := rego.New(
+			rego.Query("data.filters.allow == true"),
+			rego.Module("test.rego", module),
+			rego.ParsedInput(in.Value),
+		).Eval(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rs) > 0 {
+			ids = append(ids, d.ID)
+		}
+	}
+
+	return ids
+}
+
+func query(t *testing.T, db *dbsql.DB, result *sql.Result) []int {
+	t.Helper()
+
+	rows, err := db.Query("SELECT id FROM documents WHERE "+result.Where, result.Args...)
+	if err != nil {
+		t.Fatalf("query failed: %v\nwhere: %v", err, result.Where)
+	}
+	defer rows.Close()
+
+	var ids []int
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+func TestTranslateSQLite(t *testing.T) {
+
+	tests := []struct {
+		note   string
+		module string
+		input  string
+	}{
+		{
+			note: "equality",
+			module: `package filters
+				allow { input.document.owner == input.subject }`,
+			input: `{"subject": "alice"}`,
+		},
+		{
+			note: "unification with constant on the left",
+			module: `package filters
+				allow { input.subject = input.document.owner }`,
+			input: `{"subject": "bob"}`,
+		},
+		{
+			note: "not equal",
+			module: `package filters
+				allow { input.document.owner != "alice" }`,
+			input: `{}`,
+		},
+		{
+			note: "comparison",
+			module: `package filters
+				allow { input.document.level <= input.clearance }`,
+			input: `{"clearance": 2}`,
+		},
+		{
+			note: "comparison with constant on the left",
+			module: `package filters
+				allow { 3 < input.document.level }`,
+			input: `{}`,
+		},
+		{
+			note: "startswith",
+			module: `package filters
+				allow { startswith(input.document.path, "/finance/") }`,
+			input: `{}`,
+		},
+		{
+			note: "startswith escapes wildcards",
+			module: `package filters
+				allow { startswith(input.document.path, "/legal/100%_") }`,
+			input: `{}`,
+		},
+		{
+			note: "set membership",
+			module: `package filters
+				import future.keywords.in
+				allow { input.document.kind in {"memo", "sheet"} }`,
+			input: `{}`,
+		},
+		{
+			note: "conjunction",
+			module: `package filters
+				allow {
+					input.document.owner == input.subject
+					input.document.level > 1
+				}`,
+			input: `{"subject": "alice"}`,
+		},
+		{
+			note: "disjunction",
+			module: `package filters
+				allow { input.document.owner == input.subject }
+				allow { input.document.public }`,
+			input: `{"subject": "carol"}`,
+		},
+		{
+			note: "negation",
+			module: `package filters
+				allow {
+					input.document.public
+					not input.document.deleted
+				}`,
+			input: `{}`,
+		},
+		{
+			note: "unconditional",
+			module: `package filters
+				allow { input.subject == "admin" }`,
+			input: `{"subject": "admin"}`,
+		},
+		{
+			note: "never",
+			module: `package filters
+				allow { input.subject == "admin" }`,
+			input: `{"subject": "guest"}`,
+		},
+	}
+
+	db := openDB(t)
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			result, err := sql.Translate(partial(t, tc.module, tc.input), sql.Options{
+				Dialect: sql.SQLite,
+				Tables:  []sql.Table{documentsTable},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			exp := allowed(t, tc.module, tc.input)
+			if got := query(t, db, result); !reflect.DeepEqual(exp, got) {
+				t.Fatalf("expected rows %v but got %v (where: %v, args: %v)", exp, got, result.Where, result.Args)
+			}
+		})
+	}
+}
+
+func TestTranslateNull(t *testing.T) {
+
+	pq := &rego.PartialQueries{
+		Queries: []ast.Body{
+			ast.MustParseBody(`input.document.reviewer = null; input.document.owner != null`),
+		},
+	}
+
+	result, err := sql.Translate(pq, sql.Options{Dialect: sql.SQLite, Tables: []sql.Table{documentsTable}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := query(t, openDB(t), result); len(got) != len(documents) {
+		t.Fatalf("expected all rows but got %v", got)
+	}
+}
@@ -58,6 +58,7 @@ type Downloader struct {
 	etag               string                        // HTTP Etag for caching purposes
 	sizeLimitBytes     *int64                        // max bundle file size in bytes (passed to reader)
 	bvc                *bundle.VerificationConfig
+	dc                 *bundle.DecryptionConfig
 	respHdrTimeoutSec  int64
 	wg                 sync.WaitGroup
 	logger             logging.Logger
@@ -65,6 +66,9 @@ type Downloader struct {
 	stopped            bool
 	persist            bool
 	longPollingEnabled bool
+	blobCacheDir       string // directory to cache OCI blobs in
+	ociLayer           string // digest of the bundle layer of the last downloaded OCI manifest
+	ociToken           string // bearer token issued by the OCI registry
 }
 
 type downloaderResponse struct {
@@ -106,6 +110,12 @@ func (d *Downloader) WithBundleVerificationConfig(config *bundle.VerificationCon
 	return d
 }
 
+// WithDecryptionConfig sets the key configuration used to decrypt an encrypted bundle
+func (d *Downloader) WithDecryptionConfig(config *bundle.DecryptionConfig) *Downloader {
+	d.dc = config
+	return d
+}
+
 // WithSizeLimitBytes sets the file size limit for bundles read by this downloader.
 func (d *Downloader) WithSizeLimitBytes(n int64) *Downloader {
 	d.sizeLimitBytes = &n
@@ -118,6 +128,14 @@ func (d *Downloader) WithBundlePersistence(persist bool) *Downloader {
 	return d
 }
 
+// WithBlobCacheDir sets the directory that blobs downloaded from OCI
+// registries are cached in. Cached blobs are reused when the process
+// restarts. Blobs of previous bundles are removed by PruneBlobCache.
+func (d *Downloader) WithBlobCacheDir(dir string) *Downloader {
+	d.blobCacheDir = dir
+	return d
+}
+
 // ClearCache is deprecated. Use SetCache instead.
 func (d *Downloader) ClearCache() {
 	d.etag = ""
@@ -258,6 +276,10 @@ func (d *Downloader) oneShot(ctx context.Context) error {
 }
 
 func (d *Downloader) download(ctx context.Context, m metrics.Metrics) (*downloaderResponse, error) {
+	if d.client.Config().Type == rest.ServiceTypeOCI {
+		return d.downloadOCI(ctx, m)
+	}
+
 	d.logger.Debug("Download starting.")
 
 	d.client = d.client.WithHeader("If-None-Match", d.etag)
@@ -307,7 +329,7 @@ func (d *Downloader) download(ctx context.Context, m metrics.Metrics) (*download
 				loader = bundle.NewTarballLoaderWithBaseURL(resp.Body, baseURL)
 			}
 
-			reader := bundle.NewCustomReader(loader).WithMetrics(m).WithBundleVerificationConfig(d.bvc)
+			reader := bundle.NewCustomReader(loader).WithMetrics(m).WithBundleVerificationConfig(d.bvc).WithDecryptionConfig(d.dc)
 			if d.sizeLimitBytes != nil {
 				reader = reader.WithSizeLimitBytes(*d.sizeLimitBytes)
 			}
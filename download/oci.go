@@ -0,0 +1,519 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/util"
+)
+
+const (
+	ociImageManifestMediaType   = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestMediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+	ociBundleLayerMediaType     = "application/vnd.openpolicyagent.layer.v1.tar+gzip"
+	ociTarGzipLayerMediaType    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	dockerTarGzipLayerMediaType = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+
+	ociDefaultTag = "latest"
+
+	// maxOCIManifestBytes bounds the size of manifests read from registries.
+	// Bundle manifests are small; anything larger is not a bundle.
+	maxOCIManifestBytes = 4 << 20
+)
+
+// ociReference identifies a manifest in a repository by tag or digest.
+type ociReference struct {
+	repository string
+	tag        string
+	digest     string
+}
+
+func (r ociReference) String() string {
+	if r.digest != "" {
+		return r.repository + "@" + r.digest
+	}
+	return r.repository + ":" + r.tag
+}
+
+// ref returns the tag or digest to request from the registry.
+func (r ociReference) ref() string {
+	if r.digest != "" {
+		return r.digest
+	}
+	return r.tag
+}
+
+// parseOCIReference parses a bundle resource of the form <repository>[:<tag>]
+// or <repository>@<digest>. If neither a tag nor a digest is given, the
+// "latest" tag is used.
+func parseOCIReference(resource string) (ociReference, error) {
+
+	var r ociReference
+	s := strings.Trim(resource, "/")
+
+	if i := strings.Index(s, "@"); i != -1 {
+		r.repository, r.digest = s[:i], s[i+1:]
+		if _, _, err := parseOCIDigest(r.digest); err != nil {
+			return r, err
+		}
+	} else if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "/") {
+		r.repository, r.tag = s[:i], s[i+1:]
+	} else {
+		r.repository, r.tag = s, ociDefaultTag
+	}
+
+	if r.repository == "" || (r.digest == "" && r.tag == "") {
+		return r, fmt.Errorf("invalid OCI reference %q", resource)
+	}
+
+	return r, nil
+}
+
+// parseOCIDigest returns the hash function and the hex encoded checksum of
+// digest.
+func parseOCIDigest(digest string) (hash.Hash, string, error) {
+
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 {
+		return nil, "", fmt.Errorf("invalid digest %q", digest)
+	}
+
+	var h hash.Hash
+	switch parts[0] {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, "", fmt.Errorf("unsupported digest algorithm %q", parts[0])
+	}
+
+	if _, err := hex.DecodeString(parts[1]); err != nil || len(parts[1]) != 2*h.Size() {
+		return nil, "", fmt.Errorf("invalid digest %q", digest)
+	}
+
+	return h, parts[1], nil
+}
+
+// verifyOCIDigest returns an error if bs does not match digest.
+func verifyOCIDigest(digest string, bs []byte) error {
+	h, expected, err := parseOCIDigest(digest)
+	if err != nil {
+		return err
+	}
+	h.Write(bs)
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf("digest mismatch (expected %v but got %v:%v)", digest, strings.SplitN(digest, ":", 2)[0], actual)
+	}
+	return nil
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// bundleLayer returns the manifest layer that contains the bundle. Layers
+// with the OPA bundle media type are preferred. Otherwise, the manifest must
+// contain exactly one gzipped tarball layer.
+func (m ociManifest) bundleLayer() (ociDescriptor, error) {
+
+	var candidates []ociDescriptor
+
+	for _, l := range m.Layers {
+		switch l.MediaType {
+		case ociBundleLayerMediaType:
+			return l, nil
+		case ociTarGzipLayerMediaType, dockerTarGzipLayerMediaType:
+			candidates = append(candidates, l)
+		}
+	}
+
+	if len(candidates) != 1 {
+		return ociDescriptor{}, fmt.Errorf("manifest must contain one %v layer or exactly one %v layer", ociBundleLayerMediaType, ociTarGzipLayerMediaType)
+	}
+
+	return candidates[0], nil
+}
+
+// downloadOCI fetches the bundle referred to by the downloader path from an
+// OCI registry. The manifest digest is used as the ETag: if the tag resolves
+// to the same manifest as the last successful download, the bundle layer is
+// not fetched again.
+func (d *Downloader) downloadOCI(ctx context.Context, m metrics.Metrics) (*downloaderResponse, error) {
+	d.logger.Debug("Download starting.")
+
+	ref, err := parseOCIReference(d.path)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Timer(metrics.BundleRequest).Start()
+	manifest, digest, err := d.ociManifest(ctx, ref)
+	m.Timer(metrics.BundleRequest).Stop()
+	if err != nil {
+		return nil, err
+	}
+
+	if digest == d.etag {
+		d.logger.Debug("Manifest digest unchanged (%v).", digest)
+		return &downloaderResponse{etag: digest}, nil
+	}
+
+	layer, err := manifest.bundleLayer()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%v", ref)
+	}
+
+	m.Timer(metrics.BundleRequest).Start()
+	blob, err := d.ociBlob(ctx, ref, layer)
+	m.Timer(metrics.BundleRequest).Stop()
+	if err != nil {
+		return nil, err
+	}
+
+	d.ociLayer = layer.Digest
+
+	d.logger.Debug("Download in progress.")
+	m.Timer(metrics.RegoLoadBundles).Start()
+	defer m.Timer(metrics.RegoLoadBundles).Stop()
+
+	baseURL := d.client.Config().URL + "/" + ref.repository
+	loader := bundle.NewTarballLoaderWithBaseURL(bytes.NewReader(blob), baseURL)
+	reader := bundle.NewCustomReader(loader).WithMetrics(m).WithBundleVerificationConfig(d.bvc).WithDecryptionConfig(d.dc)
+	if d.sizeLimitBytes != nil {
+		reader = reader.WithSizeLimitBytes(*d.sizeLimitBytes)
+	}
+
+	b, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	var raw bytes.Buffer
+	if d.persist {
+		raw.Write(blob)
+	}
+
+	return &downloaderResponse{
+		b:    &b,
+		raw:  &raw,
+		etag: digest,
+	}, nil
+}
+
+// ociManifest fetches the manifest for ref and returns it along with its
+// digest. If ref is a digest, or the registry reports the digest, the manifest
+// content is verified against it.
+func (d *Downloader) ociManifest(ctx context.Context, ref ociReference) (ociManifest, string, error) {
+
+	var manifest ociManifest
+
+	accept := strings.Join([]string{ociImageManifestMediaType, dockerManifestMediaType}, ", ")
+	resp, err := d.ociDo(ctx, ref, "v2/"+ref.repository+"/manifests/"+ref.ref(), accept)
+	if err != nil {
+		return manifest, "", err
+	}
+
+	defer util.Close(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return manifest, "", errors.Wrapf(HTTPError{StatusCode: resp.StatusCode}, "manifest %v", ref)
+	}
+
+	bs, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOCIManifestBytes+1))
+	if err != nil {
+		return manifest, "", err
+	} else if len(bs) > maxOCIManifestBytes {
+		return manifest, "", fmt.Errorf("manifest %v exceeds %d bytes", ref, maxOCIManifestBytes)
+	}
+
+	digest := ref.digest
+	if digest == "" {
+		digest = resp.Header.Get("Docker-Content-Digest")
+	}
+
+	if digest == "" {
+		sum := sha256.Sum256(bs)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	} else if err := verifyOCIDigest(digest, bs); err != nil {
+		return manifest, "", errors.Wrapf(err, "manifest %v", ref)
+	}
+
+	if err := json.Unmarshal(bs, &manifest); err != nil {
+		return manifest, "", errors.Wrapf(err, "manifest %v", ref)
+	}
+
+	return manifest, digest, nil
+}
+
+// ociBlob returns the content of the layer. If a blob cache directory is set,
+// the layer is read from the cache when present and written to it after a
+// successful download. Cached and downloaded content is always verified
+// against the layer digest.
+func (d *Downloader) ociBlob(ctx context.Context, ref ociReference, layer ociDescriptor) ([]byte, error) {
+
+	if _, _, err := parseOCIDigest(layer.Digest); err != nil {
+		return nil, errors.Wrapf(err, "layer %v", ref)
+	}
+
+	var cached string
+	if d.blobCacheDir != "" {
+		parts := strings.SplitN(layer.Digest, ":", 2)
+		cached = filepath.Join(d.blobCacheDir, "blobs", parts[0], parts[1])
+		if bs, err := ioutil.ReadFile(cached); err == nil {
+			if err := verifyOCIDigest(layer.Digest, bs); err == nil {
+				d.logger.Debug("Using cached blob %v.", layer.Digest)
+				return bs, nil
+			}
+			d.logger.Warn("Ignoring corrupt cached blob %v.", layer.Digest)
+		}
+	}
+
+	resp, err := d.ociDo(ctx, ref, "v2/"+ref.repository+"/blobs/"+layer.Digest, "*/*")
+	if err != nil {
+		return nil, err
+	}
+
+	defer util.Close(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(HTTPError{StatusCode: resp.StatusCode}, "blob %v", layer.Digest)
+	}
+
+	bs, err := ioutil.ReadAll(io.LimitReader(resp.Body, layer.Size+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(bs)) != layer.Size {
+		return nil, fmt.Errorf("blob %v: size mismatch (expected %d bytes)", layer.Digest, layer.Size)
+	} else if err := verifyOCIDigest(layer.Digest, bs); err != nil {
+		return nil, errors.Wrapf(err, "blob %v", layer.Digest)
+	}
+
+	if cached != "" {
+		if err := writeFileAtomic(cached, bs); err != nil {
+			d.logger.Warn("Failed to cache blob %v: %v", layer.Digest, err)
+		}
+	}
+
+	return bs, nil
+}
+
+// PruneBlobCache removes the cached blobs other than the bundle layer of the
+// last downloaded OCI manifest. It should be called from the update callback
+// once the downloaded bundle has been activated, so that the blob cache does
+// not keep every revision that was ever downloaded.
+func (d *Downloader) PruneBlobCache() error {
+
+	if d.blobCacheDir == "" || d.ociLayer == "" {
+		return nil
+	}
+
+	parts := strings.SplitN(d.ociLayer, ":", 2)
+	keep := filepath.Join(d.blobCacheDir, "blobs", parts[0], parts[1])
+
+	return filepath.Walk(filepath.Join(d.blobCacheDir, "blobs"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || path == keep {
+			return nil
+		}
+		d.logger.Debug("Removing cached blob %v.", path)
+		return os.Remove(path)
+	})
+}
+
+// ociDo sends a GET request for path to the registry. If the registry
+// challenges the request with a bearer token scheme (as most public
+// registries do), a token is obtained from the registry's token server and
+// the request is retried. The token is reused for subsequent requests until
+// it is rejected.
+func (d *Downloader) ociDo(ctx context.Context, ref ociReference, path, accept string) (*http.Response, error) {
+
+	resp, err := d.ociClientDo(ctx, path, accept)
+	if err != nil {
+		return nil, errors.Wrap(err, "request failed")
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	util.Close(resp)
+
+	if err := d.ociRefreshToken(ctx, ref, challenge); err != nil {
+		return nil, err
+	}
+
+	resp, err = d.ociClientDo(ctx, path, accept)
+	if err != nil {
+		return nil, errors.Wrap(err, "request failed")
+	}
+
+	return resp, nil
+}
+
+func (d *Downloader) ociClientDo(ctx context.Context, path, accept string) (*http.Response, error) {
+	client := d.client.WithHeader("Accept", accept)
+	if d.ociToken != "" {
+		client = client.WithHeader("Authorization", "Bearer "+d.ociToken)
+	}
+	return client.Do(ctx, "GET", path)
+}
+
+// ociRefreshToken obtains a registry token as described by the bearer
+// challenge. The request to the token server includes the headers configured
+// on the service (e.g., basic authentication credentials.)
+func (d *Downloader) ociRefreshToken(ctx context.Context, ref ociReference, challenge string) error {
+
+	d.ociToken = ""
+
+	params, ok := parseBearerChallenge(challenge)
+	if !ok || params["realm"] == "" {
+		return errors.Wrapf(HTTPError{StatusCode: http.StatusUnauthorized}, "%v", ref)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return errors.Wrap(err, "invalid token realm")
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + ref.repository + ":pull"
+	}
+	query.Set("scope", scope)
+
+	client := d.client.WithURL(realm.Scheme+"://"+realm.Host).WithHeader("Accept", "application/json")
+	resp, err := client.Do(ctx, "GET", realm.Path+"?"+query.Encode())
+	if err != nil {
+		return errors.Wrap(err, "token request failed")
+	}
+
+	defer util.Close(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrap(HTTPError{StatusCode: resp.StatusCode}, "token request failed")
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return errors.Wrap(err, "token request failed")
+	}
+
+	d.ociToken = token.Token
+	if d.ociToken == "" {
+		d.ociToken = token.AccessToken
+	}
+
+	if d.ociToken == "" {
+		return errors.New("token request failed: token server returned empty token")
+	}
+
+	return nil
+}
+
+// parseBearerChallenge parses a WWW-Authenticate header value of the form:
+//
+//	Bearer realm="https://auth.example.com/token",service="example.com",scope="..."
+func parseBearerChallenge(challenge string) (map[string]string, bool) {
+
+	const scheme = "bearer "
+
+	if len(challenge) < len(scheme) || !strings.EqualFold(challenge[:len(scheme)], scheme) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	s := strings.TrimSpace(challenge[len(scheme):])
+
+	for s != "" {
+		eq := strings.Index(s, "=")
+		if eq == -1 {
+			return nil, false
+		}
+
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimSpace(s[eq+1:])
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end == -1 {
+				return nil, false
+			}
+			value, s = s[1:end+1], s[end+2:]
+		} else if comma := strings.Index(s, ","); comma != -1 {
+			value, s = s[:comma], s[comma:]
+		} else {
+			value, s = s, ""
+		}
+
+		params[key] = strings.TrimSpace(value)
+		s = strings.TrimLeft(strings.TrimSpace(s), ",")
+		s = strings.TrimSpace(s)
+	}
+
+	return params, true
+}
+
+func writeFileAtomic(path string, bs []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,526 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/keys"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/plugins/rest"
+	"github.com/meta-quick/opax/util/test"
+)
+
+func TestParseOCIReference(t *testing.T) {
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	tests := []struct {
+		input string
+		exp   ociReference
+		err   string
+	}{
+		{input: "org/policy:v1", exp: ociReference{repository: "org/policy", tag: "v1"}},
+		{input: "/org/policy", exp: ociReference{repository: "org/policy", tag: "latest"}},
+		{input: "org/policy@" + digest, exp: ociReference{repository: "org/policy", digest: digest}},
+		{input: "localhost:5000/policy", exp: ociReference{repository: "localhost:5000/policy", tag: "latest"}},
+		{input: "org/policy:", err: "invalid OCI reference"},
+		{input: "org/policy@md5:abc", err: "unsupported digest algorithm"},
+		{input: "org/policy@sha256:abc", err: "invalid digest"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			ref, err := parseOCIReference(tc.input)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Expected error containing %q but got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ref != tc.exp {
+				t.Fatalf("Expected %#v but got %#v", tc.exp, ref)
+			}
+		})
+	}
+}
+
+func TestParseBearerChallenge(t *testing.T) {
+
+	params, ok := parseBearerChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com", scope="repository:org/policy:pull,push"`)
+	if !ok {
+		t.Fatal("Expected challenge to parse")
+	}
+
+	exp := map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:org/policy:pull,push",
+	}
+
+	if !reflect.DeepEqual(params, exp) {
+		t.Fatalf("Expected %v but got %v", exp, params)
+	}
+
+	if _, ok := parseBearerChallenge(`Basic realm="registry"`); ok {
+		t.Fatal("Expected basic challenge to be rejected")
+	}
+}
+
+func TestOCIDownload(t *testing.T) {
+
+	ctx := context.Background()
+	reg := newTestRegistry(t)
+	defer reg.server.Close()
+
+	reg.push("org/policy", "v1", bundleFixture("v1"))
+
+	var updates []Update
+	d := New(Config{}, reg.client(t, ""), "org/policy:v1").WithCallback(func(_ context.Context, u Update) { updates = append(updates, u) })
+
+	if err := d.oneShot(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if updates[0].Bundle == nil || updates[0].Bundle.Manifest.Revision != "v1" {
+		t.Fatalf("Expected bundle with revision v1 but got: %v", updates[0])
+	}
+
+	if exp := reg.digest("org/policy", "v1"); updates[0].ETag != exp {
+		t.Fatalf("Expected ETag %v but got %v", exp, updates[0].ETag)
+	}
+
+	if !strings.HasSuffix(updates[0].Bundle.Modules[0].URL, "/org/policy/example.rego") {
+		t.Fatalf("Expected module URL to refer to repository but got %v", updates[0].Bundle.Modules[0].URL)
+	}
+
+	// Unchanged tags must not be downloaded again.
+	if err := d.oneShot(ctx); err != nil {
+		t.Fatal(err)
+	} else if updates[1].Bundle != nil || updates[1].ETag != updates[0].ETag {
+		t.Fatalf("Expected unchanged update but got: %v", updates[1])
+	} else if n := reg.blobRequests(); n != 1 {
+		t.Fatalf("Expected 1 blob request but got %d", n)
+	}
+
+	// Moving the tag must result in a new bundle.
+	reg.push("org/policy", "v1", bundleFixture("v2"))
+
+	if err := d.oneShot(ctx); err != nil {
+		t.Fatal(err)
+	} else if updates[2].Bundle == nil || updates[2].Bundle.Manifest.Revision != "v2" {
+		t.Fatalf("Expected bundle with revision v2 but got: %v", updates[2])
+	}
+}
+
+func TestOCIDownloadByDigest(t *testing.T) {
+
+	ctx := context.Background()
+	reg := newTestRegistry(t)
+	defer reg.server.Close()
+
+	reg.push("org/policy", "v1", bundleFixture("v1"))
+	digest := reg.digest("org/policy", "v1")
+
+	d := New(Config{}, reg.client(t, ""), "org/policy@"+digest)
+
+	resp, err := d.downloadOCI(ctx, metrics.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.etag != digest || resp.b == nil {
+		t.Fatalf("Expected bundle with ETag %v but got: %+v", digest, resp)
+	}
+}
+
+func TestOCIDownloadVerifiesDigests(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		note    string
+		corrupt func(*testRegistry)
+		exp     string
+	}{
+		{
+			note: "manifest digest header",
+			corrupt: func(reg *testRegistry) {
+				reg.digestHeader = "sha256:" + strings.Repeat("0", 64)
+			},
+			exp: "manifest org/policy:v1: digest mismatch",
+		},
+		{
+			note: "blob content",
+			corrupt: func(reg *testRegistry) {
+				for _, v := range reg.blobs {
+					v[len(v)-1] ^= 0xff
+				}
+			},
+			exp: "digest mismatch",
+		},
+		{
+			note: "blob size",
+			corrupt: func(reg *testRegistry) {
+				for k, v := range reg.blobs {
+					reg.blobs[k] = append(v, 0)
+				}
+			},
+			exp: "size mismatch",
+		},
+		{
+			note: "missing blob",
+			corrupt: func(reg *testRegistry) {
+				reg.blobs = map[string][]byte{}
+			},
+			exp: "server replied with Not Found",
+		},
+		{
+			note: "missing tag",
+			corrupt: func(reg *testRegistry) {
+				reg.manifests = map[string][]byte{}
+			},
+			exp: "manifest org/policy:v1: server replied with Not Found",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			reg := newTestRegistry(t)
+			defer reg.server.Close()
+
+			reg.push("org/policy", "v1", bundleFixture("v1"))
+			tc.corrupt(reg)
+
+			d := New(Config{}, reg.client(t, ""), "org/policy:v1")
+
+			_, err := d.downloadOCI(ctx, metrics.New())
+			if err == nil || !strings.Contains(err.Error(), tc.exp) {
+				t.Fatalf("Expected error containing %q but got: %v", tc.exp, err)
+			}
+		})
+	}
+}
+
+func TestOCIDownloadTokenAuth(t *testing.T) {
+
+	ctx := context.Background()
+	reg := newTestRegistry(t)
+	defer reg.server.Close()
+
+	reg.push("org/policy", "v1", bundleFixture("v1"))
+	reg.basicAuth = "Basic dXNlcjpwYXNz"
+
+	d := New(Config{}, reg.client(t, ""), "org/policy:v1")
+	if _, err := d.downloadOCI(ctx, metrics.New()); err == nil || !strings.Contains(err.Error(), "token request failed: server replied with Unauthorized") {
+		t.Fatal("Expected token request to fail without credentials but got:", err)
+	}
+
+	d = New(Config{}, reg.client(t, reg.basicAuth), "org/policy:v1")
+	if _, err := d.downloadOCI(ctx, metrics.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens are reused until the registry rejects them.
+	if n := reg.tokenRequests(); n != 2 {
+		t.Fatalf("Expected 2 token requests but got %d", n)
+	}
+
+	d.etag = ""
+	if _, err := d.downloadOCI(ctx, metrics.New()); err != nil {
+		t.Fatal(err)
+	} else if n := reg.tokenRequests(); n != 2 {
+		t.Fatalf("Expected 2 token requests but got %d", n)
+	}
+}
+
+func TestOCIDownloadBlobCache(t *testing.T) {
+
+	ctx := context.Background()
+
+	test.WithTempFS(nil, func(dir string) {
+		reg := newTestRegistry(t)
+		defer reg.server.Close()
+
+		reg.push("org/policy", "v1", bundleFixture("v1"))
+
+		d := New(Config{}, reg.client(t, ""), "org/policy:v1").WithBlobCacheDir(dir).WithBundlePersistence(true)
+		resp, err := d.downloadOCI(ctx, metrics.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := bundle.NewReader(resp.raw).Read()
+		if err != nil {
+			t.Fatal(err)
+		} else if b.Manifest.Revision != "v1" {
+			t.Fatalf("Expected raw bundle with revision v1 but got: %v", b.Manifest)
+		}
+
+		// A new downloader (e.g., after a restart) reuses the cached blob.
+		d = New(Config{}, reg.client(t, ""), "org/policy:v1").WithBlobCacheDir(dir)
+		if _, err := d.downloadOCI(ctx, metrics.New()); err != nil {
+			t.Fatal(err)
+		} else if n := reg.blobRequests(); n != 1 {
+			t.Fatalf("Expected 1 blob request but got %d", n)
+		}
+
+		// Corrupt cache entries are replaced.
+		files, err := filepath.Glob(filepath.Join(dir, "blobs", "sha256", "*"))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("Expected one cached blob but got: %v (err: %v)", files, err)
+		}
+
+		if err := os.WriteFile(files[0], []byte("corrupt"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		d = New(Config{}, reg.client(t, ""), "org/policy:v1").WithBlobCacheDir(dir)
+		if _, err := d.downloadOCI(ctx, metrics.New()); err != nil {
+			t.Fatal(err)
+		} else if n := reg.blobRequests(); n != 2 {
+			t.Fatalf("Expected 2 blob requests but got %d", n)
+		}
+
+		if bs, err := os.ReadFile(files[0]); err != nil || verifyOCIDigest("sha256:"+filepath.Base(files[0]), bs) != nil {
+			t.Fatalf("Expected cached blob to be repaired (err: %v)", err)
+		}
+	})
+}
+
+func TestOCIDownloadPruneBlobCache(t *testing.T) {
+
+	ctx := context.Background()
+
+	test.WithTempFS(nil, func(dir string) {
+		reg := newTestRegistry(t)
+		defer reg.server.Close()
+
+		d := New(Config{}, reg.client(t, ""), "org/policy:v1").WithBlobCacheDir(dir)
+
+		for _, revision := range []string{"v1", "v2"} {
+			reg.push("org/policy", "v1", bundleFixture(revision))
+			if _, err := d.downloadOCI(ctx, metrics.New()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, "blobs", "sha256", "*"))
+		if err != nil || len(files) != 2 {
+			t.Fatalf("Expected two cached blobs but got: %v (err: %v)", files, err)
+		}
+
+		// Only the blob of the last downloaded manifest is kept.
+		if err := d.PruneBlobCache(); err != nil {
+			t.Fatal(err)
+		}
+
+		files, err = filepath.Glob(filepath.Join(dir, "blobs", "sha256", "*"))
+		if err != nil || len(files) != 1 || "sha256:"+filepath.Base(files[0]) != d.ociLayer {
+			t.Fatalf("Expected only blob %v to be cached but got: %v (err: %v)", d.ociLayer, files, err)
+		}
+	})
+}
+
+func TestOCIServiceType(t *testing.T) {
+	_, err := rest.New([]byte(`{"url": "https://example.com", "type": "ftp"}`), map[string]*keys.Config{})
+	if err == nil || !strings.Contains(err.Error(), `unsupported service type "ftp"`) {
+		t.Fatal("Expected unsupported service type error but got:", err)
+	}
+}
+
+func bundleFixture(revision string) bundle.Bundle {
+	return bundle.Bundle{
+		Manifest: bundle.Manifest{
+			Revision: revision,
+		},
+		Data: map[string]interface{}{
+			"revision": revision,
+		},
+		Modules: []bundle.ModuleFile{
+			{
+				Path: "/example.rego",
+				Raw:  []byte("package example\n\np = true"),
+			},
+		},
+	}
+}
+
+// testRegistry is a minimal in-process implementation of the OCI
+// distribution API that serves manifests by tag or digest and blobs by
+// digest. If basicAuth is set, requests require a bearer token that the
+// registry's token endpoint only issues to clients presenting basicAuth.
+type testRegistry struct {
+	t            *testing.T
+	server       *httptest.Server
+	mtx          sync.Mutex
+	manifests    map[string][]byte // keyed by <repository>:<tag> and <repository>@<digest>
+	blobs        map[string][]byte
+	basicAuth    string
+	digestHeader string
+	token        string
+	nBlobs       int
+	nTokens      int
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	reg := &testRegistry{
+		t:         t,
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+	}
+	reg.server = httptest.NewServer(http.HandlerFunc(reg.handle))
+	return reg
+}
+
+func (reg *testRegistry) client(t *testing.T, authorization string) rest.Client {
+	config := map[string]interface{}{
+		"url":  reg.server.URL,
+		"type": rest.ServiceTypeOCI,
+	}
+	if authorization != "" {
+		config["headers"] = map[string]string{"Authorization": authorization}
+	}
+	bs, _ := json.Marshal(config)
+	client, err := rest.New(bs, map[string]*keys.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func (reg *testRegistry) push(repository, tag string, b bundle.Bundle) {
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf, b); err != nil {
+		reg.t.Fatal(err)
+	}
+
+	layer := buf.Bytes()
+	config := []byte("{}")
+
+	manifest, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociImageManifestMediaType,
+		Config:        ociDescriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: sha256Digest(config), Size: int64(len(config))},
+		Layers:        []ociDescriptor{{MediaType: ociBundleLayerMediaType, Digest: sha256Digest(layer), Size: int64(len(layer))}},
+	})
+	if err != nil {
+		reg.t.Fatal(err)
+	}
+
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	reg.blobs[sha256Digest(layer)] = layer
+	reg.blobs[sha256Digest(config)] = config
+	reg.manifests[repository+":"+tag] = manifest
+	reg.manifests[repository+"@"+sha256Digest(manifest)] = manifest
+}
+
+func (reg *testRegistry) digest(repository, tag string) string {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+	return sha256Digest(reg.manifests[repository+":"+tag])
+}
+
+func (reg *testRegistry) blobRequests() int {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+	return reg.nBlobs
+}
+
+func (reg *testRegistry) tokenRequests() int {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+	return reg.nTokens
+}
+
+func (reg *testRegistry) handle(w http.ResponseWriter, r *http.Request) {
+
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	if r.URL.Path == "/token" {
+		reg.nTokens++
+		if r.Header.Get("Authorization") != reg.basicAuth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if exp := "repository:org/policy:pull"; r.URL.Query().Get("scope") != exp || r.URL.Query().Get("service") != "test-registry" {
+			reg.t.Errorf("Unexpected token request: %v", r.URL)
+		}
+		reg.token = fmt.Sprintf("token-%d", reg.nTokens)
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": reg.token})
+		return
+	}
+
+	if reg.basicAuth != "" && r.Header.Get("Authorization") != "Bearer "+reg.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="test-registry"`, reg.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+
+	if i := strings.LastIndex(path, "/manifests/"); i != -1 {
+		repository, ref := path[:i], path[i+len("/manifests/"):]
+		sep := ":"
+		if strings.HasPrefix(ref, "sha256:") {
+			sep = "@"
+		}
+		manifest, ok := reg.manifests[repository+sep+ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), ociImageManifestMediaType) {
+			reg.t.Errorf("Unexpected Accept header: %v", r.Header.Get("Accept"))
+		}
+		digest := reg.digestHeader
+		if digest == "" {
+			digest = sha256Digest(manifest)
+		}
+		w.Header().Set("Content-Type", ociImageManifestMediaType)
+		w.Header().Set("Docker-Content-Digest", digest)
+		_, _ = w.Write(manifest)
+		return
+	}
+
+	if i := strings.LastIndex(path, "/blobs/"); i != -1 {
+		reg.nBlobs++
+		blob, ok := reg.blobs[path[i+len("/blobs/"):]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(blob)
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func sha256Digest(bs []byte) string {
+	sum := sha256.Sum256(bs)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
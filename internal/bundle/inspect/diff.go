@@ -0,0 +1,487 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package inspect
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/format"
+	"github.com/meta-quick/opax/loader"
+)
+
+// Kinds of changes reported for modules, rules, Wasm modules and Wasm resolvers.
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// Diff represents the differences between two revisions of a bundle. Fields
+// are empty if the respective part of the bundle did not change.
+type Diff struct {
+	Manifest    *ManifestDiff           `json:"manifest,omitempty"`
+	Modules     []ModuleDiff            `json:"modules,omitempty"`
+	Data        []bundle.PatchOperation `json:"data,omitempty"`
+	WasmModules []FileDiff              `json:"wasm_modules,omitempty"`
+	Signatures  *SignaturesDiff         `json:"signatures,omitempty"`
+}
+
+// ValueDiff represents a value that changed between the bundles.
+type ValueDiff struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// ManifestDiff represents the differences between the bundle manifests.
+type ManifestDiff struct {
+	Revision      *ValueDiff         `json:"revision,omitempty"`
+	RootsAdded    []string           `json:"roots_added,omitempty"`
+	RootsRemoved  []string           `json:"roots_removed,omitempty"`
+	Metadata      *ValueDiff         `json:"metadata,omitempty"`
+	WasmResolvers []WasmResolverDiff `json:"wasm_resolvers,omitempty"`
+}
+
+// WasmResolverDiff represents a Wasm resolver that changed between the bundles.
+type WasmResolverDiff struct {
+	Entrypoint string `json:"entrypoint"`
+	Change     string `json:"change"`
+	OldModule  string `json:"old_module,omitempty"`
+	NewModule  string `json:"new_module,omitempty"`
+}
+
+// ModuleDiff represents a policy module that changed between the bundles.
+// Modules are compared by their ASTs, so changes that only affect formatting
+// or comments are not reported.
+type ModuleDiff struct {
+	Path           string     `json:"path"`
+	Change         string     `json:"change"`
+	Package        *ValueDiff `json:"package,omitempty"`
+	ImportsAdded   []string   `json:"imports_added,omitempty"`
+	ImportsRemoved []string   `json:"imports_removed,omitempty"`
+	Rules          []RuleDiff `json:"rules,omitempty"`
+}
+
+// RuleDiff represents the changes to the definitions of a rule (or function)
+// in a module. Definitions are compared by their ASTs regardless of order.
+type RuleDiff struct {
+	Name    string   `json:"name"`
+	Change  string   `json:"change"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// FileDiff represents a file that changed between the bundles.
+type FileDiff struct {
+	Path   string `json:"path"`
+	Change string `json:"change"`
+}
+
+// SignaturesDiff represents a change to the plugin, keys or algorithms that
+// the bundles are signed with. Signatures that change only because the bundle
+// contents changed are not reported.
+type SignaturesDiff struct {
+	Old SignaturesInfo `json:"old"`
+	New SignaturesInfo `json:"new"`
+}
+
+// SignaturesInfo summarizes the signatures of a bundle.
+type SignaturesInfo struct {
+	Signed     bool     `json:"signed"`
+	Plugin     string   `json:"plugin,omitempty"`
+	KeyIDs     []string `json:"keyids,omitempty"`
+	Algorithms []string `json:"algorithms,omitempty"`
+}
+
+// Empty returns true if the bundles do not differ.
+func (d *Diff) Empty() bool {
+	return d.Manifest == nil && len(d.Modules) == 0 && len(d.Data) == 0 && len(d.WasmModules) == 0 && d.Signatures == nil
+}
+
+// Compare reads the bundles at the given paths and returns the differences
+// between them. Signatures are not verified.
+func Compare(prevPath, nextPath string) (*Diff, error) {
+
+	prev, err := readBundle(prevPath)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := readBundle(nextPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return CompareBundles(prev, next)
+}
+
+// CompareBundles returns the differences between the prev and next bundles.
+func CompareBundles(prev, next bundle.Bundle) (*Diff, error) {
+
+	data, err := bundle.DiffData(prev.Data, next.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Diff{
+		Manifest:    diffManifests(prev.Manifest, next.Manifest),
+		Modules:     diffModules(prev.Modules, next.Modules),
+		Data:        data,
+		WasmModules: diffWasmModules(prev.WasmModules, next.WasmModules),
+		Signatures:  diffSignatures(prev.Signatures, next.Signatures),
+	}, nil
+}
+
+// readBundle reads the bundle at path including its signatures, which the
+// bundle reader only returns when they are verified. Module paths are kept
+// relative to the bundle root so that bundle directories can be compared.
+func readBundle(path string) (bundle.Bundle, error) {
+
+	bl, _, err := loader.GetBundleDirectoryLoader(path)
+	if err != nil {
+		return bundle.Bundle{}, err
+	}
+
+	b, err := bundle.NewCustomReader(bl).WithSkipBundleVerification(true).Read()
+	if err != nil {
+		return bundle.Bundle{}, fmt.Errorf("bundle %s: %w", path, err)
+	}
+
+	bi := &Info{Namespaces: map[string][]string{}}
+	if err := bi.getBundleDataWasmAndSignatures(path); err != nil {
+		return bundle.Bundle{}, err
+	}
+
+	b.Signatures = bi.Signatures
+
+	return b, nil
+}
+
+func diffManifests(prev, next bundle.Manifest) *ManifestDiff {
+
+	prev.Init()
+	next.Init()
+
+	var d ManifestDiff
+
+	if prev.Revision != next.Revision {
+		d.Revision = &ValueDiff{Old: prev.Revision, New: next.Revision}
+	}
+
+	d.RootsAdded, d.RootsRemoved = diffStrings(*prev.Roots, *next.Roots)
+
+	if !reflect.DeepEqual(prev.Metadata, next.Metadata) {
+		d.Metadata = &ValueDiff{Old: prev.Metadata, New: next.Metadata}
+	}
+
+	var entrypoints []string
+
+	prevResolvers := make(map[string]string, len(prev.WasmResolvers))
+	for _, wr := range prev.WasmResolvers {
+		prevResolvers[wr.Entrypoint] = wr.Module
+		entrypoints = append(entrypoints, wr.Entrypoint)
+	}
+
+	nextResolvers := make(map[string]string, len(next.WasmResolvers))
+	for _, wr := range next.WasmResolvers {
+		nextResolvers[wr.Entrypoint] = wr.Module
+		entrypoints = append(entrypoints, wr.Entrypoint)
+	}
+
+	for _, ep := range sortedUnique(entrypoints) {
+		x, xok := prevResolvers[ep]
+		y, yok := nextResolvers[ep]
+		switch {
+		case !yok:
+			d.WasmResolvers = append(d.WasmResolvers, WasmResolverDiff{Entrypoint: ep, Change: ChangeRemoved, OldModule: x})
+		case !xok:
+			d.WasmResolvers = append(d.WasmResolvers, WasmResolverDiff{Entrypoint: ep, Change: ChangeAdded, NewModule: y})
+		case x != y:
+			d.WasmResolvers = append(d.WasmResolvers, WasmResolverDiff{Entrypoint: ep, Change: ChangeModified, OldModule: x, NewModule: y})
+		}
+	}
+
+	if reflect.DeepEqual(d, ManifestDiff{}) {
+		return nil
+	}
+
+	return &d
+}
+
+func diffModules(prev, next []bundle.ModuleFile) []ModuleDiff {
+
+	var paths []string
+
+	prevModules := make(map[string]*ast.Module, len(prev))
+	for _, mf := range prev {
+		prevModules[normalizePath(mf.Path)] = mf.Parsed
+		paths = append(paths, normalizePath(mf.Path))
+	}
+
+	nextModules := make(map[string]*ast.Module, len(next))
+	for _, mf := range next {
+		nextModules[normalizePath(mf.Path)] = mf.Parsed
+		paths = append(paths, normalizePath(mf.Path))
+	}
+
+	var result []ModuleDiff
+
+	for _, p := range sortedUnique(paths) {
+		x, xok := prevModules[p]
+		y, yok := nextModules[p]
+
+		d := ModuleDiff{Path: p}
+
+		switch {
+		case !yok:
+			d.Change = ChangeRemoved
+			d.Rules = diffRules(x.Rules, nil)
+		case !xok:
+			d.Change = ChangeAdded
+			d.Rules = diffRules(nil, y.Rules)
+		default:
+			d.Change = ChangeModified
+			if !x.Package.Equal(y.Package) {
+				d.Package = &ValueDiff{Old: x.Package.Path.String(), New: y.Package.Path.String()}
+			}
+			d.ImportsAdded, d.ImportsRemoved = diffImports(x.Imports, y.Imports)
+			d.Rules = diffRules(x.Rules, y.Rules)
+			if d.Package == nil && len(d.ImportsAdded) == 0 && len(d.ImportsRemoved) == 0 && len(d.Rules) == 0 {
+				continue
+			}
+		}
+
+		result = append(result, d)
+	}
+
+	return result
+}
+
+func diffImports(prev, next []*ast.Import) (added, removed []string) {
+
+	contains := func(imports []*ast.Import, imp *ast.Import) bool {
+		for _, other := range imports {
+			if ast.Compare(imp, other) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, imp := range next {
+		if !contains(prev, imp) {
+			added = append(added, imp.String())
+		}
+	}
+
+	for _, imp := range prev {
+		if !contains(next, imp) {
+			removed = append(removed, imp.String())
+		}
+	}
+
+	return added, removed
+}
+
+// diffRules groups the rule definitions by name and returns the definitions
+// that were added or removed for each name.
+func diffRules(prev, next []*ast.Rule) []RuleDiff {
+
+	var names []string
+
+	prevRules := map[string][]*ast.Rule{}
+	for _, r := range prev {
+		name := r.Head.Name.String()
+		prevRules[name] = append(prevRules[name], r)
+		names = append(names, name)
+	}
+
+	nextRules := map[string][]*ast.Rule{}
+	for _, r := range next {
+		name := r.Head.Name.String()
+		nextRules[name] = append(nextRules[name], r)
+		names = append(names, name)
+	}
+
+	contains := func(rules []*ast.Rule, rule *ast.Rule) bool {
+		for _, other := range rules {
+			if ast.Compare(rule, other) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	var result []RuleDiff
+
+	for _, name := range sortedUnique(names) {
+		d := RuleDiff{Name: name}
+
+		for _, r := range nextRules[name] {
+			if !contains(prevRules[name], r) {
+				d.Added = append(d.Added, ruleString(r))
+			}
+		}
+
+		for _, r := range prevRules[name] {
+			if !contains(nextRules[name], r) {
+				d.Removed = append(d.Removed, ruleString(r))
+			}
+		}
+
+		switch {
+		case len(prevRules[name]) == 0:
+			d.Change = ChangeAdded
+		case len(nextRules[name]) == 0:
+			d.Change = ChangeRemoved
+		case len(d.Added) > 0 || len(d.Removed) > 0:
+			d.Change = ChangeModified
+		default:
+			continue
+		}
+
+		result = append(result, d)
+	}
+
+	return result
+}
+
+// ruleString returns the rule as it would be formatted by 'opa fmt'.
+func ruleString(r *ast.Rule) string {
+	bs, err := format.Ast(r)
+	if err != nil {
+		return r.String()
+	}
+	return strings.TrimSpace(string(bs))
+}
+
+func diffWasmModules(prev, next []bundle.WasmModuleFile) []FileDiff {
+
+	var paths []string
+
+	prevModules := make(map[string][]byte, len(prev))
+	for _, wm := range prev {
+		prevModules[normalizePath(wm.Path)] = wm.Raw
+		paths = append(paths, normalizePath(wm.Path))
+	}
+
+	nextModules := make(map[string][]byte, len(next))
+	for _, wm := range next {
+		nextModules[normalizePath(wm.Path)] = wm.Raw
+		paths = append(paths, normalizePath(wm.Path))
+	}
+
+	var result []FileDiff
+
+	for _, p := range sortedUnique(paths) {
+		x, xok := prevModules[p]
+		y, yok := nextModules[p]
+		switch {
+		case !yok:
+			result = append(result, FileDiff{Path: p, Change: ChangeRemoved})
+		case !xok:
+			result = append(result, FileDiff{Path: p, Change: ChangeAdded})
+		case !bytes.Equal(x, y):
+			result = append(result, FileDiff{Path: p, Change: ChangeModified})
+		}
+	}
+
+	return result
+}
+
+func diffSignatures(prev, next bundle.SignaturesConfig) *SignaturesDiff {
+
+	x, y := signaturesInfo(prev), signaturesInfo(next)
+	if reflect.DeepEqual(x, y) {
+		return nil
+	}
+
+	return &SignaturesDiff{Old: x, New: y}
+}
+
+// signaturesInfo returns the plugin, key IDs and algorithms of the signatures
+// as declared in the (unverified) JWT headers.
+func signaturesInfo(sc bundle.SignaturesConfig) SignaturesInfo {
+
+	info := SignaturesInfo{Signed: len(sc.Signatures) > 0, Plugin: sc.Plugin}
+
+	var keyIDs, algs []string
+
+	for _, token := range sc.Signatures {
+		var hdr struct {
+			KeyID     string `json:"kid"`
+			Algorithm string `json:"alg"`
+		}
+		parts := strings.Split(token, ".")
+		if bs, err := base64.RawURLEncoding.DecodeString(parts[0]); err == nil {
+			_ = json.Unmarshal(bs, &hdr)
+		}
+		if hdr.KeyID != "" {
+			keyIDs = append(keyIDs, hdr.KeyID)
+		}
+		if hdr.Algorithm != "" {
+			algs = append(algs, hdr.Algorithm)
+		}
+	}
+
+	info.KeyIDs = sortedUnique(keyIDs)
+	info.Algorithms = sortedUnique(algs)
+
+	return info
+}
+
+// diffStrings returns the strings in next that are not in prev and the
+// strings in prev that are not in next.
+func diffStrings(prev, next []string) (added, removed []string) {
+
+	x := make(map[string]struct{}, len(prev))
+	for _, s := range prev {
+		x[s] = struct{}{}
+	}
+
+	y := make(map[string]struct{}, len(next))
+	for _, s := range next {
+		y[s] = struct{}{}
+	}
+
+	for _, s := range sortedUnique(append(append([]string{}, prev...), next...)) {
+		if _, ok := x[s]; !ok {
+			added = append(added, s)
+		} else if _, ok := y[s]; !ok {
+			removed = append(removed, s)
+		}
+	}
+
+	return added, removed
+}
+
+// sortedUnique sorts the strings and removes duplicates. The slice is modified
+// in place.
+func sortedUnique(strs []string) []string {
+	if len(strs) == 0 {
+		return nil
+	}
+	sort.Strings(strs)
+	result := strs[:1]
+	for _, s := range strs[1:] {
+		if s != result[len(result)-1] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func normalizePath(p string) string {
+	return path.Clean("/" + filepath.ToSlash(p))
+}
@@ -0,0 +1,210 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package inspect
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/util"
+	"github.com/meta-quick/opax/util/test"
+)
+
+func TestCompareBundles(t *testing.T) {
+
+	prev := bundle.Bundle{
+		Manifest: bundle.Manifest{
+			Revision: "1",
+			Roots:    &[]string{"authz", "users"},
+			WasmResolvers: []bundle.WasmResolver{
+				{Entrypoint: "authz/allow", Module: "/policy.wasm"},
+				{Entrypoint: "authz/deny", Module: "/policy.wasm"},
+			},
+		},
+		Modules: []bundle.ModuleFile{
+			testModuleFile("/authz/authz.rego", `package authz
+import data.users
+allow { input.user == "admin" }
+allow { users[input.user].admin }
+deny { false }`),
+			testModuleFile("/authz/unchanged.rego", "package authz.unchanged\np = 1"),
+			testModuleFile("/authz/removed.rego", "package authz.removed\nq = 1"),
+		},
+		Data: util.MustUnmarshalJSON([]byte(`{"users": {"alice": {"admin": true}, "bob": {"admin": false}}}`)).(map[string]interface{}),
+		WasmModules: []bundle.WasmModuleFile{
+			{Path: "/policy.wasm", Raw: []byte("v1")},
+		},
+	}
+
+	next := bundle.Bundle{
+		Manifest: bundle.Manifest{
+			Revision: "2",
+			Roots:    &[]string{"authz", "groups"},
+			Metadata: map[string]interface{}{"release": "2022-06"},
+			WasmResolvers: []bundle.WasmResolver{
+				{Entrypoint: "authz/allow", Module: "/other.wasm"},
+				{Entrypoint: "authz/audit", Module: "/policy.wasm"},
+			},
+		},
+		Modules: []bundle.ModuleFile{
+			testModuleFile("/authz/authz.rego", `package authz
+import data.groups
+allow { users[input.user].admin }
+allow { groups.admins[input.user] }
+audit = true`),
+			testModuleFile("authz/unchanged.rego", "package authz.unchanged\n\n# formatted\np = 1"),
+			testModuleFile("/authz/added.rego", "package authz.added\nr = 1"),
+		},
+		Data: util.MustUnmarshalJSON([]byte(`{"users": {"alice": {"admin": true}, "carol": {"admin": true}}}`)).(map[string]interface{}),
+		WasmModules: []bundle.WasmModuleFile{
+			{Path: "/policy.wasm", Raw: []byte("v2")},
+			{Path: "/other.wasm", Raw: []byte("v1")},
+		},
+	}
+
+	diff, err := CompareBundles(prev, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &Diff{
+		Manifest: &ManifestDiff{
+			Revision:     &ValueDiff{Old: "1", New: "2"},
+			RootsAdded:   []string{"groups"},
+			RootsRemoved: []string{"users"},
+			Metadata:     &ValueDiff{Old: map[string]interface{}(nil), New: map[string]interface{}{"release": "2022-06"}},
+			WasmResolvers: []WasmResolverDiff{
+				{Entrypoint: "authz/allow", Change: ChangeModified, OldModule: "/policy.wasm", NewModule: "/other.wasm"},
+				{Entrypoint: "authz/audit", Change: ChangeAdded, NewModule: "/policy.wasm"},
+				{Entrypoint: "authz/deny", Change: ChangeRemoved, OldModule: "/policy.wasm"},
+			},
+		},
+		Modules: []ModuleDiff{
+			{
+				Path:   "/authz/added.rego",
+				Change: ChangeAdded,
+				Rules:  []RuleDiff{{Name: "r", Change: ChangeAdded, Added: []string{"r = 1"}}},
+			},
+			{
+				Path:           "/authz/authz.rego",
+				Change:         ChangeModified,
+				ImportsAdded:   []string{"import data.groups"},
+				ImportsRemoved: []string{"import data.users"},
+				Rules: []RuleDiff{
+					{
+						Name:    "allow",
+						Change:  ChangeModified,
+						Added:   []string{"allow {\n\tgroups.admins[input.user]\n}"},
+						Removed: []string{"allow {\n\tinput.user == \"admin\"\n}"},
+					},
+					{Name: "audit", Change: ChangeAdded, Added: []string{"audit = true"}},
+					{Name: "deny", Change: ChangeRemoved, Removed: []string{"deny {\n\tfalse\n}"}},
+				},
+			},
+			{
+				Path:   "/authz/removed.rego",
+				Change: ChangeRemoved,
+				Rules:  []RuleDiff{{Name: "q", Change: ChangeRemoved, Removed: []string{"q = 1"}}},
+			},
+		},
+		Data: []bundle.PatchOperation{
+			{Op: "remove", Path: "/users/bob"},
+			{Op: "upsert", Path: "/users/carol", Value: map[string]interface{}{"admin": true}},
+		},
+		WasmModules: []FileDiff{
+			{Path: "/other.wasm", Change: ChangeAdded},
+			{Path: "/policy.wasm", Change: ChangeModified},
+		},
+	}
+
+	if !reflect.DeepEqual(diff, exp) {
+		t.Fatalf("expected diff:\n\n%v\n\ngot:\n\n%v", string(util.MustMarshalJSON(exp)), string(util.MustMarshalJSON(diff)))
+	}
+
+	if diff.Empty() {
+		t.Fatal("expected diff not to be empty")
+	}
+
+	same, err := CompareBundles(prev, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !same.Empty() {
+		t.Fatalf("expected empty diff but got: %v", string(util.MustMarshalJSON(same)))
+	}
+}
+
+func TestCompareSignatures(t *testing.T) {
+
+	token := func(hdr string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(hdr)) + ".e30.c2ln"
+	}
+
+	prev := `{"signatures": ["` + token(`{"alg": "RS256", "kid": "k1"}`) + `"]}`
+	rotated := `{"signatures": ["` + token(`{"alg": "SM2", "kid": "k2"}`) + `"]}`
+	resigned := `{"signatures": ["` + token(`{"alg": "RS256", "kid": "k1", "x": 1}`) + `"]}`
+
+	files := map[string]string{
+		"/v1/.manifest":        `{"revision": "1"}`,
+		"/v1/.signatures.json": prev,
+		"/v1/x/x.rego":         "package x\np = 1",
+		"/v2/.manifest":        `{"revision": "1"}`,
+		"/v2/.signatures.json": rotated,
+		"/v2/x/x.rego":         "package x\np = 1",
+		"/v3/.manifest":        `{"revision": "1"}`,
+		"/v3/.signatures.json": resigned,
+		"/v3/x/x.rego":         "package x\n\np = 1",
+		"/v4/.manifest":        `{"revision": "1"}`,
+		"/v4/x/x.rego":         "package x\np = 1",
+		"/v4/x/data.json":      `{"y": 1}`,
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+
+		compare := func(x, y string) *Diff {
+			t.Helper()
+			diff, err := Compare(filepath.Join(rootDir, x), filepath.Join(rootDir, y))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return diff
+		}
+
+		// rotated keys and algorithms are reported
+		diff := compare("v1", "v2")
+		exp := &SignaturesDiff{
+			Old: SignaturesInfo{Signed: true, KeyIDs: []string{"k1"}, Algorithms: []string{"RS256"}},
+			New: SignaturesInfo{Signed: true, KeyIDs: []string{"k2"}, Algorithms: []string{"SM2"}},
+		}
+		if !reflect.DeepEqual(diff.Signatures, exp) || len(diff.Modules) != 0 || diff.Manifest != nil {
+			t.Fatalf("expected signatures diff %+v but got: %v", exp, string(util.MustMarshalJSON(diff)))
+		}
+
+		// new signatures with the same key and reformatted modules are not reported
+		if diff := compare("v1", "v3"); !diff.Empty() {
+			t.Fatalf("expected empty diff but got: %v", string(util.MustMarshalJSON(diff)))
+		}
+
+		// unsigned bundles are reported
+		diff = compare("v1", "v4")
+		if diff.Signatures == nil || diff.Signatures.New.Signed || len(diff.Data) != 1 {
+			t.Fatalf("expected unsigned bundle and data change but got: %v", string(util.MustMarshalJSON(diff)))
+		}
+	})
+}
+
+func testModuleFile(path, module string) bundle.ModuleFile {
+	return bundle.ModuleFile{
+		URL:    path,
+		Path:   path,
+		Raw:    []byte(module),
+		Parsed: ast.MustParseModule(module),
+	}
+}
@@ -57,6 +57,8 @@ func SignLiteral(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, hd
 	switch s := signer.(type) {
 	case *sign.ECDSASigner:
 		signature, err = s.SignWithRand([]byte(signingInput), key, rnd)
+	case sign.SM2Signer:
+		signature, err = s.SignWithRand([]byte(signingInput), key, rnd)
 	default:
 		signature, err = signer.Sign([]byte(signingInput), key)
 	}
@@ -12,6 +12,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+
 	"github.com/meta-quick/opax/internal/jwx/jwa"
 	"github.com/meta-quick/opax/internal/jwx/jwk"
 	"github.com/meta-quick/opax/internal/jwx/jws"
@@ -169,6 +172,63 @@ func TestRoundtrip_RSACompact(t *testing.T) {
 	}
 }
 
+func TestRoundtrip_SM2Compact(t *testing.T) {
+	payload := []byte("Hello, World!")
+
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err.Error())
+	}
+
+	privPEM, err := smx509.WritePrivateKeyToPem(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubPEM, err := smx509.WritePublicKeyToPem(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, err := sign.GetSigningKey(string(privPEM), jwa.SM2)
+	if err != nil {
+		t.Fatalf("Failed to parse private key: %s", err.Error())
+	}
+
+	pub, err := verify.GetSigningKey(string(pubPEM), jwa.SM2)
+	if err != nil {
+		t.Fatalf("Failed to parse public key: %s", err.Error())
+	}
+
+	buf, err := jws.SignWithOption(payload, jwa.SM2, priv)
+	if err != nil {
+		t.Fatalf("Failed to sign message: %s", err.Error())
+	}
+
+	verified, err := jws.Verify(buf, jwa.SM2, pub)
+	if err != nil {
+		t.Fatalf("Failed to verify signature: %s", err.Error())
+	}
+
+	if !bytes.Equal(payload, verified) {
+		t.Fatalf("Mismatched payloads (%s):(%s)", payload, verified)
+	}
+
+	parts := strings.Split(string(buf), ".")
+	if sig, _ := base64.RawURLEncoding.DecodeString(parts[2]); len(sig) != 64 {
+		t.Fatalf("Expected 64 byte signature but got %d bytes", len(sig))
+	}
+
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte("Goodbye, World!"))
+	if _, err := jws.Verify([]byte(strings.Join(parts, ".")), jwa.SM2, pub); err == nil {
+		t.Fatal("Verification of modified payload should fail")
+	}
+
+	if _, err := jws.Verify(buf, jwa.SM2, priv); err == nil {
+		t.Fatal("Verification with private key should fail")
+	}
+}
+
 func TestEncode(t *testing.T) {
 	// HS256Compact tests that https://tools.ietf.org/html/rfc7515#appendix-A.1 works
 	t.Run("HS256Compact", func(t *testing.T) {
@@ -37,6 +37,9 @@ type ECDSASigner struct {
 	sign ecdsaSignFunc
 }
 
+// SM2Signer uses github.com/tjfoc/gmsm/sm2 to sign the payloads.
+type SM2Signer struct{}
+
 type hmacSignFunc func([]byte, []byte) ([]byte, error)
 
 // HMACSigner uses crypto/hmac to sign the payloads.
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/pkg/errors"
+	smx509 "github.com/tjfoc/gmsm/x509"
 
 	"github.com/meta-quick/opax/internal/jwx/jwa"
 )
@@ -19,6 +20,8 @@ func New(alg jwa.SignatureAlgorithm) (Signer, error) {
 		return newECDSA(alg)
 	case jwa.HS256, jwa.HS384, jwa.HS512:
 		return newHMAC(alg)
+	case jwa.SM2:
+		return SM2Signer{}, nil
 	default:
 		return nil, errors.Errorf(`unsupported signature algorithm %s`, alg)
 	}
@@ -26,6 +29,7 @@ func New(alg jwa.SignatureAlgorithm) (Signer, error) {
 
 // GetSigningKey returns a *rsa.PrivateKey or *ecdsa.PrivateKey typically encoded in PEM blocks of type "RSA PRIVATE KEY"
 // or "EC PRIVATE KEY" for RSA and ECDSA family of algorithms.
+// For SM2, it returns a *sm2.PrivateKey encoded in PEM blocks of type "PRIVATE KEY" (PKCS #8) or "EC PRIVATE KEY".
 // For HMAC family, it return a []byte value
 func GetSigningKey(key string, alg jwa.SignatureAlgorithm) (interface{}, error) {
 	switch alg {
@@ -59,6 +63,21 @@ func GetSigningKey(key string, alg jwa.SignatureAlgorithm) (interface{}, error)
 			return pkcs8priv, nil
 		}
 		return priv, nil
+	case jwa.SM2:
+		block, _ := pem.Decode([]byte(key))
+		if block == nil {
+			return nil, fmt.Errorf("failed to parse PEM block containing the key")
+		}
+
+		priv, err := smx509.ParsePKCS8UnecryptedPrivateKey(block.Bytes)
+		if err != nil {
+			ecpriv, err2 := smx509.ParseSm2PrivateKey(block.Bytes)
+			if err2 != nil {
+				return nil, fmt.Errorf("error parsing private key (%v), (%v)", err, err2)
+			}
+			return ecpriv, nil
+		}
+		return priv, nil
 	case jwa.HS256, jwa.HS384, jwa.HS512:
 		return []byte(key), nil
 	default:
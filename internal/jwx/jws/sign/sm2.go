@@ -0,0 +1,49 @@
+package sign
+
+import (
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/tjfoc/gmsm/sm2"
+
+	"github.com/meta-quick/opax/internal/jwx/jwa"
+)
+
+// sm2KeyBytes is the size of the r and s values of SM2 signatures, which are
+// encoded like ECDSA signatures (r || s, each padded to the curve size).
+const sm2KeyBytes = 32
+
+// Algorithm returns the signer algorithm
+func (s SM2Signer) Algorithm() jwa.SignatureAlgorithm {
+	return jwa.SM2
+}
+
+// SignWithRand signs payload with a SM2 private key and a provided randomness
+// source (such as `rand.Reader`). The payload is digested with SM3 using the
+// default user ID.
+func (s SM2Signer) SignWithRand(payload []byte, key interface{}, rnd io.Reader) ([]byte, error) {
+	if key == nil {
+		return nil, errors.New(`missing private key while signing payload`)
+	}
+
+	privateKey, ok := key.(*sm2.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf(`invalid key type %T. *sm2.PrivateKey is required`, key)
+	}
+
+	r, sig, err := sm2.Sm2Sign(privateKey, payload, nil, rnd)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign payload using sm2")
+	}
+
+	out := make([]byte, 2*sm2KeyBytes)
+	r.FillBytes(out[:sm2KeyBytes])
+	sig.FillBytes(out[sm2KeyBytes:])
+	return out, nil
+}
+
+// Sign signs payload with a SM2 private key
+func (s SM2Signer) Sign(payload []byte, key interface{}) ([]byte, error) {
+	return s.SignWithRand(payload, key, rand.Reader)
+}
@@ -33,6 +33,9 @@ type ECDSAVerifier struct {
 	verify ecdsaVerifyFunc
 }
 
+// SM2Verifier implements the Verifier interface
+type SM2Verifier struct{}
+
 // HMACVerifier implements the Verifier interface
 type HMACVerifier struct {
 	signer sign.Signer
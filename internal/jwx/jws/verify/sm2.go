@@ -0,0 +1,30 @@
+package verify
+
+import (
+	"math/big"
+
+	"github.com/pkg/errors"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// Verify checks whether the signature for a given input and key is correct.
+// The payload is digested with SM3 using the default user ID.
+func (v SM2Verifier) Verify(payload []byte, signature []byte, key interface{}) error {
+	if key == nil {
+		return errors.New(`missing public key while verifying payload`)
+	}
+	sm2key, ok := key.(*sm2.PublicKey)
+	if !ok {
+		return errors.Errorf(`invalid key type %T. *sm2.PublicKey is required`, key)
+	}
+
+	r, s := &big.Int{}, &big.Int{}
+	n := len(signature) / 2
+	r.SetBytes(signature[:n])
+	s.SetBytes(signature[n:])
+
+	if !sm2.Sm2Verify(sm2key, payload, nil, r, s) {
+		return errors.New(`failed to verify signature using sm2`)
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 
 	"github.com/pkg/errors"
+	smx509 "github.com/tjfoc/gmsm/x509"
 
 	"github.com/meta-quick/opax/internal/jwx/jwa"
 )
@@ -22,6 +23,8 @@ func New(alg jwa.SignatureAlgorithm) (Verifier, error) {
 		return newECDSA(alg)
 	case jwa.HS256, jwa.HS384, jwa.HS512:
 		return newHMAC(alg)
+	case jwa.SM2:
+		return SM2Verifier{}, nil
 	default:
 		return nil, errors.Errorf(`unsupported signature algorithm: %s`, alg)
 	}
@@ -29,6 +32,7 @@ func New(alg jwa.SignatureAlgorithm) (Verifier, error) {
 
 // GetSigningKey returns a *rsa.PublicKey or *ecdsa.PublicKey typically encoded in PEM blocks of type "PUBLIC KEY",
 // for RSA and ECDSA family of algorithms.
+// For SM2, it returns a *sm2.PublicKey encoded in a PEM block of type "PUBLIC KEY".
 // For HMAC family, it return a []byte value
 func GetSigningKey(key string, alg jwa.SignatureAlgorithm) (interface{}, error) {
 	switch alg {
@@ -49,6 +53,13 @@ func GetSigningKey(key string, alg jwa.SignatureAlgorithm) (interface{}, error)
 		default:
 			return nil, fmt.Errorf("invalid key type %T", pub)
 		}
+	case jwa.SM2:
+		block, _ := pem.Decode([]byte(key))
+		if block == nil {
+			return nil, fmt.Errorf("failed to parse PEM block containing the key")
+		}
+
+		return smx509.ParseSm2PublicKey(block.Bytes)
 	case jwa.HS256, jwa.HS384, jwa.HS512:
 		return []byte(key), nil
 	default:
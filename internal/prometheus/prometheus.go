@@ -10,6 +10,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
@@ -18,10 +19,34 @@ import (
 	"github.com/meta-quick/opax/metrics"
 )
 
+// Registerer is implemented by metrics providers that export Prometheus
+// collectors, e.g., Provider.
+type Registerer interface {
+	Register(prometheus.Collector) error
+}
+
+// Register registers the collectors with m if m exports Prometheus
+// collectors. Otherwise, it does nothing. The first error is returned.
+func Register(m interface{}, cs ...prometheus.Collector) error {
+	r, ok := m.(Registerer)
+	if !ok {
+		return nil
+	}
+
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Provider wraps a metrics.Metrics provider with a Prometheus registry that can
 // instrument the HTTP server's handlers.
 type Provider struct {
 	registry             *prometheus.Registry
+	counters             *prometheus.Registry // exports the counters of the inner provider
 	durationHistogram    *prometheus.HistogramVec
 	cancellationCounters *prometheus.CounterVec
 	inner                metrics.Metrics
@@ -62,8 +87,13 @@ func New(inner metrics.Metrics, logger func(attrs map[string]interface{}, f stri
 	)
 
 	registry.MustRegister(cancellationCounters)
+
+	counters := prometheus.NewRegistry()
+	counters.MustRegister(counterCollector{inner: inner})
+
 	return &Provider{
 		registry:             registry,
+		counters:             counters,
 		durationHistogram:    durationHistogram,
 		cancellationCounters: cancellationCounters,
 		inner:                inner,
@@ -73,7 +103,15 @@ func New(inner metrics.Metrics, logger func(attrs map[string]interface{}, f stri
 
 // RegisterEndpoints registers `/metrics` endpoint
 func (p *Provider) RegisterEndpoints(registrar func(path, method string, handler http.Handler)) {
-	registrar("/metrics", http.MethodGet, promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{}))
+	registrar("/metrics", http.MethodGet, promhttp.HandlerFor(prometheus.Gatherers{p.registry, p.counters}, promhttp.HandlerOpts{}))
+}
+
+// Register registers the collector with the Prometheus registry. A collector
+// with the same metrics that was registered before, e.g., by a plugin that has
+// since been replaced, is unregistered first.
+func (p *Provider) Register(c prometheus.Collector) error {
+	p.registry.Unregister(c)
+	return p.registry.Register(c)
 }
 
 // InstrumentHandler returned wrapped HTTP handler with added prometheus instrumentation
@@ -103,7 +141,8 @@ func (p *Provider) Info() metrics.Info {
 }
 
 // All returns the union of the inner metric provider and the underlying
-// prometheus registry.
+// prometheus registry. The counters of the inner provider that are exported
+// to Prometheus are not included twice.
 func (p *Provider) All() map[string]interface{} {
 
 	all := p.inner.All()
@@ -149,6 +188,38 @@ func (p *Provider) Clear() {
 	p.inner.Clear()
 }
 
+// counterCollector exports the counters of the inner metric provider, e.g.,
+// the decision log drop counters, as Prometheus counters. The collector is
+// unchecked because the set of counters is not known in advance.
+type counterCollector struct {
+	inner metrics.Metrics
+}
+
+func (counterCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c counterCollector) Collect(ch chan<- prometheus.Metric) {
+	for key, value := range c.inner.All() {
+		if !strings.HasPrefix(key, counterPrefix) {
+			continue
+		}
+
+		v, ok := value.(uint64)
+		if !ok {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, counterPrefix)
+		desc := prometheus.NewDesc(name, "A count of "+strings.ReplaceAll(name, "_", " ")+".", nil, nil)
+
+		// Counters with names that are not valid metric names are skipped.
+		if m, err := prometheus.NewConstMetric(desc, prometheus.CounterValue, float64(v)); err == nil {
+			ch <- m
+		}
+	}
+}
+
+const counterPrefix = "counter_"
+
 type captureStatusResponseWriter struct {
 	http.ResponseWriter
 	status int
@@ -163,7 +234,19 @@ func (h *hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return h.hijacker.Hijack()
 }
 
+func (h *hijacker) Flush() {
+	if f, ok := h.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (c *captureStatusResponseWriter) WriteHeader(statusCode int) {
 	c.ResponseWriter.WriteHeader(statusCode)
 	c.status = statusCode
 }
+
+func (c *captureStatusResponseWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
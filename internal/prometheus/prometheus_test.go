@@ -0,0 +1,128 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/meta-quick/opax/metrics"
+)
+
+func TestCountersExported(t *testing.T) {
+
+	inner := metrics.New()
+	p := New(inner, nil)
+
+	inner.Counter("decision_logs_dropped_by_policy").Add(3)
+	inner.Counter("invalid-name").Incr()
+	inner.Timer("some_timer").Start()
+
+	var handler http.Handler
+	p.RegisterEndpoints(func(path, method string, h http.Handler) {
+		handler = h
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %v: %v", rec.Code, rec.Body.String())
+	}
+
+	body := rec.Body.String()
+
+	if !strings.Contains(body, "# TYPE decision_logs_dropped_by_policy counter\ndecision_logs_dropped_by_policy 3\n") {
+		t.Fatalf("Expected counter to be exported but got:\n%v", body)
+	}
+
+	if strings.Contains(body, "invalid") || strings.Contains(body, "some_timer") {
+		t.Fatalf("Expected only counters with valid names to be exported but got:\n%v", body)
+	}
+
+	// The counters are included once in the union of all metrics.
+	all := p.All()
+	if all["counter_decision_logs_dropped_by_policy"] != uint64(3) {
+		t.Fatalf("Expected counter in all metrics but got: %v", all)
+	}
+
+	if _, ok := all["decision_logs_dropped_by_policy"]; ok {
+		t.Fatal("Expected counter not to be included twice")
+	}
+}
+
+func TestRegisterReplacesCollector(t *testing.T) {
+
+	p := New(metrics.New(), nil)
+
+	for _, v := range []float64{1, 2} {
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "A test gauge."})
+		gauge.Set(v)
+		if err := p.Register(gauge); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	families, err := p.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range families {
+		if f.GetName() == "test_gauge" {
+			if v := f.GetMetric()[0].GetGauge().GetValue(); v != 2 {
+				t.Fatalf("Expected replaced gauge value 2 but got %v", v)
+			}
+			return
+		}
+	}
+
+	t.Fatal("Expected gauge to be registered")
+}
+
+func TestRegisterCollectors(t *testing.T) {
+
+	// Providers that do not export Prometheus collectors are ignored.
+	if err := Register(metrics.New(), prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "A test gauge."})); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(metrics.New(), nil)
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "A test gauge."})
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_counter", Help: "A test counter."})
+
+	if err := Register(p, gauge, counter); err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.registry.Unregister(gauge) || !p.registry.Unregister(counter) {
+		t.Fatal("Expected collectors to be registered")
+	}
+}
+
+func TestInstrumentHandlerFlusher(t *testing.T) {
+
+	p := New(metrics.New(), nil)
+
+	handler := p.InstrumentHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("Expected response writer to implement http.Flusher")
+		}
+		f.Flush()
+	}), "test")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !recorder.Flushed {
+		t.Fatal("Expected response to be flushed")
+	}
+}
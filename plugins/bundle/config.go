@@ -148,8 +148,21 @@ type Source struct {
 	Service        string                     `json:"service"`
 	Resource       string                     `json:"resource"`
 	Signing        *bundle.VerificationConfig `json:"signing"`
+	Decryption     *bundle.DecryptionConfig   `json:"decryption"`
+	Git            *GitConfig                 `json:"git,omitempty"`
+	Watch          bool                       `json:"watch,omitempty"` // reload file:// resources when they change
 	Persist        bool                       `json:"persist"`
 	SizeLimitBytes int64                      `json:"size_limit_bytes"`
+	Shadow         *ShadowConfig              `json:"shadow,omitempty"` // evaluate decisions against the bundle without activating it
+}
+
+// ShadowConfig marks a bundle as a shadow bundle. Shadow bundles are not
+// activated in the store. Instead, decisions are also evaluated against the
+// shadow bundle and the results are compared with the active policies.
+type ShadowConfig struct {
+	SampleRate      *float64 `json:"sample_rate,omitempty"`       // fraction of decisions evaluated against the shadow bundle
+	LatencyBudgetMS *int64   `json:"latency_budget_ms,omitempty"` // max time spent on a shadow evaluation
+	MaxConcurrency  *int     `json:"max_concurrency,omitempty"`   // max number of concurrent shadow evaluations
 }
 
 // IsMultiBundle returns whether or not the config is the newer multi-bundle
@@ -165,6 +178,8 @@ func (c *Config) validateAndInjectDefaults(services []string, keys map[string]*k
 		return c.validateAndInjectDefaultsLegacy(services)
 	}
 
+	var shadow string
+
 	for name, source := range c.Bundles {
 		if source.Resource == "" {
 			source.Resource = path.Join(defaultBundlePathPrefix, name)
@@ -181,7 +196,24 @@ func (c *Config) validateAndInjectDefaults(services []string, keys map[string]*k
 			}
 		}
 
-		if strings.HasPrefix(source.Resource, "file://") {
+		if source.Decryption != nil {
+			err := source.Decryption.ValidateAndInjectDefaults(keys)
+			if err != nil {
+				return fmt.Errorf("invalid configuration for bundle %q: %s", name, err.Error())
+			}
+		} else if len(keys) > 0 {
+			source.Decryption = bundle.NewDecryptionConfig(keys, "")
+		}
+
+		if source.Watch && (source.Git != nil || !strings.HasPrefix(source.Resource, "file://")) {
+			return fmt.Errorf("invalid configuration for bundle %q: watch requires a file:// resource", name)
+		}
+
+		if source.Git != nil {
+			if err := source.Git.validateAndInjectDefaults(); err != nil {
+				return fmt.Errorf("invalid configuration for bundle %q: %w", name, err)
+			}
+		} else if strings.HasPrefix(source.Resource, "file://") {
 			if _, err := url.Parse(source.Resource); err != nil {
 				return fmt.Errorf("invalid URL for bundle %q: %v", name, err)
 			}
@@ -207,6 +239,42 @@ func (c *Config) validateAndInjectDefaults(services []string, keys map[string]*k
 		if source.SizeLimitBytes <= 0 {
 			source.SizeLimitBytes = bundle.DefaultSizeLimitBytes
 		}
+
+		if source.Shadow != nil {
+			if shadow != "" {
+				return fmt.Errorf("invalid configuration for bundle %q: bundle %q is already configured as shadow bundle", name, shadow)
+			}
+			shadow = name
+
+			if err := source.Shadow.validateAndInjectDefaults(); err != nil {
+				return fmt.Errorf("invalid configuration for bundle %q: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *ShadowConfig) validateAndInjectDefaults() error {
+	if c.SampleRate == nil {
+		rate := defaultShadowSampleRate
+		c.SampleRate = &rate
+	} else if *c.SampleRate < 0 || *c.SampleRate > 1 {
+		return fmt.Errorf("shadow sample rate must be between 0 and 1")
+	}
+
+	if c.LatencyBudgetMS == nil {
+		budget := defaultShadowLatencyBudgetMS
+		c.LatencyBudgetMS = &budget
+	} else if *c.LatencyBudgetMS <= 0 {
+		return fmt.Errorf("shadow latency budget must be positive")
+	}
+
+	if c.MaxConcurrency == nil {
+		concurrency := defaultShadowMaxConcurrency
+		c.MaxConcurrency = &concurrency
+	} else if *c.MaxConcurrency <= 0 {
+		return fmt.Errorf("shadow max concurrency must be positive")
 	}
 
 	return nil
@@ -255,5 +323,8 @@ func (c *Config) generateLegacyResourcePath() string {
 }
 
 const (
-	defaultBundlePathPrefix = "bundles"
+	defaultBundlePathPrefix      = "bundles"
+	defaultShadowSampleRate      = float64(1)
+	defaultShadowLatencyBudgetMS = int64(100)
+	defaultShadowMaxConcurrency  = 1
 )
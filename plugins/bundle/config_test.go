@@ -227,9 +227,79 @@ func TestParseAndValidateBundlesConfig(t *testing.T) {
 			services:  []string{"s1"},
 			wantError: true,
 		},
+		{
+			conf:      `{"b1":{"service": "s1", "signing": {"keyids": ["foo", "edge"], "threshold": 2}}}`,
+			services:  []string{"s1"},
+			wantError: false,
+		},
+		{
+			conf:      `{"b1":{"service": "s1", "signing": {"keyids": ["foo", "bar"]}}}`,
+			services:  []string{"s1"},
+			wantError: true,
+		},
+		{
+			conf:      `{"b1":{"service": "s1", "signing": {"threshold": 3}}}`,
+			services:  []string{"s1"},
+			wantError: true,
+		},
+		{
+			conf:      `{"b1":{"service": "s1", "decryption": {"keyid": "edge"}}}`,
+			services:  []string{"s1"},
+			wantError: false,
+		},
+		{
+			conf:      `{"b1":{"service": "s1", "decryption": {"keyid": "foo"}}}`,
+			services:  []string{"s1"},
+			wantError: true,
+		},
+		{
+			conf:      `{"b1":{"service": "s1", "decryption": {"keyid": "bar"}}}`,
+			services:  []string{"s1"},
+			wantError: true,
+		},
+		{
+			conf:      `{"b1":{"git": {"url": "https://example.com/policies.git", "ref": "main", "subdir": "authz"}}}`,
+			services:  []string{},
+			wantError: false,
+		},
+		{
+			conf:      `{"b1":{"git": {"ref": "main"}}}`,
+			services:  []string{},
+			wantError: true,
+		},
+		{
+			conf:      `{"b1":{"git": {"url": "https://example.com/policies.git", "subdir": "../authz"}}}`,
+			services:  []string{},
+			wantError: true,
+		},
+		{
+			conf:      `{"b1":{"service": "s1"}, "b2":{"service": "s1", "shadow": {"sample_rate": 0.5, "latency_budget_ms": 10}}}`,
+			services:  []string{"s1"},
+			wantError: false,
+		},
+		{
+			conf:      `{"b1":{"service": "s1", "shadow": {"sample_rate": 1.5}}}`,
+			services:  []string{"s1"},
+			wantError: true,
+		},
+		{
+			conf:      `{"b1":{"service": "s1", "shadow": {"latency_budget_ms": 0}}}`,
+			services:  []string{"s1"},
+			wantError: true,
+		},
+		{
+			conf:      `{"b1":{"service": "s1", "shadow": {"max_concurrency": 0}}}`,
+			services:  []string{"s1"},
+			wantError: true,
+		},
+		{
+			conf:      `{"b1":{"service": "s1", "shadow": {}}, "b2":{"service": "s1", "shadow": {}}}`,
+			services:  []string{"s1"},
+			wantError: true,
+		},
 	}
 
-	keys := map[string]*keys.Config{"foo": {Key: "secret"}}
+	keys := map[string]*keys.Config{"foo": {Key: "secret"}, "edge": {PrivateKey: "private"}}
 	for i := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
 			_, err := NewConfigBuilder().WithBytes([]byte(tests[i].conf)).WithServices(tests[i].services).
@@ -375,6 +445,21 @@ func TestParseBundlesConfigSimpleFileURL(t *testing.T) {
 
 }
 
+func TestParseBundlesConfigShadowDefaults(t *testing.T) {
+
+	config := []byte(`{"test": {"resource": "file:///b.tar.gz", "shadow": {}}}`)
+
+	parsed, err := ParseBundlesConfig(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shadow := parsed.Bundles["test"].Shadow
+	if *shadow.SampleRate != defaultShadowSampleRate || *shadow.LatencyBudgetMS != defaultShadowLatencyBudgetMS || *shadow.MaxConcurrency != defaultShadowMaxConcurrency {
+		t.Fatalf("Unexpected shadow config: %+v", shadow)
+	}
+}
+
 func TestConfigIsMultiBundle(t *testing.T) {
 	tests := []struct {
 		conf     Config
@@ -0,0 +1,372 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/compile"
+	"github.com/meta-quick/opax/download"
+	"github.com/meta-quick/opax/logging"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/util"
+)
+
+const (
+	defaultGitRef = "HEAD"
+
+	// gitActivatedRef is the ref in the persisted repository that points to
+	// the commit of the last activated bundle.
+	gitActivatedRef = "refs/opa/activated"
+
+	// gitAllowProtocol restricts the transports git may use to those that
+	// the url setting supports. In particular, it prevents remote helpers
+	// such as ext:: from running arbitrary commands.
+	gitAllowProtocol = "file:http:https"
+
+	// gitMinRetryDelay is the minimum delay before the git source retries a
+	// failed fetch or build.
+	gitMinRetryDelay = time.Millisecond * 100
+)
+
+// GitConfig represents the configuration of a bundle source that builds
+// bundles from a git repository instead of downloading them from a service.
+type GitConfig struct {
+	URL    string `json:"url"`              // local path, file:// or http(s):// URL of the repository
+	Ref    string `json:"ref,omitempty"`    // branch or tag to track (default: the remote HEAD)
+	Subdir string `json:"subdir,omitempty"` // directory within the repository that contains the bundle
+}
+
+func (c *GitConfig) validateAndInjectDefaults() error {
+
+	if c.URL == "" {
+		return fmt.Errorf("missing git repository url")
+	}
+
+	if c.Ref == "" {
+		c.Ref = defaultGitRef
+	} else if strings.HasPrefix(c.Ref, "-") {
+		return fmt.Errorf("invalid git ref %q", c.Ref)
+	}
+
+	if c.Subdir != "" {
+		subdir := path.Clean("/" + c.Subdir)
+		if subdir != "/"+strings.Trim(c.Subdir, "/") {
+			return fmt.Errorf("invalid git subdirectory %q", c.Subdir)
+		}
+		c.Subdir = strings.TrimPrefix(subdir, "/")
+	}
+
+	return nil
+}
+
+// gitLoader implements the Loader interface for bundle sources backed by a
+// git repository. The repository is fetched into a bare repository in dir
+// and the tree of the fetched commit is built into a bundle with the commit
+// SHA as the revision. The commit SHA serves as the etag so unchanged commits
+// are not rebuilt.
+type gitLoader struct {
+	name           string
+	config         GitConfig
+	trigger        download.Config
+	dir            string // bare repository that remote commits are fetched into
+	tempDir        bool   // remove dir when the loader stops
+	bvc            *bundle.VerificationConfig
+	dc             *bundle.DecryptionConfig
+	sizeLimitBytes int64
+	f              func(context.Context, string, download.Update)
+	logger         logging.Logger
+	buildMtx       sync.Mutex // serializes fetches and builds
+	mtx            sync.Mutex // protects etag and stopped
+	etag           string
+	stop           chan chan struct{}
+	stopped        bool
+}
+
+func newGitLoader(name string, source *Source, dir string, f func(context.Context, string, download.Update), logger logging.Logger) *gitLoader {
+	return &gitLoader{
+		name:           name,
+		config:         *source.Git,
+		trigger:        source.Config,
+		dir:            dir,
+		bvc:            source.Signing,
+		dc:             source.Decryption,
+		sizeLimitBytes: source.SizeLimitBytes,
+		f:              f,
+		logger:         logger,
+		stop:           make(chan chan struct{}),
+	}
+}
+
+func (gl *gitLoader) Start(ctx context.Context) {
+	if *gl.trigger.Trigger == plugins.TriggerPeriodic {
+		go gl.loop(ctx)
+	}
+}
+
+func (gl *gitLoader) Stop(context.Context) {
+	if *gl.trigger.Trigger == plugins.TriggerPeriodic {
+		gl.mtx.Lock()
+		stopped := gl.stopped
+		gl.stopped = true
+		gl.mtx.Unlock()
+
+		if !stopped {
+			done := make(chan struct{})
+			gl.stop <- done
+			<-done
+		}
+	}
+
+	gl.buildMtx.Lock()
+	defer gl.buildMtx.Unlock()
+
+	if gl.tempDir {
+		os.RemoveAll(gl.dir)
+		gl.dir, gl.tempDir = "", false
+	}
+}
+
+func (gl *gitLoader) ClearCache() {
+	gl.SetCache("")
+}
+
+func (gl *gitLoader) SetCache(etag string) {
+	gl.mtx.Lock()
+	defer gl.mtx.Unlock()
+	gl.etag = etag
+}
+
+func (gl *gitLoader) Trigger(ctx context.Context) error {
+	return gl.oneShot(ctx)
+}
+
+func (gl *gitLoader) loop(context.Context) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var retry int
+
+	for {
+		var delay time.Duration
+
+		err := gl.oneShot(ctx)
+
+		if err != nil {
+			delay = util.DefaultBackoff(float64(gitMinRetryDelay), float64(*gl.trigger.Polling.MaxDelaySeconds), retry)
+			retry++
+		} else {
+			min := float64(*gl.trigger.Polling.MinDelaySeconds)
+			max := float64(*gl.trigger.Polling.MaxDelaySeconds)
+			delay = time.Duration(((max - min) * rand.Float64()) + min)
+			retry = 0
+		}
+
+		gl.logger.Debug("Waiting %v before next git fetch/retry.", delay)
+
+		select {
+		case <-time.After(delay):
+		case done := <-gl.stop:
+			cancel()
+			close(done)
+			return
+		}
+	}
+}
+
+func (gl *gitLoader) oneShot(ctx context.Context) error {
+
+	gl.buildMtx.Lock()
+	defer gl.buildMtx.Unlock()
+
+	gl.mtx.Lock()
+	etag := gl.etag
+	gl.mtx.Unlock()
+
+	m := metrics.New()
+	u := download.Update{Metrics: m}
+
+	u.Bundle, u.ETag, u.Error = gl.build(ctx, m, etag)
+
+	gl.SetCache(u.ETag)
+
+	gl.f(ctx, gl.name, u)
+
+	return u.Error
+}
+
+// build fetches the configured ref and returns the bundle built from the
+// commit it points to. If the commit has not changed since the last build, no
+// bundle is returned.
+func (gl *gitLoader) build(ctx context.Context, m metrics.Metrics, etag string) (*bundle.Bundle, string, error) {
+
+	m.Timer(metrics.BundleRequest).Start()
+	commit, err := gl.fetch(ctx)
+	m.Timer(metrics.BundleRequest).Stop()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if commit == etag {
+		gl.logger.Debug("Git commit %v unchanged, skipping bundle build.", commit)
+		return nil, commit, nil
+	}
+
+	gl.logger.Debug("Building bundle from git commit %v.", commit)
+
+	b, err := gl.buildCommit(ctx, m, commit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return b, commit, nil
+}
+
+// buildCommit builds the bundle from the tree of a commit in the bare
+// repository. The files are verified and decrypted before they are compiled.
+func (gl *gitLoader) buildCommit(ctx context.Context, m metrics.Metrics, commit string) (*bundle.Bundle, error) {
+
+	m.Timer(metrics.RegoLoadBundles).Start()
+	defer m.Timer(metrics.RegoLoadBundles).Stop()
+
+	treeish := commit
+	if gl.config.Subdir != "" {
+		treeish += ":" + gl.config.Subdir
+	}
+
+	archive, err := gl.git(ctx, "archive", "--format=tar.gz", treeish)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := bundle.NewCustomReader(bundle.NewTarballLoader(bytes.NewReader(archive))).
+		WithMetrics(m).
+		WithBundleVerificationConfig(gl.bvc).
+		WithDecryptionConfig(gl.dc).
+		WithSizeLimitBytes(gl.sizeLimitBytes).
+		Read()
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := compile.New().
+		WithAsBundle(true).
+		WithBundle(&b).
+		WithRevision(commit)
+
+	if err := compiler.Build(ctx); err != nil {
+		return nil, err
+	}
+
+	// Formatting the modules and setting the revision invalidate any
+	// signatures in the repository. They have been verified above so the
+	// built bundle is passed on without them.
+	result := compiler.Bundle()
+	result.Signatures = bundle.SignaturesConfig{}
+
+	return result, nil
+}
+
+// persist records commit as the commit of the activated bundle so that the
+// bundle can be rebuilt from the repository on startup.
+func (gl *gitLoader) persist(ctx context.Context, commit string) error {
+	_, err := gl.git(ctx, "update-ref", gitActivatedRef, commit)
+	return err
+}
+
+// loadActivated rebuilds the bundle of the last activated commit from the
+// persisted repository. If no bundle was activated, nil is returned.
+func (gl *gitLoader) loadActivated(ctx context.Context) (*bundle.Bundle, error) {
+
+	if _, err := os.Stat(filepath.Join(gl.dir, "HEAD")); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	out, err := gl.git(ctx, "for-each-ref", "--format=%(objectname)", gitActivatedRef)
+	if err != nil {
+		return nil, err
+	}
+
+	commit := strings.TrimSpace(string(out))
+	if commit == "" {
+		return nil, nil
+	}
+
+	gl.buildMtx.Lock()
+	defer gl.buildMtx.Unlock()
+
+	return gl.buildCommit(ctx, metrics.New(), commit)
+}
+
+// fetch fetches the configured ref into the bare repository and returns the
+// SHA of the commit it points to.
+func (gl *gitLoader) fetch(ctx context.Context) (string, error) {
+
+	if gl.dir == "" {
+		dir, err := ioutil.TempDir("", "opa-git-bundle-")
+		if err != nil {
+			return "", err
+		}
+		gl.dir, gl.tempDir = dir, true
+	}
+
+	if _, err := os.Stat(filepath.Join(gl.dir, "HEAD")); os.IsNotExist(err) {
+		if err := os.MkdirAll(gl.dir, 0755); err != nil {
+			return "", err
+		}
+		if _, err := gl.git(ctx, "init", "--quiet", "--bare"); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	if _, err := gl.git(ctx, "fetch", "--quiet", "--no-tags", "--depth=1", "--", gl.config.URL, gl.config.Ref); err != nil {
+		return "", err
+	}
+
+	out, err := gl.git(ctx, "rev-parse", "--verify", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// git runs the git command in the bare repository and returns its output.
+func (gl *gitLoader) git(ctx context.Context, args ...string) ([]byte, error) {
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--git-dir", gl.dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+gitAllowProtocol)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %v failed: %v", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %v failed: %w", args[0], err)
+	}
+
+	return stdout.Bytes(), nil
+}
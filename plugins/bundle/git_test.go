@@ -0,0 +1,384 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/download"
+	"github.com/meta-quick/opax/keys"
+	"github.com/meta-quick/opax/logging"
+	"github.com/meta-quick/opax/plugins"
+)
+
+// testGitRepo is a bare repository that is populated through a work tree.
+type testGitRepo struct {
+	t    *testing.T
+	bare string
+	work string
+}
+
+func newTestGitRepo(t *testing.T) *testGitRepo {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	root, err := ioutil.TempDir("", "opa-git-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	r := &testGitRepo{t: t, bare: filepath.Join(root, "repo.git"), work: filepath.Join(root, "work")}
+	r.run("", "init", "--quiet", "--bare", r.bare)
+	r.run("", "init", "--quiet", r.work)
+	r.run(r.work, "checkout", "--quiet", "-b", "main")
+	r.run(r.work, "remote", "add", "origin", r.bare)
+	return r
+}
+
+func (r *testGitRepo) run(dir string, args ...string) string {
+	r.t.Helper()
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes files (removing those with empty content) to the work tree,
+// commits them and pushes the branch. It returns the commit SHA.
+func (r *testGitRepo) commit(branch string, files map[string]string) string {
+	r.t.Helper()
+	for name, content := range files {
+		path := filepath.Join(r.work, filepath.FromSlash(name))
+		if content == "" {
+			if err := os.Remove(path); err != nil {
+				r.t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	r.run(r.work, "add", "-A")
+	r.run(r.work, "commit", "--quiet", "--allow-empty", "-m", "update")
+	r.run(r.work, "push", "--quiet", "origin", "HEAD:refs/heads/"+branch)
+	return r.run(r.work, "rev-parse", "HEAD")
+}
+
+type testGitUpdates struct {
+	updates []download.Update
+}
+
+func (u *testGitUpdates) callback(_ context.Context, _ string, update download.Update) {
+	u.updates = append(u.updates, update)
+}
+
+func (u *testGitUpdates) last(t *testing.T) download.Update {
+	t.Helper()
+	if len(u.updates) == 0 {
+		t.Fatal("expected update")
+	}
+	return u.updates[len(u.updates)-1]
+}
+
+func newTestGitLoader(t *testing.T, git GitConfig, updates *testGitUpdates) *gitLoader {
+	t.Helper()
+	trigger := plugins.TriggerManual
+	source := &Source{Config: download.Config{Trigger: &trigger}, Git: &git, SizeLimitBytes: bundle.DefaultSizeLimitBytes}
+	if err := source.Git.validateAndInjectDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Config.ValidateAndInjectDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	gl := newGitLoader("test", source, "", updates.callback, logging.NewNoOpLogger())
+	t.Cleanup(func() { gl.Stop(context.Background()) })
+	return gl
+}
+
+func TestGitLoaderBuildsCommit(t *testing.T) {
+
+	repo := newTestGitRepo(t)
+	ctx := context.Background()
+
+	sha1 := repo.commit("main", map[string]string{
+		"README.md":                  "not part of the bundle",
+		"policies/authz/.manifest":   `{"roots": ["authz"]}`,
+		"policies/authz/authz.rego":  "package authz\nallow { input.user == data.authz.admin }",
+		"policies/authz/data.json":   `{"authz": {"admin": "alice"}}`,
+		"policies/other/other.rego":  "package other\np = 1",
+		"policies/authz/ignore.yaml": "ignored: true",
+	})
+
+	updates := &testGitUpdates{}
+	gl := newTestGitLoader(t, GitConfig{URL: repo.bare, Ref: "main", Subdir: "/policies/authz/"}, updates)
+
+	if err := gl.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	u := updates.last(t)
+	if u.Error != nil || u.Bundle == nil {
+		t.Fatalf("expected bundle but got: %v", u.Error)
+	}
+
+	if u.ETag != sha1 || u.Bundle.Manifest.Revision != sha1 {
+		t.Fatalf("expected revision and etag %v but got %v and %v", sha1, u.Bundle.Manifest.Revision, u.ETag)
+	}
+
+	if len(u.Bundle.Modules) != 1 || u.Bundle.Modules[0].Parsed.Package.Path.String() != "data.authz" {
+		t.Fatalf("expected authz module but got: %v", u.Bundle.Modules)
+	}
+
+	if roots := *u.Bundle.Manifest.Roots; len(roots) != 1 || roots[0] != "authz" {
+		t.Fatalf("expected manifest roots from subdirectory but got: %v", roots)
+	}
+
+	// an unchanged commit is not rebuilt
+	if err := gl.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if u := updates.last(t); u.Error != nil || u.Bundle != nil || u.ETag != sha1 {
+		t.Fatalf("expected unchanged update but got: %+v", u)
+	}
+
+	// a new commit is picked up
+	sha2 := repo.commit("main", map[string]string{
+		"policies/authz/data.json": `{"authz": {"admin": "bob"}}`,
+	})
+
+	if err := gl.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	u = updates.last(t)
+	if u.Error != nil || u.Bundle == nil || u.Bundle.Manifest.Revision != sha2 {
+		t.Fatalf("expected bundle for %v but got: %+v", sha2, u)
+	}
+
+	if admin := u.Bundle.Data["authz"].(map[string]interface{})["admin"]; admin != "bob" {
+		t.Fatalf("expected updated data but got: %v", admin)
+	}
+}
+
+func TestGitLoaderTracksTag(t *testing.T) {
+
+	repo := newTestGitRepo(t)
+	ctx := context.Background()
+
+	tagged := repo.commit("main", map[string]string{"x.rego": "package x\np = 1"})
+	repo.run(repo.work, "tag", "v1")
+	repo.run(repo.work, "push", "--quiet", "origin", "v1")
+
+	repo.commit("main", map[string]string{"x.rego": "package x\np = 2"})
+
+	updates := &testGitUpdates{}
+	gl := newTestGitLoader(t, GitConfig{URL: "file://" + filepath.ToSlash(repo.bare), Ref: "v1"}, updates)
+
+	if err := gl.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	u := updates.last(t)
+	if u.Error != nil || u.Bundle == nil || u.Bundle.Manifest.Revision != tagged {
+		t.Fatalf("expected bundle for tagged commit %v but got: %+v", tagged, u)
+	}
+
+	if !strings.Contains(string(u.Bundle.Modules[0].Raw), "p = 1") {
+		t.Fatalf("expected tagged module but got: %s", u.Bundle.Modules[0].Raw)
+	}
+}
+
+func TestGitLoaderErrors(t *testing.T) {
+
+	repo := newTestGitRepo(t)
+	ctx := context.Background()
+
+	repo.commit("main", map[string]string{"x.rego": "package x\np = "})
+
+	tests := []struct {
+		note string
+		git  GitConfig
+		err  string
+	}{
+		{
+			note: "unknown ref",
+			git:  GitConfig{URL: repo.bare, Ref: "missing"},
+			err:  "git fetch failed",
+		},
+		{
+			note: "transport not allowed",
+			git:  GitConfig{URL: "ext::sh -c false", Ref: "main"},
+			err:  "transport 'ext' not allowed",
+		},
+		{
+			note: "unknown subdirectory",
+			git:  GitConfig{URL: repo.bare, Ref: "main", Subdir: "missing"},
+			err:  "git archive failed",
+		},
+		{
+			note: "parse error",
+			git:  GitConfig{URL: repo.bare, Ref: "main"},
+			err:  "rego_parse_error",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			updates := &testGitUpdates{}
+			gl := newTestGitLoader(t, tc.git, updates)
+
+			err := gl.Trigger(ctx)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q but got: %v", tc.err, err)
+			}
+
+			if u := updates.last(t); u.Error == nil || u.Bundle != nil {
+				t.Fatalf("expected error update but got: %+v", u)
+			}
+		})
+	}
+}
+
+func TestGitConfigValidation(t *testing.T) {
+
+	tests := []struct {
+		git    GitConfig
+		subdir string
+		err    string
+	}{
+		{git: GitConfig{}, err: "missing git repository url"},
+		{git: GitConfig{URL: "x", Ref: "--upload-pack=x"}, err: `invalid git ref "--upload-pack=x"`},
+		{git: GitConfig{URL: "x", Subdir: "../x"}, err: `invalid git subdirectory "../x"`},
+		{git: GitConfig{URL: "x", Subdir: "a/./b"}, err: `invalid git subdirectory "a/./b"`},
+		{git: GitConfig{URL: "x", Subdir: "/a/b/"}, subdir: "a/b"},
+	}
+
+	for _, tc := range tests {
+		err := tc.git.validateAndInjectDefaults()
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("expected error %q but got: %v", tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		} else if tc.git.Subdir != tc.subdir || tc.git.Ref != defaultGitRef {
+			t.Errorf("unexpected defaults: %+v", tc.git)
+		}
+	}
+}
+
+func TestPluginGitSourceStatus(t *testing.T) {
+
+	repo := newTestGitRepo(t)
+	ctx := context.Background()
+
+	sha := repo.commit("main", map[string]string{"authz/authz.rego": "package authz\nallow = true"})
+
+	manager := getTestManager()
+
+	config, err := NewConfigBuilder().
+		WithBytes([]byte(`{"authz": {"git": {"url": "` + filepath.ToSlash(repo.bare) + `", "ref": "main"}, "trigger": "manual"}}`)).
+		Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.Stop(ctx)
+
+	if err := plugin.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	status := plugin.status["authz"]
+	if status.ActiveRevision != sha || status.Code != "" {
+		t.Fatalf("expected active revision %v but got: %+v", sha, status)
+	}
+
+	ensurePluginState(t, plugin, plugins.StateOK)
+}
+
+func TestPluginGitSourcePersistence(t *testing.T) {
+
+	repo := newTestGitRepo(t)
+	ctx := context.Background()
+
+	sha := repo.commit("main", map[string]string{"authz/authz.rego": "package authz\nallow = true"})
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newPlugin := func(raw string, keys map[string]*keys.Config) *Plugin {
+		t.Helper()
+		config, err := NewConfigBuilder().WithBytes([]byte(raw)).WithKeyConfigs(keys).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		plugin := New(config, getTestManager())
+		plugin.bundlePersistPath = dir
+		return plugin
+	}
+
+	raw := `{"authz": {"git": {"url": "` + filepath.ToSlash(repo.bare) + `", "ref": "main"}, "trigger": "manual", "persist": true}}`
+
+	plugin := newPlugin(raw, nil)
+	plugin.initDownloaders()
+
+	if err := plugin.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := plugin.status["authz"]; status.ActiveRevision != sha || status.Code != "" {
+		t.Fatalf("expected active revision %v but got: %+v", sha, status)
+	}
+
+	plugin.downloaders["authz"].Stop(ctx)
+
+	// the activated commit is rebuilt from the persisted repository
+	plugin = newPlugin(raw, nil)
+	plugin.loadAndActivateBundlesFromDisk(ctx)
+
+	if status := plugin.status["authz"]; status.ActiveRevision != sha || status.Code != "" {
+		t.Fatalf("expected active revision %v but got: %+v", sha, status)
+	}
+
+	// and verified like a downloaded bundle
+	signed := `{"authz": {"git": {"url": "` + filepath.ToSlash(repo.bare) + `", "ref": "main"}, "trigger": "manual", "persist": true, "signing": {"keyid": "foo"}}}`
+
+	plugin = newPlugin(signed, map[string]*keys.Config{"foo": {Key: "secret"}})
+	plugin.loadAndActivateBundlesFromDisk(ctx)
+
+	if status := plugin.status["authz"]; status.ActiveRevision != "" || status.Message == "" {
+		t.Fatalf("expected verification error but got: %+v", status)
+	}
+}
@@ -6,10 +6,12 @@
 package bundle
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -17,6 +19,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+
 	"github.com/meta-quick/opax/ast"
 	"github.com/meta-quick/opax/bundle"
 	"github.com/meta-quick/opax/download"
@@ -64,6 +68,10 @@ type Plugin struct {
 	ready             bool
 	bundlePersistPath string
 	stopped           bool
+	shadowMtx         sync.RWMutex
+	shadow            *Shadow               // environment of the activated shadow bundle
+	shadowTrigger     storage.TriggerHandle // rebuilds the shadow environment on commits to the active store
+	shadowDone        chan struct{}
 }
 
 // New returns a new Plugin with the given config.
@@ -104,6 +112,13 @@ func Lookup(manager *plugins.Manager) *Plugin {
 // from the configured service. When a new bundle is downloaded, the data and
 // policies are extracted and inserted into storage.
 func (p *Plugin) Start(ctx context.Context) error {
+
+	// The trigger is registered before p.mtx is locked because the shadow
+	// environment is rebuilt while p.mtx is held.
+	if err := p.startShadowRefresh(ctx); err != nil {
+		return err
+	}
+
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
@@ -139,6 +154,8 @@ func (p *Plugin) Stop(ctx context.Context) {
 		p.log(name).Info("Stopping bundle loader.")
 		dl.Stop(ctx)
 	}
+
+	p.stopShadowRefresh(ctx)
 }
 
 // Reconfigure notifies the plugin that it's configuration has changed.
@@ -157,6 +174,8 @@ func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
 	newBundles, updatedBundles, deletedBundles := p.configDelta(newConfig)
 	p.config = *newConfig
 
+	p.reconfigureShadow()
+
 	if len(updatedBundles) == 0 && len(newBundles) == 0 && len(deletedBundles) == 0 {
 		// no relevant config changes
 		return
@@ -186,7 +205,14 @@ func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
 		}
 	}
 
-	// Deactivate the bundles that were removed
+	// Deactivate the bundles that were removed. Bundles that are now
+	// configured as shadow bundles are removed from the store as well.
+	for name := range updatedBundles {
+		if p.isShadow(name) {
+			deletedBundles[name] = struct{}{}
+		}
+	}
+
 	params := storage.WriteParams
 	params.Context = storage.NewContext()
 	err := storage.Txn(ctx, p.manager.Store, params, func(txn storage.Transaction) error {
@@ -316,7 +342,14 @@ func (p *Plugin) loadAndActivateBundlesFromDisk(ctx context.Context) {
 
 	for name, src := range p.config.Bundles {
 		if p.persistBundle(name) {
-			b, err := loadBundleFromDisk(p.bundlePersistPath, name, src)
+			var b *bundle.Bundle
+			var err error
+			if src.Git != nil {
+				gl := newGitLoader(name, src, filepath.Join(p.bundlePersistPath, name, "git"), nil, p.log(name))
+				b, err = gl.loadActivated(ctx)
+			} else {
+				b, err = loadBundleFromDisk(p.bundlePersistPath, name, src)
+			}
 			if err != nil {
 				p.log(name).Error("Failed to load bundle from disk: %v", err)
 				p.status[name].SetError(err)
@@ -365,6 +398,14 @@ func (p *Plugin) loadAndActivateBundlesFromDisk(ctx context.Context) {
 
 func (p *Plugin) newDownloader(name string, source *Source) Loader {
 
+	if source.Git != nil {
+		var dir string
+		if p.persistBundle(name) {
+			dir = filepath.Join(p.bundlePersistPath, name, "git")
+		}
+		return newGitLoader(name, source, dir, p.oneShot, p.log(name))
+	}
+
 	if u, err := url.Parse(source.Resource); err == nil {
 		switch u.Scheme {
 		case "file":
@@ -372,8 +413,11 @@ func (p *Plugin) newDownloader(name string, source *Source) Loader {
 				name:           name,
 				path:           u.Path,
 				bvc:            source.Signing,
+				dc:             source.Decryption,
 				sizeLimitBytes: source.SizeLimitBytes,
 				f:              p.oneShot,
+				watch:          source.Watch,
+				logger:         p.log(name),
 			}
 		}
 	}
@@ -385,11 +429,16 @@ func (p *Plugin) newDownloader(name string, source *Source) Loader {
 		// wrap the callback to include the name of the bundle that was updated
 		p.oneShot(ctx, name, u)
 	}
-	return download.New(conf, client, path).
+	d := download.New(conf, client, path).
 		WithCallback(callback).
 		WithBundleVerificationConfig(source.Signing).
+		WithDecryptionConfig(source.Decryption).
 		WithSizeLimitBytes(source.SizeLimitBytes).
 		WithBundlePersistence(p.persistBundle(name))
+	if p.persistBundle(name) {
+		d = d.WithBlobCacheDir(filepath.Join(p.bundlePersistPath, name, "oci"))
+	}
+	return d
 }
 
 func (p *Plugin) oneShot(ctx context.Context, name string, u download.Update) {
@@ -457,7 +506,12 @@ func (p *Plugin) process(ctx context.Context, name string, u download.Update) {
 		if u.Bundle.Type() == bundle.SnapshotBundleType && p.persistBundle(name) {
 			p.log(name).Debug("Persisting bundle to disk in progress.")
 
-			err := p.saveBundleToDisk(name, u.Raw)
+			var err error
+			if gl, ok := p.downloaders[name].(*gitLoader); ok {
+				err = gl.persist(ctx, u.ETag)
+			} else {
+				err = p.saveBundleToDisk(name, u.Raw)
+			}
 			if err != nil {
 				p.log(name).Error("Persisting bundle to disk failed: %v", err)
 				p.status[name].SetError(err)
@@ -470,6 +524,12 @@ func (p *Plugin) process(ctx context.Context, name string, u download.Update) {
 			p.log(name).Debug("Bundle persisted to disk successfully at path %v.", filepath.Join(p.bundlePersistPath, name))
 		}
 
+		if d, ok := p.downloaders[name].(*download.Downloader); ok {
+			if err := d.PruneBlobCache(); err != nil {
+				p.log(name).Warn("Failed to prune blob cache: %v", err)
+			}
+		}
+
 		p.status[name].SetError(nil)
 		p.status[name].SetActivateSuccess(u.Bundle.Manifest.Revision)
 
@@ -495,7 +555,11 @@ func (p *Plugin) process(ctx context.Context, name string, u download.Update) {
 func (p *Plugin) checkPluginReadiness() {
 	if !p.ready {
 		readyNow := true // optimistically
-		for _, status := range p.status {
+		for name, status := range p.status {
+			// Shadow bundles do not affect the active policies.
+			if p.isShadow(name) {
+				continue
+			}
 			if len(status.Errors) > 0 || (status.LastSuccessfulActivation == time.Time{}) {
 				readyNow = false // Not ready yet, check again on next bundle activation.
 				break
@@ -510,6 +574,10 @@ func (p *Plugin) checkPluginReadiness() {
 }
 
 func (p *Plugin) activate(ctx context.Context, name string, b *bundle.Bundle) error {
+	if p.isShadow(name) {
+		return p.activateShadow(ctx, name, b)
+	}
+
 	p.log(name).Debug("Bundle activation in progress. Opening storage transaction.")
 
 	params := storage.WriteParams
@@ -659,7 +727,7 @@ func loadBundleFromDisk(path, name string, src *Source) (*bundle.Bundle, error)
 		r := bundle.NewReader(f)
 
 		if src != nil {
-			r = r.WithBundleVerificationConfig(src.Signing)
+			r = r.WithBundleVerificationConfig(src.Signing).WithDecryptionConfig(src.Decryption)
 		}
 
 		b, err := r.Read()
@@ -694,26 +762,65 @@ type fileLoader struct {
 	name           string
 	path           string
 	bvc            *bundle.VerificationConfig
+	dc             *bundle.DecryptionConfig
 	sizeLimitBytes int64
 	f              func(context.Context, string, download.Update)
+	watch          bool
+	logger         logging.Logger
+	loadMtx        sync.Mutex // serializes loads
+	mtx            sync.Mutex // protects etag and stop
+	etag           string
+	stop           chan chan struct{}
 }
 
 func (fl *fileLoader) Start(ctx context.Context) {
+	var watcher *fsnotify.Watcher
+	var stop chan chan struct{}
+
+	if fl.watch {
+		// The watcher is set up before the initial load so that changes made
+		// while the bundle is loaded are not missed.
+		var err error
+		watcher, err = newFileWatcher(fl.path)
+		if err != nil {
+			fl.logger.Error("Failed to watch %v for changes: %v", fl.path, err)
+		} else {
+			stop = make(chan chan struct{})
+			fl.mtx.Lock()
+			fl.stop = stop
+			fl.mtx.Unlock()
+		}
+	}
+
 	go func() {
 		fl.oneShot(ctx)
+		if watcher != nil {
+			fl.loop(ctx, watcher, stop)
+		}
 	}()
 }
 
-func (*fileLoader) Stop(context.Context) {
+func (fl *fileLoader) Stop(context.Context) {
+	fl.mtx.Lock()
+	stop := fl.stop
+	fl.stop = nil
+	fl.mtx.Unlock()
 
+	if stop != nil {
+		done := make(chan struct{})
+		stop <- done
+		<-done
+	}
 }
 
-func (*fileLoader) ClearCache() {
-
+func (fl *fileLoader) ClearCache() {
+	fl.SetCache("")
 }
 
-func (*fileLoader) SetCache(string) {
-
+func (fl *fileLoader) SetCache(etag string) {
+	fl.mtx.Lock()
+	defer fl.mtx.Unlock()
+	fl.etag = etag
 }
 
 func (fl *fileLoader) Trigger(ctx context.Context) error {
@@ -722,6 +829,9 @@ func (fl *fileLoader) Trigger(ctx context.Context) error {
 }
 
 func (fl *fileLoader) oneShot(ctx context.Context) {
+	fl.loadMtx.Lock()
+	defer fl.loadMtx.Unlock()
+
 	var u download.Update
 	u.Metrics = metrics.New()
 
@@ -735,25 +845,43 @@ func (fl *fileLoader) oneShot(ctx context.Context) {
 	var reader *bundle.Reader
 
 	if info.IsDir() {
+		u.ETag, u.Error = directoryDigest(fl.path)
 		reader = bundle.NewCustomReader(bundle.NewDirectoryLoader(fl.path))
 	} else {
-		f, err := os.Open(fl.path)
-		u.Error = err
-		if err != nil {
-			fl.f(ctx, fl.name, u)
-			return
-		}
-		defer f.Close()
-		reader = bundle.NewReader(f)
+		var bs []byte
+		bs, u.Error = ioutil.ReadFile(fl.path)
+		u.ETag = fileDigest(bs)
+		reader = bundle.NewReader(bytes.NewReader(bs))
+	}
+
+	if u.Error != nil {
+		u.ETag = ""
+		fl.f(ctx, fl.name, u)
+		return
+	}
+
+	fl.mtx.Lock()
+	etag := fl.etag
+	fl.mtx.Unlock()
+
+	// Unchanged bundles are reported like bundles that were not modified on
+	// the server and are not activated again.
+	if u.ETag == etag {
+		fl.f(ctx, fl.name, u)
+		return
 	}
 
 	b, err := reader.
 		WithMetrics(u.Metrics).
 		WithBundleVerificationConfig(fl.bvc).
+		WithDecryptionConfig(fl.dc).
 		WithSizeLimitBytes(fl.sizeLimitBytes).Read()
 	u.Error = err
 	if err == nil {
 		u.Bundle = &b
 	}
+
+	fl.SetCache(u.ETag)
+
 	fl.f(ctx, fl.name, u)
 }
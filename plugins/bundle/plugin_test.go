@@ -8,6 +8,10 @@ package bundle
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
@@ -2321,6 +2325,66 @@ func TestLoadBundleFromDisk(t *testing.T) {
 	}
 }
 
+func TestLoadEncryptedBundleFromDisk(t *testing.T) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	bundleName := "foo"
+	bundleDir := filepath.Join(dir, bundleName)
+
+	err = os.MkdirAll(bundleDir, os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	b := bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: "quickbrownfaux"},
+		Data:     map[string]interface{}{"foo": map[string]interface{}{"secret": "masking-model"}},
+	}
+
+	var buf bytes.Buffer
+	bec := bundle.NewEncryptionConfig(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})), "edge", "")
+	if err := bundle.NewWriter(&buf).WithEncryptionConfig(bec).Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(bundleDir, "bundle.tar.gz"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadBundleFromDisk(dir, bundleName, &Source{}); err == nil || err.Error() != "bundle is encrypted but decryption key not provided" {
+		t.Fatal("expected decryption error but got:", err)
+	}
+
+	dc := bundle.NewDecryptionConfig(map[string]*keys.Config{
+		"edge": {PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))},
+	}, "edge")
+
+	result, err := loadBundleFromDisk(dir, bundleName, &Source{Decryption: dc})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !result.Equal(b) {
+		t.Fatal("expected the test bundle to be equal to the one loaded from disk")
+	}
+}
+
 func TestLoadSignedBundleFromDisk(t *testing.T) {
 
 	// no bundle on disk
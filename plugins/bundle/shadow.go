@@ -0,0 +1,320 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/internal/deepcopy"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
+)
+
+// Shadow is the policy environment of an activated shadow bundle. Shadow
+// bundles are activated in a separate store so that decisions can be
+// evaluated against a candidate bundle without affecting the active
+// policies. The separate store is a copy of the active store with the shadow
+// bundle activated on top. It is rebuilt when the active store changes, so
+// that decisions do not diverge because of stale data.
+type Shadow struct {
+	Name           string        // name of the shadow bundle
+	Revision       string        // revision of the activated shadow bundle
+	Store          storage.Store // copy of the active store with the shadow bundle activated
+	Compiler       *ast.Compiler // compiler for the modules in the shadow store
+	SampleRate     float64       // fraction of decisions to evaluate against the shadow bundle
+	LatencyBudget  time.Duration // max time to spend on a shadow evaluation
+	MaxConcurrency int           // max number of concurrent shadow evaluations
+
+	// bundles are the last snapshot bundle and the delta bundles activated
+	// since, in order. They are activated again when the store is rebuilt.
+	bundles []*bundle.Bundle
+}
+
+// Shadow returns the environment of the activated shadow bundle. If no
+// shadow bundle is configured or it has not been activated yet, nil is
+// returned. The returned value must not be modified.
+func (p *Plugin) Shadow() *Shadow {
+	p.shadowMtx.RLock()
+	defer p.shadowMtx.RUnlock()
+	return p.shadow
+}
+
+func (p *Plugin) isShadow(name string) bool {
+	src := p.config.Bundles[name]
+	return src != nil && src.Shadow != nil
+}
+
+// activateShadow activates the shadow bundle in a copy of the active store.
+// Delta bundles are activated after the bundles of the current shadow
+// environment.
+func (p *Plugin) activateShadow(ctx context.Context, name string, b *bundle.Bundle) error {
+	p.log(name).Debug("Shadow bundle activation in progress.")
+
+	config := p.config.Bundles[name].Shadow
+
+	p.shadowMtx.RLock()
+	current := p.shadow
+	p.shadowMtx.RUnlock()
+
+	bundles := []*bundle.Bundle{b}
+
+	if b.Type() == bundle.DeltaBundleType {
+		if current == nil || current.Name != name {
+			return fmt.Errorf("delta bundle requires an activated shadow bundle")
+		}
+		bundles = append(append([]*bundle.Bundle{}, current.bundles...), b)
+	}
+
+	store, compiler, err := p.buildShadow(ctx, name, bundles, p.status[name].Metrics)
+	if err != nil {
+		return err
+	}
+
+	p.shadowMtx.Lock()
+	p.shadow = &Shadow{
+		Name:           name,
+		Revision:       b.Manifest.Revision,
+		Store:          store,
+		Compiler:       compiler,
+		SampleRate:     *config.SampleRate,
+		LatencyBudget:  time.Duration(*config.LatencyBudgetMS) * time.Millisecond,
+		MaxConcurrency: *config.MaxConcurrency,
+		bundles:        bundles,
+	}
+	p.shadowMtx.Unlock()
+
+	return nil
+}
+
+// buildShadow returns a new store with the data and policies of the active
+// store and the bundles activated on top, and the compiler for its modules.
+func (p *Plugin) buildShadow(ctx context.Context, name string, bundles []*bundle.Bundle, m metrics.Metrics) (storage.Store, *ast.Compiler, error) {
+
+	store, compiler := inmem.New(), ast.NewCompiler()
+
+	params := storage.WriteParams
+	params.Context = storage.NewContext()
+
+	err := storage.Txn(ctx, store, params, func(txn storage.Transaction) error {
+		if err := p.copyActiveStore(ctx, store, txn); err != nil {
+			return err
+		}
+
+		compiler = compiler.WithPathConflictsCheck(storage.NonEmpty(ctx, store, txn)).
+			WithEnablePrintStatements(p.manager.EnablePrintStatements())
+
+		for _, b := range bundles {
+			// The bundles are activated again on every rebuild, so the
+			// store must not share their data.
+			err := bundle.Activate(&bundle.ActivateOpts{
+				Ctx:      ctx,
+				Store:    store,
+				Txn:      txn,
+				TxnCtx:   params.Context,
+				Compiler: compiler,
+				Metrics:  m,
+				Bundles:  map[string]*bundle.Bundle{name: copyShadowBundle(b)},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return store, compiler, nil
+}
+
+func copyShadowBundle(b *bundle.Bundle) *bundle.Bundle {
+	cpy := b.Copy()
+	if len(cpy.Patch.Data) > 0 {
+		ops := make([]bundle.PatchOperation, len(cpy.Patch.Data))
+		for i, op := range cpy.Patch.Data {
+			op.Value = deepcopy.DeepCopy(op.Value)
+			ops[i] = op
+		}
+		cpy.Patch.Data = ops
+	}
+	return &cpy
+}
+
+// startShadowRefresh registers a trigger on the active store and rebuilds
+// the shadow environment after the active store changes. Commits that happen
+// while the environment is rebuilt are coalesced into one more rebuild.
+func (p *Plugin) startShadowRefresh(ctx context.Context) error {
+
+	stale := make(chan struct{}, 1)
+
+	err := storage.Txn(ctx, p.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		var err error
+		p.shadowTrigger, err = p.manager.Store.Register(ctx, txn, storage.TriggerConfig{
+			OnCommit: func(context.Context, storage.Transaction, storage.TriggerEvent) {
+				select {
+				case stale <- struct{}{}:
+				default:
+				}
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	p.shadowDone = make(chan struct{})
+
+	go func(done chan struct{}) {
+		for {
+			select {
+			case <-done:
+				return
+			case <-stale:
+				p.refreshShadow(context.Background())
+			}
+		}
+	}(p.shadowDone)
+
+	return nil
+}
+
+func (p *Plugin) stopShadowRefresh(ctx context.Context) {
+	if p.shadowTrigger == nil {
+		return
+	}
+
+	_ = storage.Txn(ctx, p.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		p.shadowTrigger.Unregister(ctx, txn)
+		return nil
+	})
+	p.shadowTrigger = nil
+
+	close(p.shadowDone)
+	p.shadowDone = nil
+}
+
+// refreshShadow rebuilds the shadow environment from the active store. If the
+// environment cannot be rebuilt, the current one is kept.
+func (p *Plugin) refreshShadow(ctx context.Context) {
+
+	// Shadow bundles are activated while p.mtx is held.
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	current := p.Shadow()
+	if current == nil {
+		return
+	}
+
+	store, compiler, err := p.buildShadow(ctx, current.Name, current.bundles, metrics.New())
+	if err != nil {
+		p.log(current.Name).Error("Failed to refresh shadow bundle: %v", err)
+		return
+	}
+
+	p.shadowMtx.Lock()
+	defer p.shadowMtx.Unlock()
+
+	// The shadow bundle may have been discarded in the meantime.
+	if p.shadow == nil || p.shadow.Name != current.Name {
+		return
+	}
+
+	shadow := *p.shadow
+	shadow.Store = store
+	shadow.Compiler = compiler
+	p.shadow = &shadow
+	p.log(current.Name).Debug("Shadow bundle refreshed.")
+}
+
+// copyActiveStore writes the data and policies of the active store to the
+// shadow store. The manifests of the active bundles are not copied, so the
+// shadow bundle may replace active bundles with overlapping roots. Their data
+// and policies are erased when the shadow bundle is activated.
+func (p *Plugin) copyActiveStore(ctx context.Context, store storage.Store, txn storage.Transaction) error {
+
+	var data map[string]interface{}
+	policies := map[string][]byte{}
+
+	err := storage.Txn(ctx, p.manager.Store, storage.TransactionParams{}, func(active storage.Transaction) error {
+		value, err := p.manager.Store.Read(ctx, active, storage.Path{})
+		if err != nil {
+			return err
+		}
+
+		// The data of the active store must not be modified by writes to
+		// the shadow store.
+		data, _ = deepcopy.DeepCopy(value).(map[string]interface{})
+
+		ids, err := p.manager.Store.ListPolicies(ctx, active)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			bs, err := p.manager.Store.GetPolicy(ctx, active, id)
+			if err != nil {
+				return err
+			}
+			policies[id] = bs
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if system, ok := data["system"].(map[string]interface{}); ok {
+		delete(system, "bundles")
+	}
+
+	if data != nil {
+		if err := store.Write(ctx, txn, storage.AddOp, storage.Path{}, data); err != nil {
+			return err
+		}
+	}
+
+	for id, bs := range policies {
+		if err := store.UpsertPolicy(ctx, txn, id, bs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconfigureShadow applies the shadow settings of the current config to the
+// shadow environment. The environment is discarded if the bundle is no longer
+// configured as shadow bundle.
+func (p *Plugin) reconfigureShadow() {
+	p.shadowMtx.Lock()
+	defer p.shadowMtx.Unlock()
+
+	if p.shadow == nil {
+		return
+	}
+
+	if !p.isShadow(p.shadow.Name) {
+		p.log(p.shadow.Name).Info("Shadow bundle configuration removed. Discarding shadow bundle.")
+		p.shadow = nil
+		return
+	}
+
+	config := p.config.Bundles[p.shadow.Name].Shadow
+	shadow := *p.shadow
+	shadow.SampleRate = *config.SampleRate
+	shadow.LatencyBudget = time.Duration(*config.LatencyBudgetMS) * time.Millisecond
+	shadow.MaxConcurrency = *config.MaxConcurrency
+	p.shadow = &shadow
+}
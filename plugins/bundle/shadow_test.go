@@ -0,0 +1,247 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/download"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/rego"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/util"
+)
+
+func TestPluginOneShotShadowBundle(t *testing.T) {
+
+	ctx := context.Background()
+	manager := getTestManager()
+
+	config, err := ParseBundlesConfig([]byte(`{
+		"authz": {"resource": "file:///authz.tar.gz"},
+		"candidate": {"resource": "file:///candidate.tar.gz", "shadow": {"sample_rate": 0.5, "latency_budget_ms": 20}}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+	plugin.initDownloaders()
+
+	plugin.oneShot(ctx, "candidate", download.Update{Bundle: testShadowBundle("r2", `package authz
+
+allow = true`), Metrics: metrics.New()})
+
+	// The shadow bundle does not make the plugin ready.
+	ensurePluginState(t, plugin, plugins.StateNotReady)
+
+	plugin.oneShot(ctx, "authz", download.Update{Bundle: testShadowBundle("r1", `package authz
+
+allow = false`), Metrics: metrics.New()})
+
+	ensurePluginState(t, plugin, plugins.StateOK)
+
+	txn := storage.NewTransactionOrDie(ctx, manager.Store)
+	data, err := manager.Store.Read(ctx, txn, storage.MustParsePath("/system/bundles"))
+	manager.Store.Abort(ctx, txn)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, ok := data.(map[string]interface{})["candidate"]; ok {
+		t.Fatal("Expected shadow bundle not to be activated in the store")
+	}
+
+	shadow := plugin.Shadow()
+	if shadow == nil {
+		t.Fatal("Expected shadow bundle to be activated")
+	}
+
+	if shadow.Name != "candidate" || shadow.Revision != "r2" || shadow.SampleRate != 0.5 || shadow.LatencyBudget != 20*time.Millisecond {
+		t.Fatalf("Unexpected shadow: %+v", shadow)
+	}
+
+	rs, err := rego.New(
+		rego.Query("data.authz.allow"),
+		rego.Store(shadow.Store),
+		rego.Compiler(shadow.Compiler),
+	).Eval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rs) != 1 || !reflect.DeepEqual(rs[0].Expressions[0].Value, true) {
+		t.Fatalf("Unexpected shadow result: %v", rs)
+	}
+
+	// Removing the shadow configuration discards the shadow bundle.
+	config, err = ParseBundlesConfig([]byte(`{"authz": {"resource": "file:///authz.tar.gz"}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin.Reconfigure(ctx, config)
+
+	if plugin.Shadow() != nil {
+		t.Fatal("Expected shadow bundle to be discarded")
+	}
+}
+
+func TestPluginShadowBundleOverlaysActiveStore(t *testing.T) {
+
+	ctx := context.Background()
+	manager := getTestManager()
+
+	err := storage.Txn(ctx, manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		return manager.Store.Write(ctx, txn, storage.AddOp, storage.MustParsePath("/users"), []interface{}{"alice"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ParseBundlesConfig([]byte(`{
+		"lib": {"resource": "file:///lib.tar.gz"},
+		"authz": {"resource": "file:///authz.tar.gz"},
+		"candidate": {"resource": "file:///candidate.tar.gz", "shadow": {}}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+	plugin.initDownloaders()
+
+	lib := testShadowBundle("r1", `package lib
+
+users = data.users`)
+	lib.Manifest.Roots = &[]string{"lib"}
+	lib.Modules[0].Path = "/lib.rego"
+
+	plugin.oneShot(ctx, "lib", download.Update{Bundle: lib, Metrics: metrics.New()})
+	plugin.oneShot(ctx, "authz", download.Update{Bundle: testShadowBundle("r1", `package authz
+
+allow = false`), Metrics: metrics.New()})
+
+	// The shadow bundle replaces the active bundle with the same roots and
+	// uses the data and policies of the other bundles.
+	plugin.oneShot(ctx, "candidate", download.Update{Bundle: testShadowBundle("r2", `package authz
+
+allow { data.lib.users[_] == input.user }`), Metrics: metrics.New()})
+
+	shadow := plugin.Shadow()
+	if shadow == nil {
+		t.Fatal("Expected shadow bundle to be activated")
+	}
+
+	rs, err := rego.New(
+		rego.Query("data.authz.allow"),
+		rego.Input(map[string]interface{}{"user": "alice"}),
+		rego.Store(shadow.Store),
+		rego.Compiler(shadow.Compiler),
+	).Eval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rs) != 1 || !reflect.DeepEqual(rs[0].Expressions[0].Value, true) {
+		t.Fatalf("Unexpected shadow result: %v", rs)
+	}
+
+	// Writes to the shadow store do not affect the active store.
+	txn := storage.NewTransactionOrDie(ctx, manager.Store)
+	defer manager.Store.Abort(ctx, txn)
+
+	if _, err := manager.Store.Read(ctx, txn, storage.MustParsePath("/system/bundles/authz")); err != nil {
+		t.Fatalf("Expected active bundle to remain in the store: %v", err)
+	}
+
+	if _, err := manager.Store.Read(ctx, txn, storage.MustParsePath("/system/bundles/candidate")); !storage.IsNotFound(err) {
+		t.Fatalf("Expected shadow bundle not to be activated in the store but got: %v", err)
+	}
+}
+
+func TestPluginShadowBundleRefreshesOnActiveStoreCommit(t *testing.T) {
+
+	ctx := context.Background()
+	manager := getTestManager()
+
+	config, err := ParseBundlesConfig([]byte(`{
+		"candidate": {"resource": "file:///candidate.tar.gz", "shadow": {}}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+	plugin.initDownloaders()
+
+	if err := plugin.startShadowRefresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.stopShadowRefresh(ctx)
+
+	plugin.oneShot(ctx, "candidate", download.Update{Bundle: testShadowBundle("r1", `package authz
+
+allow { data.users[_] == input.user }`), Metrics: metrics.New()})
+
+	eval := func() interface{} {
+		shadow := plugin.Shadow()
+		if shadow == nil {
+			t.Fatal("Expected shadow bundle to be activated")
+		}
+		rs, err := rego.New(
+			rego.Query("data.authz.allow"),
+			rego.Input(map[string]interface{}{"user": "alice"}),
+			rego.Store(shadow.Store),
+			rego.Compiler(shadow.Compiler),
+		).Eval(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(rs) == 0 {
+			return nil
+		}
+		return rs[0].Expressions[0].Value
+	}
+
+	if v := eval(); v != nil {
+		t.Fatalf("Expected undefined result but got: %v", v)
+	}
+
+	// Writes to the active store are applied to the shadow environment.
+	err = storage.Txn(ctx, manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		return manager.Store.Write(ctx, txn, storage.AddOp, storage.MustParsePath("/users"), []interface{}{"alice"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for eval() != true {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for shadow environment to be refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if shadow := plugin.Shadow(); shadow.Revision != "r1" {
+		t.Fatalf("Unexpected shadow: %+v", shadow)
+	}
+}
+
+func testShadowBundle(revision string, module string) *bundle.Bundle {
+	b := bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: revision, Roots: &[]string{"authz"}},
+		Data:     util.MustUnmarshalJSON([]byte(`{}`)).(map[string]interface{}),
+		Modules: []bundle.ModuleFile{
+			{
+				Path:   "/authz.rego",
+				Parsed: ast.MustParseModule(module),
+				Raw:    []byte(module),
+			},
+		},
+	}
+	b.Manifest.Init()
+	return &b
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileWatchDebounce is the time a watched bundle must remain unchanged before
+// it is loaded, so that bundles written file by file are not loaded halfway.
+const fileWatchDebounce = time.Millisecond * 250
+
+// newFileWatcher returns a watcher for the bundle directory or tarball at
+// path. The parent directory is watched as well so that bundles which are
+// replaced (e.g., renamed into place or swapped via symlinks) or which do
+// not exist yet are picked up.
+func newFileWatcher(path string) (*fsnotify.Watcher, error) {
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	if err := addDirectoryWatches(watcher, path); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return watcher, nil
+}
+
+// addDirectoryWatches adds path and all directories below it to the watcher
+// if path is a directory. Watches on directories that are removed are removed
+// by the watcher itself.
+func addDirectoryWatches(watcher *fsnotify.Watcher, path string) error {
+
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return nil
+	}
+
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(p)
+		}
+		return nil
+	})
+}
+
+// loop reloads the bundle after changes have been observed by the watcher and
+// no further changes were made for fileWatchDebounce. It returns when a
+// channel is received on stop, which is closed in response.
+func (fl *fileLoader) loop(ctx context.Context, watcher *fsnotify.Watcher, stop chan chan struct{}) {
+
+	defer watcher.Close()
+
+	var timer *time.Timer
+	var pending <-chan time.Time
+
+	for {
+		select {
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			fl.logger.Debug("Registered file event: %v.", evt)
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(fileWatchDebounce)
+			pending = timer.C
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			fl.logger.Error("Failed to watch %v for changes: %v", fl.path, err)
+		case <-pending:
+			timer, pending = nil, nil
+			if err := addDirectoryWatches(watcher, fl.path); err != nil {
+				fl.logger.Error("Failed to watch %v for changes: %v", fl.path, err)
+			}
+			fl.oneShot(ctx)
+		case done := <-stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			close(done)
+			return
+		}
+	}
+}
+
+// fileDigest returns the digest of a bundle tarball. It is used as the etag
+// of bundles loaded from tarballs.
+func fileDigest(bs []byte) string {
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
+
+// directoryDigest returns the digest of the names and contents of all files
+// below path. It is used as the etag of bundles loaded from directories.
+func directoryDigest(path string) (string, error) {
+
+	var files []string
+
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(files)
+
+	h := sha256.New()
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return "", err
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+
+		fh := sha256.New()
+		_, err = io.Copy(fh, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "%s\x00%x\n", filepath.ToSlash(rel), fh.Sum(nil))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/util/test"
+)
+
+// startWatchingPlugin starts a plugin with a single watched file:// bundle
+// source and returns a channel that receives its status updates.
+func startWatchingPlugin(t *testing.T, path string) (*Plugin, chan Status) {
+	t.Helper()
+
+	p := New(&Config{Bundles: map[string]*Source{
+		"test": {
+			SizeLimitBytes: bundle.DefaultSizeLimitBytes,
+			Resource:       "file://" + path,
+			Watch:          true,
+		},
+	}}, getTestManager())
+
+	ch := make(chan Status, 100)
+	p.Register("test", func(s Status) {
+		ch <- s
+	})
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Stop(context.Background()) })
+
+	return p, ch
+}
+
+func waitForStatus(t *testing.T, ch chan Status, f func(Status) bool) Status {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case s := <-ch:
+			if f(s) {
+				return s
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for bundle status")
+		}
+	}
+}
+
+func activatedRevision(rev string) func(Status) bool {
+	return func(s Status) bool {
+		return s.Code == "" && s.ActiveRevision == rev
+	}
+}
+
+func TestPluginFileWatchDirectory(t *testing.T) {
+	test.WithTempFS(map[string]string{
+		"bundle/.manifest":   `{"revision": "1", "roots": ["test"]}`,
+		"bundle/x/test.rego": "package test\np := 1",
+	}, func(dir string) {
+
+		root := filepath.Join(dir, "bundle")
+		_, ch := startWatchingPlugin(t, root)
+
+		first := waitForStatus(t, ch, activatedRevision("1"))
+
+		// rewriting unchanged files does not activate the bundle again
+		writeFile(t, filepath.Join(root, "x", "test.rego"), "package test\np := 1")
+
+		s := waitForStatus(t, ch, func(Status) bool { return true })
+		if s.ActiveRevision != "1" || !s.LastSuccessfulActivation.Equal(first.LastSuccessfulActivation) {
+			t.Fatalf("expected bundle not to be activated again but got: %+v", s)
+		}
+
+		// files in new directories are picked up
+		writeFile(t, filepath.Join(root, "y", "z", "other.rego"), "package test.other\nq := 1")
+		writeFile(t, filepath.Join(root, ".manifest"), `{"revision": "2", "roots": ["test"]}`)
+
+		waitForStatus(t, ch, activatedRevision("2"))
+
+		// failed activations are reported and the previous bundle remains active
+		writeFile(t, filepath.Join(root, "y", "z", "other.rego"), "package test.other\nq := ")
+		writeFile(t, filepath.Join(root, ".manifest"), `{"revision": "3", "roots": ["test"]}`)
+
+		s = waitForStatus(t, ch, func(s Status) bool { return s.Code != "" })
+		if s.ActiveRevision != "2" {
+			t.Fatalf("expected previous revision to remain active but got: %+v", s)
+		}
+
+		writeFile(t, filepath.Join(root, "y", "z", "other.rego"), "package test.other\nq := 2")
+
+		waitForStatus(t, ch, activatedRevision("3"))
+	})
+}
+
+func TestPluginFileWatchTarball(t *testing.T) {
+	test.WithTempFS(map[string]string{}, func(dir string) {
+
+		path := filepath.Join(dir, "bundle.tar.gz")
+		writeBundle(t, path, "1", "package test\np := 1")
+
+		p, ch := startWatchingPlugin(t, path)
+
+		waitForStatus(t, ch, activatedRevision("1"))
+
+		// bundles replaced by renaming them into place are picked up
+		writeBundle(t, path+".tmp", "2", "package test\np := 2")
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+
+		waitForStatus(t, ch, activatedRevision("2"))
+
+		ctx := context.Background()
+		txn := storage.NewTransactionOrDie(ctx, p.manager.Store)
+		defer p.manager.Store.Abort(ctx, txn)
+
+		ids, err := p.manager.Store.ListPolicies(ctx, txn)
+		if err != nil || len(ids) != 1 {
+			t.Fatalf("expected one policy but got: %v (err: %v)", ids, err)
+		}
+
+		bs, err := p.manager.Store.GetPolicy(ctx, txn, ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Contains(bs, []byte("p := 2")) {
+			t.Fatalf("expected updated policy but got: %s", bs)
+		}
+	})
+}
+
+func TestPluginFileWatchMissingBundle(t *testing.T) {
+	test.WithTempFS(map[string]string{}, func(dir string) {
+
+		root := filepath.Join(dir, "bundle")
+		_, ch := startWatchingPlugin(t, root)
+
+		waitForStatus(t, ch, func(s Status) bool { return s.Code != "" })
+
+		writeFile(t, filepath.Join(root, ".manifest"), `{"revision": "1"}`)
+
+		waitForStatus(t, ch, activatedRevision("1"))
+	})
+}
+
+func TestConfigWatchRequiresFileResource(t *testing.T) {
+	_, err := NewConfigBuilder().
+		WithBytes([]byte(`{"b1": {"service": "s1", "watch": true}}`)).
+		WithServices([]string{"s1"}).
+		Parse()
+	if err == nil || err.Error() != `invalid configuration for bundle "b1": watch requires a file:// resource` {
+		t.Fatalf("expected watch error but got: %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeBundle(t *testing.T, path, revision, module string) {
+	t.Helper()
+	b := bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: revision},
+		Data:     map[string]interface{}{},
+		Modules: []bundle.ModuleFile{
+			{
+				URL:    "/test/test.rego",
+				Path:   "/test/test.rego",
+				Parsed: ast.MustParseModule(module),
+				Raw:    []byte(module),
+			},
+		},
+	}
+	var buf bytes.Buffer
+	if err := bundle.NewWriter(&buf).Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPluginFileWatchStopDuringLoad(t *testing.T) {
+	test.WithTempFS(map[string]string{
+		"bundle/.manifest": `{"revision": "1"}`,
+	}, func(dir string) {
+
+		p := New(&Config{Bundles: map[string]*Source{
+			"test": {
+				SizeLimitBytes: bundle.DefaultSizeLimitBytes,
+				Resource:       "file://" + filepath.Join(dir, "bundle"),
+				Watch:          true,
+			},
+		}}, getTestManager())
+
+		ctx := context.Background()
+		if err := p.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// stopping while the initial load may still be in progress must not
+		// block
+		done := make(chan struct{})
+		go func() {
+			p.Stop(ctx)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for plugin to stop")
+		}
+	})
+}
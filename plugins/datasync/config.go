@@ -0,0 +1,231 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package datasync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/download"
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/util"
+)
+
+const (
+	// FormatJSON indicates that the response body contains a single JSON value.
+	FormatJSON = "json"
+
+	// FormatNDJSON indicates that the response body contains newline delimited
+	// JSON values. The values are collected into an array.
+	FormatNDJSON = "ndjson"
+
+	// defaultSizeLimitBytes is the default limit on the size of response bodies.
+	defaultSizeLimitBytes = int64(1024 * 1024 * 1024)
+
+	// defaultStalenessFactor is multiplied with the maximum polling delay to
+	// obtain the default staleness threshold.
+	defaultStalenessFactor = 3
+)
+
+// Config represents the configuration of the plugin. It maps the names of
+// the data sources to their configuration.
+type Config struct {
+	Sources map[string]*Source
+}
+
+// Source is a configured HTTP service to synchronize data from.
+type Source struct {
+	download.Config
+
+	Service             string `json:"service"`
+	Resource            string `json:"resource"`
+	Path                string `json:"path"`                            // storage path to write the data to
+	Query               string `json:"query,omitempty"`                 // optional query that transforms the response (available as `input`)
+	Format              string `json:"format,omitempty"`                // format of the response body: json or ndjson
+	MaxStalenessSeconds *int64 `json:"max_staleness_seconds,omitempty"` // age after which synchronized data is reported as stale
+	SizeLimitBytes      int64  `json:"size_limit_bytes,omitempty"`
+
+	path         storage.Path
+	maxStaleness time.Duration
+}
+
+// StoragePath returns the parsed storage path that the data is written to.
+func (s *Source) StoragePath() storage.Path {
+	return s.path
+}
+
+// ConfigBuilder assists in the construction of the plugin configuration.
+type ConfigBuilder struct {
+	raw      []byte
+	services []string
+	trigger  *plugins.TriggerMode
+}
+
+// NewConfigBuilder returns a new ConfigBuilder to build and parse the plugin config.
+func NewConfigBuilder() *ConfigBuilder {
+	return &ConfigBuilder{}
+}
+
+// WithBytes sets the raw plugin config.
+func (b *ConfigBuilder) WithBytes(config []byte) *ConfigBuilder {
+	b.raw = config
+	return b
+}
+
+// WithServices sets the services that serve the data.
+func (b *ConfigBuilder) WithServices(services []string) *ConfigBuilder {
+	b.services = services
+	return b
+}
+
+// WithTriggerMode sets the plugin trigger mode.
+func (b *ConfigBuilder) WithTriggerMode(trigger *plugins.TriggerMode) *ConfigBuilder {
+	b.trigger = trigger
+	return b
+}
+
+// Parse validates the config and injects default values.
+func (b *ConfigBuilder) Parse() (*Config, error) {
+	if b.raw == nil {
+		return nil, nil
+	}
+
+	var sources map[string]*Source
+
+	if err := util.Unmarshal(b.raw, &sources); err != nil {
+		return nil, err
+	}
+
+	c := Config{Sources: map[string]*Source{}}
+	for name, source := range sources {
+		if source != nil {
+			c.Sources[name] = source
+		}
+	}
+
+	if err := c.validateAndInjectDefaults(b.services, b.trigger); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// ParseConfig validates the config and injects default values.
+func ParseConfig(config []byte, services []string) (*Config, error) {
+	t := plugins.DefaultTriggerMode
+	return NewConfigBuilder().WithBytes(config).WithServices(services).WithTriggerMode(&t).Parse()
+}
+
+func (c *Config) validateAndInjectDefaults(services []string, trigger *plugins.TriggerMode) error {
+
+	names := make([]string, 0, len(c.Sources))
+	for name := range c.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := c.Sources[name].validateAndInjectDefaults(services, trigger); err != nil {
+			return fmt.Errorf("invalid configuration for data source %q: %w", name, err)
+		}
+	}
+
+	// Sources overwrite the documents under their paths, so they must not
+	// share any part of the data tree with each other.
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			a, b := c.Sources[names[i]], c.Sources[names[j]]
+			if bundle.RootPathsOverlap(rootPath(a.path), rootPath(b.path)) {
+				return fmt.Errorf("data sources %q and %q have overlapping paths %v and %v", names[i], names[j], a.path, b.path)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Source) validateAndInjectDefaults(services []string, trigger *plugins.TriggerMode) error {
+
+	svc, err := getServiceFromList(s.Service, services)
+	if err != nil {
+		return err
+	}
+	s.Service = svc
+
+	if s.Resource == "" {
+		return fmt.Errorf("missing resource")
+	}
+
+	path, ok := storage.ParsePathEscaped(s.Path)
+	if !ok || !strings.HasPrefix(s.Path, "/") {
+		return fmt.Errorf("invalid path %q", s.Path)
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("path must not be the document root")
+	}
+	s.path = path
+
+	if s.Query != "" {
+		if _, err := ast.ParseBody(s.Query); err != nil {
+			return fmt.Errorf("invalid query: %w", err)
+		}
+	}
+
+	switch s.Format {
+	case "":
+		s.Format = FormatJSON
+	case FormatJSON, FormatNDJSON:
+	default:
+		return fmt.Errorf("invalid format %q (want %q or %q)", s.Format, FormatJSON, FormatNDJSON)
+	}
+
+	t, err := plugins.ValidateAndInjectDefaultsForTriggerMode(trigger, s.Trigger)
+	if err != nil {
+		return err
+	}
+	s.Trigger = t
+
+	if err := s.Config.ValidateAndInjectDefaults(); err != nil {
+		return err
+	}
+
+	if s.MaxStalenessSeconds != nil {
+		if *s.MaxStalenessSeconds < 1 {
+			return fmt.Errorf("'max_staleness_seconds' must be at least 1")
+		}
+		s.maxStaleness = time.Duration(*s.MaxStalenessSeconds) * time.Second
+	} else {
+		// The polling delays have been scaled to nanoseconds above.
+		s.maxStaleness = time.Duration(*s.Polling.MaxDelaySeconds) * defaultStalenessFactor
+	}
+
+	if s.SizeLimitBytes <= 0 {
+		s.SizeLimitBytes = defaultSizeLimitBytes
+	}
+
+	return nil
+}
+
+func getServiceFromList(service string, services []string) (string, error) {
+	if service == "" && len(services) != 0 {
+		return services[0], nil
+	}
+	for _, svc := range services {
+		if svc == service {
+			return service, nil
+		}
+	}
+	return service, fmt.Errorf("service name %q not found", service)
+}
+
+// rootPath returns the path in the format used for bundle roots.
+func rootPath(path storage.Path) string {
+	return strings.Join(path, "/")
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package datasync
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/storage"
+)
+
+func TestParseConfig(t *testing.T) {
+
+	config, err := ParseConfig([]byte(`{
+		"roles": {
+			"resource": "/v1/roles",
+			"path": "/roles/users",
+			"query": "{u.id: u.roles | u := input[_]}",
+			"format": "ndjson",
+			"polling": {"min_delay_seconds": 10, "max_delay_seconds": 20}
+		},
+		"blocklist": {
+			"service": "b",
+			"resource": "/blocklist",
+			"path": "/roles/blocked",
+			"max_staleness_seconds": 5
+		}
+	}`), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := config.Sources["roles"]
+	if roles.Service != "a" || roles.Format != FormatNDJSON || !roles.StoragePath().Equal(storage.MustParsePath("/roles/users")) {
+		t.Fatalf("unexpected source: %+v", roles)
+	}
+	if roles.maxStaleness != 60*time.Second {
+		t.Fatalf("expected default staleness of 60s but got %v", roles.maxStaleness)
+	}
+	if *roles.Trigger != plugins.DefaultTriggerMode || roles.SizeLimitBytes != defaultSizeLimitBytes {
+		t.Fatalf("expected defaults to be injected but got: %+v", roles)
+	}
+
+	blocklist := config.Sources["blocklist"]
+	if blocklist.Service != "b" || blocklist.Format != FormatJSON || blocklist.maxStaleness != 5*time.Second {
+		t.Fatalf("unexpected source: %+v", blocklist)
+	}
+
+	if config, err := ParseConfig(nil, nil); config != nil || err != nil {
+		t.Fatalf("expected no config but got %v, %v", config, err)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		config  string
+		trigger plugins.TriggerMode
+		wantErr string
+	}{
+		{
+			note:    "unknown service",
+			config:  `{"x": {"service": "c", "resource": "/x", "path": "/x"}}`,
+			wantErr: `invalid configuration for data source "x": service name "c" not found`,
+		},
+		{
+			note:    "missing resource",
+			config:  `{"x": {"path": "/x"}}`,
+			wantErr: "missing resource",
+		},
+		{
+			note:    "relative path",
+			config:  `{"x": {"resource": "/x", "path": "x"}}`,
+			wantErr: `invalid path "x"`,
+		},
+		{
+			note:    "document root",
+			config:  `{"x": {"resource": "/x", "path": "/"}}`,
+			wantErr: "path must not be the document root",
+		},
+		{
+			note:    "invalid query",
+			config:  `{"x": {"resource": "/x", "path": "/x", "query": "input["}}`,
+			wantErr: "invalid query",
+		},
+		{
+			note:    "invalid format",
+			config:  `{"x": {"resource": "/x", "path": "/x", "format": "csv"}}`,
+			wantErr: `invalid format "csv"`,
+		},
+		{
+			note:    "invalid staleness",
+			config:  `{"x": {"resource": "/x", "path": "/x", "max_staleness_seconds": 0}}`,
+			wantErr: "'max_staleness_seconds' must be at least 1",
+		},
+		{
+			note:    "invalid polling",
+			config:  `{"x": {"resource": "/x", "path": "/x", "polling": {"min_delay_seconds": 10}}}`,
+			wantErr: "polling configuration missing 'max_delay_seconds'",
+		},
+		{
+			note:    "trigger mode mismatch",
+			config:  `{"x": {"resource": "/x", "path": "/x", "trigger": "periodic"}}`,
+			trigger: plugins.TriggerManual,
+			wantErr: "trigger mode mismatch",
+		},
+		{
+			note:    "overlapping paths",
+			config:  `{"x": {"resource": "/x", "path": "/a"}, "y": {"resource": "/y", "path": "/a/b"}}`,
+			wantErr: `data sources "x" and "y" have overlapping paths /a and /a/b`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			trigger := tc.trigger
+			if trigger == "" {
+				trigger = plugins.DefaultTriggerMode
+			}
+			_, err := NewConfigBuilder().WithBytes([]byte(tc.config)).WithServices([]string{"a", "b"}).WithTriggerMode(&trigger).Parse()
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q but got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,714 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package datasync implements a plugin that periodically synchronizes data
+// from HTTP services into the store, independently of bundles.
+package datasync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/download"
+	"github.com/meta-quick/opax/logging"
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/rego"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/util"
+)
+
+// Name identifies the plugin on manager.
+const Name = "data_sync"
+
+// minRetryDelay is the minimum delay before a failed synchronization is retried.
+const minRetryDelay = time.Millisecond * 100
+
+// Plugin implements periodic synchronization of data from HTTP services. Each
+// data source is fetched, optionally transformed with a Rego query and written
+// under its configured path in a separate transaction.
+type Plugin struct {
+	config       Config
+	manager      *plugins.Manager                         // plugin manager for storage and service clients
+	status       map[string]*Status                       // current status for each data source
+	etags        map[string]string                        // etag of the data last written for each source
+	listeners    map[interface{}]func(map[string]*Status) // listeners to send status updates to
+	pollers      map[string]*poller
+	trigger      storage.TriggerHandle // re-checks bundle roots on bundle activation
+	logger       logging.Logger
+	mtx          sync.Mutex
+	cfgMtx       sync.Mutex
+	ready        bool
+	started      bool
+	pluginStatus plugins.Status // last status reported to the manager
+}
+
+// New returns a new Plugin with the given config.
+func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
+	initialStatus := map[string]*Status{}
+	for name, source := range parsedConfig.Sources {
+		initialStatus[name] = &Status{
+			Name: name,
+			Path: source.path.String(),
+		}
+	}
+
+	p := &Plugin{
+		manager:      manager,
+		config:       *parsedConfig,
+		status:       initialStatus,
+		etags:        map[string]string{},
+		pollers:      map[string]*poller{},
+		logger:       manager.Logger(),
+		pluginStatus: plugins.Status{State: plugins.StateNotReady},
+	}
+
+	manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
+	return p
+}
+
+// Lookup returns the data sync plugin registered with the manager.
+func Lookup(manager *plugins.Manager) *Plugin {
+	if p := manager.Plugin(Name); p != nil {
+		return p.(*Plugin)
+	}
+	return nil
+}
+
+// Start runs the plugin. The plugin will periodically fetch the configured
+// data sources and write them into storage.
+func (p *Plugin) Start(ctx context.Context) error {
+
+	// The trigger is registered before p.mtx is locked because it locks
+	// p.mtx while commits wait for it to return.
+	err := storage.Txn(ctx, p.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		var err error
+		p.trigger, err = p.manager.Store.Register(ctx, txn, storage.TriggerConfig{OnCommit: p.onCommit})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	// With no data sources configured there is nothing to wait for.
+	p.started = true
+	p.updatePluginStatus()
+
+	for name, source := range p.config.Sources {
+		p.log(name).Info("Starting data synchronization.")
+		p.pollers[name] = newPoller(p, name, source)
+		p.pollers[name].start()
+	}
+
+	return nil
+}
+
+// Stop stops the plugin.
+func (p *Plugin) Stop(ctx context.Context) {
+	p.mtx.Lock()
+	pollers := p.pollers
+	p.pollers = map[string]*poller{}
+	p.started = false
+	p.mtx.Unlock()
+
+	for name, pl := range pollers {
+		p.log(name).Info("Stopping data synchronization.")
+		pl.stop()
+	}
+
+	if p.trigger != nil {
+		_ = storage.Txn(ctx, p.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+			p.trigger.Unregister(ctx, txn)
+			return nil
+		})
+		p.trigger = nil
+	}
+}
+
+// Reconfigure notifies the plugin that its configuration has changed. Data
+// sources that have been added or changed are (re)started. The data of
+// removed sources is erased from the store.
+func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
+	p.cfgMtx.Lock()
+	defer p.cfgMtx.Unlock()
+
+	newConfig := config.(*Config)
+
+	p.mtx.Lock()
+	oldConfig := p.config
+	p.config = *newConfig
+	pollers := map[string]*poller{}
+	for name, pl := range p.pollers {
+		pollers[name] = pl
+	}
+	p.mtx.Unlock()
+
+	added := map[string]*Source{}
+	updated := map[string]*Source{}
+	erase := []storage.Path{}
+
+	for name, source := range newConfig.Sources {
+		old, ok := oldConfig.Sources[name]
+		if !ok {
+			added[name] = source
+		} else if !reflect.DeepEqual(old, source) {
+			updated[name] = source
+			if !old.path.Equal(source.path) {
+				erase = append(erase, old.path)
+			}
+		}
+	}
+
+	for name, old := range oldConfig.Sources {
+		if _, ok := newConfig.Sources[name]; !ok {
+			erase = append(erase, old.path)
+			if pl, ok := pollers[name]; ok {
+				p.log(name).Info("Data source configuration removed. Stopping data synchronization.")
+				pl.stop()
+			}
+		}
+	}
+
+	if len(added) == 0 && len(updated) == 0 && len(erase) == 0 {
+		// no relevant config changes
+		return
+	}
+
+	// Stop the pollers outside p.mtx to allow them to finish any in-progress synchronization.
+	for name := range updated {
+		if pl, ok := pollers[name]; ok {
+			pl.stop()
+		}
+	}
+
+	for _, path := range erase {
+		if err := p.erase(ctx, path); err != nil {
+			p.logger.Error("Failed to erase data at %v: %v", path, err)
+		}
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for name := range p.status {
+		if _, ok := newConfig.Sources[name]; !ok {
+			delete(p.pollers, name)
+			delete(p.status, name)
+			delete(p.etags, name)
+		}
+	}
+
+	for name, source := range newConfig.Sources {
+		_, isNew := added[name]
+		_, isUpdated := updated[name]
+
+		if !isNew && !isUpdated {
+			continue
+		}
+
+		if isNew {
+			p.log(name).Info("New data source configuration added. Starting data synchronization.")
+		} else {
+			p.log(name).Info("Data source configuration changed. Restarting data synchronization.")
+		}
+
+		p.status[name] = &Status{Name: name, Path: source.path.String()}
+
+		// Force the data to be fetched and written again because the path,
+		// query or service may have changed.
+		delete(p.etags, name)
+		p.ready = false
+
+		if p.started {
+			p.pollers[name] = newPoller(p, name, source)
+			p.pollers[name].start()
+		}
+	}
+
+	p.updatePluginStatus()
+	p.notifyListeners()
+}
+
+// Trigger synchronizes all configured data sources. Errors are logged,
+// included in the status of the data sources and returned.
+func (p *Plugin) Trigger(ctx context.Context) error {
+	p.mtx.Lock()
+	names := make([]string, 0, len(p.pollers))
+	pollers := map[string]*poller{}
+	for name, pl := range p.pollers {
+		names = append(names, name)
+		pollers[name] = pl
+	}
+	p.mtx.Unlock()
+
+	sort.Strings(names)
+
+	var errs []string
+	for _, name := range names {
+		if err := pollers[name].oneShot(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("data synchronization failed: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Register a listener to receive status updates for all data sources. The
+// name must be comparable.
+func (p *Plugin) Register(name interface{}, listener func(map[string]*Status)) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.listeners == nil {
+		p.listeners = map[interface{}]func(map[string]*Status){}
+	}
+
+	p.listeners[name] = listener
+}
+
+// Unregister a listener to stop receiving status updates.
+func (p *Plugin) Unregister(name interface{}) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	delete(p.listeners, name)
+}
+
+// Config returns the plugins current configuration.
+func (p *Plugin) Config() *Config {
+	return &p.config
+}
+
+// sync fetches, transforms and writes the data of a single source.
+func (p *Plugin) sync(ctx context.Context, name string, source *Source) error {
+
+	p.mtx.Lock()
+	etag := p.etags[name]
+	p.mtx.Unlock()
+
+	value, newEtag, modified, err := p.fetch(ctx, source, etag)
+
+	if err == nil && modified && source.Query != "" {
+		value, err = p.transform(ctx, source, value)
+	}
+
+	if err == nil {
+		if modified {
+			err = p.write(ctx, source, value)
+		} else {
+			err = p.check(ctx, source)
+		}
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	status, ok := p.status[name]
+	if !ok || ctx.Err() != nil {
+		// The source was removed or its poller stopped while the data was
+		// synchronized.
+		return err
+	}
+
+	status.SetRequest()
+
+	if err != nil {
+		p.log(name).Error("Data synchronization failed: %v", err)
+		status.SetError(err)
+	} else {
+		if modified {
+			p.etags[name] = newEtag
+			p.log(name).Info("Data synchronized successfully.")
+		} else {
+			p.log(name).Debug("Data synchronization skipped, server replied with not modified.")
+		}
+		status.SetSyncSuccess(modified)
+	}
+
+	status.setStale(time.Now().UTC(), source.maxStaleness)
+
+	p.updatePluginStatus()
+	p.notifyListeners()
+
+	return err
+}
+
+// fetch requests the data from the service. If the server replies that the
+// data has not been modified since the last request, no value is returned.
+func (p *Plugin) fetch(ctx context.Context, source *Source, etag string) (interface{}, string, bool, error) {
+
+	accept := "application/json"
+	if source.Format == FormatNDJSON {
+		accept = "application/x-ndjson"
+	}
+
+	resp, err := p.manager.Client(source.Service).
+		WithHeader("Accept", accept).
+		WithHeader("If-None-Match", etag).
+		Do(ctx, "GET", source.Resource)
+	if err != nil {
+		return nil, "", false, errors.Wrap(err, "request failed")
+	}
+
+	defer util.Close(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		value, err := decode(resp.Body, source.Format, source.SizeLimitBytes)
+		if err != nil {
+			return nil, "", false, err
+		}
+		return value, resp.Header.Get("ETag"), true, nil
+	case http.StatusNotModified:
+		return nil, etag, false, nil
+	default:
+		return nil, "", false, download.HTTPError{StatusCode: resp.StatusCode}
+	}
+}
+
+// transform evaluates the query of the source with the fetched data as input
+// and returns the value of the first expression.
+func (p *Plugin) transform(ctx context.Context, source *Source, input interface{}) (interface{}, error) {
+
+	rs, err := rego.New(
+		rego.Query(source.Query),
+		rego.Compiler(p.manager.GetCompiler()),
+		rego.Store(p.manager.Store),
+		rego.Input(input),
+		rego.Runtime(p.manager.Info),
+	).Eval(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+
+	if len(rs) == 0 {
+		return nil, fmt.Errorf("query result undefined")
+	}
+
+	return rs[0].Expressions[0].Value, nil
+}
+
+// write replaces the data under the path of the source in a new transaction.
+func (p *Plugin) write(ctx context.Context, source *Source, value interface{}) error {
+
+	if err := util.RoundTrip(&value); err != nil {
+		return err
+	}
+
+	params := storage.WriteParams
+	params.Context = storage.NewContext()
+
+	return storage.Txn(ctx, p.manager.Store, params, func(txn storage.Transaction) error {
+		if err := checkBundleRoots(ctx, p.manager.Store, txn, source.path); err != nil {
+			return err
+		}
+		if err := storage.MakeDir(ctx, p.manager.Store, txn, source.path[:len(source.path)-1]); err != nil {
+			return err
+		}
+		return p.manager.Store.Write(ctx, txn, storage.AddOp, source.path, value)
+	})
+}
+
+// check verifies that the path of the source has not been claimed by a bundle
+// since the data was written.
+func (p *Plugin) check(ctx context.Context, source *Source) error {
+	return storage.Txn(ctx, p.manager.Store, storage.TransactionParams{}, func(txn storage.Transaction) error {
+		return checkBundleRoots(ctx, p.manager.Store, txn, source.path)
+	})
+}
+
+// erase removes the data under path unless the path is owned by a bundle.
+func (p *Plugin) erase(ctx context.Context, path storage.Path) error {
+
+	params := storage.WriteParams
+	params.Context = storage.NewContext()
+
+	return storage.Txn(ctx, p.manager.Store, params, func(txn storage.Transaction) error {
+		if err := checkBundleRoots(ctx, p.manager.Store, txn, path); err != nil {
+			return nil
+		}
+		err := p.manager.Store.Write(ctx, txn, storage.RemoveOp, path, nil)
+		if err != nil && !storage.IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// onCommit checks the paths of the data sources against the roots of bundles
+// activated in the transaction. Conflicts are reported right away instead of
+// on the next synchronization, which may be a long time off.
+func (p *Plugin) onCommit(ctx context.Context, txn storage.Transaction, event storage.TriggerEvent) {
+
+	if !bundlesChanged(event) {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	var changed bool
+
+	for name, source := range p.config.Sources {
+		status, ok := p.status[name]
+		if !ok {
+			continue
+		}
+		if err := checkBundleRoots(ctx, p.manager.Store, txn, source.path); err != nil {
+			p.log(name).Error("Data synchronization failed: %v", err)
+			status.SetError(err)
+			// The bundle has replaced the data, so it must be written again
+			// once the conflict is resolved.
+			delete(p.etags, name)
+			changed = true
+		}
+	}
+
+	if changed {
+		p.updatePluginStatus()
+		p.notifyListeners()
+	}
+}
+
+// bundlesChanged returns true if the event includes changes to the manifests
+// of activated bundles.
+func bundlesChanged(event storage.TriggerEvent) bool {
+	for _, e := range event.Data {
+		if e.Path.HasPrefix(bundle.BundlesBasePath) || bundle.BundlesBasePath.HasPrefix(e.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// updatePluginStatus reports the plugin as ready once every data source has
+// been synchronized successfully. Stale data sources are reported as a warning.
+func (p *Plugin) updatePluginStatus() {
+
+	if !p.ready {
+		readyNow := true
+		for _, status := range p.status {
+			if status.LastSuccessfulRequest.IsZero() {
+				readyNow = false
+				break
+			}
+		}
+		p.ready = readyNow
+	}
+
+	var stale []string
+	for name, status := range p.status {
+		if status.Stale {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+
+	var next plugins.Status
+
+	switch {
+	case !p.ready:
+		next = plugins.Status{State: plugins.StateNotReady}
+	case len(stale) > 0:
+		next = plugins.Status{State: plugins.StateWarn, Message: "stale data sources: " + strings.Join(stale, ", ")}
+	default:
+		next = plugins.Status{State: plugins.StateOK}
+	}
+
+	if next != p.pluginStatus {
+		p.pluginStatus = next
+		p.manager.UpdatePluginStatus(Name, &next)
+	}
+}
+
+func (p *Plugin) notifyListeners() {
+	for _, listener := range p.listeners {
+		// Send a copy of the full status map to the listeners. They shouldn't
+		// have access to the original underlying map.
+		statusCpy := map[string]*Status{}
+		for k, v := range p.status {
+			v := *v
+			statusCpy[k] = &v
+		}
+		listener(statusCpy)
+	}
+}
+
+func (p *Plugin) log(name string) logging.Logger {
+	return p.logger.WithFields(map[string]interface{}{"name": name, "plugin": Name})
+}
+
+// checkBundleRoots returns an error if path overlaps with the roots of an
+// activated bundle. Bundles own the data under their roots, so the data would
+// be overwritten on the next bundle activation.
+func checkBundleRoots(ctx context.Context, store storage.Store, txn storage.Transaction, path storage.Path) error {
+
+	names, err := bundle.ReadBundleNamesFromStore(ctx, store, txn)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		roots, err := bundle.ReadBundleRootsFromStore(ctx, store, txn, name)
+		if err != nil && !storage.IsNotFound(err) {
+			return err
+		}
+		if roots == nil {
+			roots = []string{""}
+		}
+		for _, root := range roots {
+			if bundle.RootPathsOverlap(root, rootPath(path)) {
+				return fmt.Errorf("path %v conflicts with root %q of bundle %q", path, root, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// decode reads a JSON or NDJSON document from r. NDJSON values are returned
+// as an array.
+func decode(r io.Reader, format string, sizeLimitBytes int64) (interface{}, error) {
+
+	bs, err := ioutil.ReadAll(io.LimitReader(r, sizeLimitBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(bs)) > sizeLimitBytes {
+		return nil, fmt.Errorf("response size exceeds limit (%d bytes)", sizeLimitBytes)
+	}
+
+	if format == FormatNDJSON {
+		values := []interface{}{}
+		decoder := util.NewJSONDecoder(bytes.NewReader(bs))
+		for {
+			var x interface{}
+			if err := decoder.Decode(&x); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, errors.Wrap(err, "invalid ndjson response")
+			}
+			values = append(values, x)
+		}
+		return values, nil
+	}
+
+	var x interface{}
+	if err := util.UnmarshalJSON(bs, &x); err != nil {
+		return nil, errors.Wrap(err, "invalid json response")
+	}
+
+	return x, nil
+}
+
+// poller synchronizes a single data source, periodically or when triggered.
+type poller struct {
+	plugin  *Plugin
+	name    string
+	source  *Source
+	syncMtx sync.Mutex // serializes synchronizations
+	mtx     sync.Mutex // protects stopped
+	ctx     context.Context
+	cancel  context.CancelFunc // cancels periodic synchronizations in progress
+	stopCh  chan chan struct{}
+	stopped bool
+}
+
+func newPoller(p *Plugin, name string, source *Source) *poller {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &poller{
+		plugin: p,
+		name:   name,
+		source: source,
+		ctx:    ctx,
+		cancel: cancel,
+		stopCh: make(chan chan struct{}),
+	}
+}
+
+func (pl *poller) start() {
+	if *pl.source.Trigger == plugins.TriggerPeriodic {
+		go pl.loop()
+	}
+}
+
+func (pl *poller) stop() {
+	if *pl.source.Trigger != plugins.TriggerPeriodic {
+		return
+	}
+
+	pl.mtx.Lock()
+	stopped := pl.stopped
+	pl.stopped = true
+	pl.mtx.Unlock()
+
+	if !stopped {
+		pl.cancel()
+		done := make(chan struct{})
+		pl.stopCh <- done
+		<-done
+	}
+}
+
+func (pl *poller) oneShot(ctx context.Context) error {
+	pl.syncMtx.Lock()
+	defer pl.syncMtx.Unlock()
+	return pl.plugin.sync(ctx, pl.name, pl.source)
+}
+
+func (pl *poller) loop() {
+
+	defer pl.cancel()
+
+	var retry int
+
+	for {
+		var delay time.Duration
+
+		err := pl.oneShot(pl.ctx)
+
+		if err != nil {
+			delay = util.DefaultBackoff(float64(minRetryDelay), float64(*pl.source.Polling.MaxDelaySeconds), retry)
+			retry++
+		} else {
+			min := float64(*pl.source.Polling.MinDelaySeconds)
+			max := float64(*pl.source.Polling.MaxDelaySeconds)
+			delay = time.Duration(((max - min) * rand.Float64()) + min)
+			retry = 0
+		}
+
+		pl.plugin.log(pl.name).Debug("Waiting %v before next data synchronization/retry.", delay)
+
+		select {
+		case <-time.After(delay):
+		case done := <-pl.stopCh:
+			close(done)
+			return
+		}
+	}
+}
@@ -0,0 +1,483 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package datasync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
+	"github.com/meta-quick/opax/util"
+)
+
+func TestPluginSync(t *testing.T) {
+
+	ctx := context.Background()
+	fixture := newTestFixture(t, `{
+		"roles": {
+			"resource": "/roles",
+			"path": "/external/roles",
+			"query": "{u.id: u.roles | u := input[_]}",
+			"format": "ndjson",
+			"trigger": "manual"
+		}
+	}`)
+	defer fixture.server.stop()
+
+	fixture.server.set("/roles", `{"id": "alice", "roles": ["admin"]}
+{"id": "bob", "roles": []}`, `"v1"`)
+
+	if err := fixture.plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.plugin.Stop(ctx)
+
+	fixture.assertPluginState(t, plugins.StateNotReady)
+
+	if err := fixture.plugin.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.assertData(t, "/external/roles", `{"alice": ["admin"], "bob": []}`)
+	fixture.assertPluginState(t, plugins.StateOK)
+
+	status := fixture.status("roles")
+	if status.Code != "" || status.Stale || status.LastSuccessfulUpdate.IsZero() || status.Path != "/external/roles" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	// The etag of the response is sent on the next request and the data is
+	// not written again if the server replies with not modified.
+	if err := storage.WriteOne(ctx, fixture.manager.Store, storage.ReplaceOp, storage.MustParsePath("/external/roles"), "changed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fixture.plugin.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp, act := []string{"", `"v1"`}, fixture.server.etags(); !reflect.DeepEqual(exp, act) {
+		t.Fatalf("expected If-None-Match headers %v but got %v", exp, act)
+	}
+
+	fixture.assertData(t, "/external/roles", `"changed"`)
+
+	next := fixture.status("roles")
+	if next.LastSuccessfulUpdate != status.LastSuccessfulUpdate || !next.LastSuccessfulRequest.After(status.LastSuccessfulRequest) {
+		t.Fatalf("expected successful request without update but got: %+v", next)
+	}
+}
+
+func TestPluginSyncErrors(t *testing.T) {
+
+	ctx := context.Background()
+	fixture := newTestFixture(t, `{
+		"blocklist": {
+			"resource": "/blocklist",
+			"path": "/blocklist",
+			"trigger": "manual"
+		}
+	}`)
+	defer fixture.server.stop()
+
+	if err := fixture.plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.plugin.Stop(ctx)
+
+	// Unknown resources are reported with the HTTP status code.
+	if err := fixture.plugin.Trigger(ctx); err == nil || err.Error() != "data synchronization failed: blocklist: server replied with Not Found" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status := fixture.status("blocklist")
+	if status.Code != errCode || status.HTTPCode != "404" || status.Message != "server replied with Not Found" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	// Invalid responses are reported.
+	fixture.server.set("/blocklist", `["10.0.0.1"`, "")
+
+	if err := fixture.plugin.Trigger(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+
+	status = fixture.status("blocklist")
+	if status.HTTPCode != "" || !strings.HasPrefix(status.Message, "invalid json response") {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	fixture.assertPluginState(t, plugins.StateNotReady)
+
+	// Once the data has been synchronized it becomes stale when subsequent
+	// requests fail for longer than the configured staleness.
+	fixture.server.set("/blocklist", `["10.0.0.1"]`, "")
+
+	if err := fixture.plugin.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.assertData(t, "/blocklist", `["10.0.0.1"]`)
+	fixture.assertPluginState(t, plugins.StateOK)
+
+	fixture.server.set("/blocklist", "", "")
+	fixture.plugin.config.Sources["blocklist"].maxStaleness = time.Nanosecond
+
+	if err := fixture.plugin.Trigger(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+
+	status = fixture.status("blocklist")
+	if !status.Stale || status.HTTPCode != "404" {
+		t.Fatalf("expected stale status but got: %+v", status)
+	}
+
+	fixture.assertPluginState(t, plugins.StateWarn)
+	if msg := fixture.manager.PluginStatus()[Name].Message; msg != "stale data sources: blocklist" {
+		t.Fatalf("unexpected plugin status message: %q", msg)
+	}
+
+	// The last synchronized data is kept.
+	fixture.assertData(t, "/blocklist", `["10.0.0.1"]`)
+}
+
+func TestPluginBundleRootConflict(t *testing.T) {
+
+	ctx := context.Background()
+	fixture := newTestFixture(t, `{
+		"roles": {
+			"resource": "/roles",
+			"path": "/authz/roles",
+			"trigger": "manual"
+		}
+	}`)
+	defer fixture.server.stop()
+
+	fixture.server.set("/roles", `{"alice": ["admin"]}`, `"v1"`)
+
+	if err := fixture.plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.plugin.Stop(ctx)
+
+	if err := fixture.plugin.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.assertData(t, "/authz/roles", `{"alice": ["admin"]}`)
+
+	// Activating a bundle that owns the path is reported as a conflict right
+	// away and on later synchronizations, even though the data has not
+	// changed on the server.
+	err := storage.Txn(ctx, fixture.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		if err := storage.MakeDir(ctx, fixture.manager.Store, txn, bundle.BundlesBasePath); err != nil {
+			return err
+		}
+		manifest := util.MustUnmarshalJSON([]byte(`{"authz": {"manifest": {"revision": "1", "roots": ["authz"]}}}`))
+		return fixture.manager.Store.Write(ctx, txn, storage.AddOp, bundle.BundlesBasePath, manifest)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := fixture.status("roles")
+	if status.Message != `path /authz/roles conflicts with root "authz" of bundle "authz"` {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	if err := fixture.plugin.Trigger(ctx); err == nil || !strings.Contains(err.Error(), status.Message) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Changed data is not written under the bundle root.
+	fixture.server.set("/roles", `{"bob": ["admin"]}`, `"v2"`)
+
+	if err := fixture.plugin.Trigger(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if status := fixture.status("roles"); status.Code != errCode {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	fixture.assertData(t, "/authz/roles", `{"alice": ["admin"]}`)
+}
+
+func TestPluginReconfigure(t *testing.T) {
+
+	ctx := context.Background()
+	fixture := newTestFixture(t, `{
+		"roles": {"resource": "/roles", "path": "/roles", "trigger": "manual"},
+		"blocklist": {"resource": "/blocklist", "path": "/blocklist", "trigger": "manual"}
+	}`)
+	defer fixture.server.stop()
+
+	fixture.server.set("/roles", `{"alice": ["admin"]}`, `"v1"`)
+	fixture.server.set("/blocklist", `["10.0.0.1"]`, `"v1"`)
+
+	if err := fixture.plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.plugin.Stop(ctx)
+
+	if err := fixture.plugin.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.assertData(t, "/roles", `{"alice": ["admin"]}`)
+	fixture.assertData(t, "/blocklist", `["10.0.0.1"]`)
+
+	var statuses []map[string]*Status
+	fixture.plugin.Register("test", func(s map[string]*Status) {
+		statuses = append(statuses, s)
+	})
+
+	// Removed sources are erased and sources with a changed path are
+	// synchronized again.
+	config, err := NewConfigBuilder().WithBytes([]byte(`{
+		"roles": {"resource": "/roles", "path": "/users/roles", "trigger": "manual"}
+	}`)).WithServices(fixture.manager.Services()).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.plugin.Reconfigure(ctx, config)
+
+	fixture.assertNotFound(t, "/roles")
+	fixture.assertNotFound(t, "/blocklist")
+	fixture.assertPluginState(t, plugins.StateNotReady)
+
+	if err := fixture.plugin.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.assertData(t, "/users/roles", `{"alice": ["admin"]}`)
+	fixture.assertPluginState(t, plugins.StateOK)
+
+	if len(statuses) != 2 || len(statuses[1]) != 1 || statuses[1]["roles"].Path != "/users/roles" {
+		t.Fatalf("unexpected status updates: %v", string(util.MustMarshalJSON(statuses)))
+	}
+}
+
+func TestPluginPeriodic(t *testing.T) {
+
+	ctx := context.Background()
+	fixture := newTestFixture(t, `{
+		"roles": {
+			"resource": "/roles",
+			"path": "/roles",
+			"polling": {"min_delay_seconds": 1, "max_delay_seconds": 1}
+		}
+	}`)
+	defer fixture.server.stop()
+
+	fixture.server.set("/roles", `{"alice": ["admin"]}`, "")
+
+	var once sync.Once
+	done := make(chan struct{})
+	fixture.plugin.Register("test", func(s map[string]*Status) {
+		if !s["roles"].LastSuccessfulUpdate.IsZero() {
+			once.Do(func() { close(done) })
+		}
+	})
+
+	if err := fixture.plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for data synchronization")
+	}
+
+	fixture.plugin.Stop(ctx)
+
+	fixture.assertData(t, "/roles", `{"alice": ["admin"]}`)
+}
+
+func TestPluginStopCancelsSync(t *testing.T) {
+
+	ctx := context.Background()
+	fixture := newTestFixture(t, `{"roles": {"resource": "/roles", "path": "/roles"}}`)
+	defer fixture.server.stop()
+
+	requests := make(chan struct{}, 1)
+	fixture.server.requests = requests
+	fixture.server.hang = true
+
+	if err := fixture.plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for request")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		fixture.plugin.Stop(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for plugin to stop")
+	}
+}
+
+type testFixture struct {
+	manager *plugins.Manager
+	plugin  *Plugin
+	server  *testServer
+}
+
+func newTestFixture(t *testing.T, config string) testFixture {
+	t.Helper()
+
+	ts := &testServer{responses: map[string]testResponse{}}
+	ts.server = httptest.NewServer(http.HandlerFunc(ts.handle))
+
+	managerConfig := []byte(fmt.Sprintf(`{
+		"services": {
+			"example": {"url": %q}
+		}
+	}`, ts.server.URL))
+
+	manager, err := plugins.New(managerConfig, "test-instance-id", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsedConfig, err := NewConfigBuilder().WithBytes([]byte(config)).WithServices(manager.Services()).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testFixture{
+		manager: manager,
+		plugin:  New(parsedConfig, manager),
+		server:  ts,
+	}
+}
+
+func (f testFixture) status(name string) Status {
+	f.plugin.mtx.Lock()
+	defer f.plugin.mtx.Unlock()
+	return *f.plugin.status[name]
+}
+
+func (f testFixture) assertPluginState(t *testing.T, exp plugins.State) {
+	t.Helper()
+	if status := f.manager.PluginStatus()[Name]; status == nil || status.State != exp {
+		t.Fatalf("expected plugin state %v but got %v", exp, status)
+	}
+}
+
+func (f testFixture) assertData(t *testing.T, path string, exp string) {
+	t.Helper()
+	value, err := storage.ReadOne(context.Background(), f.manager.Store, storage.MustParsePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, util.MustUnmarshalJSON([]byte(exp))) {
+		t.Fatalf("expected %v at %v but got %v", exp, path, value)
+	}
+}
+
+func (f testFixture) assertNotFound(t *testing.T, path string) {
+	t.Helper()
+	if _, err := storage.ReadOne(context.Background(), f.manager.Store, storage.MustParsePath(path)); !storage.IsNotFound(err) {
+		t.Fatalf("expected %v to be erased but got: %v", path, err)
+	}
+}
+
+type testResponse struct {
+	body string
+	etag string
+}
+
+type testServer struct {
+	server      *httptest.Server
+	mtx         sync.Mutex
+	responses   map[string]testResponse
+	noneMatches []string
+	requests    chan struct{} // receives a value per request if set
+	hang        bool          // do not reply until the request is cancelled
+}
+
+func (ts *testServer) handle(w http.ResponseWriter, r *http.Request) {
+	ts.mtx.Lock()
+	requests, hang := ts.requests, ts.hang
+	ts.mtx.Unlock()
+
+	if requests != nil {
+		requests <- struct{}{}
+	}
+
+	if hang {
+		<-r.Context().Done()
+		return
+	}
+
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	ts.noneMatches = append(ts.noneMatches, r.Header.Get("If-None-Match"))
+
+	resp, ok := ts.responses[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if resp.etag != "" {
+		if r.Header.Get("If-None-Match") == resp.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", resp.etag)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(resp.body))
+}
+
+// set sets the response for path. An empty body removes the response.
+func (ts *testServer) set(path, body, etag string) {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+
+	if body == "" {
+		delete(ts.responses, path)
+		return
+	}
+
+	ts.responses[path] = testResponse{body: body, etag: etag}
+	ts.noneMatches = nil
+}
+
+func (ts *testServer) etags() []string {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+	return ts.noneMatches
+}
+
+func (ts *testServer) stop() {
+	ts.server.Close()
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package datasync
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/meta-quick/opax/download"
+)
+
+const (
+	errCode = "data_sync_error"
+)
+
+// Status represents the status of synchronizing a data source.
+type Status struct {
+	Name                  string      `json:"name"`
+	Path                  string      `json:"path"`
+	LastSuccessfulUpdate  time.Time   `json:"last_successful_update,omitempty"`
+	LastSuccessfulRequest time.Time   `json:"last_successful_request,omitempty"`
+	LastRequest           time.Time   `json:"last_request,omitempty"`
+	Stale                 bool        `json:"stale"`
+	Code                  string      `json:"code,omitempty"`
+	Message               string      `json:"message,omitempty"`
+	HTTPCode              json.Number `json:"http_code,omitempty"`
+}
+
+// SetRequest updates the status object to reflect a synchronization attempt.
+func (s *Status) SetRequest() {
+	s.LastRequest = time.Now().UTC()
+}
+
+// SetSyncSuccess updates the status object to reflect that the data is up to
+// date. If updated is true, the data was written to the store.
+func (s *Status) SetSyncSuccess(updated bool) {
+	s.LastSuccessfulRequest = s.LastRequest
+	if updated {
+		s.LastSuccessfulUpdate = s.LastRequest
+	}
+	s.SetError(nil)
+}
+
+// SetError updates the status object to reflect a failure to fetch, transform
+// or write the data. If err is nil, the error status is cleared.
+func (s *Status) SetError(err error) {
+
+	if err == nil {
+		s.Code = ""
+		s.HTTPCode = ""
+		s.Message = ""
+		return
+	}
+
+	s.Code = errCode
+	s.HTTPCode = ""
+	s.Message = err.Error()
+
+	if cause, ok := errors.Cause(err).(download.HTTPError); ok {
+		s.HTTPCode = json.Number(strconv.Itoa(cause.StatusCode))
+	}
+}
+
+// setStale updates the stale flag of the status object. Data that has not
+// been synchronized successfully yet is not stale.
+func (s *Status) setStale(now time.Time, maxStaleness time.Duration) {
+	s.Stale = !s.LastSuccessfulRequest.IsZero() && now.Sub(s.LastSuccessfulRequest) > maxStaleness
+}
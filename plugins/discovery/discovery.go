@@ -22,6 +22,7 @@ import (
 	"github.com/meta-quick/opax/metrics"
 	"github.com/meta-quick/opax/plugins"
 	"github.com/meta-quick/opax/plugins/bundle"
+	"github.com/meta-quick/opax/plugins/datasync"
 	"github.com/meta-quick/opax/plugins/logs"
 	"github.com/meta-quick/opax/plugins/status"
 	"github.com/meta-quick/opax/rego"
@@ -370,7 +371,7 @@ func getPluginSet(factories map[string]plugins.Factory, manager *plugins.Manager
 		pluginNames = append(pluginNames, k)
 	}
 
-	// Parse and validate bundle/logs/status configurations.
+	// Parse and validate bundle/logs/status/data sync configurations.
 
 	// If `bundle` was configured use that, otherwise try the new `bundles` option
 	bundleConfig, err := bundle.ParseConfig(config.Bundle, manager.Services())
@@ -399,6 +400,12 @@ func getPluginSet(factories map[string]plugins.Factory, manager *plugins.Manager
 		return nil, err
 	}
 
+	dataSyncConfig, err := datasync.NewConfigBuilder().WithBytes(config.DataSync).WithServices(manager.Services()).
+		WithTriggerMode(trigger).Parse()
+	if err != nil {
+		return nil, err
+	}
+
 	// Accumulate plugins to start or reconfigure.
 	starts := []plugins.Plugin{}
 	reconfigs := []pluginreconfig{}
@@ -430,6 +437,15 @@ func getPluginSet(factories map[string]plugins.Factory, manager *plugins.Manager
 		}
 	}
 
+	if dataSyncConfig != nil {
+		p, created := getDataSyncPlugin(manager, dataSyncConfig)
+		if created {
+			starts = append(starts, p)
+		} else if p != nil {
+			reconfigs = append(reconfigs, pluginreconfig{dataSyncConfig, p})
+		}
+	}
+
 	result := &pluginSet{starts, reconfigs}
 
 	getCustomPlugins(manager, pluginFactories, result)
@@ -458,6 +474,17 @@ func getDecisionLogsPlugin(m *plugins.Manager, config *logs.Config, metrics metr
 	return plugin, created
 }
 
+func getDataSyncPlugin(m *plugins.Manager, config *datasync.Config) (plugin *datasync.Plugin, created bool) {
+	plugin = datasync.Lookup(m)
+	if plugin == nil {
+		plugin = datasync.New(config, m)
+		m.Register(datasync.Name, plugin)
+		registerDataSyncStatusUpdates(m)
+		created = true
+	}
+	return plugin, created
+}
+
 func getStatusPlugin(m *plugins.Manager, config *status.Config, metrics metrics.Metrics) (plugin *status.Plugin, created bool) {
 
 	plugin = status.Lookup(m)
@@ -466,6 +493,7 @@ func getStatusPlugin(m *plugins.Manager, config *status.Config, metrics metrics.
 		plugin = status.New(config, m).WithMetrics(metrics)
 		m.Register(status.Name, plugin)
 		registerBundleStatusUpdates(m)
+		registerDataSyncStatusUpdates(m)
 		created = true
 	}
 
@@ -500,3 +528,13 @@ func registerBundleStatusUpdates(m *plugins.Manager) {
 		bp.RegisterBulkListener(pluginlistener(status.Name), sp.BulkUpdateBundleStatus)
 	}
 }
+
+func registerDataSyncStatusUpdates(m *plugins.Manager) {
+	dp := datasync.Lookup(m)
+	sp := status.Lookup(m)
+	if dp == nil || sp == nil {
+		return
+	}
+	type pluginlistener string
+	dp.Register(pluginlistener(status.Name), sp.UpdateDataSyncStatus)
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/meta-quick/opax/metrics"
 	"github.com/meta-quick/opax/plugins"
 	"github.com/meta-quick/opax/plugins/bundle"
+	"github.com/meta-quick/opax/plugins/datasync"
 	"github.com/meta-quick/opax/plugins/logs"
 	"github.com/meta-quick/opax/plugins/status"
 	"github.com/meta-quick/opax/server"
@@ -1215,6 +1216,42 @@ bundles:
 	}
 }
 
+func TestGetPluginSetWithDataSyncConfig(t *testing.T) {
+	conf := `
+services:
+  s1:
+    url: http://test1.com
+
+status:
+  service: s1
+
+data_sync:
+  roles:
+    resource: /roles
+    path: /external/roles
+`
+	manager := getTestManager(t, conf)
+	trigger := plugins.TriggerManual
+	_, err := getPluginSet(nil, manager, manager.Config, nil, &trigger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	dp := datasync.Lookup(manager)
+	if dp == nil {
+		t.Fatal("Unable to find data sync plugin on manager")
+	}
+
+	source := dp.Config().Sources["roles"]
+	if source == nil || source.Service != "s1" || *source.Trigger != plugins.TriggerManual {
+		t.Fatalf("Expected the data source to be configured, got: %+v", dp.Config().Sources)
+	}
+
+	if status.Lookup(manager) == nil {
+		t.Fatal("Unable to find status plugin on manager")
+	}
+}
+
 func TestGetPluginSetWithBadManualTriggerBundlesConfig(t *testing.T) {
 	confGood := `
 services:
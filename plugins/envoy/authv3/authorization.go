@@ -0,0 +1,91 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package authv3 contains the messages and the gRPC service of the Envoy
+// external authorization API (envoy.service.auth.v3) used by OPA.
+package authv3
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the name of the Envoy external authorization service.
+const ServiceName = "envoy.service.auth.v3.Authorization"
+
+const checkMethod = "/" + ServiceName + "/Check"
+
+// AuthorizationServer is the server API of the Envoy external authorization
+// service.
+type AuthorizationServer interface {
+	// Check performs an authorization check based on the attributes of a
+	// request.
+	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+}
+
+// RegisterAuthorizationServer registers srv as the Envoy external
+// authorization service on s.
+func RegisterAuthorizationServer(s grpc.ServiceRegistrar, srv AuthorizationServer) {
+	s.RegisterService(&AuthorizationServiceDesc, srv)
+}
+
+// AuthorizationServiceDesc is the grpc.ServiceDesc of the Envoy external
+// authorization service.
+var AuthorizationServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*AuthorizationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Check",
+			Handler:    checkHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "envoy/service/auth/v3/external_auth.proto",
+}
+
+func checkHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorizationServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: checkMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorizationServer).Check(ctx, req.(*CheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AuthorizationClient is the client API of the Envoy external authorization
+// service.
+type AuthorizationClient interface {
+	// Check performs an authorization check based on the attributes of a
+	// request.
+	Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+}
+
+type authorizationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewAuthorizationClient returns a client of the Envoy external authorization
+// service.
+func NewAuthorizationClient(cc grpc.ClientConnInterface) AuthorizationClient {
+	return &authorizationClient{cc}
+}
+
+func (c *authorizationClient) Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error) {
+	out := new(CheckResponse)
+	if err := c.cc.Invoke(ctx, checkMethod, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
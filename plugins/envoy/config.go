@@ -0,0 +1,81 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package envoy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/util"
+)
+
+const (
+	// DefaultAddr is the address the plugin listens on by default.
+	DefaultAddr = ":9191"
+
+	// DefaultPath is the default path of the decision evaluated for each
+	// authorization check.
+	DefaultPath = "envoy/authz/allow"
+)
+
+// Config represents the configuration of the plugin.
+type Config struct {
+	Addr                 string `json:"addr"`                              // address to serve the gRPC API on (host:port or unix://path)
+	Path                 string `json:"path"`                              // path of the decision to evaluate, e.g. envoy/authz/allow
+	DryRun               bool   `json:"dry-run,omitempty"`                 // allow all requests but log the actual decisions
+	SkipRequestBodyParse bool   `json:"skip-request-body-parse,omitempty"` // do not populate input.parsed_body
+
+	query string
+}
+
+// ParseConfig validates the config and injects default values.
+func ParseConfig(config []byte) (*Config, error) {
+	if config == nil {
+		config = []byte(`{}`)
+	}
+
+	var parsedConfig Config
+
+	if err := util.Unmarshal(config, &parsedConfig); err != nil {
+		return nil, err
+	}
+
+	if err := parsedConfig.validateAndInjectDefaults(); err != nil {
+		return nil, err
+	}
+
+	return &parsedConfig, nil
+}
+
+// Query returns the query evaluated for each authorization check.
+func (c *Config) Query() string {
+	return c.query
+}
+
+func (c *Config) validateAndInjectDefaults() error {
+	if c.Addr == "" {
+		c.Addr = DefaultAddr
+	}
+
+	if c.Path == "" {
+		c.Path = DefaultPath
+	}
+
+	path := strings.Trim(c.Path, "/")
+	if path == "" {
+		return fmt.Errorf("invalid path %q", c.Path)
+	}
+
+	ref, err := ast.PtrRef(ast.DefaultRootDocument, path)
+	if err != nil {
+		return fmt.Errorf("invalid path %q: %w", c.Path, err)
+	}
+
+	c.Path = path
+	c.query = ref.String()
+
+	return nil
+}
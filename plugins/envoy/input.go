@@ -0,0 +1,154 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package envoy
+
+import (
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/meta-quick/opax/plugins/envoy/authv3"
+	"github.com/meta-quick/opax/util"
+)
+
+// RequestToInput converts an authorization check request into the input
+// document of the decision. The request is encoded with the canonical
+// protobuf JSON mapping. The path, the query string and (unless
+// skipBodyParse is set) the body of the HTTP request are provided in parsed
+// form under parsed_path, parsed_query and parsed_body.
+func RequestToInput(req *authv3.CheckRequest, skipBodyParse bool) (map[string]interface{}, error) {
+
+	bs, err := protojson.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	input := map[string]interface{}{}
+	if err := util.UnmarshalJSON(bs, &input); err != nil {
+		return nil, err
+	}
+
+	http := req.GetAttributes().GetRequest().GetHttp()
+
+	path, rawQuery := http.GetPath(), ""
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, rawQuery = path[:i], path[i+1:]
+	}
+
+	parsedPath, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedQuery, err := parseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	input["parsed_path"] = parsedPath
+	input["parsed_query"] = parsedQuery
+
+	if !skipBodyParse {
+		parsedBody, truncated, err := parseBody(http)
+		if err != nil {
+			return nil, err
+		}
+		input["parsed_body"] = parsedBody
+		input["truncated_body"] = truncated
+	}
+
+	input["version"] = map[string]interface{}{
+		"ext_authz": "v3",
+		"encoding":  "protojson",
+	}
+
+	return input, nil
+}
+
+func parsePath(path string) ([]interface{}, error) {
+	parts := strings.Split(strings.TrimLeft(path, "/"), "/")
+	result := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		s, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+func parseQuery(rawQuery string) (map[string]interface{}, error) {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	return valuesToInterface(values), nil
+}
+
+func valuesToInterface(values url.Values) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for k, vs := range values {
+		arr := make([]interface{}, len(vs))
+		for i, v := range vs {
+			arr[i] = v
+		}
+		result[k] = arr
+	}
+	return result
+}
+
+// parseBody decodes JSON and URL-encoded form request bodies. Bodies of other
+// content types are not parsed. If Envoy only forwarded part of the body
+// (see with_request_body.max_request_bytes), the body is reported as
+// truncated and not parsed.
+func parseBody(http *authv3.AttributeContext_HttpRequest) (interface{}, bool, error) {
+
+	body := http.GetRawBody()
+	if len(body) == 0 {
+		body = []byte(http.GetBody())
+	}
+
+	if len(body) == 0 {
+		return nil, false, nil
+	}
+
+	headers := http.GetHeaders()
+
+	if cl, ok := headers["content-length"]; ok {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil {
+			return nil, false, err
+		}
+		if n > int64(len(body)) {
+			return nil, true, nil
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(headers["content-type"])
+	if err != nil {
+		return nil, false, nil
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var parsed interface{}
+		if err := util.UnmarshalJSON(body, &parsed); err != nil {
+			return nil, false, err
+		}
+		return parsed, false, nil
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, false, err
+		}
+		return valuesToInterface(values), false, nil
+	}
+
+	return nil, false, nil
+}
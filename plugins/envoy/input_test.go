@@ -0,0 +1,178 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package envoy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/meta-quick/opax/plugins/envoy/authv3"
+	"github.com/meta-quick/opax/util"
+)
+
+func TestRequestToInput(t *testing.T) {
+
+	req := &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Source: &authv3.AttributeContext_Peer{
+				Address: &authv3.Address{
+					Address: &authv3.Address_SocketAddress{
+						SocketAddress: &authv3.SocketAddress{Address: "10.0.0.1", PortSpecifier: &authv3.SocketAddress_PortValue{PortValue: 4567}},
+					},
+				},
+			},
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method: "POST",
+					Path:   "/api/v1/a%20b?x=1&x=2&y",
+					Headers: map[string]string{
+						"content-type":   "application/json; charset=utf-8",
+						"content-length": "14",
+					},
+					Body: `{"foo": "bar"}`,
+				},
+			},
+			ContextExtensions: map[string]string{"route": "api"},
+		},
+	}
+
+	input, err := RequestToInput(req, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result map[string]interface{}
+	if err := util.UnmarshalJSON(bs, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	var expected map[string]interface{}
+	if err := util.UnmarshalJSON([]byte(`{
+		"attributes": {
+			"source": {"address": {"socketAddress": {"address": "10.0.0.1", "portValue": 4567}}},
+			"request": {
+				"http": {
+					"method": "POST",
+					"path": "/api/v1/a%20b?x=1&x=2&y",
+					"headers": {"content-type": "application/json; charset=utf-8", "content-length": "14"},
+					"body": "{\"foo\": \"bar\"}"
+				}
+			},
+			"contextExtensions": {"route": "api"}
+		},
+		"parsed_path": ["api", "v1", "a b"],
+		"parsed_query": {"x": ["1", "2"], "y": [""]},
+		"parsed_body": {"foo": "bar"},
+		"truncated_body": false,
+		"version": {"ext_authz": "v3", "encoding": "protojson"}
+	}`), &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected:\n\n%v\n\ngot:\n\n%v", expected, result)
+	}
+}
+
+func TestRequestToInputBody(t *testing.T) {
+
+	tests := []struct {
+		note          string
+		headers       map[string]string
+		body          string
+		rawBody       []byte
+		skip          bool
+		wantBody      interface{}
+		wantTruncated bool
+		wantErr       bool
+	}{
+		{
+			note:     "no body",
+			headers:  map[string]string{"content-type": "application/json"},
+			wantBody: nil,
+		},
+		{
+			note:     "form",
+			headers:  map[string]string{"content-type": "application/x-www-form-urlencoded"},
+			body:     "a=1&a=2&b=x",
+			wantBody: map[string]interface{}{"a": []interface{}{"1", "2"}, "b": []interface{}{"x"}},
+		},
+		{
+			note:     "raw body",
+			headers:  map[string]string{"content-type": "application/vnd.api+json"},
+			rawBody:  []byte(`[true]`),
+			wantBody: []interface{}{true},
+		},
+		{
+			note:     "unknown content type",
+			headers:  map[string]string{"content-type": "text/plain"},
+			body:     "hello",
+			wantBody: nil,
+		},
+		{
+			note:          "truncated",
+			headers:       map[string]string{"content-type": "application/json", "content-length": "100"},
+			body:          `{"foo": `,
+			wantBody:      nil,
+			wantTruncated: true,
+		},
+		{
+			note:    "invalid json",
+			headers: map[string]string{"content-type": "application/json"},
+			body:    `{"foo": `,
+			wantErr: true,
+		},
+		{
+			note:    "skip parsing",
+			headers: map[string]string{"content-type": "application/json"},
+			body:    `{"foo": `,
+			skip:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			req := &authv3.CheckRequest{
+				Attributes: &authv3.AttributeContext{
+					Request: &authv3.AttributeContext_Request{
+						Http: &authv3.AttributeContext_HttpRequest{
+							Path:    "/",
+							Headers: tc.headers,
+							Body:    tc.body,
+							RawBody: tc.rawBody,
+						},
+					},
+				},
+			}
+
+			input, err := RequestToInput(req, tc.skip)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.skip {
+				if _, ok := input["parsed_body"]; ok {
+					t.Fatalf("expected body not to be parsed but got: %v", input["parsed_body"])
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(input["parsed_body"], tc.wantBody) || input["truncated_body"] != tc.wantTruncated {
+				t.Fatalf("unexpected body: %v (truncated: %v)", input["parsed_body"], input["truncated_body"])
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package envoy implements a plugin that serves the Envoy external
+// authorization gRPC API (envoy.service.auth.v3.Authorization). Each
+// authorization check is mapped to the input document of a configurable
+// decision and the decision is translated back into the check response.
+package envoy
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/internal/uuid"
+	"github.com/meta-quick/opax/logging"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/plugins"
+	bundlePlugin "github.com/meta-quick/opax/plugins/bundle"
+	"github.com/meta-quick/opax/plugins/envoy/authv3"
+	"github.com/meta-quick/opax/plugins/logs"
+	"github.com/meta-quick/opax/rego"
+	"github.com/meta-quick/opax/server"
+	"github.com/meta-quick/opax/storage"
+	iCache "github.com/meta-quick/opax/topdown/cache"
+)
+
+// Name identifies the plugin on manager.
+const Name = "envoy_ext_authz_grpc"
+
+// Factory creates the plugin from its configuration. It is registered with
+// the runtime so that the plugin can be enabled under the `plugins` key of
+// the configuration file.
+type Factory struct{}
+
+// Validate parses and validates the plugin configuration.
+func (Factory) Validate(_ *plugins.Manager, config []byte) (interface{}, error) {
+	return ParseConfig(config)
+}
+
+// New returns a new instance of the plugin.
+func (Factory) New(manager *plugins.Manager, config interface{}) plugins.Plugin {
+	return New(config.(*Config), manager)
+}
+
+// Plugin serves the Envoy external authorization API.
+type Plugin struct {
+	manager         *plugins.Manager
+	config          Config
+	server          *grpc.Server
+	listener        net.Listener
+	interQueryCache iCache.InterQueryCache
+	preparedQuery   *rego.PreparedEvalQuery // reset when the compiler changes
+	logger          logging.Logger
+	mtx             sync.Mutex
+}
+
+// New returns a new Plugin with the given config.
+func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
+
+	p := &Plugin{
+		manager:         manager,
+		config:          *parsedConfig,
+		interQueryCache: iCache.NewInterQueryCache(manager.InterQueryBuiltinCacheConfig()),
+		logger:          manager.Logger().WithFields(map[string]interface{}{"plugin": Name}),
+	}
+
+	manager.RegisterCompilerTrigger(func(storage.Transaction) {
+		p.mtx.Lock()
+		p.preparedQuery = nil
+		p.mtx.Unlock()
+	})
+
+	manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
+
+	return p
+}
+
+// Lookup returns the Envoy plugin registered with the manager.
+func Lookup(manager *plugins.Manager) *Plugin {
+	if p := manager.Plugin(Name); p != nil {
+		if ep, ok := p.(*Plugin); ok {
+			return ep
+		}
+	}
+	return nil
+}
+
+// Start starts serving the external authorization API on the configured
+// address.
+func (p *Plugin) Start(ctx context.Context) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if err := p.start(); err != nil {
+		p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateErr, Message: err.Error()})
+		return err
+	}
+
+	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateOK})
+	return nil
+}
+
+// Stop stops serving the external authorization API. In-flight checks are
+// completed before Stop returns.
+func (p *Plugin) Stop(ctx context.Context) {
+	p.mtx.Lock()
+	srv := p.server
+	p.server, p.listener = nil, nil
+	p.mtx.Unlock()
+
+	if srv != nil {
+		p.logger.Info("Stopping Envoy external authorization server.")
+		srv.GracefulStop()
+	}
+
+	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
+}
+
+// Reconfigure notifies the plugin that its configuration has changed. The
+// server is restarted if the address changed.
+func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
+	newConfig := config.(*Config)
+
+	p.mtx.Lock()
+	oldConfig := p.config
+	p.config = *newConfig
+	p.preparedQuery = nil
+	restart := p.server != nil && oldConfig.Addr != newConfig.Addr
+	p.mtx.Unlock()
+
+	if restart {
+		p.Stop(ctx)
+		if err := p.Start(ctx); err != nil {
+			p.logger.Error("Failed to restart Envoy external authorization server: %v.", err)
+		}
+	}
+}
+
+// Addr returns the address the plugin is listening on or an empty string if
+// the plugin is not running.
+func (p *Plugin) Addr() string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.listener == nil {
+		return ""
+	}
+	return p.listener.Addr().String()
+}
+
+func (p *Plugin) start() error {
+
+	if p.server != nil {
+		return nil
+	}
+
+	network, addr := "tcp", p.config.Addr
+	if strings.HasPrefix(addr, "unix://") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix://")
+	}
+
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(srv, p)
+
+	p.server, p.listener = srv, l
+
+	p.logger.WithFields(map[string]interface{}{"addr": l.Addr().String()}).Info("Starting Envoy external authorization server.")
+
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			p.logger.Error("Envoy external authorization server stopped: %v.", err)
+		}
+	}()
+
+	return nil
+}
+
+// Check evaluates the configured decision for an authorization check
+// request received from Envoy.
+func (p *Plugin) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+
+	m := metrics.New()
+
+	p.mtx.Lock()
+	config := p.config
+	p.mtx.Unlock()
+
+	decisionID, err := uuid.New(rand.Reader)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	input, err := RequestToInput(req, config.SkipRequestBodyParse)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid check request: %v", err)
+	}
+
+	astInput, err := ast.InterfaceToValue(input)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid check request: %v", err)
+	}
+
+	txn, err := p.manager.Store.NewTransaction(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	defer p.manager.Store.Abort(ctx, txn)
+
+	result, err := p.eval(ctx, txn, config.Query(), astInput, m)
+
+	var d *decision
+	if err == nil {
+		var v interface{}
+		if result != nil {
+			v = *result
+		}
+		d, err = newDecision(v)
+	}
+
+	var goInput interface{} = input
+	if logErr := p.logDecision(ctx, txn, decisionID, remoteAddr(ctx), config.Path, &goInput, astInput, result, err, m); logErr != nil {
+		return nil, status.Error(codes.Internal, logErr.Error())
+	}
+
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if config.DryRun {
+		d = &decision{allowed: true}
+	}
+
+	return d.response(), nil
+}
+
+// eval evaluates the decision and returns its result or nil if the decision
+// is undefined.
+func (p *Plugin) eval(ctx context.Context, txn storage.Transaction, query string, input ast.Value, m metrics.Metrics) (*interface{}, error) {
+
+	pq, err := p.getPreparedQuery(ctx, txn, query, m)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := pq.Eval(ctx,
+		rego.EvalTransaction(txn),
+		rego.EvalParsedInput(input),
+		rego.EvalMetrics(m),
+		rego.EvalInterQueryBuiltinCache(p.interQueryCache),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rs) == 0 {
+		return nil, nil
+	}
+
+	return &rs[0].Expressions[0].Value, nil
+}
+
+func (p *Plugin) getPreparedQuery(ctx context.Context, txn storage.Transaction, query string, m metrics.Metrics) (*rego.PreparedEvalQuery, error) {
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.preparedQuery != nil {
+		return p.preparedQuery, nil
+	}
+
+	opts := []func(*rego.Rego){
+		rego.Query(query),
+		rego.Compiler(p.manager.GetCompiler()),
+		rego.Store(p.manager.Store),
+		rego.Transaction(txn),
+		rego.Metrics(m),
+		rego.Runtime(p.manager.Info),
+	}
+
+	for _, r := range p.manager.GetWasmResolvers() {
+		for _, entrypoint := range r.Entrypoints() {
+			opts = append(opts, rego.Resolver(entrypoint, r))
+		}
+	}
+
+	pq, err := rego.New(opts...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.preparedQuery = &pq
+	return p.preparedQuery, nil
+}
+
+// logDecision sends the decision to the decision log plugin if decision
+// logging is enabled.
+func (p *Plugin) logDecision(ctx context.Context, txn storage.Transaction, decisionID, remoteAddr, path string, goInput *interface{}, astInput ast.Value, result *interface{}, err error, m metrics.Metrics) error {
+
+	plugin := logs.Lookup(p.manager)
+	if plugin == nil {
+		return nil
+	}
+
+	info := &server.Info{
+		Txn:        txn,
+		Bundles:    map[string]server.BundleInfo{},
+		DecisionID: decisionID,
+		RemoteAddr: remoteAddr,
+		Path:       path,
+		Timestamp:  time.Now().UTC(),
+		Input:      goInput,
+		InputAST:   astInput,
+		Results:    result,
+		Error:      err,
+		Metrics:    m,
+	}
+
+	if err := p.setRevisions(ctx, txn, info); err != nil {
+		return err
+	}
+
+	return plugin.Log(ctx, info)
+}
+
+// setRevisions records the revisions of the activated bundles on the
+// decision. For backwards compatibility the legacy revision is used if
+// bundles are not configured by name.
+func (p *Plugin) setRevisions(ctx context.Context, txn storage.Transaction, info *server.Info) error {
+
+	legacyRevision, err := bundle.LegacyReadRevisionFromStore(ctx, p.manager.Store, txn)
+	if err != nil && !storage.IsNotFound(err) {
+		return err
+	}
+
+	if bp := bundlePlugin.Lookup(p.manager); legacyRevision != "" || (bp != nil && !bp.Config().IsMultiBundle()) {
+		info.Revision = legacyRevision
+		return nil
+	}
+
+	names, err := bundle.ReadBundleNamesFromStore(ctx, p.manager.Store, txn)
+	if err != nil && !storage.IsNotFound(err) {
+		return err
+	}
+
+	for _, name := range names {
+		r, err := bundle.ReadBundleRevisionFromStore(ctx, p.manager.Store, txn, name)
+		if err != nil && !storage.IsNotFound(err) {
+			return err
+		}
+		info.Bundles[name] = server.BundleInfo{Revision: r}
+	}
+
+	return nil
+}
+
+func remoteAddr(ctx context.Context) string {
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		return pr.Addr.String()
+	}
+	return ""
+}
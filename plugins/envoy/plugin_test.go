@@ -0,0 +1,448 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package envoy
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/plugins/envoy/authv3"
+	"github.com/meta-quick/opax/plugins/logs"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
+)
+
+const testPolicy = `package envoy.authz
+
+default allow = false
+
+allow {
+	input.attributes.request.http.method == "GET"
+	input.parsed_path == ["api", "public"]
+}
+
+default decision = {"allowed": false, "headers": {"x-reason": "denied"}, "body": "go away", "http_status": 401}
+
+decision = {
+	"allowed": true,
+	"headers": {"x-user": input.parsed_query.user[0]},
+	"response_headers_to_add": {"x-trace": ["a", "b"]},
+	"request_headers_to_remove": ["authorization"],
+	"dynamic_metadata": {"user": input.parsed_query.user[0], "score": 7},
+} {
+	input.parsed_body.action == "read"
+}
+
+invalid = "allow"
+`
+
+type testLogBackend struct {
+	mtx    sync.Mutex
+	events []logs.EventV1
+}
+
+func (*testLogBackend) Start(context.Context) error { return nil }
+
+func (*testLogBackend) Stop(context.Context) {}
+
+func (*testLogBackend) Reconfigure(context.Context, interface{}) {}
+
+func (b *testLogBackend) Log(_ context.Context, event logs.EventV1) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.events = append(b.events, event)
+	return nil
+}
+
+func (b *testLogBackend) Events() []logs.EventV1 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.events
+}
+
+type testFixture struct {
+	manager *plugins.Manager
+	plugin  *Plugin
+	backend *testLogBackend
+	client  authv3.AuthorizationClient
+	conn    *grpc.ClientConn
+}
+
+func newTestFixture(t *testing.T, config string) *testFixture {
+	t.Helper()
+
+	ctx := context.Background()
+
+	manager, err := plugins.New(nil, "test-instance-id", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &testLogBackend{}
+	manager.Register("test_log_backend", backend)
+
+	logsConfig, err := logs.ParseConfig([]byte(`{"plugin": "test_log_backend"}`), nil, []string{"test_log_backend"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Register(logs.Name, logs.New(logsConfig, manager))
+
+	parsed, err := ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(parsed, manager)
+	manager.Register(Name, plugin)
+
+	err = storage.Txn(ctx, manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		return manager.Store.UpsertPolicy(ctx, txn, "policy.rego", []byte(testPolicy))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &testFixture{manager: manager, plugin: plugin, backend: backend}
+	f.connect(t)
+
+	t.Cleanup(func() {
+		f.conn.Close()
+		plugin.Stop(ctx)
+	})
+
+	return f
+}
+
+func (f *testFixture) connect(t *testing.T) {
+	t.Helper()
+
+	if f.conn != nil {
+		f.conn.Close()
+	}
+
+	conn, err := grpc.Dial(f.plugin.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.conn = conn
+	f.client = authv3.NewAuthorizationClient(conn)
+}
+
+func newCheckRequest(method, path, body string, headers map[string]string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method:  method,
+					Path:    path,
+					Body:    body,
+					Headers: headers,
+				},
+			},
+		},
+	}
+}
+
+func TestCheckAllowDeny(t *testing.T) {
+
+	f := newTestFixture(t, `{"addr": "127.0.0.1:0"}`)
+	ctx := context.Background()
+
+	resp, err := f.client.Check(ctx, newCheckRequest("GET", "/api/public?x=1", "", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.GetStatus().GetCode() != int32(codes.OK) || resp.GetOkResponse() == nil {
+		t.Fatalf("expected request to be allowed but got: %v", resp)
+	}
+
+	resp, err = f.client.Check(ctx, newCheckRequest("POST", "/api/public", "", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.GetStatus().GetCode() != int32(codes.PermissionDenied) || resp.GetDeniedResponse() == nil {
+		t.Fatalf("expected request to be denied but got: %v", resp)
+	}
+
+	if resp.GetDeniedResponse().GetStatus() != nil {
+		t.Fatalf("expected no status code but got: %v", resp.GetDeniedResponse().GetStatus())
+	}
+
+	events := f.backend.Events()
+	if len(events) != 2 {
+		t.Fatalf("expected 2 decisions to be logged but got %d", len(events))
+	}
+
+	if events[0].Path != "envoy/authz/allow" || events[0].DecisionID == "" || *events[0].Result != true || events[1].DecisionID == events[0].DecisionID {
+		t.Fatalf("unexpected decision log event: %+v", events[0])
+	}
+
+	input := (*events[0].Input).(map[string]interface{})
+	if !reflect.DeepEqual(input["parsed_path"], []interface{}{"api", "public"}) {
+		t.Fatalf("unexpected input: %v", input)
+	}
+}
+
+func TestCheckObjectDecision(t *testing.T) {
+
+	f := newTestFixture(t, `{"addr": "127.0.0.1:0", "path": "/envoy/authz/decision"}`)
+	ctx := context.Background()
+
+	resp, err := f.client.Check(ctx, newCheckRequest("POST", "/api?user=alice", `{"action": "read"}`, map[string]string{
+		"content-type": "application/json",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := resp.GetOkResponse()
+	if resp.GetStatus().GetCode() != int32(codes.OK) || ok == nil {
+		t.Fatalf("expected request to be allowed but got: %v", resp)
+	}
+
+	if len(ok.Headers) != 1 || ok.Headers[0].Header.Key != "x-user" || ok.Headers[0].Header.Value != "alice" || ok.Headers[0].Append.GetValue() {
+		t.Fatalf("unexpected headers: %v", ok.Headers)
+	}
+
+	if len(ok.ResponseHeadersToAdd) != 2 || ok.ResponseHeadersToAdd[0].Append.GetValue() || !ok.ResponseHeadersToAdd[1].Append.GetValue() {
+		t.Fatalf("unexpected response headers: %v", ok.ResponseHeadersToAdd)
+	}
+
+	if !reflect.DeepEqual(ok.HeadersToRemove, []string{"authorization"}) {
+		t.Fatalf("unexpected headers to remove: %v", ok.HeadersToRemove)
+	}
+
+	md := resp.GetDynamicMetadata().AsMap()
+	if md["user"] != "alice" || md["score"] != float64(7) {
+		t.Fatalf("unexpected dynamic metadata: %v", md)
+	}
+
+	resp, err = f.client.Check(ctx, newCheckRequest("POST", "/api", `action=read`, map[string]string{
+		"content-type": "text/plain",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	denied := resp.GetDeniedResponse()
+	if resp.GetStatus().GetCode() != int32(codes.PermissionDenied) || denied == nil {
+		t.Fatalf("expected request to be denied but got: %v", resp)
+	}
+
+	if denied.GetStatus().GetCode() != 401 || denied.Body != "go away" || len(denied.Headers) != 1 || denied.Headers[0].Header.Value != "denied" {
+		t.Fatalf("unexpected denied response: %v", denied)
+	}
+}
+
+func TestCheckUndefinedDecision(t *testing.T) {
+
+	f := newTestFixture(t, `{"addr": "127.0.0.1:0", "path": "envoy/authz/missing"}`)
+
+	resp, err := f.client.Check(context.Background(), newCheckRequest("GET", "/", "", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.GetStatus().GetCode() != int32(codes.PermissionDenied) {
+		t.Fatalf("expected request to be denied but got: %v", resp)
+	}
+
+	events := f.backend.Events()
+	if len(events) != 1 || events[0].Result != nil || events[0].Error != nil {
+		t.Fatalf("unexpected decision log events: %+v", events)
+	}
+}
+
+func TestCheckInvalidDecision(t *testing.T) {
+
+	f := newTestFixture(t, `{"addr": "127.0.0.1:0", "path": "envoy/authz/invalid"}`)
+
+	_, err := f.client.Check(context.Background(), newCheckRequest("GET", "/", "", nil))
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("expected internal error but got: %v", err)
+	}
+
+	events := f.backend.Events()
+	if len(events) != 1 || events[0].Error == nil {
+		t.Fatalf("expected error to be logged but got: %+v", events)
+	}
+}
+
+func TestCheckDryRun(t *testing.T) {
+
+	f := newTestFixture(t, `{"addr": "127.0.0.1:0", "path": "envoy/authz/decision", "dry-run": true}`)
+
+	resp, err := f.client.Check(context.Background(), newCheckRequest("GET", "/", "", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.GetStatus().GetCode() != int32(codes.OK) || len(resp.GetOkResponse().GetHeaders()) != 0 {
+		t.Fatalf("expected request to be allowed without modifications but got: %v", resp)
+	}
+
+	events := f.backend.Events()
+	if len(events) != 1 {
+		t.Fatalf("expected one decision to be logged but got %d", len(events))
+	}
+
+	result := (*events[0].Result).(map[string]interface{})
+	if result["allowed"] != false {
+		t.Fatalf("expected actual decision to be logged but got: %v", result)
+	}
+}
+
+func TestPolicyUpdate(t *testing.T) {
+
+	f := newTestFixture(t, `{"addr": "127.0.0.1:0"}`)
+	ctx := context.Background()
+
+	req := newCheckRequest("GET", "/private", "", nil)
+
+	resp, err := f.client.Check(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.GetStatus().GetCode() != int32(codes.PermissionDenied) {
+		t.Fatalf("expected request to be denied but got: %v", resp)
+	}
+
+	err = storage.Txn(ctx, f.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		return f.manager.Store.UpsertPolicy(ctx, txn, "policy.rego", []byte(`package envoy.authz
+
+allow = true`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = f.client.Check(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.GetStatus().GetCode() != int32(codes.OK) {
+		t.Fatalf("expected request to be allowed after policy update but got: %v", resp)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+
+	f := newTestFixture(t, `{"addr": "127.0.0.1:0"}`)
+	ctx := context.Background()
+
+	oldAddr := f.plugin.Addr()
+
+	config, err := ParseConfig([]byte(`{"addr": "127.0.0.1:0", "path": "envoy/authz/decision"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.plugin.Reconfigure(ctx, config)
+
+	// The address is unchanged so the server keeps running.
+	if f.plugin.Addr() != oldAddr {
+		t.Fatalf("expected server to keep listening on %v but got %v", oldAddr, f.plugin.Addr())
+	}
+
+	resp, err := f.client.Check(ctx, newCheckRequest("GET", "/api/public", "", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.GetDeniedResponse().GetBody() != "go away" {
+		t.Fatalf("expected new decision path to be used but got: %v", resp)
+	}
+
+	config, err = ParseConfig([]byte(`{"addr": "localhost:0"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.plugin.Reconfigure(ctx, config)
+
+	if f.plugin.Addr() == "" || f.plugin.Addr() == oldAddr {
+		t.Fatalf("expected server to be restarted but got address %q", f.plugin.Addr())
+	}
+
+	f.connect(t)
+
+	resp, err = f.client.Check(ctx, newCheckRequest("GET", "/api/public", "", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.GetStatus().GetCode() != int32(codes.OK) {
+		t.Fatalf("expected request to be allowed but got: %v", resp)
+	}
+}
+
+func TestPluginStatus(t *testing.T) {
+
+	f := newTestFixture(t, `{"addr": "127.0.0.1:0"}`)
+
+	if s := f.manager.PluginStatus()[Name]; s == nil || s.State != plugins.StateOK {
+		t.Fatalf("expected plugin to be OK but got: %v", s)
+	}
+
+	f.plugin.Stop(context.Background())
+
+	if s := f.manager.PluginStatus()[Name]; s == nil || s.State != plugins.StateNotReady {
+		t.Fatalf("expected plugin to be not ready but got: %v", s)
+	}
+
+	if f.plugin.Addr() != "" {
+		t.Fatalf("expected no address but got %v", f.plugin.Addr())
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+
+	config, err := ParseConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Addr != DefaultAddr || config.Path != DefaultPath || config.Query() != "data.envoy.authz.allow" {
+		t.Fatalf("expected defaults to be injected but got: %+v", config)
+	}
+
+	config, err = ParseConfig([]byte(`{"addr": "unix:///tmp/opa.sock", "path": "/istio/authz/allow/", "skip-request-body-parse": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Path != "istio/authz/allow" || config.Query() != "data.istio.authz.allow" || !config.SkipRequestBodyParse {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+
+	if _, err := ParseConfig([]byte(`{"path": "/"}`)); err == nil {
+		t.Fatal("expected error for empty path")
+	}
+
+	if _, err := ParseConfig([]byte(`{"dry-run": "yes"}`)); err == nil {
+		t.Fatal("expected error for invalid config")
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/meta-quick/opax/plugins/envoy/authv3"
+)
+
+// decision is the result of a policy decision. Policies either return a
+// boolean or an object with the following keys:
+//
+//	allowed                    boolean, required
+//	headers                    headers added to the upstream request (allowed) or the response (denied)
+//	response_headers_to_add    headers added to the response sent downstream (allowed only)
+//	request_headers_to_remove  headers removed from the upstream request (allowed only)
+//	body                       body of the response sent downstream (denied only)
+//	http_status                status code of the response sent downstream (denied only)
+//	dynamic_metadata           metadata emitted to the filters following ext_authz
+type decision struct {
+	allowed                bool
+	headers                []*authv3.HeaderValueOption
+	responseHeadersToAdd   []*authv3.HeaderValueOption
+	requestHeadersToRemove []string
+	body                   string
+	httpStatus             int32
+	dynamicMetadata        *structpb.Struct
+}
+
+func newDecision(result interface{}) (*decision, error) {
+
+	switch result := result.(type) {
+	case nil:
+		return &decision{}, nil
+	case bool:
+		return &decision{allowed: result}, nil
+	case map[string]interface{}:
+		return newDecisionFromObject(result)
+	}
+
+	return nil, fmt.Errorf("illegal decision: expected boolean or object but got %T", result)
+}
+
+func newDecisionFromObject(obj map[string]interface{}) (*decision, error) {
+
+	var d decision
+	var err error
+
+	allowed, ok := obj["allowed"].(bool)
+	if !ok {
+		return nil, fmt.Errorf("illegal decision: 'allowed' must be a boolean")
+	}
+	d.allowed = allowed
+
+	if d.headers, err = getHeaders(obj, "headers"); err != nil {
+		return nil, err
+	}
+
+	if d.responseHeadersToAdd, err = getHeaders(obj, "response_headers_to_add"); err != nil {
+		return nil, err
+	}
+
+	if v, ok := obj["request_headers_to_remove"]; ok {
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("illegal decision: 'request_headers_to_remove' must be an array of strings")
+		}
+		for _, x := range arr {
+			s, ok := x.(string)
+			if !ok {
+				return nil, fmt.Errorf("illegal decision: 'request_headers_to_remove' must be an array of strings")
+			}
+			d.requestHeadersToRemove = append(d.requestHeadersToRemove, s)
+		}
+	}
+
+	if v, ok := obj["body"]; ok {
+		if d.body, ok = v.(string); !ok {
+			return nil, fmt.Errorf("illegal decision: 'body' must be a string")
+		}
+	}
+
+	if v, ok := obj["http_status"]; ok {
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("illegal decision: 'http_status' must be a number")
+		}
+		code, err := n.Int64()
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("illegal decision: invalid 'http_status' %v", n)
+		}
+		d.httpStatus = int32(code)
+	}
+
+	if v, ok := obj["dynamic_metadata"]; ok {
+		if _, ok := v.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("illegal decision: 'dynamic_metadata' must be an object")
+		}
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		d.dynamicMetadata = &structpb.Struct{}
+		if err := protojson.Unmarshal(bs, d.dynamicMetadata); err != nil {
+			return nil, fmt.Errorf("illegal decision: invalid 'dynamic_metadata': %w", err)
+		}
+	}
+
+	return &d, nil
+}
+
+// getHeaders returns the headers under key. Headers are given as an object
+// that maps header names to a string or to an array of strings. A header
+// with multiple values is appended once per value.
+func getHeaders(obj map[string]interface{}, key string) ([]*authv3.HeaderValueOption, error) {
+
+	v, ok := obj[key]
+	if !ok {
+		return nil, nil
+	}
+
+	headers, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("illegal decision: '%v' must be an object", key)
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []*authv3.HeaderValueOption
+
+	for _, name := range names {
+		switch value := headers[name].(type) {
+		case string:
+			result = append(result, newHeaderValueOption(name, value, false))
+		case []interface{}:
+			for i, x := range value {
+				s, ok := x.(string)
+				if !ok {
+					return nil, fmt.Errorf("illegal decision: value of header '%v' in '%v' must be a string or an array of strings", name, key)
+				}
+				result = append(result, newHeaderValueOption(name, s, i > 0))
+			}
+		default:
+			return nil, fmt.Errorf("illegal decision: value of header '%v' in '%v' must be a string or an array of strings", name, key)
+		}
+	}
+
+	return result, nil
+}
+
+// newHeaderValueOption returns a header that either replaces or is appended
+// to existing values. The deprecated append field is used because it is
+// understood by all Envoy versions that implement the v3 API.
+func newHeaderValueOption(name, value string, appendValue bool) *authv3.HeaderValueOption {
+	return &authv3.HeaderValueOption{
+		Header: &authv3.HeaderValue{Key: name, Value: value},
+		Append: wrapperspb.Bool(appendValue),
+	}
+}
+
+// response returns the check response that corresponds to the decision.
+func (d *decision) response() *authv3.CheckResponse {
+
+	resp := &authv3.CheckResponse{
+		DynamicMetadata: d.dynamicMetadata,
+	}
+
+	if d.allowed {
+		resp.Status = &rpcstatus.Status{Code: int32(codes.OK)}
+		resp.HttpResponse = &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{
+				Headers:              d.headers,
+				HeadersToRemove:      d.requestHeadersToRemove,
+				ResponseHeadersToAdd: d.responseHeadersToAdd,
+			},
+		}
+		return resp
+	}
+
+	denied := &authv3.DeniedHttpResponse{
+		Headers: d.headers,
+		Body:    d.body,
+	}
+
+	if d.httpStatus != 0 {
+		denied.Status = &authv3.HttpStatus{Code: d.httpStatus}
+	}
+
+	resp.Status = &rpcstatus.Status{Code: int32(codes.PermissionDenied)}
+	resp.HttpResponse = &authv3.CheckResponse_DeniedResponse{DeniedResponse: denied}
+
+	return resp
+}
@@ -0,0 +1,401 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/meta-quick/opax/logging"
+	"github.com/meta-quick/opax/plugins"
+)
+
+const (
+	// diskBufferHeaderSize is the size of the timestamp that precedes every
+	// event stored in the disk buffer.
+	diskBufferHeaderSize = 8
+
+	// diskBufferReadLimitFactor scales the upload size limit to the amount
+	// of uncompressed events that are read from the disk buffer per upload.
+	diskBufferReadLimitFactor = 8
+)
+
+// diskBuffer implements a persistent FIFO buffer for the plugin. Events are
+// stored with increasing sequence numbers as keys and the write is synced
+// before Push returns so that buffered events survive restarts. Events are
+// only removed from the buffer once their upload has been acknowledged, so
+// every event is uploaded at least once. If the buffer size is exceeded,
+// events from the front of the buffer are dropped.
+//
+// Writes are synced outside of the buffer's lock, so concurrent pushes share
+// the syncs of the database's write-ahead log instead of waiting for one
+// sync each.
+type diskBuffer struct {
+	mtx    sync.Mutex
+	path   string
+	limit  int64
+	db     *pebble.DB
+	first  uint64 // sequence number of the oldest event
+	next   uint64 // sequence number of the next event
+	usage  int64
+	syncs  sync.WaitGroup // pending syncs of pushed events
+	logger logging.Logger
+}
+
+// diskBufferEntry is an event read from the disk buffer.
+type diskBufferEntry struct {
+	seq uint64
+	bs  []byte
+}
+
+func newDiskBuffer(path string, limit int64, logger logging.Logger) *diskBuffer {
+	return &diskBuffer{
+		path:   path,
+		limit:  limit,
+		logger: logger,
+	}
+}
+
+// Open opens the buffer and recovers the events buffered by a previous run.
+func (b *diskBuffer) Open() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	db, err := pebble.Open(b.path, &pebble.Options{Logger: pebbleLogger{b.logger}})
+	if err != nil {
+		return err
+	}
+
+	b.first, b.next, b.usage = 0, 0, 0
+
+	iter := db.NewIter(nil)
+
+	if iter.First() {
+		b.first = binary.BigEndian.Uint64(iter.Key())
+	}
+
+	for valid := iter.First(); valid; valid = iter.Next() {
+		b.next = binary.BigEndian.Uint64(iter.Key()) + 1
+		b.usage += int64(len(iter.Value()))
+	}
+
+	if err := iter.Close(); err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	b.db = db
+
+	if n := b.next - b.first; n > 0 {
+		b.logger.Info("Recovered %d buffered decisions from %v.", n, b.path)
+	}
+
+	return nil
+}
+
+// Close closes the buffer. Buffered events remain on disk.
+func (b *diskBuffer) Close() error {
+	b.mtx.Lock()
+	db := b.db
+	b.db = nil
+	b.mtx.Unlock()
+
+	if db == nil {
+		return nil
+	}
+
+	b.syncs.Wait()
+
+	return db.Close()
+}
+
+// SetLimit sets the buffer size limit. The limit is applied on the next
+// push.
+func (b *diskBuffer) SetLimit(limit int64) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.limit = limit
+}
+
+// Push appends the event to the buffer. The write is synced to disk before
+// Push returns.
+func (b *diskBuffer) Push(bs []byte, t time.Time) (dropped int, err error) {
+	db, dropped, err := b.push(bs, t)
+	if err != nil {
+		return 0, err
+	}
+
+	defer b.syncs.Done()
+
+	// Syncing the write-ahead log also syncs the writes of all pushes that
+	// precede this one. Pebble combines concurrent syncs into one.
+	if err := db.LogData(nil, pebble.Sync); err != nil {
+		return dropped, err
+	}
+
+	return dropped, nil
+}
+
+// push writes the event to the buffer without syncing it. On success, the
+// caller must sync the returned database and call b.syncs.Done.
+func (b *diskBuffer) push(bs []byte, t time.Time) (db *pebble.DB, dropped int, err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.db == nil {
+		return nil, 0, fmt.Errorf("decision log buffer %v is not open", b.path)
+	}
+
+	value := make([]byte, diskBufferHeaderSize+len(bs))
+	binary.BigEndian.PutUint64(value, uint64(t.UnixNano()))
+	copy(value[diskBufferHeaderSize:], bs)
+
+	size := int64(len(value))
+
+	if b.limit > 0 && size > b.limit {
+		return nil, 0, fmt.Errorf("decision exceeds buffer size limit")
+	}
+
+	batch := b.db.NewBatch()
+	defer batch.Close()
+
+	first, usage := b.first, b.usage
+
+	if b.limit > 0 && usage+size > b.limit {
+		iter := b.db.NewIter(&pebble.IterOptions{LowerBound: diskBufferKey(first)})
+		for valid := iter.First(); valid && usage+size > b.limit; valid = iter.Next() {
+			usage -= int64(len(iter.Value()))
+			first = binary.BigEndian.Uint64(iter.Key()) + 1
+			dropped++
+		}
+		if err := iter.Close(); err != nil {
+			return nil, 0, err
+		}
+
+		if err := batch.DeleteRange(diskBufferKey(b.first), diskBufferKey(first), nil); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := batch.Set(diskBufferKey(b.next), value, nil); err != nil {
+		return nil, 0, err
+	}
+
+	if err := batch.Commit(pebble.NoSync); err != nil {
+		return nil, 0, err
+	}
+
+	b.first = first
+	b.next++
+	b.usage = usage + size
+	b.syncs.Add(1)
+
+	return b.db, dropped, nil
+}
+
+// Peek returns the oldest events in the buffer. Events are returned until
+// their total size exceeds the limit. At least one event is returned if the
+// buffer is not empty. The events remain in the buffer until they are
+// acknowledged.
+func (b *diskBuffer) Peek(limit int64) ([]diskBufferEntry, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.db == nil {
+		return nil, fmt.Errorf("decision log buffer %v is not open", b.path)
+	}
+
+	iter := b.db.NewIter(&pebble.IterOptions{LowerBound: diskBufferKey(b.first)})
+	defer iter.Close()
+
+	var entries []diskBufferEntry
+	var size int64
+
+	for valid := iter.First(); valid && (len(entries) == 0 || size < limit); valid = iter.Next() {
+		value := iter.Value()
+		bs := make([]byte, len(value)-diskBufferHeaderSize)
+		copy(bs, value[diskBufferHeaderSize:])
+		entries = append(entries, diskBufferEntry{
+			seq: binary.BigEndian.Uint64(iter.Key()),
+			bs:  bs,
+		})
+		size += int64(len(bs))
+	}
+
+	return entries, iter.Error()
+}
+
+// Ack removes all events up to and including the event with the sequence
+// number from the buffer. Events that have already been dropped are ignored.
+func (b *diskBuffer) Ack(seq uint64) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.db == nil {
+		return fmt.Errorf("decision log buffer %v is not open", b.path)
+	}
+
+	if seq < b.first {
+		return nil
+	}
+
+	usage := b.usage
+
+	iter := b.db.NewIter(&pebble.IterOptions{
+		LowerBound: diskBufferKey(b.first),
+		UpperBound: diskBufferKey(seq + 1),
+	})
+	for valid := iter.First(); valid; valid = iter.Next() {
+		usage -= int64(len(iter.Value()))
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	// Acknowledgements are not synced. If they are lost in a crash, the
+	// events are uploaded again.
+	if err := b.db.DeleteRange(diskBufferKey(b.first), diskBufferKey(seq+1), pebble.NoSync); err != nil {
+		return err
+	}
+
+	b.first = seq + 1
+	b.usage = usage
+
+	return nil
+}
+
+// Stats returns the number of events in the buffer, their total size and the
+// time that the oldest event was buffered at.
+func (b *diskBuffer) Stats() (n int64, usage int64, oldest time.Time, err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.db == nil || b.first == b.next {
+		return 0, 0, time.Time{}, nil
+	}
+
+	value, closer, err := b.db.Get(diskBufferKey(b.first))
+	if err != nil {
+		return 0, 0, time.Time{}, err
+	}
+	defer closer.Close()
+
+	oldest = time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+
+	return int64(b.next - b.first), b.usage, oldest, nil
+}
+
+func diskBufferKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// pebbleLogger forwards the messages of the pebble database to the plugin's
+// logger.
+type pebbleLogger struct {
+	logger logging.Logger
+}
+
+func (l pebbleLogger) Infof(format string, args ...interface{}) {
+	l.logger.Debug(format, args...)
+}
+
+func (l pebbleLogger) Fatalf(format string, args ...interface{}) {
+	l.logger.Error(format, args...)
+	os.Exit(1)
+}
+
+var (
+	backlogEventsDesc = prometheus.NewDesc(
+		"decision_logs_backlog_events",
+		"Number of decisions in the on-disk decision log buffer.",
+		nil, nil)
+	backlogBytesDesc = prometheus.NewDesc(
+		"decision_logs_backlog_bytes",
+		"Size of the decisions in the on-disk decision log buffer.",
+		nil, nil)
+	backlogAgeDesc = prometheus.NewDesc(
+		"decision_logs_backlog_oldest_age_seconds",
+		"Age of the oldest decision in the on-disk decision log buffer.",
+		nil, nil)
+	backlogChunksDesc = prometheus.NewDesc(
+		"decision_logs_backlog_chunks",
+		"Number of compressed chunks of decisions in the in-memory decision log buffer.",
+		nil, nil)
+	backlogChunkBytesDesc = prometheus.NewDesc(
+		"decision_logs_backlog_chunk_bytes",
+		"Size of the compressed chunks of decisions in the in-memory decision log buffer.",
+		nil, nil)
+)
+
+// backlogCollector exports the backlog of the buffer of the decision logs
+// plugin registered with the manager. The plugin is looked up on every
+// collection, so the collector keeps reporting the current plugin when it
+// is replaced. The in-memory buffer holds compressed chunks of decisions, so
+// its backlog is reported in chunks rather than decisions. While an upload is
+// in progress, the chunks being uploaded are detached from the in-memory
+// buffer and are not included; chunks that fail to upload are counted again
+// once they are requeued. No metrics are collected if decisions are not
+// uploaded to a service.
+type backlogCollector struct {
+	manager *plugins.Manager
+}
+
+func (backlogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- backlogEventsDesc
+	ch <- backlogBytesDesc
+	ch <- backlogAgeDesc
+	ch <- backlogChunksDesc
+	ch <- backlogChunkBytesDesc
+}
+
+func (c backlogCollector) Collect(ch chan<- prometheus.Metric) {
+	p := Lookup(c.manager)
+	if p == nil {
+		return
+	}
+
+	p.mtx.Lock()
+	disk := p.disk
+	var chunks int
+	var chunkBytes int64
+	memory := disk == nil && p.buffer != nil && p.config.Service != ""
+	if memory {
+		chunks, chunkBytes = p.buffer.Len(), p.buffer.usage
+	}
+	p.mtx.Unlock()
+
+	if memory {
+		ch <- prometheus.MustNewConstMetric(backlogChunksDesc, prometheus.GaugeValue, float64(chunks))
+		ch <- prometheus.MustNewConstMetric(backlogChunkBytesDesc, prometheus.GaugeValue, float64(chunkBytes))
+		return
+	}
+
+	if disk == nil {
+		return
+	}
+
+	n, usage, oldest, err := disk.Stats()
+	if err != nil {
+		p.logger.Error("Failed to read decision log buffer: %v.", err)
+		return
+	}
+
+	var age float64
+	if n > 0 {
+		age = time.Since(oldest).Seconds()
+	}
+
+	ch <- prometheus.MustNewConstMetric(backlogEventsDesc, prometheus.GaugeValue, float64(n))
+	ch <- prometheus.MustNewConstMetric(backlogBytesDesc, prometheus.GaugeValue, float64(usage))
+	ch <- prometheus.MustNewConstMetric(backlogAgeDesc, prometheus.GaugeValue, age)
+}
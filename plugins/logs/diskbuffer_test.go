@@ -0,0 +1,263 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/meta-quick/opax/logging"
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/storage/inmem"
+)
+
+func TestDiskBuffer(t *testing.T) {
+
+	path := t.TempDir()
+	buffer := newDiskBuffer(path, 0, logging.NewNoOpLogger())
+
+	if err := buffer.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		dropped, err := buffer.Push([]byte(fmt.Sprint(i)), start.Add(time.Duration(i)*time.Second))
+		if err != nil || dropped != 0 {
+			t.Fatalf("Unexpected push result, dropped: %v, err: %v", dropped, err)
+		}
+	}
+
+	entries, err := buffer.Peek(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || string(entries[0].bs) != "0" || string(entries[1].bs) != "1" {
+		t.Fatalf("Unexpected entries: %v", entries)
+	}
+
+	if err := buffer.Ack(entries[1].seq); err != nil {
+		t.Fatal(err)
+	}
+
+	// Acknowledging the same entries again has no effect.
+	if err := buffer.Ack(entries[0].seq); err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiskBufferStats(t, buffer, 3, 3*(diskBufferHeaderSize+1), start.Add(2*time.Second))
+
+	// The remaining entries are recovered after a restart.
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.Push([]byte("x"), start); err == nil {
+		t.Fatal("Expected error pushing to closed buffer")
+	}
+
+	buffer = newDiskBuffer(path, 0, logging.NewNoOpLogger())
+	if err := buffer.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Close()
+
+	assertDiskBufferStats(t, buffer, 3, 3*(diskBufferHeaderSize+1), start.Add(2*time.Second))
+
+	if _, err := buffer.Push([]byte("5"), start.Add(5*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = buffer.Peek(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values []string
+	for _, e := range entries {
+		values = append(values, string(e.bs))
+	}
+
+	if strings.Join(values, ",") != "2,3,4,5" {
+		t.Fatalf("Unexpected entries: %v", values)
+	}
+
+	if err := buffer.Ack(entries[len(entries)-1].seq); err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiskBufferStats(t, buffer, 0, 0, time.Time{})
+
+	if entries, err := buffer.Peek(100); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected empty buffer but got %v (err: %v)", entries, err)
+	}
+}
+
+func TestDiskBufferConcurrentPush(t *testing.T) {
+
+	buffer := newDiskBuffer(t.TempDir(), 0, logging.NewNoOpLogger())
+
+	if err := buffer.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := buffer.Push([]byte(fmt.Sprint(i%10)), time.Now()); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := buffer.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Close()
+
+	if n, usage, _, err := buffer.Stats(); err != nil || n != 50 || usage != 50*(diskBufferHeaderSize+1) {
+		t.Fatalf("Expected 50 recovered decisions but got %v, %v bytes (err: %v)", n, usage, err)
+	}
+}
+
+func TestDiskBufferLimit(t *testing.T) {
+
+	buffer := newDiskBuffer(t.TempDir(), 3*(diskBufferHeaderSize+2), logging.NewNoOpLogger())
+
+	if err := buffer.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Close()
+
+	now := time.Now()
+
+	var dropped int
+	for i := 10; i < 15; i++ {
+		n, err := buffer.Push([]byte(fmt.Sprint(i)), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dropped += n
+	}
+
+	if dropped != 2 {
+		t.Fatalf("Expected 2 entries to be dropped but got %v", dropped)
+	}
+
+	entries, err := buffer.Peek(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 || string(entries[0].bs) != "12" {
+		t.Fatalf("Expected oldest entries to be dropped but got: %v", entries)
+	}
+
+	if _, err := buffer.Push([]byte(strings.Repeat("x", 100)), now); err == nil {
+		t.Fatal("Expected error pushing entry that exceeds the limit")
+	}
+
+	// Lowering the limit drops entries on the next push.
+	buffer.SetLimit(diskBufferHeaderSize + 2)
+
+	if n, err := buffer.Push([]byte("15"), now); err != nil || n != 3 {
+		t.Fatalf("Expected 3 entries to be dropped but got %v (err: %v)", n, err)
+	}
+}
+
+func TestBacklogCollector(t *testing.T) {
+
+	manager, err := plugins.New(nil, "test-instance-id", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(backlogCollector{manager: manager}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The plugin is looked up when the metrics are collected.
+	plugin := &Plugin{manager: manager, logger: logging.NewNoOpLogger()}
+	manager.Register(Name, plugin)
+
+	if families, err := registry.Gather(); err != nil || len(families) != 0 {
+		t.Fatalf("Expected no metrics without buffer but got %v (err: %v)", families, err)
+	}
+
+	// The in-memory buffer is reported in chunks.
+	plugin.config.Service = "svc"
+	plugin.buffer = newLogBuffer(0)
+	plugin.buffer.Push([]byte("chunk"))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, f := range families {
+		values[f.GetName()] = f.GetMetric()[0].GetGauge().GetValue()
+	}
+
+	if len(values) != 2 || values["decision_logs_backlog_chunks"] != 1 || values["decision_logs_backlog_chunk_bytes"] != 5 {
+		t.Fatalf("Unexpected backlog metrics: %v", values)
+	}
+
+	plugin.disk = newDiskBuffer(t.TempDir(), 0, logging.NewNoOpLogger())
+	if err := plugin.disk.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.disk.Close()
+
+	if _, err := plugin.disk.Push([]byte("abc"), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err = registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values = map[string]float64{}
+	for _, f := range families {
+		values[f.GetName()] = f.GetMetric()[0].GetGauge().GetValue()
+	}
+
+	if len(values) != 3 || values["decision_logs_backlog_events"] != 1 || values["decision_logs_backlog_bytes"] != diskBufferHeaderSize+3 {
+		t.Fatalf("Unexpected backlog metrics: %v", values)
+	}
+
+	if age := values["decision_logs_backlog_oldest_age_seconds"]; age < 60 {
+		t.Fatalf("Expected age of at least 60s but got %v", age)
+	}
+}
+
+func assertDiskBufferStats(t *testing.T, buffer *diskBuffer, n int64, usage int64, oldest time.Time) {
+	t.Helper()
+
+	actN, actUsage, actOldest, err := buffer.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actN != n || actUsage != usage || !actOldest.Equal(oldest) {
+		t.Fatalf("Expected stats (%v, %v, %v) but got (%v, %v, %v)", n, usage, oldest, actN, actUsage, actOldest)
+	}
+}
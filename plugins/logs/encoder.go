@@ -55,13 +55,15 @@ func (enc *chunkEncoder) WithMetrics(m metrics.Metrics) *chunkEncoder {
 }
 
 func (enc *chunkEncoder) Write(event EventV1) (result [][]byte, err error) {
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(event); err != nil {
+	bs, err := encodeEvent(event)
+	if err != nil {
 		return nil, err
 	}
+	return enc.WriteBytes(bs)
+}
 
-	bs := buf.Bytes()
-
+// WriteBytes writes an event that has already been encoded with encodeEvent.
+func (enc *chunkEncoder) WriteBytes(bs []byte) (result [][]byte, err error) {
 	if len(bs) == 0 {
 		return nil, nil
 	} else if int64(len(bs)+2) > enc.limit {
@@ -102,6 +104,15 @@ func (enc *chunkEncoder) Write(event EventV1) (result [][]byte, err error) {
 	return
 }
 
+// encodeEvent returns the JSON encoding of the event followed by a newline.
+func encodeEvent(event EventV1) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func (enc *chunkEncoder) writeClose() error {
 	if _, err := enc.w.Write([]byte(`]`)); err != nil {
 		return err
@@ -0,0 +1,601 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meta-quick/opax/logging"
+)
+
+const (
+	// FileFormatNDJSON writes one JSON encoded event per line.
+	FileFormatNDJSON = "ndjson"
+
+	// FileFormatGzip writes the gzip compressed chunks that are uploaded to
+	// remote services. Each chunk is a gzip member that contains a JSON array
+	// of events.
+	FileFormatGzip = "gzip"
+
+	// FileSyncAlways syncs the file to disk after every write.
+	FileSyncAlways = "always"
+
+	// FileSyncInterval syncs the file to disk every flush interval.
+	FileSyncInterval = "interval"
+
+	// FileSyncNever leaves syncing the file to the operating system.
+	FileSyncNever = "never"
+
+	defaultFileMaxSizeBytes         = int64(100 * 1024 * 1024) // 100MB
+	defaultFileFlushIntervalSeconds = int64(5)
+	fileBackupTimeFormat            = "2006-01-02T15-04-05.000000000"
+)
+
+// FileConfig represents the configuration of the file sink.
+type FileConfig struct {
+	Path                    string `json:"path"`
+	Format                  string `json:"format,omitempty"`
+	MaxSizeBytes            *int64 `json:"max_size_bytes,omitempty"`            // size after which the file is rotated, 0 disables size based rotation
+	RotationIntervalSeconds int64  `json:"rotation_interval_seconds,omitempty"` // age after which the file is rotated
+	MaxFiles                int    `json:"max_files,omitempty"`                 // max number of rotated files to keep
+	MaxAgeSeconds           int64  `json:"max_age_seconds,omitempty"`           // max age of rotated files to keep
+	Fsync                   string `json:"fsync,omitempty"`
+	FlushIntervalSeconds    *int64 `json:"flush_interval_seconds,omitempty"` // interval to flush compressed chunks and sync the file
+}
+
+func (c *FileConfig) validateAndInjectDefaults() error {
+
+	if c.Path == "" {
+		return fmt.Errorf("missing 'path'")
+	}
+
+	switch c.Format {
+	case "":
+		c.Format = FileFormatNDJSON
+	case FileFormatNDJSON, FileFormatGzip:
+	default:
+		return fmt.Errorf("invalid 'format' %q, allowed values are %q and %q", c.Format, FileFormatNDJSON, FileFormatGzip)
+	}
+
+	switch c.Fsync {
+	case "":
+		c.Fsync = FileSyncInterval
+	case FileSyncAlways, FileSyncInterval, FileSyncNever:
+	default:
+		return fmt.Errorf("invalid 'fsync' %q, allowed values are %q, %q and %q", c.Fsync, FileSyncAlways, FileSyncInterval, FileSyncNever)
+	}
+
+	if c.MaxSizeBytes == nil {
+		maxSize := defaultFileMaxSizeBytes
+		c.MaxSizeBytes = &maxSize
+	}
+
+	if *c.MaxSizeBytes < 0 || c.RotationIntervalSeconds < 0 || c.MaxFiles < 0 || c.MaxAgeSeconds < 0 {
+		return fmt.Errorf("rotation and retention limits must not be negative")
+	}
+
+	if c.FlushIntervalSeconds == nil {
+		interval := defaultFileFlushIntervalSeconds
+		c.FlushIntervalSeconds = &interval
+	}
+
+	if *c.FlushIntervalSeconds <= 0 {
+		return fmt.Errorf("'flush_interval_seconds' must be positive")
+	}
+
+	return nil
+}
+
+// fileSink writes decision log events to a local file. The file is rotated
+// based on its size and age. Rotated files are renamed to include the time of
+// the rotation and removed once the retention limits are exceeded.
+//
+// Every event (NDJSON) or chunk (gzip) is written with a single write. If OPA
+// crashes while writing, the incomplete data at the end of the file is
+// truncated the next time the file is opened.
+type fileSink struct {
+	config      FileConfig
+	uploadLimit int64
+	logger      logging.Logger
+	mtx         sync.Mutex
+	f           *os.File
+	size        int64
+	opened      time.Time
+	enc         *chunkEncoder // only set for the gzip format
+	dirty       bool          // data has been written since the last sync
+	stop        chan chan struct{}
+	now         func() time.Time
+	rename      func(oldpath, newpath string) error
+}
+
+func newFileSink(config FileConfig, uploadLimit int64, logger logging.Logger) *fileSink {
+	return &fileSink{
+		config:      config,
+		uploadLimit: uploadLimit,
+		logger:      logger,
+		now:         time.Now,
+		rename:      os.Rename,
+	}
+}
+
+// Open opens the file and starts flushing and syncing it periodically.
+func (s *fileSink) Open() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.stop != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.config.Path), 0o755); err != nil {
+		return err
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	if s.config.Format == FileFormatGzip {
+		s.enc = newChunkEncoder(s.uploadLimit)
+	}
+
+	s.stop = make(chan chan struct{})
+	go s.loop(s.stop)
+
+	return nil
+}
+
+// Close flushes pending events, syncs and closes the file.
+func (s *fileSink) Close() error {
+	s.mtx.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mtx.Unlock()
+
+	if stop != nil {
+		done := make(chan struct{})
+		stop <- done
+		<-done
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+
+	err := s.flush()
+	if syncErr := s.f.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := s.f.Close(); err == nil {
+		err = closeErr
+	}
+	s.f = nil
+	return err
+}
+
+// Write writes the event to the file. In the gzip format events are buffered
+// until a chunk is complete or the sink is flushed.
+func (s *fileSink) Write(event EventV1) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.stop == nil {
+		return fmt.Errorf("decision log file %v is not open", s.config.Path)
+	}
+
+	if s.enc != nil {
+		chunks, err := s.enc.Write(event)
+		if err != nil {
+			return err
+		}
+		return s.writeChunks(chunks)
+	}
+
+	bs, err := encodeEvent(event)
+	if err != nil {
+		return err
+	}
+
+	return s.write(bs)
+}
+
+func (s *fileSink) loop(stop chan chan struct{}) {
+	ticker := time.NewTicker(time.Duration(*s.config.FlushIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mtx.Lock()
+			if err := s.tick(); err != nil {
+				s.logger.Error("Failed to flush decision log file: %v.", err)
+			}
+			s.mtx.Unlock()
+		case done := <-stop:
+			done <- struct{}{}
+			return
+		}
+	}
+}
+
+// tick flushes pending chunks, syncs the file if required by the fsync policy
+// and rotates the file if it is older than the rotation interval.
+func (s *fileSink) tick() error {
+	if s.f == nil {
+		// The file could not be reopened after a failed rotation.
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	if s.config.Fsync == FileSyncInterval && s.dirty {
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+		s.dirty = false
+	}
+
+	if s.size > 0 && s.rotationDue() {
+		return s.rotate()
+	}
+
+	return nil
+}
+
+func (s *fileSink) flush() error {
+	if s.enc == nil {
+		return nil
+	}
+
+	chunks, err := s.enc.Flush()
+	if err != nil {
+		return err
+	}
+
+	return s.writeChunks(chunks)
+}
+
+func (s *fileSink) writeChunks(chunks [][]byte) error {
+	for _, chunk := range chunks {
+		if err := s.write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) write(bs []byte) error {
+
+	if s.size > 0 && (s.rotationDue() || (*s.config.MaxSizeBytes > 0 && s.size+int64(len(bs)) > *s.config.MaxSizeBytes)) {
+		// Events are still written to the current file if the rotation
+		// fails. The rotation is retried with the next write.
+		if err := s.rotate(); err != nil {
+			s.logger.Error("Failed to rotate decision log file: %v.", err)
+		}
+	}
+
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.Write(bs)
+	if err != nil {
+		// Remove the partially written data so that the next write does
+		// not append to an incomplete line or chunk.
+		if n > 0 {
+			if terr := s.f.Truncate(s.size); terr != nil {
+				s.size += int64(n)
+			}
+		}
+		return err
+	}
+
+	s.size += int64(n)
+	s.dirty = true
+
+	if s.config.Fsync == FileSyncAlways {
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+		s.dirty = false
+	}
+
+	return nil
+}
+
+func (s *fileSink) rotationDue() bool {
+	interval := time.Duration(s.config.RotationIntervalSeconds) * time.Second
+	return interval > 0 && s.now().Sub(s.opened) >= interval
+}
+
+// rotate renames the current file and opens a new one. If the file cannot be
+// renamed, the current file is reopened.
+func (s *fileSink) rotate() error {
+
+	if s.config.Fsync != FileSyncNever {
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+
+	s.f = nil
+
+	if err := s.rename(s.config.Path, s.backupName(s.now())); err != nil {
+		opened := s.opened
+		if oerr := s.open(); oerr != nil {
+			s.logger.Error("Failed to reopen decision log file: %v.", oerr)
+		} else {
+			// Keep the age of the file so that the next write retries
+			// the rotation.
+			s.opened = opened
+		}
+		return err
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	if err := s.removeBackups(); err != nil {
+		s.logger.Error("Failed to remove rotated decision log files: %v.", err)
+	}
+
+	return nil
+}
+
+// open opens the file for appending. Incomplete data written before a crash
+// is truncated first.
+func (s *fileSink) open() error {
+
+	f, err := os.OpenFile(s.config.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	size, err := s.recover(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f = f
+	s.size = size
+	s.opened = s.now()
+	s.dirty = false
+
+	return nil
+}
+
+// recover returns the size of the complete data in the file and truncates
+// anything after it.
+func (s *fileSink) recover(f *os.File) (int64, error) {
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size := fi.Size()
+	if size == 0 {
+		return 0, nil
+	}
+
+	var end int64
+	if s.config.Format == FileFormatGzip {
+		end, err = lastGzipMemberEnd(f)
+	} else {
+		end, err = lastLineEnd(f, size)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if end < size {
+		s.logger.Warn("Truncating %d bytes of incomplete data at the end of decision log file %v.", size-end, s.config.Path)
+		if err := f.Truncate(end); err != nil {
+			return 0, err
+		}
+	}
+
+	return end, nil
+}
+
+// backupName returns the name of the file rotated at t, e.g.,
+// decisions-2022-01-02T15-04-05.000000000.log for decisions.log.
+func (s *fileSink) backupName(t time.Time) string {
+	dir, base := filepath.Split(s.config.Path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext)
+
+	for {
+		name := filepath.Join(dir, prefix+"-"+t.UTC().Format(fileBackupTimeFormat)+ext)
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			return name
+		}
+		t = t.Add(time.Nanosecond)
+	}
+}
+
+type fileBackup struct {
+	name string
+	t    time.Time
+}
+
+// backups returns the rotated files ordered from oldest to newest.
+func (s *fileSink) backups() ([]fileBackup, error) {
+	dir, base := filepath.Split(s.config.Path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []fileBackup
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		t, err := time.Parse(fileBackupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if err != nil {
+			continue
+		}
+		result = append(result, fileBackup{name: filepath.Join(dir, name), t: t})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].t.Before(result[j].t)
+	})
+
+	return result, nil
+}
+
+// removeBackups removes the rotated files that exceed the retention limits.
+func (s *fileSink) removeBackups() error {
+
+	if s.config.MaxFiles == 0 && s.config.MaxAgeSeconds == 0 {
+		return nil
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		return err
+	}
+
+	maxAge := time.Duration(s.config.MaxAgeSeconds) * time.Second
+
+	for i, b := range backups {
+		expired := maxAge > 0 && s.now().Sub(b.t) > maxAge
+		excess := s.config.MaxFiles > 0 && len(backups)-i > s.config.MaxFiles
+		if !expired && !excess {
+			continue
+		}
+		if err := os.Remove(b.name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lastLineEnd returns the offset after the last newline in the file.
+func lastLineEnd(f *os.File, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	end := size
+
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+		if _, err := f.ReadAt(buf[:n], end-n); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return end - n + int64(i) + 1, nil
+		}
+		end -= n
+	}
+
+	return 0, nil
+}
+
+// lastGzipMemberEnd returns the offset after the last complete gzip member in
+// the file.
+func lastGzipMemberEnd(f *os.File) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// The gzip reader does not read past the end of a member if the
+	// underlying reader implements io.ByteReader.
+	cr := &countingReader{r: bufio.NewReader(f)}
+
+	var end int64
+	var zr *gzip.Reader
+
+	for {
+		var err error
+		if zr == nil {
+			zr, err = gzip.NewReader(cr)
+		} else {
+			err = zr.Reset(cr)
+		}
+		if err == nil {
+			zr.Multistream(false)
+			_, err = io.Copy(io.Discard, zr)
+		}
+
+		// Errors of the underlying file must not be mistaken for
+		// incomplete data.
+		if cr.err != nil {
+			return 0, cr.err
+		} else if err != nil {
+			return end, nil
+		}
+
+		end = cr.n
+	}
+}
+
+// countingReader counts the bytes read from a file and records read errors
+// other than io.EOF.
+type countingReader struct {
+	r   *bufio.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.record(err)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	c.record(err)
+	return b, err
+}
+
+func (c *countingReader) record(err error) {
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+}
@@ -0,0 +1,629 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meta-quick/opax/logging"
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/server"
+	"github.com/meta-quick/opax/storage/inmem"
+)
+
+func TestParseConfigFile(t *testing.T) {
+
+	config, err := ParseConfig([]byte(`{"file": {"path": "/var/log/opa/decisions.log"}}`), []string{"svc"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Service != "" {
+		t.Fatalf("Expected no default service with file logging but got %q", config.Service)
+	}
+
+	file := config.File
+	if file.Format != FileFormatNDJSON || file.Fsync != FileSyncInterval || *file.MaxSizeBytes != defaultFileMaxSizeBytes || *file.FlushIntervalSeconds != defaultFileFlushIntervalSeconds {
+		t.Fatalf("Expected defaults to be injected but got: %+v", file)
+	}
+
+	tests := []struct {
+		note    string
+		config  string
+		wantErr string
+	}{
+		{
+			note:    "missing path",
+			config:  `{"file": {}}`,
+			wantErr: "invalid file config in decision_logs: missing 'path'",
+		},
+		{
+			note:    "invalid format",
+			config:  `{"file": {"path": "x", "format": "json"}}`,
+			wantErr: "invalid 'format' \"json\"",
+		},
+		{
+			note:    "invalid fsync",
+			config:  `{"file": {"path": "x", "fsync": "sometimes"}}`,
+			wantErr: "invalid 'fsync' \"sometimes\"",
+		},
+		{
+			note:    "negative limit",
+			config:  `{"file": {"path": "x", "max_files": -1}}`,
+			wantErr: "rotation and retention limits must not be negative",
+		},
+		{
+			note:    "zero flush interval",
+			config:  `{"file": {"path": "x", "flush_interval_seconds": 0}}`,
+			wantErr: "'flush_interval_seconds' must be positive",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tc.config), nil, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Expected error %q but got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func newTestFileSink(t *testing.T, config string) *fileSink {
+	t.Helper()
+
+	var fc FileConfig
+	if err := json.Unmarshal([]byte(config), &fc); err != nil {
+		t.Fatal(err)
+	}
+
+	if fc.Path == "" {
+		fc.Path = filepath.Join(t.TempDir(), "logs", "decisions.log")
+	}
+
+	if err := fc.validateAndInjectDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	return newFileSink(fc, defaultUploadSizeLimitBytes, logging.NewNoOpLogger())
+}
+
+func testEvent(id int) EventV1 {
+	var result interface{} = true
+	return EventV1{
+		DecisionID: fmt.Sprint(id),
+		Path:       "http/authz/allow",
+		Result:     &result,
+		Timestamp:  time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func readNDJSON(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event EventV1
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, event.DecisionID)
+	}
+	return ids
+}
+
+func readGzip(t *testing.T, path string) []string {
+	t.Helper()
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every gzip member is a chunk as it would be uploaded.
+	var ids []string
+	r := bytes.NewReader(bs)
+	for r.Len() > 0 {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr.Multistream(false)
+		chunk, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		_, _ = w.Write(chunk)
+		_ = w.Close()
+
+		events, err := newChunkDecoder(compressed.Bytes()).decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range events {
+			ids = append(ids, e.DecisionID)
+		}
+	}
+	return ids
+}
+
+func TestFileSinkNDJSON(t *testing.T) {
+
+	s := newTestFileSink(t, `{"fsync": "always"}`)
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := s.Write(testEvent(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ids := readNDJSON(t, s.config.Path); strings.Join(ids, ",") != "0,1,2" {
+		t.Fatalf("Unexpected events: %v", ids)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Write(testEvent(3)); err == nil {
+		t.Fatal("Expected error writing to closed sink")
+	}
+
+	// Reopening appends to the existing file.
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Write(testEvent(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := readNDJSON(t, s.config.Path); strings.Join(ids, ",") != "0,1,2,3" {
+		t.Fatalf("Unexpected events: %v", ids)
+	}
+}
+
+func TestFileSinkGzip(t *testing.T) {
+
+	s := newTestFileSink(t, `{"format": "gzip"}`)
+	s.uploadLimit = 400
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := s.Write(testEvent(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := readGzip(t, s.config.Path)
+	if len(ids) != 20 || ids[0] != "0" || ids[19] != "19" {
+		t.Fatalf("Unexpected events: %v", ids)
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+
+	s := newTestFileSink(t, `{"max_size_bytes": 500, "max_files": 2}`)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := s.Write(testEvent(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 rotated files to be retained but got %v", backups)
+	}
+
+	var ids []string
+	for _, b := range backups {
+		fi, err := os.Stat(b.name)
+		if err != nil {
+			t.Fatal(err)
+		} else if fi.Size() > 500 {
+			t.Fatalf("Expected rotated file to be at most 500 bytes but got %v", fi.Size())
+		}
+		ids = append(ids, readNDJSON(t, b.name)...)
+	}
+	ids = append(ids, readNDJSON(t, s.config.Path)...)
+
+	// The oldest events have been removed with the rotated files and the
+	// remaining events are consecutive.
+	if len(ids) >= 20 {
+		t.Fatalf("Expected oldest events to be removed but got: %v", ids)
+	}
+
+	for i, id := range ids {
+		if exp := fmt.Sprint(20 - len(ids) + i); id != exp {
+			t.Fatalf("Expected event %v at %d but got: %v", exp, i, ids)
+		}
+	}
+}
+
+func TestFileSinkRotationRenameFailure(t *testing.T) {
+
+	s := newTestFileSink(t, `{"max_size_bytes": 500}`)
+
+	failing := true
+	s.rename = func(oldpath, newpath string) error {
+		if failing {
+			return fmt.Errorf("rename failed")
+		}
+		return os.Rename(oldpath, newpath)
+	}
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Events are written to the current file while the rotation fails.
+	for i := 0; i < 10; i++ {
+		if err := s.Write(testEvent(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failing = false
+
+	if err := s.Write(testEvent(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(backups) != 1 {
+		t.Fatalf("Expected the file to be rotated once but got %v", backups)
+	}
+
+	ids := append(readNDJSON(t, backups[0].name), readNDJSON(t, s.config.Path)...)
+	if len(ids) != 11 || ids[0] != "0" || ids[10] != "10" {
+		t.Fatalf("Expected all events to be written but got: %v", ids)
+	}
+}
+
+func TestFileSinkTimeRotationAndMaxAge(t *testing.T) {
+
+	s := newTestFileSink(t, `{"rotation_interval_seconds": 60, "max_age_seconds": 150}`)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 4; i++ {
+		s.mtx.Lock()
+		if err := s.write([]byte(fmt.Sprintf("{\"decision_id\": \"%d\"}\n", i))); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+		if err := s.tick(); err != nil {
+			t.Fatal(err)
+		}
+		s.mtx.Unlock()
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files were rotated at 1m, 2m, 3m and 4m. The file rotated at 1m is
+	// older than the max age.
+	var names []string
+	for _, b := range backups {
+		names = append(names, filepath.Base(b.name))
+	}
+
+	exp := []string{
+		"decisions-2022-01-01T00-02-00.000000000.log",
+		"decisions-2022-01-01T00-03-00.000000000.log",
+		"decisions-2022-01-01T00-04-00.000000000.log",
+	}
+
+	if strings.Join(names, ",") != strings.Join(exp, ",") {
+		t.Fatalf("Expected rotated files %v but got %v", exp, names)
+	}
+
+	if ids := readNDJSON(t, backups[2].name); len(ids) != 1 || ids[0] != "3" {
+		t.Fatalf("Unexpected events in newest rotated file: %v", ids)
+	}
+
+	// Empty files are not rotated.
+	s.mtx.Lock()
+	now = now.Add(time.Hour)
+	if err := s.tick(); err != nil {
+		t.Fatal(err)
+	}
+	s.mtx.Unlock()
+
+	if b, _ := s.backups(); len(b) != 3 {
+		t.Fatalf("Expected empty file not to be rotated but got %v", b)
+	}
+}
+
+func TestFileSinkRecoverPartialLine(t *testing.T) {
+
+	s := newTestFileSink(t, `{}`)
+
+	if err := os.MkdirAll(filepath.Dir(s.config.Path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := encodeEvent(testEvent(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partial := append(append([]byte{}, line...), []byte(`{"decision_id": "1", "pa`)...)
+	if err := os.WriteFile(s.config.Path, partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Write(testEvent(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := readNDJSON(t, s.config.Path); strings.Join(ids, ",") != "0,2" {
+		t.Fatalf("Unexpected events: %v", ids)
+	}
+}
+
+func TestFileSinkRecoverPartialGzipMember(t *testing.T) {
+
+	s := newTestFileSink(t, `{"format": "gzip"}`)
+
+	if err := os.MkdirAll(filepath.Dir(s.config.Path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	enc := newChunkEncoder(defaultUploadSizeLimitBytes)
+	var data []byte
+	for i := 0; i < 2; i++ {
+		if _, err := enc.Write(testEvent(i)); err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := enc.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, chunks[0]...)
+	}
+
+	// Simulate a crash while writing the second chunk.
+	if err := os.WriteFile(s.config.Path, data[:len(data)-10], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Write(testEvent(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := readGzip(t, s.config.Path); strings.Join(ids, ",") != "0,2" {
+		t.Fatalf("Unexpected events: %v", ids)
+	}
+}
+
+func TestPluginFileSink(t *testing.T) {
+
+	ctx := context.Background()
+	manager, _ := plugins.New(nil, "test-instance-id", inmem.New())
+
+	path := filepath.Join(t.TempDir(), "decisions.log")
+
+	config, err := ParseConfig([]byte(fmt.Sprintf(`{"file": {"path": %q}}`, path)), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := plugin.Log(ctx, &server.Info{DecisionID: fmt.Sprint(i), Path: "http/authz/allow"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reconfiguring the file sink closes the current file.
+	newPath := filepath.Join(t.TempDir(), "decisions.log")
+	newConfig, err := ParseConfig([]byte(fmt.Sprintf(`{"file": {"path": %q}}`, newPath)), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin.Reconfigure(ctx, newConfig)
+
+	if err := plugin.Log(ctx, &server.Info{DecisionID: "2", Path: "http/authz/allow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin.Stop(ctx)
+
+	if ids := readNDJSON(t, path); strings.Join(ids, ",") != "0,1" {
+		t.Fatalf("Unexpected events: %v", ids)
+	}
+
+	if ids := readNDJSON(t, newPath); strings.Join(ids, ",") != "2" {
+		t.Fatalf("Unexpected events: %v", ids)
+	}
+}
+
+func TestPluginFileSinkReconfigureSamePath(t *testing.T) {
+
+	ctx := context.Background()
+	manager, _ := plugins.New(nil, "test-instance-id", inmem.New())
+
+	path := filepath.Join(t.TempDir(), "decisions.log")
+
+	parse := func(maxFiles int) *Config {
+		config, err := ParseConfig([]byte(fmt.Sprintf(`{"file": {"path": %q, "format": "gzip", "max_files": %d}}`, path, maxFiles)), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+
+	plugin := New(parse(1), manager)
+
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := plugin.Log(ctx, &server.Info{DecisionID: fmt.Sprint(i), Path: "http/authz/allow"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The pending chunk of the current sink is flushed before the new sink
+	// appends to the same file.
+	plugin.Reconfigure(ctx, parse(2))
+
+	for i := 3; i < 5; i++ {
+		if err := plugin.Log(ctx, &server.Info{DecisionID: fmt.Sprint(i), Path: "http/authz/allow"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin.Stop(ctx)
+
+	if ids := readGzip(t, path); strings.Join(ids, ",") != "0,1,2,3,4" {
+		t.Fatalf("Unexpected events: %v", ids)
+	}
+}
+
+func TestPluginFileSinkReconfigureOpenFailure(t *testing.T) {
+
+	ctx := context.Background()
+	manager, _ := plugins.New(nil, "test-instance-id", inmem.New())
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "decisions.log")
+
+	config, err := ParseConfig([]byte(fmt.Sprintf(`{"file": {"path": %q}}`, path)), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := plugin.Log(ctx, &server.Info{DecisionID: "0", Path: "http/authz/allow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The directory of the new file cannot be created, so the current file
+	// is kept and the plugin reports an error.
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	newConfig, err := ParseConfig([]byte(fmt.Sprintf(`{"file": {"path": %q}}`, filepath.Join(blocker, "decisions.log"))), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin.Reconfigure(ctx, newConfig)
+
+	if status := manager.PluginStatus()[Name]; status == nil || status.State != plugins.StateErr {
+		t.Fatalf("Expected error status but got: %v", status)
+	}
+
+	if err := plugin.Log(ctx, &server.Info{DecisionID: "1", Path: "http/authz/allow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin.Stop(ctx)
+
+	if ids := readNDJSON(t, path); strings.Join(ids, ",") != "0,1" {
+		t.Fatalf("Unexpected events: %v", ids)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
@@ -21,6 +22,7 @@ import (
 	"golang.org/x/time/rate"
 
 	"github.com/meta-quick/opax/ast"
+	iprom "github.com/meta-quick/opax/internal/prometheus"
 	"github.com/meta-quick/opax/internal/ref"
 	"github.com/meta-quick/opax/logging"
 	"github.com/meta-quick/opax/metrics"
@@ -58,10 +60,22 @@ type EventV1 struct {
 	RequestedBy string                  `json:"requested_by,omitempty"`
 	Timestamp   time.Time               `json:"timestamp"`
 	Metrics     map[string]interface{}  `json:"metrics,omitempty"`
+	Divergence  *DivergenceV1           `json:"divergence,omitempty"`
 
 	inputAST ast.Value
 }
 
+// DivergenceV1 describes the outcome of a shadow bundle evaluation that
+// differs from the decision's outcome.
+type DivergenceV1 struct {
+	DecisionID string       `json:"decision_id,omitempty"` // ID of the diverging decision
+	Bundle     string       `json:"bundle"`
+	Revision   string       `json:"revision,omitempty"`
+	InputHash  string       `json:"input_hash,omitempty"`
+	Result     *interface{} `json:"result,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
 // BundleInfoV1 describes a bundle associated with a decision log event.
 type BundleInfoV1 struct {
 	Revision string `json:"revision,omitempty"`
@@ -91,6 +105,7 @@ var errorKey = ast.StringTerm("error")
 var requestedByKey = ast.StringTerm("requested_by")
 var timestampKey = ast.StringTerm("timestamp")
 var metricsKey = ast.StringTerm("metrics")
+var divergenceKey = ast.StringTerm("divergence")
 
 // AST returns the Rego AST representation for a given EventV1 object.
 // This avoids having to round trip through JSON while applying a decision log
@@ -193,6 +208,32 @@ func (e *EventV1) AST() (ast.Value, error) {
 		event.Insert(metricsKey, ast.NewTerm(m))
 	}
 
+	if e.Divergence != nil {
+		divergence := map[string]interface{}{
+			"bundle": e.Divergence.Bundle,
+		}
+		if len(e.Divergence.DecisionID) > 0 {
+			divergence["decision_id"] = e.Divergence.DecisionID
+		}
+		if len(e.Divergence.Revision) > 0 {
+			divergence["revision"] = e.Divergence.Revision
+		}
+		if len(e.Divergence.InputHash) > 0 {
+			divergence["input_hash"] = e.Divergence.InputHash
+		}
+		if e.Divergence.Result != nil {
+			divergence["result"] = *e.Divergence.Result
+		}
+		if len(e.Divergence.Error) > 0 {
+			divergence["error"] = e.Divergence.Error
+		}
+		d, err := roundtripJSONToAST(divergence)
+		if err != nil {
+			return nil, err
+		}
+		event.Insert(divergenceKey, ast.NewTerm(d))
+	}
+
 	return event, nil
 }
 
@@ -215,7 +256,13 @@ const (
 	defaultUploadSizeLimitBytes = int64(32768) // 32KB limit
 	defaultBufferSizeLimitBytes = int64(0)     // unlimited
 	defaultMaskDecisionPath     = "/system/log/mask"
+	defaultDropDecisionPath     = "/system/log/drop"
 	logDropCounterName          = "decision_logs_dropped"
+	logDropPolicyCounterName    = "decision_logs_dropped_by_policy"
+	logDropSamplingCounterName  = "decision_logs_dropped_by_sampling"
+	logSampledCounterName       = "decision_logs_sampled"
+	logDropErrorCounterName     = "decision_logs_drop_errors"
+	logDropOversizedCounterName = "decision_logs_dropped_oversized"
 	defaultResourcePath         = "/logs"
 )
 
@@ -227,6 +274,8 @@ type ReportingConfig struct {
 	MaxDelaySeconds       *int64               `json:"max_delay_seconds,omitempty"`        // max amount of time to wait between poll attempts
 	MaxDecisionsPerSecond *float64             `json:"max_decisions_per_second,omitempty"` // max number of decision logs to buffer per second
 	Trigger               *plugins.TriggerMode `json:"trigger,omitempty"`                  // trigger mode
+	Persist               bool                 `json:"persist,omitempty"`                  // buffer decisions on disk
+	PersistSizeLimitBytes *int64               `json:"persist_size_limit_bytes,omitempty"` // max size of on-disk buffer
 }
 
 // Config represents the plugin configuration.
@@ -236,9 +285,13 @@ type Config struct {
 	PartitionName   string          `json:"partition_name,omitempty"`
 	Reporting       ReportingConfig `json:"reporting"`
 	MaskDecision    *string         `json:"mask_decision"`
+	DropDecision    *string         `json:"drop_decision"`
+	Sampling        []SamplingRule  `json:"sampling,omitempty"`
 	ConsoleLogs     bool            `json:"console"`
+	File            *FileConfig     `json:"file,omitempty"`
 	Resource        *string         `json:"resource"`
 	maskDecisionRef ast.Ref
+	dropDecisionRef ast.Ref
 }
 
 func (c *Config) validateAndInjectDefaults(services []string, pluginsList []string, trigger *plugins.TriggerMode) error {
@@ -254,11 +307,11 @@ func (c *Config) validateAndInjectDefaults(services []string, pluginsList []stri
 		if !found {
 			return fmt.Errorf("invalid plugin name %q in decision_logs", *c.Plugin)
 		}
-	} else if c.Service == "" && len(services) != 0 && !c.ConsoleLogs {
+	} else if c.Service == "" && len(services) != 0 && !c.ConsoleLogs && c.File == nil {
 		// For backwards compatibility allow defaulting to the first
-		// service listed, but only if console logging is disabled. If enabled
-		// we can't tell if the deployer wanted to use only console logs or
-		// both console logs and the default service option.
+		// service listed, but only if console and file logging are disabled.
+		// If enabled we can't tell if the deployer wanted to use only local
+		// logs or both local logs and the default service option.
 		c.Service = services[0]
 	} else if c.Service != "" {
 		found := false
@@ -316,6 +369,26 @@ func (c *Config) validateAndInjectDefaults(services []string, pluginsList []stri
 		return fmt.Errorf("invalid decision_log config, specify either 'buffer_size_limit_bytes' or 'max_decisions_per_second'")
 	}
 
+	if c.Reporting.Persist {
+		if c.Service == "" {
+			return fmt.Errorf("invalid decision_log config, 'persist' requires 'service'")
+		}
+
+		if c.Reporting.BufferSizeLimitBytes != nil {
+			return fmt.Errorf("invalid decision_log config, specify either 'buffer_size_limit_bytes' or 'persist_size_limit_bytes'")
+		}
+	} else if c.Reporting.PersistSizeLimitBytes != nil {
+		return fmt.Errorf("invalid decision_log config, 'persist_size_limit_bytes' requires 'persist'")
+	}
+
+	// default the on-disk buffer size limit
+	persistLimit := defaultBufferSizeLimitBytes
+	if c.Reporting.PersistSizeLimitBytes != nil {
+		persistLimit = *c.Reporting.PersistSizeLimitBytes
+	}
+
+	c.Reporting.PersistSizeLimitBytes = &persistLimit
+
 	// default the buffer size limit
 	bufferLimit := defaultBufferSizeLimitBytes
 	if c.Reporting.BufferSizeLimitBytes != nil {
@@ -334,6 +407,28 @@ func (c *Config) validateAndInjectDefaults(services []string, pluginsList []stri
 		return fmt.Errorf("invalid mask_decision in decision_logs: %w", err)
 	}
 
+	if c.DropDecision == nil {
+		dropDecision := defaultDropDecisionPath
+		c.DropDecision = &dropDecision
+	}
+
+	c.dropDecisionRef, err = ref.ParseDataPath(*c.DropDecision)
+	if err != nil {
+		return fmt.Errorf("invalid drop_decision in decision_logs: %w", err)
+	}
+
+	if c.File != nil {
+		if err := c.File.validateAndInjectDefaults(); err != nil {
+			return fmt.Errorf("invalid file config in decision_logs: %w", err)
+		}
+	}
+
+	for i := range c.Sampling {
+		if err := c.Sampling[i].validateAndInjectDefaults(); err != nil {
+			return fmt.Errorf("invalid sampling rule %d in decision_logs: %w", i, err)
+		}
+	}
+
 	if c.PartitionName != "" {
 		resourcePath := fmt.Sprintf("/logs/%v", c.PartitionName)
 		c.Resource = &resourcePath
@@ -354,12 +449,17 @@ type Plugin struct {
 	manager   *plugins.Manager
 	config    Config
 	buffer    *logBuffer
+	disk      *diskBuffer
 	enc       *chunkEncoder
+	file      *fileSink
+	fileMtx   sync.RWMutex // held by writers while writing to file
 	mtx       sync.Mutex
 	stop      chan chan struct{}
 	reconfig  chan reconfigure
 	mask      *rego.PreparedEvalQuery
 	maskMutex sync.Mutex
+	drop      *rego.PreparedEvalQuery
+	dropMutex sync.Mutex
 	limiter   *rate.Limiter
 	metrics   metrics.Metrics
 	logger    logging.Logger
@@ -430,7 +530,7 @@ func (b *ConfigBuilder) Parse() (*Config, error) {
 		return nil, err
 	}
 
-	if parsedConfig.Plugin == nil && parsedConfig.Service == "" && len(b.services) == 0 && !parsedConfig.ConsoleLogs {
+	if parsedConfig.Plugin == nil && parsedConfig.Service == "" && len(b.services) == 0 && !parsedConfig.ConsoleLogs && parsedConfig.File == nil {
 		// Nothing to validate or inject
 		return nil, nil
 	}
@@ -455,6 +555,10 @@ func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
 		logger:   manager.Logger().WithFields(map[string]interface{}{"plugin": Name}),
 	}
 
+	if parsedConfig.File != nil {
+		plugin.file = newFileSink(*parsedConfig.File, *parsedConfig.Reporting.UploadSizeLimitBytes, plugin.logger)
+	}
+
 	if parsedConfig.Reporting.MaxDecisionsPerSecond != nil {
 		limit := *parsedConfig.Reporting.MaxDecisionsPerSecond
 		plugin.limiter = rate.NewLimiter(rate.Limit(limit), int(math.Max(1, limit)))
@@ -467,10 +571,17 @@ func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
 	return plugin
 }
 
-// WithMetrics sets the global metrics provider to be used by the plugin.
+// WithMetrics sets the global metrics provider to be used by the plugin. If
+// the provider exports Prometheus collectors, the backlog of the on-disk
+// buffer is exported too.
 func (p *Plugin) WithMetrics(m metrics.Metrics) *Plugin {
 	p.metrics = m
 	p.enc.WithMetrics(m)
+
+	if err := iprom.Register(m, backlogCollector{manager: p.manager}); err != nil {
+		p.logger.Error("Failed to register decision log backlog metrics: %v.", err)
+	}
+
 	return p
 }
 
@@ -488,6 +599,30 @@ func Lookup(manager *plugins.Manager) *Plugin {
 // Start starts the plugin.
 func (p *Plugin) Start(ctx context.Context) error {
 	p.logger.Info("Starting decision logger.")
+
+	p.fileMtx.RLock()
+	file := p.file
+	p.fileMtx.RUnlock()
+
+	if file != nil {
+		if err := file.Open(); err != nil {
+			p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateErr, Message: err.Error()})
+			return fmt.Errorf("failed to open decision log file: %w", err)
+		}
+	}
+
+	if p.config.Reporting.Persist {
+		disk, err := p.openDiskBuffer(&p.config)
+		if err != nil {
+			p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateErr, Message: err.Error()})
+			return fmt.Errorf("failed to open decision log buffer: %w", err)
+		}
+
+		p.mtx.Lock()
+		p.disk = disk
+		p.mtx.Unlock()
+	}
+
 	go p.loop()
 	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateOK})
 	return nil
@@ -506,6 +641,28 @@ func (p *Plugin) Stop(ctx context.Context) {
 	done := make(chan struct{})
 	p.stop <- done
 	<-done
+
+	p.fileMtx.RLock()
+	file := p.file
+	p.fileMtx.RUnlock()
+
+	p.mtx.Lock()
+	disk := p.disk
+	p.disk = nil
+	p.mtx.Unlock()
+
+	if file != nil {
+		if err := file.Close(); err != nil {
+			p.logger.Error("Failed to close decision log file: %v.", err)
+		}
+	}
+
+	if disk != nil {
+		if err := disk.Close(); err != nil {
+			p.logger.Error("Failed to close decision log buffer: %v.", err)
+		}
+	}
+
 	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
 }
 
@@ -568,7 +725,52 @@ func (p *Plugin) Log(ctx context.Context, decision *server.Info) error {
 		event.Error = decision.Error
 	}
 
-	err := p.maskEvent(ctx, decision.Txn, &event)
+	if d := decision.Divergence; d != nil {
+		event.Divergence = &DivergenceV1{
+			DecisionID: d.DecisionID,
+			Bundle:     d.Bundle,
+			Revision:   d.Revision,
+			InputHash:  d.InputHash,
+			Result:     d.Results,
+		}
+		if d.Error != nil {
+			event.Divergence.Error = d.Error.Error()
+		}
+	}
+
+	// Failures of the drop decision or the sampling rules must not erase
+	// the audit trail, so the event is logged as if it was not dropped.
+	drop, err := p.dropEvent(ctx, decision.Txn, &event)
+	if err != nil {
+		p.incrCounter(logDropErrorCounterName)
+		p.logger.Error("Log drop decision failed, logging event: %v.", err)
+		drop = false
+	}
+
+	if drop {
+		p.incrCounter(logDropPolicyCounterName)
+		p.logger.Debug("Decision log event to path %v dropped by drop decision.", event.Path)
+		return nil
+	}
+
+	if len(p.config.Sampling) > 0 {
+		sampled, err := sample(p.config.Sampling, &event)
+		if err != nil {
+			p.incrCounter(logDropErrorCounterName)
+			p.logger.Error("Log event sampling failed, logging event: %v.", err)
+			sampled = samplingNoMatch
+		}
+
+		switch sampled {
+		case samplingKeep:
+			p.incrCounter(logSampledCounterName)
+		case samplingDrop:
+			p.incrCounter(logDropSamplingCounterName)
+			return nil
+		}
+	}
+
+	err = p.maskEvent(ctx, decision.Txn, &event)
 	if err != nil {
 		// TODO(tsandall): see note below about error handling.
 		p.logger.Error("Log event masking failed: %v.", err)
@@ -584,9 +786,24 @@ func (p *Plugin) Log(ctx context.Context, decision *server.Info) error {
 
 	if p.config.Service != "" {
 		p.mtx.Lock()
-		p.encodeAndBufferEvent(event)
+		disk := p.disk
+		if disk == nil {
+			p.encodeAndBufferEvent(event)
+		}
 		p.mtx.Unlock()
+
+		if disk != nil {
+			p.encodeAndPersistEvent(disk, event)
+		}
+	}
+
+	p.fileMtx.RLock()
+	if p.file != nil {
+		if err := p.file.Write(event); err != nil {
+			p.logger.Error("Failed to write to decision log file: %v.", err)
+		}
 	}
+	p.fileMtx.RUnlock()
 
 	if p.config.Plugin != nil {
 		proxy, ok := p.manager.Plugin(*p.config.Plugin).(Logger)
@@ -606,8 +823,12 @@ func (p *Plugin) Reconfigure(_ context.Context, config interface{}) {
 	p.reconfig <- reconfigure{config: config, done: done}
 
 	p.maskMutex.Lock()
-	defer p.maskMutex.Unlock()
 	p.mask = nil
+	p.maskMutex.Unlock()
+
+	p.dropMutex.Lock()
+	p.drop = nil
+	p.dropMutex.Unlock()
 
 	<-done
 }
@@ -639,11 +860,15 @@ func (p *Plugin) Trigger(ctx context.Context) error {
 
 // compilerUpdated is called when a compiler trigger on the plugin manager
 // fires. This indicates a new compiler instance is available. The decision
-// logger needs to prepare a new masking query.
+// logger needs to prepare new masking and drop queries.
 func (p *Plugin) compilerUpdated(txn storage.Transaction) {
 	p.maskMutex.Lock()
-	defer p.maskMutex.Unlock()
 	p.mask = nil
+	p.maskMutex.Unlock()
+
+	p.dropMutex.Lock()
+	p.drop = nil
+	p.dropMutex.Unlock()
 }
 
 func (p *Plugin) loop() {
@@ -712,6 +937,24 @@ func (p *Plugin) doOneShot(ctx context.Context) error {
 }
 
 func (p *Plugin) oneShot(ctx context.Context) (ok bool, err error) {
+	ok, err = p.oneShotBuffer(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	p.mtx.Lock()
+	disk := p.disk
+	p.mtx.Unlock()
+
+	if disk == nil {
+		return ok, nil
+	}
+
+	uploaded, err := p.oneShotDisk(ctx, disk)
+	return ok || uploaded, err
+}
+
+func (p *Plugin) oneShotBuffer(ctx context.Context) (ok bool, err error) {
 	// Make a local copy of the plugins's encoder and buffer and create
 	// a new encoder and buffer. This is needed as locking the buffer for
 	// the upload duration will block policy evaluation and result in
@@ -768,6 +1011,74 @@ func (p *Plugin) oneShot(ctx context.Context) (ok bool, err error) {
 	return err == nil, err
 }
 
+// oneShotDisk uploads the decisions in the on-disk buffer. Decisions are only
+// removed from the buffer after the service has acknowledged their upload.
+func (p *Plugin) oneShotDisk(ctx context.Context, disk *diskBuffer) (ok bool, err error) {
+	limit := *p.config.Reporting.UploadSizeLimitBytes
+
+	for {
+		entries, err := disk.Peek(limit * diskBufferReadLimitFactor)
+		if err != nil {
+			return ok, err
+		} else if len(entries) == 0 {
+			return ok, nil
+		}
+
+		enc := newChunkEncoder(limit).WithMetrics(p.metrics)
+
+		// Entries that were persisted before the upload size limit was
+		// reduced may not fit into a chunk. They could never be uploaded,
+		// so they are dropped instead of blocking the buffer.
+		var written []diskBufferEntry
+		var chunks [][]byte
+		for _, entry := range entries {
+			if int64(len(entry.bs)+2) > limit {
+				p.incrCounter(logDropOversizedCounterName)
+				p.logger.Error("Dropped buffered decision of %d bytes that exceeds the upload size limit.", len(entry.bs))
+				continue
+			}
+			result, err := enc.WriteBytes(entry.bs)
+			if err != nil {
+				return ok, err
+			}
+			written = append(written, entry)
+			chunks = append(chunks, result...)
+		}
+
+		result, err := enc.Flush()
+		if err != nil {
+			return ok, err
+		}
+		chunks = append(chunks, result...)
+
+		// The chunks contain the written entries in order. Acknowledge the
+		// entries in each chunk once it has been uploaded.
+		var n int
+		for _, chunk := range chunks {
+			events, err := newChunkDecoder(chunk).decode()
+			if err != nil {
+				return ok, err
+			}
+
+			if err := uploadChunk(ctx, p.manager.Client(p.config.Service), *p.config.Resource, chunk); err != nil {
+				return ok, err
+			}
+
+			n += len(events)
+			ok = true
+
+			if err := disk.Ack(written[n-1].seq); err != nil {
+				return ok, err
+			}
+		}
+
+		// Acknowledge the dropped entries after the last written one.
+		if err := disk.Ack(entries[len(entries)-1].seq); err != nil {
+			return ok, err
+		}
+	}
+}
+
 func (p *Plugin) reconfigure(config interface{}) {
 
 	newConfig := config.(*Config)
@@ -778,15 +1089,112 @@ func (p *Plugin) reconfigure(config interface{}) {
 	}
 
 	p.logger.Info("Decision log uploader configuration changed.")
+
+	if !reflect.DeepEqual(p.config.File, newConfig.File) {
+		p.reconfigureFile(newConfig)
+	}
+
+	if p.config.Reporting.Persist != newConfig.Reporting.Persist {
+		p.reconfigureDiskBuffer(newConfig)
+	} else if newConfig.Reporting.Persist {
+		p.mtx.Lock()
+		if p.disk != nil {
+			p.disk.SetLimit(*newConfig.Reporting.PersistSizeLimitBytes)
+		}
+		p.mtx.Unlock()
+	}
+
 	p.config = *newConfig
 }
 
+// reconfigureFile closes the current file sink and opens the new one.
+//
+// The current sink is closed before the new one is opened because both may
+// write to the same file. Decisions logged in the meantime wait for the new
+// sink. If the new sink cannot be opened, the current one is reopened and the
+// plugin reports an error.
+func (p *Plugin) reconfigureFile(newConfig *Config) {
+
+	p.fileMtx.Lock()
+	defer p.fileMtx.Unlock()
+
+	old := p.file
+	p.file = nil
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			p.logger.Error("Failed to close decision log file: %v.", err)
+		}
+	}
+
+	if newConfig.File == nil {
+		return
+	}
+
+	file := newFileSink(*newConfig.File, *newConfig.Reporting.UploadSizeLimitBytes, p.logger)
+	if err := file.Open(); err != nil {
+		p.logger.Error("Failed to open decision log file: %v.", err)
+		p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateErr, Message: fmt.Sprintf("failed to open decision log file: %v", err)})
+
+		if old != nil {
+			if err := old.Open(); err != nil {
+				p.logger.Error("Failed to reopen decision log file: %v.", err)
+				return
+			}
+			p.file = old
+		}
+		return
+	}
+
+	p.file = file
+	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateOK})
+}
+
+// reconfigureDiskBuffer opens or closes the on-disk buffer. Decisions that
+// remain in a closed buffer are uploaded when it is enabled again.
+func (p *Plugin) reconfigureDiskBuffer(newConfig *Config) {
+
+	var disk *diskBuffer
+	if newConfig.Reporting.Persist {
+		var err error
+		disk, err = p.openDiskBuffer(newConfig)
+		if err != nil {
+			p.logger.Error("Failed to open decision log buffer: %v.", err)
+			disk = nil
+		}
+	}
+
+	p.mtx.Lock()
+	old := p.disk
+	p.disk = disk
+	p.mtx.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			p.logger.Error("Failed to close decision log buffer: %v.", err)
+		}
+	}
+}
+
+// openDiskBuffer opens the on-disk buffer in the persistence directory.
+func (p *Plugin) openDiskBuffer(config *Config) (*diskBuffer, error) {
+	persistDir, err := p.manager.Config.GetPersistenceDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	disk := newDiskBuffer(filepath.Join(persistDir, "decision_logs"), *config.Reporting.PersistSizeLimitBytes, p.logger)
+	if err := disk.Open(); err != nil {
+		return nil, err
+	}
+
+	return disk, nil
+}
+
 func (p *Plugin) encodeAndBufferEvent(event EventV1) {
 	if p.limiter != nil {
 		if !p.limiter.Allow() {
-			if p.metrics != nil {
-				p.metrics.Counter(logDropCounterName).Incr()
-			}
+			p.incrCounter(logDropCounterName)
 
 			p.logger.Error("Decision log dropped as rate limit exceeded. Reduce reporting interval or increase rate limit.")
 			return
@@ -807,6 +1215,43 @@ func (p *Plugin) encodeAndBufferEvent(event EventV1) {
 	}
 }
 
+// encodeAndPersistEvent writes the event to the on-disk buffer. Unlike the
+// in-memory buffer, events are stored individually and only compressed into
+// chunks when they are uploaded.
+func (p *Plugin) encodeAndPersistEvent(disk *diskBuffer, event EventV1) {
+	if p.limiter != nil {
+		if !p.limiter.Allow() {
+			p.incrCounter(logDropCounterName)
+
+			p.logger.Error("Decision log dropped as rate limit exceeded. Reduce reporting interval or increase rate limit.")
+			return
+		}
+	}
+
+	bs, err := encodeEvent(event)
+	if err != nil {
+		p.logger.Error("Log encoding failed: %v.", err)
+		return
+	}
+
+	// Events that do not fit into an upload chunk could never be uploaded.
+	if int64(len(bs)+2) > *p.config.Reporting.UploadSizeLimitBytes {
+		p.incrCounter(logDropOversizedCounterName)
+		p.logger.Error("Log encoding failed: upload chunk size too small.")
+		return
+	}
+
+	dropped, err := disk.Push(bs, time.Now())
+	if err != nil {
+		p.logger.Error("Failed to write to decision log buffer: %v.", err)
+		return
+	}
+
+	if dropped > 0 {
+		p.logger.Error("Dropped %v decisions from buffer. Reduce reporting interval or increase buffer size.", dropped)
+	}
+}
+
 func (p *Plugin) bufferChunk(buffer *logBuffer, bs []byte) {
 	dropped := buffer.Push(bs)
 	if dropped > 0 {
@@ -882,6 +1327,71 @@ func (p *Plugin) maskEvent(ctx context.Context, txn storage.Transaction, event *
 	return nil
 }
 
+// dropEvent evaluates the drop decision with the event as input. The event
+// is dropped if the decision is true.
+func (p *Plugin) dropEvent(ctx context.Context, txn storage.Transaction, event *EventV1) (bool, error) {
+
+	drop, err := func() (rego.PreparedEvalQuery, error) {
+
+		p.dropMutex.Lock()
+		defer p.dropMutex.Unlock()
+
+		if p.drop == nil {
+
+			query := ast.NewBody(ast.NewExpr(ast.NewTerm(p.config.dropDecisionRef)))
+
+			r := rego.New(
+				rego.ParsedQuery(query),
+				rego.Compiler(p.manager.GetCompiler()),
+				rego.Store(p.manager.Store),
+				rego.Transaction(txn),
+				rego.Runtime(p.manager.Info),
+				rego.EnablePrintStatements(p.manager.EnablePrintStatements()),
+				rego.PrintHook(p.manager.PrintHook()),
+			)
+
+			pq, err := r.PrepareForEval(context.Background())
+			if err != nil {
+				return rego.PreparedEvalQuery{}, err
+			}
+
+			p.drop = &pq
+		}
+
+		return *p.drop, nil
+	}()
+
+	if err != nil {
+		return false, err
+	}
+
+	input, err := event.AST()
+	if err != nil {
+		return false, err
+	}
+
+	rs, err := drop.Eval(
+		ctx,
+		rego.EvalParsedInput(input),
+		rego.EvalTransaction(txn),
+	)
+
+	if err != nil {
+		return false, err
+	} else if len(rs) == 0 {
+		return false, nil
+	}
+
+	result, ok := rs[0].Expressions[0].Value.(bool)
+	return ok && result, nil
+}
+
+func (p *Plugin) incrCounter(name string) {
+	if p.metrics != nil {
+		p.metrics.Counter(name).Incr()
+	}
+}
+
 func uploadChunk(ctx context.Context, client rest.Client, uploadPath string, data []byte) error {
 
 	resp, err := client.
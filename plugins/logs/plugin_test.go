@@ -17,6 +17,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -88,6 +89,54 @@ func TestPluginCustomBackend(t *testing.T) {
 	}
 }
 
+func TestPluginDivergenceEvent(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := plugins.New(nil, "test-instance-id", inmem.New())
+
+	backend := &testPlugin{}
+	manager.Register("test_plugin", backend)
+
+	config, err := ParseConfig([]byte(`{"plugin": "test_plugin"}`), nil, []string{"test_plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+
+	var result interface{} = true
+	plugin.Log(ctx, &server.Info{
+		DecisionID: "2",
+		Path:       "authz/allow",
+		Results:    &result,
+		Divergence: &server.DivergenceInfo{
+			DecisionID: "1",
+			Bundle:     "candidate",
+			Revision:   "r2",
+			InputHash:  "abc",
+			Error:      fmt.Errorf("boom"),
+		},
+	})
+
+	if len(backend.events) != 1 {
+		t.Fatal("Unexpected events:", backend.events)
+	}
+
+	exp := DivergenceV1{DecisionID: "1", Bundle: "candidate", Revision: "r2", InputHash: "abc", Error: "boom"}
+	if d := backend.events[0].Divergence; d == nil || !reflect.DeepEqual(*d, exp) {
+		t.Fatalf("Expected divergence %+v but got %+v", exp, d)
+	}
+
+	value, err := backend.events[0].AST()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expAST := ast.MustParseTerm(`{"decision_id": "1", "bundle": "candidate", "revision": "r2", "input_hash": "abc", "error": "boom"}`)
+	if act := value.(ast.Object).Get(ast.StringTerm("divergence")); act == nil || !act.Equal(expAST) {
+		t.Fatalf("Expected divergence %v but got %v", expAST, act)
+	}
+}
+
 func TestPluginCustomBackendAndHTTPServiceAndConsole(t *testing.T) {
 
 	ctx := context.Background()
@@ -1799,6 +1848,390 @@ func newTestFixture(t *testing.T, opts ...testFixtureOptions) testFixture {
 
 }
 
+func TestPluginDropDecision(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+
+	err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		return store.UpsertPolicy(ctx, txn, "drop.rego", []byte(`package system.log
+
+drop {
+	input.path == "http/authz/allow"
+	input.result == true
+}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := plugins.New(nil, "test-instance-id", store)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := manager.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &testPlugin{}
+	manager.Register("test_plugin", backend)
+
+	config, err := ParseConfig([]byte(`{"plugin": "test_plugin"}`), nil, []string{"test_plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := metrics.New()
+	plugin := New(config, manager).WithMetrics(m)
+
+	for i, allowed := range []bool{true, false, true, true, false} {
+		var result interface{} = allowed
+		if err := plugin.Log(ctx, &server.Info{DecisionID: fmt.Sprint(i), Path: "http/authz/allow", Results: &result}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(backend.events) != 2 || backend.events[0].DecisionID != "1" || backend.events[1].DecisionID != "4" {
+		t.Fatalf("Expected only denials to be logged but got: %v", backend.events)
+	}
+
+	if exp, act := uint64(3), m.Counter(logDropPolicyCounterName).Value(); act != exp {
+		t.Fatalf("Expected %v events to be dropped but got %v", exp, act)
+	}
+
+	// Reconfigure with a drop decision that does not exist.
+	dropDecision := "/system/log/missing"
+	newConfig := &Config{Plugin: config.Plugin, DropDecision: &dropDecision}
+	trigger := plugins.DefaultTriggerMode
+	if err := newConfig.validateAndInjectDefaults(nil, []string{"test_plugin"}, &trigger); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.Stop(ctx)
+
+	plugin.Reconfigure(ctx, newConfig)
+
+	var result interface{} = true
+	if err := plugin.Log(ctx, &server.Info{DecisionID: "5", Path: "http/authz/allow", Results: &result}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backend.events) != 3 {
+		t.Fatalf("Expected event to be logged after reconfiguration but got: %v", backend.events)
+	}
+}
+
+func TestPluginDropDecisionErrorFailsOpen(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+
+	err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		return store.UpsertPolicy(ctx, txn, "drop.rego", []byte(`package system.log
+
+drop = true { input.path == "http/authz/allow" }
+drop = false { input.path == "http/authz/allow" }`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := plugins.New(nil, "test-instance-id", store)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := manager.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &testPlugin{}
+	manager.Register("test_plugin", backend)
+
+	config, err := ParseConfig([]byte(`{"plugin": "test_plugin"}`), nil, []string{"test_plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := metrics.New()
+	plugin := New(config, manager).WithMetrics(m)
+
+	var result interface{} = true
+	if err := plugin.Log(ctx, &server.Info{DecisionID: "1", Path: "http/authz/allow", Results: &result}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backend.events) != 1 || backend.events[0].DecisionID != "1" {
+		t.Fatalf("Expected event to be logged despite drop decision error but got: %v", backend.events)
+	}
+
+	if exp, act := uint64(1), m.Counter(logDropErrorCounterName).Value(); act != exp {
+		t.Fatalf("Expected %v drop errors but got %v", exp, act)
+	}
+
+	if act := m.Counter(logDropPolicyCounterName).Value(); act != uint64(0) {
+		t.Fatalf("Expected no events to be dropped but got %v", act)
+	}
+}
+
+func TestPluginSampling(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := plugins.New(nil, "test-instance-id", inmem.New())
+
+	backend := &testPlugin{}
+	manager.Register("test_plugin", backend)
+
+	config, err := ParseConfig([]byte(`{
+		"plugin": "test_plugin",
+		"sampling": [
+			{"path": "http/authz/*", "result": true, "rate": 0.1},
+			{"path": "http/**", "rate": 0}
+		]
+	}`), nil, []string{"test_plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := metrics.New()
+	plugin := New(config, manager).WithMetrics(m)
+
+	log := func(id, path string, result interface{}) {
+		if err := plugin.Log(ctx, &server.Info{DecisionID: id, Path: path, Results: &result}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n := 1000
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("decision-%d", i)
+		log(id, "http/authz/allow", true)
+		log(id, "http/authz/allow", false)
+		log(id, "http/authz/nested/allow", true)
+		log(id, "other/allow", true)
+	}
+
+	counts := map[string]int{}
+	for _, e := range backend.events {
+		counts[fmt.Sprintf("%v:%v", e.Path, *e.Result)]++
+	}
+
+	if counts["other/allow:true"] != n {
+		t.Fatalf("Expected all events without matching rule to be logged but got %v", counts)
+	}
+
+	if counts["http/authz/allow:false"] != 0 || counts["http/authz/nested/allow:true"] != 0 {
+		t.Fatalf("Expected events with zero sampling rate to be dropped but got %v", counts)
+	}
+
+	sampled := counts["http/authz/allow:true"]
+	if sampled < n/20 || sampled > n/5 {
+		t.Fatalf("Expected about %d sampled events but got %d", n/10, sampled)
+	}
+
+	if act := m.Counter(logSampledCounterName).Value(); act != uint64(sampled) {
+		t.Fatalf("Expected sampled counter to be %d but got %v", sampled, act)
+	}
+
+	if exp, act := uint64(3*n-sampled), m.Counter(logDropSamplingCounterName).Value(); act != exp {
+		t.Fatalf("Expected dropped counter to be %d but got %v", exp, act)
+	}
+
+	// Sampling is deterministic for a decision ID.
+	before := len(backend.events)
+	for i := 0; i < n; i++ {
+		log(fmt.Sprintf("decision-%d", i), "http/authz/allow", true)
+	}
+
+	if act := len(backend.events) - before; act != sampled {
+		t.Fatalf("Expected the same %d events to be sampled but got %d", sampled, act)
+	}
+}
+
+func TestPluginPersist(t *testing.T) {
+	ctx := context.Background()
+
+	fixture := newTestFixture(t, testFixtureOptions{
+		ReportingUploadSizeLimitBytes: 300,
+		ExtraConfig: map[string]interface{}{
+			"reporting": map[string]interface{}{
+				"persist": true,
+			},
+		},
+		ExtraManagerConfig: map[string]interface{}{
+			"persistence_directory": t.TempDir(),
+		},
+	})
+	defer fixture.server.stop()
+
+	fixture.server.ch = make(chan []EventV1, 10)
+	tr := plugins.TriggerManual
+	fixture.plugin.config.Reporting.Trigger = &tr
+
+	if err := fixture.plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var input interface{} = map[string]interface{}{"method": "GET"}
+	var result interface{} = false
+
+	for i := 0; i < 5; i++ {
+		if err := fixture.plugin.Log(ctx, logServerInfo(fmt.Sprint(i), input, result)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fixture.plugin.buffer.Len() != 0 {
+		t.Fatal("Expected in-memory buffer to be empty")
+	}
+
+	fixture.server.expCode = 500
+	if _, err := fixture.plugin.oneShot(ctx); err == nil {
+		t.Fatal("Expected error")
+	}
+	<-fixture.server.ch
+
+	// Restart the plugin. The decisions that were not uploaded are recovered.
+	fixture.plugin.Stop(ctx)
+
+	config := fixture.plugin.config
+	plugin := New(&config, fixture.manager)
+
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.Stop(ctx)
+
+	if n, _, _, err := plugin.disk.Stats(); err != nil || n != 5 {
+		t.Fatalf("Expected 5 decisions to be recovered but got %v (err: %v)", n, err)
+	}
+
+	fixture.server.expCode = 200
+	if ok, err := plugin.oneShot(ctx); !ok || err != nil {
+		t.Fatalf("Expected upload but got %v (err: %v)", ok, err)
+	}
+
+	var ids []string
+	for len(fixture.server.ch) > 0 {
+		for _, event := range <-fixture.server.ch {
+			ids = append(ids, event.DecisionID)
+		}
+	}
+
+	if !reflect.DeepEqual(ids, []string{"0", "1", "2", "3", "4"}) {
+		t.Fatalf("Expected all decisions to be uploaded in order but got: %v", ids)
+	}
+
+	if n, usage, _, err := plugin.disk.Stats(); err != nil || n != 0 || usage != 0 {
+		t.Fatalf("Expected buffer to be empty but got %v decisions, %v bytes (err: %v)", n, usage, err)
+	}
+
+	if ok, err := plugin.oneShot(ctx); ok || err != nil {
+		t.Fatalf("Unexpected error or upload, err: %v", err)
+	}
+}
+
+func TestPluginPersistDropsOversizedDecisions(t *testing.T) {
+	ctx := context.Background()
+
+	fixture := newTestFixture(t, testFixtureOptions{
+		ReportingUploadSizeLimitBytes: 300,
+		ExtraConfig: map[string]interface{}{
+			"reporting": map[string]interface{}{
+				"persist": true,
+			},
+		},
+		ExtraManagerConfig: map[string]interface{}{
+			"persistence_directory": t.TempDir(),
+		},
+	})
+	defer fixture.server.stop()
+
+	fixture.server.ch = make(chan []EventV1, 10)
+	tr := plugins.TriggerManual
+	fixture.plugin.config.Reporting.Trigger = &tr
+
+	m := metrics.New()
+	fixture.plugin.WithMetrics(m)
+
+	if err := fixture.plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.plugin.Stop(ctx)
+
+	// Simulate decisions that were persisted with a larger upload size limit.
+	var input interface{} = map[string]interface{}{"method": strings.Repeat("x", 300)}
+	var result interface{} = false
+
+	for _, id := range []string{"big-1", "big-2"} {
+		bs, err := encodeEvent(EventV1{DecisionID: id, Input: &input, Result: &result})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fixture.plugin.disk.Push(bs, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fixture.plugin.Log(ctx, logServerInfo("small", map[string]interface{}{"method": "GET"}, result)); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := fixture.plugin.oneShot(ctx); !ok || err != nil {
+		t.Fatalf("Expected upload but got %v (err: %v)", ok, err)
+	}
+
+	events := <-fixture.server.ch
+	if len(events) != 1 || events[0].DecisionID != "small" {
+		t.Fatalf("Expected only the small decision to be uploaded but got: %v", events)
+	}
+
+	if exp, act := uint64(2), m.Counter(logDropOversizedCounterName).Value(); act != exp {
+		t.Fatalf("Expected %v oversized decisions to be dropped but got %v", exp, act)
+	}
+
+	if n, _, _, err := fixture.plugin.disk.Stats(); err != nil || n != 0 {
+		t.Fatalf("Expected buffer to be empty but got %v decisions (err: %v)", n, err)
+	}
+}
+
+func TestParseConfigPersist(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		config  string
+		wantErr string
+	}{
+		{
+			note:   "valid",
+			config: `{"service": "svc", "reporting": {"persist": true, "persist_size_limit_bytes": 1024}}`,
+		},
+		{
+			note:    "no service",
+			config:  `{"console": true, "reporting": {"persist": true}}`,
+			wantErr: "invalid decision_log config, 'persist' requires 'service'",
+		},
+		{
+			note:    "buffer size limit",
+			config:  `{"service": "svc", "reporting": {"persist": true, "buffer_size_limit_bytes": 1024}}`,
+			wantErr: "invalid decision_log config, specify either 'buffer_size_limit_bytes' or 'persist_size_limit_bytes'",
+		},
+		{
+			note:    "size limit without persist",
+			config:  `{"service": "svc", "reporting": {"persist_size_limit_bytes": 1024}}`,
+			wantErr: "invalid decision_log config, 'persist_size_limit_bytes' requires 'persist'",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tc.config), []string{"svc"}, nil)
+			if tc.wantErr == "" && err != nil {
+				t.Fatal(err)
+			} else if tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+				t.Fatalf("Expected error %q but got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestParseConfigUseDefaultServiceNoConsole(t *testing.T) {
 	services := []string{
 		"s0",
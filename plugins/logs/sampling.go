@@ -0,0 +1,126 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/gobwas/glob"
+
+	"github.com/meta-quick/opax/ast"
+)
+
+// SamplingRule configures the fraction of the decisions that are logged.
+// A decision matches the rule if its path matches the path pattern and its
+// result is equal to the configured result. Omitted fields match any
+// decision.
+type SamplingRule struct {
+	Path   string       `json:"path,omitempty"`   // glob pattern matched against the decision path, e.g., "http/authz/*"
+	Result *interface{} `json:"result,omitempty"` // result that matching decisions must have
+	Rate   *float64     `json:"rate"`             // fraction of the matching decisions to log, between 0 and 1
+
+	pathGlob glob.Glob
+	result   ast.Value
+}
+
+func (r *SamplingRule) validateAndInjectDefaults() error {
+
+	if r.Rate == nil {
+		return fmt.Errorf("missing 'rate'")
+	}
+
+	if *r.Rate < 0 || *r.Rate > 1 {
+		return fmt.Errorf("'rate' must be between 0 and 1")
+	}
+
+	if r.Path != "" {
+		var err error
+		r.pathGlob, err = glob.Compile(strings.Trim(r.Path, "/"), '/')
+		if err != nil {
+			return fmt.Errorf("invalid 'path': %w", err)
+		}
+	}
+
+	if r.Result != nil {
+		var err error
+		r.result, err = ast.InterfaceToValue(*r.Result)
+		if err != nil {
+			return fmt.Errorf("invalid 'result': %w", err)
+		}
+	}
+
+	return nil
+}
+
+// matches returns true if the event matches the rule. The result of the event
+// is only converted if the rule requires it. The converted result is cached
+// in result for the remaining rules.
+func (r *SamplingRule) matches(event *EventV1, result *ast.Value) (bool, error) {
+
+	if r.pathGlob != nil && !r.pathGlob.Match(strings.Trim(event.Path, "/")) {
+		return false, nil
+	}
+
+	if r.result == nil {
+		return true, nil
+	}
+
+	if event.Result == nil {
+		return false, nil
+	}
+
+	if *result == nil {
+		v, err := roundtripJSONToAST(event.Result)
+		if err != nil {
+			return false, err
+		}
+		*result = v
+	}
+
+	return r.result.Compare(*result) == 0, nil
+}
+
+// samplingDecision is the outcome of sampling a decision log event.
+type samplingDecision int
+
+const (
+	samplingNoMatch samplingDecision = iota // no rule matched, the event is logged
+	samplingKeep                            // a rule matched and the event was sampled
+	samplingDrop                            // a rule matched and the event was not sampled
+)
+
+// sample applies the first rule that matches the event. Events are sampled
+// based on a hash of the decision ID so that the outcome for a decision is
+// the same on every OPA that logs it.
+func sample(rules []SamplingRule, event *EventV1) (samplingDecision, error) {
+
+	var result ast.Value
+
+	for i := range rules {
+		ok, err := rules[i].matches(event, &result)
+		if err != nil {
+			return samplingNoMatch, err
+		} else if !ok {
+			continue
+		}
+
+		if sampleHash(event.DecisionID) < *rules[i].Rate {
+			return samplingKeep, nil
+		}
+
+		return samplingDrop, nil
+	}
+
+	return samplingNoMatch, nil
+}
+
+// sampleHash maps the decision ID to a number in [0, 1).
+func sampleHash(decisionID string) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(decisionID))
+	return float64(h.Sum64()>>11) / float64(uint64(1)<<53)
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigSampling(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		config  string
+		wantErr string
+	}{
+		{
+			note:   "valid",
+			config: `{"console": true, "sampling": [{"path": "/http/authz/*/", "result": {"allowed": true}, "rate": 0.5}, {"rate": 1}]}`,
+		},
+		{
+			note:    "missing rate",
+			config:  `{"console": true, "sampling": [{"path": "x"}]}`,
+			wantErr: "invalid sampling rule 0 in decision_logs: missing 'rate'",
+		},
+		{
+			note:    "rate out of range",
+			config:  `{"console": true, "sampling": [{"rate": 1}, {"rate": 1.5}]}`,
+			wantErr: "invalid sampling rule 1 in decision_logs: 'rate' must be between 0 and 1",
+		},
+		{
+			note:    "invalid path",
+			config:  `{"console": true, "sampling": [{"path": "[a", "rate": 1}]}`,
+			wantErr: "invalid sampling rule 0 in decision_logs: invalid 'path'",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tc.config), nil, nil)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Expected error %q but got: %v", tc.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if *config.DropDecision != defaultDropDecisionPath || config.dropDecisionRef.String() != "data.system.log.drop" {
+				t.Fatalf("Expected default drop decision but got %v", *config.DropDecision)
+			}
+		})
+	}
+}
+
+func TestSample(t *testing.T) {
+
+	config, err := ParseConfig([]byte(`{"console": true, "sampling": [
+		{"path": "/http/authz/*/", "result": {"allowed": true, "status": 200}, "rate": 0},
+		{"result": "x", "rate": 1},
+		{"path": "http/**", "rate": 1}
+	]}`), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var allowed interface{} = map[string]interface{}{"status": 200, "allowed": true}
+	var denied interface{} = map[string]interface{}{"status": 403, "allowed": false}
+	var x interface{} = "x"
+
+	tests := []struct {
+		note   string
+		event  EventV1
+		result samplingDecision
+	}{
+		{
+			note:   "path and result",
+			event:  EventV1{Path: "http/authz/allow", Result: &allowed},
+			result: samplingDrop,
+		},
+		{
+			note:   "path mismatch",
+			event:  EventV1{Path: "http/authz/a/allow", Result: &x},
+			result: samplingKeep,
+		},
+		{
+			note:   "result mismatch",
+			event:  EventV1{Path: "http/authz/allow", Result: &denied},
+			result: samplingKeep,
+		},
+		{
+			note:   "no result",
+			event:  EventV1{Path: "http/authz/allow"},
+			result: samplingKeep,
+		},
+		{
+			note:   "no match",
+			event:  EventV1{Path: "other", Result: &allowed},
+			result: samplingNoMatch,
+		},
+		{
+			note:   "query",
+			event:  EventV1{Query: "data.http.authz.allow", Result: &allowed},
+			result: samplingNoMatch,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			result, err := sample(config.Sampling, &tc.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tc.result {
+				t.Fatalf("Expected %v but got %v", tc.result, result)
+			}
+		})
+	}
+}
+
+func TestSampleHash(t *testing.T) {
+
+	n := 10000
+	buckets := make([]int, 10)
+
+	for i := 0; i < n; i++ {
+		h := sampleHash(fmt.Sprintf("2b6ec3d5-4d4c-44d6-9e5b-%012d", i))
+		if h < 0 || h >= 1 {
+			t.Fatalf("Expected hash in [0, 1) but got %v", h)
+		}
+		buckets[int(h*10)]++
+	}
+
+	for i, count := range buckets {
+		if count < n/20 || count > n/5 {
+			t.Fatalf("Expected uniform distribution but bucket %d has %d of %d values: %v", i, count, n, buckets)
+		}
+	}
+
+	if sampleHash("abc") != sampleHash("abc") {
+		t.Fatal("Expected hash to be deterministic")
+	}
+}
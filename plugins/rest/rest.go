@@ -27,6 +27,10 @@ const (
 
 	grantTypeClientCredentials = "client_credentials"
 	grantTypeJwtBearer         = "jwt_bearer"
+
+	// ServiceTypeOCI identifies services that implement the OCI distribution
+	// specification (i.e., container registries.)
+	ServiceTypeOCI = "oci"
 )
 
 // An HTTPAuthPlugin represents a mechanism to construct and configure HTTP authentication for a REST service
@@ -40,6 +44,7 @@ type HTTPAuthPlugin interface {
 type Config struct {
 	Name                         string            `json:"name"`
 	URL                          string            `json:"url"`
+	Type                         string            `json:"type,omitempty"`
 	Headers                      map[string]string `json:"headers"`
 	AllowInsecureTLS             bool              `json:"allow_insecure_tls,omitempty"`
 	ResponseHeaderTimeoutSeconds *int64            `json:"response_header_timeout_seconds,omitempty"`
@@ -161,6 +166,12 @@ func New(config []byte, keys map[string]*keys.Config, opts ...func(*Client)) (Cl
 
 	parsedConfig.URL = strings.TrimRight(parsedConfig.URL, "/")
 
+	switch parsedConfig.Type {
+	case "", ServiceTypeOCI:
+	default:
+		return Client{}, fmt.Errorf("unsupported service type %q", parsedConfig.Type)
+	}
+
 	if parsedConfig.ResponseHeaderTimeoutSeconds == nil {
 		timeout := new(int64)
 		*timeout = defaultResponseHeaderTimeoutSeconds
@@ -224,6 +235,14 @@ func (c Client) WithHeader(k, v string) Client {
 	return c
 }
 
+// WithURL returns a shallow copy of the client that sends requests to the
+// given base URL instead of the configured one. This is used to contact
+// endpoints (e.g., token servers) that the service redirects clients to.
+func (c Client) WithURL(url string) Client {
+	c.config.URL = strings.TrimRight(url, "/")
+	return c
+}
+
 // WithJSON returns a shallow copy of the client with the JSON value set as the
 // message body to include the requests. This function sets the Content-Type
 // header.
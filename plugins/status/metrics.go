@@ -0,0 +1,180 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/plugins/bundle"
+)
+
+var (
+	bundleInfoDesc = prometheus.NewDesc(
+		"bundle_info",
+		"Revision of the active bundle.",
+		[]string{"name", "revision"}, nil)
+	bundleActivationsDesc = prometheus.NewDesc(
+		"bundle_activations_total",
+		"Number of bundle activations, by result.",
+		[]string{"name", "result"}, nil)
+	bundleFailedDesc = prometheus.NewDesc(
+		"bundle_failed",
+		"Whether the last bundle download or activation failed.",
+		[]string{"name"}, nil)
+	bundleLastRequestDesc = prometheus.NewDesc(
+		"bundle_last_request_timestamp_seconds",
+		"Time of the last bundle request.",
+		[]string{"name"}, nil)
+	bundleLastDownloadDesc = prometheus.NewDesc(
+		"bundle_last_successful_download_timestamp_seconds",
+		"Time of the last successful bundle download.",
+		[]string{"name"}, nil)
+	bundleLastActivationDesc = prometheus.NewDesc(
+		"bundle_last_successful_activation_timestamp_seconds",
+		"Time of the last successful bundle activation.",
+		[]string{"name"}, nil)
+	pluginStatusDesc = prometheus.NewDesc(
+		"plugin_status",
+		"State of the plugin.",
+		[]string{"name", "state"}, nil)
+)
+
+// Results of bundle activations in the bundle_activations_total metric.
+const (
+	activationSuccess = "success"
+	activationFailure = "failure"
+)
+
+// statusCollector exports the status reported by the plugin as Prometheus
+// metrics. The statuses are updated by the plugin's loop so that scrapes
+// never wait for status updates to be sent. No metrics are collected unless
+// enabled in the plugin's config.
+type statusCollector struct {
+	mtx         sync.Mutex
+	enabled     bool
+	bundles     map[string]bundle.Status
+	plugins     map[string]plugins.Status
+	activations map[string]map[string]float64
+}
+
+func newStatusCollector() *statusCollector {
+	return &statusCollector{
+		bundles:     map[string]bundle.Status{},
+		plugins:     map[string]plugins.Status{},
+		activations: map[string]map[string]float64{},
+	}
+}
+
+func (c *statusCollector) setEnabled(enabled bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.enabled = enabled
+}
+
+// updateBundles records the bundle statuses. Activations are counted by
+// comparing the statuses with the previous ones: a new activation time is a
+// successful activation and an error reported for a new request is a failure.
+func (c *statusCollector) updateBundles(statuses map[string]*bundle.Status) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	bundles := make(map[string]bundle.Status, len(statuses))
+
+	for name, status := range statuses {
+		prev, ok := c.bundles[name]
+
+		if !status.LastSuccessfulActivation.IsZero() && (!ok || !status.LastSuccessfulActivation.Equal(prev.LastSuccessfulActivation)) {
+			c.countActivation(name, activationSuccess)
+		}
+
+		if status.Code != "" && (!ok || !status.LastRequest.Equal(prev.LastRequest)) {
+			c.countActivation(name, activationFailure)
+		}
+
+		bundles[name] = *status
+	}
+
+	for name := range c.activations {
+		if _, ok := bundles[name]; !ok {
+			delete(c.activations, name)
+		}
+	}
+
+	c.bundles = bundles
+}
+
+func (c *statusCollector) countActivation(name, result string) {
+	counts, ok := c.activations[name]
+	if !ok {
+		counts = map[string]float64{}
+		c.activations[name] = counts
+	}
+	counts[result]++
+}
+
+func (c *statusCollector) updatePlugins(statuses map[string]*plugins.Status) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.plugins = make(map[string]plugins.Status, len(statuses))
+	for name, status := range statuses {
+		if status != nil {
+			c.plugins[name] = *status
+		}
+	}
+}
+
+func (*statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bundleInfoDesc
+	ch <- bundleActivationsDesc
+	ch <- bundleFailedDesc
+	ch <- bundleLastRequestDesc
+	ch <- bundleLastDownloadDesc
+	ch <- bundleLastActivationDesc
+	ch <- pluginStatusDesc
+}
+
+func (c *statusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.enabled {
+		return
+	}
+
+	for name, status := range c.bundles {
+		if status.ActiveRevision != "" {
+			ch <- prometheus.MustNewConstMetric(bundleInfoDesc, prometheus.GaugeValue, 1, name, status.ActiveRevision)
+		}
+
+		for _, result := range []string{activationSuccess, activationFailure} {
+			ch <- prometheus.MustNewConstMetric(bundleActivationsDesc, prometheus.CounterValue, c.activations[name][result], name, result)
+		}
+
+		var failed float64
+		if status.Code != "" {
+			failed = 1
+		}
+		ch <- prometheus.MustNewConstMetric(bundleFailedDesc, prometheus.GaugeValue, failed, name)
+
+		for desc, t := range map[*prometheus.Desc]time.Time{
+			bundleLastRequestDesc:    status.LastRequest,
+			bundleLastDownloadDesc:   status.LastSuccessfulDownload,
+			bundleLastActivationDesc: status.LastSuccessfulActivation,
+		} {
+			if !t.IsZero() {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(t.UnixNano())/1e9, name)
+			}
+		}
+	}
+
+	for name, status := range c.plugins {
+		ch <- prometheus.MustNewConstMetric(pluginStatusDesc, prometheus.GaugeValue, 1, name, string(status.State))
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package status
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/plugins/bundle"
+)
+
+func TestParseConfigPrometheus(t *testing.T) {
+
+	config, err := ParseConfig([]byte(`{"prometheus": true}`), []string{"s0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config == nil || !config.Prometheus || config.Service != "" {
+		t.Fatalf("Expected Prometheus metrics without service but got %+v", config)
+	}
+
+	config, err = ParseConfig([]byte(`{"prometheus": true}`), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if config == nil {
+		t.Fatal("Expected config")
+	}
+}
+
+func TestStatusCollector(t *testing.T) {
+
+	collector := newStatusCollector()
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal(err)
+	}
+
+	t1 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+
+	ok := &bundle.Status{
+		Name:                     "authz",
+		ActiveRevision:           "r1",
+		LastRequest:              t1,
+		LastSuccessfulRequest:    t1,
+		LastSuccessfulDownload:   t1,
+		LastSuccessfulActivation: t1,
+	}
+
+	failed := *ok
+	failed.LastRequest = t2
+	failed.Code = "bundle_error"
+
+	collector.updateBundles(map[string]*bundle.Status{"authz": ok})
+	collector.updatePlugins(map[string]*plugins.Status{"bundle": {State: plugins.StateOK}})
+
+	if values := gatherValues(t, registry); len(values) != 0 {
+		t.Fatalf("Expected no metrics unless enabled but got %v", values)
+	}
+
+	collector.setEnabled(true)
+
+	collector.updateBundles(map[string]*bundle.Status{"authz": &failed})
+
+	// Statuses that have been seen before are not counted again.
+	collector.updateBundles(map[string]*bundle.Status{"authz": &failed})
+
+	exp := map[string]float64{
+		`bundle_info{name="authz",revision="r1"}`:                           1,
+		`bundle_activations_total{name="authz",result="success"}`:           1,
+		`bundle_activations_total{name="authz",result="failure"}`:           1,
+		`bundle_failed{name="authz"}`:                                       1,
+		`bundle_last_request_timestamp_seconds{name="authz"}`:               float64(t2.Unix()),
+		`bundle_last_successful_download_timestamp_seconds{name="authz"}`:   float64(t1.Unix()),
+		`bundle_last_successful_activation_timestamp_seconds{name="authz"}`: float64(t1.Unix()),
+		`plugin_status{name="bundle",state="OK"}`:                           1,
+	}
+
+	if values := gatherValues(t, registry); !reflect.DeepEqual(values, exp) {
+		t.Fatalf("Expected metrics:\n%v\nbut got:\n%v", exp, values)
+	}
+}
+
+func gatherValues(t *testing.T, g prometheus.Gatherer) map[string]float64 {
+	t.Helper()
+
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, fmt.Sprintf("%v=%q", l.GetName(), l.GetValue()))
+			}
+			sort.Strings(labels)
+
+			key := fmt.Sprintf("%v{%v}", f.GetName(), strings.Join(labels, ","))
+
+			if c := m.GetCounter(); c != nil {
+				values[key] = c.GetValue()
+			} else {
+				values[key] = m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	return values
+}
@@ -14,10 +14,12 @@ import (
 
 	"github.com/pkg/errors"
 
+	iprom "github.com/meta-quick/opax/internal/prometheus"
 	"github.com/meta-quick/opax/logging"
 	"github.com/meta-quick/opax/metrics"
 	"github.com/meta-quick/opax/plugins"
 	"github.com/meta-quick/opax/plugins/bundle"
+	"github.com/meta-quick/opax/plugins/datasync"
 	"github.com/meta-quick/opax/util"
 )
 
@@ -31,12 +33,13 @@ type Logger interface {
 // UpdateRequestV1 represents the status update message that OPA sends to
 // remote HTTP endpoints.
 type UpdateRequestV1 struct {
-	Labels    map[string]string          `json:"labels"`
-	Bundle    *bundle.Status             `json:"bundle,omitempty"` // Deprecated: Use bulk `bundles` status updates instead
-	Bundles   map[string]*bundle.Status  `json:"bundles,omitempty"`
-	Discovery *bundle.Status             `json:"discovery,omitempty"`
-	Metrics   map[string]interface{}     `json:"metrics,omitempty"`
-	Plugins   map[string]*plugins.Status `json:"plugins,omitempty"`
+	Labels    map[string]string           `json:"labels"`
+	Bundle    *bundle.Status              `json:"bundle,omitempty"` // Deprecated: Use bulk `bundles` status updates instead
+	Bundles   map[string]*bundle.Status   `json:"bundles,omitempty"`
+	Discovery *bundle.Status              `json:"discovery,omitempty"`
+	DataSync  map[string]*datasync.Status `json:"data_sync,omitempty"`
+	Metrics   map[string]interface{}      `json:"metrics,omitempty"`
+	Plugins   map[string]*plugins.Status  `json:"plugins,omitempty"`
 }
 
 // Plugin implements status reporting. Updates can be triggered by the caller.
@@ -49,6 +52,8 @@ type Plugin struct {
 	lastBundleStatuses map[string]*bundle.Status
 	discoCh            chan bundle.Status
 	lastDiscoStatus    *bundle.Status
+	dataSyncCh         chan map[string]*datasync.Status
+	lastDataSyncStatus map[string]*datasync.Status
 	pluginStatusCh     chan map[string]*plugins.Status
 	lastPluginStatuses map[string]*plugins.Status
 	queryCh            chan chan *UpdateRequestV1
@@ -57,6 +62,7 @@ type Plugin struct {
 	metrics            metrics.Metrics
 	logger             logging.Logger
 	trigger            chan trigger
+	collector          *statusCollector
 }
 
 // Config contains configuration for the plugin.
@@ -65,7 +71,8 @@ type Config struct {
 	Service       string               `json:"service"`
 	PartitionName string               `json:"partition_name,omitempty"`
 	ConsoleLogs   bool                 `json:"console"`
-	Trigger       *plugins.TriggerMode `json:"trigger,omitempty"` // trigger mode
+	Prometheus    bool                 `json:"prometheus,omitempty"` // export status as Prometheus metrics
+	Trigger       *plugins.TriggerMode `json:"trigger,omitempty"`    // trigger mode
 }
 
 type trigger struct {
@@ -86,11 +93,11 @@ func (c *Config) validateAndInjectDefaults(services []string, pluginsList []stri
 		if !found {
 			return fmt.Errorf("invalid plugin name %q in status", *c.Plugin)
 		}
-	} else if c.Service == "" && len(services) != 0 && !c.ConsoleLogs {
+	} else if c.Service == "" && len(services) != 0 && !c.ConsoleLogs && !c.Prometheus {
 		// For backwards compatibility allow defaulting to the first
-		// service listed, but only if console logging is disabled. If enabled
-		// we can't tell if the deployer wanted to use only console logs or
-		// both console logs and the default service option.
+		// service listed, but only if console logging and Prometheus metrics
+		// are disabled. If enabled we can't tell if the deployer wanted to use
+		// only console logs or metrics or also the default service option.
 		c.Service = services[0]
 	} else if c.Service != "" {
 		found := false
@@ -171,7 +178,7 @@ func (b *ConfigBuilder) Parse() (*Config, error) {
 		return nil, err
 	}
 
-	if parsedConfig.Plugin == nil && parsedConfig.Service == "" && len(b.services) == 0 && !parsedConfig.ConsoleLogs {
+	if parsedConfig.Plugin == nil && parsedConfig.Service == "" && len(b.services) == 0 && !parsedConfig.ConsoleLogs && !parsedConfig.Prometheus {
 		// Nothing to validate or inject
 		return nil, nil
 	}
@@ -191,22 +198,33 @@ func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
 		bundleCh:       make(chan bundle.Status),
 		bulkBundleCh:   make(chan map[string]*bundle.Status),
 		discoCh:        make(chan bundle.Status),
+		dataSyncCh:     make(chan map[string]*datasync.Status),
 		stop:           make(chan chan struct{}),
 		reconfig:       make(chan interface{}),
 		pluginStatusCh: make(chan map[string]*plugins.Status),
 		queryCh:        make(chan chan *UpdateRequestV1),
 		logger:         manager.Logger().WithFields(map[string]interface{}{"plugin": Name}),
 		trigger:        make(chan trigger),
+		collector:      newStatusCollector(),
 	}
 
+	p.collector.setEnabled(p.config.Prometheus)
+
 	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
 
 	return p
 }
 
-// WithMetrics sets the global metrics provider to be used by the plugin.
+// WithMetrics sets the global metrics provider to be used by the plugin. If
+// the provider exports Prometheus collectors, the status is exported too
+// when enabled in the config.
 func (p *Plugin) WithMetrics(m metrics.Metrics) *Plugin {
 	p.metrics = m
+
+	if err := iprom.Register(m, p.collector); err != nil {
+		p.logger.Error("Failed to register status metrics: %v.", err)
+	}
+
 	return p
 }
 
@@ -264,6 +282,12 @@ func (p *Plugin) UpdateDiscoveryStatus(status bundle.Status) {
 	p.discoCh <- status
 }
 
+// UpdateDataSyncStatus notifies the plugin that the status of the data
+// sources synchronized by the data sync plugin was updated.
+func (p *Plugin) UpdateDataSyncStatus(status map[string]*datasync.Status) {
+	p.dataSyncCh <- status
+}
+
 // UpdatePluginStatus notifies the plugin that a plugin status was updated.
 func (p *Plugin) UpdatePluginStatus(status map[string]*plugins.Status) {
 	p.pluginStatusCh <- status
@@ -305,6 +329,7 @@ func (p *Plugin) loop() {
 		select {
 		case statuses := <-p.pluginStatusCh:
 			p.lastPluginStatuses = statuses
+			p.collector.updatePlugins(statuses)
 			if *p.config.Trigger == plugins.TriggerPeriodic {
 				err := p.oneShot(ctx)
 				if err != nil {
@@ -316,6 +341,7 @@ func (p *Plugin) loop() {
 
 		case statuses := <-p.bulkBundleCh:
 			p.lastBundleStatuses = statuses
+			p.collector.updateBundles(statuses)
 			if *p.config.Trigger == plugins.TriggerPeriodic {
 				err := p.oneShot(ctx)
 				if err != nil {
@@ -327,6 +353,7 @@ func (p *Plugin) loop() {
 
 		case status := <-p.bundleCh:
 			p.lastBundleStatus = &status
+			p.collector.updateBundles(map[string]*bundle.Status{status.Name: &status})
 			err := p.oneShot(ctx)
 			if err != nil {
 				p.logger.Error("%v.", err)
@@ -343,6 +370,16 @@ func (p *Plugin) loop() {
 					p.logger.Info("Status update sent successfully in response to discovery update.")
 				}
 			}
+		case statuses := <-p.dataSyncCh:
+			p.lastDataSyncStatus = statuses
+			if *p.config.Trigger == plugins.TriggerPeriodic {
+				err := p.oneShot(ctx)
+				if err != nil {
+					p.logger.Error("%v.", err)
+				} else {
+					p.logger.Info("Status update sent successfully in response to data sync update.")
+				}
+			}
 		case newConfig := <-p.reconfig:
 			p.reconfigure(newConfig)
 		case respCh := <-p.queryCh:
@@ -420,6 +457,7 @@ func (p *Plugin) reconfigure(config interface{}) {
 
 	p.logger.Info("Status reporter configuration changed.")
 	p.config = *newConfig
+	p.collector.setEnabled(p.config.Prometheus)
 }
 
 func (p *Plugin) snapshot() *UpdateRequestV1 {
@@ -429,6 +467,7 @@ func (p *Plugin) snapshot() *UpdateRequestV1 {
 		Discovery: p.lastDiscoStatus,
 		Bundle:    p.lastBundleStatus,
 		Bundles:   p.lastBundleStatuses,
+		DataSync:  p.lastDataSyncStatus,
 		Plugins:   p.lastPluginStatuses,
 	}
 
@@ -18,6 +18,7 @@ import (
 	"github.com/meta-quick/opax/metrics"
 	"github.com/meta-quick/opax/plugins"
 	"github.com/meta-quick/opax/plugins/bundle"
+	"github.com/meta-quick/opax/plugins/datasync"
 	"github.com/meta-quick/opax/storage/inmem"
 	"github.com/meta-quick/opax/util"
 	"github.com/meta-quick/opax/version"
@@ -462,6 +463,55 @@ func TestPluginStartDiscovery(t *testing.T) {
 	}
 }
 
+func TestPluginStartDataSync(t *testing.T) {
+
+	fixture := newTestFixture(t, nil)
+	fixture.server.ch = make(chan UpdateRequestV1)
+	defer fixture.server.stop()
+
+	ctx := context.Background()
+
+	err := fixture.plugin.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.plugin.Stop(ctx)
+
+	// Ignore the plugin updating its status (tested elsewhere)
+	<-fixture.server.ch
+
+	tSync, _ := time.Parse(time.RFC3339Nano, "2018-01-01T00:00:00.0000000Z")
+
+	status := map[string]*datasync.Status{
+		"roles": {
+			Name:                  "roles",
+			Path:                  "/roles",
+			LastSuccessfulRequest: tSync,
+			LastSuccessfulUpdate:  tSync,
+			Stale:                 true,
+		},
+	}
+
+	fixture.plugin.UpdateDataSyncStatus(status)
+	result := <-fixture.server.ch
+
+	exp := UpdateRequestV1{
+		Labels: map[string]string{
+			"id":      "test-instance-id",
+			"app":     "example-app",
+			"version": version.Version,
+		},
+		DataSync: status,
+		Plugins: map[string]*plugins.Status{
+			"status": {State: plugins.StateOK},
+		},
+	}
+
+	if !reflect.DeepEqual(result, exp) {
+		t.Fatalf("Expected: %+v but got: %+v", exp, result)
+	}
+}
+
 func TestPluginBadAuth(t *testing.T) {
 	fixture := newTestFixture(t, nil)
 	ctx := context.Background()
@@ -119,6 +119,7 @@ type EvalContext struct {
 	sortSets               bool
 	printHook              print.Hook
 	capabilities           *ast.Capabilities
+	budget                 *topdown.Budget
 }
 
 // EvalOption defines a function to set an option on an EvalConfig
@@ -253,6 +254,14 @@ func EvalInterQueryBuiltinCache(c cache.InterQueryCache) EvalOption {
 	}
 }
 
+// EvalBudget sets the limits on the resources that the evaluation may consume.
+// It overrides the budget set with the Budget option.
+func EvalBudget(b *topdown.Budget) EvalOption {
+	return func(e *EvalContext) {
+		e.budget = b
+	}
+}
+
 // EvalResolver sets a Resolver for a specified ref path for this evaluation.
 func EvalResolver(ref ast.Ref, r resolver.Resolver) EvalOption {
 	return func(e *EvalContext) {
@@ -313,6 +322,7 @@ func (pq preparedQuery) newEvalContext(ctx context.Context, options []EvalOption
 		resolvers:        pq.r.resolvers,
 		printHook:        pq.r.printHook,
 		capabilities:     pq.r.capabilities,
+		budget:           pq.r.budget,
 	}
 
 	for _, o := range options {
@@ -509,6 +519,8 @@ type Rego struct {
 	skipBundleVerification bool
 	interQueryBuiltinCache cache.InterQueryCache
 	strictBuiltinErrors    bool
+	budget                 *topdown.Budget
+	parallelism            int
 	resolvers              []refResolver
 	schemaSet              *ast.SchemaSet
 	target                 string // target type (wasm, rego, etc.)
@@ -1022,6 +1034,25 @@ func StrictBuiltinErrors(yes bool) func(r *Rego) {
 	}
 }
 
+// Budget sets the limits on the resources that a single evaluation may
+// consume. Evaluations that exceed the budget fail with a topdown.Error that
+// has the topdown.BudgetErr code. Budgets are not enforced for Wasm targets.
+func Budget(b *topdown.Budget) func(r *Rego) {
+	return func(r *Rego) {
+		r.budget = b
+	}
+}
+
+// Parallelism enables parallel evaluation of the rules that define the same
+// partial set or partial object using up to n goroutines per evaluation. See
+// topdown.Query.WithParallelism for details. Parallel evaluation is not
+// supported for Wasm targets.
+func Parallelism(n int) func(r *Rego) {
+	return func(r *Rego) {
+		r.parallelism = n
+	}
+}
+
 // Resolver sets a Resolver for a specified ref path.
 func Resolver(ref ast.Ref, r resolver.Resolver) func(r *Rego) {
 	return func(rego *Rego) {
@@ -1907,6 +1938,8 @@ func (r *Rego) eval(ctx context.Context, ectx *EvalContext) (ResultSet, error) {
 		WithEarlyExit(ectx.earlyExit).
 		WithInterQueryBuiltinCache(ectx.interQueryBuiltinCache).
 		WithStrictBuiltinErrors(r.strictBuiltinErrors).
+		WithBudget(ectx.budget).
+		WithParallelism(r.parallelism).
 		WithSeed(ectx.seed).
 		WithPrintHook(ectx.printHook).
 		WithDistributedTracingOpts(r.distributedTacingOpts)
@@ -2181,6 +2214,7 @@ func (r *Rego) partial(ctx context.Context, ectx *EvalContext) (*PartialQueries,
 		WithShallowInlining(r.shallowInlining).
 		WithInterQueryBuiltinCache(ectx.interQueryBuiltinCache).
 		WithStrictBuiltinErrors(r.strictBuiltinErrors).
+		WithBudget(ectx.budget).
 		WithSeed(ectx.seed).
 		WithPrintHook(ectx.printHook)
 
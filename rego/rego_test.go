@@ -1974,6 +1974,63 @@ func TestStrictBuiltinErrors(t *testing.T) {
 	}
 }
 
+func TestBudget(t *testing.T) {
+	ctx := context.Background()
+	query := "x := numbers.range(1, 100); y := [z | z := x[_]]"
+
+	_, err := New(Query(query), Budget(&topdown.Budget{MaxSteps: 20})).Eval(ctx)
+	if !topdown.IsBudgetExceeded(err) {
+		t.Fatal("expected budget error but got:", err)
+	}
+
+	// Budgets set at evaluation time override the budget set on the Rego object.
+	pq, err := New(Query(query), Budget(&topdown.Budget{MaxSteps: 20})).PrepareForEval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := metrics.New()
+	_, err = pq.Eval(ctx, EvalBudget(&topdown.Budget{MaxSteps: 1000}), EvalMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Counter("eval_budget_steps").Value().(uint64) == 0 {
+		t.Fatal("expected steps to be reported in metrics")
+	}
+
+	_, err = pq.Eval(ctx, EvalBudget(&topdown.Budget{MaxResultBytes: 10}))
+	if !topdown.IsBudgetExceeded(err) {
+		t.Fatal("expected budget error but got:", err)
+	}
+}
+
+func TestParallelism(t *testing.T) {
+	ctx := context.Background()
+	module := `package test
+		p[x] { x := numbers.range(1, 10)[_] }
+		p[x] { x := numbers.range(5, 15)[_] }
+		q[k] = v { v := numbers.range(1, 10)[k] }
+		q[k] = v { v := numbers.range(1, 10)[k] }`
+
+	var exp interface{}
+
+	for _, n := range []int{1, 4} {
+		rs, err := New(Query("data.test"), Module("test.rego", module), Parallelism(n)).Eval(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 1 {
+			t.Fatalf("expected one result but got: %v", rs)
+		}
+		if exp == nil {
+			exp = rs[0].Expressions[0].Value
+		} else if !reflect.DeepEqual(exp, rs[0].Expressions[0].Value) {
+			t.Fatalf("expected %v with parallelism %d but got %v", exp, n, rs[0].Expressions[0].Value)
+		}
+	}
+}
+
 func TestTimeSeedingOptions(t *testing.T) {
 
 	ctx := context.Background()
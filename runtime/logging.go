@@ -194,6 +194,14 @@ func (r *recorder) WriteHeader(s int) {
 	r.inner.WriteHeader(s)
 }
 
+// Flush implements http.Flusher so that streaming responses, e.g., of the
+// Watch API, are not held back by the recorder.
+func (r *recorder) Flush() {
+	if f, ok := r.inner.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (r *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	h, ok := r.inner.(http.Hijacker)
 	if !ok {
@@ -40,6 +40,7 @@ import (
 	"github.com/meta-quick/opax/metrics"
 	"github.com/meta-quick/opax/plugins"
 	"github.com/meta-quick/opax/plugins/discovery"
+	"github.com/meta-quick/opax/plugins/envoy"
 	"github.com/meta-quick/opax/plugins/logs"
 	"github.com/meta-quick/opax/repl"
 	"github.com/meta-quick/opax/server"
@@ -84,6 +85,10 @@ type Params struct {
 	// for read-only diagnostic API's (/health, /metrics, etc)
 	DiagnosticAddrs *[]string
 
+	// GRPCAddrs are the listening addresses that the OPA server will bind to
+	// for the gRPC decision API.
+	GRPCAddrs *[]string
+
 	// H2CEnabled flag controls whether OPA will allow H2C (HTTP/2 cleartext) on
 	// HTTP listeners.
 	H2CEnabled bool
@@ -387,11 +392,20 @@ func (rt *Runtime) Serve(ctx context.Context) error {
 		rt.Params.DiagnosticAddrs = &[]string{}
 	}
 
+	if rt.Params.GRPCAddrs == nil {
+		rt.Params.GRPCAddrs = &[]string{}
+	}
+
 	rt.logger.WithFields(map[string]interface{}{
 		"addrs":            *rt.Params.Addrs,
 		"diagnostic-addrs": *rt.Params.DiagnosticAddrs,
+		"grpc-addrs":       *rt.Params.GRPCAddrs,
 	}).Info("Initializing server.")
 
+	if rt.Params.Authorization == server.AuthorizationOff && (rt.Params.Authentication == server.AuthenticationJWT || rt.Params.Authentication == server.AuthenticationAPIKey) {
+		rt.logger.Warn("Authentication enabled without authorization. Requests without credentials will be accepted. See https://www.openpolicyagent.org/docs/latest/security/#authentication-and-authorization for more information.")
+	}
+
 	if rt.Params.Authorization == server.AuthorizationOff && rt.Params.Authentication == server.AuthenticationToken {
 		rt.logger.Error("Token authentication enabled without authorization. Authentication will be ineffective. See https://www.openpolicyagent.org/docs/latest/security/#authentication-and-authorization for more information.")
 	}
@@ -454,6 +468,10 @@ func (rt *Runtime) Serve(ctx context.Context) error {
 		rt.server = rt.server.WithDiagnosticAddresses(*rt.Params.DiagnosticAddrs)
 	}
 
+	if rt.Params.GRPCAddrs != nil {
+		rt.server = rt.server.WithGRPCAddresses(*rt.Params.GRPCAddrs)
+	}
+
 	rt.server, err = rt.server.Init(ctx)
 	if err != nil {
 		rt.logger.WithFields(map[string]interface{}{"err": err}).Error("Unable to initialize server.")
@@ -556,6 +574,17 @@ func (rt *Runtime) DiagnosticAddrs() []string {
 	return rt.server.DiagnosticAddrs()
 }
 
+// GRPCAddrs returns a list of addresses that the runtime is listening on for
+// the gRPC decision API (when in server mode). Returns an empty list if it
+// hasn't started listening.
+func (rt *Runtime) GRPCAddrs() []string {
+	if rt.server == nil {
+		return nil
+	}
+
+	return rt.server.GRPCAddrs()
+}
+
 // StartREPL starts the runtime in REPL mode. This function will block the calling goroutine.
 func (rt *Runtime) StartREPL(ctx context.Context) {
 
@@ -860,4 +889,5 @@ func generateDecisionID() string {
 
 func init() {
 	registeredPlugins = make(map[string]plugins.Factory)
+	registeredPlugins[envoy.Name] = envoy.Factory{}
 }
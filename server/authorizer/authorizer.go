@@ -160,6 +160,13 @@ func makeInput(r *http.Request) (*http.Request, interface{}, error) {
 	method := strings.ToUpper(r.Method)
 	query := r.URL.Query()
 
+	if isWatch(method, path) {
+		path, err = watchDataPath(query)
+		if err != nil {
+			return r, nil, err
+		}
+	}
+
 	var rawBody []byte
 
 	if expectBody(r.Method, path) {
@@ -193,8 +200,9 @@ func makeInput(r *http.Request) (*http.Request, interface{}, error) {
 		r = r.WithContext(ctx)
 	}
 
-	identity, ok := identifier.Identity(r)
-	if ok {
+	if claims, ok := identifier.Claims(r); ok {
+		input["identity"] = claims
+	} else if identity, ok := identifier.Identity(r); ok {
 		input["identity"] = identity
 	}
 
@@ -214,12 +222,35 @@ func expectBody(method string, path []interface{}) bool {
 		} else if len(path) >= 2 {
 			s1 := path[0].(string)
 			s2 := path[1].(string)
+			if s1 == "v1" && s2 == "batch" {
+				return len(path) >= 3 && path[2].(string) == "data"
+			}
 			return dataAPIVersions[s1] && s2 == "data"
 		}
 	}
 	return false
 }
 
+func isWatch(method string, path []interface{}) bool {
+	return method == http.MethodGet && len(path) == 2 && path[0] == "v1" && path[1] == "watch"
+}
+
+// watchDataPath returns the path of the Data API request equivalent to a
+// request to the Watch API, so that policies that authorize reads of data by
+// path also control which documents can be watched.
+func watchDataPath(query url.Values) ([]interface{}, error) {
+	path := []interface{}{"v1", "data"}
+	watched := strings.Trim(query.Get(types.ParamPathV1), "/")
+	if watched == "" {
+		return path, nil
+	}
+	parts, err := parsePath("/" + watched)
+	if err != nil {
+		return nil, err
+	}
+	return append(path, parts...), nil
+}
+
 func expectYAML(r *http.Request) bool {
 	// NOTE(tsandall): This check comes from the server's HTTP handler code. The docs
 	// are a bit more strict, but the authorizer should be consistent w/ the original
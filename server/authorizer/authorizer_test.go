@@ -337,6 +337,36 @@ func TestMakeInput(t *testing.T) {
 
 }
 
+func TestMakeInputWatch(t *testing.T) {
+	tests := []struct {
+		query string
+		path  []interface{}
+	}{
+		{"", []interface{}{"v1", "data"}},
+		{"?path=/", []interface{}{"v1", "data"}},
+		{"?path=system/bundles", []interface{}{"v1", "data", "system", "bundles"}},
+		{"?path=a/b%252Fc&format=ndjson", []interface{}{"v1", "data", "a", "b/c"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:8181/v1/watch"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, input, err := makeInput(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if path := input.(map[string]interface{})["path"]; !reflect.DeepEqual(path, tc.path) {
+				t.Fatalf("Expected path %v but got %v", tc.path, path)
+			}
+		})
+	}
+}
+
 func TestMakeInputWithBody(t *testing.T) {
 
 	reqs := []struct {
@@ -29,6 +29,18 @@ type Info struct {
 	Error      error
 	Metrics    metrics.Metrics
 	Trace      []*topdown.Event
+	Divergence *DivergenceInfo // set if the shadow bundle's result differs from the result
+}
+
+// DivergenceInfo describes a shadow evaluation whose outcome differs from the
+// outcome of the decision.
+type DivergenceInfo struct {
+	DecisionID string       // ID of the decision whose shadow evaluation diverged
+	Bundle     string       // name of the shadow bundle
+	Revision   string       // revision of the shadow bundle
+	InputHash  string       // SHA-256 hash of the decision's input
+	Results    *interface{} // result of the shadow evaluation
+	Error      error        // error of the shadow evaluation
 }
 
 // BundleInfo contains information describing a bundle.
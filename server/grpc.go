@@ -0,0 +1,826 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/rego"
+	"github.com/meta-quick/opax/server/identifier"
+	"github.com/meta-quick/opax/server/opav1"
+	"github.com/meta-quick/opax/server/types"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/topdown"
+	"github.com/meta-quick/opax/util"
+)
+
+// grpcHealthStatusListener is the name of the plugin status listener that
+// keeps the serving status of the gRPC health service up to date.
+const grpcHealthStatusListener = "server-grpc-health"
+
+// initGRPC sets up the state shared by all gRPC listeners. Requests to the
+// gRPC decision API are authenticated and authorized like requests to the
+// REST API.
+func (s *Server) initGRPC(authenticator identifier.Authenticator) {
+
+	if authenticator != nil || s.authentication != AuthenticationOff || s.authorization != AuthorizationOff {
+		s.grpcAuth = s.initHandlerAuth(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), authenticator)
+	}
+
+	s.grpcHealth = health.NewServer()
+	s.updateGRPCHealth(s.manager.PluginStatus())
+	s.manager.RegisterPluginStatusListener(grpcHealthStatusListener, s.updateGRPCHealth)
+}
+
+// updateGRPCHealth reports the decision service as serving once the bundles
+// have been activated, like the /health endpoint with the bundles parameter.
+func (s *Server) updateGRPCHealth(statuses map[string]*plugins.Status) {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if s.bundlesReady(statuses) {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+	s.grpcHealth.SetServingStatus("", st)
+	s.grpcHealth.SetServingStatus(opav1.DecisionService_ServiceDesc.ServiceName, st)
+}
+
+// newGRPCServer returns a gRPC server that serves the decision API and the
+// health service.
+func (s *Server) newGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(s.grpcStreamAuth),
+	)
+	gs := grpc.NewServer(opts...)
+	opav1.RegisterDecisionServiceServer(gs, &grpcDecisionService{s: s})
+	healthpb.RegisterHealthServer(gs, s.grpcHealth)
+	return gs
+}
+
+func (s *Server) getGRPCListener(addr string) ([]Loop, httpListener, error) {
+	parsedURL, err := parseURL(addr, s.cert != nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l := &grpcListener{}
+	loops := []Loop{l.ListenAndServe}
+
+	switch parsedURL.Scheme {
+	case "unix":
+		l.network = "unix"
+		l.address = parsedURL.Host + parsedURL.Path
+		// Recover @ prefix for abstract Unix sockets.
+		if strings.HasPrefix(parsedURL.String(), parsedURL.Scheme+"://@") {
+			l.address = "@" + l.address
+		} else {
+			// Remove domain socket file in case it already exists.
+			os.Remove(l.address)
+		}
+		l.s = s.newGRPCServer()
+	case "http":
+		l.network, l.address = "tcp", parsedURL.Host
+		l.s = s.newGRPCServer()
+	case "https":
+		if s.cert == nil {
+			return nil, nil, fmt.Errorf("TLS certificate required but not supplied")
+		}
+		l.network, l.address = "tcp", parsedURL.Host
+		l.s = s.newGRPCServer(grpc.Creds(credentials.NewTLS(s.tlsConfig())))
+		if s.certRefresh > 0 {
+			logger := s.manager.Logger().WithFields(map[string]interface{}{
+				"cert-file":     s.certFile,
+				"cert-key-file": s.certKeyFile,
+			})
+			loops = append(loops, s.certLoop(logger))
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid url scheme %q", parsedURL.Scheme)
+	}
+
+	return loops, l, nil
+}
+
+// grpcListener serves the gRPC decision API. TLS is configured on the gRPC
+// server so ListenAndServe and ListenAndServeTLS behave the same.
+type grpcListener struct {
+	s       *grpc.Server
+	network string
+	address string
+	addr    string
+	addrMtx sync.RWMutex
+}
+
+var _ httpListener = (*grpcListener)(nil)
+
+func (g *grpcListener) ListenAndServe() error {
+	l, err := net.Listen(g.network, g.address)
+	if err != nil {
+		return err
+	}
+
+	if g.network == "tcp" {
+		g.addrMtx.Lock()
+		g.addr = l.Addr().String()
+		g.addrMtx.Unlock()
+	}
+
+	return g.s.Serve(l)
+}
+
+func (g *grpcListener) ListenAndServeTLS(string, string) error {
+	return g.ListenAndServe()
+}
+
+func (g *grpcListener) Addr() string {
+	g.addrMtx.RLock()
+	defer g.addrMtx.RUnlock()
+	return g.addr
+}
+
+// Shutdown waits for pending RPCs to finish. Open streams are closed once the
+// context is done.
+func (g *grpcListener) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		g.s.Stop()
+		return ctx.Err()
+	}
+}
+
+func (g *grpcListener) Type() httpListenerType {
+	return grpcListenerType
+}
+
+// grpcDecisionService implements the gRPC decision API.
+type grpcDecisionService struct {
+	opav1.UnimplementedDecisionServiceServer
+	s *Server
+}
+
+func (g *grpcDecisionService) Evaluate(ctx context.Context, req *opav1.EvaluateRequest) (*opav1.EvaluateResponse, error) {
+	s := g.s
+	m := metrics.New()
+	m.Timer(metrics.ServerHandler).Start()
+
+	decisionID := s.generateDecisionID()
+	annotateSpan(ctx, decisionID)
+
+	urlPath := strings.Trim(req.Path, "/")
+	remoteAddr := grpcRemoteAddr(ctx)
+
+	m.Timer(metrics.RegoInputParse).Start()
+
+	input, err := readInputGRPC(req.Input)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	m.Timer(metrics.RegoInputParse).Stop()
+
+	txn, err := s.store.NewTransaction(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	defer s.store.Abort(ctx, txn)
+
+	br, err := getRevisions(ctx, s.store, txn)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	logger := s.getDecisionLogger(br)
+
+	preparedQuery, err := s.prepareDataQuery(ctx, txn, urlPath, false, req.StrictBuiltinErrors, m)
+	if err != nil {
+		_ = logger.Log(ctx, txn, decisionID, remoteAddr, urlPath, "", input.goInput, input.value, nil, err, m)
+		return nil, grpcError(err)
+	}
+
+	rs, err := preparedQuery.Eval(
+		ctx,
+		rego.EvalTransaction(txn),
+		rego.EvalParsedInput(input.value),
+		rego.EvalMetrics(m),
+		rego.EvalInterQueryBuiltinCache(s.interQueryBuiltinCache),
+		rego.EvalBudget(s.budget),
+	)
+
+	m.Timer(metrics.ServerHandler).Stop()
+
+	if err != nil {
+		_ = logger.Log(ctx, txn, decisionID, remoteAddr, urlPath, "", input.goInput, input.value, nil, err, m)
+		return nil, grpcError(err)
+	}
+
+	var result *interface{}
+	if len(rs) > 0 {
+		result = &rs[0].Expressions[0].Value
+	}
+
+	if err := logger.Log(ctx, txn, decisionID, remoteAddr, urlPath, "", input.goInput, input.value, result, nil, m); err != nil {
+		return nil, grpcError(err)
+	}
+
+	var mvalues map[string]interface{}
+	if req.Metrics {
+		mvalues = m.All()
+	}
+
+	return newGRPCEvaluateResponse(decisionID, result, mvalues, req.JsonResult)
+}
+
+func (g *grpcDecisionService) BatchEvaluate(ctx context.Context, req *opav1.BatchEvaluateRequest) (*opav1.BatchEvaluateResponse, error) {
+	s := g.s
+	m := metrics.New()
+	m.Timer(metrics.ServerHandler).Start()
+
+	urlPath := strings.Trim(req.Path, "/")
+	remoteAddr := grpcRemoteAddr(ctx)
+
+	m.Timer(metrics.RegoInputParse).Start()
+
+	if len(req.Inputs) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "batch request must contain at least one input")
+	}
+
+	if err := s.checkBatchSize(len(req.Inputs)); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	inputs := make(map[string]batchInput, len(req.Inputs))
+	for id, in := range req.Inputs {
+		input, err := readInputGRPC(in)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "input %q: %v", id, err)
+		}
+		inputs[id] = input
+	}
+
+	m.Timer(metrics.RegoInputParse).Stop()
+	m.Counter(serverBatchItems).Add(uint64(len(inputs)))
+
+	txn, err := s.store.NewTransaction(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	defer s.store.Abort(ctx, txn)
+
+	br, err := getRevisions(ctx, s.store, txn)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	logger := s.getDecisionLogger(br)
+
+	preparedQuery, err := s.prepareDataQuery(ctx, txn, urlPath, false, req.StrictBuiltinErrors, m)
+	if err != nil {
+		for _, input := range inputs {
+			_ = logger.Log(ctx, txn, s.generateDecisionID(), remoteAddr, urlPath, "", input.goInput, input.value, nil, err, metrics.New())
+		}
+		return nil, grpcError(err)
+	}
+
+	parallelism := limitParallelism(int(req.Parallelism))
+
+	ids, responses, logErrs := s.evalBatch(ctx, txn, preparedQuery, logger, remoteAddr, urlPath, inputs, parallelism, req.Metrics)
+
+	for _, err := range logErrs {
+		if err != nil {
+			return nil, grpcError(err)
+		}
+	}
+
+	result := &opav1.BatchEvaluateResponse{
+		Responses: map[string]*opav1.EvaluateResponse{},
+		Errors:    map[string]*opav1.Error{},
+	}
+
+	for i, id := range ids {
+		if e := responses[i].Error; e != nil {
+			m.Counter(serverBatchErrors).Incr()
+			result.Errors[id] = &opav1.Error{
+				DecisionId: responses[i].DecisionID,
+				Code:       e.Code,
+				Message:    e.Message,
+			}
+			continue
+		}
+		resp, err := newGRPCEvaluateResponse(responses[i].DecisionID, responses[i].Result, responses[i].Metrics, req.JsonResult)
+		if err != nil {
+			return nil, err
+		}
+		result.Responses[id] = resp
+	}
+
+	m.Timer(metrics.ServerHandler).Stop()
+
+	if req.Metrics {
+		result.Metrics, err = grpcStruct(m.All())
+		if err != nil {
+			return nil, grpcError(err)
+		}
+	}
+
+	return result, nil
+}
+
+func (g *grpcDecisionService) Compile(ctx context.Context, req *opav1.CompileRequest) (*opav1.CompileResponse, error) {
+	s := g.s
+	m := metrics.New()
+
+	input, err := readInputGRPC(req.Input)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Decode the request like the REST API so that both report the same
+	// errors for invalid queries and unknowns.
+	body := map[string]interface{}{
+		"query":    req.Query,
+		"unknowns": req.Unknowns,
+	}
+	if input.goInput != nil {
+		body["input"] = *input.goInput
+	}
+
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	request, reqErr := readInputCompilePostV1(ioutil.NopCloser(bytes.NewReader(bs)))
+	if reqErr != nil {
+		return nil, grpcErrorV1(codes.InvalidArgument, reqErr)
+	}
+
+	txn, err := s.store.NewTransaction(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	defer s.store.Abort(ctx, txn)
+
+	pq, err := s.partialEval(ctx, txn, request, m, false, nil)
+	if err != nil {
+		if errs, ok := err.(ast.Errors); ok {
+			return nil, grpcErrorV1(codes.InvalidArgument, types.NewErrorV1(types.CodeInvalidParameter, types.MsgCompileModuleError).WithASTErrors(errs))
+		}
+		return nil, grpcError(err)
+	}
+
+	result := types.PartialEvaluationResultV1{
+		Queries: pq.Queries,
+		Support: pq.Support,
+	}
+
+	value, raw, err := grpcValue(result, req.JsonResult)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &opav1.CompileResponse{Result: value, ResultJson: raw}, nil
+}
+
+func (g *grpcDecisionService) WatchData(req *opav1.WatchDataRequest, stream opav1.DecisionService_WatchDataServer) error {
+	s := g.s
+	ctx := stream.Context()
+	urlPath := strings.Trim(req.Path, "/")
+
+	// Subscribe before the first evaluation so that no change is missed.
+	changed := s.subscribeWatch()
+	defer s.unsubscribeWatch(changed)
+
+	var last []byte
+	var lastDefined, sent bool
+
+	for {
+		value, defined, err := s.evalWatch(ctx, urlPath)
+		if err != nil {
+			return grpcError(err)
+		}
+
+		bs, err := json.Marshal(value)
+		if err != nil {
+			return grpcError(err)
+		}
+
+		if !sent || defined != lastDefined || !bytes.Equal(bs, last) {
+			event := &opav1.WatchDataEvent{Defined: defined}
+			if defined {
+				event.Value, event.ValueJson, err = grpcValue(value, req.JsonResult)
+				if err != nil {
+					return grpcError(err)
+				}
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+			last, lastDefined, sent = bs, defined, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.watchDone:
+			// Streams end on shutdown so that GracefulStop does not wait for them.
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+// evalWatch evaluates the document at urlPath in a new transaction.
+func (s *Server) evalWatch(ctx context.Context, urlPath string) (interface{}, bool, error) {
+	txn, err := s.store.NewTransaction(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer s.store.Abort(ctx, txn)
+
+	opts := []func(*rego.Rego){
+		rego.Compiler(s.getCompiler()),
+		rego.Store(s.store),
+		rego.InterQueryBuiltinCache(s.interQueryBuiltinCache),
+		rego.Budget(s.budget),
+	}
+
+	rego, err := s.makeRego(ctx, false, false, txn, nil, urlPath, metrics.New(), false, nil, opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rs, err := rego.Eval(ctx)
+	if err != nil || len(rs) == 0 {
+		return nil, false, err
+	}
+
+	return rs[0].Expressions[0].Value, true, nil
+}
+
+// subscribeWatch returns a channel that receives a value after each commit to
+// the store.
+func (s *Server) subscribeWatch() chan struct{} {
+	ch := make(chan struct{}, 1)
+	s.watchMtx.Lock()
+	defer s.watchMtx.Unlock()
+	if s.watchers == nil {
+		s.watchers = map[chan struct{}]struct{}{}
+	}
+	s.watchers[ch] = struct{}{}
+	return ch
+}
+
+func (s *Server) unsubscribeWatch(ch chan struct{}) {
+	s.watchMtx.Lock()
+	defer s.watchMtx.Unlock()
+	delete(s.watchers, ch)
+}
+
+// notifyWatchers signals all subscribers without blocking. Subscribers that
+// have not yet consumed the previous signal are not signaled twice.
+func (s *Server) notifyWatchers() {
+	s.watchMtx.Lock()
+	defer s.watchMtx.Unlock()
+	for ch := range s.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// grpcUnaryAuth authenticates and authorizes unary RPCs.
+func (s *Server) grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.grpcAuthorize(ctx, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// grpcStreamAuth authenticates and authorizes server-streaming RPCs once the
+// request has been received.
+func (s *Server) grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &grpcAuthStream{ServerStream: ss, s: s, method: info.FullMethod})
+}
+
+type grpcAuthStream struct {
+	grpc.ServerStream
+	s          *Server
+	method     string
+	authorized bool
+}
+
+func (a *grpcAuthStream) RecvMsg(m interface{}) error {
+	if err := a.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if !a.authorized {
+		if err := a.s.grpcAuthorize(a.Context(), a.method, m); err != nil {
+			return err
+		}
+		a.authorized = true
+	}
+	return nil
+}
+
+// grpcAuthorize runs the request through the authentication and
+// authorization handlers of the REST API. The request is presented to them as
+// the equivalent REST API request. The health service is not protected so
+// that it can be used for liveness and readiness probes.
+func (s *Server) grpcAuthorize(ctx context.Context, method string, req interface{}) error {
+	if s.grpcAuth == nil || strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return nil
+	}
+
+	r, err := newGRPCHTTPRequest(ctx, req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	w := &grpcAuthResponse{header: http.Header{}}
+	s.grpcAuth.ServeHTTP(w, r)
+
+	if w.status == http.StatusOK {
+		return nil
+	}
+
+	var body types.ErrorV1
+	if err := util.UnmarshalJSON(w.body.Bytes(), &body); err != nil {
+		body.Message = http.StatusText(w.status)
+	}
+
+	switch {
+	case w.status == http.StatusUnauthorized && body.Code == types.CodeUnauthenticated:
+		return status.Error(codes.Unauthenticated, body.Message)
+	case w.status == http.StatusUnauthorized:
+		return status.Error(codes.PermissionDenied, body.Message)
+	case w.status == http.StatusBadRequest:
+		return status.Error(codes.InvalidArgument, body.Message)
+	default:
+		return status.Error(codes.Internal, body.Message)
+	}
+}
+
+// newGRPCHTTPRequest returns the REST API request equivalent to a gRPC
+// request. Metadata is converted to headers.
+func newGRPCHTTPRequest(ctx context.Context, req interface{}) (*http.Request, error) {
+
+	var method, path string
+	var body map[string]interface{}
+
+	switch req := req.(type) {
+	case *opav1.EvaluateRequest:
+		method, path = http.MethodPost, "/v1/data/"+strings.Trim(req.Path, "/")
+		input, err := readInputGRPC(req.Input)
+		if err != nil {
+			return nil, err
+		}
+		body = map[string]interface{}{}
+		if input.goInput != nil {
+			body["input"] = *input.goInput
+		}
+	case *opav1.BatchEvaluateRequest:
+		method, path = http.MethodPost, "/v1/batch/data/"+strings.Trim(req.Path, "/")
+		inputs := make(map[string]interface{}, len(req.Inputs))
+		for id, in := range req.Inputs {
+			input, err := readInputGRPC(in)
+			if err != nil {
+				return nil, fmt.Errorf("input %q: %w", id, err)
+			}
+			inputs[id] = nil
+			if input.goInput != nil {
+				inputs[id] = *input.goInput
+			}
+		}
+		body = map[string]interface{}{"inputs": inputs}
+	case *opav1.CompileRequest:
+		method, path = http.MethodPost, "/v1/compile"
+	case *opav1.WatchDataRequest:
+		method, path = http.MethodGet, "/v1/data/"+strings.Trim(req.Path, "/")
+	default:
+		return nil, fmt.Errorf("unsupported request %T", req)
+	}
+
+	var bs []byte
+	if body != nil {
+		var err error
+		bs, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r := &http.Request{
+		Method:     method,
+		URL:        &url.URL{Path: path},
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(bs)),
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		if strings.HasPrefix(k, ":") || strings.HasSuffix(k, "-bin") {
+			continue
+		}
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state := info.State
+			r.TLS = &state
+		}
+	}
+
+	return r.WithContext(ctx), nil
+}
+
+// grpcAuthResponse records the response of the authentication and
+// authorization handlers.
+type grpcAuthResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *grpcAuthResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *grpcAuthResponse) Write(bs []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(bs)
+}
+
+func (w *grpcAuthResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func grpcRemoteAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// readInputGRPC converts an input document of the gRPC decision API. A nil
+// value is returned if the input is not set.
+func readInputGRPC(in *opav1.Input) (batchInput, error) {
+
+	var bs []byte
+
+	switch x := in.GetInput().(type) {
+	case *opav1.Input_Value:
+		var err error
+		bs, err = protojson.Marshal(x.Value)
+		if err != nil {
+			return batchInput{}, fmt.Errorf("malformed input: %w", err)
+		}
+	case *opav1.Input_Json:
+		bs = x.Json
+	default:
+		return batchInput{}, nil
+	}
+
+	var goInput interface{}
+	if err := util.UnmarshalJSON(bs, &goInput); err != nil {
+		return batchInput{}, fmt.Errorf("malformed input: %w", err)
+	}
+
+	value, err := ast.InterfaceToValue(goInput)
+	if err != nil {
+		return batchInput{}, err
+	}
+
+	return batchInput{value: value, goInput: &goInput}, nil
+}
+
+func newGRPCEvaluateResponse(decisionID string, result *interface{}, m map[string]interface{}, asJSON bool) (*opav1.EvaluateResponse, error) {
+	resp := &opav1.EvaluateResponse{DecisionId: decisionID}
+
+	var err error
+
+	if result != nil {
+		resp.Defined = true
+		resp.Result, resp.ResultJson, err = grpcValue(*result, asJSON)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+	}
+
+	if m != nil {
+		resp.Metrics, err = grpcStruct(m)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+	}
+
+	return resp, nil
+}
+
+// grpcValue converts x into a structured value or, if asJSON is true, into
+// JSON. Numbers in structured values are limited to the precision of a
+// double.
+func grpcValue(x interface{}, asJSON bool) (*structpb.Value, []byte, error) {
+	bs, err := json.Marshal(x)
+	if err != nil {
+		return nil, nil, err
+	}
+	if asJSON {
+		return nil, bs, nil
+	}
+	var v structpb.Value
+	if err := protojson.Unmarshal(bs, &v); err != nil {
+		return nil, nil, err
+	}
+	return &v, nil, nil
+}
+
+func grpcStruct(x map[string]interface{}) (*structpb.Struct, error) {
+	bs, err := json.Marshal(x)
+	if err != nil {
+		return nil, err
+	}
+	var v structpb.Struct
+	if err := protojson.Unmarshal(bs, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// grpcError returns the gRPC status error that corresponds to the status the
+// REST API responds with for err.
+func grpcError(err error) error {
+	switch {
+	case types.IsBadRequest(err), storage.IsInvalidPatch(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case storage.IsWriteConflictError(err):
+		return status.Error(codes.Aborted, err.Error())
+	case topdown.IsError(err):
+		return grpcErrorV1(codes.Internal, types.NewErrorV1(types.CodeInternal, types.MsgEvaluationError).WithError(err))
+	case storage.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case err == context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// grpcErrorV1 returns a gRPC status error with the message and the detailed
+// errors of e.
+func grpcErrorV1(c codes.Code, e *types.ErrorV1) error {
+	msgs := []string{e.Message}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return status.Error(c, strings.Join(msgs, ": "))
+}
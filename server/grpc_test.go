@@ -0,0 +1,449 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/meta-quick/opax/plugins"
+	"github.com/meta-quick/opax/server/opav1"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
+	"github.com/meta-quick/opax/util"
+)
+
+func TestGRPCEvaluate(t *testing.T) {
+	f := newFixture(t)
+
+	var mtx sync.Mutex
+	decisions := map[string]*Info{}
+	var nextID int
+
+	f.server = f.server.WithDecisionIDFactory(func() string {
+		mtx.Lock()
+		defer mtx.Unlock()
+		nextID++
+		return fmt.Sprint(nextID)
+	}).WithDecisionLoggerWithErr(func(_ context.Context, info *Info) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		decisions[info.DecisionID] = info
+		return nil
+	})
+
+	if err := f.v1(http.MethodPut, "/policies/test", `package test
+
+	allow { input.x > 1 }
+
+	big = 12345678901234567890
+
+	p = "a" { input.conflict }
+	p = "b" { input.conflict }`, 200, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	client, closeFn := newGRPCTestClient(t, f.server)
+	defer closeFn()
+
+	ctx := context.Background()
+
+	resp, err := client.Evaluate(ctx, &opav1.EvaluateRequest{
+		Path:  "test/allow",
+		Input: &opav1.Input{Input: &opav1.Input_Value{Value: mustStructValue(t, map[string]interface{}{"x": 2})}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.DecisionId != "1" || !resp.Defined || !resp.Result.GetBoolValue() || resp.Metrics != nil {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+
+	resp, err = client.Evaluate(ctx, &opav1.EvaluateRequest{
+		Path:  "/test/allow",
+		Input: &opav1.Input{Input: &opav1.Input_Json{Json: []byte(`{"x": 0}`)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Defined || resp.Result != nil {
+		t.Fatalf("expected undefined result but got: %v", resp)
+	}
+
+	resp, err = client.Evaluate(ctx, &opav1.EvaluateRequest{Path: "test/big", JsonResult: true, Metrics: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.ResultJson) != "12345678901234567890" || resp.Result != nil {
+		t.Fatalf("expected exact JSON result but got: %v", resp)
+	}
+	if _, ok := resp.Metrics.GetFields()["timer_server_handler_ns"]; !ok {
+		t.Fatalf("expected metrics but got: %v", resp.Metrics)
+	}
+
+	_, err = client.Evaluate(ctx, &opav1.EvaluateRequest{Path: "test/p", Input: &opav1.Input{Input: &opav1.Input_Json{Json: []byte(`{"conflict": true}`)}}})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("expected internal error but got: %v", err)
+	}
+
+	_, err = client.Evaluate(ctx, &opav1.EvaluateRequest{Path: "test/allow", Input: &opav1.Input{Input: &opav1.Input_Json{Json: []byte(`{`)}}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument error but got: %v", err)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if len(decisions) != 4 {
+		t.Fatalf("expected four logged decisions but got: %v", decisions)
+	}
+	if d := decisions["1"]; d.Path != "test/allow" || d.RemoteAddr != "bufconn" || d.Results == nil {
+		t.Fatalf("unexpected decision: %+v", d)
+	}
+	if d := decisions["4"]; d.Error == nil {
+		t.Fatalf("expected decision with error but got: %+v", d)
+	}
+}
+
+func TestGRPCBatchEvaluate(t *testing.T) {
+	f := newFixture(t)
+
+	if err := f.v1(http.MethodPut, "/policies/test", `package test
+
+	p = "a" { input.conflict }
+	p = "b" { input.conflict }
+	p = "c" { input.x }`, 200, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	client, closeFn := newGRPCTestClient(t, f.server)
+	defer closeFn()
+
+	resp, err := client.BatchEvaluate(context.Background(), &opav1.BatchEvaluateRequest{
+		Path: "test/p",
+		Inputs: map[string]*opav1.Input{
+			"ok":        {Input: &opav1.Input_Json{Json: []byte(`{"x": true}`)}},
+			"undefined": {},
+			"fail":      {Input: &opav1.Input_Json{Json: []byte(`{"conflict": true}`)}},
+		},
+		Parallelism: 2,
+		Metrics:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Responses) != 2 || len(resp.Errors) != 1 {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+	if r := resp.Responses["ok"]; r.Result.GetStringValue() != "c" || r.Metrics == nil {
+		t.Fatalf("unexpected response for ok: %v", r)
+	}
+	if r := resp.Responses["undefined"]; r.Defined || r.Result != nil {
+		t.Fatalf("unexpected response for undefined: %v", r)
+	}
+	if e := resp.Errors["fail"]; e.Code != "internal_error" {
+		t.Fatalf("unexpected error for fail: %v", e)
+	}
+	if v := resp.Metrics.GetFields()["counter_"+serverBatchErrors].GetNumberValue(); v != 1 {
+		t.Fatalf("expected one batch error but got: %v", resp.Metrics)
+	}
+
+	_, err = client.BatchEvaluate(context.Background(), &opav1.BatchEvaluateRequest{Path: "test/p"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument error but got: %v", err)
+	}
+}
+
+func TestGRPCCompile(t *testing.T) {
+	f := newFixture(t)
+
+	if err := f.v1(http.MethodPut, "/policies/test", `package test
+
+	allow { input.user == data.users[_] }`, 200, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	client, closeFn := newGRPCTestClient(t, f.server)
+	defer closeFn()
+
+	resp, err := client.Compile(context.Background(), &opav1.CompileRequest{
+		Query:      "data.test.allow == true",
+		Unknowns:   []string{"data.users"},
+		Input:      &opav1.Input{Input: &opav1.Input_Json{Json: []byte(`{"user": "alice"}`)}},
+		JsonResult: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Queries []interface{} `json:"queries"`
+	}
+	if err := util.UnmarshalJSON(resp.ResultJson, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Queries) != 1 {
+		t.Fatalf("expected one query but got: %s", resp.ResultJson)
+	}
+
+	_, err = client.Compile(context.Background(), &opav1.CompileRequest{Query: "x ="})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument error but got: %v", err)
+	}
+}
+
+func TestGRPCWatchData(t *testing.T) {
+	f := newFixture(t)
+
+	client, closeFn := newGRPCTestClient(t, f.server)
+	defer closeFn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchData(ctx, &opav1.WatchDataRequest{Path: "roles/admin", JsonResult: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Defined {
+		t.Fatalf("expected undefined value but got: %v", event)
+	}
+
+	writes := []struct {
+		path  string
+		value interface{}
+		exp   string
+	}{
+		{path: "/roles", value: map[string]interface{}{"admin": []interface{}{"alice"}}, exp: `["alice"]`},
+		// Unrelated changes do not produce events.
+		{path: "/other", value: "x"},
+		{path: "/roles/admin/-", value: "bob", exp: `["alice","bob"]`},
+	}
+
+	for _, w := range writes {
+		if err := storage.WriteOne(ctx, f.server.store, storage.AddOp, storage.MustParsePath(w.path), w.value); err != nil {
+			t.Fatal(err)
+		}
+		if w.exp == "" {
+			continue
+		}
+		exp := w.exp
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !event.Defined || string(event.ValueJson) != exp {
+			t.Fatalf("expected %v but got: %v", exp, event)
+		}
+	}
+
+	// Streams end on shutdown.
+	f.server.closeWatch()
+
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("expected end of stream but got: %v", err)
+	}
+}
+
+func TestGRPCHealth(t *testing.T) {
+	f := newFixture(t)
+
+	conn, closeFn := newGRPCTestConn(t, f.server)
+	defer closeFn()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: opav1.DecisionService_ServiceDesc.ServiceName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected serving status but got: %v", resp.Status)
+	}
+
+	f.server.manager.UpdatePluginStatus("bundle", &plugins.Status{State: plugins.StateNotReady})
+
+	resp, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected not serving status but got: %v", resp.Status)
+	}
+}
+
+func TestGRPCAuthenticationAPIKey(t *testing.T) {
+
+	ctx := context.Background()
+	store := inmem.New()
+
+	sum := sha256.Sum256([]byte("secret"))
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(keysFile, []byte(fmt.Sprintf(`{"keys": [{"id": "ci", "hash": "sha256:%x"}]}`, sum)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := plugins.New([]byte(fmt.Sprintf(`{"server": {"authentication": {"api_keys": {"file": %q}}}}`, keysFile)), "test", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := New().
+		WithStore(store).
+		WithManager(m).
+		WithAuthentication(AuthenticationAPIKey).
+		Init(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, closeFn := newGRPCTestConn(t, server)
+	defer closeFn()
+
+	client := opav1.NewDecisionServiceClient(conn)
+
+	tests := []struct {
+		key  string
+		code codes.Code
+	}{
+		{key: "", code: codes.OK},
+		{key: "secret", code: codes.OK},
+		{key: "wrong", code: codes.Unauthenticated},
+	}
+
+	for _, tc := range tests {
+		ctx := ctx
+		if tc.key != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", tc.key)
+		}
+
+		_, err := client.Evaluate(ctx, &opav1.EvaluateRequest{Path: "x"})
+		if status.Code(err) != tc.code {
+			t.Errorf("key %q: expected %v but got: %v", tc.key, tc.code, err)
+		}
+
+		stream, err := client.WatchData(ctx, &opav1.WatchDataRequest{Path: "x"})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != tc.code {
+			t.Errorf("key %q: expected %v for stream but got: %v", tc.key, tc.code, err)
+		}
+	}
+
+	// The health service does not require credentials.
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", "wrong")
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGRPCListener(t *testing.T) {
+	f := newFixture(t, func(s *Server) {
+		s.WithAddresses(nil).WithGRPCAddresses([]string{"localhost:0"})
+	})
+
+	loops, err := f.server.Listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, len(loops))
+	for _, loop := range loops {
+		go func(loop Loop) { errc <- loop() }(loop)
+	}
+
+	var addrs []string
+	for i := 0; i < 100 && len(addrs) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		addrs = f.server.GRPCAddrs()
+	}
+	if len(addrs) != 1 || len(f.server.Addrs()) != 0 {
+		t.Fatalf("expected one gRPC address but got: %v", addrs)
+	}
+
+	conn, err := grpc.Dial(addrs[0], grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := opav1.NewDecisionServiceClient(conn).Evaluate(context.Background(), &opav1.EvaluateRequest{Path: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := f.server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newGRPCTestClient(t *testing.T, s *Server) (opav1.DecisionServiceClient, func()) {
+	conn, closeFn := newGRPCTestConn(t, s)
+	return opav1.NewDecisionServiceClient(conn), closeFn
+}
+
+func newGRPCTestConn(t *testing.T, s *Server) (*grpc.ClientConn, func()) {
+	t.Helper()
+
+	l := bufconn.Listen(1 << 20)
+	gs := s.newGRPCServer()
+	go func() {
+		_ = gs.Serve(l)
+	}()
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, func() {
+		conn.Close()
+		gs.Stop()
+	}
+}
+
+func mustStructValue(t *testing.T, x interface{}) *structpb.Value {
+	t.Helper()
+	v, err := structpb.NewValue(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
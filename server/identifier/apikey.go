@@ -0,0 +1,142 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package identifier
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/meta-quick/opax/util"
+)
+
+const (
+	defaultAPIKeyHeader = "X-API-Key"
+	apiKeyHashPrefix    = "sha256:"
+)
+
+// APIKeyConfig represents the configuration of the API key authenticator.
+type APIKeyConfig struct {
+	File   string `json:"file"`
+	Header string `json:"header,omitempty"`
+}
+
+func (c *APIKeyConfig) validateAndInjectDefaults() error {
+
+	if c.File == "" {
+		return errors.New("missing required 'file' field")
+	}
+
+	if c.Header == "" {
+		c.Header = defaultAPIKeyHeader
+	}
+
+	return nil
+}
+
+// apiKeyFile is the format of the file containing the hashed API keys.
+type apiKeyFile struct {
+	Keys []struct {
+		ID     string                 `json:"id"`
+		Hash   string                 `json:"hash"`
+		Claims map[string]interface{} `json:"claims,omitempty"`
+	} `json:"keys"`
+}
+
+type apiKey struct {
+	hash   []byte
+	claims map[string]interface{}
+}
+
+// APIKeys authenticates requests carrying an API key in a header. Only the
+// SHA-256 hashes of the keys are stored. The identity of a request consists of
+// the claims configured for its key and the key ID as the "sub" claim.
+type APIKeys struct {
+	header string
+	keys   []apiKey
+}
+
+// NewAPIKeys returns a new APIKeys authenticator with the keys read from the
+// configured file.
+func NewAPIKeys(config APIKeyConfig) (*APIKeys, error) {
+
+	bs, err := ioutil.ReadFile(config.File)
+	if err != nil {
+		return nil, err
+	}
+
+	var f apiKeyFile
+	if err := util.Unmarshal(bs, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse API key file: %w", err)
+	}
+
+	a := &APIKeys{header: config.Header}
+	ids := map[string]struct{}{}
+
+	for i, k := range f.Keys {
+		if k.ID == "" {
+			return nil, fmt.Errorf("API key %d: missing id", i)
+		}
+		if _, ok := ids[k.ID]; ok {
+			return nil, fmt.Errorf("API key %q: duplicate id", k.ID)
+		}
+		ids[k.ID] = struct{}{}
+
+		if !strings.HasPrefix(k.Hash, apiKeyHashPrefix) {
+			return nil, fmt.Errorf("API key %q: hash must be prefixed with %q", k.ID, apiKeyHashPrefix)
+		}
+		hash, err := hex.DecodeString(strings.TrimPrefix(k.Hash, apiKeyHashPrefix))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: invalid SHA-256 hash", k.ID)
+		}
+
+		claims := make(map[string]interface{}, len(k.Claims)+1)
+		for name, v := range k.Claims {
+			claims[name] = v
+		}
+		claims["sub"] = k.ID
+
+		a.keys = append(a.keys, apiKey{hash: hash, claims: claims})
+	}
+
+	return a, nil
+}
+
+// Authenticate implements the Authenticator interface.
+func (a *APIKeys) Authenticate(r *http.Request) (map[string]interface{}, error) {
+
+	value := r.Header.Get(a.header)
+	if value == "" {
+		return nil, nil
+	}
+
+	hash := sha256.Sum256([]byte(value))
+
+	// Compare against every key so that the time taken does not depend on
+	// which key matched.
+	var claims map[string]interface{}
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash) == 1 {
+			claims = k.claims
+		}
+	}
+
+	if claims == nil {
+		return nil, authnError(ReasonUnknownKey, nil)
+	}
+
+	// The claims are shared between requests, hand out a copy.
+	result := make(map[string]interface{}, len(claims))
+	for name, v := range claims {
+		result[name] = v
+	}
+
+	return result, nil
+}
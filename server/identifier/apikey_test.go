@@ -0,0 +1,122 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package identifier_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/meta-quick/opax/server/identifier"
+)
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func writeAPIKeys(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "keys.yaml")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestAPIKeys(t *testing.T) {
+
+	file := writeAPIKeys(t, fmt.Sprintf(`
+keys:
+- id: ci
+  hash: %v
+  claims:
+    roles: [deployer]
+- id: dashboard
+  hash: %v
+`, hashKey("ci-secret"), hashKey("dashboard-secret")))
+
+	config, err := identifier.ParseConfig([]byte(fmt.Sprintf(`{"api_keys": {"file": %q}}`, file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.APIKeys.Header != "X-API-Key" {
+		t.Fatalf("expected default header but got %q", config.APIKeys.Header)
+	}
+
+	a, err := identifier.NewAPIKeys(*config.APIKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := authenticate(a, "X-API-Key", "")
+	if claims != nil || err != nil {
+		t.Fatalf("expected no claims and no error but got %v, %v", claims, err)
+	}
+
+	claims, err = authenticate(a, "X-API-Key", "ci-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "ci" || fmt.Sprint(claims["roles"]) != "[deployer]" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+
+	claims, err = authenticate(a, "X-API-Key", "dashboard-secret")
+	if err != nil || claims["sub"] != "dashboard" {
+		t.Fatalf("unexpected claims: %v, %v", claims, err)
+	}
+
+	_, err = authenticate(a, "X-API-Key", hashKey("ci-secret"))
+	var authnErr *identifier.AuthenticationError
+	if !errors.As(err, &authnErr) || authnErr.Reason != identifier.ReasonUnknownKey {
+		t.Fatalf("expected unknown key but got: %v", err)
+	}
+}
+
+func TestAPIKeysFileErrors(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		content string
+		wantErr string
+	}{
+		{
+			note:    "missing id",
+			content: fmt.Sprintf(`{"keys": [{"hash": %q}]}`, hashKey("x")),
+			wantErr: "API key 0: missing id",
+		},
+		{
+			note:    "duplicate id",
+			content: fmt.Sprintf(`{"keys": [{"id": "a", "hash": %q}, {"id": "a", "hash": %q}]}`, hashKey("x"), hashKey("y")),
+			wantErr: `API key "a": duplicate id`,
+		},
+		{
+			note:    "plain key",
+			content: `{"keys": [{"id": "a", "hash": "secret"}]}`,
+			wantErr: `API key "a": hash must be prefixed with "sha256:"`,
+		},
+		{
+			note:    "invalid hash",
+			content: `{"keys": [{"id": "a", "hash": "sha256:abcd"}]}`,
+			wantErr: `API key "a": invalid SHA-256 hash`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := identifier.NewAPIKeys(identifier.APIKeyConfig{File: writeAPIKeys(t, tc.content)})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q but got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package identifier
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/server/types"
+	"github.com/meta-quick/opax/server/writer"
+	"github.com/meta-quick/opax/util"
+)
+
+// Reasons for rejecting the credentials of a request. The reasons are
+// included in the error message returned to the client and in the name of the
+// counter that tracks the failures.
+const (
+	ReasonInvalidCredentials = "invalid_credentials"
+	ReasonInvalidSignature   = "invalid_signature"
+	ReasonExpired            = "expired"
+	ReasonNotYetValid        = "not_yet_valid"
+	ReasonInvalidIssuer      = "invalid_issuer"
+	ReasonInvalidAudience    = "invalid_audience"
+	ReasonUnknownKey         = "unknown_key"
+	ReasonMissingIdentity    = "missing_identity"
+	ReasonKeysUnavailable    = "keys_unavailable"
+)
+
+// authnFailedCounterPrefix is the prefix of the counters that track rejected
+// credentials by reason.
+const authnFailedCounterPrefix = "server_authn_failed_"
+
+var reasonMessages = map[string]string{
+	ReasonInvalidCredentials: "invalid credentials",
+	ReasonInvalidSignature:   "invalid token signature",
+	ReasonExpired:            "token expired",
+	ReasonNotYetValid:        "token not yet valid",
+	ReasonInvalidIssuer:      "invalid token issuer",
+	ReasonInvalidAudience:    "invalid token audience",
+	ReasonUnknownKey:         "unknown API key",
+	ReasonMissingIdentity:    "client certificate identity missing",
+	ReasonKeysUnavailable:    "token verification keys unavailable",
+}
+
+// AuthenticationError is returned by an Authenticator if the credentials of a
+// request are invalid.
+type AuthenticationError struct {
+	Reason string
+	Err    error // optional detail, not returned to the client
+}
+
+func (e *AuthenticationError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v", reasonMessages[e.Reason], e.Err)
+	}
+	return reasonMessages[e.Reason]
+}
+
+func authnError(reason string, err error) *AuthenticationError {
+	return &AuthenticationError{Reason: reason, Err: err}
+}
+
+// Authenticator validates the credentials of a request. If the request does
+// not contain credentials, nil claims and a nil error are returned.
+type Authenticator interface {
+	Authenticate(r *http.Request) (map[string]interface{}, error)
+}
+
+// Authenticated validates the credentials of incoming requests with an
+// Authenticator and sets the claims on the request. Requests with invalid
+// credentials are rejected. Requests without credentials are passed on
+// without claims so that the authorization policy can decide about them.
+type Authenticated struct {
+	inner         http.Handler
+	authenticator Authenticator
+	metrics       metrics.Metrics
+}
+
+// Metrics returns an argument that sets the metrics used to count rejected
+// credentials.
+func Metrics(m metrics.Metrics) func(*Authenticated) {
+	return func(a *Authenticated) {
+		a.metrics = m
+	}
+}
+
+// NewAuthenticated returns a new Authenticated object.
+func NewAuthenticated(inner http.Handler, authenticator Authenticator, opts ...func(*Authenticated)) *Authenticated {
+	a := &Authenticated{
+		inner:         inner,
+		authenticator: authenticator,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (h *Authenticated) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := h.authenticator.Authenticate(r)
+	if err != nil {
+		reason := ReasonInvalidCredentials
+		if authnErr, ok := err.(*AuthenticationError); ok {
+			reason = authnErr.Reason
+		}
+		if h.metrics != nil {
+			h.metrics.Counter(authnFailedCounterPrefix + reason).Incr()
+		}
+		writer.Error(w, http.StatusUnauthorized, types.NewErrorV1(types.CodeUnauthenticated, "%v: %v", types.MsgUnauthenticatedError, reasonMessages[reason]))
+		return
+	}
+
+	if claims != nil {
+		r = SetClaims(r, claims)
+	}
+
+	h.inner.ServeHTTP(w, r)
+}
+
+// Config represents the configuration of the built-in authenticators.
+type Config struct {
+	JWT     *JWTConfig    `json:"jwt,omitempty"`
+	APIKeys *APIKeyConfig `json:"api_keys,omitempty"`
+	TLS     *TLSConfig    `json:"tls,omitempty"`
+}
+
+// ParseConfig parses and validates the authentication configuration.
+func ParseConfig(raw []byte) (*Config, error) {
+
+	var c Config
+
+	if raw == nil {
+		return &c, nil
+	}
+
+	if err := util.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+
+	if c.JWT != nil {
+		if err := c.JWT.validateAndInjectDefaults(); err != nil {
+			return nil, fmt.Errorf("invalid jwt authentication config: %w", err)
+		}
+	}
+
+	if c.APIKeys != nil {
+		if err := c.APIKeys.validateAndInjectDefaults(); err != nil {
+			return nil, fmt.Errorf("invalid api_keys authentication config: %w", err)
+		}
+	}
+
+	if c.TLS != nil {
+		if err := c.TLS.validateAndInjectDefaults(); err != nil {
+			return nil, fmt.Errorf("invalid tls authentication config: %w", err)
+		}
+	}
+
+	return &c, nil
+}
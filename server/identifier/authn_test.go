@@ -0,0 +1,99 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package identifier_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/server/identifier"
+)
+
+type claimsHandler struct {
+	claims  map[string]interface{}
+	defined bool
+	called  bool
+}
+
+func (h *claimsHandler) ServeHTTP(_ http.ResponseWriter, r *http.Request) {
+	h.called = true
+	h.claims, h.defined = identifier.Claims(r)
+}
+
+type staticAuthenticator struct {
+	claims map[string]interface{}
+	err    error
+}
+
+func (a staticAuthenticator) Authenticate(*http.Request) (map[string]interface{}, error) {
+	return a.claims, a.err
+}
+
+func TestAuthenticated(t *testing.T) {
+
+	tests := []struct {
+		note          string
+		authenticator staticAuthenticator
+		code          int
+		defined       bool
+		body          string
+		counter       string
+	}{
+		{
+			note:          "no credentials",
+			authenticator: staticAuthenticator{},
+			code:          http.StatusOK,
+		},
+		{
+			note:          "valid credentials",
+			authenticator: staticAuthenticator{claims: map[string]interface{}{"sub": "alice"}},
+			code:          http.StatusOK,
+			defined:       true,
+		},
+		{
+			note:          "invalid credentials",
+			authenticator: staticAuthenticator{err: &identifier.AuthenticationError{Reason: identifier.ReasonExpired}},
+			code:          http.StatusUnauthorized,
+			body:          `"message": "request credentials rejected: token expired"`,
+			counter:       "server_authn_failed_expired",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			m := metrics.New()
+			inner := &claimsHandler{}
+			handler := identifier.NewAuthenticated(inner, tc.authenticator, identifier.Metrics(m))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/v1/data", nil)
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.code {
+				t.Fatalf("expected code %v but got %v", tc.code, rec.Code)
+			}
+
+			if tc.code != http.StatusOK {
+				if inner.called {
+					t.Fatal("expected request to be rejected")
+				}
+				if !strings.Contains(rec.Body.String(), `"code": "unauthenticated"`) || !strings.Contains(rec.Body.String(), tc.body) {
+					t.Fatalf("unexpected response: %v", rec.Body.String())
+				}
+				if n := m.Counter(tc.counter).Value(); n != uint64(1) {
+					t.Fatalf("expected counter %v to be 1 but got %v", tc.counter, n)
+				}
+				return
+			}
+
+			if inner.defined != tc.defined || (tc.defined && inner.claims["sub"] != "alice") {
+				t.Fatalf("unexpected claims: %v", inner.claims)
+			}
+		})
+	}
+}
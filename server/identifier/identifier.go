@@ -26,10 +26,24 @@ func SetIdentity(r *http.Request, v string) *http.Request {
 	return r.WithContext(context.WithValue(r.Context(), identity, v))
 }
 
+// Claims returns the validated claims of the caller associated with ctx. Claims
+// are set by the built-in authentication handlers instead of a raw identity.
+func Claims(r *http.Request) (map[string]interface{}, bool) {
+	v, ok := r.Context().Value(claims).(map[string]interface{})
+	return v, ok
+}
+
+// SetClaims returns a new http.Request with the validated claims set to v.
+func SetClaims(r *http.Request, v map[string]interface{}) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claims, v))
+}
+
 type identityKey string
 
 const identity = identityKey("org.openpolicyagent/identity")
 
+const claims = identityKey("org.openpolicyagent/claims")
+
 // TokenBased extracts Bearer tokens from the request.
 type TokenBased struct {
 	inner http.Handler
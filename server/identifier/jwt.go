@@ -0,0 +1,406 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package identifier
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meta-quick/opax/internal/jwx/jwa"
+	"github.com/meta-quick/opax/internal/jwx/jwk"
+	"github.com/meta-quick/opax/internal/jwx/jws"
+	"github.com/meta-quick/opax/util"
+)
+
+const (
+	defaultJWKSRefreshSeconds = int64(300)
+
+	// jwksMinRefreshInterval limits how often a token with an unknown key ID
+	// can cause the key set to be reloaded.
+	jwksMinRefreshInterval = 10 * time.Second
+
+	jwksFetchTimeout   = 10 * time.Second
+	jwksSizeLimitBytes = 1 << 20
+)
+
+// defaultJWTAlgorithms are the signature algorithms accepted if none are
+// configured. Symmetric algorithms and unsigned tokens are never accepted.
+var defaultJWTAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+}
+
+// JWTConfig represents the configuration of the JWT authenticator.
+type JWTConfig struct {
+	JWKSFile           string   `json:"jwks_file,omitempty"`
+	JWKSURL            string   `json:"jwks_url,omitempty"`
+	JWKSRefreshSeconds *int64   `json:"jwks_refresh_seconds,omitempty"`
+	Issuer             string   `json:"issuer,omitempty"`
+	Audience           string   `json:"audience,omitempty"`
+	Algorithms         []string `json:"algorithms,omitempty"`
+	LeewaySeconds      int64    `json:"leeway_seconds,omitempty"`
+}
+
+func (c *JWTConfig) validateAndInjectDefaults() error {
+
+	if (c.JWKSFile == "") == (c.JWKSURL == "") {
+		return errors.New("exactly one of 'jwks_file' or 'jwks_url' must be set")
+	}
+
+	if c.JWKSRefreshSeconds == nil {
+		v := defaultJWKSRefreshSeconds
+		c.JWKSRefreshSeconds = &v
+	} else if *c.JWKSRefreshSeconds < 1 {
+		return errors.New("'jwks_refresh_seconds' must be at least 1")
+	}
+
+	if c.LeewaySeconds < 0 {
+		return errors.New("'leeway_seconds' must not be negative")
+	}
+
+	if len(c.Algorithms) == 0 {
+		c.Algorithms = defaultJWTAlgorithms
+	}
+
+	for _, alg := range c.Algorithms {
+		switch jwa.SignatureAlgorithm(alg) {
+		case jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512, jwa.ES256, jwa.ES384, jwa.ES512, jwa.SM2:
+		default:
+			return fmt.Errorf("unsupported algorithm %q", alg)
+		}
+	}
+
+	return nil
+}
+
+// JWT authenticates requests carrying a signed JSON Web Token as a Bearer
+// token. Tokens are verified with a key set loaded from a file or an HTTP
+// endpoint. The key set is cached and reloaded periodically, or earlier if a
+// token refers to an unknown key. Outdated keys are used while the key set is
+// reloaded.
+type JWT struct {
+	config     JWTConfig
+	algorithms map[jwa.SignatureAlgorithm]struct{}
+	client     *http.Client
+
+	mtx         sync.Mutex
+	keys        []jwk.Key     // replaced, never modified, on reload
+	loaded      time.Time     // time of the last successful load
+	lastAttempt time.Time     // time of the last load attempt
+	loading     chan struct{} // closed when the load in progress completes
+	loadErr     error         // error of the last load attempt
+}
+
+// NewJWT returns a new JWT authenticator. If the key set is read from a file,
+// the file must be readable when the authenticator is created.
+func NewJWT(config JWTConfig) (*JWT, error) {
+
+	a := &JWT{
+		config:     config,
+		algorithms: make(map[jwa.SignatureAlgorithm]struct{}, len(config.Algorithms)),
+		client:     &http.Client{Timeout: jwksFetchTimeout},
+	}
+
+	for _, alg := range config.Algorithms {
+		a.algorithms[jwa.SignatureAlgorithm(alg)] = struct{}{}
+	}
+
+	if config.JWKSFile != "" {
+		if err := a.reloadIfAllowed(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Authenticate implements the Authenticator interface.
+func (a *JWT) Authenticate(r *http.Request) (map[string]interface{}, error) {
+
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, nil
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, authnError(ReasonInvalidCredentials, errors.New("malformed token"))
+	}
+
+	var header jws.StandardHeaders
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, authnError(ReasonInvalidCredentials, err)
+	}
+
+	if _, ok := a.algorithms[header.Algorithm]; !ok {
+		return nil, authnError(ReasonInvalidSignature, fmt.Errorf("algorithm %q not allowed", header.Algorithm))
+	}
+
+	now := time.Now()
+
+	keys, err := a.keysFor(header.KeyID, now)
+	if err != nil {
+		return nil, authnError(ReasonKeysUnavailable, err)
+	}
+
+	var payload []byte
+
+	for _, key := range keys {
+		if alg := key.GetAlgorithm(); alg != jwa.NoValue && alg != header.Algorithm {
+			continue
+		}
+		material, err := publicKey(key)
+		if err != nil {
+			continue
+		}
+		if payload, err = jws.Verify([]byte(token), header.Algorithm, material); err == nil {
+			break
+		}
+	}
+
+	if payload == nil {
+		return nil, authnError(ReasonInvalidSignature, nil)
+	}
+
+	var claims map[string]interface{}
+	if err := util.UnmarshalJSON(payload, &claims); err != nil || claims == nil {
+		return nil, authnError(ReasonInvalidCredentials, errors.New("malformed claims"))
+	}
+
+	if err := a.checkClaims(claims, now); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (a *JWT) checkClaims(claims map[string]interface{}, now time.Time) error {
+
+	leeway := time.Duration(a.config.LeewaySeconds) * time.Second
+
+	if exp, ok, err := numericDate(claims, "exp"); err != nil {
+		return authnError(ReasonInvalidCredentials, err)
+	} else if ok && !now.Before(exp.Add(leeway)) {
+		return authnError(ReasonExpired, nil)
+	}
+
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return authnError(ReasonInvalidCredentials, err)
+	} else if ok && now.Add(leeway).Before(nbf) {
+		return authnError(ReasonNotYetValid, nil)
+	}
+
+	if a.config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.config.Issuer {
+			return authnError(ReasonInvalidIssuer, nil)
+		}
+	}
+
+	if a.config.Audience != "" && !hasAudience(claims["aud"], a.config.Audience) {
+		return authnError(ReasonInvalidAudience, nil)
+	}
+
+	return nil
+}
+
+// keysFor returns the keys that may have signed a token with the given key
+// ID. The key set is reloaded if it is outdated or does not contain the key.
+// Outdated keys are reloaded in the background.
+func (a *JWT) keysFor(kid string, now time.Time) ([]jwk.Key, error) {
+
+	refresh := time.Duration(*a.config.JWKSRefreshSeconds) * time.Second
+
+	keys, loaded := a.current()
+
+	if keys == nil {
+		if err := a.reloadIfAllowed(now); err != nil {
+			return nil, err
+		}
+		keys, _ = a.current()
+	} else if now.Sub(loaded) >= refresh {
+		go a.reloadIfAllowed(now)
+	}
+
+	matching := matchKeys(keys, kid)
+	if len(matching) == 0 && kid != "" {
+		if err := a.reloadIfAllowed(now); err == nil {
+			keys, _ = a.current()
+			matching = matchKeys(keys, kid)
+		}
+	}
+
+	return matching, nil
+}
+
+func (a *JWT) current() ([]jwk.Key, time.Time) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.keys, a.loaded
+}
+
+// reloadIfAllowed reloads the key set unless it has been attempted within
+// jwksMinRefreshInterval. Concurrent callers wait for the same reload. The
+// lock is not held while the key set is loaded so that slow key set
+// endpoints do not block tokens signed with known keys.
+func (a *JWT) reloadIfAllowed(now time.Time) error {
+
+	a.mtx.Lock()
+
+	if loading := a.loading; loading != nil {
+		a.mtx.Unlock()
+		<-loading
+		a.mtx.Lock()
+		defer a.mtx.Unlock()
+		return a.loadErr
+	}
+
+	if !a.lastAttempt.IsZero() && now.Sub(a.lastAttempt) < jwksMinRefreshInterval {
+		a.mtx.Unlock()
+		return errors.New("key set reload rate limited")
+	}
+
+	loading := make(chan struct{})
+	a.loading = loading
+	a.lastAttempt = now
+	a.mtx.Unlock()
+
+	keys, err := a.load()
+
+	a.mtx.Lock()
+	if err == nil {
+		a.keys = keys
+		a.loaded = now
+	}
+	a.loadErr = err
+	a.loading = nil
+	a.mtx.Unlock()
+
+	close(loading)
+
+	return err
+}
+
+func (a *JWT) load() ([]jwk.Key, error) {
+
+	var bs []byte
+	var err error
+
+	if a.config.JWKSFile != "" {
+		bs, err = ioutil.ReadFile(a.config.JWKSFile)
+	} else {
+		bs, err = a.fetch()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key set: %w", err)
+	}
+
+	set, err := jwk.ParseBytes(bs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key set: %w", err)
+	}
+
+	return set.Keys, nil
+}
+
+func (a *JWT) fetch() ([]byte, error) {
+
+	resp, err := a.client.Get(a.config.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response code %d", resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, jwksSizeLimitBytes))
+}
+
+func matchKeys(keys []jwk.Key, kid string) []jwk.Key {
+	if kid == "" {
+		return keys
+	}
+	var result []jwk.Key
+	for _, key := range keys {
+		if key.GetKeyID() == kid {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+func publicKey(key jwk.Key) (interface{}, error) {
+	material, err := key.Materialize()
+	if err != nil {
+		return nil, err
+	}
+	switch material.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return jwk.GetPublicKey(material)
+	}
+	return material, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	match := bearerTokenRegexp.FindStringSubmatch(r.Header.Get("Authorization"))
+	if len(match) == 0 {
+		return "", false
+	}
+	return match[1], true
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	bs, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	if err := json.Unmarshal(bs, v); err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	return nil
+}
+
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("claim %q must be a number", name)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("claim %q must be a number", name)
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true, nil
+}
+
+func hasAudience(aud interface{}, expected string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == expected
+	case []interface{}:
+		for _, v := range aud {
+			if s, ok := v.(string); ok && s == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,379 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package identifier_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meta-quick/opax/internal/jwx/jwa"
+	"github.com/meta-quick/opax/internal/jwx/jws"
+	"github.com/meta-quick/opax/server/identifier"
+)
+
+func jwks(t *testing.T, keys map[string]*rsa.PrivateKey) []byte {
+	t.Helper()
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	bs, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	hdr, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jws.SignLiteral(payload, jwa.SignatureAlgorithm(alg), key, hdr, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(token)
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func authenticate(a identifier.Authenticator, header, value string) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, "/v1/data", nil)
+	if err != nil {
+		panic(err)
+	}
+	if value != "" {
+		req.Header.Set(header, value)
+	}
+	return a.Authenticate(req)
+}
+
+func TestJWT(t *testing.T) {
+
+	key := generateKey(t)
+	otherKey := generateKey(t)
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, jwks(t, map[string]*rsa.PrivateKey{"k1": key}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := identifier.ParseConfig([]byte(fmt.Sprintf(`{"jwt": {
+		"jwks_file": %q,
+		"issuer": "https://issuer.example.com",
+		"audience": "opa",
+		"leeway_seconds": 5
+	}}`, file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := identifier.NewJWT(*config.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	valid := func(overrides map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://issuer.example.com",
+			"aud": []string{"other", "opa"},
+			"exp": now + 60,
+			"nbf": now - 60,
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+
+	tests := []struct {
+		note     string
+		header   string
+		reason   string
+		expected string
+	}{
+		{
+			note: "no credentials",
+		},
+		{
+			note:     "valid token",
+			header:   "Bearer " + signToken(t, key, "RS256", "k1", valid(nil)),
+			expected: "alice",
+		},
+		{
+			note:     "within leeway",
+			header:   "Bearer " + signToken(t, key, "RS256", "k1", valid(map[string]interface{}{"exp": now - 2, "aud": "opa"})),
+			expected: "alice",
+		},
+		{
+			note:   "malformed token",
+			header: "Bearer not-a-token",
+			reason: identifier.ReasonInvalidCredentials,
+		},
+		{
+			note:   "wrong key",
+			header: "Bearer " + signToken(t, otherKey, "RS256", "k1", valid(nil)),
+			reason: identifier.ReasonInvalidSignature,
+		},
+		{
+			note:   "algorithm not allowed",
+			header: "Bearer " + signToken(t, key, "PS256", "k1", valid(nil)),
+			reason: identifier.ReasonInvalidSignature,
+		},
+		{
+			note:   "expired",
+			header: "Bearer " + signToken(t, key, "RS256", "k1", valid(map[string]interface{}{"exp": now - 10})),
+			reason: identifier.ReasonExpired,
+		},
+		{
+			note:   "not yet valid",
+			header: "Bearer " + signToken(t, key, "RS256", "k1", valid(map[string]interface{}{"nbf": now + 60})),
+			reason: identifier.ReasonNotYetValid,
+		},
+		{
+			note:   "wrong issuer",
+			header: "Bearer " + signToken(t, key, "RS256", "k1", valid(map[string]interface{}{"iss": "https://evil.example.com"})),
+			reason: identifier.ReasonInvalidIssuer,
+		},
+		{
+			note:   "missing audience",
+			header: "Bearer " + signToken(t, key, "RS256", "k1", valid(map[string]interface{}{"aud": nil})),
+			reason: identifier.ReasonInvalidAudience,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			claims, err := authenticate(a, "Authorization", tc.header)
+			if tc.reason != "" {
+				var authnErr *identifier.AuthenticationError
+				if !errors.As(err, &authnErr) || authnErr.Reason != tc.reason {
+					t.Fatalf("expected reason %v but got: %v", tc.reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected == "" {
+				if claims != nil {
+					t.Fatalf("expected no claims but got %v", claims)
+				}
+			} else if claims["sub"] != tc.expected {
+				t.Fatalf("expected subject %v but got %v", tc.expected, claims)
+			}
+		})
+	}
+}
+
+func TestJWTKeySetEndpoint(t *testing.T) {
+
+	key1 := generateKey(t)
+	key2 := generateKey(t)
+
+	var requests int32
+	keys := map[string]*rsa.PrivateKey{"k1": key1}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(jwks(t, keys))
+	}))
+	defer ts.Close()
+
+	config, err := identifier.ParseConfig([]byte(fmt.Sprintf(`{"jwt": {"jwks_url": %q}}`, ts.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := identifier.NewJWT(*config.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"sub": "bob"}
+
+	for i := 0; i < 3; i++ {
+		if _, err := authenticate(a, "Authorization", "Bearer "+signToken(t, key1, "RS256", "k1", claims)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected key set to be fetched once but got %d requests", n)
+	}
+
+	// Unknown key IDs do not trigger a reload within the minimum refresh
+	// interval.
+	keys["k2"] = key2
+	_, err = authenticate(a, "Authorization", "Bearer "+signToken(t, key2, "RS256", "k2", claims))
+	var authnErr *identifier.AuthenticationError
+	if !errors.As(err, &authnErr) || authnErr.Reason != identifier.ReasonInvalidSignature {
+		t.Fatalf("expected invalid signature but got: %v", err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected rate limited reload but got %d requests", n)
+	}
+}
+
+func TestJWTKeySetConcurrentLoad(t *testing.T) {
+
+	key := generateKey(t)
+
+	var requests int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+		}
+		<-release
+		w.Write(jwks(t, map[string]*rsa.PrivateKey{"k1": key}))
+	}))
+	defer ts.Close()
+
+	config, err := identifier.ParseConfig([]byte(fmt.Sprintf(`{"jwt": {"jwks_url": %q}}`, ts.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := identifier.NewJWT(*config.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := "Bearer " + signToken(t, key, "RS256", "k1", map[string]interface{}{"sub": "bob"})
+
+	// Requests that arrive while the key set is loaded wait for the same load.
+	errs := make(chan error)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := authenticate(a, "Authorization", token)
+			errs <- err
+		}()
+	}
+
+	<-started
+	close(release)
+
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected key set to be fetched once but got %d requests", n)
+	}
+}
+
+func TestJWTKeySetUnavailable(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	config, err := identifier.ParseConfig([]byte(fmt.Sprintf(`{"jwt": {"jwks_url": %q}}`, ts.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := identifier.NewJWT(*config.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = authenticate(a, "Authorization", "Bearer "+signToken(t, generateKey(t), "RS256", "k1", map[string]interface{}{}))
+	var authnErr *identifier.AuthenticationError
+	if !errors.As(err, &authnErr) || authnErr.Reason != identifier.ReasonKeysUnavailable {
+		t.Fatalf("expected keys unavailable but got: %v", err)
+	}
+}
+
+func TestParseJWTConfigErrors(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		config  string
+		wantErr string
+	}{
+		{
+			note:    "no key set",
+			config:  `{"jwt": {}}`,
+			wantErr: "exactly one of 'jwks_file' or 'jwks_url' must be set",
+		},
+		{
+			note:    "two key sets",
+			config:  `{"jwt": {"jwks_file": "x", "jwks_url": "https://example.com"}}`,
+			wantErr: "exactly one of 'jwks_file' or 'jwks_url' must be set",
+		},
+		{
+			note:    "symmetric algorithm",
+			config:  `{"jwt": {"jwks_file": "x", "algorithms": ["HS256"]}}`,
+			wantErr: `unsupported algorithm "HS256"`,
+		},
+		{
+			note:    "no signature",
+			config:  `{"jwt": {"jwks_file": "x", "algorithms": ["none"]}}`,
+			wantErr: `unsupported algorithm "none"`,
+		},
+		{
+			note:    "invalid refresh",
+			config:  `{"jwt": {"jwks_file": "x", "jwks_refresh_seconds": 0}}`,
+			wantErr: "'jwks_refresh_seconds' must be at least 1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := identifier.ParseConfig([]byte(tc.config))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q but got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
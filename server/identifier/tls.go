@@ -5,7 +5,9 @@
 package identifier
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 )
 
 // TLSBased extracts the CN of the client's TLS ceritificate
@@ -29,3 +31,108 @@ func (h *TLSBased) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	h.inner.ServeHTTP(w, r)
 }
+
+// Sources of the subject of a client certificate identity.
+const (
+	TLSIdentitySubject   = "subject"
+	TLSIdentitySubjectCN = "subject_cn"
+	TLSIdentitySANDNS    = "san_dns"
+	TLSIdentitySANURI    = "san_uri"
+	TLSIdentitySANEmail  = "san_email"
+)
+
+// TLSConfig represents the configuration of the client certificate identity
+// mapping.
+type TLSConfig struct {
+	Identity  string `json:"identity,omitempty"`
+	URIPrefix string `json:"uri_prefix,omitempty"`
+}
+
+func (c *TLSConfig) validateAndInjectDefaults() error {
+
+	switch c.Identity {
+	case "":
+		c.Identity = TLSIdentitySubject
+	case TLSIdentitySubject, TLSIdentitySubjectCN, TLSIdentitySANDNS, TLSIdentitySANURI, TLSIdentitySANEmail:
+	default:
+		return fmt.Errorf("invalid identity %q", c.Identity)
+	}
+
+	if c.URIPrefix != "" && c.Identity != TLSIdentitySANURI {
+		return fmt.Errorf("'uri_prefix' requires identity %q", TLSIdentitySANURI)
+	}
+
+	return nil
+}
+
+// TLSIdentity maps the verified client certificate of a request to claims.
+// The "sub" claim is taken from the configured part of the certificate.
+// Certificates that do not contain it are rejected.
+type TLSIdentity struct {
+	config TLSConfig
+}
+
+// NewTLSIdentity returns a new TLSIdentity authenticator.
+func NewTLSIdentity(config TLSConfig) *TLSIdentity {
+	return &TLSIdentity{config: config}
+}
+
+// Authenticate implements the Authenticator interface.
+func (a *TLSIdentity) Authenticate(r *http.Request) (map[string]interface{}, error) {
+
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+
+	uris := make([]string, len(cert.URIs))
+	for i := range cert.URIs {
+		uris[i] = cert.URIs[i].String()
+	}
+
+	var sub string
+
+	switch a.config.Identity {
+	case TLSIdentitySubject:
+		sub = cert.Subject.ToRDNSequence().String()
+	case TLSIdentitySubjectCN:
+		sub = cert.Subject.CommonName
+	case TLSIdentitySANDNS:
+		sub = first(cert.DNSNames, "")
+	case TLSIdentitySANURI:
+		sub = first(uris, a.config.URIPrefix)
+	case TLSIdentitySANEmail:
+		sub = first(cert.EmailAddresses, "")
+	}
+
+	if sub == "" {
+		return nil, authnError(ReasonMissingIdentity, nil)
+	}
+
+	return map[string]interface{}{
+		"sub":             sub,
+		"subject":         cert.Subject.ToRDNSequence().String(),
+		"common_name":     cert.Subject.CommonName,
+		"dns_names":       stringsToInterfaces(cert.DNSNames),
+		"uris":            stringsToInterfaces(uris),
+		"email_addresses": stringsToInterfaces(cert.EmailAddresses),
+	}, nil
+}
+
+func first(values []string, prefix string) string {
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			return v
+		}
+	}
+	return ""
+}
+
+func stringsToInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i := range values {
+		result[i] = values[i]
+	}
+	return result
+}
@@ -6,6 +6,8 @@ package identifier_test
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -81,3 +83,59 @@ func TestTLSBased(t *testing.T) {
 	}
 
 }
+
+func TestTLSIdentity(t *testing.T) {
+
+	cert, err := tls.LoadX509KeyPair("testdata/cn-cert.pem", "testdata/key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config   string
+		expected string
+		reason   string
+	}{
+		{config: `{}`, expected: "CN=my-client"},
+		{config: `{"identity": "subject_cn"}`, expected: "my-client"},
+		{config: `{"identity": "san_dns"}`, expected: "client.opa.example.com"},
+		{config: `{"identity": "san_uri", "uri_prefix": "spiffe://"}`, reason: identifier.ReasonMissingIdentity},
+		{config: `{"identity": "san_email"}`, reason: identifier.ReasonMissingIdentity},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.config, func(t *testing.T) {
+			config, err := identifier.ParseConfig([]byte(`{"tls": ` + tc.config + `}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/data", nil)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+
+			claims, err := identifier.NewTLSIdentity(*config.TLS).Authenticate(req)
+			if tc.reason != "" {
+				var authnErr *identifier.AuthenticationError
+				if !errors.As(err, &authnErr) || authnErr.Reason != tc.reason {
+					t.Fatalf("expected reason %v but got: %v", tc.reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims["sub"] != tc.expected || claims["common_name"] != "my-client" {
+				t.Fatalf("unexpected claims: %v", claims)
+			}
+		})
+	}
+
+	if _, err := identifier.ParseConfig([]byte(`{"tls": {"identity": "subject", "uri_prefix": "spiffe://"}}`)); err == nil {
+		t.Fatal("expected error for uri_prefix without san_uri identity")
+	}
+}
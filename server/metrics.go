@@ -0,0 +1,200 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/meta-quick/opax/ast"
+	iprom "github.com/meta-quick/opax/internal/prometheus"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/util"
+)
+
+const (
+	defaultMaxPathLabels = 100
+
+	// otherPathLabel is the path label of decisions for paths that exceed
+	// the configured number of path labels or do not refer to policies.
+	otherPathLabel = "_other"
+)
+
+// metricsConfig represents the configuration of the per-path decision
+// metrics.
+type metricsConfig struct {
+	MaxPathLabels *int `json:"max_path_labels,omitempty"` // max number of distinct path label values
+}
+
+func parseMetricsConfig(raw []byte) (*metricsConfig, error) {
+	var c metricsConfig
+
+	if raw != nil {
+		if err := util.Unmarshal(raw, &c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.MaxPathLabels == nil {
+		limit := defaultMaxPathLabels
+		c.MaxPathLabels = &limit
+	} else if *c.MaxPathLabels < 0 {
+		return nil, fmt.Errorf("max_path_labels must be non-negative")
+	}
+
+	return &c, nil
+}
+
+// pathLabels limits the cardinality of path labels. Only paths that refer to
+// packages or rules of the compiled policies are used as label values, so
+// clients cannot use up the labels with requests for arbitrary paths. The
+// first paths seen are used up to the limit, all other paths share a label.
+// The paths are reset when the policies change.
+type pathLabels struct {
+	mtx      sync.Mutex
+	limit    int
+	paths    map[string]struct{}
+	compiler func() *ast.Compiler
+}
+
+func newPathLabels(limit int, compiler func() *ast.Compiler) *pathLabels {
+	return &pathLabels{
+		limit:    limit,
+		paths:    map[string]struct{}{},
+		compiler: compiler,
+	}
+}
+
+func (l *pathLabels) label(path string) string {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if _, ok := l.paths[path]; ok {
+		return path
+	}
+
+	if len(l.paths) >= l.limit || !l.isPolicyPath(path) {
+		return otherPathLabel
+	}
+
+	l.paths[path] = struct{}{}
+	return path
+}
+
+// isPolicyPath returns true if the path refers to a package or rule of the
+// compiled policies.
+func (l *pathLabels) isPolicyPath(path string) bool {
+	compiler := l.compiler()
+	if compiler == nil || compiler.RuleTree == nil {
+		return false
+	}
+
+	node := compiler.RuleTree
+	for _, x := range stringPathToDataRef(path) {
+		if node = node.Child(x.Value); node == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reset removes all paths.
+func (l *pathLabels) reset() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.paths = map[string]struct{}{}
+}
+
+// decisionMetrics records the evaluation latency and outcome of decisions per
+// decision path.
+type decisionMetrics struct {
+	paths     *pathLabels
+	duration  *prometheus.HistogramVec
+	undefined *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+}
+
+func (s *Server) initDecisionMetrics() error {
+
+	var raw []byte
+	if s.manager.Config.Server != nil {
+		raw = s.manager.Config.Server.Metrics
+	}
+
+	config, err := parseMetricsConfig(raw)
+	if err != nil {
+		return fmt.Errorf("invalid server metrics config: %w", err)
+	}
+
+	s.decisionMetrics = &decisionMetrics{
+		paths: newPathLabels(*config.MaxPathLabels, s.getCompiler),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "decision_duration_seconds",
+			Help: "A histogram of the evaluation duration of decisions, by path.",
+			Buckets: []float64{
+				1e-5,
+				5e-5,
+				1e-4,
+				5e-4,
+				1e-3, // 1 millisecond
+				5e-3,
+				0.01,
+				0.05,
+				0.1,
+				0.5,
+				1, // 1 second
+			},
+		}, []string{"path"}),
+		undefined: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "decision_undefined_total",
+			Help: "Number of decisions with undefined results, by path.",
+		}, []string{"path"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "decision_errors_total",
+			Help: "Number of decisions that failed, by path.",
+		}, []string{"path"}),
+	}
+
+	return iprom.Register(s.metrics, s.decisionMetrics.duration, s.decisionMetrics.undefined, s.decisionMetrics.errors)
+}
+
+// reset removes the path labels and the series recorded for them. It is
+// called when the policies change so that the labels of removed policies do
+// not count against the limit.
+func (dm *decisionMetrics) reset() {
+	if dm == nil {
+		return
+	}
+
+	dm.paths.reset()
+	dm.duration.Reset()
+	dm.undefined.Reset()
+	dm.errors.Reset()
+}
+
+// observe records a decision for the path. Decisions of ad-hoc queries are
+// not recorded.
+func (dm *decisionMetrics) observe(path string, result *interface{}, err error, m metrics.Metrics) {
+	if dm == nil || path == "" {
+		return
+	}
+
+	label := dm.paths.label(path)
+
+	switch {
+	case err != nil:
+		dm.errors.WithLabelValues(label).Inc()
+		return
+	case result == nil:
+		dm.undefined.WithLabelValues(label).Inc()
+	}
+
+	if m != nil {
+		dm.duration.WithLabelValues(label).Observe(float64(m.Timer(metrics.RegoQueryEval).Int64()) / 1e9)
+	}
+}
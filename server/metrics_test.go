@@ -0,0 +1,133 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseMetricsConfig(t *testing.T) {
+
+	config, err := parseMetricsConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if *config.MaxPathLabels != defaultMaxPathLabels {
+		t.Fatalf("Expected default max path labels but got %v", *config.MaxPathLabels)
+	}
+
+	config, err = parseMetricsConfig([]byte(`{"max_path_labels": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	} else if *config.MaxPathLabels != 0 {
+		t.Fatalf("Expected no path labels but got %v", *config.MaxPathLabels)
+	}
+
+	if _, err := parseMetricsConfig([]byte(`{"max_path_labels": -1}`)); err == nil {
+		t.Fatal("Expected error for negative max path labels")
+	}
+}
+
+func TestDecisionMetrics(t *testing.T) {
+
+	f := newFixtureWithConfig(t, `{"server": {"metrics": {"max_path_labels": 2}}}`)
+
+	policy := `package test
+
+p = true
+
+q = x {
+	x := input.x
+}
+
+r = 1 {
+	input.conflict
+}
+
+r = 2 {
+	input.conflict
+}`
+
+	if err := f.v1("PUT", "/policies/test", policy, 200, "{}"); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := []tr{
+		// Paths that do not refer to policies do not use up labels.
+		{"GET", "/data/random/x", "", 200, `{}`},
+		{"GET", "/data/test/p", "", 200, `{"result": true}`},
+		{"POST", "/data/test/p", "", 200, `{"result": true}`},
+		{"POST", "/data/test/q", `{"input": {}}`, 200, `{}`},
+		{"POST", "/data/test/q", `{"input": {"x": 1}}`, 200, `{"result": 1}`},
+		// Paths beyond the label limit share a label.
+		{"POST", "/data/test/r", `{"input": {"conflict": true}}`, 500, ""},
+		{"POST", "/data/test/r", `{"input": {}}`, 200, `{}`},
+		// Ad-hoc queries are not recorded.
+		{"GET", "/query?q=data.test.p", "", 200, ""},
+	}
+
+	for _, req := range reqs {
+		if err := f.v1(req.method, req.path, req.body, req.code, req.resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dm := f.server.decisionMetrics
+
+	assertDecisionMetrics(t, dm, []decisionMetricsCase{
+		{"test/p", 2, 0, 0},
+		{"test/q", 2, 1, 0},
+		{otherPathLabel, 2, 2, 1},
+	})
+
+	// The labels and their series are reset when the policies change.
+	if err := f.v1("PUT", "/policies/test2", "package test2\n\ns = true", 200, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.v1("GET", "/data/test2/s", "", 200, `{"result": true}`); err != nil {
+		t.Fatal(err)
+	}
+
+	if dm.duration.DeleteLabelValues("test/p") || dm.undefined.DeleteLabelValues("test/q") || dm.errors.DeleteLabelValues(otherPathLabel) {
+		t.Fatal("Expected series of old paths to be removed")
+	}
+
+	assertDecisionMetrics(t, dm, []decisionMetricsCase{
+		{"test2/s", 1, 0, 0},
+	})
+}
+
+type decisionMetricsCase struct {
+	path      string
+	count     uint64
+	undefined float64
+	errors    float64
+}
+
+func assertDecisionMetrics(t *testing.T, dm *decisionMetrics, cases []decisionMetricsCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		var m dto.Metric
+		if err := dm.duration.WithLabelValues(tc.path).(prometheus.Metric).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+
+		if act := m.GetHistogram().GetSampleCount(); act != tc.count {
+			t.Errorf("Expected %v decisions for %v but got %v", tc.count, tc.path, act)
+		}
+
+		if act := counterValue(t, dm.undefined.WithLabelValues(tc.path)); act != tc.undefined {
+			t.Errorf("Expected %v undefined decisions for %v but got %v", tc.undefined, tc.path, act)
+		}
+
+		if act := counterValue(t, dm.errors.WithLabelValues(tc.path)); act != tc.errors {
+			t.Errorf("Expected %v failed decisions for %v but got %v", tc.errors, tc.path, act)
+		}
+	}
+}
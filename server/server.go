@@ -19,6 +19,8 @@ import (
 	"net/http/pprof"
 	"net/url"
 	"os"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -26,14 +28,18 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc/health"
 
 	"github.com/meta-quick/opax/ast"
 	"github.com/meta-quick/opax/bundle"
+	"github.com/meta-quick/opax/datafilter/elasticsearch"
+	"github.com/meta-quick/opax/datafilter/sql"
 	"github.com/meta-quick/opax/internal/json/patch"
 	"github.com/meta-quick/opax/metrics"
 	"github.com/meta-quick/opax/plugins"
@@ -45,6 +51,7 @@ import (
 	"github.com/meta-quick/opax/server/types"
 	"github.com/meta-quick/opax/server/writer"
 	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
 	"github.com/meta-quick/opax/topdown"
 	iCache "github.com/meta-quick/opax/topdown/cache"
 	"github.com/meta-quick/opax/topdown/lineage"
@@ -62,6 +69,8 @@ const (
 	AuthenticationOff AuthenticationScheme = iota
 	AuthenticationToken
 	AuthenticationTLS
+	AuthenticationJWT
+	AuthenticationAPIKey
 )
 
 var supportedTLSVersions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
@@ -82,11 +91,13 @@ const defaultMinTLSVersion = tls.VersionTLS12
 const (
 	PromHandlerV0Data     = "v0/data"
 	PromHandlerV1Data     = "v1/data"
+	PromHandlerV1Batch    = "v1/batch"
 	PromHandlerV1Query    = "v1/query"
 	PromHandlerV1Policies = "v1/policies"
 	PromHandlerV1Compile  = "v1/compile"
 	PromHandlerV1Config   = "v1/config"
 	PromHandlerV1Status   = "v1/status"
+	PromHandlerV1Watch    = "v1/watch"
 	PromHandlerIndex      = "index"
 	PromHandlerCatch      = "catchall"
 	PromHandlerHealth     = "health"
@@ -94,6 +105,16 @@ const (
 
 const pqMaxCacheSize = 100
 
+// defaultMaxBatchInputs is the default maximum number of inputs of a batch
+// Data API request.
+const defaultMaxBatchInputs = 1000
+
+// Names of the metrics reported for batch Data API requests.
+const (
+	serverBatchItems  = "server_batch_items"
+	serverBatchErrors = "server_batch_errors"
+)
+
 // OpenTelemetry attributes
 const otelDecisionIDAttr = "opa.decision_id"
 
@@ -108,6 +129,7 @@ type Server struct {
 	router                 *mux.Router
 	addrs                  []string
 	diagAddrs              []string
+	grpcAddrs              []string
 	h2cEnabled             bool
 	authentication         AuthenticationScheme
 	authorization          AuthorizationScheme
@@ -134,8 +156,25 @@ type Server struct {
 	metrics                Metrics
 	defaultDecisionPath    string
 	interQueryBuiltinCache iCache.InterQueryCache
+	budget                 *topdown.Budget
+	maxBatchInputs         int
 	allPluginsOkOnce       bool
 	distributedTracingOpts tracing.Options
+	grpcAuth               http.Handler
+	grpcHealth             *health.Server
+	watchMtx               sync.Mutex
+	watchers               map[chan struct{}]struct{}
+	watchEpoch             string
+	watchSeq               uint64
+	watchHistory           []watchChange
+	watchDone              chan struct{}
+	decisionMetrics        *decisionMetrics
+	shadowInFlight         int32 // number of running shadow evaluations
+	shadowMtx              sync.Mutex
+	shadowCompiler         *ast.Compiler // compiler the cached shadow queries were prepared with
+	shadowQueries          *cache
+	shadowEvals            *prometheus.CounterVec
+	shadowDivergences      *prometheus.CounterVec
 }
 
 // Metrics defines the interface that the server requires for recording HTTP
@@ -158,8 +197,14 @@ func New() *Server {
 // from s.Listeners().
 func (s *Server) Init(ctx context.Context) (*Server, error) {
 	s.initRouters()
-	s.Handler = s.initHandlerAuth(s.Handler)
-	s.DiagnosticHandler = s.initHandlerAuth(s.DiagnosticHandler)
+
+	authenticator, err := s.initAuthenticator()
+	if err != nil {
+		return nil, err
+	}
+
+	s.Handler = s.initHandlerAuth(s.Handler, authenticator)
+	s.DiagnosticHandler = s.initHandlerAuth(s.DiagnosticHandler, authenticator)
 
 	txn, err := s.store.NewTransaction(ctx, storage.WriteParams)
 	if err != nil {
@@ -182,6 +227,41 @@ func (s *Server) Init(ctx context.Context) (*Server, error) {
 	s.interQueryBuiltinCache = iCache.NewInterQueryCache(s.manager.InterQueryBuiltinCacheConfig())
 	s.manager.RegisterCacheTrigger(s.updateCacheConfig)
 
+	var budgetConfig []byte
+	if s.manager.Config.Server != nil {
+		budgetConfig = s.manager.Config.Server.Budget
+	}
+
+	s.budget, err = topdown.ParseBudgetConfig(budgetConfig)
+	if err != nil {
+		s.store.Abort(ctx, txn)
+		return nil, err
+	}
+
+	var batchConfig []byte
+	if s.manager.Config.Server != nil {
+		batchConfig = s.manager.Config.Server.Batch
+	}
+
+	s.maxBatchInputs, err = parseMaxBatchInputs(batchConfig)
+	if err != nil {
+		s.store.Abort(ctx, txn)
+		return nil, err
+	}
+
+	if err := s.initDecisionMetrics(); err != nil {
+		s.store.Abort(ctx, txn)
+		return nil, err
+	}
+
+	if err := s.initShadow(); err != nil {
+		s.store.Abort(ctx, txn)
+		return nil, err
+	}
+
+	s.initGRPC(authenticator)
+	s.initWatch()
+
 	return s, s.store.Commit(ctx, txn)
 }
 
@@ -189,6 +269,7 @@ func (s *Server) Init(ctx context.Context) (*Server, error) {
 // currently in use by the OPA Server. If any exceed the deadline specified
 // by the context an error will be returned.
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeWatch()
 	errChan := make(chan error)
 	for _, srvr := range s.httpListeners {
 		go func(s httpListener) {
@@ -227,6 +308,13 @@ func (s *Server) WithDiagnosticAddresses(addrs []string) *Server {
 	return s
 }
 
+// WithGRPCAddresses sets the listening addresses that the server will bind to
+// and serve the gRPC decision API on.
+func (s *Server) WithGRPCAddresses(addrs []string) *Server {
+	s.grpcAddrs = addrs
+	return s
+}
+
 // WithAuthentication sets authentication scheme to use on the server.
 func (s *Server) WithAuthentication(scheme AuthenticationScheme) *Server {
 	s.authentication = scheme
@@ -370,6 +458,15 @@ func (s *Server) Listeners() ([]Loop, error) {
 		}
 	}
 
+	for _, addr := range s.grpcAddrs {
+		l, listener, err := s.getGRPCListener(addr)
+		if err != nil {
+			return nil, err
+		}
+		s.httpListeners = append(s.httpListeners, listener)
+		loops = append(loops, l...)
+	}
+
 	return loops, nil
 }
 
@@ -386,6 +483,13 @@ func (s *Server) DiagnosticAddrs() []string {
 	return s.addrsForType(diagnosticListenerType)
 }
 
+// GRPCAddrs returns a list of addresses that the server is listening on for
+// the gRPC decision API.
+// If the server hasn't been started it will not return an address.
+func (s *Server) GRPCAddrs() []string {
+	return s.addrsForType(grpcListenerType)
+}
+
 func (s *Server) addrsForType(t httpListenerType) []string {
 	var addrs []string
 	for _, l := range s.httpListeners {
@@ -422,6 +526,7 @@ type httpListenerType int
 const (
 	defaultListenerType httpListenerType = iota
 	diagnosticListenerType
+	grpcListenerType
 )
 
 type httpListener interface {
@@ -574,21 +679,9 @@ func (s *Server) getListenerForHTTPSServer(u *url.URL, h http.Handler, t httpLis
 	}
 
 	httpsServer := http.Server{
-		Addr:    u.Host,
-		Handler: h,
-		TLSConfig: &tls.Config{
-			GetCertificate: s.getCertificate,
-			ClientCAs:      s.certPool,
-		},
-	}
-	if s.authentication == AuthenticationTLS {
-		httpsServer.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
-	}
-
-	if s.minTLSVersion != 0 {
-		httpsServer.TLSConfig.MinVersion = s.minTLSVersion
-	} else {
-		httpsServer.TLSConfig.MinVersion = defaultMinTLSVersion
+		Addr:      u.Host,
+		Handler:   h,
+		TLSConfig: s.tlsConfig(),
 	}
 
 	l := newHTTPListener(&httpsServer, t)
@@ -598,6 +691,24 @@ func (s *Server) getListenerForHTTPSServer(u *url.URL, h http.Handler, t httpLis
 	return httpsLoop, l, nil
 }
 
+// tlsConfig returns the TLS configuration of the HTTPS and gRPC listeners.
+func (s *Server) tlsConfig() *tls.Config {
+	config := &tls.Config{
+		GetCertificate: s.getCertificate,
+		ClientCAs:      s.certPool,
+	}
+	if s.authentication == AuthenticationTLS {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if s.minTLSVersion != 0 {
+		config.MinVersion = s.minTLSVersion
+	} else {
+		config.MinVersion = defaultMinTLSVersion
+	}
+	return config
+}
+
 func (s *Server) getListenerForUNIXSocket(u *url.URL, h http.Handler, t httpListenerType) (Loop, httpListener, error) {
 	socketPath := u.Host + u.Path
 
@@ -621,7 +732,42 @@ func (s *Server) getListenerForUNIXSocket(u *url.URL, h http.Handler, t httpList
 	return domainSocketLoop, l, nil
 }
 
-func (s *Server) initHandlerAuth(handler http.Handler) http.Handler {
+// initAuthenticator returns the authenticator for the built-in authentication
+// schemes configured in the server authentication config. If nil is returned,
+// the legacy identifiers are used.
+func (s *Server) initAuthenticator() (identifier.Authenticator, error) {
+
+	var raw []byte
+	if s.manager.Config.Server != nil {
+		raw = s.manager.Config.Server.Authentication
+	}
+
+	config, err := identifier.ParseConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.authentication {
+	case AuthenticationJWT:
+		if config.JWT == nil {
+			return nil, errors.New("jwt authentication requires server.authentication.jwt configuration")
+		}
+		return identifier.NewJWT(*config.JWT)
+	case AuthenticationAPIKey:
+		if config.APIKeys == nil {
+			return nil, errors.New("apikey authentication requires server.authentication.api_keys configuration")
+		}
+		return identifier.NewAPIKeys(*config.APIKeys)
+	case AuthenticationTLS:
+		if config.TLS != nil {
+			return identifier.NewTLSIdentity(*config.TLS), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *Server) initHandlerAuth(handler http.Handler, authenticator identifier.Authenticator) http.Handler {
 	// Add authorization handler. This must come BEFORE authentication handler
 	// so that the latter can run first.
 	switch s.authorization {
@@ -637,6 +783,14 @@ func (s *Server) initHandlerAuth(handler http.Handler) http.Handler {
 			authorizer.InterQueryCache(s.interQueryBuiltinCache))
 	}
 
+	if authenticator != nil {
+		var opts []func(*identifier.Authenticated)
+		if m, ok := s.metrics.(metrics.Metrics); ok {
+			opts = append(opts, identifier.Metrics(m))
+		}
+		return identifier.NewAuthenticated(handler, authenticator, opts...)
+	}
+
 	switch s.authentication {
 	case AuthenticationToken:
 		handler = identifier.NewTokenBased(handler)
@@ -698,6 +852,8 @@ func (s *Server) initRouters() {
 	s.registerHandler(mainRouter, 1, "/data", http.MethodPatch, s.instrumentHandler(s.v1DataPatch, PromHandlerV1Data))
 	s.registerHandler(mainRouter, 1, "/data/{path:.+}", http.MethodPost, s.instrumentHandler(s.v1DataPost, PromHandlerV1Data))
 	s.registerHandler(mainRouter, 1, "/data", http.MethodPost, s.instrumentHandler(s.v1DataPost, PromHandlerV1Data))
+	s.registerHandler(mainRouter, 1, "/batch/data/{path:.+}", http.MethodPost, s.instrumentHandler(s.v1BatchDataPost, PromHandlerV1Batch))
+	s.registerHandler(mainRouter, 1, "/batch/data", http.MethodPost, s.instrumentHandler(s.v1BatchDataPost, PromHandlerV1Batch))
 	s.registerHandler(mainRouter, 1, "/policies", http.MethodGet, s.instrumentHandler(s.v1PoliciesList, PromHandlerV1Policies))
 	s.registerHandler(mainRouter, 1, "/policies/{path:.+}", http.MethodDelete, s.instrumentHandler(s.v1PoliciesDelete, PromHandlerV1Policies))
 	s.registerHandler(mainRouter, 1, "/policies/{path:.+}", http.MethodGet, s.instrumentHandler(s.v1PoliciesGet, PromHandlerV1Policies))
@@ -707,6 +863,7 @@ func (s *Server) initRouters() {
 	s.registerHandler(mainRouter, 1, "/compile", http.MethodPost, s.instrumentHandler(s.v1CompilePost, PromHandlerV1Compile))
 	s.registerHandler(mainRouter, 1, "/config", http.MethodGet, s.instrumentHandler(s.v1ConfigGet, PromHandlerV1Config))
 	s.registerHandler(mainRouter, 1, "/status", http.MethodGet, s.instrumentHandler(s.v1StatusGet, PromHandlerV1Status))
+	s.registerHandler(mainRouter, 1, "/watch", http.MethodGet, s.instrumentHandler(s.v1WatchGet, PromHandlerV1Watch))
 	mainRouter.Handle("/", s.instrumentHandler(s.unversionedPost, PromHandlerIndex)).Methods(http.MethodPost)
 	mainRouter.Handle("/", s.instrumentHandler(s.indexGet, PromHandlerIndex)).Methods(http.MethodGet)
 
@@ -779,6 +936,7 @@ func (s *Server) execQuery(ctx context.Context, r *http.Request, br bundleRevisi
 		rego.Runtime(s.runtime),
 		rego.UnsafeBuiltins(unsafeBuiltinsMap),
 		rego.InterQueryBuiltinCache(s.interQueryBuiltinCache),
+		rego.Budget(s.budget),
 		rego.PrintHook(s.manager.PrintHook()),
 		rego.EnablePrintStatements(s.manager.EnablePrintStatements()),
 		rego.DistributedTracingOpts(s.distributedTracingOpts),
@@ -881,6 +1039,13 @@ func (s *Server) reload(ctx context.Context, txn storage.Transaction, event stor
 	s.partials = map[string]rego.PartialResult{}
 	s.preparedEvalQueries = newCache(pqMaxCacheSize)
 	s.defaultDecisionPath = s.generateDefaultDecisionPath()
+
+	if event.PolicyChanged() {
+		s.decisionMetrics.reset()
+	}
+
+	s.recordWatchChange(event)
+	s.notifyWatchers()
 }
 
 func (s *Server) unversionedPost(w http.ResponseWriter, r *http.Request) {
@@ -975,6 +1140,7 @@ func (s *Server) v0QueryPath(w http.ResponseWriter, r *http.Request, urlPath str
 		rego.EvalParsedInput(input),
 		rego.EvalMetrics(m),
 		rego.EvalInterQueryBuiltinCache(s.interQueryBuiltinCache),
+		rego.EvalBudget(s.budget),
 	}
 
 	rs, err := preparedQuery.Eval(
@@ -1235,23 +1401,7 @@ func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
 		buf = topdown.NewBufferTracer()
 	}
 
-	eval := rego.New(
-		rego.Compiler(s.getCompiler()),
-		rego.Store(s.store),
-		rego.Transaction(txn),
-		rego.ParsedQuery(request.Query),
-		rego.ParsedInput(request.Input),
-		rego.ParsedUnknowns(request.Unknowns),
-		rego.QueryTracer(buf),
-		rego.Instrument(includeInstrumentation),
-		rego.Metrics(m),
-		rego.Runtime(s.runtime),
-		rego.UnsafeBuiltins(unsafeBuiltinsMap),
-		rego.InterQueryBuiltinCache(s.interQueryBuiltinCache),
-		rego.PrintHook(s.manager.PrintHook()),
-	)
-
-	pq, err := eval.Partial(ctx)
+	pq, err := s.partialEval(ctx, txn, request, m, includeInstrumentation, buf)
 	if err != nil {
 		switch err := err.(type) {
 		case ast.Errors:
@@ -1279,11 +1429,41 @@ func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
 		Support: pq.Support,
 	}
 
+	if request.Target != nil {
+		i, err = translateCompileResult(request.Target, pq)
+		if err != nil {
+			writer.Error(w, http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, "error(s) occurred while translating partial evaluation result: %v", err))
+			return
+		}
+	}
+
 	result.Result = &i
 
 	writer.JSON(w, http.StatusOK, result, pretty)
 }
 
+// partialEval partially evaluates the query of a compile request.
+func (s *Server) partialEval(ctx context.Context, txn storage.Transaction, request *compileRequest, m metrics.Metrics, instrument bool, tracer topdown.QueryTracer) (*rego.PartialQueries, error) {
+	eval := rego.New(
+		rego.Compiler(s.getCompiler()),
+		rego.Store(s.store),
+		rego.Transaction(txn),
+		rego.ParsedQuery(request.Query),
+		rego.ParsedInput(request.Input),
+		rego.ParsedUnknowns(request.Unknowns),
+		rego.QueryTracer(tracer),
+		rego.Instrument(instrument),
+		rego.Metrics(m),
+		rego.Runtime(s.runtime),
+		rego.UnsafeBuiltins(unsafeBuiltinsMap),
+		rego.InterQueryBuiltinCache(s.interQueryBuiltinCache),
+		rego.Budget(s.budget),
+		rego.PrintHook(s.manager.PrintHook()),
+	)
+
+	return eval.Partial(ctx)
+}
+
 func (s *Server) v1DataGet(w http.ResponseWriter, r *http.Request) {
 	m := metrics.New()
 
@@ -1393,6 +1573,7 @@ func (s *Server) v1DataGet(w http.ResponseWriter, r *http.Request) {
 		rego.EvalMetrics(m),
 		rego.EvalQueryTracer(buf),
 		rego.EvalInterQueryBuiltinCache(s.interQueryBuiltinCache),
+		rego.EvalBudget(s.budget),
 		rego.EvalInstrument(includeInstrumentation),
 	}
 
@@ -1435,6 +1616,7 @@ func (s *Server) v1DataGet(w http.ResponseWriter, r *http.Request) {
 			writer.ErrorAuto(w, err)
 			return
 		}
+		s.shadowEval(logger, decisionID, r.RemoteAddr, urlPath, goInput, input, nil)
 		writer.JSON(w, http.StatusOK, result, pretty)
 		return
 	}
@@ -1450,6 +1632,7 @@ func (s *Server) v1DataGet(w http.ResponseWriter, r *http.Request) {
 		writer.ErrorAuto(w, err)
 		return
 	}
+	s.shadowEval(logger, decisionID, r.RemoteAddr, urlPath, goInput, input, result.Result)
 	writer.JSON(w, http.StatusOK, result, pretty)
 }
 
@@ -1608,6 +1791,7 @@ func (s *Server) v1DataPost(w http.ResponseWriter, r *http.Request) {
 		rego.EvalMetrics(m),
 		rego.EvalQueryTracer(buf),
 		rego.EvalInterQueryBuiltinCache(s.interQueryBuiltinCache),
+		rego.EvalBudget(s.budget),
 		rego.EvalInstrument(includeInstrumentation),
 	}
 
@@ -1650,6 +1834,7 @@ func (s *Server) v1DataPost(w http.ResponseWriter, r *http.Request) {
 			writer.ErrorAuto(w, err)
 			return
 		}
+		s.shadowEval(logger, decisionID, r.RemoteAddr, urlPath, goInput, input, nil)
 		writer.JSON(w, http.StatusOK, result, pretty)
 		return
 	}
@@ -1665,9 +1850,234 @@ func (s *Server) v1DataPost(w http.ResponseWriter, r *http.Request) {
 		writer.ErrorAuto(w, err)
 		return
 	}
+	s.shadowEval(logger, decisionID, r.RemoteAddr, urlPath, goInput, input, result.Result)
 	writer.JSON(w, http.StatusOK, result, pretty)
 }
 
+func (s *Server) v1BatchDataPost(w http.ResponseWriter, r *http.Request) {
+	m := metrics.New()
+	m.Timer(metrics.ServerHandler).Start()
+
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	urlPath := vars["path"]
+	pretty := getBoolParam(r.URL, types.ParamPrettyV1, true)
+	includeMetrics := getBoolParam(r.URL, types.ParamMetricsV1, true)
+	partial := getBoolParam(r.URL, types.ParamPartialV1, true)
+	provenance := getBoolParam(r.URL, types.ParamProvenanceV1, true)
+	strictBuiltinErrors := getBoolParam(r.URL, types.ParamStrictBuiltinErrors, true)
+
+	parallelism, err := getParallelism(r.URL)
+	if err != nil {
+		writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		return
+	}
+
+	m.Timer(metrics.RegoInputParse).Start()
+
+	inputs, err := readBatchInputsPostV1(r)
+	if err != nil {
+		writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		return
+	}
+
+	if err := s.checkBatchSize(len(inputs)); err != nil {
+		writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		return
+	}
+
+	m.Timer(metrics.RegoInputParse).Stop()
+	m.Counter(serverBatchItems).Add(uint64(len(inputs)))
+
+	txn, err := s.store.NewTransaction(ctx)
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
+	defer s.store.Abort(ctx, txn)
+
+	br, err := getRevisions(ctx, s.store, txn)
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
+	logger := s.getDecisionLogger(br)
+
+	preparedQuery, err := s.prepareDataQuery(ctx, txn, urlPath, partial, strictBuiltinErrors, m)
+	if err != nil {
+		// The error applies to every item, log the decisions before
+		// failing the whole request.
+		for _, input := range inputs {
+			_ = logger.Log(ctx, txn, s.generateDecisionID(), r.RemoteAddr, urlPath, "", input.goInput, input.value, nil, err, metrics.New())
+		}
+		writer.ErrorAuto(w, err)
+		return
+	}
+
+	ids, responses, logErrs := s.evalBatch(ctx, txn, preparedQuery, logger, r.RemoteAddr, urlPath, inputs, parallelism, includeMetrics)
+
+	// Decisions that could not be logged must not be returned, as for the
+	// single decision endpoint.
+	for _, err := range logErrs {
+		if err != nil {
+			writer.ErrorAuto(w, err)
+			return
+		}
+	}
+
+	result := types.BatchDataResponseV1{
+		Responses: make(map[string]types.BatchDataItemResponseV1, len(ids)),
+	}
+
+	status := http.StatusOK
+	for i, id := range ids {
+		result.Responses[id] = responses[i]
+		if responses[i].Error != nil {
+			m.Counter(serverBatchErrors).Incr()
+			status = http.StatusMultiStatus
+		}
+	}
+
+	if provenance {
+		result.Provenance = s.getProvenance(br)
+	}
+
+	m.Timer(metrics.ServerHandler).Stop()
+
+	if includeMetrics {
+		result.Metrics = m.All()
+	}
+
+	writer.JSON(w, status, result, pretty)
+}
+
+// prepareDataQuery returns the prepared query that evaluates the document at
+// urlPath for the batch Data API and the gRPC decision API. The prepared
+// query is shared with the single decision endpoint.
+func (s *Server) prepareDataQuery(ctx context.Context, txn storage.Transaction, urlPath string, partial, strictBuiltinErrors bool, m metrics.Metrics) (*rego.PreparedEvalQuery, error) {
+	pqID := "v1DataPost::"
+	if partial {
+		pqID += "partial::"
+	}
+	if strictBuiltinErrors {
+		pqID += "strict-builtin-errors::"
+	}
+	pqID += urlPath
+	if preparedQuery, ok := s.getCachedPreparedEvalQuery(pqID, m); ok {
+		return preparedQuery, nil
+	}
+
+	opts := []func(*rego.Rego){
+		rego.Compiler(s.getCompiler()),
+		rego.Store(s.store),
+	}
+
+	for _, r := range s.manager.GetWasmResolvers() {
+		for _, entrypoint := range r.Entrypoints() {
+			opts = append(opts, rego.Resolver(entrypoint, r))
+		}
+	}
+
+	rego, err := s.makeRego(ctx, partial, strictBuiltinErrors, txn, nil, urlPath, m, false, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pq, err := rego.PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.preparedEvalQueries.Insert(pqID, &pq)
+	return &pq, nil
+}
+
+// evalBatch evaluates the prepared query for each of the inputs and logs the
+// decisions. The responses and decision logging errors are returned in the
+// order of the returned input IDs.
+func (s *Server) evalBatch(ctx context.Context, txn storage.Transaction, preparedQuery *rego.PreparedEvalQuery, logger decisionLogger, remoteAddr, urlPath string, inputs map[string]batchInput, parallelism int, includeMetrics bool) ([]string, []types.BatchDataItemResponseV1, []error) {
+
+	ids := make([]string, 0, len(inputs))
+	for id := range inputs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	responses := make([]types.BatchDataItemResponseV1, len(ids))
+	logErrs := make([]error, len(ids))
+
+	eval := func(i int) {
+		input := inputs[ids[i]]
+		decisionID := s.generateDecisionID()
+
+		im := metrics.New()
+		im.Timer(metrics.ServerHandler).Start()
+
+		rs, err := preparedQuery.Eval(
+			ctx,
+			rego.EvalTransaction(txn),
+			rego.EvalParsedInput(input.value),
+			rego.EvalMetrics(im),
+			rego.EvalInterQueryBuiltinCache(s.interQueryBuiltinCache),
+			rego.EvalBudget(s.budget),
+		)
+
+		im.Timer(metrics.ServerHandler).Stop()
+
+		resp := types.BatchDataItemResponseV1{DecisionID: decisionID}
+
+		if err != nil {
+			resp.Error = batchItemError(err)
+		} else if len(rs) > 0 {
+			resp.Result = &rs[0].Expressions[0].Value
+		}
+
+		if includeMetrics {
+			resp.Metrics = im.All()
+		}
+
+		logErrs[i] = logger.Log(ctx, txn, decisionID, remoteAddr, urlPath, "", input.goInput, input.value, resp.Result, err, im)
+		responses[i] = resp
+	}
+
+	if parallelism > len(ids) {
+		parallelism = len(ids)
+	}
+
+	// The inputs share the read transaction, which only in-memory stores
+	// allow to be used concurrently.
+	if !inmem.IsInMem(s.store) {
+		parallelism = 1
+	}
+
+	if parallelism <= 1 {
+		for i := range ids {
+			eval(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		next := make(chan int)
+		for n := 0; n < parallelism; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					eval(i)
+				}
+			}()
+		}
+		for i := range ids {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+	}
+
+	return ids, responses, logErrs
+}
+
 func (s *Server) v1DataPut(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
@@ -2275,6 +2685,7 @@ func (s *Server) getDecisionLogger(br bundleRevisions) (logger decisionLogger) {
 		logger.revisions = br.Revisions
 	}
 	logger.logger = s.logger
+	logger.metrics = s.decisionMetrics
 	return logger
 }
 
@@ -2524,6 +2935,19 @@ func stringPathToRef(s string) (r ast.Ref) {
 	return r
 }
 
+// batchItemError returns the error response for an input of a batch request
+// that failed to evaluate.
+func batchItemError(err error) *types.ErrorV1 {
+	switch {
+	case topdown.IsError(err):
+		return types.NewErrorV1(types.CodeInternal, types.MsgEvaluationError).WithError(err)
+	case types.IsBadRequest(err):
+		return types.NewErrorV1(types.CodeInvalidParameter, err.Error())
+	default:
+		return types.NewErrorV1(types.CodeInternal, err.Error())
+	}
+}
+
 func validateQuery(query string) (ast.Body, error) {
 
 	var body ast.Body
@@ -2622,6 +3046,119 @@ func readInputGetV1(str string) (ast.Value, error) {
 	return ast.InterfaceToValue(input)
 }
 
+type batchInput struct {
+	value   ast.Value
+	goInput *interface{}
+}
+
+func readBatchInputsPostV1(r *http.Request) (map[string]batchInput, error) {
+
+	var request types.BatchDataRequestV1
+
+	if parsed, ok := authorizer.GetBodyOnContext(r.Context()); ok {
+		obj, ok := parsed.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("body must be an object")
+		}
+		if inputs, ok := obj["inputs"].(map[string]interface{}); ok {
+			request.Inputs = make(map[string]*interface{}, len(inputs))
+			for id := range inputs {
+				v := inputs[id]
+				request.Inputs[id] = &v
+			}
+		}
+	} else {
+		bs, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.Contains(r.Header.Get("Content-Type"), "yaml") {
+			if err := util.Unmarshal(bs, &request); err != nil {
+				return nil, errors.Wrapf(err, "body contains malformed batch request")
+			}
+		} else if err := util.UnmarshalJSON(bs, &request); err != nil {
+			return nil, errors.Wrapf(err, "body contains malformed batch request")
+		}
+	}
+
+	if len(request.Inputs) == 0 {
+		return nil, errors.New("batch request must contain at least one input")
+	}
+
+	result := make(map[string]batchInput, len(request.Inputs))
+
+	for id, input := range request.Inputs {
+		if input == nil {
+			result[id] = batchInput{}
+			continue
+		}
+		value, err := ast.InterfaceToValue(*input)
+		if err != nil {
+			return nil, errors.Wrapf(err, "input %q", id)
+		}
+		result[id] = batchInput{value: value, goInput: input}
+	}
+
+	return result, nil
+}
+
+func getParallelism(url *url.URL) (int, error) {
+	p := url.Query().Get(types.ParamParallelismV1)
+	if p == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(p)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %v parameter %q", types.ParamParallelismV1, p)
+	}
+	return limitParallelism(n), nil
+}
+
+// batchConfig represents the configuration of the batch Data API.
+type batchConfig struct {
+	MaxInputs *int `json:"max_inputs,omitempty"` // max number of inputs of a batch request
+}
+
+func parseMaxBatchInputs(raw []byte) (int, error) {
+	var c batchConfig
+
+	if raw != nil {
+		if err := util.Unmarshal(raw, &c); err != nil {
+			return 0, fmt.Errorf("invalid server batch config: %w", err)
+		}
+	}
+
+	if c.MaxInputs == nil {
+		return defaultMaxBatchInputs, nil
+	} else if *c.MaxInputs < 1 {
+		return 0, fmt.Errorf("invalid server batch config: max_inputs must be positive")
+	}
+
+	return *c.MaxInputs, nil
+}
+
+// checkBatchSize returns an error if a batch request has more inputs than
+// allowed.
+func (s *Server) checkBatchSize(n int) error {
+	if n > s.maxBatchInputs {
+		return fmt.Errorf("batch request contains %d inputs (limit: %d)", n, s.maxBatchInputs)
+	}
+	return nil
+}
+
+// limitParallelism caps the number of inputs of a batch request that are
+// evaluated concurrently at the number of usable CPUs.
+func limitParallelism(n int) int {
+	if n < 1 {
+		return 1
+	}
+	if procs := runtime.GOMAXPROCS(0); n > procs {
+		return procs
+	}
+	return n
+}
+
 func readInputPostV1(r *http.Request) (ast.Value, error) {
 
 	parsed, ok := authorizer.GetBodyOnContext(r.Context())
@@ -2670,6 +3207,7 @@ type compileRequest struct {
 	Query    ast.Body
 	Input    ast.Value
 	Unknowns []*ast.Term
+	Target   *types.CompileTargetV1
 }
 
 func readInputCompilePostV1(r io.ReadCloser) (*compileRequest, *types.ErrorV1) {
@@ -2712,15 +3250,41 @@ func readInputCompilePostV1(r io.ReadCloser) (*compileRequest, *types.ErrorV1) {
 		}
 	}
 
+	if request.Target != nil {
+		switch request.Target.Type {
+		case types.CompileTargetSQLV1:
+			if request.Target.SQL == nil {
+				return nil, types.NewErrorV1(types.CodeInvalidParameter, "missing required 'target.sql' value")
+			}
+		case types.CompileTargetElasticsearchV1:
+			if request.Target.Elasticsearch == nil {
+				return nil, types.NewErrorV1(types.CodeInvalidParameter, "missing required 'target.elasticsearch' value")
+			}
+		default:
+			return nil, types.NewErrorV1(types.CodeInvalidParameter, "unsupported compile target %q", request.Target.Type)
+		}
+	}
+
 	result := &compileRequest{
 		Query:    query,
 		Input:    input,
 		Unknowns: unknowns,
+		Target:   request.Target,
 	}
 
 	return result, nil
 }
 
+func translateCompileResult(target *types.CompileTargetV1, pq *rego.PartialQueries) (interface{}, error) {
+	switch target.Type {
+	case types.CompileTargetSQLV1:
+		return sql.Translate(pq, *target.SQL)
+	case types.CompileTargetElasticsearchV1:
+		return elasticsearch.Translate(pq, *target.Elasticsearch)
+	}
+	return nil, fmt.Errorf("unsupported compile target %q", target.Type)
+}
+
 var indexHTML, _ = template.New("index").Parse(`
 <html>
 <head>
@@ -2782,10 +3346,13 @@ type decisionLogger struct {
 	revisions map[string]string
 	revision  string // Deprecated: Use `revisions` instead.
 	logger    func(context.Context, *Info) error
+	metrics   *decisionMetrics
 }
 
 func (l decisionLogger) Log(ctx context.Context, txn storage.Transaction, decisionID, remoteAddr, path string, query string, goInput *interface{}, astInput ast.Value, goResults *interface{}, err error, m metrics.Metrics) error {
 
+	l.metrics.observe(path, goResults, err, m)
+
 	bundles := map[string]BundleInfo{}
 	for name, rev := range l.revisions {
 		bundles[name] = BundleInfo{Revision: rev}
@@ -2816,6 +3383,37 @@ func (l decisionLogger) Log(ctx context.Context, txn storage.Transaction, decisi
 	return nil
 }
 
+// LogDivergence logs an event for a decision whose shadow evaluation diverged.
+// The event has its own decision ID, the ID of the diverging decision is part
+// of the divergence. The event does not include the input, it is identified by
+// its hash.
+func (l decisionLogger) LogDivergence(ctx context.Context, decisionID, remoteAddr, path string, goResults *interface{}, divergence *DivergenceInfo) error {
+
+	bundles := map[string]BundleInfo{}
+	for name, rev := range l.revisions {
+		bundles[name] = BundleInfo{Revision: rev}
+	}
+
+	info := &Info{
+		Revision:   l.revision,
+		Bundles:    bundles,
+		Timestamp:  time.Now().UTC(),
+		DecisionID: decisionID,
+		RemoteAddr: remoteAddr,
+		Path:       path,
+		Results:    goResults,
+		Divergence: divergence,
+	}
+
+	if l.logger != nil {
+		if err := l.logger(ctx, info); err != nil {
+			return errors.Wrap(err, "decision_logs")
+		}
+	}
+
+	return nil
+}
+
 type patchImpl struct {
 	path  storage.Path
 	op    storage.PatchOp
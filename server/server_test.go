@@ -8,14 +8,18 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -958,6 +962,109 @@ func TestCompileV1(t *testing.T) {
 	}
 }
 
+func TestCompileV1SQLTarget(t *testing.T) {
+
+	mod := `package filters
+
+	allow { input.document.owner = input.subject }
+	allow { input.document.public = true }
+
+	deny { contains(input.document.path, "x") }
+	`
+
+	target := `"target": {
+		"type": "sql",
+		"sql": {
+			"dialect": "postgres",
+			"tables": [{"name": "documents", "unknown": "input.document"}]
+		}
+	}`
+
+	tests := []struct {
+		note string
+		trs  []tr
+	}{
+		{
+			note: "translated",
+			trs: []tr{
+				{http.MethodPut, "/policies/test", mod, 200, ""},
+				{http.MethodPost, "/compile", `{
+					"unknowns": ["input.document"],
+					"input": {"subject": "alice"},
+					"query": "data.filters.allow = true",
+					` + target + `
+				}`, 200, `{"result": {
+					"where": "(\"documents\".\"owner\" = $1) OR (\"documents\".\"public\" = $2)",
+					"args": ["alice", true]
+				}}`},
+			},
+		},
+		{
+			note: "error: unsupported construct",
+			trs: []tr{
+				{http.MethodPut, "/policies/test", mod, 200, ""},
+				{http.MethodPost, "/compile", `{
+					"unknowns": ["input.document"],
+					"query": "data.filters.deny = true",
+					` + target + `
+				}`, 400, `{
+					"code": "invalid_parameter",
+					"message": "error(s) occurred while translating partial evaluation result: test:6: datafilter_unsupported_error: built-in function contains cannot be translated"
+				}`},
+			},
+		},
+		{
+			note: "error: unknown target",
+			trs: []tr{
+				{http.MethodPost, "/compile", `{"query": "input.x = 1", "target": {"type": "cobol"}}`, 400, `{
+					"code": "invalid_parameter",
+					"message": "unsupported compile target \"cobol\""
+				}`},
+			},
+		},
+		{
+			note: "error: missing options",
+			trs: []tr{
+				{http.MethodPost, "/compile", `{"query": "input.x = 1", "target": {"type": "sql"}}`, 400, `{
+					"code": "invalid_parameter",
+					"message": "missing required 'target.sql' value"
+				}`},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			executeRequests(t, tc.trs)
+		})
+	}
+}
+
+func TestCompileV1ElasticsearchTarget(t *testing.T) {
+
+	f := newFixture(t)
+
+	err := f.v1(http.MethodPut, "/policies/test", `package filters
+
+	allow { startswith(input.document.path, input.prefix) }`, 200, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.v1(http.MethodPost, "/compile", `{
+		"unknowns": ["input.document"],
+		"input": {"prefix": "/finance/"},
+		"query": "data.filters.allow = true",
+		"target": {
+			"type": "elasticsearch",
+			"elasticsearch": {"indices": [{"unknown": "input.document"}]}
+		}
+	}`, 200, `{"result": {"bool": {"filter": [{"prefix": {"path": {"value": "/finance/"}}}]}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestCompileV1Observability(t *testing.T) {
 
 	f := newFixture(t)
@@ -2240,6 +2347,61 @@ func TestDataMetricsEval(t *testing.T) {
 	})
 }
 
+func TestDataV1Budget(t *testing.T) {
+	f := newFixtureWithConfig(t, `{"server": {"budget": {"max_steps": 50}}}`)
+
+	err := f.v1(http.MethodPut, "/policies/test", `package test
+		p = count([x | x := numbers.range(1, 100)[_]])
+		q = 7`, 200, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.reset()
+	f.server.Handler.ServeHTTP(f.recorder, newReqV1(http.MethodGet, "/data/test/p", ""))
+
+	if f.recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %v but got: %v", http.StatusInternalServerError, f.recorder)
+	}
+
+	var result struct {
+		Errors []struct {
+			Code string `json:"code"`
+		} `json:"errors"`
+	}
+	if err := util.NewJSONDecoder(f.recorder.Body).Decode(&result); err != nil {
+		t.Fatalf("Unexpected JSON decode error: %v", err)
+	}
+
+	if len(result.Errors) != 1 || result.Errors[0].Code != "eval_budget_error" {
+		t.Fatalf("Expected budget error but got: %+v", result)
+	}
+
+	testDataMetrics(t, f, "/data/test/q?metrics", []string{
+		"counter_eval_budget_steps",
+		"counter_server_query_cache_hit",
+		"timer_rego_input_parse_ns",
+		"timer_rego_query_parse_ns",
+		"timer_rego_query_compile_ns",
+		"timer_rego_query_eval_ns",
+		"timer_server_handler_ns",
+	})
+}
+
+func TestDataV1BudgetInvalidConfig(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+	m, err := plugins.New([]byte(`{"server": {"budget": {"max_steps": -1}}}`), "test", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = New().WithStore(store).WithManager(m).Init(ctx)
+	if err == nil || err.Error() != "budget max_steps must be non-negative" {
+		t.Fatalf("Expected budget validation error but got: %v", err)
+	}
+}
+
 func testDataMetrics(t *testing.T, f *fixture, url string, expected []string) {
 	t.Helper()
 	f.reset()
@@ -2810,6 +2972,149 @@ func TestDecisionIDs(t *testing.T) {
 	}
 }
 
+func TestBatchDataPostV1(t *testing.T) {
+	f := newFixture(t)
+
+	var mtx sync.Mutex
+	decisions := map[string]*Info{}
+	var nextID int
+
+	f.server = f.server.WithDecisionIDFactory(func() string {
+		mtx.Lock()
+		defer mtx.Unlock()
+		nextID++
+		return fmt.Sprint(nextID)
+	}).WithDecisionLoggerWithErr(func(_ context.Context, info *Info) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		decisions[info.DecisionID] = info
+		return nil
+	})
+
+	err := f.v1(http.MethodPut, "/policies/test", `package test
+
+	allow { input.x > 1 }
+
+	p = "a" { input.conflict }
+	p = "b" { input.conflict }`, 200, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.v1(http.MethodPost, "/batch/data/test/allow", `{"inputs": {"a": {"x": 2}, "b": {"x": 0}, "c": {"x": 3}}}`, 200, `{
+		"responses": {
+			"a": {"decision_id": "1", "result": true},
+			"b": {"decision_id": "2"},
+			"c": {"decision_id": "3", "result": true}
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decisions) != 3 || decisions["2"].Path != "test/allow" || decisions["2"].Results != nil {
+		t.Fatalf("expected three logged decisions but got: %v", decisions)
+	}
+
+	f.reset()
+	f.server.Handler.ServeHTTP(f.recorder, newReqV1(http.MethodPost, "/batch/data/test/p?metrics", `{"inputs": {"ok": {}, "fail": {"conflict": true}}}`))
+	if f.recorder.Code != http.StatusMultiStatus {
+		t.Fatalf("expected multi-status but got %v: %v", f.recorder.Code, f.recorder.Body)
+	}
+
+	var result struct {
+		Metrics   map[string]interface{} `json:"metrics"`
+		Responses map[string]struct {
+			Metrics map[string]interface{} `json:"metrics"`
+			Result  *interface{}           `json:"result"`
+			Error   *struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		} `json:"responses"`
+	}
+	if err := util.NewJSONDecoder(f.recorder.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if fail := result.Responses["fail"]; fail.Error == nil || fail.Error.Code != types.CodeInternal || fail.Result != nil {
+		t.Fatalf("expected evaluation error but got: %+v", fail)
+	}
+
+	if ok := result.Responses["ok"]; ok.Error != nil || ok.Metrics == nil {
+		t.Fatalf("expected undefined result with metrics but got: %+v", ok)
+	}
+
+	if result.Metrics["counter_server_batch_items"] != json.Number("2") || result.Metrics["counter_server_batch_errors"] != json.Number("1") {
+		t.Fatalf("unexpected batch metrics: %v", result.Metrics)
+	}
+
+	decisions = map[string]*Info{}
+	inputs := make([]string, 20)
+	for i := range inputs {
+		inputs[i] = fmt.Sprintf(`"%d": {"x": %d}`, i, i)
+	}
+
+	f.reset()
+	f.server.Handler.ServeHTTP(f.recorder, newReqV1(http.MethodPost, "/batch/data/test/allow?parallelism=4", `{"inputs": {`+strings.Join(inputs, ",")+`}}`))
+	if f.recorder.Code != http.StatusOK {
+		t.Fatalf("expected success but got %v: %v", f.recorder.Code, f.recorder.Body)
+	}
+
+	var parallel types.BatchDataResponseV1
+	if err := util.NewJSONDecoder(f.recorder.Body).Decode(&parallel); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range inputs {
+		resp := parallel.Responses[fmt.Sprint(i)]
+		if (resp.Result != nil) != (i > 1) || decisions[resp.DecisionID] == nil {
+			t.Fatalf("unexpected response for input %d: %+v", i, resp)
+		}
+	}
+
+	tests := []struct {
+		note string
+		path string
+		body string
+	}{
+		{note: "no inputs", path: "/batch/data/test/allow", body: `{"inputs": {}}`},
+		{note: "malformed body", path: "/batch/data/test/allow", body: `{"inputs": [1]}`},
+		{note: "invalid parallelism", path: "/batch/data/test/allow?parallelism=0", body: `{"inputs": {"a": {}}}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			f.reset()
+			f.server.Handler.ServeHTTP(f.recorder, newReqV1(http.MethodPost, tc.path, tc.body))
+			if f.recorder.Code != http.StatusBadRequest {
+				t.Fatalf("expected bad request but got %v: %v", f.recorder.Code, f.recorder.Body)
+			}
+		})
+	}
+}
+
+func TestBatchDataPostV1MaxInputs(t *testing.T) {
+	f := newFixtureWithConfig(t, `{"server": {"batch": {"max_inputs": 2}}}`)
+
+	if err := f.v1(http.MethodPost, "/batch/data/test/allow", `{"inputs": {"a": {}, "b": {}}}`, 200, `{"responses": {"a": {}, "b": {}}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	f.reset()
+	f.server.Handler.ServeHTTP(f.recorder, newReqV1(http.MethodPost, "/batch/data/test/allow", `{"inputs": {"a": {}, "b": {}, "c": {}}}`))
+	if f.recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected bad request but got %v: %v", f.recorder.Code, f.recorder.Body)
+	}
+
+	if _, err := parseMaxBatchInputs([]byte(`{"max_inputs": 0}`)); err == nil {
+		t.Fatal("expected error for non-positive max_inputs")
+	}
+
+	if n, err := parseMaxBatchInputs(nil); err != nil || n != defaultMaxBatchInputs {
+		t.Fatalf("expected default max inputs but got %v (err: %v)", n, err)
+	}
+}
+
 func TestDecisionLogging(t *testing.T) {
 	f := newFixture(t)
 
@@ -3269,6 +3574,63 @@ func TestAuthorization(t *testing.T) {
 	}
 }
 
+func TestAuthenticationAPIKey(t *testing.T) {
+
+	ctx := context.Background()
+	store := inmem.New()
+
+	sum := sha256.Sum256([]byte("secret"))
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(keysFile, []byte(fmt.Sprintf(`{"keys": [{"id": "ci", "hash": "sha256:%x"}]}`, sum)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := plugins.New([]byte(fmt.Sprintf(`{"server": {"authentication": {"api_keys": {"file": %q}}}}`, keysFile)), "test", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := New().
+		WithAddresses([]string{":8182"}).
+		WithStore(store).
+		WithManager(m).
+		WithAuthentication(AuthenticationAPIKey).
+		Init(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		code int
+	}{
+		{key: "", code: http.StatusOK},
+		{key: "secret", code: http.StatusOK},
+		{key: "wrong", code: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:8182/health", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.key != "" {
+			req.Header.Set("X-API-Key", tc.key)
+		}
+		validateAuthorizedRequest(t, server, req, tc.code)
+	}
+
+	_, err = New().
+		WithAddresses([]string{":8182"}).
+		WithStore(store).
+		WithManager(m).
+		WithAuthentication(AuthenticationJWT).
+		Init(ctx)
+	if err == nil || !strings.Contains(err.Error(), "jwt authentication requires server.authentication.jwt configuration") {
+		t.Fatalf("expected missing configuration error but got: %v", err)
+	}
+}
+
 func validateAuthorizedRequest(t *testing.T, s *Server, req *http.Request, exp int) {
 	t.Helper()
 
@@ -3487,9 +3849,13 @@ type fixture struct {
 }
 
 func newFixture(t *testing.T, opts ...func(*Server)) *fixture {
+	return newFixtureWithConfig(t, "", opts...)
+}
+
+func newFixtureWithConfig(t *testing.T, config string, opts ...func(*Server)) *fixture {
 	ctx := context.Background()
 	store := inmem.New()
-	m, err := plugins.New([]byte{}, "test", store)
+	m, err := plugins.New([]byte(config), "test", store)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,173 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/meta-quick/opax/ast"
+	iprom "github.com/meta-quick/opax/internal/prometheus"
+	bundlePlugin "github.com/meta-quick/opax/plugins/bundle"
+	"github.com/meta-quick/opax/rego"
+	"github.com/meta-quick/opax/util"
+)
+
+// Outcomes of shadow evaluations in the shadow_evaluations_total metric.
+const (
+	shadowOutcomeMatch      = "match"
+	shadowOutcomeDivergence = "divergence"
+	shadowOutcomeError      = "error"
+	shadowOutcomeTimeout    = "timeout"
+	shadowOutcomeSkipped    = "skipped"
+)
+
+func (s *Server) initShadow() error {
+	s.shadowEvals = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shadow_evaluations_total",
+		Help: "Number of decisions evaluated against the shadow bundle, by outcome.",
+	}, []string{"outcome"})
+
+	s.shadowDivergences = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shadow_divergences_total",
+		Help: "Number of decisions whose shadow bundle outcome differs from the decision, by path.",
+	}, []string{"path"})
+
+	return iprom.Register(s.metrics, s.shadowEvals, s.shadowDivergences)
+}
+
+// shadowEval evaluates a decision against the shadow bundle, if one has been
+// activated. The evaluation runs in the background so that it never delays
+// the response. Decisions are sampled at the configured rate and evaluations
+// are cancelled once they exceed the latency budget. The number of concurrent
+// evaluations is limited so that they do not compete with decisions for CPU
+// time; decisions sampled while the limit is reached are skipped. If the
+// outcome differs from the decision, a divergence event is logged.
+func (s *Server) shadowEval(logger decisionLogger, decisionID, remoteAddr, urlPath string, goInput *interface{}, input ast.Value, result *interface{}) {
+	bp := bundlePlugin.Lookup(s.manager)
+	if bp == nil {
+		return
+	}
+
+	shadow := bp.Shadow()
+	if shadow == nil || rand.Float64() >= shadow.SampleRate {
+		return
+	}
+
+	if n := atomic.AddInt32(&s.shadowInFlight, 1); int(n) > shadow.MaxConcurrency {
+		atomic.AddInt32(&s.shadowInFlight, -1)
+		s.shadowEvals.WithLabelValues(shadowOutcomeSkipped).Inc()
+		return
+	}
+
+	go func() {
+		defer atomic.AddInt32(&s.shadowInFlight, -1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), shadow.LatencyBudget)
+		defer cancel()
+
+		var rs rego.ResultSet
+		pq, err := s.shadowQuery(ctx, shadow, urlPath)
+		if err == nil {
+			rs, err = pq.Eval(ctx, rego.EvalParsedInput(input))
+		}
+
+		var shadowResult *interface{}
+
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			s.shadowEvals.WithLabelValues(shadowOutcomeTimeout).Inc()
+			return
+		case err != nil:
+			s.shadowEvals.WithLabelValues(shadowOutcomeError).Inc()
+		default:
+			if len(rs) > 0 {
+				shadowResult = &rs[0].Expressions[0].Value
+			}
+			if equalResults(result, shadowResult) {
+				s.shadowEvals.WithLabelValues(shadowOutcomeMatch).Inc()
+				return
+			}
+			s.shadowEvals.WithLabelValues(shadowOutcomeDivergence).Inc()
+		}
+
+		s.shadowDivergences.WithLabelValues(s.decisionMetrics.paths.label(urlPath)).Inc()
+
+		divergence := &DivergenceInfo{
+			DecisionID: decisionID,
+			Bundle:     shadow.Name,
+			Revision:   shadow.Revision,
+			InputHash:  hashInput(goInput),
+			Results:    shadowResult,
+			Error:      err,
+		}
+
+		// The decision's context may be cancelled already, the event is
+		// logged with a fresh context.
+		logCtx, logCancel := context.WithTimeout(context.Background(), time.Second)
+		defer logCancel()
+
+		_ = logger.LogDivergence(logCtx, s.generateDecisionID(), remoteAddr, urlPath, result, divergence)
+	}()
+}
+
+// shadowQuery returns the prepared query for the path in the shadow
+// environment. Prepared queries are cached until a new shadow bundle is
+// activated.
+func (s *Server) shadowQuery(ctx context.Context, shadow *bundlePlugin.Shadow, urlPath string) (rego.PreparedEvalQuery, error) {
+	s.shadowMtx.Lock()
+	if s.shadowCompiler != shadow.Compiler {
+		s.shadowCompiler = shadow.Compiler
+		s.shadowQueries = newCache(pqMaxCacheSize)
+	}
+	queries := s.shadowQueries
+	s.shadowMtx.Unlock()
+
+	if pq, ok := queries.Get(urlPath); ok {
+		return pq.(rego.PreparedEvalQuery), nil
+	}
+
+	pq, err := rego.New(
+		rego.Compiler(shadow.Compiler),
+		rego.Store(shadow.Store),
+		rego.Query(stringPathToDataRef(urlPath).String()),
+		rego.Runtime(s.runtime),
+		rego.UnsafeBuiltins(unsafeBuiltinsMap),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return rego.PreparedEvalQuery{}, err
+	}
+
+	queries.Insert(urlPath, pq)
+	return pq, nil
+}
+
+func equalResults(a, b *interface{}) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return util.Compare(*a, *b) == 0
+}
+
+// hashInput returns the hex encoded SHA-256 hash of the JSON encoded input.
+// Object keys are sorted by the encoder, so equal inputs have equal hashes.
+func hashInput(input *interface{}) string {
+	if input == nil {
+		return ""
+	}
+	bs, err := json.Marshal(*input)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,238 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	bundlePlugin "github.com/meta-quick/opax/plugins/bundle"
+	"github.com/meta-quick/opax/server/types"
+	"github.com/meta-quick/opax/util"
+	"github.com/meta-quick/opax/util/test"
+)
+
+func TestShadowEvaluation(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	var mtx sync.Mutex
+	var divergences []*Info
+	var nextID int
+
+	f := newFixture(t, func(s *Server) {
+		s.WithDecisionIDFactory(func() string {
+			mtx.Lock()
+			defer mtx.Unlock()
+			nextID++
+			return fmt.Sprint(nextID)
+		})
+		s.WithDecisionLoggerWithErr(func(_ context.Context, info *Info) error {
+			if info.Divergence != nil {
+				mtx.Lock()
+				divergences = append(divergences, info)
+				mtx.Unlock()
+			}
+			return nil
+		})
+	})
+
+	files := map[string]string{
+		"candidate/.manifest": `{"roots": ["authz"]}`,
+		"candidate/authz/policy.rego": fmt.Sprintf(`package authz
+
+default allow = false
+
+allow {
+	input.user == data.users[_]
+}
+
+slow {
+	http.send({"method": "get", "url": %q})
+}`, ts.URL),
+	}
+
+	// The shadow bundle is evaluated with the data of the active store.
+	if err := f.v1("PUT", "/data/users", `["alice"]`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+		config, err := bundlePlugin.ParseBundlesConfig([]byte(fmt.Sprintf(`{
+			"candidate": {
+				"resource": "file://%v",
+				"shadow": {"latency_budget_ms": 200}
+			}
+		}`, filepath.Join(rootDir, "candidate"))), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bp := bundlePlugin.New(config, f.server.manager)
+		f.server.manager.Register(bundlePlugin.Name, bp)
+
+		ctx := context.Background()
+		if err := bp.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer bp.Stop(ctx)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for bp.Shadow() == nil {
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for shadow bundle activation")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		policy := `package authz
+
+default allow = false
+
+allow {
+	input.user == "bob"
+}
+
+slow = true`
+
+		if err := f.v1("PUT", "/policies/test", policy, 200, "{}"); err != nil {
+			t.Fatal(err)
+		}
+
+		exp := map[string]float64{
+			shadowOutcomeMatch:      2,
+			shadowOutcomeDivergence: 2,
+			shadowOutcomeTimeout:    1,
+		}
+
+		var evaluations float64
+
+		decisionIDs := map[string]bool{}
+
+		// Shadow evaluations run in the background and may be skipped while
+		// others are in progress. Wait for each evaluation to finish.
+		request := func(method, path, body, result string) {
+			t.Helper()
+			f.reset()
+			f.server.Handler.ServeHTTP(f.recorder, newReqV1(method, path, body))
+
+			var resp types.DataResponseV1
+			if err := util.NewJSONDecoder(f.recorder.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			var act interface{}
+			if resp.Result != nil {
+				act = *resp.Result
+			}
+			if exp := util.MustUnmarshalJSON([]byte(result)); f.recorder.Code != 200 || util.Compare(act, exp) != 0 {
+				t.Fatalf("Expected result %v for %v but got %v: %v", result, path, f.recorder.Code, act)
+			}
+
+			decisionIDs[resp.DecisionID] = true
+			evaluations++
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				var total float64
+				for outcome := range exp {
+					total += counterValue(t, f.server.shadowEvals.WithLabelValues(outcome))
+				}
+				if total == evaluations && atomic.LoadInt32(&f.server.shadowInFlight) == 0 {
+					return
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("Timed out waiting for shadow evaluation of %v", path)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		// Only the primary result is returned.
+		for user, result := range map[string]string{"alice": "false", "bob": "true", "carol": "false"} {
+			body := fmt.Sprintf(`{"input": {"user": %q}}`, user)
+			request("POST", "/data/authz/allow", body, result)
+		}
+
+		request("GET", "/data/authz/missing", "", "null")
+
+		// The shadow evaluation exceeds the latency budget.
+		request("GET", "/data/authz/slow", "", "true")
+
+		for outcome, v := range exp {
+			if act := counterValue(t, f.server.shadowEvals.WithLabelValues(outcome)); act != v {
+				t.Fatalf("Expected %v %v evaluations but got %v", v, outcome, act)
+			}
+		}
+
+		if act := counterValue(t, f.server.shadowDivergences.WithLabelValues("authz/allow")); act != 2 {
+			t.Fatalf("Expected 2 divergences but got %v", act)
+		}
+
+		// Decisions are not evaluated while the max number of concurrent
+		// evaluations (default: 1) is running.
+		atomic.StoreInt32(&f.server.shadowInFlight, 1)
+		if err := f.v1("POST", "/data/authz/allow", `{"input": {"user": "alice"}}`, 200, ""); err != nil {
+			t.Fatal(err)
+		}
+		atomic.StoreInt32(&f.server.shadowInFlight, 0)
+
+		if act := counterValue(t, f.server.shadowEvals.WithLabelValues(shadowOutcomeSkipped)); act != 1 {
+			t.Fatalf("Expected 1 skipped evaluation but got %v", act)
+		}
+
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if len(divergences) != 2 {
+			t.Fatalf("Expected 2 divergence events but got %v", len(divergences))
+		}
+
+		for _, info := range divergences {
+			if info.Path != "authz/allow" || info.Input != nil || info.Divergence.Bundle != "candidate" {
+				t.Fatalf("Unexpected divergence event: %+v", info)
+			}
+
+			// The divergence event has its own ID and references the
+			// decision.
+			if !decisionIDs[info.Divergence.DecisionID] || decisionIDs[info.DecisionID] || info.DecisionID == "" {
+				t.Fatalf("Unexpected decision IDs of divergence event: %v, %v", info.DecisionID, info.Divergence.DecisionID)
+			}
+
+			var input interface{} = map[string]interface{}{"user": "alice"}
+			if *info.Results == true {
+				input = map[string]interface{}{"user": "bob"}
+			}
+
+			if info.Divergence.InputHash != hashInput(&input) {
+				t.Fatalf("Unexpected input hash: %+v", info.Divergence)
+			}
+
+			if *info.Results == *info.Divergence.Results {
+				t.Fatalf("Expected results to differ: %+v", info.Divergence)
+			}
+		}
+	})
+}
+
+func counterValue(t *testing.T, c interface{ Write(*dto.Metric) error }) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
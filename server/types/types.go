@@ -12,6 +12,8 @@ import (
 	"strings"
 
 	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/datafilter/elasticsearch"
+	"github.com/meta-quick/opax/datafilter/sql"
 	"github.com/meta-quick/opax/topdown"
 	"github.com/meta-quick/opax/util"
 )
@@ -21,6 +23,7 @@ const (
 	CodeInternal          = "internal_error"
 	CodeEvaluation        = "evaluation_error"
 	CodeUnauthorized      = "unauthorized"
+	CodeUnauthenticated   = "unauthenticated"
 	CodeInvalidParameter  = "invalid_parameter"
 	CodeInvalidOperation  = "invalid_operation"
 	CodeResourceNotFound  = "resource_not_found"
@@ -79,6 +82,7 @@ const (
 	MsgEvaluationError            = "error(s) occurred while evaluating query"
 	MsgUnauthorizedUndefinedError = "authorization policy missing or undefined"
 	MsgUnauthorizedError          = "request rejected by administrative policy"
+	MsgUnauthenticatedError       = "request credentials rejected"
 	MsgUndefinedError             = "document missing or undefined"
 	MsgPluginConfigError          = "error(s) occurred while configuring plugin(s)"
 )
@@ -151,6 +155,29 @@ type DataResponseV1 struct {
 	Result      *interface{}  `json:"result,omitempty"`
 }
 
+// BatchDataRequestV1 models the request message for batch Data API POST
+// operations. The inputs are keyed by caller-chosen IDs.
+type BatchDataRequestV1 struct {
+	Inputs map[string]*interface{} `json:"inputs"`
+}
+
+// BatchDataResponseV1 models the response message for batch Data API POST
+// operations. The responses are keyed by the IDs of the inputs.
+type BatchDataResponseV1 struct {
+	Provenance *ProvenanceV1                      `json:"provenance,omitempty"`
+	Metrics    MetricsV1                          `json:"metrics,omitempty"`
+	Responses  map[string]BatchDataItemResponseV1 `json:"responses"`
+}
+
+// BatchDataItemResponseV1 models the response for a single input of a batch Data
+// API POST operation. Either the result or the error is set.
+type BatchDataItemResponseV1 struct {
+	DecisionID string       `json:"decision_id,omitempty"`
+	Metrics    MetricsV1    `json:"metrics,omitempty"`
+	Result     *interface{} `json:"result,omitempty"`
+	Error      *ErrorV1     `json:"error,omitempty"`
+}
+
 // MetricsV1 models a collection of performance metrics.
 type MetricsV1 map[string]interface{}
 
@@ -349,11 +376,27 @@ func NewBindingsV1(locals *ast.ValueMap) (result []*BindingV1) {
 
 // CompileRequestV1 models the request message for Compile API operations.
 type CompileRequestV1 struct {
-	Input    *interface{} `json:"input"`
-	Query    string       `json:"query"`
-	Unknowns *[]string    `json:"unknowns"`
+	Input    *interface{}     `json:"input"`
+	Query    string           `json:"query"`
+	Unknowns *[]string        `json:"unknowns"`
+	Target   *CompileTargetV1 `json:"target,omitempty"`
 }
 
+// CompileTargetV1 models the translation of partial evaluation results that
+// Compile API clients can request. If a target is set, the translation is
+// returned instead of the Rego AST.
+type CompileTargetV1 struct {
+	Type          string                 `json:"type"`
+	SQL           *sql.Options           `json:"sql,omitempty"`
+	Elasticsearch *elasticsearch.Options `json:"elasticsearch,omitempty"`
+}
+
+// Compile API translation targets.
+const (
+	CompileTargetSQLV1           = "sql"
+	CompileTargetElasticsearchV1 = "elasticsearch"
+)
+
 // CompileResponseV1 models the response message for Compile API operations.
 type CompileResponseV1 struct {
 	Result      *interface{} `json:"result,omitempty"`
@@ -389,6 +432,37 @@ type HealthResponseV1 struct {
 	Error string `json:"error,omitempty"`
 }
 
+// WatchEventV1 models an event of the Watch API stream. The patch describes
+// the changes to the watched document. The bundle revisions are read together
+// with the values in the patch.
+type WatchEventV1 struct {
+	ID        string            `json:"id,omitempty"`
+	Type      string            `json:"type"`
+	Revision  string            `json:"revision,omitempty"` // Deprecated: Use Revisions instead.
+	Revisions map[string]string `json:"revisions,omitempty"`
+	Patch     []PatchV1         `json:"patch,omitempty"`
+
+	// PoliciesChanged is set if policies changed. The IDs of the changed
+	// policies are only included in Policies for streams watching the root of
+	// the data document.
+	PoliciesChanged bool                 `json:"policies_changed,omitempty"`
+	Policies        []WatchPolicyEventV1 `json:"policies,omitempty"`
+}
+
+// WatchPolicyEventV1 models a policy change in the Watch API stream.
+type WatchPolicyEventV1 struct {
+	ID      string `json:"id"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// Watch API event types.
+const (
+	WatchEventOpenV1      = "open"
+	WatchEventResetV1     = "reset"
+	WatchEventChangeV1    = "change"
+	WatchEventHeartbeatV1 = "heartbeat"
+)
+
 const (
 	// ParamQueryV1 defines the name of the HTTP URL parameter that specifies
 	// values for the request query.
@@ -449,6 +523,27 @@ const (
 	// ParamStrictBuiltinErrors names the HTTP URL parameter that indicates the client
 	// wants built-in function errors to be treated as fatal.
 	ParamStrictBuiltinErrors = "strict-builtin-errors"
+
+	// ParamParallelismV1 defines the name of the HTTP URL parameter that
+	// specifies how many inputs of a batch request may be evaluated
+	// concurrently.
+	ParamParallelismV1 = "parallelism"
+
+	// ParamPathV1 defines the name of the HTTP URL parameter that specifies
+	// the path of the document watched by the Watch API.
+	ParamPathV1 = "path"
+
+	// ParamSinceV1 defines the name of the HTTP URL parameter that specifies
+	// the ID of the last event received from the Watch API.
+	ParamSinceV1 = "since"
+
+	// ParamHeartbeatV1 defines the name of the HTTP URL parameter that
+	// specifies the interval of Watch API heartbeats.
+	ParamHeartbeatV1 = "heartbeat"
+
+	// ParamFormatV1 defines the name of the HTTP URL parameter that specifies
+	// the format of the Watch API stream.
+	ParamFormatV1 = "format"
 )
 
 // BadRequestErr represents an error condition raised if the caller passes
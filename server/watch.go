@@ -0,0 +1,466 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/meta-quick/opax/server/types"
+	"github.com/meta-quick/opax/server/writer"
+	"github.com/meta-quick/opax/storage"
+)
+
+const (
+	// watchHistorySize is the number of changes that are retained so that
+	// clients can resume their stream after reconnecting.
+	watchHistorySize = 1000
+
+	defaultWatchHeartbeat = 15 * time.Second
+	minWatchHeartbeat     = time.Second
+
+	watchFormatSSE    = "sse"
+	watchFormatNDJSON = "ndjson"
+)
+
+// watchChange records a commit to the store. Only the paths of the changed
+// documents are retained; the values are read when the change is streamed so
+// that the history does not hold on to old versions of the data.
+type watchChange struct {
+	seq      uint64
+	paths    []storage.Path
+	policies []types.WatchPolicyEventV1
+
+	// unknown is set if the store did not report what changed, e.g., the
+	// disk store does not report changed paths or policies.
+	unknown bool
+}
+
+func (s *Server) initWatch() {
+	s.watchMtx.Lock()
+	defer s.watchMtx.Unlock()
+	s.watchEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+	s.watchDone = make(chan struct{})
+}
+
+// closeWatch ends all Watch API streams so that they do not block the
+// shutdown of the HTTP listeners.
+func (s *Server) closeWatch() {
+	s.watchMtx.Lock()
+	defer s.watchMtx.Unlock()
+	if s.watchDone == nil {
+		return
+	}
+	select {
+	case <-s.watchDone:
+	default:
+		close(s.watchDone)
+	}
+}
+
+// recordWatchChange appends the changes in event to the history. It is called
+// from the store trigger, so changes are recorded in commit order.
+func (s *Server) recordWatchChange(event storage.TriggerEvent) {
+	c := watchChange{unknown: event.IsZero()}
+
+	for _, d := range event.Data {
+		path := make(storage.Path, len(d.Path))
+		copy(path, d.Path)
+		c.paths = append(c.paths, path)
+	}
+
+	for _, p := range event.Policy {
+		c.policies = append(c.policies, types.WatchPolicyEventV1{ID: p.ID, Removed: p.Removed})
+	}
+
+	s.watchMtx.Lock()
+	defer s.watchMtx.Unlock()
+
+	s.watchSeq++
+	c.seq = s.watchSeq
+
+	if len(s.watchHistory) == watchHistorySize {
+		copy(s.watchHistory, s.watchHistory[1:])
+		s.watchHistory = s.watchHistory[:watchHistorySize-1]
+	}
+	s.watchHistory = append(s.watchHistory, c)
+}
+
+// watchToken returns the resume token for the change with the sequence number.
+// Tokens include the epoch of the server so that tokens issued by a previous
+// run are not mistaken for current ones.
+func (s *Server) watchToken(seq uint64) string {
+	return s.watchEpoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// watchResume returns the sequence number of the first change to stream to a
+// client that last received the event with the token. If the token cannot be
+// resumed, the stream starts after the latest change and reset is true.
+func (s *Server) watchResume(token string) (next uint64, reset bool, err error) {
+	s.watchMtx.Lock()
+	defer s.watchMtx.Unlock()
+
+	latest := s.watchSeq + 1
+
+	if token == "" {
+		return latest, false, nil
+	}
+
+	i := strings.LastIndex(token, "-")
+	if i < 0 {
+		return 0, false, fmt.Errorf("invalid event id: %v", token)
+	}
+
+	seq, err := strconv.ParseUint(token[i+1:], 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid event id: %v", token)
+	}
+
+	if token[:i] != s.watchEpoch || seq > s.watchSeq || seq+1 < s.watchOldest() {
+		return latest, true, nil
+	}
+
+	return seq + 1, false, nil
+}
+
+// watchChanges returns the changes starting at the sequence number. If some of
+// these changes are no longer retained, ok is false.
+func (s *Server) watchChanges(next uint64) (changes []watchChange, ok bool) {
+	s.watchMtx.Lock()
+	defer s.watchMtx.Unlock()
+
+	if next < s.watchOldest() {
+		return nil, false
+	}
+
+	for _, c := range s.watchHistory {
+		if c.seq >= next {
+			changes = append(changes, c)
+		}
+	}
+
+	return changes, true
+}
+
+// watchOldest returns the sequence number of the oldest retained change. The
+// caller must hold the watch lock.
+func (s *Server) watchOldest() uint64 {
+	if len(s.watchHistory) == 0 {
+		return s.watchSeq + 1
+	}
+	return s.watchHistory[0].seq
+}
+
+func (s *Server) v1WatchGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	path, ok := storage.ParsePathEscaped("/" + strings.Trim(r.URL.Query().Get(types.ParamPathV1), "/"))
+	if !ok {
+		writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, errors.Errorf("bad path: %v", r.URL.Query().Get(types.ParamPathV1)))
+		return
+	}
+
+	heartbeat := defaultWatchHeartbeat
+	if v := r.URL.Query().Get(types.ParamHeartbeatV1); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < minWatchHeartbeat {
+			writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, errors.Errorf("invalid heartbeat: %v (must be at least %v)", v, minWatchHeartbeat))
+			return
+		}
+		heartbeat = d
+	}
+
+	format := r.URL.Query().Get(types.ParamFormatV1)
+	if format == "" {
+		format = watchFormatSSE
+		if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+			format = watchFormatNDJSON
+		}
+	}
+
+	if format != watchFormatSSE && format != watchFormatNDJSON {
+		writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, errors.Errorf("invalid format: %v", format))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writer.ErrorString(w, http.StatusInternalServerError, types.CodeInternal, errors.New("streaming not supported"))
+		return
+	}
+
+	token := r.URL.Query().Get(types.ParamSinceV1)
+	if token == "" {
+		token = r.Header.Get("Last-Event-ID")
+	}
+
+	// Subscribe before reading the history so that no change is missed.
+	changed := s.subscribeWatch()
+	defer s.unsubscribeWatch(changed)
+
+	next, reset, err := s.watchResume(token)
+	if err != nil {
+		writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		return
+	}
+
+	stream := &watchStream{s: s, w: w, path: path, format: format}
+
+	if format == watchFormatSSE {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	typ := types.WatchEventOpenV1
+	if reset {
+		typ = types.WatchEventResetV1
+	}
+
+	if err := stream.sendMarker(ctx, typ, next-1); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		changes, ok := s.watchChanges(next)
+		if !ok {
+			// The client fell behind the retained history.
+			next, _, _ = s.watchResume("")
+			if err := stream.sendMarker(ctx, types.WatchEventResetV1, next-1); err != nil {
+				return
+			}
+		} else if len(changes) > 0 {
+			if err := stream.sendChanges(ctx, changes); err != nil {
+				s.manager.Logger().Debug("Watch stream closed: %v.", err)
+				return
+			}
+			next = changes[len(changes)-1].seq + 1
+		}
+		flusher.Flush()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.watchDone:
+			return
+		case <-changed:
+		case <-ticker.C:
+			if err := stream.write(types.WatchEventV1{Type: types.WatchEventHeartbeatV1}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// watchStream writes the events of a single Watch API stream.
+type watchStream struct {
+	s      *Server
+	w      io.Writer
+	path   storage.Path
+	format string
+
+	// last is the last value of the watched document that was sent for a
+	// change that the store did not describe.
+	last []byte
+}
+
+// sendMarker sends an event without changes that carries the current bundle
+// revisions, e.g., when the stream is opened.
+func (ws *watchStream) sendMarker(ctx context.Context, typ string, seq uint64) error {
+	txn, err := ws.s.store.NewTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer ws.s.store.Abort(ctx, txn)
+
+	br, err := getRevisions(ctx, ws.s.store, txn)
+	if err != nil {
+		return err
+	}
+
+	return ws.write(types.WatchEventV1{
+		ID:        ws.s.watchToken(seq),
+		Type:      typ,
+		Revision:  br.LegacyRevision,
+		Revisions: br.Revisions,
+	})
+}
+
+// sendChanges sends the changes that affect the watched document. The values
+// and bundle revisions are read in a single transaction, so they may be newer
+// than the change itself.
+func (ws *watchStream) sendChanges(ctx context.Context, changes []watchChange) error {
+	txn, err := ws.s.store.NewTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer ws.s.store.Abort(ctx, txn)
+
+	br, err := getRevisions(ctx, ws.s.store, txn)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		patch, err := ws.patch(ctx, txn, c)
+		if err != nil {
+			return err
+		}
+
+		if len(patch) == 0 && len(c.policies) == 0 {
+			continue
+		}
+
+		event := types.WatchEventV1{
+			ID:              ws.s.watchToken(c.seq),
+			Type:            types.WatchEventChangeV1,
+			Revision:        br.LegacyRevision,
+			Revisions:       br.Revisions,
+			Patch:           patch,
+			PoliciesChanged: len(c.policies) > 0,
+		}
+
+		// Streams are authorized like reads of the watched document, which
+		// does not grant access to the list of policies. Only streams that
+		// watch the root of the data document receive the policy IDs.
+		if len(ws.path) == 0 {
+			event.Policies = c.policies
+		}
+
+		err = ws.write(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// patch returns the JSON Patch that applies the change to the watched
+// document. Changes to documents under the watched path are reported at their
+// own path. Changes to documents that contain the watched document are
+// reported at the watched path.
+func (ws *watchStream) patch(ctx context.Context, txn storage.Transaction, c watchChange) ([]types.PatchV1, error) {
+
+	if c.unknown {
+		op, err := ws.op(ctx, txn, ws.path)
+		if err != nil {
+			return nil, err
+		}
+		bs, err := json.Marshal(op)
+		if err != nil {
+			return nil, err
+		}
+		if ws.last != nil && string(bs) == string(ws.last) {
+			return nil, nil
+		}
+		ws.last = bs
+		return []types.PatchV1{op}, nil
+	}
+
+	var targets []storage.Path
+
+	for _, p := range c.paths {
+		if p.HasPrefix(ws.path) {
+			targets = append(targets, p)
+		} else if ws.path.HasPrefix(p) {
+			targets = append(targets, ws.path)
+		}
+	}
+
+	// Skip changes to documents that are contained in other changed documents.
+	sort.SliceStable(targets, func(i, j int) bool {
+		return len(targets[i]) < len(targets[j])
+	})
+
+	var patch []types.PatchV1
+
+	for i, target := range targets {
+		contained := false
+		for _, other := range targets[:i] {
+			if target.HasPrefix(other) {
+				contained = true
+				break
+			}
+		}
+		if contained {
+			continue
+		}
+		op, err := ws.op(ctx, txn, target)
+		if err != nil {
+			return nil, err
+		}
+		patch = append(patch, op)
+	}
+
+	return patch, nil
+}
+
+// op returns the patch operation that sets the document at path to its
+// current value.
+func (ws *watchStream) op(ctx context.Context, txn storage.Transaction, path storage.Path) (types.PatchV1, error) {
+	pointer := watchPointer(path)
+
+	value, err := ws.s.store.Read(ctx, txn, path)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return types.PatchV1{Op: "remove", Path: pointer}, nil
+		}
+		return types.PatchV1{}, err
+	}
+
+	if len(path) == 0 {
+		return types.PatchV1{Op: "replace", Path: pointer, Value: value}, nil
+	}
+
+	return types.PatchV1{Op: "add", Path: pointer, Value: value}, nil
+}
+
+func (ws *watchStream) write(event types.WatchEventV1) error {
+	bs, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if ws.format == watchFormatNDJSON {
+		_, err = fmt.Fprintf(ws.w, "%s\n", bs)
+		return err
+	}
+
+	if event.Type == types.WatchEventHeartbeatV1 {
+		_, err = io.WriteString(ws.w, ": heartbeat\n\n")
+		return err
+	}
+
+	_, err = fmt.Fprintf(ws.w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, bs)
+	return err
+}
+
+var watchPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// watchPointer returns the JSON Pointer for the path.
+func watchPointer(path storage.Path) string {
+	var sb strings.Builder
+	for _, p := range path {
+		sb.WriteByte('/')
+		sb.WriteString(watchPointerEscaper.Replace(p))
+	}
+	return sb.String()
+}
@@ -0,0 +1,291 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meta-quick/opax/server/types"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
+	"github.com/meta-quick/opax/util"
+)
+
+func TestWatch(t *testing.T) {
+
+	f := newFixture(t)
+	ts := httptest.NewServer(f.server.Handler)
+	defer ts.Close()
+	defer f.server.closeWatch()
+
+	if err := f.v1(http.MethodPut, "/data/system/bundles/b1/manifest", `{"revision": "r1", "roots": ["z"]}`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.v1(http.MethodPut, "/data/a", `{}`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	events, closeStream := watchNDJSON(t, ts.URL+"/v1/watch?path=a&format=ndjson")
+
+	open := nextWatchEvent(t, events)
+	if open.Type != types.WatchEventOpenV1 || !reflect.DeepEqual(open.Revisions, map[string]string{"b1": "r1"}) {
+		t.Fatalf("Unexpected open event: %+v", open)
+	}
+
+	rootEvents, closeRootStream := watchNDJSON(t, ts.URL+"/v1/watch?format=ndjson")
+	defer closeRootStream()
+
+	if event := nextWatchEvent(t, rootEvents); event.Type != types.WatchEventOpenV1 {
+		t.Fatalf("Unexpected open event: %+v", event)
+	}
+
+	requests := []tr{
+		{http.MethodPut, "/data/a/b", `1`, 204, ""},
+		{http.MethodPut, "/data/x", `1`, 204, ""},
+		{http.MethodPatch, "/data/a", `[{"op": "remove", "path": "b"}]`, 204, ""},
+		{http.MethodPut, "/data/a", `{"c": 2}`, 204, ""},
+		{http.MethodPut, "/policies/test", "package test\np = 1", 200, ""},
+	}
+
+	if err := f.v1TestRequests(requests); err != nil {
+		t.Fatal(err)
+	}
+
+	// The change to /x is not streamed. Values are read when the changes are
+	// streamed, so the value of the first change depends on how far the stream
+	// has fallen behind and is not checked.
+	exp := [][]types.PatchV1{
+		nil,
+		{{Op: "remove", Path: "/a/b"}},
+		{{Op: "add", Path: "/a", Value: map[string]interface{}{"c": json.Number("2")}}},
+		nil,
+	}
+
+	var last types.WatchEventV1
+	for i := range exp {
+		event := nextWatchEvent(t, events)
+		if event.Type != types.WatchEventChangeV1 {
+			t.Fatalf("Expected change event but got: %+v", event)
+		}
+		if i == 0 {
+			if len(event.Patch) != 1 || event.Patch[0].Path != "/a/b" {
+				t.Fatalf("Unexpected patch: %+v", event.Patch)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(event.Patch, exp[i]) {
+			t.Fatalf("Expected patch %d to be %v but got %v", i, exp[i], event.Patch)
+		}
+		last = event
+	}
+
+	// Policy IDs are only sent to streams that watch the root document.
+	if !last.PoliciesChanged || last.Policies != nil {
+		t.Fatalf("Expected policy change without IDs but got: %+v", last)
+	}
+
+	for {
+		event := nextWatchEvent(t, rootEvents)
+		if !event.PoliciesChanged {
+			continue
+		}
+		if !reflect.DeepEqual(event.Policies, []types.WatchPolicyEventV1{{ID: "test"}}) {
+			t.Fatalf("Unexpected policies: %+v", event.Policies)
+		}
+		break
+	}
+
+	closeStream()
+
+	// Changes that happened while disconnected are streamed on resume. Changes
+	// to documents that contain the watched document are reported at the
+	// watched path.
+	if err := f.v1(http.MethodPut, "/data/a", `{"c": {"d": 3}}`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	events, closeStream = watchNDJSON(t, ts.URL+"/v1/watch?path=a/c/d&format=ndjson&since="+last.ID)
+	defer closeStream()
+
+	if event := nextWatchEvent(t, events); event.Type != types.WatchEventOpenV1 || event.ID != last.ID {
+		t.Fatalf("Expected open event with ID %v but got: %+v", last.ID, event)
+	}
+
+	event := nextWatchEvent(t, events)
+	if exp := []types.PatchV1{{Op: "add", Path: "/a/c/d", Value: json.Number("3")}}; !reflect.DeepEqual(event.Patch, exp) {
+		t.Fatalf("Expected patch %v but got: %+v", exp, event)
+	}
+
+	// Tokens of other server runs cannot be resumed.
+	events2, closeStream2 := watchNDJSON(t, ts.URL+"/v1/watch?format=ndjson&since=abc-1")
+	defer closeStream2()
+
+	if event := nextWatchEvent(t, events2); event.Type != types.WatchEventResetV1 {
+		t.Fatalf("Expected reset event but got: %+v", event)
+	}
+
+	// Streams end on shutdown.
+	f.server.closeWatch()
+
+	if _, ok := <-events; ok {
+		t.Fatal("Expected stream to end")
+	}
+}
+
+func TestWatchSSE(t *testing.T) {
+
+	f := newFixture(t)
+	ts := httptest.NewServer(f.server.Handler)
+	defer ts.Close()
+	defer f.server.closeWatch()
+
+	resp, err := http.Get(ts.URL + "/v1/watch?heartbeat=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Unexpected content type: %v", ct)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+
+	var lines []string
+	for scanner.Scan() && scanner.Text() != ": heartbeat" {
+		lines = append(lines, scanner.Text())
+	}
+
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "id: ") || lines[1] != "event: open" || !strings.HasPrefix(lines[2], "data: {") || lines[3] != "" {
+		t.Fatalf("Unexpected stream: %q", lines)
+	}
+}
+
+func TestWatchBadRequest(t *testing.T) {
+
+	f := newFixture(t)
+
+	for _, query := range []string{"heartbeat=0s", "heartbeat=1ns", "heartbeat=999ms", "heartbeat=x", "format=xml", "since=1"} {
+		if err := f.v1(http.MethodGet, "/watch?"+query, "", 400, ""); err != nil {
+			t.Fatalf("%v: %v", query, err)
+		}
+	}
+}
+
+func TestWatchAuthorization(t *testing.T) {
+
+	ctx := context.Background()
+	store := inmem.NewFromObject(map[string]interface{}{"x": 1, "y": 2})
+
+	txn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+	authzPolicy := `package system.authz
+
+		default allow = false
+
+		allow {
+			input.method = "GET"
+			not denied
+		}
+
+		denied {
+			input.path[2] = "x"
+		}
+
+		denied {
+			input.path[2] = "system"
+		}
+		`
+	if err := store.UpsertPolicy(ctx, txn, "authz", []byte(authzPolicy)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Commit(ctx, txn); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFixtureWithStore(t, store, func(s *Server) {
+		s.WithAuthorization(AuthorizationBasic)
+	})
+	ts := httptest.NewServer(f.server.Handler)
+	defer ts.Close()
+	defer f.server.closeWatch()
+
+	// Watching is authorized like reading the watched document.
+	for _, path := range []string{"/data/x", "/watch?path=x", "/watch?path=x/a", "/watch?path=system/bundles"} {
+		if err := f.executeRequest(newReqV1(http.MethodGet, path, ""), 401, ""); err != nil {
+			t.Fatalf("%v: %v", path, err)
+		}
+	}
+
+	events, closeStream := watchNDJSON(t, ts.URL+"/v1/watch?path=y&format=ndjson")
+	defer closeStream()
+
+	if event := nextWatchEvent(t, events); event.Type != types.WatchEventOpenV1 {
+		t.Fatalf("Expected open event but got: %+v", event)
+	}
+}
+
+func TestWatchPointer(t *testing.T) {
+	if p := watchPointer([]string{"a", "b/c", "d~e"}); p != "/a/b~1c/d~0e" {
+		t.Fatalf("Unexpected pointer: %v", p)
+	}
+}
+
+// watchNDJSON opens an NDJSON watch stream and returns a channel of its
+// events. The channel is closed when the stream ends.
+func watchNDJSON(t *testing.T, url string) (<-chan types.WatchEventV1, func()) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status: %v", resp.Status)
+	}
+
+	ch := make(chan types.WatchEventV1, 100)
+
+	go func() {
+		defer close(ch)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var event types.WatchEventV1
+			if err := util.UnmarshalJSON(scanner.Bytes(), &event); err != nil {
+				panic(err)
+			}
+			ch <- event
+		}
+	}()
+
+	return ch, func() { resp.Body.Close() }
+}
+
+func nextWatchEvent(t *testing.T, events <-chan types.WatchEventV1) types.WatchEventV1 {
+	t.Helper()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("Stream ended")
+			}
+			if event.Type != types.WatchEventHeartbeatV1 {
+				return event
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for event")
+		}
+	}
+}
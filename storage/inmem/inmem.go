@@ -63,6 +63,14 @@ func NewFromReader(r io.Reader) storage.Store {
 	return NewFromObject(data)
 }
 
+// IsInMem returns true if store is an in-memory store returned by this
+// package. Read transactions of in-memory stores can be used by multiple
+// goroutines concurrently.
+func IsInMem(s storage.Store) bool {
+	_, ok := s.(*store)
+	return ok
+}
+
 type store struct {
 	rmu      sync.RWMutex                      // reader-writer lock
 	wmu      sync.Mutex                        // writer lock
@@ -0,0 +1,212 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/util"
+)
+
+const (
+	evalBudgetSteps         = "eval_budget_steps"
+	evalBudgetTermBytes     = "eval_budget_term_bytes"
+	evalBudgetResultBytes   = "eval_budget_result_bytes"
+	evalBudgetHTTPSendCalls = "eval_budget_http_send_calls"
+)
+
+// Budget defines limits on the resources that a single query may consume.
+// Zero values disable the corresponding limit. When a limit is exceeded,
+// evaluation stops with an Error that has the BudgetErr code.
+type Budget struct {
+
+	// MaxSteps limits the number of evaluation steps taken by the query. A
+	// step is taken each time an expression is evaluated (including
+	// expressions in rules, functions and comprehensions) and each time a
+	// body produces a result.
+	MaxSteps int64 `json:"max_steps,omitempty"`
+
+	// MaxTermBytes limits the estimated size of the values produced by
+	// built-in functions and comprehensions. Values are counted each time they
+	// are produced, even if they share structure with values produced
+	// earlier.
+	MaxTermBytes int64 `json:"max_term_bytes,omitempty"`
+
+	// MaxResultBytes limits the estimated JSON encoded size of the query
+	// results.
+	MaxResultBytes int64 `json:"max_result_bytes,omitempty"`
+
+	// MaxHTTPSendCalls limits the number of http.send calls made by the query.
+	MaxHTTPSendCalls int64 `json:"max_http_send_calls,omitempty"`
+}
+
+// ParseBudgetConfig returns the budget described by raw. If raw is nil, no
+// limits are applied.
+func ParseBudgetConfig(raw []byte) (*Budget, error) {
+
+	var b Budget
+
+	if raw == nil {
+		return &b, nil
+	}
+
+	if err := util.Unmarshal(raw, &b); err != nil {
+		return nil, err
+	}
+
+	return &b, b.Validate()
+}
+
+// Validate returns an error if any of the limits are negative.
+func (b Budget) Validate() error {
+	limits := []struct {
+		name  string
+		value int64
+	}{
+		{"max_steps", b.MaxSteps},
+		{"max_term_bytes", b.MaxTermBytes},
+		{"max_result_bytes", b.MaxResultBytes},
+		{"max_http_send_calls", b.MaxHTTPSendCalls},
+	}
+	for _, l := range limits {
+		if l.value < 0 {
+			return fmt.Errorf("budget %v must be non-negative", l.name)
+		}
+	}
+	return nil
+}
+
+// Enabled returns true if any of the limits are set.
+func (b Budget) Enabled() bool {
+	return b.MaxSteps > 0 || b.MaxTermBytes > 0 || b.MaxResultBytes > 0 || b.MaxHTTPSendCalls > 0
+}
+
+// budgetTracker records the resources consumed by a query. The tracker is
+// shared by all of the evals spawned for the query. A nil tracker imposes no
+// limits.
+type budgetTracker struct {
+	limits        Budget
+	steps         int64
+	termBytes     int64
+	resultBytes   int64
+	httpSendCalls int64
+}
+
+func newBudgetTracker(b *Budget) *budgetTracker {
+	if b == nil || !b.Enabled() {
+		return nil
+	}
+	return &budgetTracker{limits: *b}
+}
+
+func (t *budgetTracker) step(loc *ast.Location) error {
+	if t == nil || t.limits.MaxSteps == 0 {
+		return nil
+	}
+	return t.consume(loc, &t.steps, 1, t.limits.MaxSteps, "step")
+}
+
+func (t *budgetTracker) allocTerm(loc *ast.Location, v ast.Value) error {
+	if t == nil || t.limits.MaxTermBytes == 0 {
+		return nil
+	}
+	return t.consume(loc, &t.termBytes, valueSizeBytes(v), t.limits.MaxTermBytes, "term bytes")
+}
+
+func (t *budgetTracker) result(qr QueryResult) error {
+	if t == nil || t.limits.MaxResultBytes == 0 {
+		return nil
+	}
+	var n int64
+	for k, v := range qr {
+		n += int64(len(k)) + 3 + valueSizeBytes(v.Value)
+	}
+	return t.consume(nil, &t.resultBytes, n, t.limits.MaxResultBytes, "result bytes")
+}
+
+func (t *budgetTracker) httpSend(loc *ast.Location) error {
+	if t == nil || t.limits.MaxHTTPSendCalls == 0 {
+		return nil
+	}
+	return t.consume(loc, &t.httpSendCalls, 1, t.limits.MaxHTTPSendCalls, "http.send calls")
+}
+
+func (t *budgetTracker) consume(loc *ast.Location, counter *int64, n, limit int64, name string) error {
+	if atomic.AddInt64(counter, n) > limit {
+		return budgetExceededErr(loc, name, limit)
+	}
+	return nil
+}
+
+// report adds the resources consumed by the query to m. Only the resources
+// that are limited are reported.
+func (t *budgetTracker) report(m metrics.Metrics) {
+	if t == nil {
+		return
+	}
+	if t.limits.MaxSteps > 0 {
+		m.Counter(evalBudgetSteps).Add(uint64(atomic.LoadInt64(&t.steps)))
+	}
+	if t.limits.MaxTermBytes > 0 {
+		m.Counter(evalBudgetTermBytes).Add(uint64(atomic.LoadInt64(&t.termBytes)))
+	}
+	if t.limits.MaxResultBytes > 0 {
+		m.Counter(evalBudgetResultBytes).Add(uint64(atomic.LoadInt64(&t.resultBytes)))
+	}
+	if t.limits.MaxHTTPSendCalls > 0 {
+		m.Counter(evalBudgetHTTPSendCalls).Add(uint64(atomic.LoadInt64(&t.httpSendCalls)))
+	}
+}
+
+// valueSizeBytes returns an estimate of the size of the JSON encoding of v.
+func valueSizeBytes(v ast.Value) int64 {
+	switch v := v.(type) {
+	case ast.Null:
+		return 4
+	case ast.Boolean:
+		if v {
+			return 4
+		}
+		return 5
+	case ast.Number:
+		return int64(len(v))
+	case ast.String:
+		return int64(len(v)) + 2
+	case *ast.Array:
+		n := int64(2)
+		for i := 0; i < v.Len(); i++ {
+			n += valueSizeBytes(v.Elem(i).Value) + 1
+		}
+		return n
+	case ast.Set:
+		n := int64(2)
+		v.Foreach(func(x *ast.Term) {
+			n += valueSizeBytes(x.Value) + 1
+		})
+		return n
+	case ast.Object:
+		n := int64(2)
+		v.Foreach(func(k, x *ast.Term) {
+			n += valueSizeBytes(k.Value) + valueSizeBytes(x.Value) + 2
+		})
+		return n
+	default:
+		// Non-ground values (e.g., refs and vars in partial evaluation
+		// results) are estimated by their string representation.
+		return int64(len(v.String()))
+	}
+}
+
+func budgetExceededErr(loc *ast.Location, name string, limit int64) error {
+	return &Error{
+		Code:     BudgetErr,
+		Location: loc,
+		Message:  name + " budget exceeded (limit: " + strconv.FormatInt(limit, 10) + ")",
+	}
+}
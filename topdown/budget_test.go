@@ -0,0 +1,202 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/metrics"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
+)
+
+func TestBudget(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		note    string
+		module  string
+		query   string
+		budget  Budget
+		exp     string // expected error message, empty if query should succeed
+		metrics map[string]uint64
+	}{
+		{
+			note:    "steps within budget",
+			module:  `package test p { x := 1; x == 1 }`,
+			query:   `data.test.p = x`,
+			budget:  Budget{MaxSteps: 10},
+			metrics: map[string]uint64{evalBudgetSteps: 5},
+		},
+		{
+			note:   "steps exceeded",
+			module: `package test p { x := numbers.range(1, 100); count([y | y := x[_]]) > 0 }`,
+			query:  `data.test.p = x`,
+			budget: Budget{MaxSteps: 50},
+			exp:    "step budget exceeded (limit: 50)",
+		},
+		{
+			note:    "term bytes within budget",
+			module:  `package test p = y { y := concat("", ["a", "b"]) }`,
+			query:   `data.test.p = x`,
+			budget:  Budget{MaxTermBytes: 100},
+			metrics: map[string]uint64{evalBudgetTermBytes: 4},
+		},
+		{
+			note:   "term bytes with void built-in",
+			module: `package test p { print("x") }`,
+			query:  `data.test.p = x`,
+			budget: Budget{MaxTermBytes: 100},
+		},
+		{
+			note:   "term bytes exceeded by built-in",
+			module: `package test p { x := numbers.range(1, 1000); count(x) > 0 }`,
+			query:  `data.test.p = x`,
+			budget: Budget{MaxTermBytes: 1000},
+			exp:    "term bytes budget exceeded (limit: 1000)",
+		},
+		{
+			note:   "term bytes exceeded by walk",
+			module: `package test p { walk(input, [path, value]); false }`,
+			query:  `data.test.p = x`,
+			budget: Budget{MaxTermBytes: 200},
+			exp:    "term bytes budget exceeded (limit: 200)",
+		},
+		{
+			note:   "term bytes exceeded by comprehension",
+			module: `package test p { xs := {x: x | x := ["aaaaaaaaaa", "bbbbbbbbbb", "cccccccccc"][_]}; count(xs) > 0 }`,
+			query:  `data.test.p = x`,
+			budget: Budget{MaxTermBytes: 30},
+			exp:    "term bytes budget exceeded (limit: 30)",
+		},
+		{
+			note:    "result bytes within budget",
+			module:  `package test p = "abc"`,
+			query:   `data.test.p = x`,
+			budget:  Budget{MaxResultBytes: 10},
+			metrics: map[string]uint64{evalBudgetResultBytes: 9},
+		},
+		{
+			note:   "result bytes exceeded",
+			module: `package test p[x] { x := numbers.range(1, 100)[_] }`,
+			query:  `data.test.p[x]`,
+			budget: Budget{MaxResultBytes: 100},
+			exp:    "result bytes budget exceeded (limit: 100)",
+		},
+		{
+			note: "http.send calls within budget",
+			module: fmt.Sprintf(`package test p {
+				http.send({"method": "get", "url": %q}).status_code == 200
+			}`, ts.URL),
+			query:   `data.test.p = x`,
+			budget:  Budget{MaxHTTPSendCalls: 1},
+			metrics: map[string]uint64{evalBudgetHTTPSendCalls: 1},
+		},
+		{
+			note: "http.send calls exceeded",
+			module: fmt.Sprintf(`package test p {
+				http.send({"method": "get", "url": %q}).status_code == 200
+				http.send({"method": "get", "url": %q, "headers": {"x": "y"}}).status_code == 200
+			}`, ts.URL, ts.URL),
+			query:  `data.test.p = x`,
+			budget: Budget{MaxHTTPSendCalls: 1},
+			exp:    "http.send calls budget exceeded (limit: 1)",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			ctx := context.Background()
+			compiler := compileModules([]string{tc.module})
+			store := inmem.New()
+			txn := storage.NewTransactionOrDie(ctx, store)
+			defer store.Abort(ctx, txn)
+			m := metrics.New()
+
+			query := NewQuery(ast.MustParseBody(tc.query)).
+				WithCompiler(compiler).
+				WithStore(store).
+				WithTransaction(txn).
+				WithInput(ast.MustParseTerm(`{"a": [1, 2, 3], "b": {"c": ["d", "e", "f"]}, "g": "hhhhhhhhhhhhhhhh"}`)).
+				WithMetrics(m).
+				WithBudget(&tc.budget)
+
+			_, err := query.Run(ctx)
+
+			if tc.exp == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			} else {
+				if !IsBudgetExceeded(err) {
+					t.Fatalf("Expected budget error but got: %v", err)
+				}
+				if !strings.Contains(err.Error(), tc.exp) {
+					t.Fatalf("Expected error to contain %q but got: %v", tc.exp, err)
+				}
+			}
+
+			for name, exp := range tc.metrics {
+				if act := m.Counter(name).Value().(uint64); exp != act {
+					t.Errorf("Expected %v to be %d but got %d", name, exp, act)
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetStrictBuiltinErrorsDisabled(t *testing.T) {
+	// Budget errors raised by built-in functions must stop evaluation even if
+	// built-in errors are otherwise ignored.
+	ctx := context.Background()
+	compiler := compileModules([]string{`package test p { count(numbers.range(1, 1000)) > 0 } p { true }`})
+	store := inmem.New()
+	txn := storage.NewTransactionOrDie(ctx, store)
+	defer store.Abort(ctx, txn)
+
+	_, err := NewQuery(ast.MustParseBody(`data.test.p = x`)).
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(txn).
+		WithStrictBuiltinErrors(false).
+		WithBudget(&Budget{MaxTermBytes: 100}).
+		Run(ctx)
+
+	if !IsBudgetExceeded(err) {
+		t.Fatalf("Expected budget error but got: %v", err)
+	}
+}
+
+func TestParseBudgetConfig(t *testing.T) {
+
+	b, err := ParseBudgetConfig([]byte(`{"max_steps": 100, "max_http_send_calls": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := (Budget{MaxSteps: 100, MaxHTTPSendCalls: 2}); *b != exp {
+		t.Fatalf("Expected %+v but got %+v", exp, *b)
+	}
+
+	b, err = ParseBudgetConfig(nil)
+	if err != nil || b.Enabled() {
+		t.Fatalf("Expected disabled budget but got %+v (err: %v)", b, err)
+	}
+
+	_, err = ParseBudgetConfig([]byte(`{"max_term_bytes": -1}`))
+	if err == nil || err.Error() != "budget max_term_bytes must be non-negative" {
+		t.Fatalf("Expected validation error but got: %v", err)
+	}
+}
@@ -52,6 +52,7 @@ type (
 		PrintHook              print.Hook            // provides callback function to use for printing
 		DistributedTracingOpts tracing.Options       // options to be used by distributed tracing.
 		rand                   *rand.Rand            // randomization source for non-security-sensitive operations
+		budget                 *budgetTracker        // resource limits of query being evaluated
 		Capabilities           *ast.Capabilities
 	}
 
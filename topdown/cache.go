@@ -152,6 +152,10 @@ func (s *refStack) Pop() {
 	s.sl = s.sl[:len(s.sl)-1]
 }
 
+func (s *refStack) Copy() *refStack {
+	return &refStack{sl: append([]refStackElem(nil), s.sl...)}
+}
+
 func (s *refStack) Prefixed(ref ast.Ref) bool {
 	if s != nil {
 		for i := len(s.sl) - 1; i >= 0; i-- {
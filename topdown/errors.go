@@ -56,6 +56,10 @@ const (
 
 	// WithMergeErr indicates that the real and replacement data could not be merged.
 	WithMergeErr string = "eval_with_merge_error"
+
+	// BudgetErr indicates evaluation stopped because the query exceeded one of
+	// the limits set by its Budget.
+	BudgetErr string = "eval_budget_error"
 )
 
 // IsError returns true if the err is an Error.
@@ -69,6 +73,12 @@ func IsCancel(err error) bool {
 	return errors.Is(err, &Error{Code: CancelErr})
 }
 
+// IsBudgetExceeded returns true if err was caused by the query exceeding its
+// budget.
+func IsBudgetExceeded(err error) bool {
+	return errors.Is(err, &Error{Code: BudgetErr})
+}
+
 // Is allows matching topdown errors using errors.Is (see IsCancel).
 func (e *Error) Is(target error) bool {
 	var t *Error
@@ -63,6 +63,11 @@ func TestErrorWrapping(t *testing.T) {
 			err:   fmt.Errorf("meh: %w", &topdown.Error{Code: topdown.CancelErr}),
 			check: topdown.IsCancel,
 		},
+		{
+			note:  "wrapped budget exceeded",
+			err:   fmt.Errorf("meh: %w", topdown.Halt{Err: &topdown.Error{Code: topdown.BudgetErr}}),
+			check: topdown.IsBudgetExceeded,
+		},
 		{
 			note: "matching errors, code",
 			err:  &e0,
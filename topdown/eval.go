@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/meta-quick/opax/ast"
 	"github.com/meta-quick/opax/metrics"
@@ -26,11 +27,10 @@ type queryIDFactory struct {
 	curr uint64
 }
 
-// Note: The first call to Next() returns 0.
+// Note: The first call to Next() returns 0. Next is safe to call from the
+// goroutines that evaluate rules in parallel.
 func (f *queryIDFactory) Next() uint64 {
-	curr := f.curr
-	f.curr++
-	return curr
+	return atomic.AddUint64(&f.curr, 1) - 1
 }
 
 type builtinErrors struct {
@@ -57,6 +57,8 @@ type eval struct {
 	parent                 *eval
 	caller                 *eval
 	cancel                 Cancel
+	budget                 *budgetTracker
+	parallelism            *parallelism
 	query                  ast.Body
 	queryCompiler          ast.QueryCompiler
 	index                  int
@@ -301,6 +303,10 @@ func (e *eval) evalExpr(iter evalIterator) error {
 		}
 	}
 
+	if err := e.budget.step(e.query.Loc()); err != nil {
+		return err
+	}
+
 	if e.index >= len(e.query) {
 		err := iter(e)
 		if err != nil {
@@ -725,6 +731,7 @@ func (e *eval) evalCall(terms []*ast.Term, iter unifyIterator) error {
 		PrintHook:              e.printHook,
 		DistributedTracingOpts: e.tracingOpts,
 		Capabilities:           capabilities,
+		budget:                 e.budget,
 	}
 
 	eval := evalBuiltin{
@@ -1158,7 +1165,11 @@ func (e *eval) biunifyComprehensionArray(x *ast.ArrayComprehension, b *ast.Term,
 	result := ast.NewArray()
 	child := e.closure(x.Body)
 	err := child.Run(func(child *eval) error {
-		result = result.Append(child.bindings.Plug(x.Term))
+		term := child.bindings.Plug(x.Term)
+		if err := e.budget.allocTerm(x.Term.Location, term.Value); err != nil {
+			return err
+		}
+		result = result.Append(term)
 		return nil
 	})
 	if err != nil {
@@ -1171,7 +1182,11 @@ func (e *eval) biunifyComprehensionSet(x *ast.SetComprehension, b *ast.Term, b1,
 	result := ast.NewSet()
 	child := e.closure(x.Body)
 	err := child.Run(func(child *eval) error {
-		result.Add(child.bindings.Plug(x.Term))
+		term := child.bindings.Plug(x.Term)
+		if err := e.budget.allocTerm(x.Term.Location, term.Value); err != nil {
+			return err
+		}
+		result.Add(term)
 		return nil
 	})
 	if err != nil {
@@ -1190,6 +1205,12 @@ func (e *eval) biunifyComprehensionObject(x *ast.ObjectComprehension, b *ast.Ter
 		if exist != nil && !exist.Equal(value) {
 			return objectDocKeyConflictErr(x.Key.Location)
 		}
+		if err := e.budget.allocTerm(x.Key.Location, key.Value); err != nil {
+			return err
+		}
+		if err := e.budget.allocTerm(x.Value.Location, value.Value); err != nil {
+			return err
+		}
 		result.Insert(key, value)
 		return nil
 	})
@@ -1348,6 +1369,21 @@ func (e *eval) getRules(ref ast.Ref, args []*ast.Term) (*ast.IndexResult, error)
 	if result.EarlyExit {
 		msg.WriteString(", early exit")
 	}
+	if len(result.Hits) > 0 {
+		kinds := make([]string, 0, len(result.Hits))
+		for kind := range result.Hits {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		msg.WriteString(", index hits:")
+		for _, kind := range kinds {
+			msg.WriteRune(' ')
+			msg.WriteString(kind)
+			msg.WriteRune('=')
+			msg.WriteString(strconv.Itoa(result.Hits[kind]))
+			e.metrics.Counter(ruleIndexHitsCounterPrefix + kind).Add(uint64(result.Hits[kind]))
+		}
+	}
 	msg.WriteRune(')')
 	e.traceIndex(e.query[e.index], msg.String(), &ref)
 	return result, err
@@ -1592,6 +1628,12 @@ func (e evalBuiltin) eval(iter unifyIterator) error {
 
 		e.e.instr.stopTimer(evalOpBuiltinCall)
 
+		if output != nil {
+			if err := e.e.budget.allocTerm(e.bctx.Location, output.Value); err != nil {
+				return Halt{Err: err}
+			}
+		}
+
 		var err error
 
 		if e.bi.Decl.Result() == nil {
@@ -2241,24 +2283,53 @@ func (e evalVirtualPartial) evalAllRules(iter unifyIterator, rules []*ast.Rule)
 }
 
 func (e evalVirtualPartial) evalAllRulesNoCache(rules []*ast.Rule) (*ast.Term, error) {
+
+	if e.e.parallel(len(rules)) {
+		return e.evalAllRulesParallel(rules)
+	}
+
 	result := e.empty
 
 	for _, rule := range rules {
-		child := e.e.child(rule.Body)
-		child.traceEnter(rule)
-		err := child.eval(func(*eval) error {
-			child.traceExit(rule)
-			var err error
-			result, _, err = e.reduce(rule.Head, child.bindings, result)
-			if err != nil {
-				return err
-			}
+		var err error
+		result, err = e.evalOneRuleAll(e.e, rule, result)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			child.traceRedo(rule)
-			return nil
+	return result, nil
+}
+
+// evalAllRulesParallel evaluates each rule on a fork of the eval and merges
+// the results in rule order so that the result (and any conflict error) is
+// the same as if the rules had been evaluated serially.
+func (e evalVirtualPartial) evalAllRulesParallel(rules []*ast.Rule) (*ast.Term, error) {
+
+	results := make([]*ast.Term, len(rules))
+	group := newParallelGroup(e.e)
+
+	for i := range rules {
+		i := i
+		group.Go(func(fork *eval) error {
+			var err error
+			results[i], err = e.evalOneRuleAll(fork, rules[i], e.empty.Copy())
+			return err
 		})
+	}
 
-		if err != nil {
+	errs := group.Wait()
+	result := e.empty
+
+	for i, rule := range rules {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if results[i] == nil {
+			// The rule was cancelled because an earlier rule failed.
+			continue
+		}
+		if err := e.merge(rule.Head, result, results[i]); err != nil {
 			return nil, err
 		}
 	}
@@ -2266,6 +2337,30 @@ func (e evalVirtualPartial) evalAllRulesNoCache(rules []*ast.Rule) (*ast.Term, e
 	return result, nil
 }
 
+func (e evalVirtualPartial) evalOneRuleAll(parent *eval, rule *ast.Rule, result *ast.Term) (*ast.Term, error) {
+
+	child := parent.child(rule.Body)
+	child.traceEnter(rule)
+
+	err := child.eval(func(*eval) error {
+		child.traceExit(rule)
+		var err error
+		result, _, err = e.reduce(rule.Head, child.bindings, result)
+		if err != nil {
+			return err
+		}
+
+		child.traceRedo(rule)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (e evalVirtualPartial) evalOneRulePreUnify(iter unifyIterator, rule *ast.Rule, hint evalVirtualPartialCacheHint, result *ast.Term, unknown bool) error {
 
 	key := e.ref[e.pos+1]
@@ -2527,6 +2622,29 @@ func (e evalVirtualPartial) reduce(head *ast.Head, b *bindings, result *ast.Term
 	return result, exists, nil
 }
 
+// merge adds the keys (and values) of the partial result produced by a single
+// rule to result.
+func (e evalVirtualPartial) merge(head *ast.Head, result, partial *ast.Term) error {
+	switch v := result.Value.(type) {
+	case ast.Set:
+		partial.Value.(ast.Set).Foreach(func(x *ast.Term) {
+			v.Add(x)
+		})
+	case ast.Object:
+		return partial.Value.(ast.Object).Iter(func(k, x *ast.Term) error {
+			if curr := v.Get(k); curr != nil {
+				if !curr.Equal(x) {
+					return objectDocKeyConflictErr(head.Location)
+				}
+				return nil
+			}
+			v.Insert(k, x)
+			return nil
+		})
+	}
+	return nil
+}
+
 type evalVirtualComplete struct {
 	e         *eval
 	ref       ast.Ref
@@ -5,6 +5,7 @@
 package topdown
 
 import (
+	"bytes"
 	"context"
 	"testing"
 
@@ -443,3 +444,53 @@ func TestTopdownVirtualCache(t *testing.T) {
 		})
 	}
 }
+
+func TestRuleIndexHits(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+
+	module := `package test
+		p { startswith(input.path, "/finance/") }
+		p { startswith(input.path, "/hr/") }
+		p { net.cidr_contains("10.0.0.0/8", input.addr) }
+		p { input.level > 3 }
+	`
+
+	compiler := compileModules([]string{module})
+	txn := storage.NewTransactionOrDie(ctx, store)
+	defer store.Abort(ctx, txn)
+	m := metrics.New()
+	tracer := NewBufferTracer()
+
+	query := NewQuery(ast.MustParseBody("data.test.p = x")).
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(txn).
+		WithInput(ast.MustParseTerm(`{"path": "/finance/q1", "addr": "192.168.0.1", "level": 1}`)).
+		WithTracer(tracer).
+		WithMetrics(m)
+
+	qrs, err := query.Run(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exp, act := 1, len(qrs); exp != act {
+		t.Fatalf("expected %d query result, got %d query results: %+v", exp, act, qrs)
+	}
+
+	var found bool
+	for _, evt := range *tracer {
+		if evt.Op == IndexOp && evt.Message == "(matched 1 rule, early exit, index hits: prefix=1)" {
+			found = true
+		}
+	}
+	if !found {
+		var buf bytes.Buffer
+		PrettyTrace(&buf, *tracer)
+		t.Fatalf("expected index trace event with hits, got:\n%v", buf.String())
+	}
+
+	if exp, act := uint64(1), m.Counter(ruleIndexHitsCounterPrefix+ast.IndexHitPrefix).Value().(uint64); exp != act {
+		t.Errorf("expected %d prefix hits, got %d", exp, act)
+	}
+}
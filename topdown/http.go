@@ -101,6 +101,10 @@ func builtinHTTPSend(bctx BuiltinContext, args []*ast.Term, iter func(*ast.Term)
 		return handleBuiltinErr(ast.HTTPSend.Name, bctx.Location, err)
 	}
 
+	if err := bctx.budget.httpSend(bctx.Location); err != nil {
+		return Halt{Err: err}
+	}
+
 	result, err := getHTTPResponse(bctx, req)
 	if err != nil {
 		if raiseError {
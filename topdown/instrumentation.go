@@ -25,6 +25,12 @@ const (
 	partialOpCopyPropagation      = "partial_op_copy_propagation"
 )
 
+// ruleIndexHitsCounterPrefix prefixes the names of the counters that report
+// how many prefix, glob, CIDR and range index nodes matched during rule index
+// lookups. Unlike the instrumentation metrics above, these counters are always
+// recorded.
+const ruleIndexHitsCounterPrefix = "eval_op_rule_index_hits_"
+
 // Instrumentation implements helper functions to instrument query evaluation
 // to diagnose performance issues. Instrumentation may be expensive in some
 // cases, so it is disabled by default.
@@ -0,0 +1,242 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/topdown/builtins"
+)
+
+// parallelism bounds the number of goroutines that evaluate independent rule
+// bodies concurrently. It is shared by all of the evals spawned for a query.
+// The goroutine that runs the query counts towards the limit, so a limit of n
+// allows up to n-1 additional goroutines. Tasks that cannot be handed to a
+// goroutine are evaluated by the caller, which means nested parallel sections
+// never wait on each other.
+type parallelism struct {
+	sem chan struct{}
+}
+
+func newParallelism(n int) *parallelism {
+	if n <= 1 {
+		return nil
+	}
+	return &parallelism{sem: make(chan struct{}, n-1)}
+}
+
+func (p *parallelism) tryAcquire() bool {
+	select {
+	case p.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *parallelism) release() {
+	<-p.sem
+}
+
+// parallel returns true if n independent tasks should be evaluated
+// concurrently. Partial evaluation and instrumentation rely on state that
+// cannot be shared across goroutines, so they always evaluate serially.
+func (e *eval) parallel(n int) bool {
+	return e.parallelism != nil && n > 1 && !e.partial() && e.instr == nil
+}
+
+// lockedReader serializes reads from a seed shared by forks. Callers may
+// supply seeds (e.g., math/rand sources) that are not safe for concurrent use.
+type lockedReader struct {
+	mtx sync.Mutex
+	r   io.Reader
+}
+
+func (r *lockedReader) Read(p []byte) (int, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.r.Read(p)
+}
+
+// fork returns a copy of e that can be evaluated on another goroutine while e
+// is suspended. The copy shares the read-only state of e (compiler, store
+// transaction, input, bindings, inter-query cache, etc.) but gets its own
+// intra-query caches, built-in errors and trace buffer. Trace events, built-in
+// errors and built-in cache entries are handed back to e when the parallel
+// group finishes. The seed is wrapped so that e and all of its forks share one
+// lockedReader.
+func (e *eval) fork(cancel Cancel) (*eval, *BufferTracer) {
+	if _, ok := e.seed.(*lockedReader); !ok && e.seed != nil {
+		e.seed = &lockedReader{r: e.seed}
+	}
+	cpy := *e
+	cpy.cancel = cancel
+	cpy.baseCache = newBaseCache()
+	cpy.virtualCache = newVirtualCache()
+	cpy.comprehensionCache = newComprehensionCache()
+	cpy.builtinCache = copyBuiltinCache(e.builtinCache)
+	cpy.builtinErrors = &builtinErrors{}
+	cpy.targetStack = e.targetStack.Copy()
+
+	var buf *BufferTracer
+	if e.traceEnabled {
+		buf = NewBufferTracer()
+		cpy.tracers = []QueryTracer{buf}
+	}
+
+	return &cpy, buf
+}
+
+// parallelGroup evaluates a set of tasks on forks of an eval. Results are
+// reported in the order the tasks were added regardless of the order in which
+// they complete. If a task fails, the tasks added after it are cancelled;
+// tasks added before it run to completion so that the first error in task
+// order is the same error that serial evaluation would return.
+type parallelGroup struct {
+	e      *eval
+	parent Cancel
+	failed int64
+	wg     sync.WaitGroup
+	tasks  []*parallelTask
+}
+
+type parallelTask struct {
+	group  *parallelGroup
+	index  int64
+	fork   *eval
+	tracer *BufferTracer
+	err    error
+}
+
+func newParallelGroup(e *eval) *parallelGroup {
+	return &parallelGroup{
+		e:      e,
+		parent: e.cancel,
+		failed: math.MaxInt64,
+	}
+}
+
+// Go runs f on a new fork of the group's eval. If the worker pool is
+// exhausted, f runs on the calling goroutine before Go returns.
+func (g *parallelGroup) Go(f func(*eval) error) {
+
+	t := &parallelTask{group: g, index: int64(len(g.tasks))}
+	t.fork, t.tracer = g.e.fork(t)
+	g.tasks = append(g.tasks, t)
+
+	run := func() {
+		if t.err = f(t.fork); t.err != nil {
+			t.Cancel()
+		}
+	}
+
+	if !g.e.parallelism.tryAcquire() {
+		run()
+		return
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.e.parallelism.release()
+		run()
+	}()
+}
+
+// Wait waits for all tasks to finish, replays their trace events and built-in
+// errors onto the group's eval in task order, and returns the error of each
+// task. Errors caused by an earlier task failing are omitted so that callers
+// see the original error.
+func (g *parallelGroup) Wait() []error {
+
+	g.wg.Wait()
+
+	errs := make([]error, len(g.tasks))
+
+	for i, t := range g.tasks {
+
+		if t.tracer != nil {
+			for _, evt := range *t.tracer {
+				for _, tracer := range g.e.tracers {
+					tracer.TraceEvent(*evt)
+				}
+			}
+		}
+
+		g.e.builtinErrors.errs = append(g.e.builtinErrors.errs, t.fork.builtinErrors.errs...)
+		mergeBuiltinCache(g.e.builtinCache, t.fork.builtinCache)
+
+		if t.err != nil && !t.induced(t.err) {
+			errs[i] = t.err
+		}
+	}
+
+	return errs
+}
+
+// Cancel marks the task as failed which cancels the tasks added after it.
+func (t *parallelTask) Cancel() {
+	for {
+		curr := atomic.LoadInt64(&t.group.failed)
+		if curr <= t.index || atomic.CompareAndSwapInt64(&t.group.failed, curr, t.index) {
+			return
+		}
+	}
+}
+
+// Cancelled returns true if the query was cancelled or a task added before
+// this one failed.
+func (t *parallelTask) Cancelled() bool {
+	return atomic.LoadInt64(&t.group.failed) < t.index || (t.group.parent != nil && t.group.parent.Cancelled())
+}
+
+// induced returns true if err was caused by an earlier task failing (as
+// opposed to the query being cancelled.)
+func (t *parallelTask) induced(err error) bool {
+	return IsCancel(err) && (t.group.parent == nil || !t.group.parent.Cancelled())
+}
+
+// copyBuiltinCache returns a copy of the built-in cache that a fork can update
+// without affecting other forks. Forks see the values that were cached before
+// the fork but do not see each other's values, so identical calls in rules
+// that are evaluated in parallel are not deduplicated. The http.send cache is
+// a nested map and copied as well.
+func copyBuiltinCache(c builtins.Cache) builtins.Cache {
+	cpy := make(builtins.Cache, len(c))
+	for k, v := range c {
+		if vm, ok := v.(*ast.ValueMap); ok {
+			v = vm.Copy()
+		}
+		cpy[k] = v
+	}
+	return cpy
+}
+
+// mergeBuiltinCache adds the entries of the fork's cache to the parent's cache.
+// Forks are merged in task order and existing entries are kept, so the first
+// value in rule order is used by the rest of the query.
+func mergeBuiltinCache(parent, fork builtins.Cache) {
+	for k, v := range fork {
+		curr, ok := parent[k]
+		if !ok {
+			parent[k] = v
+			continue
+		}
+		dst, ok1 := curr.(*ast.ValueMap)
+		src, ok2 := v.(*ast.ValueMap)
+		if ok1 && ok2 {
+			src.Iter(func(k, v ast.Value) bool {
+				if dst.Get(k) == nil {
+					dst.Put(k, v)
+				}
+				return false
+			})
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright 2022 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meta-quick/opax/ast"
+	"github.com/meta-quick/opax/storage"
+	"github.com/meta-quick/opax/storage/inmem"
+	"github.com/meta-quick/opax/topdown/cache"
+	"github.com/meta-quick/opax/util"
+)
+
+func TestParallelEvalMatchesSerial(t *testing.T) {
+
+	data := util.MustUnmarshalJSON([]byte(`{
+		"users": {
+			"alice": {"roles": ["admin", "dev"], "teams": ["a", "b"]},
+			"bob": {"roles": ["dev"], "teams": ["b"]},
+			"carol": {"roles": ["ops"], "teams": ["c"]}
+		}
+	}`)).(map[string]interface{})
+
+	tests := []struct {
+		note   string
+		module string
+		query  string
+	}{
+		{
+			note: "partial set",
+			module: `package test
+				p[x] { data.users[x].roles[_] == "admin" }
+				p[x] { data.users[x].roles[_] == "dev" }
+				p[x] { data.users[x].teams[_] == "c" }
+				p["static"]`,
+			query: `x = data.test.p`,
+		},
+		{
+			note: "partial object",
+			module: `package test
+				p[x] = y { y := data.users[x].roles }
+				p["count"] = n { n := count(data.users) }
+				p[x] = y { x := data.users[_].teams[_]; y := true }`,
+			query: `x = data.test.p`,
+		},
+		{
+			note: "iteration order",
+			module: `package test
+				p[x] { x := numbers.range(1, 50)[_] }
+				p[x] { x := numbers.range(25, 100)[_] }
+				p[x] { x := data.users[_].teams[_] }`,
+			query: `x = [y | data.test.p[y]]`,
+		},
+		{
+			note: "nested",
+			module: `package test
+				p[x] { q[x] }
+				p[x] { r[x] }
+				q[x] { x := data.users[_].roles[_] }
+				q[x] { x := "q" }
+				r[x] { x := data.users[_].teams[_] }
+				r[x] { q[y]; x := concat("-", ["r", y]) }`,
+			query: `x = data.test.p`,
+		},
+		{
+			note: "with",
+			module: `package test
+				p[x] { x := input.a }
+				p[x] { x := input.b }
+				q = y { y := p with input as {"a": 1, "b": 2} }`,
+			query: `x = data.test.q`,
+		},
+		{
+			note: "comprehensions",
+			module: `package test
+				p[x] { x := {y | y := data.users[_].roles[_]} }
+				p[x] { x := [y | y := data.users[_].teams[_]] }
+				p[x] { x := {k: v | v := data.users[k].roles[0]} }`,
+			query: `x = data.test.p`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			serial, err := runParallelTestQuery(tc.module, tc.query, data, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range []int{2, 4, 16} {
+				parallel, err := runParallelTestQuery(tc.module, tc.query, data, n)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if serial.String() != parallel.String() {
+					t.Fatalf("Expected parallelism %d to produce:\n\n%v\n\nGot:\n\n%v", n, serial, parallel)
+				}
+			}
+		})
+	}
+}
+
+func runParallelTestQuery(module, query string, data map[string]interface{}, n int, opts ...func(*Query) *Query) (*ast.Term, error) {
+	ctx := context.Background()
+	compiler := compileModules([]string{module})
+	store := inmem.NewFromObject(data)
+	txn := storage.NewTransactionOrDie(ctx, store)
+	defer store.Abort(ctx, txn)
+
+	q := NewQuery(ast.MustParseBody(query)).
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(txn).
+		WithParallelism(n)
+
+	for _, opt := range opts {
+		q = opt(q)
+	}
+
+	qrs, err := q.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(qrs) != 1 {
+		return nil, fmt.Errorf("expected exactly one result but got: %v", qrs)
+	}
+
+	return qrs[0][ast.Var("x")], nil
+}
+
+func TestParallelEvalErrors(t *testing.T) {
+
+	tests := []struct {
+		note   string
+		module string
+		strict bool
+		code   string
+		msg    string
+	}{
+		{
+			note: "conflict across rules",
+			module: `package test
+				p["a"] = 1
+				p["b"] = 2
+				p["a"] = 3`,
+			code: ConflictErr,
+			msg:  `p["a"] = 3: eval_conflict_error: object keys must be unique`,
+		},
+		{
+			note: "first error in rule order",
+			module: `package test
+				p[x] { x := numbers.range(1, 1000)[_] }
+				p[x] { x := 1 / 0 }
+				p[x] { x := to_number("x") }`,
+			strict: true,
+			code:   BuiltinErr,
+			msg:    "div: divide by zero",
+		},
+		{
+			note: "built-in errors are merged",
+			module: `package test
+				p[x] { x := 1 }
+				p[x] { x := to_number("x") }`,
+			strict: true,
+			code:   BuiltinErr,
+			msg:    "to_number: strconv.ParseFloat",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			for _, n := range []int{1, 4} {
+				_, err := runParallelTestQuery(tc.module, "x = data.test.p", nil, n, func(q *Query) *Query {
+					return q.WithStrictBuiltinErrors(tc.strict)
+				})
+				e, ok := err.(*Error)
+				if !ok || e.Code != tc.code || !strings.Contains(err.Error(), tc.msg) {
+					t.Fatalf("Expected %v error containing %q with parallelism %d but got: %v", tc.code, tc.msg, n, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParallelEvalCancel(t *testing.T) {
+
+	module := `package test
+		p[x] { x := numbers.range(1, 100000)[_]; x < 0 }
+		p[x] { x := numbers.range(1, 100000)[_]; x < 0 }`
+
+	cancel := NewCancel()
+	cancel.Cancel()
+
+	_, err := runParallelTestQuery(module, "x = data.test.p", nil, 4, func(q *Query) *Query {
+		return q.WithCancel(cancel)
+	})
+
+	if !IsCancel(err) {
+		t.Fatalf("Expected cancel error but got: %v", err)
+	}
+}
+
+// racySeed fails if it is read concurrently.
+type racySeed struct {
+	reading int32
+}
+
+func (r *racySeed) Read(p []byte) (int, error) {
+	if !atomic.CompareAndSwapInt32(&r.reading, 0, 1) {
+		return 0, fmt.Errorf("concurrent read")
+	}
+	defer atomic.StoreInt32(&r.reading, 0)
+	time.Sleep(time.Millisecond)
+	for i := range p {
+		p[i] = byte(i)
+	}
+	return len(p), nil
+}
+
+func TestParallelEvalSharedSeed(t *testing.T) {
+
+	var rules []string
+	for i := 0; i < 8; i++ {
+		rules = append(rules, fmt.Sprintf(`p[x] { x := uuid.rfc4122("%d") }`, i))
+	}
+
+	module := "package test\n" + strings.Join(rules, "\n")
+
+	result, err := runParallelTestQuery(module, "x = data.test.p", nil, 8, func(q *Query) *Query {
+		return q.WithSeed(&racySeed{}).WithStrictBuiltinErrors(true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := result.Value.(ast.Set).Len(); n != 1 {
+		t.Fatalf("Expected 1 result but got %d", n)
+	}
+}
+
+func TestParallelEvalTracing(t *testing.T) {
+
+	module := `package test
+		p[x] { x := 1 }
+		p[x] { x := 2; x > 1 }
+		p[x] { x := 3; false }`
+
+	traceOps := func(n int) []string {
+		buf := NewBufferTracer()
+		_, err := runParallelTestQuery(module, "x = data.test.p", nil, n, func(q *Query) *Query {
+			return q.WithQueryTracer(buf)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops := make([]string, len(*buf))
+		for i, evt := range *buf {
+			ops[i] = fmt.Sprintf("%v %v", evt.Op, evt.Node)
+		}
+		return ops
+	}
+
+	serial, parallel := traceOps(1), traceOps(4)
+
+	if strings.Join(serial, "\n") != strings.Join(parallel, "\n") {
+		t.Fatalf("Expected trace:\n\n%v\n\nGot:\n\n%v", strings.Join(serial, "\n"), strings.Join(parallel, "\n"))
+	}
+}
+
+func TestParallelEvalInterQueryCache(t *testing.T) {
+
+	var requests int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Cache-Control", "max-age=290304000, public")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"path": "` + r.URL.Path + `"}`))
+	}))
+	defer ts.Close()
+
+	var rules []string
+	for i := 0; i < 8; i++ {
+		rules = append(rules, fmt.Sprintf(`p[x] { x := http.send({"method": "get", "url": "%v/%d", "cache": true, "force_json_decode": true}).body.path }`, ts.URL, i))
+	}
+
+	module := "package test\n" + strings.Join(rules, "\n")
+	config, _ := cache.ParseCachingConfig(nil)
+	interQueryCache := cache.NewInterQueryCache(config)
+
+	for i := 0; i < 2; i++ {
+		result, err := runParallelTestQuery(module, "x = data.test.p", nil, 4, func(q *Query) *Query {
+			return q.WithInterQueryBuiltinCache(interQueryCache)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := result.Value.(ast.Set).Len(); n != 8 {
+			t.Fatalf("Expected 8 results but got %d", n)
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 8 {
+		t.Fatalf("Expected 8 requests but got %d", n)
+	}
+}
+
+func TestParallelEvalBuiltinCache(t *testing.T) {
+
+	requests := map[string]*int32{"/before": new(int32), "/during": new(int32)}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests[r.URL.Path], 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	module := fmt.Sprintf(`package test
+		p[1] { http.send({"method": "get", "url": "%[1]v/before"}).status_code == 200 }
+		p[2] { http.send({"method": "get", "url": "%[1]v/before"}).status_code == 200 }
+		p[3] { http.send({"method": "get", "url": "%[1]v/during"}).status_code == 200 }`, ts.URL)
+
+	// Values cached before the rules are evaluated in parallel are seen by
+	// every rule and values cached by the rules are seen afterwards.
+	query := fmt.Sprintf(`http.send({"method": "get", "url": "%[1]v/before"}, _)
+		x = data.test.p
+		http.send({"method": "get", "url": "%[1]v/during"}, _)`, ts.URL)
+
+	result, err := runParallelTestQuery(module, query, nil, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := result.Value.(ast.Set).Len(); n != 3 {
+		t.Fatalf("Expected 3 results but got %d", n)
+	}
+
+	for path, n := range requests {
+		if *n != 1 {
+			t.Fatalf("Expected 1 request to %v but got %d", path, *n)
+		}
+	}
+}
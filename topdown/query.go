@@ -55,6 +55,8 @@ type Query struct {
 	strictBuiltinErrors    bool
 	printHook              print.Hook
 	tracingOpts            tracing.Options
+	budget                 *Budget
+	parallelism            int
 }
 
 // Builtin represents a built-in function that queries can call.
@@ -248,6 +250,27 @@ func (q *Query) WithStrictBuiltinErrors(yes bool) *Query {
 	return q
 }
 
+// WithBudget sets the limits on the resources that the query may consume. This
+// is optional.
+func (q *Query) WithBudget(b *Budget) *Query {
+	q.budget = b
+	return q
+}
+
+// WithParallelism enables parallel evaluation of the rules that define the
+// same partial set or partial object. At most n goroutines (including the
+// caller's) evaluate the query at any time. Results are merged in rule order
+// so the outcome is the same as serial evaluation. Parallel evaluation
+// requires the store, resolvers and print hook to be safe for concurrent use
+// and is not applied during partial evaluation or when instrumentation is
+// enabled. Comprehensions and the bodies of complete rules and functions are
+// always evaluated serially. This is optional; by default rules are evaluated
+// serially.
+func (q *Query) WithParallelism(n int) *Query {
+	q.parallelism = n
+	return q
+}
+
 // WithResolver configures an external resolver to use for the given ref.
 func (q *Query) WithResolver(ref ast.Ref, r resolver.Resolver) *Query {
 	q.external.Put(ref, r)
@@ -287,12 +310,15 @@ func (q *Query) PartialRun(ctx context.Context) (partials []ast.Body, support []
 	}
 	f := &queryIDFactory{}
 	b := newBindings(0, q.instr)
+	budget := newBudgetTracker(q.budget)
 	e := &eval{
 		ctx:                    ctx,
 		metrics:                q.metrics,
 		seed:                   q.seed,
 		time:                   ast.NumberTerm(int64ToJSONNumber(q.time.UnixNano())),
 		cancel:                 q.cancel,
+		budget:                 budget,
+		parallelism:            newParallelism(q.parallelism),
 		query:                  q.query,
 		queryCompiler:          q.queryCompiler,
 		queryIDFact:            f,
@@ -337,6 +363,7 @@ func (q *Query) PartialRun(ctx context.Context) (partials []ast.Body, support []
 	e.caller = e
 	q.metrics.Timer(metrics.RegoPartialEval).Start()
 	defer q.metrics.Timer(metrics.RegoPartialEval).Stop()
+	defer budget.report(q.metrics)
 
 	livevars := ast.NewVarSet()
 
@@ -427,12 +454,15 @@ func (q *Query) Iter(ctx context.Context, iter func(QueryResult) error) error {
 		q.metrics = metrics.New()
 	}
 	f := &queryIDFactory{}
+	budget := newBudgetTracker(q.budget)
 	e := &eval{
 		ctx:                    ctx,
 		metrics:                q.metrics,
 		seed:                   q.seed,
 		time:                   ast.NumberTerm(int64ToJSONNumber(q.time.UnixNano())),
 		cancel:                 q.cancel,
+		budget:                 budget,
+		parallelism:            newParallelism(q.parallelism),
 		query:                  q.query,
 		queryCompiler:          q.queryCompiler,
 		queryIDFact:            f,
@@ -470,9 +500,14 @@ func (q *Query) Iter(ctx context.Context, iter func(QueryResult) error) error {
 			qr[k.Value.(ast.Var)] = v
 			return nil
 		}) // cannot return error
+		if err := budget.result(qr); err != nil {
+			return err
+		}
 		return iter(qr)
 	})
 
+	budget.report(q.metrics)
+
 	if q.strictBuiltinErrors && err == nil && len(e.builtinErrors.errs) > 0 {
 		err = e.builtinErrors.errs[0]
 	}
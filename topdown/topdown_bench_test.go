@@ -8,10 +8,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/meta-quick/opax/ast"
 	"github.com/meta-quick/opax/metrics"
@@ -710,6 +713,52 @@ func BenchmarkFunctionArgumentIndex(b *testing.B) {
 	}
 }
 
+func BenchmarkConditionIndexing(b *testing.B) {
+	ctx := context.Background()
+
+	sizes := []int{10, 100, 1000, 10000}
+
+	for _, n := range sizes {
+		compiler := ast.MustCompileModules(map[string]string{
+			"test.rego": moduleWithPrefixes(n),
+		})
+		body := ast.MustParseBody("data.test.p = x")
+		input := ast.MustParseTerm(fmt.Sprintf(`{"path": "/tenants/%d/docs"}`, n-1))
+
+		for _, indexing := range []bool{true, false} {
+			b.Run(fmt.Sprintf("%d/indexing=%v", n, indexing), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					q := NewQuery(body).
+						WithCompiler(compiler).
+						WithInput(input).
+						WithIndexing(indexing)
+
+					res, err := q.Run(ctx)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					if len(res) != 1 {
+						b.Fatalf("Expected one result, got %d", len(res))
+					}
+				}
+			})
+		}
+	}
+}
+
+func moduleWithPrefixes(n int) string {
+	var b strings.Builder
+
+	b.WriteString(`package test
+`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `p { startswith(input.path, "/tenants/%d/") }
+`, i)
+	}
+	return b.String()
+}
+
 func moduleWithDefs(n int) string {
 	var b strings.Builder
 
@@ -729,3 +778,55 @@ func genComprehensionIndexingData(n int) map[string]interface{} {
 	}
 	return map[string]interface{}{"items": items}
 }
+
+func BenchmarkParallelPartialSet(b *testing.B) {
+	ctx := context.Background()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	workloads := []struct {
+		name string
+		rule func(int) string
+	}{
+		{"cpu", func(i int) string {
+			return fmt.Sprintf(`p[x] { x := count([y | y := numbers.range(0, 2000)[_]; y %% %d == 0]) }`, i+2)
+		}},
+		{"http", func(i int) string {
+			return fmt.Sprintf(`p[x] { x := http.send({"method": "get", "url": "%v/%d"}).status_code + %d }`, ts.URL, i, i)
+		}},
+	}
+
+	for _, w := range workloads {
+		rules := make([]string, 8)
+		for i := range rules {
+			rules[i] = w.rule(i)
+		}
+		compiler := ast.MustCompileModules(map[string]string{
+			"test.rego": "package test\n" + strings.Join(rules, "\n"),
+		})
+		body := ast.MustParseBody("data.test.p = x")
+
+		for _, n := range []int{1, 4, 8} {
+			b.Run(fmt.Sprintf("%v/parallelism=%d", w.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					q := NewQuery(body).
+						WithCompiler(compiler).
+						WithParallelism(n)
+
+					res, err := q.Run(ctx)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					if len(res) != 1 {
+						b.Fatalf("Expected one result, got %d", len(res))
+					}
+				}
+			})
+		}
+	}
+}